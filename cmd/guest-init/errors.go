@@ -6,16 +6,25 @@ import "errors"
 
 var (
 	ErrReadCmdline        = errors.New("read cmdline")
+	ErrOverlayRoot        = errors.New("set up overlay root")
 	ErrMissingDNS         = errors.New("missing matchlock.dns")
 	ErrInvalidMTU         = errors.New("invalid matchlock.mtu")
+	ErrInvalidSwap        = errors.New("invalid matchlock.swap_mb")
+	ErrSetupSwap          = errors.New("setup zram swap")
+	ErrLoadKernelModule   = errors.New("load kernel module")
+	ErrInvalidModules     = errors.New("invalid matchlock.modules")
 	ErrInvalidAddHost     = errors.New("invalid matchlock.add_host")
 	ErrWriteHostname      = errors.New("write hostname")
 	ErrWriteHosts         = errors.New("write hosts")
 	ErrWriteResolvConf    = errors.New("write resolv.conf")
 	ErrBringUpInterface   = errors.New("bring up interface")
 	ErrSetInterfaceMTU    = errors.New("set interface mtu")
+	ErrInvalidRoute       = errors.New("invalid matchlock.routes")
+	ErrAddRoute           = errors.New("add gateway route")
 	ErrStartGuestFused    = errors.New("start guest-fused")
 	ErrWorkspaceMount     = errors.New("check workspace mount")
 	ErrWorkspaceMountWait = errors.New("workspace mount timeout")
 	ErrExecGuestAgent     = errors.New("exec guest-agent")
+	ErrResolveUser        = errors.New("resolve image user")
+	ErrNetworkUnreachable = errors.New("network unreachable")
 )
@@ -7,6 +7,7 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -21,6 +22,7 @@ import (
 	"github.com/jingkaihe/matchlock/internal/errx"
 	guestagent "github.com/jingkaihe/matchlock/internal/guestruntime/agent"
 	guestfused "github.com/jingkaihe/matchlock/internal/guestruntime/fused"
+	"github.com/jingkaihe/matchlock/pkg/api"
 	"golang.org/x/sys/unix"
 )
 
@@ -34,7 +36,7 @@ const (
 	guestFusedPath = "/opt/matchlock/guest-fused"
 	guestAgentPath = "/opt/matchlock/guest-agent"
 
-	defaultWorkspace = "/workspace"
+	defaultWorkspace = api.DefaultWorkspace
 	defaultPATH      = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
 
 	networkInterface  = "eth0"
@@ -42,6 +44,16 @@ const (
 	workspaceWaitStep = 100 * time.Millisecond
 	workspaceWaitMax  = 30 * time.Second
 	fuseSuperMagic    = 0x65735546
+
+	// networkWaitMax stays well inside the host's 30s ready timeout so a
+	// dead network surfaces as network_unreachable, not a ready timeout.
+	networkWaitMax  = 15 * time.Second
+	networkWaitStep = 200 * time.Millisecond
+	networkDialMax  = time.Second
+
+	// logPrefix tags init diagnostics on the console so the host can
+	// attribute them (see api.ParseLogLine).
+	logPrefix = "[init] "
 )
 
 type diskMount struct {
@@ -55,12 +67,19 @@ type hostIPMapping struct {
 }
 
 type bootConfig struct {
-	DNSServers []string
-	Hostname   string
-	AddHosts   []hostIPMapping
-	Workspace  string
-	MTU        int
-	Disks      []diskMount
+	DNSServers    []string
+	SearchDomains []string
+	ResolvOptions []string
+	Hostname      string
+	AddHosts      []hostIPMapping
+	Workspace     string
+	MTU           int
+	SwapMB        int
+	Routes        []net.IP
+	Disks         []diskMount
+	User          string
+	NetworkProbe  string
+	Modules       kernelModules
 }
 
 func main() {
@@ -87,25 +106,47 @@ func runtimeRole() string {
 }
 
 func runInit() {
+	if err := switchToOverlayRoot(procCmdlinePath); err != nil {
+		fatal(err)
+	}
 	prepareBaseFilesystems()
 	cfg, err := parseBootConfig(procCmdlinePath)
 	if err != nil {
 		fatal(err)
 	}
+	for _, err := range loadKernelModulesDisk(cfg.Modules) {
+		warnf("%v", err)
+	}
 
 	_ = os.Setenv("PATH", defaultPATH)
 	configureCgroupDelegation()
 
+	// The image USER is resolved now, so an image naming a missing user
+	// fails boot instead of every exec.
+	if err := resolveBootUser(cfg.User); err != nil {
+		fatal(err)
+	}
+
 	if err := configureHostname(cfg.Hostname, cfg.AddHosts); err != nil {
 		fatal(err)
 	}
 
-	if err := writeResolvConf(etcResolvConfPath, cfg.DNSServers); err != nil {
+	if err := writeResolvConf(etcResolvConfPath, cfg); err != nil {
 		fatal(err)
 	}
 
 	bringUpNetwork(networkInterface, cfg.MTU)
+	if len(cfg.Routes) > 0 {
+		if err := addGatewayRoutes(networkInterface, cfg.Routes); err != nil {
+			warnf("%v", err)
+		}
+	}
 	mountExtraDisks(cfg.Disks)
+	if cfg.SwapMB > 0 {
+		if err := setupZramSwap(cfg.SwapMB); err != nil {
+			warnf("%v", err)
+		}
+	}
 
 	if err := startGuestFused(guestFusedPath); err != nil {
 		fatal(err)
@@ -115,18 +156,52 @@ func runInit() {
 		fatal(err)
 	}
 
+	if cfg.NetworkProbe != "" {
+		if err := waitForNetwork(cfg.NetworkProbe, networkWaitMax, net.DialTimeout); err != nil {
+			fatal(err)
+		}
+	}
+
 	if err := unix.Exec(guestAgentPath, []string{guestAgentPath}, os.Environ()); err != nil {
 		fatal(errx.With(ErrExecGuestAgent, ": %w", err))
 	}
 }
 
+// bootErrorCodes maps boot failures to the codes the host turns into typed
+// errors. Codes must match api.BootErrorCode.
+var bootErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrMissingDNS, "missing_dns"},
+	{ErrWorkspaceMountWait, "workspace_mount_timeout"},
+	{ErrExecGuestAgent, "exec_guest_agent"},
+	{ErrStartGuestFused, "start_guest_fused"},
+	{ErrOverlayRoot, "overlay_root"},
+	{ErrResolveUser, "resolve_user"},
+	{ErrNetworkUnreachable, "network_unreachable"},
+}
+
+// fatal reports a boot failure in the structured form parsed by
+// api.ParseBootError and exits.
 func fatal(err error) {
-	fmt.Fprintf(os.Stderr, "FATAL: %v\n", err)
+	fmt.Fprintln(os.Stderr, formatBootError(err))
 	os.Exit(1)
 }
 
+func formatBootError(err error) string {
+	code := "init_failed"
+	for _, c := range bootErrorCodes {
+		if errors.Is(err, c.err) {
+			code = c.code
+			break
+		}
+	}
+	return logPrefix + "MATCHLOCK_BOOT_ERROR: " + code + " " + err.Error()
+}
+
 func warnf(format string, args ...any) {
-	fmt.Fprintf(os.Stderr, "WARNING: "+format+"\n", args...)
+	fmt.Fprintf(os.Stderr, logPrefix+"WARNING: "+format+"\n", args...)
 }
 
 func parseBootConfig(cmdlinePath string) (*bootConfig, error) {
@@ -142,13 +217,19 @@ func parseBootConfig(cmdlinePath string) (*bootConfig, error) {
 	for _, field := range strings.Fields(string(data)) {
 		switch {
 		case strings.HasPrefix(field, "matchlock.dns="):
-			v := strings.TrimPrefix(field, "matchlock.dns=")
-			for _, ns := range strings.Split(v, ",") {
-				ns = strings.TrimSpace(ns)
-				if ns != "" {
-					cfg.DNSServers = append(cfg.DNSServers, ns)
-				}
-			}
+			cfg.DNSServers = append(cfg.DNSServers, splitList(strings.TrimPrefix(field, "matchlock.dns="))...)
+
+		case strings.HasPrefix(field, "matchlock.dns_search="):
+			cfg.SearchDomains = append(cfg.SearchDomains, splitList(strings.TrimPrefix(field, "matchlock.dns_search="))...)
+
+		case strings.HasPrefix(field, "matchlock.dns_options="):
+			cfg.ResolvOptions = append(cfg.ResolvOptions, splitList(strings.TrimPrefix(field, "matchlock.dns_options="))...)
+
+		case strings.HasPrefix(field, "matchlock.wait_network="):
+			cfg.NetworkProbe = strings.TrimPrefix(field, "matchlock.wait_network=")
+
+		case strings.HasPrefix(field, "matchlock.user="):
+			cfg.User = strings.TrimPrefix(field, "matchlock.user=")
 
 		case strings.HasPrefix(field, "hostname="):
 			v := strings.TrimPrefix(field, "hostname=")
@@ -170,6 +251,31 @@ func parseBootConfig(cmdlinePath string) (*bootConfig, error) {
 			}
 			cfg.MTU = mtu
 
+		case strings.HasPrefix(field, "matchlock.swap_mb="):
+			v := strings.TrimPrefix(field, "matchlock.swap_mb=")
+			swapMB, convErr := strconv.Atoi(v)
+			if convErr != nil || swapMB < 0 {
+				return nil, errx.With(ErrInvalidSwap, ": %q", v)
+			}
+			cfg.SwapMB = swapMB
+
+		case strings.HasPrefix(field, "matchlock.routes="):
+			v := strings.TrimPrefix(field, "matchlock.routes=")
+			for _, host := range strings.Split(v, ",") {
+				ip := net.ParseIP(host).To4()
+				if ip == nil {
+					return nil, errx.With(ErrInvalidRoute, ": %q", host)
+				}
+				cfg.Routes = append(cfg.Routes, ip)
+			}
+
+		case strings.HasPrefix(field, "matchlock.modules="):
+			mods, parseErr := parseKernelModulesParam(strings.TrimPrefix(field, "matchlock.modules="))
+			if parseErr != nil {
+				return nil, parseErr
+			}
+			cfg.Modules = mods
+
 		case strings.HasPrefix(field, "matchlock.disk."):
 			spec := strings.TrimPrefix(field, "matchlock.disk.")
 			i := strings.IndexByte(spec, '=')
@@ -199,6 +305,30 @@ func parseBootConfig(cmdlinePath string) (*bootConfig, error) {
 	return cfg, nil
 }
 
+// resolveBootUser checks that the user guest commands default to exists in
+// the rootfs. The guest agent reads the same matchlock.user= param itself.
+func resolveBootUser(user string) error {
+	if user == "" {
+		return nil
+	}
+	if _, _, _, err := guestagent.ResolveUser(user); err != nil {
+		return errx.With(ErrResolveUser, " %q: %w", user, err)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated cmdline value, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func prepareBaseFilesystems() {
 	_ = unix.Mount("", "/", "", unix.MS_REMOUNT, "rw")
 
@@ -316,11 +446,19 @@ func renderEtcHosts(hostname string, addHosts []hostIPMapping) string {
 	return b.String()
 }
 
-func writeResolvConf(path string, servers []string) error {
+func writeResolvConf(path string, cfg *bootConfig) error {
 	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 		return errx.With(ErrWriteResolvConf, " remove %s: %w", path, err)
 	}
 
+	content := renderResolvConf(cfg.DNSServers, cfg.SearchDomains, cfg.ResolvOptions)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return errx.With(ErrWriteResolvConf, " write %s: %w", path, err)
+	}
+	return nil
+}
+
+func renderResolvConf(servers, searchDomains, options []string) string {
 	var b strings.Builder
 	for _, ns := range servers {
 		if ns == "" {
@@ -330,11 +468,17 @@ func writeResolvConf(path string, servers []string) error {
 		b.WriteString(ns)
 		b.WriteByte('\n')
 	}
-
-	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
-		return errx.With(ErrWriteResolvConf, " write %s: %w", path, err)
+	if len(searchDomains) > 0 {
+		b.WriteString("search ")
+		b.WriteString(strings.Join(searchDomains, " "))
+		b.WriteByte('\n')
 	}
-	return nil
+	if len(options) > 0 {
+		b.WriteString("options ")
+		b.WriteString(strings.Join(options, " "))
+		b.WriteByte('\n')
+	}
+	return b.String()
 }
 
 func bringUpNetwork(iface string, mtu int) {
@@ -500,6 +644,23 @@ func waitForWorkspaceMount(mountsPath, workspace string, timeout time.Duration)
 	}
 }
 
+// waitForNetwork retries a TCP connect to probe until one succeeds, so the
+// guest agent only signals ready once egress works.
+func waitForNetwork(probe string, timeout time.Duration, dial func(network, addr string, timeout time.Duration) (net.Conn, error)) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := dial("tcp", probe, networkDialMax)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return errx.With(ErrNetworkUnreachable, ": %s: %w", probe, err)
+		}
+		time.Sleep(networkWaitStep)
+	}
+}
+
 func workspaceMounted(mountsPath, workspace string) (bool, error) {
 	f, err := os.Open(mountsPath)
 	if err != nil {
@@ -3,12 +3,23 @@
 package main
 
 import (
+	"encoding/binary"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
 )
 
 func TestParseBootConfig(t *testing.T) {
@@ -31,6 +42,39 @@ func TestParseBootConfig(t *testing.T) {
 	assert.Equal(t, hostIPMapping{Host: "api.internal", IP: "10.0.0.10"}, cfg.AddHosts[0])
 }
 
+func TestParseBootConfigResolv(t *testing.T) {
+	dir := t.TempDir()
+	cmdline := filepath.Join(dir, "cmdline")
+	content := "matchlock.dns=10.0.0.53 matchlock.dns_search=svc.cluster.local,cluster.local matchlock.dns_options=ndots:2,rotate"
+	require.NoError(t, os.WriteFile(cmdline, []byte(content), 0644))
+
+	cfg, err := parseBootConfig(cmdline)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"svc.cluster.local", "cluster.local"}, cfg.SearchDomains)
+	assert.Equal(t, []string{"ndots:2", "rotate"}, cfg.ResolvOptions)
+}
+
+func TestParseBootConfigUser(t *testing.T) {
+	dir := t.TempDir()
+	cmdline := filepath.Join(dir, "cmdline")
+	require.NoError(t, os.WriteFile(cmdline, []byte("matchlock.dns=10.0.0.53 matchlock.user=nginx"), 0644))
+
+	cfg, err := parseBootConfig(cmdline)
+	require.NoError(t, err)
+	assert.Equal(t, "nginx", cfg.User)
+
+	require.NoError(t, resolveBootUser(""))
+	require.NoError(t, resolveBootUser("1000:1000"))
+	require.ErrorIs(t, resolveBootUser("no-such-matchlock-user"), ErrResolveUser)
+}
+
+func TestRenderResolvConf(t *testing.T) {
+	assert.Equal(t, "nameserver 8.8.8.8\nnameserver 8.8.4.4\n", renderResolvConf([]string{"8.8.8.8", "8.8.4.4"}, nil, nil))
+	assert.Equal(t,
+		"nameserver 10.0.0.53\nsearch svc.cluster.local cluster.local\noptions ndots:2 rotate\n",
+		renderResolvConf([]string{"10.0.0.53"}, []string{"svc.cluster.local", "cluster.local"}, []string{"ndots:2", "rotate"}))
+}
+
 func TestParseBootConfigDefaultsWorkspace(t *testing.T) {
 	dir := t.TempDir()
 	cmdline := filepath.Join(dir, "cmdline")
@@ -54,6 +98,28 @@ func TestParseBootConfigRequiresDNS(t *testing.T) {
 	assert.ErrorIs(t, err, ErrMissingDNS)
 }
 
+func TestFormatBootErrorRoundTrips(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{ErrMissingDNS, api.ErrBootMissingDNS},
+		{errx.With(ErrWorkspaceMountWait, ": %s", "/workspace"), api.ErrBootWorkspaceMountWait},
+		{errx.With(ErrExecGuestAgent, ": %w", os.ErrNotExist), api.ErrBootExecGuestAgent},
+		{errx.With(ErrStartGuestFused, " %s: %w", guestFusedPath, os.ErrNotExist), api.ErrBootStartGuestFused},
+		{errx.With(ErrOverlayRoot, ": mount overlay: %w", os.ErrPermission), api.ErrBootOverlayRoot},
+		{errx.With(ErrResolveUser, " %q: %w", "appuser", os.ErrNotExist), api.ErrBootResolveUser},
+		{errx.With(ErrNetworkUnreachable, ": %s: %w", "8.8.8.8:53", os.ErrDeadlineExceeded), api.ErrBootNetworkUnreachable},
+		{ErrReadCmdline, api.ErrBootFailed},
+	}
+	for _, tt := range tests {
+		bootErr := api.ParseBootError(formatBootError(tt.err))
+		require.NotNil(t, bootErr, tt.err.Error())
+		assert.ErrorIs(t, bootErr, tt.want)
+		assert.Equal(t, tt.err.Error(), bootErr.Message)
+	}
+}
+
 func TestParseBootConfigRejectsInvalidMTU(t *testing.T) {
 	dir := t.TempDir()
 	cmdline := filepath.Join(dir, "cmdline")
@@ -65,6 +131,113 @@ func TestParseBootConfigRejectsInvalidMTU(t *testing.T) {
 	assert.ErrorIs(t, err, ErrInvalidMTU)
 }
 
+func TestParseBootConfigSwap(t *testing.T) {
+	dir := t.TempDir()
+	cmdline := filepath.Join(dir, "cmdline")
+	require.NoError(t, os.WriteFile(cmdline, []byte("matchlock.dns=1.1.1.1 matchlock.swap_mb=768"), 0644))
+
+	cfg, err := parseBootConfig(cmdline)
+	require.NoError(t, err)
+	assert.Equal(t, 768, cfg.SwapMB)
+
+	require.NoError(t, os.WriteFile(cmdline, []byte("matchlock.dns=1.1.1.1 matchlock.swap_mb=-1"), 0644))
+	_, err = parseBootConfig(cmdline)
+	assert.ErrorIs(t, err, ErrInvalidSwap)
+}
+
+func TestParseBootConfigRoutes(t *testing.T) {
+	dir := t.TempDir()
+	cmdline := filepath.Join(dir, "cmdline")
+	require.NoError(t, os.WriteFile(cmdline, []byte("matchlock.dns=1.1.1.1 matchlock.routes=192.168.100.50,10.0.0.9"), 0644))
+
+	cfg, err := parseBootConfig(cmdline)
+	require.NoError(t, err)
+	require.Len(t, cfg.Routes, 2)
+	assert.Equal(t, "192.168.100.50", cfg.Routes[0].String())
+	assert.Equal(t, "10.0.0.9", cfg.Routes[1].String())
+
+	require.NoError(t, os.WriteFile(cmdline, []byte("matchlock.dns=1.1.1.1 matchlock.routes=db.internal"), 0644))
+	_, err = parseBootConfig(cmdline)
+	assert.ErrorIs(t, err, ErrInvalidRoute)
+}
+
+func TestParseBootConfigWaitNetwork(t *testing.T) {
+	dir := t.TempDir()
+	cmdline := filepath.Join(dir, "cmdline")
+	require.NoError(t, os.WriteFile(cmdline, []byte("matchlock.dns=1.1.1.1 matchlock.wait_network=example.com:443"), 0644))
+
+	cfg, err := parseBootConfig(cmdline)
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:443", cfg.NetworkProbe)
+}
+
+func TestWaitForNetworkRetriesUntilConnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	attempts := 0
+	dial := func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		attempts++
+		if attempts < 3 {
+			return nil, syscall.ENETUNREACH
+		}
+		return net.DialTimeout(network, addr, timeout)
+	}
+	require.NoError(t, waitForNetwork(ln.Addr().String(), 5*time.Second, dial))
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWaitForNetworkTimesOut(t *testing.T) {
+	dial := func(network, addr string, timeout time.Duration) (net.Conn, error) {
+		return nil, syscall.ENETUNREACH
+	}
+	err := waitForNetwork("10.0.0.1:53", 0, dial)
+	require.ErrorIs(t, err, ErrNetworkUnreachable)
+	assert.ErrorIs(t, err, syscall.ENETUNREACH)
+}
+
+func TestDefaultGateway(t *testing.T) {
+	routes := filepath.Join(t.TempDir(), "route")
+	// /proc/net/route prints the network-order address as a host-order word.
+	gateway := fmt.Sprintf("%08X", binary.NativeEndian.Uint32([]byte{192, 168, 100, 1}))
+	table := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n" +
+		"eth0\t0064A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\t0\t0\t0\n" +
+		"eth0\t00000000\t" + gateway + "\t0003\t0\t0\t0\t00000000\t0\t0\t0\n"
+	require.NoError(t, os.WriteFile(routes, []byte(table), 0644))
+
+	ip, err := defaultGateway(routes, "eth0")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.100.1", ip.String())
+
+	_, err = defaultGateway(routes, "eth1")
+	assert.ErrorIs(t, err, ErrAddRoute)
+}
+
+func TestRtentryLayout(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("layout checked on 64-bit targets")
+	}
+	var rt rtentry
+	assert.Equal(t, uintptr(120), unsafe.Sizeof(rt))
+	assert.Equal(t, uintptr(56), unsafe.Offsetof(rt.flags))
+	assert.Equal(t, uintptr(80), unsafe.Offsetof(rt.metric))
+	assert.Equal(t, uintptr(88), unsafe.Offsetof(rt.dev))
+}
+
+func TestOverlayRootDevice(t *testing.T) {
+	assert.Equal(t, "vdc", overlayRootDevice("console=ttyS0 matchlock.overlay_root=vdc matchlock.dns=8.8.8.8"))
+	assert.Empty(t, overlayRootDevice("console=ttyS0 matchlock.dns=8.8.8.8"))
+}
+
+func TestSwapHeader(t *testing.T) {
+	page := swapHeader(4096, 8<<20)
+	require.Len(t, page, 4096)
+	assert.Equal(t, uint32(1), binary.NativeEndian.Uint32(page[1024:]))
+	assert.Equal(t, uint32(2047), binary.NativeEndian.Uint32(page[1028:]))
+	assert.Equal(t, "SWAPSPACE2", string(page[4096-10:]))
+}
+
 func TestParseBootConfigRejectsInvalidAddHost(t *testing.T) {
 	dir := t.TempDir()
 	cmdline := filepath.Join(dir, "cmdline")
@@ -114,3 +287,38 @@ func TestWriteEtcHostsCreatesFile(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, renderEtcHosts("vm-12345678", []hostIPMapping{{Host: "api.internal", IP: "10.0.0.10"}}), string(data))
 }
+
+func TestLoadKernelModules(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"00-nf_tables.ko", "01-nft_chain_nat.ko", "02-broken.ko", "99-unlisted.ko"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	var loaded []string
+	errs := loadKernelModules(dir, []string{"00-nf_tables.ko", "01-nft_chain_nat.ko", "02-broken.ko"}, func(path string) error {
+		loaded = append(loaded, filepath.Base(path))
+		if strings.Contains(path, "broken") {
+			return unix.ENOEXEC
+		}
+		return nil
+	})
+
+	assert.Equal(t, []string{"00-nf_tables.ko", "01-nft_chain_nat.ko", "02-broken.ko"}, loaded)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrLoadKernelModule)
+	assert.ErrorIs(t, errs[0], unix.ENOEXEC)
+	assert.Contains(t, errs[0].Error(), "02-broken.ko")
+
+	assert.Empty(t, loadKernelModulesDisk(kernelModules{}))
+}
+
+func TestParseKernelModulesParam(t *testing.T) {
+	mods, err := parseKernelModulesParam("vdc:00-nf_tables.ko,01-nft_nat.ko")
+	require.NoError(t, err)
+	assert.Equal(t, kernelModules{Device: "vdc", Names: []string{"00-nf_tables.ko", "01-nft_nat.ko"}}, mods)
+
+	for _, bad := range []string{"00-nf_tables.ko", ":00-a.ko", "vdc:../evil.ko", "vdc:sub/a.ko", "vdc:a.so", "../sda:a.ko"} {
+		_, err := parseKernelModulesParam(bad)
+		assert.ErrorIs(t, err, ErrInvalidModules, bad)
+	}
+}
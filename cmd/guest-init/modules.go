@@ -0,0 +1,86 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"golang.org/x/sys/unix"
+)
+
+// modulesMountDir is where the host's read-only modules disk (see
+// api.Config.KernelModules) is mounted while its modules load.
+const modulesMountDir = "/run/matchlock-modules"
+
+// kernelModules is the matchlock.modules=<device>:<name>,... cmdline param:
+// the modules disk and the files on it to load, in order.
+type kernelModules struct {
+	Device string
+	Names  []string
+}
+
+func parseKernelModulesParam(v string) (kernelModules, error) {
+	device, list, ok := strings.Cut(v, ":")
+	if !ok || device == "" || strings.Contains(device, "/") {
+		return kernelModules{}, errx.With(ErrInvalidModules, ": %q", v)
+	}
+	names := splitList(list)
+	for _, name := range names {
+		if strings.Contains(name, "/") || filepath.Ext(name) != ".ko" {
+			return kernelModules{}, errx.With(ErrInvalidModules, ": %q", name)
+		}
+	}
+	return kernelModules{Device: device, Names: names}, nil
+}
+
+// loadKernelModulesDisk mounts the modules disk read-only, loads the
+// modules the host listed and unmounts it again. Nothing is loaded from the
+// rootfs, which the image or an earlier session may have written.
+func loadKernelModulesDisk(mods kernelModules) []error {
+	if len(mods.Names) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(modulesMountDir, 0700); err != nil {
+		return []error{errx.With(ErrLoadKernelModule, ": %w", err)}
+	}
+	devicePath := "/dev/" + mods.Device
+	if err := unix.Mount(devicePath, modulesMountDir, "ext4", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return []error{errx.With(ErrLoadKernelModule, ": mount %s: %w", devicePath, err)}
+	}
+	defer func() {
+		_ = unix.Unmount(modulesMountDir, unix.MNT_DETACH)
+		_ = os.Remove(modulesMountDir)
+	}()
+	return loadKernelModules(modulesMountDir, mods.Names, finitModule)
+}
+
+// loadKernelModules loads names from dir, in order, with load. A module
+// that fails does not stop the rest; each failure is returned so it can be
+// reported on the console.
+func loadKernelModules(dir string, names []string, load func(path string) error) []error {
+	var errs []error
+	for _, name := range names {
+		if err := load(filepath.Join(dir, name)); err != nil {
+			errs = append(errs, errx.With(ErrLoadKernelModule, " %s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// finitModule is the in-process equivalent of insmod, so images need no
+// kmod tools. A module that is already loaded or built in is not an error.
+func finitModule(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := unix.FinitModule(int(f.Fd()), "", 0); err != nil && !errors.Is(err, unix.EEXIST) {
+		return err
+	}
+	return nil
+}
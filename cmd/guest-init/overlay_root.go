@@ -0,0 +1,101 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// overlayRootScratch holds the upper disk and the merged root while
+	// they are assembled. It lives on a tmpfs mounted over the read-only
+	// base's /run, which is hidden again once the root is switched.
+	overlayRootScratch = "/run/matchlock-root"
+	overlayRootParam   = "matchlock.overlay_root="
+)
+
+// overlayRootDevice returns the block device named by matchlock.overlay_root=
+// on the kernel cmdline, or "" when the rootfs is writable as booted.
+func overlayRootDevice(cmdline string) string {
+	for _, field := range strings.Fields(cmdline) {
+		if dev, ok := strings.CutPrefix(field, overlayRootParam); ok {
+			return dev
+		}
+	}
+	return ""
+}
+
+// switchToOverlayRoot runs before anything else in PID 1 when the VM boots
+// from a shared read-only base. It mounts the per-VM upper disk, stacks an
+// overlayfs over the base and pivots into it, so the rest of boot and the
+// workload see a normal writable root while the base image is never
+// written.
+func switchToOverlayRoot(cmdlinePath string) error {
+	if err := unix.Mount("proc", "/proc", "proc", 0, ""); err != nil && err != unix.EBUSY {
+		return errx.With(ErrOverlayRoot, ": mount /proc: %w", err)
+	}
+	data, err := os.ReadFile(cmdlinePath)
+	unix.Unmount("/proc", unix.MNT_DETACH)
+	if err != nil {
+		return errx.Wrap(ErrReadCmdline, err)
+	}
+	dev := overlayRootDevice(string(data))
+	if dev == "" {
+		return nil
+	}
+
+	if err := unix.Mount("tmpfs", "/run", "tmpfs", 0, ""); err != nil {
+		return errx.With(ErrOverlayRoot, ": mount scratch tmpfs: %w", err)
+	}
+	diskDir := filepath.Join(overlayRootScratch, "disk")
+	newRoot := filepath.Join(overlayRootScratch, "root")
+	for _, dir := range []string{diskDir, newRoot} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errx.With(ErrOverlayRoot, ": create %s: %w", dir, err)
+		}
+	}
+
+	devicePath := "/dev/" + dev
+	if err := unix.Mount("devtmpfs", "/dev", "devtmpfs", 0, ""); err != nil && err != unix.EBUSY {
+		return errx.With(ErrOverlayRoot, ": mount /dev: %w", err)
+	}
+	err = unix.Mount(devicePath, diskDir, "ext4", 0, "")
+	unix.Unmount("/dev", unix.MNT_DETACH)
+	if err != nil {
+		return errx.With(ErrOverlayRoot, ": mount %s: %w", devicePath, err)
+	}
+
+	upper := filepath.Join(diskDir, "upper")
+	work := filepath.Join(diskDir, "work")
+	for _, dir := range []string{upper, work} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errx.With(ErrOverlayRoot, ": create %s: %w", dir, err)
+		}
+	}
+	opts := "lowerdir=/,upperdir=" + upper + ",workdir=" + work
+	if err := unix.Mount("overlay", newRoot, "overlay", 0, opts); err != nil {
+		return errx.With(ErrOverlayRoot, ": mount overlay: %w", err)
+	}
+
+	// pivot_root(".", ".") stacks the old root on top of the new one; the
+	// lazy unmount then reveals the overlay. The base stays referenced as
+	// the overlay's lower layer.
+	if err := unix.Chdir(newRoot); err != nil {
+		return errx.With(ErrOverlayRoot, ": chdir: %w", err)
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return errx.With(ErrOverlayRoot, ": pivot_root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return errx.With(ErrOverlayRoot, ": detach base root: %w", err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return errx.With(ErrOverlayRoot, ": chdir: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"golang.org/x/sys/unix"
+)
+
+const procNetRoutePath = "/proc/net/route"
+
+// rtentry mirrors struct rtentry for SIOCADDRT.
+type rtentry struct {
+	pad1    uintptr
+	dst     unix.RawSockaddrInet4
+	gateway unix.RawSockaddrInet4
+	genmask unix.RawSockaddrInet4
+	flags   uint16
+	pad2    int16
+	pad3    uintptr
+	pad4    uintptr
+	metric  int16
+	dev     *byte
+	mtu     uintptr
+	window  uintptr
+	irtt    uint16
+}
+
+// addGatewayRoutes adds a /32 route via the interface's default gateway for
+// each host, so allowed private services are reached through the host even
+// when they fall inside the guest's own subnet.
+func addGatewayRoutes(iface string, hosts []net.IP) error {
+	gateway, err := defaultGateway(procNetRoutePath, iface)
+	if err != nil {
+		return err
+	}
+
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM, 0)
+	if err != nil {
+		return errx.With(ErrAddRoute, " socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	dev := append([]byte(iface), 0)
+	for _, host := range hosts {
+		if host.Equal(gateway) {
+			continue
+		}
+		rt := rtentry{
+			dst:     sockaddrInet4(host),
+			gateway: sockaddrInet4(gateway),
+			genmask: sockaddrInet4(net.IPv4bcast),
+			flags:   unix.RTF_UP | unix.RTF_GATEWAY | unix.RTF_HOST,
+			dev:     &dev[0],
+		}
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), unix.SIOCADDRT, uintptr(unsafe.Pointer(&rt)))
+		if errno != 0 && errno != unix.EEXIST {
+			return errx.With(ErrAddRoute, " %s via %s: %v", host, gateway, errno)
+		}
+	}
+	return nil
+}
+
+// defaultGateway returns the IPv4 default gateway of iface from a
+// /proc/net/route style table.
+func defaultGateway(routePath, iface string) (net.IP, error) {
+	f, err := os.Open(routePath)
+	if err != nil {
+		return nil, errx.With(ErrAddRoute, " read routes: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[0] != iface || fields[1] != "00000000" {
+			continue
+		}
+		// The kernel prints the network-order address as a host-order hex word.
+		v, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			continue
+		}
+		gw := make(net.IP, 4)
+		binary.NativeEndian.PutUint32(gw, uint32(v))
+		return gw, nil
+	}
+	return nil, errx.With(ErrAddRoute, ": no default gateway on %s", iface)
+}
+
+func sockaddrInet4(ip net.IP) unix.RawSockaddrInet4 {
+	sa := unix.RawSockaddrInet4{Family: unix.AF_INET}
+	copy(sa.Addr[:], ip.To4())
+	return sa
+}
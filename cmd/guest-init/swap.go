@@ -0,0 +1,64 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"strconv"
+	"unsafe"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	zramDevicePath   = "/dev/zram0"
+	zramDisksizePath = "/sys/block/zram0/disksize"
+
+	// Offsets into the first page of a v1 swap area (union swap_header).
+	swapHeaderInfoOffset = 1024
+	swapMagic            = "SWAPSPACE2"
+)
+
+// setupZramSwap sizes /dev/zram0, formats it as swap and enables it. It is
+// the in-process equivalent of mkswap + swapon, so it works on images that
+// ship neither.
+func setupZramSwap(swapMB int) error {
+	size := int64(swapMB) << 20
+	if err := os.WriteFile(zramDisksizePath, []byte(strconv.FormatInt(size, 10)), 0644); err != nil {
+		return errx.With(ErrSetupSwap, " set zram disksize: %w", err)
+	}
+
+	dev, err := os.OpenFile(zramDevicePath, os.O_WRONLY, 0)
+	if err != nil {
+		return errx.With(ErrSetupSwap, " open %s: %w", zramDevicePath, err)
+	}
+	_, err = dev.WriteAt(swapHeader(os.Getpagesize(), size), 0)
+	if err == nil {
+		err = dev.Sync()
+	}
+	dev.Close()
+	if err != nil {
+		return errx.With(ErrSetupSwap, " mkswap %s: %w", zramDevicePath, err)
+	}
+
+	path, err := unix.BytePtrFromString(zramDevicePath)
+	if err != nil {
+		return errx.With(ErrSetupSwap, " swapon: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SWAPON, uintptr(unsafe.Pointer(path)), 0, 0); errno != 0 {
+		return errx.With(ErrSetupSwap, " swapon %s: %w", zramDevicePath, errno)
+	}
+	return nil
+}
+
+// swapHeader returns the first page of a v1 swap area covering size bytes.
+func swapHeader(pageSize int, size int64) []byte {
+	page := make([]byte, pageSize)
+	info := page[swapHeaderInfoOffset:]
+	binary.NativeEndian.PutUint32(info[0:], 1)                              // version
+	binary.NativeEndian.PutUint32(info[4:], uint32(size/int64(pageSize))-1) // last_page
+	copy(page[pageSize-len(swapMagic):], swapMagic)
+	return page
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+	"github.com/jingkaihe/matchlock/pkg/state"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp [flags] <src> <dst>",
+	Short: "Copy files between the host and a running sandbox",
+	Long: `Copy files or directories between the host and a running sandbox, like
+docker cp. Exactly one of src and dst names the sandbox as <id>:<path>.
+
+Sandbox paths must lie in the workspace or a VFS mount. Directories are
+copied recursively and file modes are preserved. If dst is an existing
+directory, src is copied into it. Symlinks are copied as symlinks unless
+-L is given, which copies what they point to instead.
+
+The sandbox must have been started with --rm=false to remain running.`,
+	Example: `  matchlock cp ./data vm-abc123:/workspace/data
+  matchlock cp vm-abc123:/workspace/out/report.json .
+  matchlock cp -L vm-abc123:/workspace/latest ./latest`,
+	Args: cobra.ExactArgs(2),
+	RunE: runCp,
+}
+
+func init() {
+	cpCmd.Flags().BoolP("follow-link", "L", false, "Follow symlinks in the source and copy their targets")
+	rootCmd.AddCommand(cpCmd)
+}
+
+// cpEndpoint is one side of a copy: a sandbox path when vmID is set,
+// otherwise a host path.
+type cpEndpoint struct {
+	vmID string
+	path string
+}
+
+// parseCpEndpoint splits "<id>:<path>" into a sandbox endpoint. Anything
+// else, including paths whose first colon follows a slash, is a host path.
+func parseCpEndpoint(arg string) cpEndpoint {
+	if id, p, ok := strings.Cut(arg, ":"); ok && id != "" && !strings.ContainsAny(id, `/\`) {
+		return cpEndpoint{vmID: id, path: p}
+	}
+	return cpEndpoint{path: arg}
+}
+
+func runCp(cmd *cobra.Command, args []string) error {
+	follow, _ := cmd.Flags().GetBool("follow-link")
+	src, dst := parseCpEndpoint(args[0]), parseCpEndpoint(args[1])
+	if (src.vmID == "") == (dst.vmID == "") {
+		return errx.With(ErrInvalidCp, ": exactly one of src and dst must be <id>:<path>")
+	}
+
+	ep := src
+	if ep.vmID == "" {
+		ep = dst
+	}
+	if !path.IsAbs(ep.path) {
+		return errx.With(ErrInvalidCp, ": sandbox path %q must be absolute", ep.path)
+	}
+	socketPath, err := relaySocketPath(ep.vmID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := contextWithSignal(context.Background())
+	defer cancel()
+
+	var srcFS, dstFS cpFS = hostCpFS{}, hostCpFS{}
+	if src.vmID != "" {
+		srcFS = guestCpFS{socketPath: socketPath}
+	} else {
+		dstFS = guestCpFS{socketPath: socketPath}
+	}
+	if err := copyPath(ctx, srcFS, src.path, dstFS, dst.path, follow); err != nil {
+		return errx.Wrap(ErrCopy, err)
+	}
+	return nil
+}
+
+// relaySocketPath returns the exec relay socket of running sandbox vmID.
+func relaySocketPath(vmID string) (string, error) {
+	mgr := state.NewManager()
+	vmState, err := mgr.Get(vmID)
+	if err != nil {
+		return "", errx.With(ErrVMNotFound, " %s: %w", vmID, err)
+	}
+	if vmState.Status != "running" {
+		return "", fmt.Errorf("VM %s is not running (status: %s)", vmID, vmState.Status)
+	}
+	socketPath := mgr.ExecSocketPath(vmID)
+	if _, err := os.Stat(socketPath); err != nil {
+		return "", fmt.Errorf("exec socket not found for %s (was it started with --rm=false?)", vmID)
+	}
+	return socketPath, nil
+}
+
+// cpFS is the side of a copy that files are read from or written to.
+type cpFS interface {
+	Stat(ctx context.Context, p string, follow bool) (api.FileInfo, error)
+	List(ctx context.Context, p string) ([]api.FileInfo, error)
+	Read(ctx context.Context, p string) ([]byte, error)
+	Readlink(ctx context.Context, p string) (string, error)
+	Write(ctx context.Context, p string, content []byte, mode fs.FileMode) error
+	Mkdir(ctx context.Context, p string, mode fs.FileMode) error
+	Symlink(ctx context.Context, target, p string) error
+	Join(dir, name string) string
+	Base(p string) string
+}
+
+// copyPath copies src to dst with docker cp semantics: an existing
+// directory at dst receives src under its own name.
+func copyPath(ctx context.Context, src cpFS, srcPath string, dst cpFS, dstPath string, follow bool) error {
+	if info, err := dst.Stat(ctx, dstPath, true); err == nil && info.IsDir {
+		dstPath = dst.Join(dstPath, src.Base(srcPath))
+	}
+	return copyTree(ctx, src, srcPath, dst, dstPath, follow)
+}
+
+func copyTree(ctx context.Context, src cpFS, srcPath string, dst cpFS, dstPath string, follow bool) error {
+	info, err := src.Stat(ctx, srcPath, follow)
+	if err != nil {
+		return err
+	}
+	mode := fs.FileMode(info.Mode)
+
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		target, err := src.Readlink(ctx, srcPath)
+		if err != nil {
+			return err
+		}
+		return dst.Symlink(ctx, target, dstPath)
+	case info.IsDir:
+		if err := dst.Mkdir(ctx, dstPath, mode.Perm()); err != nil {
+			return err
+		}
+		entries, err := src.List(ctx, srcPath)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := copyTree(ctx, src, src.Join(srcPath, e.Name), dst, dst.Join(dstPath, e.Name), follow); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		content, err := src.Read(ctx, srcPath)
+		if err != nil {
+			return err
+		}
+		return dst.Write(ctx, dstPath, content, mode.Perm())
+	}
+}
+
+type hostCpFS struct{}
+
+func (hostCpFS) Stat(_ context.Context, p string, follow bool) (api.FileInfo, error) {
+	stat := os.Lstat
+	if follow {
+		stat = os.Stat
+	}
+	info, err := stat(p)
+	if err != nil {
+		return api.FileInfo{}, err
+	}
+	return api.FileInfo{Name: info.Name(), Size: info.Size(), Mode: uint32(info.Mode()), IsDir: info.IsDir()}, nil
+}
+
+func (hostCpFS) List(_ context.Context, p string) ([]api.FileInfo, error) {
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]api.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		files = append(files, api.FileInfo{Name: e.Name(), IsDir: e.IsDir()})
+	}
+	return files, nil
+}
+
+func (hostCpFS) Read(_ context.Context, p string) ([]byte, error) { return os.ReadFile(p) }
+
+func (hostCpFS) Readlink(_ context.Context, p string) (string, error) { return os.Readlink(p) }
+
+// Write and Mkdir never follow a symlink already at p: an earlier copy out
+// of the sandbox may have left one there, pointing anywhere on the host.
+func (hostCpFS) Write(_ context.Context, p string, content []byte, mode fs.FileMode) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|syscall.O_NOFOLLOW, mode)
+	if err != nil {
+		if errors.Is(err, syscall.ELOOP) {
+			return errx.With(ErrCpSymlink, " %s", p)
+		}
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return err
+	}
+	// OpenFile applies the umask and leaves existing files' modes alone.
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (hostCpFS) Mkdir(_ context.Context, p string, mode fs.FileMode) error {
+	if err := os.Mkdir(p, mode); err != nil {
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		info, lerr := os.Lstat(p)
+		switch {
+		case lerr != nil:
+			return lerr
+		case info.Mode()&fs.ModeSymlink != 0:
+			return errx.With(ErrCpSymlink, " %s", p)
+		case !info.IsDir():
+			return err
+		}
+		return nil
+	}
+	return os.Chmod(p, mode)
+}
+
+func (hostCpFS) Symlink(_ context.Context, target, p string) error { return os.Symlink(target, p) }
+
+func (hostCpFS) Join(dir, name string) string { return filepath.Join(dir, name) }
+
+func (hostCpFS) Base(p string) string { return filepath.Base(p) }
+
+// guestCpFS reaches the sandbox VFS through its exec relay.
+type guestCpFS struct {
+	socketPath string
+}
+
+func (g guestCpFS) Stat(ctx context.Context, p string, follow bool) (api.FileInfo, error) {
+	return sandbox.StatViaRelay(ctx, g.socketPath, p, follow)
+}
+
+func (g guestCpFS) List(ctx context.Context, p string) ([]api.FileInfo, error) {
+	return sandbox.ListFilesViaRelay(ctx, g.socketPath, p)
+}
+
+func (g guestCpFS) Read(ctx context.Context, p string) ([]byte, error) {
+	return sandbox.ReadFileViaRelay(ctx, g.socketPath, p)
+}
+
+func (g guestCpFS) Readlink(ctx context.Context, p string) (string, error) {
+	return sandbox.ReadlinkViaRelay(ctx, g.socketPath, p)
+}
+
+func (g guestCpFS) Write(ctx context.Context, p string, content []byte, mode fs.FileMode) error {
+	return sandbox.WriteFileViaRelay(ctx, g.socketPath, p, content, uint32(mode))
+}
+
+func (g guestCpFS) Mkdir(ctx context.Context, p string, mode fs.FileMode) error {
+	return sandbox.MkdirViaRelay(ctx, g.socketPath, p, uint32(mode))
+}
+
+func (g guestCpFS) Symlink(ctx context.Context, target, p string) error {
+	return sandbox.SymlinkViaRelay(ctx, g.socketPath, target, p)
+}
+
+func (guestCpFS) Join(dir, name string) string { return path.Join(dir, name) }
+
+func (guestCpFS) Base(p string) string { return path.Base(p) }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCpEndpoint(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want cpEndpoint
+	}{
+		{"vm-abc123:/workspace/out", cpEndpoint{vmID: "vm-abc123", path: "/workspace/out"}},
+		{"vm-abc123:", cpEndpoint{vmID: "vm-abc123", path: ""}},
+		{"./data", cpEndpoint{path: "./data"}},
+		{"/tmp/a:b", cpEndpoint{path: "/tmp/a:b"}},
+		{"./a:b", cpEndpoint{path: "./a:b"}},
+		{":/workspace", cpEndpoint{path: ":/workspace"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseCpEndpoint(tt.arg))
+		})
+	}
+}
+
+func TestCopyPathPreservesTreeAndModes(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "bin", "run.sh"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "secret"), []byte("s"), 0600))
+	require.NoError(t, os.Symlink("bin/run.sh", filepath.Join(src, "run")))
+
+	dst := t.TempDir()
+	require.NoError(t, copyPath(context.Background(), hostCpFS{}, src, hostCpFS{}, dst, false))
+
+	info, err := os.Stat(filepath.Join(dst, "src", "bin", "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	info, err = os.Stat(filepath.Join(dst, "src", "secret"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	target, err := os.Readlink(filepath.Join(dst, "src", "run"))
+	require.NoError(t, err)
+	assert.Equal(t, "bin/run.sh", target)
+}
+
+func TestCopyPathFollowLink(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "real"), []byte("data"), 0640))
+	require.NoError(t, os.Symlink("real", filepath.Join(dir, "link")))
+
+	dst := filepath.Join(t.TempDir(), "copy")
+	require.NoError(t, copyPath(context.Background(), hostCpFS{}, filepath.Join(dir, "link"), hostCpFS{}, dst, true))
+
+	info, err := os.Lstat(dst)
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	content, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(content))
+}
+
+func TestCopyPathRefusesToWriteThroughSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	victim := filepath.Join(outside, "victim")
+	require.NoError(t, os.WriteFile(victim, []byte("original"), 0600))
+
+	src := filepath.Join(t.TempDir(), "out")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "file"), []byte("evil"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "dir", "file"), []byte("evil"), 0644))
+
+	// A previous copy left symlinks where this one writes a file and a directory.
+	dst := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dst, "out"), 0755))
+	require.NoError(t, os.Symlink(victim, filepath.Join(dst, "out", "file")))
+	err := copyPath(context.Background(), hostCpFS{}, src, hostCpFS{}, dst, false)
+	require.ErrorIs(t, err, ErrCpSymlink)
+
+	dst = t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dst, "out"), 0755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(dst, "out", "dir")))
+	err = copyPath(context.Background(), hostCpFS{}, src, hostCpFS{}, dst, false)
+	require.ErrorIs(t, err, ErrCpSymlink)
+
+	content, err := os.ReadFile(victim)
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(content))
+	_, err = os.Lstat(filepath.Join(outside, "file"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+	"github.com/jingkaihe/matchlock/pkg/state"
+)
+
+var dfCmd = &cobra.Command{
+	Use:   "df <id>",
+	Short: "Show disk usage of a running sandbox",
+	Long: `Show disk usage for the rootfs, each extra disk and the workspace of a
+running sandbox. The workspace has no fixed size; only its used bytes are shown.`,
+	Example: `  matchlock df vm-abc123
+  matchlock df --json vm-abc123`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDf,
+}
+
+func init() {
+	dfCmd.Flags().Bool("json", false, "Print the usage as JSON")
+	rootCmd.AddCommand(dfCmd)
+}
+
+func runDf(cmd *cobra.Command, args []string) error {
+	vmID := args[0]
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	mgr := state.NewManager()
+	vmState, err := mgr.Get(vmID)
+	if err != nil {
+		return errx.With(ErrVMNotFound, " %s: %w", vmID, err)
+	}
+	if vmState.Status != "running" {
+		return fmt.Errorf("VM %s is not running (status: %s)", vmID, vmState.Status)
+	}
+
+	execSocketPath := mgr.ExecSocketPath(vmID)
+	if _, err := os.Stat(execSocketPath); err != nil {
+		return fmt.Errorf("exec socket not found for %s (was it started with --rm=false?)", vmID)
+	}
+
+	ctx, cancel := contextWithSignal(context.Background())
+	defer cancel()
+
+	disks, err := sandbox.DiskUsageViaRelay(ctx, execSocketPath)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		data, err := json.MarshalIndent(disks, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MOUNTED ON\tKIND\tSIZE\tUSED\tAVAIL\tUSE%")
+	for _, d := range disks {
+		if d.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t%s\n", d.Path, d.Kind, d.Error)
+			continue
+		}
+		if d.Kind == api.DiskUsageWorkspace {
+			fmt.Fprintf(w, "%s\t%s\t-\t%s\t-\t-\n", d.Path, d.Kind, formatDiskBytes(d.UsedBytes))
+			continue
+		}
+		use := "-"
+		if d.TotalBytes > 0 {
+			use = fmt.Sprintf("%d%%", (d.UsedBytes*100+d.TotalBytes-1)/d.TotalBytes)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", d.Path, d.Kind,
+			formatDiskBytes(d.TotalBytes), formatDiskBytes(d.UsedBytes), formatDiskBytes(d.FreeBytes), use)
+	}
+	return w.Flush()
+}
+
+func formatDiskBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGTPE"[exp])
+}
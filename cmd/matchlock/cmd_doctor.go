@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/image"
+	"github.com/jingkaihe/matchlock/pkg/kernel"
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check that this host can run sandboxes",
+	Long: `Check that this host can run sandboxes: hypervisor access, the VMM
+binary, guest runtime binaries, network privileges and the kernel and image
+caches. Each failed check prints a hint on how to fix it.
+
+The command exits non-zero if any critical check fails. Warnings, such as an
+empty image cache, do not affect the exit code.`,
+	Example: `  matchlock doctor
+  matchlock doctor --output json`,
+	Args: cobra.NoArgs,
+	RunE: runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// doctorCheck is the outcome of one host check. Critical checks fail the
+// command; the rest are reported as warnings.
+type doctorCheck struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Critical bool   `json:"critical"`
+	Detail   string `json:"detail,omitempty"`
+	Hint     string `json:"hint,omitempty"`
+}
+
+type doctorReport struct {
+	OK     bool          `json:"ok"`
+	Checks []doctorCheck `json:"checks"`
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	checks := append(platformDoctorChecks(), commonDoctorChecks()...)
+	report := newDoctorReport(checks)
+
+	if err := emitResult(report, func() { printDoctorReport(report) }); err != nil {
+		return err
+	}
+	if failed := report.criticalFailures(); failed > 0 {
+		return errx.With(ErrDoctorFailed, ": %d critical check(s) failed", failed)
+	}
+	return nil
+}
+
+func newDoctorReport(checks []doctorCheck) *doctorReport {
+	r := &doctorReport{OK: true, Checks: checks}
+	if r.criticalFailures() > 0 {
+		r.OK = false
+	}
+	return r
+}
+
+func (r *doctorReport) criticalFailures() int {
+	n := 0
+	for _, c := range r.Checks {
+		if c.Critical && !c.OK {
+			n++
+		}
+	}
+	return n
+}
+
+func printDoctorReport(r *doctorReport) {
+	for _, c := range r.Checks {
+		mark := "✓"
+		switch {
+		case !c.OK && c.Critical:
+			mark = "✗"
+		case !c.OK:
+			mark = "⚠"
+		}
+		if c.Detail != "" {
+			fmt.Printf("%s %s: %s\n", mark, c.Name, c.Detail)
+		} else {
+			fmt.Printf("%s %s\n", mark, c.Name)
+		}
+		if !c.OK && c.Hint != "" {
+			fmt.Printf("  %s\n", c.Hint)
+		}
+	}
+}
+
+// commonDoctorChecks are the checks shared by every platform.
+func commonDoctorChecks() []doctorCheck {
+	return []doctorCheck{
+		checkGuestRuntime(),
+		checkKernelCache(),
+		checkImageCache(),
+		checkSubnetRange(),
+	}
+}
+
+// checkGuestRuntime looks for guest-init, which is installed into each
+// rootfs as /init, guest-agent and guest-fused (the in-guest FUSE daemon
+// serving /workspace), and for the e2fsprogs tools that do the install.
+func checkGuestRuntime() doctorCheck {
+	c := doctorCheck{Name: "guest runtime", Critical: true}
+	guestInit := sandbox.DefaultGuestInitPath()
+	if _, err := os.Stat(guestInit); err != nil {
+		c.Detail = "guest-init not found"
+		c.Hint = "Install guest-init next to the matchlock binary or under ~/.cache/matchlock, or set MATCHLOCK_GUEST_INIT"
+		return c
+	}
+	var missing []string
+	for _, tool := range []string{"debugfs", "mkfs.ext4"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			missing = append(missing, tool)
+		}
+	}
+	if len(missing) > 0 {
+		c.Detail = strings.Join(missing, ", ") + " not found in PATH"
+		c.Hint = "Install e2fsprogs"
+		return c
+	}
+	c.OK = true
+	c.Detail = guestInit + " (init, agent and FUSE daemon)"
+	return c
+}
+
+func checkKernelCache() doctorCheck {
+	c := doctorCheck{Name: "kernel cache"}
+	if p := os.Getenv("MATCHLOCK_KERNEL"); p != "" {
+		return statCacheCheck(c, p)
+	}
+	return statCacheCheck(c, kernel.NewManager().KernelPath(kernel.CurrentArch(), ""))
+}
+
+func statCacheCheck(c doctorCheck, path string) doctorCheck {
+	if _, err := os.Stat(path); err != nil {
+		c.Detail = path + " not found"
+		c.Hint = "It is downloaded from " + kernel.DefaultRegistry + " on first run; make sure that registry is reachable"
+		return c
+	}
+	c.OK = true
+	c.Detail = path
+	return c
+}
+
+func checkImageCache() doctorCheck {
+	c := doctorCheck{Name: "rootfs cache"}
+	local, err := image.NewStore("").List()
+	if err != nil {
+		c.Detail = err.Error()
+		c.Hint = "Check that ~/.cache/matchlock is readable, or remove it to start over"
+		return c
+	}
+	remote, err := image.ListRegistryCache("")
+	if err != nil {
+		c.Detail = err.Error()
+		c.Hint = "Check that ~/.cache/matchlock is readable, or remove it to start over"
+		return c
+	}
+	if n := len(local) + len(remote); n > 0 {
+		c.OK = true
+		c.Detail = fmt.Sprintf("%d image(s) cached", n)
+		return c
+	}
+	c.Detail = "no images cached"
+	c.Hint = "Run 'matchlock pull alpine:latest' to warm the cache; images are otherwise pulled on first run"
+	return c
+}
+
+func checkSubnetRange() doctorCheck {
+	c := doctorCheck{Name: "subnet range"}
+	conflicts, err := hostSubnetConflicts()
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if len(conflicts) > 0 {
+		c.Detail = "in use on this host: " + strings.Join(conflicts, ", ")
+		c.Hint = "A sandbox given one of these subnets clashes with the host route; move the host network out of 192.168.100.0-192.168.254.255"
+		return c
+	}
+	c.OK = true
+	c.Detail = "192.168.100.0/24-192.168.254.0/24 free"
+	return c
+}
+
+type hostAddr struct {
+	iface string
+	ip    net.IP
+}
+
+func hostSubnetConflicts() ([]string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var addrs []hostAddr
+	for _, iface := range ifaces {
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifAddrs {
+			if ipNet, ok := a.(*net.IPNet); ok {
+				addrs = append(addrs, hostAddr{iface: iface.Name, ip: ipNet.IP})
+			}
+		}
+	}
+	return subnetConflicts(addrs), nil
+}
+
+// subnetConflicts returns the sandbox /24s (192.168.100-254.0) already
+// carried by a host interface. Sandbox TAP devices (fc-*) are expected to
+// hold them and are skipped.
+func subnetConflicts(addrs []hostAddr) []string {
+	var conflicts []string
+	seen := make(map[int]bool)
+	for _, a := range addrs {
+		ip4 := a.ip.To4()
+		if ip4 == nil || ip4[0] != 192 || ip4[1] != 168 || ip4[2] < 100 || ip4[2] == 255 {
+			continue
+		}
+		if strings.HasPrefix(a.iface, "fc-") || seen[int(ip4[2])] {
+			continue
+		}
+		seen[int(ip4[2])] = true
+		conflicts = append(conflicts, fmt.Sprintf("192.168.%d.0/24 (%s)", ip4[2], a.iface))
+	}
+	return conflicts
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubnetConflicts(t *testing.T) {
+	addrs := []hostAddr{
+		{iface: "eth0", ip: net.ParseIP("10.0.0.5")},
+		{iface: "virbr0", ip: net.ParseIP("192.168.122.1")},
+		{iface: "virbr1", ip: net.ParseIP("192.168.122.7")},
+		{iface: "fc-abc123", ip: net.ParseIP("192.168.100.1")},
+		{iface: "wlan0", ip: net.ParseIP("192.168.1.20")},
+		{iface: "eth1", ip: net.ParseIP("fe80::1")},
+	}
+	assert.Equal(t, []string{"192.168.122.0/24 (virbr0)"}, subnetConflicts(addrs))
+	assert.Empty(t, subnetConflicts(nil))
+}
+
+func TestDoctorReportCriticalFailures(t *testing.T) {
+	report := newDoctorReport([]doctorCheck{
+		{Name: "kvm", Critical: true, OK: true},
+		{Name: "cache", OK: false},
+	})
+	assert.True(t, report.OK)
+	assert.Equal(t, 0, report.criticalFailures())
+
+	report = newDoctorReport([]doctorCheck{
+		{Name: "kvm", Critical: true, OK: false},
+		{Name: "firecracker", Critical: true, OK: false},
+		{Name: "cache", OK: false},
+	})
+	assert.False(t, report.OK)
+	assert.Equal(t, 2, report.criticalFailures())
+}
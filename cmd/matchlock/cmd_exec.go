@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -19,9 +20,14 @@ var execCmd = &cobra.Command{
 	Short: "Execute a command in a running sandbox",
 	Long: `Execute a command in a running sandbox.
 
+With --input-file, the host file (or "-" for this process's stdin) is piped
+to the command's stdin, and the command's exit code becomes matchlock's.
+
 The sandbox must have been started with --rm=false to remain running.`,
 	Example: `  matchlock exec vm-abc123 echo hello
-  matchlock exec vm-abc123 -it sh`,
+  matchlock exec vm-abc123 -it sh
+  matchlock exec vm-abc123 --input-file data.json -- jq .items
+  cat data.csv | matchlock exec vm-abc123 --input-file - -- wc -l`,
 	Args: cobra.MinimumNArgs(1),
 	RunE: runExec,
 }
@@ -31,6 +37,7 @@ func init() {
 	execCmd.Flags().BoolP("interactive", "i", false, "Keep STDIN open")
 	execCmd.Flags().StringP("workdir", "w", "", "Working directory inside the sandbox (default: image WORKDIR, then workspace path)")
 	execCmd.Flags().StringP("user", "u", "", "Run as user (uid, uid:gid, or username)")
+	execCmd.Flags().String("input-file", "", "Pipe a host file to the command's stdin (\"-\" reads this process's stdin)")
 
 	rootCmd.AddCommand(execCmd)
 }
@@ -43,11 +50,15 @@ func runExec(cmd *cobra.Command, args []string) error {
 	interactive, _ := cmd.Flags().GetBool("interactive")
 	workdir, _ := cmd.Flags().GetString("workdir")
 	user, _ := cmd.Flags().GetString("user")
+	inputFile, _ := cmd.Flags().GetString("input-file")
 	interactiveMode := tty && interactive
 
 	if len(cmdArgs) == 0 && !interactiveMode {
 		return fmt.Errorf("command required (or use -it for interactive mode)")
 	}
+	if inputFile != "" && (tty || interactive) {
+		return fmt.Errorf("--input-file cannot be combined with -t or -i")
+	}
 
 	mgr := state.NewManager()
 	vmState, err := mgr.Get(vmID)
@@ -73,7 +84,16 @@ func runExec(cmd *cobra.Command, args []string) error {
 	}
 
 	if interactive {
-		return runExecPipe(ctx, execSocketPath, command, workdir, user)
+		return runExecPipe(ctx, execSocketPath, command, workdir, user, os.Stdin)
+	}
+
+	if inputFile != "" {
+		stdin, err := openInputFile(inputFile)
+		if err != nil {
+			return err
+		}
+		defer stdin.Close()
+		return runExecPipe(ctx, execSocketPath, command, workdir, user, stdin)
 	}
 
 	result, err := sandbox.ExecViaRelay(ctx, execSocketPath, command, workdir, user)
@@ -87,8 +107,8 @@ func runExec(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runExecPipe(ctx context.Context, execSocketPath, command, workdir, user string) error {
-	exitCode, err := sandbox.ExecPipeViaRelay(ctx, execSocketPath, command, workdir, user, os.Stdin, os.Stdout, os.Stderr)
+func runExecPipe(ctx context.Context, execSocketPath, command, workdir, user string, stdin io.Reader) error {
+	exitCode, err := sandbox.ExecPipeViaRelay(ctx, execSocketPath, command, workdir, user, stdin, os.Stdout, os.Stderr)
 	if err != nil {
 		return errx.Wrap(ErrPipeExecFailed, err)
 	}
@@ -96,6 +116,18 @@ func runExecPipe(ctx context.Context, execSocketPath, command, workdir, user str
 	return nil
 }
 
+// openInputFile opens the --input-file source; "-" is this process's stdin.
+func openInputFile(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errx.Wrap(ErrInputFile, err)
+	}
+	return f, nil
+}
+
 func runExecInteractive(ctx context.Context, execSocketPath, command, workdir, user string) error {
 	if !term.IsTerminal(int(os.Stdin.Fd())) {
 		return fmt.Errorf("-it requires a TTY")
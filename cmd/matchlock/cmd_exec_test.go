@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenInputFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"items":[]}`), 0644))
+
+	r, err := openInputFile(path)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, `{"items":[]}`, string(data))
+
+	_, err = openInputFile(filepath.Join(t.TempDir(), "missing.json"))
+	require.ErrorIs(t, err, ErrInputFile)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	stdin, err := openInputFile("-")
+	require.NoError(t, err)
+	require.NoError(t, stdin.Close(), "closing stdin wrapper must not close os.Stdin")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/state"
+)
+
+var exportDebugCmd = &cobra.Command{
+	Use:   "export-debug <id>",
+	Short: "Archive a sandbox's state directory for debugging",
+	Long: `Write the sandbox's whole state directory (rootfs, logs, lifecycle record,
+event logs, crash dumps) to a gzipped tarball. Run it after a sandbox started
+with --keep-on-exit has stopped; a running sandbox's disks are copied while in
+use. Sockets are skipped.`,
+	Example: `  matchlock export-debug vm-abc123
+  matchlock export-debug --skip-disks -f /tmp/vm.tar.gz vm-abc123`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExportDebug,
+}
+
+func init() {
+	exportDebugCmd.Flags().StringP("file", "f", "", "Archive path (default: <id>-debug.tar.gz)")
+	exportDebugCmd.Flags().Bool("skip-disks", false, "Leave the .ext4 disk images out of the archive")
+	rootCmd.AddCommand(exportDebugCmd)
+}
+
+func runExportDebug(cmd *cobra.Command, args []string) error {
+	vmID := args[0]
+	output, _ := cmd.Flags().GetString("file")
+	skipDisks, _ := cmd.Flags().GetBool("skip-disks")
+	if output == "" {
+		output = vmID + "-debug.tar.gz"
+	}
+
+	mgr := state.NewManager()
+	if _, err := mgr.Get(vmID); err != nil {
+		return errx.With(ErrVMNotFound, " %s: %w", vmID, err)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return errx.Wrap(ErrExportDebug, err)
+	}
+	if err := writeStateArchive(f, mgr.Dir(vmID), vmID, skipDisks); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return errx.Wrap(ErrExportDebug, err)
+	}
+	infof("Wrote %s\n", output)
+	return nil
+}
+
+// writeStateArchive writes dir as a gzipped tarball rooted at prefix.
+// Only directories, regular files and symlinks are archived.
+func writeStateArchive(w io.Writer, dir, prefix string, skipDisks bool) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		if !mode.IsDir() && !mode.IsRegular() && mode&os.ModeSymlink == 0 {
+			return nil
+		}
+		if skipDisks && mode.IsRegular() && strings.HasSuffix(path, ".ext4") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		var link string
+		if mode&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(filepath.Join(prefix, rel))
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !mode.IsRegular() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return errx.Wrap(ErrExportDebug, err)
+	}
+	if err := tw.Close(); err != nil {
+		return errx.Wrap(ErrExportDebug, err)
+	}
+	if err := gz.Close(); err != nil {
+		return errx.Wrap(ErrExportDebug, err)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteStateArchive(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vm.log"), []byte("boot\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rootfs.ext4"), []byte("disk"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "events"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "events", "0.jsonl"), []byte("{}\n"), 0644))
+	// Unix socket paths are limited to ~108 bytes, so keep this one short.
+	sock, err := net.Listen("unix", filepath.Join(dir, "s.sock"))
+	require.NoError(t, err)
+	defer sock.Close()
+
+	read := func(skipDisks bool) map[string]string {
+		var buf bytes.Buffer
+		require.NoError(t, writeStateArchive(&buf, dir, "vm-test", skipDisks))
+		gz, err := gzip.NewReader(&buf)
+		require.NoError(t, err)
+		tr := tar.NewReader(gz)
+		files := map[string]string{}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return files
+			}
+			require.NoError(t, err)
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			files[hdr.Name] = string(data)
+		}
+	}
+
+	assert.Equal(t, map[string]string{
+		"vm-test":                "",
+		"vm-test/events":         "",
+		"vm-test/events/0.jsonl": "{}\n",
+		"vm-test/rootfs.ext4":    "disk",
+		"vm-test/vm.log":         "boot\n",
+	}, read(false))
+
+	files := read(true)
+	assert.NotContains(t, files, "vm-test/rootfs.ext4")
+	assert.Contains(t, files, "vm-test/vm.log")
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+	"github.com/jingkaihe/matchlock/pkg/state"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history <id>",
+	Short: "Show a sandbox's recorded events grouped by trace",
+	Long: `Show the exec, network, file and syscall events recorded for a sandbox.
+
+Events are grouped by trace ID. Each exec starts a trace, exported to the guest
+as MATCHLOCK_TRACE_ID. Events raised while it is the only running exec join
+its trace. HTTP clients can also tag requests explicitly with the
+X-Matchlock-Trace-Id header; the proxy strips it before forwarding.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runHistory,
+}
+
+func init() {
+	historyCmd.Flags().String("trace", "", "Only show events for this trace ID")
+	historyCmd.Flags().Bool("json", false, "Print events as JSON lines")
+	viper.BindPFlag("history.trace", historyCmd.Flags().Lookup("trace"))
+	viper.BindPFlag("history.json", historyCmd.Flags().Lookup("json"))
+
+	rootCmd.AddCommand(historyCmd)
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	traceFilter, _ := cmd.Flags().GetString("trace")
+	asJSON, _ := cmd.Flags().GetBool("json")
+
+	mgr := state.NewManager()
+	if _, err := mgr.Get(args[0]); err != nil {
+		return err
+	}
+	events, err := sandbox.ReadEventLog(mgr.EventLogPath(args[0]))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if traceFilter != "" {
+		filtered := events[:0]
+		for _, evt := range events {
+			if evt.TraceID == traceFilter {
+				filtered = append(filtered, evt)
+			}
+		}
+		events = filtered
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, evt := range events {
+			if err := enc.Encode(evt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	printHistory(os.Stdout, events)
+	return nil
+}
+
+// printHistory prints events grouped by trace, in the order each trace was
+// first seen. Untraced events are listed last.
+func printHistory(out io.Writer, events []api.Event) {
+	var order []string
+	groups := make(map[string][]api.Event)
+	for _, evt := range events {
+		if _, seen := groups[evt.TraceID]; !seen && evt.TraceID != "" {
+			order = append(order, evt.TraceID)
+		}
+		groups[evt.TraceID] = append(groups[evt.TraceID], evt)
+	}
+	if len(groups[""]) > 0 {
+		order = append(order, "")
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for i, traceID := range order {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if traceID == "" {
+			fmt.Fprintln(w, "UNTRACED")
+		} else {
+			fmt.Fprintf(w, "TRACE %s\n", traceID)
+		}
+		for _, evt := range groups[traceID] {
+			fmt.Fprintf(w, "  %s\t%s\n", evt.Type, describeEvent(evt))
+		}
+	}
+	w.Flush()
+}
+
+func describeEvent(evt api.Event) string {
+	switch {
+	case evt.Exec != nil:
+		if evt.Exec.Error != "" {
+			return fmt.Sprintf("%s (error: %s)", evt.Exec.Command, evt.Exec.Error)
+		}
+		return fmt.Sprintf("%s (exit %d)", evt.Exec.Command, evt.Exec.ExitCode)
+	case evt.Network != nil:
+		n := evt.Network
+		if n.TLS != nil {
+			mode := "passthrough"
+			if n.TLS.Intercepted {
+				mode = "intercepted"
+			}
+			return fmt.Sprintf("TLS %s (%s)", n.Host, mode)
+		}
+		if n.Blocked {
+			return strings.TrimSpace(fmt.Sprintf("%s %s", n.Method, n.Host)) + " blocked: " + n.BlockReason
+		}
+		return fmt.Sprintf("%s %s %d", n.Method, n.URL, n.StatusCode)
+	case evt.File != nil:
+		return fmt.Sprintf("%s %s", evt.File.Op, evt.File.Path)
+	case evt.SecretInjected != nil:
+		return fmt.Sprintf("%s: injected %s", evt.SecretInjected.Host, strings.Join(evt.SecretInjected.Secrets, ", "))
+	case evt.Security != nil:
+		return "warning: " + evt.Security.Warning
+	case evt.Syscall != nil:
+		s := evt.Syscall
+		if s.Blocked {
+			return fmt.Sprintf("%s(%s) pid %d blocked", s.Name, s.Args, s.PID)
+		}
+		return fmt.Sprintf("%s(%s) pid %d", s.Name, s.Args, s.PID)
+	default:
+		return ""
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -28,17 +27,19 @@ func runKill(cmd *cobra.Command, args []string) error {
 	mgr := lifecycle.NewVMManager()
 
 	if all {
+		result := newBatchResult()
 		states, _ := mgr.List()
 		for _, s := range states {
 			if s.Status == "running" {
-				if err := mgr.Kill(s.ID); err != nil {
-					fmt.Fprintf(os.Stderr, "Failed to kill %s: %v\n", s.ID, err)
-				} else {
-					fmt.Printf("Killed %s\n", s.ID)
-				}
+				result.add(s.ID, mgr.Kill(s.ID))
 			}
 		}
-		return nil
+		return emitResult(result, func() {
+			for _, id := range result.IDs {
+				fmt.Printf("Killed %s\n", id)
+			}
+			result.printFailures("kill")
+		})
 	}
 
 	if len(args) == 0 {
@@ -48,6 +49,7 @@ func runKill(cmd *cobra.Command, args []string) error {
 	if err := mgr.Kill(args[0]); err != nil {
 		return err
 	}
-	fmt.Printf("Killed %s\n", args[0])
-	return nil
+	return emitResult(&batchResult{IDs: []string{args[0]}}, func() {
+		fmt.Printf("Killed %s\n", args[0])
+	})
 }
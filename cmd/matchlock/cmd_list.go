@@ -1,16 +1,28 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
 
+	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/state"
 )
 
+const (
+	listFormatTable = "table"
+	listFormatJSON  = "json"
+	listFormatYAML  = "yaml"
+)
+
 var listCmd = &cobra.Command{
 	Use:     "list",
 	Aliases: []string{"ls"},
@@ -20,13 +32,90 @@ var listCmd = &cobra.Command{
 
 func init() {
 	listCmd.Flags().Bool("running", false, "Show only running VMs")
+	listCmd.Flags().String("format", "", "Output format: table, json or yaml (default table, or json with --output json)")
+	listCmd.Flags().StringArray("filter", nil, "Only list VMs matching KEY=VALUE, where KEY is id, status or image (can be repeated)")
 	viper.BindPFlag("list.running", listCmd.Flags().Lookup("running"))
 
 	rootCmd.AddCommand(listCmd)
 }
 
+// listEntry is one sandbox in `list --format json|yaml`. Subnet and
+// GuestIP are only set for VMs with a host subnet allocation (Linux).
+type listEntry struct {
+	ID             string      `json:"id" yaml:"id"`
+	Status         string      `json:"status" yaml:"status"`
+	Image          string      `json:"image" yaml:"image"`
+	PID            int         `json:"pid" yaml:"pid"`
+	CreatedAt      string      `json:"created_at" yaml:"created_at"`
+	Subnet         string      `json:"subnet,omitempty" yaml:"subnet,omitempty"`
+	GuestIP        string      `json:"guest_ip,omitempty" yaml:"guest_ip,omitempty"`
+	StateDir       string      `json:"state_dir" yaml:"state_dir"`
+	SocketPath     string      `json:"socket_path" yaml:"socket_path"`
+	ExecSocketPath string      `json:"exec_socket_path" yaml:"exec_socket_path"`
+	Config         interface{} `json:"config,omitempty" yaml:"config,omitempty"`
+}
+
+// listFilters holds --filter selectors by key; a VM must match all of them.
+type listFilters map[string]string
+
+func parseListFilters(specs []string) (listFilters, error) {
+	filters := make(listFilters)
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		if !ok || value == "" {
+			return nil, errx.With(ErrInvalidListFilter, " %q: expected KEY=VALUE", spec)
+		}
+		switch key {
+		case "id", "status", "image":
+			filters[key] = value
+		default:
+			return nil, errx.With(ErrInvalidListFilter, " %q: unknown key %q (expected id, status or image)", spec, key)
+		}
+	}
+	return filters, nil
+}
+
+func (f listFilters) match(s state.VMState) bool {
+	for key, value := range f {
+		var got string
+		switch key {
+		case "id":
+			got = s.ID
+		case "status":
+			got = s.Status
+		case "image":
+			got = s.Image
+		}
+		if got != value {
+			return false
+		}
+	}
+	return true
+}
+
 func runList(cmd *cobra.Command, args []string) error {
 	running, _ := cmd.Flags().GetBool("running")
+	format, _ := cmd.Flags().GetString("format")
+	filterSpecs, _ := cmd.Flags().GetStringArray("filter")
+
+	if format == "" {
+		format = listFormatTable
+		if cliOutput.format == outputJSON {
+			format = listFormatJSON
+		}
+	}
+	switch format {
+	case listFormatTable, listFormatJSON, listFormatYAML:
+	default:
+		return errx.With(ErrInvalidListFormat, " %q: expected table, json or yaml", format)
+	}
+	filters, err := parseListFilters(filterSpecs)
+	if err != nil {
+		return err
+	}
+	if running {
+		filters["status"] = "running"
+	}
 
 	mgr := state.NewManager()
 	states, err := mgr.List()
@@ -34,13 +123,35 @@ func runList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	var matched []state.VMState
+	for _, s := range states {
+		if filters.match(s) {
+			matched = append(matched, s)
+		}
+	}
+
+	if format == listFormatTable {
+		printListTable(os.Stdout, matched)
+		return nil
+	}
+
+	subnets := state.NewSubnetAllocator()
+	entries := make([]listEntry, 0, len(matched))
+	for _, s := range matched {
+		var subnet *state.SubnetInfo
+		if info, err := subnets.Get(s.ID); err == nil {
+			subnet = info
+		}
+		entries = append(entries, newListEntry(mgr, s, subnet))
+	}
+	return writeListEntries(os.Stdout, format, entries)
+}
+
+func printListTable(out io.Writer, states []state.VMState) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
 	fmt.Fprintln(w, "ID\tSTATUS\tIMAGE\tCREATED\tPID")
 
 	for _, s := range states {
-		if running && s.Status != "running" {
-			continue
-		}
 		created := s.CreatedAt.Format("2006-01-02 15:04")
 		pid := "-"
 		if s.PID > 0 {
@@ -49,5 +160,42 @@ func runList(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.ID, s.Status, s.Image, created, pid)
 	}
 	w.Flush()
-	return nil
+}
+
+func newListEntry(mgr *state.Manager, s state.VMState, subnet *state.SubnetInfo) listEntry {
+	entry := listEntry{
+		ID:             s.ID,
+		Status:         s.Status,
+		Image:          s.Image,
+		PID:            s.PID,
+		CreatedAt:      s.CreatedAt.Format(time.RFC3339),
+		StateDir:       mgr.Dir(s.ID),
+		SocketPath:     mgr.SocketPath(s.ID),
+		ExecSocketPath: mgr.ExecSocketPath(s.ID),
+	}
+	if subnet != nil {
+		entry.Subnet = subnet.Subnet
+		entry.GuestIP = subnet.GuestIP
+	}
+	if len(s.Config) > 0 {
+		var config interface{}
+		if err := json.Unmarshal(s.Config, &config); err == nil {
+			entry.Config = config
+		}
+	}
+	return entry
+}
+
+func writeListEntries(out io.Writer, format string, entries []listEntry) error {
+	if format == listFormatYAML {
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(entries); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/state"
+)
+
+func TestParseListFilters(t *testing.T) {
+	filters, err := parseListFilters([]string{"status=running", "image=alpine:latest"})
+	require.NoError(t, err)
+	assert.True(t, filters.match(state.VMState{Status: "running", Image: "alpine:latest"}))
+	assert.False(t, filters.match(state.VMState{Status: "stopped", Image: "alpine:latest"}))
+	assert.False(t, filters.match(state.VMState{Status: "running", Image: "ubuntu:24.04"}))
+
+	for _, spec := range []string{"status", "status=", "name=web"} {
+		_, err := parseListFilters([]string{spec})
+		assert.ErrorIs(t, err, ErrInvalidListFilter, spec)
+	}
+}
+
+func TestListEntryIncludesHiddenFields(t *testing.T) {
+	mgr := state.NewManagerWithDir(t.TempDir())
+	created := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	entry := newListEntry(mgr, state.VMState{
+		ID:        "vm-abc",
+		Status:    "running",
+		Image:     "alpine:latest",
+		PID:       42,
+		CreatedAt: created,
+		Config:    json.RawMessage(`{"image":"alpine:latest"}`),
+	}, &state.SubnetInfo{Subnet: "192.168.100.0/24", GuestIP: "192.168.100.2"})
+
+	var out bytes.Buffer
+	require.NoError(t, writeListEntries(&out, listFormatJSON, []listEntry{entry}))
+	var decoded []map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	require.Len(t, decoded, 1)
+	assert.Equal(t, "2026-03-01T12:30:00Z", decoded[0]["created_at"])
+	assert.Equal(t, "192.168.100.0/24", decoded[0]["subnet"])
+	assert.Equal(t, mgr.SocketPath("vm-abc"), decoded[0]["socket_path"])
+	assert.Equal(t, map[string]interface{}{"image": "alpine:latest"}, decoded[0]["config"])
+
+	out.Reset()
+	require.NoError(t, writeListEntries(&out, listFormatYAML, []listEntry{entry}))
+	assert.Contains(t, out.String(), "- id: vm-abc\n")
+	assert.Contains(t, out.String(), "  created_at: \"2026-03-01T12:30:00Z\"\n")
+	assert.Contains(t, out.String(), "  subnet: 192.168.100.0/24\n")
+	assert.Contains(t, out.String(), "    image: alpine:latest\n")
+}
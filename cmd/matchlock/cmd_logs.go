@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+	"github.com/jingkaihe/matchlock/pkg/state"
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <id>",
+	Short: "Show a sandbox's VM console log",
+	Long: `Show the console log of a sandbox's VM.
+
+Each line is attributed to a source: init, agent and fused for the guest
+runtime's diagnostics, and console for kernel and VMM output.
+
+The log outlives the VM: it can still be read after the sandbox stops or
+fails to boot, for as long as its state directory exists. --since seeks to
+a byte offset, or back from the end when negative, so large logs can be
+read from a known point.`,
+	Example: `  matchlock logs vm-abc12345
+  matchlock logs vm-abc12345 --source init,agent -f
+  matchlock logs vm-abc12345 --since -4096`,
+	Args: cobra.ExactArgs(1),
+	RunE: runLogs,
+}
+
+func init() {
+	logsCmd.Flags().StringSlice("source", nil, "Only show lines from these sources (console, init, agent, fused)")
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep streaming new lines")
+	logsCmd.Flags().Int64("since", 0, "Start at this byte offset of the log (negative: bytes before the end)")
+	viper.BindPFlag("logs.source", logsCmd.Flags().Lookup("source"))
+	viper.BindPFlag("logs.follow", logsCmd.Flags().Lookup("follow"))
+	viper.BindPFlag("logs.since", logsCmd.Flags().Lookup("since"))
+
+	rootCmd.AddCommand(logsCmd)
+}
+
+func runLogs(cmd *cobra.Command, args []string) error {
+	sourceNames, _ := cmd.Flags().GetStringSlice("source")
+	follow, _ := cmd.Flags().GetBool("follow")
+	since, _ := cmd.Flags().GetInt64("since")
+
+	opts := sandbox.LogOptions{Follow: follow, Since: since}
+	for _, name := range sourceNames {
+		source, err := api.ParseLogSource(name)
+		if err != nil {
+			return err
+		}
+		opts.Sources = append(opts.Sources, source)
+	}
+
+	mgr := state.NewManager()
+	logPath := mgr.LogPath(args[0])
+	if _, err := mgr.Get(args[0]); err != nil {
+		// A VM without a record can still have left its log behind.
+		if _, statErr := os.Stat(logPath); statErr != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := contextWithSignal(context.Background())
+	defer cancel()
+
+	return sandbox.StreamLogs(ctx, logPath, opts, func(line api.LogLine) error {
+		_, err := fmt.Fprintf(os.Stdout, "[%s] %s\n", line.Source, line.Text)
+		return err
+	})
+}
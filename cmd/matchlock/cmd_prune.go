@@ -21,10 +21,16 @@ func init() {
 func runPrune(cmd *cobra.Command, args []string) error {
 	mgr := lifecycle.NewVMManager()
 	pruned, err := mgr.Prune()
-	for _, id := range pruned {
-		fmt.Printf("Pruned %s\n", id)
+	result := newBatchResult()
+	result.IDs = append(result.IDs, pruned...)
+	if emitErr := emitResult(result, func() {
+		for _, id := range pruned {
+			fmt.Printf("Pruned %s\n", id)
+		}
+		fmt.Printf("Pruned %d VMs\n", len(pruned))
+	}); emitErr != nil {
+		return emitErr
 	}
-	fmt.Printf("Pruned %d VMs\n", len(pruned))
 	if err != nil {
 		return err
 	}
@@ -17,7 +17,8 @@ var pullCmd = &cobra.Command{
 	Long:  `Pull a container image from a registry and build a rootfs for use with matchlock run.`,
 	Example: `  matchlock pull alpine:latest
   matchlock pull -t myapp:latest alpine:latest
-  matchlock pull --force alpine:latest`,
+  matchlock pull --force alpine:latest
+  matchlock pull --require-signature --trusted-key cosign.pub ghcr.io/acme/agent:v1`,
 	Args: cobra.ExactArgs(1),
 	RunE: runPull,
 }
@@ -25,6 +26,8 @@ var pullCmd = &cobra.Command{
 func init() {
 	pullCmd.Flags().Bool("force", false, "Always pull image from registry (ignore cache)")
 	pullCmd.Flags().StringP("tag", "t", "", "Tag the image locally")
+	pullCmd.Flags().Bool("require-signature", false, "Fail unless the image has a cosign signature by a --trusted-key")
+	pullCmd.Flags().StringArray("trusted-key", nil, "Public key (PEM file) that image signatures are verified against (can be repeated)")
 
 	rootCmd.AddCommand(pullCmd)
 }
@@ -32,17 +35,24 @@ func init() {
 func runPull(cmd *cobra.Command, args []string) error {
 	force, _ := cmd.Flags().GetBool("force")
 	tag, _ := cmd.Flags().GetString("tag")
+	requireSignature, _ := cmd.Flags().GetBool("require-signature")
+	trustedKeys, _ := cmd.Flags().GetStringArray("trusted-key")
 
 	imageRef := args[0]
-	builder := image.NewBuilder(&image.BuildOptions{
-		ForcePull: force,
-	})
+	buildOpts, err := imageBuildOptions(force, requireSignature, trustedKeys)
+	if err != nil {
+		return err
+	}
+	bar := newPullProgressBar()
+	buildOpts.Progress = bar.report()
+	builder := image.NewBuilder(buildOpts)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
 	defer cancel()
 
 	fmt.Printf("Pulling %s...\n", imageRef)
 	result, err := builder.Build(ctx, imageRef)
+	bar.clear()
 	if err != nil {
 		return err
 	}
@@ -56,5 +66,8 @@ func runPull(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("Digest: %s\n", result.Digest)
 	fmt.Printf("Size: %.1f MB\n", float64(result.Size)/(1024*1024))
+	if result.Signer != "" {
+		fmt.Printf("Signed by: %s\n", result.Signer)
+	}
 	return nil
 }
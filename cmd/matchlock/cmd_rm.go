@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -29,17 +28,19 @@ func runRemove(cmd *cobra.Command, args []string) error {
 	mgr := lifecycle.NewVMManager()
 
 	if stopped {
+		result := newBatchResult()
 		states, _ := mgr.List()
 		for _, s := range states {
 			if s.Status != "running" {
-				if err := mgr.Remove(s.ID); err != nil {
-					fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", s.ID, err)
-				} else {
-					fmt.Printf("Removed %s\n", s.ID)
-				}
+				result.add(s.ID, mgr.Remove(s.ID))
 			}
 		}
-		return nil
+		return emitResult(result, func() {
+			for _, id := range result.IDs {
+				fmt.Printf("Removed %s\n", id)
+			}
+			result.printFailures("remove")
+		})
 	}
 
 	if len(args) == 0 {
@@ -49,6 +50,7 @@ func runRemove(cmd *cobra.Command, args []string) error {
 	if err := mgr.Remove(args[0]); err != nil {
 		return err
 	}
-	fmt.Printf("Removed %s\n", args[0])
-	return nil
+	return emitResult(&batchResult{IDs: []string{args[0]}}, func() {
+		fmt.Printf("Removed %s\n", args[0])
+	})
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/spf13/cobra"
 
@@ -27,20 +28,98 @@ func runRPC(cmd *cobra.Command, args []string) error {
 	ctx, cancel := contextWithSignal(context.Background())
 	defer cancel()
 
+	// Full root is only needed to bring a sandbox up; shed it afterwards.
+	// A sandbox is never handed out while the process still holds full root.
+	var dropOnce sync.Once
+	var dropErr error
+	dropPrivileges := func(ctx context.Context, vm rpc.VM) (rpc.VM, error) {
+		dropOnce.Do(func() { dropErr = sandbox.DropPrivileges() })
+		if dropErr != nil {
+			_ = vm.Close(ctx)
+			return nil, dropErr
+		}
+		return vm, nil
+	}
+
 	factory := func(ctx context.Context, config *api.Config) (rpc.VM, error) {
 		if config.Image == "" {
 			return nil, fmt.Errorf("image is required")
 		}
 
-		builder := image.NewBuilder(&image.BuildOptions{})
+		buildOpts, err := imageBuildOptions(false, config.RequireSignature, config.TrustedKeys)
+		if err != nil {
+			return nil, errx.Wrap(ErrBuildRootfs, err)
+		}
+		buildOpts.Progress = rpc.CreateProgress(ctx)
+		builder := image.NewBuilder(buildOpts)
 
 		result, err := builder.Build(ctx, config.Image)
 		if err != nil {
 			return nil, errx.Wrap(ErrBuildRootfs, err)
 		}
 
-		return sandbox.New(ctx, config, &sandbox.Options{RootfsPath: result.RootfsPath})
+		applyImageOCIConfig(config, result.OCI)
+
+		sb, err := sandbox.New(ctx, config, &sandbox.Options{RootfsPath: result.RootfsPath})
+		if err != nil {
+			return nil, err
+		}
+		return dropPrivileges(ctx, sb)
+	}
+
+	restoreFactory := func(ctx context.Context, snapshotID string, configure func(*api.Config)) (rpc.VM, error) {
+		snap, err := sandbox.LoadVMSnapshot(snapshotID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Only a shared rootfs is read from the image; otherwise the
+		// snapshot carries the VM's own disk.
+		opts := &sandbox.Options{}
+		if snap.Config.SharedRootfs {
+			buildOpts, err := imageBuildOptions(false, snap.Config.RequireSignature, snap.Config.TrustedKeys)
+			if err != nil {
+				return nil, errx.Wrap(ErrBuildRootfs, err)
+			}
+			result, err := image.NewBuilder(buildOpts).Build(ctx, snap.Config.Image)
+			if err != nil {
+				return nil, errx.Wrap(ErrBuildRootfs, err)
+			}
+			opts.RootfsPath = result.RootfsPath
+		}
+
+		sb, err := sandbox.Restore(ctx, snapshotID, configure, opts)
+		if err != nil {
+			return nil, err
+		}
+		return dropPrivileges(ctx, sb)
 	}
 
-	return rpc.RunRPC(ctx, factory)
+	return rpc.RunRPC(ctx, factory, rpc.WithRestoreFactory(restoreFactory))
+}
+
+// applyImageOCIConfig fills config.ImageCfg from the image's own config where
+// the client left it unset. EXPOSE metadata lets clients publish all ports.
+// The image ENV is merged below the client's image_config env, so it sits at
+// the bottom of every exec's environment, as it does for matchlock run.
+func applyImageOCIConfig(config *api.Config, oci *image.OCIConfig) {
+	if oci == nil || (len(oci.ExposedPorts) == 0 && len(oci.Env) == 0) {
+		return
+	}
+	if config.ImageCfg == nil {
+		config.ImageCfg = &api.ImageConfig{}
+	}
+	if len(config.ImageCfg.ExposedPorts) == 0 {
+		config.ImageCfg.ExposedPorts = oci.ExposedPorts
+	}
+	if len(oci.Env) > 0 {
+		env := make(map[string]string, len(oci.Env)+len(config.ImageCfg.Env))
+		for k, v := range oci.Env {
+			env[k] = v
+		}
+		for k, v := range config.ImageCfg.Env {
+			env[k] = v
+		}
+		config.ImageCfg.Env = env
+	}
 }
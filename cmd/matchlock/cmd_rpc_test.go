@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/image"
+)
+
+func TestApplyImageOCIConfigMergesEnvBelowClient(t *testing.T) {
+	config := &api.Config{
+		ImageCfg: &api.ImageConfig{Env: map[string]string{"MODE": "client"}},
+	}
+	applyImageOCIConfig(config, &image.OCIConfig{
+		Env:          map[string]string{"PATH": "/opt/conda/bin:/usr/bin", "MODE": "image"},
+		ExposedPorts: []int{8080},
+	})
+
+	assert.Equal(t, map[string]string{"PATH": "/opt/conda/bin:/usr/bin", "MODE": "client"}, config.ImageCfg.Env)
+	assert.Equal(t, []int{8080}, config.ImageCfg.ExposedPorts)
+}
+
+func TestApplyImageOCIConfigWithoutClientImageConfig(t *testing.T) {
+	config := &api.Config{}
+	applyImageOCIConfig(config, &image.OCIConfig{Env: map[string]string{"LANG": "C.UTF-8"}})
+	assert.Equal(t, map[string]string{"LANG": "C.UTF-8"}, config.ImageCfg.Env)
+
+	config = &api.Config{}
+	applyImageOCIConfig(config, &image.OCIConfig{User: "app"})
+	assert.Nil(t, config.ImageCfg)
+}
@@ -34,6 +34,11 @@ Environment Variables (-e/--env, --env-file):
     --env KEY=VALUE            Set inline value
     --env KEY                  Read from host environment ($KEY)
     --env-file /path/to/.env   Read KEY=VALUE or KEY entries per line
+                               (dotenv style: # comments, "export KEY=...",
+                               single- or double-quoted values)
+
+  Precedence: -e/--env over --env-file (later files win) over the image's
+  ENV. These are plain environment variables; use --secret for credentials.
 
 Secrets (--secret):
   Secrets are injected via MITM proxy - the real value never enters the VM.
@@ -52,19 +57,49 @@ Volume Mounts (-v):
   ./data:/workspace/data           Same as above (explicit guest path)
   /host/path:subdir:host_fs        Read-write host mount to <workspace>/subdir
   /host/path:subdir:ro             Read-only host mount to <workspace>/subdir
+  ./app.conf:app.conf:ro:watch     Read-only host file; guest sees host edits immediately
 
 Wildcard Patterns for --allow-host:
   *                      Allow all hosts
   *.example.com          Allow all subdomains (api.example.com, a.b.example.com)
   api-*.example.com      Allow pattern match (api-v1.example.com, api-prod.example.com)
+  host.matchlock.internal  Reach services on this machine's loopback (must be listed
+                           explicitly; opens a path from the sandbox into the host)
+
+Entrypoint and command overrides:
+  --entrypoint replaces the image ENTRYPOINT (an empty value clears it).
+  --cmd replaces the image CMD and is split using shell quoting rules.
+  Positional arguments also replace CMD, so --cmd cannot be combined with them.
 
 Custom hosts with --add-host:
   --add-host api.internal:10.0.0.10
-  --add-host db.internal:10.0.0.11`,
+  --add-host db.internal:10.0.0.11
+
+Shadow traffic with --mirror (the guest only sees the real response):
+  --mirror api.openai.com=http://localhost:8000
+
+Metadata service with --metadata-service (requests need "Matchlock-Metadata: true"):
+  GET http://169.254.169.254/v1/sandbox                    ID, labels, non-secret config
+  GET http://169.254.169.254/v1/secrets/NAME               secret placeholder, replaced by the
+                                                           proxy on requests to its hosts
+
+Config files (-f/--config):
+  A YAML or JSON file with "version: 1" and the sandbox settings under their
+  API names (image, resources, network, vfs, env, ...). Flags that are set
+  explicitly override the file; env, secrets and volumes are merged by key.
+  Unknown fields are rejected. String values may use ${VAR} to read from the
+  host environment (e.g. secret values); --strict-env rejects unset ones.`,
 	Example: `  matchlock run --image alpine:latest -it sh
   matchlock run --image python:3.12-alpine python3 -c 'print(42)'
   matchlock run --image alpine:latest --rm=false   # keep VM alive after exit
+  matchlock run --image nginx:alpine -P --rm=false # publish EXPOSEd ports
+  matchlock run --image nginx:alpine -p 8080:80 --rm=false
+  matchlock run --image python:3.12-alpine -v ./src:src --export-workspace ./out python src/job.py
   matchlock exec <vm-id> echo hello                # exec into running VM
+  matchlock run -f sandbox.yaml -- python agent.py # settings from a config file
+
+  # Override image ENTRYPOINT and CMD
+  matchlock run --image python:3.12-alpine --entrypoint python3 --cmd "-c 'print(42)'"
 
   # With non-secret env vars
   matchlock run --image alpine:latest -e FOO=bar -- sh -c 'echo $FOO'
@@ -80,34 +115,75 @@ Custom hosts with --add-host:
 }
 
 func init() {
-	runCmd.Flags().String("image", "", "Container image (required)")
+	runCmd.Flags().String("image", "", "Container image (required unless set in --config)")
+	runCmd.Flags().StringP("config", "f", "", "Sandbox config file (YAML or JSON); explicitly set flags override it")
+	runCmd.Flags().Bool("strict-env", false, "Fail if the config file references an unset ${VAR} instead of expanding it to empty")
 	runCmd.Flags().String("workspace", api.DefaultWorkspace, "Guest mount point for VFS")
 	runCmd.Flags().StringSlice("allow-host", nil, "Allowed hosts (can be repeated)")
 	runCmd.Flags().StringSlice("add-host", nil, "Add a custom host-to-IP mapping (host:ip, can be repeated)")
-	runCmd.Flags().StringSliceP("volume", "v", nil, fmt.Sprintf("Volume mount (host:guest = overlay snapshot by default; use :%s for direct rw host mount, :%s for read-only host mount)", api.MountTypeHostFS, api.MountOptionReadonlyShort))
+	runCmd.Flags().StringSliceP("volume", "v", nil, fmt.Sprintf("Volume mount (host:guest = overlay snapshot by default; use :%s for direct rw host mount, :%s for read-only host mount, add :%s to skip guest attribute caching)", api.MountTypeHostFS, api.MountOptionReadonlyShort, api.MountOptionWatch))
 	runCmd.Flags().StringArrayP("env", "e", nil, "Environment variable (KEY=VALUE or KEY; can be repeated)")
 	runCmd.Flags().StringArray("env-file", nil, "Environment file (KEY=VALUE or KEY per line; can be repeated)")
 	runCmd.Flags().StringSlice("secret", nil, "Secret (NAME=VALUE@host1,host2 or NAME@host1,host2)")
 	runCmd.Flags().StringSlice("allow-private-host", nil, "Allow specific private IP addresses (bypasses block-private-ips for these hosts)")
+	runCmd.Flags().StringSlice("allow-udp-host", nil, "Allow guest UDP to host or host:port (repeatable; supports wildcards; other UDP except DNS is dropped)")
 	runCmd.Flags().StringSlice("dns-servers", nil, "DNS servers (default: 8.8.8.8,8.8.4.4)")
+	runCmd.Flags().StringSlice("dns-search", nil, "DNS search domains written to the guest's resolv.conf")
+	runCmd.Flags().StringSlice("dns-option", nil, "resolv.conf options for the guest (e.g. ndots:2,rotate)")
+	runCmd.Flags().StringSlice("upstream-dns", nil, "DNS servers (ip or ip:port) the host proxy uses to resolve allowed hosts (default: host resolver)")
+	runCmd.Flags().String("upstream-proxy", "", "Proxy URL (http, https, socks5 or socks5h) the host proxy tunnels upstream connections through (default: $HTTPS_PROXY; \"none\" to connect directly)")
+	runCmd.Flags().StringArray("mirror", nil, "Copy requests to matching hosts to a shadow endpoint (host_glob=url; can be repeated)")
 	runCmd.Flags().String("hostname", "", "Guest hostname (default: sandbox ID)")
+	runCmd.Flags().String("ip", "", "Static guest IPv4 address in 192.168.100.0-192.168.254.255, or 10.99.0.0/16 with --shared-bridge (default: allocated subnet's .2)")
+	runCmd.Flags().String("mac-address", "", "Static guest MAC address (default: derived from the sandbox ID)")
 	runCmd.Flags().Int("mtu", api.DefaultNetworkMTU, "Network MTU for guest interface")
-	runCmd.Flags().StringArrayP("publish", "p", nil, "Publish a host port to a sandbox port ([LOCAL_PORT:]REMOTE_PORT)")
-	runCmd.Flags().StringSlice("address", []string{"127.0.0.1"}, "Address to bind published ports on the host (can be repeated)")
+	runCmd.Flags().Bool("auto-mtu", false, "Use the host's outbound interface MTU for the guest (ignored when --mtu is set)")
+	runCmd.Flags().Bool("clamp-mss", false, "Clamp TCP MSS on forwarded SYNs to the route MTU (Linux only)")
+	runCmd.Flags().Bool("shared-bridge", false, "Attach the VM to the shared host bridge (10.99.0.0/16) instead of its own subnet (Linux only)")
+	runCmd.Flags().Int("max-connections", 0, "Maximum concurrent guest TCP connections through the proxy (0 = unlimited)")
+	runCmd.Flags().Int("max-connections-per-host", 0, "Maximum concurrent guest TCP connections per destination IP (0 = unlimited)")
+	runCmd.Flags().Bool("metadata-service", false, "Serve sandbox metadata and by-name secret lookups to the guest at http://169.254.169.254")
+	runCmd.Flags().Bool("wait-for-network", false, "Hold boot until the guest can open a TCP connection to --network-probe")
+	runCmd.Flags().String("network-probe", "", "host:port checked by --wait-for-network (default: first DNS server, port 53)")
+	runCmd.Flags().StringArray("label", nil, "Sandbox label KEY=VALUE, readable via the metadata service (can be repeated)")
+	runCmd.Flags().StringArrayP("publish", "p", nil, "Publish a sandbox port on the host, docker-style ([[ADDRESS:]HOST_PORT:]CONTAINER_PORT; no HOST_PORT picks an ephemeral port)")
+	runCmd.Flags().BoolP("publish-all", "P", false, "Publish all image EXPOSEd ports to ephemeral host ports")
+	runCmd.Flags().StringSlice("address", []string{"127.0.0.1"}, "Address to bind published ports on the host (can be repeated; an ADDRESS in -p overrides it)")
 	runCmd.Flags().Int("cpus", api.DefaultCPUs, "Number of CPUs")
 	runCmd.Flags().Int("memory", api.DefaultMemoryMB, "Memory in MB")
+	runCmd.Flags().Int("swap", 0, "Compressed zram swap in MB inside the guest (at most 2x --memory; 0 disables)")
+	runCmd.Flags().String("cpuset", "", "Pin the VM to these host CPUs, e.g. 0-3 or 0,2,4 (Linux hosts only)")
+	runCmd.Flags().String("cgroup-parent", "", "Run the VM in its own host cgroup under this cgroup v2 path (default $MATCHLOCK_CGROUP_PARENT; Linux hosts only)")
 	runCmd.Flags().Int("timeout", api.DefaultTimeoutSeconds, "Timeout in seconds")
 	runCmd.Flags().Int("disk-size", api.DefaultDiskSizeMB, "Disk size in MB")
 	runCmd.Flags().BoolP("tty", "t", false, "Allocate a pseudo-TTY")
 	runCmd.Flags().BoolP("interactive", "i", false, "Keep STDIN open")
 	runCmd.Flags().Bool("pull", false, "Always pull image from registry (ignore cache)")
+	runCmd.Flags().Bool("require-signature", false, "Refuse to run the image unless it has a cosign signature by a --trusted-key")
+	runCmd.Flags().StringArray("trusted-key", nil, "Public key (PEM file) that image signatures are verified against (can be repeated)")
 	runCmd.Flags().Bool("rm", true, "Remove sandbox after command exits (set --rm=false to keep running)")
-	runCmd.Flags().Bool("privileged", false, "Skip in-guest security restrictions (seccomp, cap drop, no_new_privs)")
+	runCmd.Flags().StringArray("on-exit", nil, "Run a hook after the command exits, before teardown: export:GUEST_PATH:HOST_DIR (can be repeated; runs in order)")
+	runCmd.Flags().String("export-workspace", "", "Copy the workspace to this host directory after the command exits (after --on-exit hooks)")
+	runCmd.Flags().Bool("privileged", false, "Skip all in-guest security restrictions (seccomp, cap drop, no_new_privs); prefer --cap-add, --allow-syscall or --disable-no-new-privs")
+	runCmd.Flags().StringSlice("cap-add", nil, "Keep a guest capability that is dropped by default (e.g. SYS_PTRACE; can be repeated)")
+	runCmd.Flags().StringSlice("allow-syscall", nil, "Remove a syscall from the guest seccomp filter (ptrace, process_vm_readv, process_vm_writev, kexec_load, kexec_file_load; can be repeated)")
+	runCmd.Flags().StringArray("ulimit", nil, "Set a resource limit on guest commands: name=soft[:hard], e.g. nofile=65536 (core, nofile, nproc, stack; can be repeated)")
+	runCmd.Flags().Bool("disable-no-new-privs", false, "Leave no_new_privs unset so setuid binaries work in the guest (seccomp and cap drop still apply)")
+	runCmd.Flags().Bool("seccomp-audit", false, "Log security-relevant guest syscalls to stderr (slows syscall-heavy workloads)")
+	runCmd.Flags().Bool("shared-rootfs", false, "Boot from a shared read-only image rootfs with a per-VM overlay instead of copying it")
+	runCmd.Flags().Bool("skip-rootfs-check", false, "Skip the read-only e2fsck pass over the rootfs before boot")
+	runCmd.Flags().Bool("keep-on-exit", false, "Keep the sandbox's state directory, including its rootfs, after it stops (overrides --rm's removal)")
+	runCmd.Flags().String("kernel", "", "Boot from this kernel image instead of the default cached kernel")
+	runCmd.Flags().StringArray("kernel-module", nil, "Load a kernel module (.ko built for the sandbox kernel) at boot (repeatable, Linux only)")
+	runCmd.Flags().StringArray("init-command", nil, "Run a setup command as root after boot and before the workload; failure aborts the run (repeatable)")
+	runCmd.Flags().StringSlice("cap-drop", nil, "Drop an additional guest capability (e.g. NET_RAW, or ALL; can be repeated)")
 	runCmd.Flags().StringP("workdir", "w", "", "Working directory inside the sandbox (default: image WORKDIR, then workspace path)")
+	runCmd.Flags().Bool("login-shell", false, "Run the command with sh -lc so /etc/profile and ~/.profile set up the environment (PATH for conda, nvm, ...)")
 	runCmd.Flags().StringP("user", "u", "", "Run as user (uid, uid:gid, or username; overrides image USER)")
 	runCmd.Flags().String("entrypoint", "", "Override image ENTRYPOINT")
+	runCmd.Flags().String("cmd", "", "Override image CMD (shell-quoted string; cannot be combined with command args)")
 	runCmd.Flags().Duration("graceful-shutdown", api.DefaultGracefulShutdownPeriod, "Graceful shutdown timeout before force-stopping the VM ")
-	runCmd.MarkFlagRequired("image")
+	runCmd.Flags().Int("stop-grace-period", 0, "Seconds to wait for the VM to exit after SIGTERM before killing it, unless --graceful-shutdown is set (default 5; Linux only)")
 
 	viper.BindPFlag("run.image", runCmd.Flags().Lookup("image"))
 	viper.BindPFlag("run.workspace", runCmd.Flags().Lookup("workspace"))
@@ -118,18 +194,36 @@ func init() {
 	viper.BindPFlag("run.env-file", runCmd.Flags().Lookup("env-file"))
 	viper.BindPFlag("run.secret", runCmd.Flags().Lookup("secret"))
 	viper.BindPFlag("run.allow-private-host", runCmd.Flags().Lookup("allow-private-host"))
+	viper.BindPFlag("run.allow-udp-host", runCmd.Flags().Lookup("allow-udp-host"))
 	viper.BindPFlag("run.hostname", runCmd.Flags().Lookup("hostname"))
+	viper.BindPFlag("run.ip", runCmd.Flags().Lookup("ip"))
+	viper.BindPFlag("run.mac-address", runCmd.Flags().Lookup("mac-address"))
 	viper.BindPFlag("run.mtu", runCmd.Flags().Lookup("mtu"))
+	viper.BindPFlag("run.auto-mtu", runCmd.Flags().Lookup("auto-mtu"))
+	viper.BindPFlag("run.clamp-mss", runCmd.Flags().Lookup("clamp-mss"))
+	viper.BindPFlag("run.shared-bridge", runCmd.Flags().Lookup("shared-bridge"))
+	viper.BindPFlag("run.max-connections", runCmd.Flags().Lookup("max-connections"))
+	viper.BindPFlag("run.max-connections-per-host", runCmd.Flags().Lookup("max-connections-per-host"))
+	viper.BindPFlag("run.metadata-service", runCmd.Flags().Lookup("metadata-service"))
+	viper.BindPFlag("run.wait-for-network", runCmd.Flags().Lookup("wait-for-network"))
+	viper.BindPFlag("run.network-probe", runCmd.Flags().Lookup("network-probe"))
+	viper.BindPFlag("run.label", runCmd.Flags().Lookup("label"))
 	viper.BindPFlag("run.publish", runCmd.Flags().Lookup("publish"))
+	viper.BindPFlag("run.publish-all", runCmd.Flags().Lookup("publish-all"))
 	viper.BindPFlag("run.address", runCmd.Flags().Lookup("address"))
 	viper.BindPFlag("run.cpus", runCmd.Flags().Lookup("cpus"))
 	viper.BindPFlag("run.memory", runCmd.Flags().Lookup("memory"))
+	viper.BindPFlag("run.swap", runCmd.Flags().Lookup("swap"))
 	viper.BindPFlag("run.timeout", runCmd.Flags().Lookup("timeout"))
 	viper.BindPFlag("run.disk-size", runCmd.Flags().Lookup("disk-size"))
 	viper.BindPFlag("run.tty", runCmd.Flags().Lookup("tty"))
 	viper.BindPFlag("run.interactive", runCmd.Flags().Lookup("interactive"))
 	viper.BindPFlag("run.pull", runCmd.Flags().Lookup("pull"))
+	viper.BindPFlag("run.require-signature", runCmd.Flags().Lookup("require-signature"))
+	viper.BindPFlag("run.trusted-key", runCmd.Flags().Lookup("trusted-key"))
 	viper.BindPFlag("run.rm", runCmd.Flags().Lookup("rm"))
+	viper.BindPFlag("run.on-exit", runCmd.Flags().Lookup("on-exit"))
+	viper.BindPFlag("run.export-workspace", runCmd.Flags().Lookup("export-workspace"))
 
 	rootCmd.AddCommand(runCmd)
 }
@@ -137,13 +231,35 @@ func init() {
 func runRun(cmd *cobra.Command, args []string) error {
 	// Image & lifecycle
 	imageName, _ := cmd.Flags().GetString("image")
+	configPath, _ := cmd.Flags().GetString("config")
+	strictEnv, _ := cmd.Flags().GetBool("strict-env")
 	pull, _ := cmd.Flags().GetBool("pull")
+	requireSignature, _ := cmd.Flags().GetBool("require-signature")
+	trustedKeys, _ := cmd.Flags().GetStringArray("trusted-key")
 	rm, _ := cmd.Flags().GetBool("rm")
+	onExitSpecs, _ := cmd.Flags().GetStringArray("on-exit")
+	exportWorkspace, _ := cmd.Flags().GetString("export-workspace")
 	privileged, _ := cmd.Flags().GetBool("privileged")
+	capAdd, _ := cmd.Flags().GetStringSlice("cap-add")
+	capDrop, _ := cmd.Flags().GetStringSlice("cap-drop")
+	allowSyscalls, _ := cmd.Flags().GetStringSlice("allow-syscall")
+	disableNoNewPrivs, _ := cmd.Flags().GetBool("disable-no-new-privs")
+	ulimitSpecs, _ := cmd.Flags().GetStringArray("ulimit")
+	seccompAudit, _ := cmd.Flags().GetBool("seccomp-audit")
+	sharedRootfs, _ := cmd.Flags().GetBool("shared-rootfs")
+	skipRootfsCheck, _ := cmd.Flags().GetBool("skip-rootfs-check")
+	keepOnExit, _ := cmd.Flags().GetBool("keep-on-exit")
+	stopGracePeriod, _ := cmd.Flags().GetInt("stop-grace-period")
+	kernelPath, _ := cmd.Flags().GetString("kernel")
+	kernelModules, _ := cmd.Flags().GetStringArray("kernel-module")
+	initCommands, _ := cmd.Flags().GetStringArray("init-command")
 
 	// Resources
 	cpus, _ := cmd.Flags().GetInt("cpus")
 	memory, _ := cmd.Flags().GetInt("memory")
+	swap, _ := cmd.Flags().GetInt("swap")
+	cpusetSpec, _ := cmd.Flags().GetString("cpuset")
+	cgroupParent, _ := cmd.Flags().GetString("cgroup-parent")
 	diskSize, _ := cmd.Flags().GetInt("disk-size")
 	timeout, _ := cmd.Flags().GetInt("timeout")
 
@@ -153,30 +269,83 @@ func runRun(cmd *cobra.Command, args []string) error {
 	interactiveMode := tty && interactive
 	workspace, _ := cmd.Flags().GetString("workspace")
 	workdir, _ := cmd.Flags().GetString("workdir")
+	loginShell, _ := cmd.Flags().GetBool("login-shell")
 
 	// Network & security
 	allowHosts, _ := cmd.Flags().GetStringSlice("allow-host")
 	allowPrivateHosts, _ := cmd.Flags().GetStringSlice("allow-private-host")
+	allowUDPHosts, _ := cmd.Flags().GetStringSlice("allow-udp-host")
 	addHostSpecs, _ := cmd.Flags().GetStringSlice("add-host")
 	volumes, _ := cmd.Flags().GetStringSlice("volume")
 	envVars, _ := cmd.Flags().GetStringArray("env")
 	envFiles, _ := cmd.Flags().GetStringArray("env-file")
 	secrets, _ := cmd.Flags().GetStringSlice("secret")
 	dnsServers, _ := cmd.Flags().GetStringSlice("dns-servers")
+	upstreamDNS, _ := cmd.Flags().GetStringSlice("upstream-dns")
+	upstreamProxy, _ := cmd.Flags().GetString("upstream-proxy")
+	searchDomains, _ := cmd.Flags().GetStringSlice("dns-search")
+	resolvOptions, _ := cmd.Flags().GetStringSlice("dns-option")
+	mirrorSpecs, _ := cmd.Flags().GetStringArray("mirror")
 	hostname, _ := cmd.Flags().GetString("hostname")
+	staticIP, _ := cmd.Flags().GetString("ip")
+	staticMAC, _ := cmd.Flags().GetString("mac-address")
 	networkMTU, _ := cmd.Flags().GetInt("mtu")
+	autoMTU, _ := cmd.Flags().GetBool("auto-mtu")
+	clampMSS, _ := cmd.Flags().GetBool("clamp-mss")
+	sharedBridge, _ := cmd.Flags().GetBool("shared-bridge")
+	maxConnections, _ := cmd.Flags().GetInt("max-connections")
+	maxConnectionsPerHost, _ := cmd.Flags().GetInt("max-connections-per-host")
+	metadataService, _ := cmd.Flags().GetBool("metadata-service")
+	waitForNetwork, _ := cmd.Flags().GetBool("wait-for-network")
+	networkProbe, _ := cmd.Flags().GetString("network-probe")
+	labelSpecs, _ := cmd.Flags().GetStringArray("label")
 	publishSpecs, _ := cmd.Flags().GetStringArray("publish")
+	publishAll, _ := cmd.Flags().GetBool("publish-all")
 	addresses, _ := cmd.Flags().GetStringSlice("address")
 
 	if networkMTU <= 0 {
 		return fmt.Errorf("--mtu must be > 0")
 	}
+	// An explicit --mtu always wins over auto-detection.
+	autoMTU = autoMTU && !cmd.Flags().Changed("mtu")
+	if autoMTU {
+		networkMTU = 0
+	}
 
 	// Shutdown
 	gracefulShutdown, _ := cmd.Flags().GetDuration("graceful-shutdown")
 
 	user, _ := cmd.Flags().GetString("user")
 	entrypoint, _ := cmd.Flags().GetString("entrypoint")
+	cmdOverride, _ := cmd.Flags().GetString("cmd")
+
+	if cmd.Flags().Changed("cmd") && len(args) > 0 {
+		return errx.With(ErrInvalidCmd, ": --cmd cannot be combined with command arguments")
+	}
+
+	var fileConfig *api.Config
+	if configPath != "" {
+		var err error
+		if fileConfig, err = api.LoadConfigFile(configPath, api.ConfigFileOptions{StrictEnv: strictEnv}); err != nil {
+			return errx.Wrap(ErrInvalidConfig, err)
+		}
+		if !cmd.Flags().Changed("image") {
+			imageName = fileConfig.Image
+		}
+		if !cmd.Flags().Changed("require-signature") {
+			requireSignature = fileConfig.RequireSignature
+		}
+		if !cmd.Flags().Changed("trusted-key") {
+			trustedKeys = fileConfig.TrustedKeys
+		}
+		if !cmd.Flags().Changed("workspace") && fileConfig.VFS != nil && fileConfig.VFS.Workspace != "" {
+			// -v guest paths are relative to the workspace the sandbox gets.
+			workspace = fileConfig.VFS.Workspace
+		}
+	}
+	if imageName == "" {
+		return ErrImageRequired
+	}
 
 	command := api.ShellQuoteArgs(args)
 
@@ -192,26 +361,32 @@ func runRun(cmd *cobra.Command, args []string) error {
 	ctx, cancel = contextWithSignal(ctx)
 	defer cancel()
 
-	builder := image.NewBuilder(&image.BuildOptions{
-		ForcePull: pull,
-	})
+	buildOpts, err := imageBuildOptions(pull, requireSignature, trustedKeys)
+	if err != nil {
+		return errx.Wrap(ErrBuildingRootfs, err)
+	}
+	bar := newPullProgressBar()
+	buildOpts.Progress = bar.report()
+	builder := image.NewBuilder(buildOpts)
 
 	buildResult, err := builder.Build(ctx, imageName)
+	bar.clear()
 	if err != nil {
 		return errx.Wrap(ErrBuildingRootfs, err)
 	}
 	if !buildResult.Cached {
-		fmt.Fprintf(os.Stderr, "Built rootfs from %s (%.1f MB)\n", imageName, float64(buildResult.Size)/(1024*1024))
+		infof("Built rootfs from %s (%.1f MB)\n", imageName, float64(buildResult.Size)/(1024*1024))
 	}
 
 	var imageCfg *api.ImageConfig
 	if buildResult.OCI != nil {
 		imageCfg = &api.ImageConfig{
-			User:       buildResult.OCI.User,
-			WorkingDir: buildResult.OCI.WorkingDir,
-			Entrypoint: buildResult.OCI.Entrypoint,
-			Cmd:        buildResult.OCI.Cmd,
-			Env:        buildResult.OCI.Env,
+			User:         buildResult.OCI.User,
+			WorkingDir:   buildResult.OCI.WorkingDir,
+			Entrypoint:   buildResult.OCI.Entrypoint,
+			Cmd:          buildResult.OCI.Cmd,
+			Env:          buildResult.OCI.Env,
+			ExposedPorts: buildResult.OCI.ExposedPorts,
 		}
 	}
 
@@ -235,6 +410,18 @@ func runRun(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	// CLI --cmd overrides image CMD; an empty value clears it
+	if cmd.Flags().Changed("cmd") {
+		cmdArgs, err := api.ShellSplitArgs(cmdOverride)
+		if err != nil {
+			return errx.Wrap(ErrInvalidCmd, err)
+		}
+		if imageCfg == nil {
+			imageCfg = &api.ImageConfig{}
+		}
+		imageCfg.Cmd = cmdArgs
+	}
+
 	// Compose command from image ENTRYPOINT/CMD and user args.
 	// Always route through ComposeCommand so --entrypoint is applied even when
 	// user provides args (args replace CMD but ENTRYPOINT is always prepended).
@@ -264,6 +451,7 @@ func runRun(cmd *cobra.Command, args []string) error {
 				Type:     spec.Type,
 				HostPath: spec.HostPath,
 				Readonly: spec.Readonly,
+				Watch:    spec.Watch,
 			}
 			mounts[spec.GuestPath] = mount
 		}
@@ -286,16 +474,52 @@ func runRun(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return errx.Wrap(ErrInvalidEnv, err)
 	}
+	labels, err := api.ParseLabels(labelSpecs)
+	if err != nil {
+		return errx.Wrap(ErrInvalidLabel, err)
+	}
+	ulimits, err := api.ParseUlimits(ulimitSpecs)
+	if err != nil {
+		return errx.Wrap(ErrInvalidUlimit, err)
+	}
+	cpuAffinity, err := api.ParseCPUSet(cpusetSpec)
+	if err != nil {
+		return errx.Wrap(ErrInvalidCPUSet, err)
+	}
+
+	if _, err := api.CapabilityNumbers(capAdd); err != nil {
+		return errx.Wrap(ErrInvalidCapability, err)
+	}
+	if _, err := api.CapabilityNumbers(capDrop); err != nil {
+		return errx.Wrap(ErrInvalidCapability, err)
+	}
+	for _, c := range capAdd {
+		if api.IsDangerousCapability(c) {
+			warnf("--cap-add %s weakens guest isolation\n", c)
+		}
+	}
 
 	addHosts, err := api.ParseAddHosts(addHostSpecs)
 	if err != nil {
 		return errx.Wrap(ErrInvalidAddHost, err)
 	}
 
-	portForwards, err := api.ParsePortForwards(publishSpecs)
+	var mirrorRoutes []api.MirrorRule
+	for _, spec := range mirrorSpecs {
+		rule, err := api.ParseMirrorRule(spec)
+		if err != nil {
+			return errx.Wrap(ErrInvalidMirror, err)
+		}
+		mirrorRoutes = append(mirrorRoutes, rule)
+	}
+
+	portForwards, err := api.ParsePublishSpecs(publishSpecs)
 	if err != nil {
 		return errx.Wrap(ErrInvalidPortForward, err)
 	}
+	if publishAll && imageCfg != nil {
+		portForwards = append(portForwards, api.PublishAllPortForwards(imageCfg.ExposedPorts)...)
+	}
 	if len(portForwards) > 0 {
 		addresses, err = normalizePortForwardAddresses(addresses)
 		if err != nil {
@@ -304,11 +528,29 @@ func runRun(cmd *cobra.Command, args []string) error {
 	}
 
 	config := &api.Config{
-		Image:      imageName,
-		Privileged: privileged,
+		Image:                  imageName,
+		Privileged:             privileged,
+		CapAdd:                 capAdd,
+		CapDrop:                capDrop,
+		AllowSyscalls:          allowSyscalls,
+		DisableNoNewPrivs:      disableNoNewPrivs,
+		Ulimits:                ulimits,
+		SeccompAudit:           seccompAudit,
+		SharedRootfs:           sharedRootfs,
+		SkipRootfsCheck:        skipRootfsCheck,
+		KeepStateOnClose:       keepOnExit,
+		StopGracePeriodSeconds: stopGracePeriod,
+		KernelPath:             kernelPath,
+		KernelModules:          kernelModules,
+		InitCommands:           initCommands,
+		RequireSignature:       requireSignature,
+		TrustedKeys:            trustedKeys,
 		Resources: &api.Resources{
 			CPUs:           cpus,
 			MemoryMB:       memory,
+			SwapMB:         swap,
+			CPUAffinity:    cpuAffinity,
+			CgroupParent:   cgroupParent,
 			DiskSizeMB:     diskSize,
 			TimeoutSeconds: timeout,
 		},
@@ -317,21 +559,53 @@ func runRun(cmd *cobra.Command, args []string) error {
 			AddHosts:            addHosts,
 			BlockPrivateIPs:     true,
 			AllowedPrivateHosts: allowPrivateHosts,
+			AllowedUDPHosts:     allowUDPHosts,
 			Secrets:             parsedSecrets,
 			DNSServers:          dnsServers,
+			UpstreamDNS:         upstreamDNS,
+			UpstreamProxy:       upstreamProxy,
+			SearchDomains:       searchDomains,
+			ResolvOptions:       resolvOptions,
+			MirrorRoutes:        mirrorRoutes,
 			Hostname:            hostname,
+			StaticIP:            staticIP,
+			StaticMAC:           staticMAC,
 			MTU:                 networkMTU,
+			AutoMTU:             autoMTU,
+			ClampMSS:            clampMSS,
+			SharedBridge:        sharedBridge,
+			MetadataService:     metadataService,
+			WaitForNetwork:      waitForNetwork || networkProbe != "",
+			NetworkProbe:        networkProbe,
+
+			MaxConcurrentConnections: maxConnections,
+			MaxConnectionsPerHost:    maxConnectionsPerHost,
 		},
 		VFS:      vfsConfig,
 		Env:      parsedEnv,
+		Labels:   labels,
 		ImageCfg: imageCfg,
 	}
+	if fileConfig != nil {
+		config = mergeRunConfig(fileConfig, config, cmd.Flags())
+	}
+	if err := config.Validate(); err != nil {
+		return errx.Wrap(ErrInvalidConfig, err)
+	}
+	exitHooks, err := parseExitHooks(onExitSpecs, exportWorkspace, config.GetWorkspace())
+	if err != nil {
+		return err
+	}
 
 	sb, err := sandbox.New(ctx, config, sandboxOpts)
 	if err != nil {
 		return errx.Wrap(ErrCreateSandbox, err)
 	}
 
+	if config.SeccompAudit {
+		go logSyscallEvents(sb.Events())
+	}
+
 	if err := sb.Start(ctx); err != nil {
 		closeErr := sb.Close(ctx)
 		if closeErr != nil {
@@ -345,17 +619,27 @@ func runRun(cmd *cobra.Command, args []string) error {
 	stateMgr := state.NewManager()
 	execSocketPath := stateMgr.ExecSocketPath(sb.ID())
 	if err := execRelay.Start(execSocketPath); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to start exec relay: %v\n", err)
+		warnf("failed to start exec relay: %v\n", err)
 	}
 	defer execRelay.Stop()
 
 	if !rm {
-		fmt.Fprintf(os.Stderr, "Sandbox %s is running\n", sb.ID())
-		fmt.Fprintf(os.Stderr, "  Connect: matchlock exec %s -it bash\n", sb.ID())
-		fmt.Fprintf(os.Stderr, "  Stop:    matchlock kill %s\n", sb.ID())
+		infof("Sandbox %s is running\n", sb.ID())
+		infof("  Connect: matchlock exec %s -it bash\n", sb.ID())
+		infof("  Stop:    matchlock kill %s\n", sb.ID())
+		if command == "" && !interactiveMode {
+			if err := emitResult(&runResult{ID: sb.ID(), Status: "running"}, func() {}); err != nil {
+				return err
+			}
+		}
 	}
 
 	closeCtx := func() (context.Context, context.CancelFunc) {
+		// Without an explicit --graceful-shutdown, leave the deadline to the
+		// configured stop grace period.
+		if !cmd.Flags().Changed("graceful-shutdown") && config.StopGracePeriodSeconds > 0 {
+			return context.WithCancel(context.Background())
+		}
 		return context.WithTimeout(context.Background(), gracefulShutdown)
 	}
 
@@ -367,7 +651,9 @@ func runRun(cmd *cobra.Command, args []string) error {
 		if err := sb.Close(c); err != nil {
 			errs = append(errs, errx.Wrap(ErrCloseSandbox, err))
 		}
-		if remove {
+		if config.KeepStateOnClose {
+			infof("Sandbox state kept at %s\n", stateMgr.Dir(sb.ID()))
+		} else if remove {
 			if err := stateMgr.Remove(sb.ID()); err != nil {
 				errs = append(errs, errx.Wrap(ErrRemoveSandbox, err))
 			}
@@ -392,17 +678,18 @@ func runRun(cmd *cobra.Command, args []string) error {
 		}
 		defer pfManager.Close()
 		for _, b := range pfManager.Bindings() {
-			fmt.Fprintf(os.Stderr, "Forwarding %s:%d -> sandbox:%d\n", b.Address, b.LocalPort, b.RemotePort)
+			infof("Forwarding %s:%d -> sandbox:%d\n", b.Address, b.LocalPort, b.RemotePort)
 		}
 	}
 
 	if interactiveMode {
-		exitCode := runInteractive(ctx, sb, command, workdir)
+		exitCode := runInteractive(ctx, sb, command, workdir, loginShell)
+		hookErr := runExitHooks(sb, exitHooks)
 		if rm {
 			if err := cleanupSandbox(true); err != nil {
-				return err
+				return errors.Join(hookErr, err)
 			}
-			return commandExit(exitCode)
+			return exitAfterHooks(exitCode, hookErr)
 		}
 		// Keep sandbox alive for follow-up `matchlock exec` sessions.
 		<-ctx.Done()
@@ -411,8 +698,9 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 	if command != "" {
 		opts := &api.ExecOptions{
-			Stdout: os.Stdout,
-			Stderr: os.Stderr,
+			Stdout:     os.Stdout,
+			Stderr:     os.Stderr,
+			LoginShell: loginShell,
 		}
 		if interactive {
 			opts.Stdin = os.Stdin
@@ -420,6 +708,10 @@ func runRun(cmd *cobra.Command, args []string) error {
 		if workdir != "" {
 			opts.WorkingDir = workdir
 		}
+		// Keep stdout for the JSON result so scripts can parse it.
+		if cliOutput.format == outputJSON {
+			opts.Stdout = os.Stderr
+		}
 		result, err := sb.Exec(ctx, command, opts)
 		if err != nil {
 			if rm {
@@ -430,11 +722,16 @@ func runRun(cmd *cobra.Command, args []string) error {
 			return errx.Wrap(ErrExecCommand, err)
 		}
 
+		hookErr := runExitHooks(sb, exitHooks)
+		exitCode := result.ExitCode
+		if err := emitResult(&runResult{ID: sb.ID(), Status: "exited", ExitCode: &exitCode}, func() {}); err != nil {
+			return err
+		}
 		if rm {
 			if err := cleanupSandbox(true); err != nil {
-				return err
+				return errors.Join(hookErr, err)
 			}
-			return commandExit(result.ExitCode)
+			return exitAfterHooks(result.ExitCode, hookErr)
 		}
 	}
 
@@ -447,7 +744,15 @@ func runRun(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-func runInteractive(ctx context.Context, sb *sandbox.Sandbox, command, workdir string) int {
+// runResult is run's --output json result: the sandbox and, once its
+// command has finished, the command's exit code.
+type runResult struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+func runInteractive(ctx context.Context, sb *sandbox.Sandbox, command, workdir string, loginShell bool) int {
 	if !term.IsTerminal(int(os.Stdin.Fd())) {
 		fmt.Fprintln(os.Stderr, "Error: -it requires a TTY")
 		return 1
@@ -481,18 +786,13 @@ func runInteractive(ctx context.Context, sb *sandbox.Sandbox, command, workdir s
 	defer signal.Stop(winchCh)
 	defer close(resizeCh)
 
-	interactiveMachine, ok := sb.Machine().(vm.InteractiveMachine)
-	if !ok {
+	if _, ok := sb.Machine().(vm.InteractiveMachine); !ok {
 		fmt.Fprintln(os.Stderr, "Error: interactive mode not supported on this backend")
 		return 1
 	}
 
-	opts := sb.PrepareExecEnv()
-	if workdir != "" {
-		opts.WorkingDir = workdir
-	}
-
-	exitCode, err := interactiveMachine.ExecInteractive(ctx, command, opts, uint16(rows), uint16(cols), os.Stdin, os.Stdout, resizeCh)
+	opts := &api.ExecOptions{WorkingDir: workdir, LoginShell: loginShell}
+	exitCode, err := sb.ExecInteractive(ctx, command, opts, uint16(rows), uint16(cols), os.Stdin, os.Stdout, resizeCh)
 	if err != nil {
 		term.Restore(int(os.Stdin.Fd()), oldState)
 		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
@@ -501,3 +801,18 @@ func runInteractive(ctx context.Context, sb *sandbox.Sandbox, command, workdir s
 
 	return exitCode
 }
+
+// logSyscallEvents prints seccomp audit records until the sandbox closes its
+// event channel.
+func logSyscallEvents(events <-chan api.Event) {
+	for evt := range events {
+		if evt.Syscall == nil {
+			continue
+		}
+		blocked := ""
+		if evt.Syscall.Blocked {
+			blocked = " (blocked)"
+		}
+		fmt.Fprintf(os.Stderr, "[seccomp-audit] pid=%d %s(%s)%s\n", evt.Syscall.PID, evt.Syscall.Name, evt.Syscall.Args, blocked)
+	}
+}
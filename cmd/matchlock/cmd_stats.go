@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+	"github.com/jingkaihe/matchlock/pkg/state"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats <id>",
+	Short: "Show resource usage of a running sandbox",
+	Long: `Show CPU time, memory, network traffic and running exec sessions of a
+running sandbox. CPU% is only shown with --watch, where it is computed
+between consecutive samples. VMM memory and network bytes are reported by
+the Linux backend only; --json also carries the whole-VM CPU time and
+memory of the VM's host cgroup when it was started with --cgroup-parent.`,
+	Example: `  matchlock stats vm-abc123
+  matchlock stats --watch --interval 5s vm-abc123
+  matchlock stats --json vm-abc123`,
+	Args: cobra.ExactArgs(1),
+	RunE: runStats,
+}
+
+func init() {
+	statsCmd.Flags().Bool("json", false, "Print each sample as one line of JSON")
+	statsCmd.Flags().BoolP("watch", "w", false, "Keep sampling until interrupted")
+	statsCmd.Flags().Duration("interval", 2*time.Second, "Time between samples with --watch")
+	rootCmd.AddCommand(statsCmd)
+}
+
+func runStats(cmd *cobra.Command, args []string) error {
+	vmID := args[0]
+	asJSON, _ := cmd.Flags().GetBool("json")
+	watch, _ := cmd.Flags().GetBool("watch")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be positive, got %s", interval)
+	}
+
+	mgr := state.NewManager()
+	vmState, err := mgr.Get(vmID)
+	if err != nil {
+		return errx.With(ErrVMNotFound, " %s: %w", vmID, err)
+	}
+	if vmState.Status != "running" {
+		return fmt.Errorf("VM %s is not running (status: %s)", vmID, vmState.Status)
+	}
+
+	execSocketPath := mgr.ExecSocketPath(vmID)
+	if _, err := os.Stat(execSocketPath); err != nil {
+		return fmt.Errorf("exec socket not found for %s (was it started with --rm=false?)", vmID)
+	}
+
+	ctx, cancel := contextWithSignal(context.Background())
+	defer cancel()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !asJSON {
+		fmt.Fprintln(w, "CPU TIME\tCPU%\tMEM USED\tMEM TOTAL\tVMM RSS\tNET RX\tNET TX\tEXECS")
+	}
+
+	var prev *api.Stats
+	for {
+		stats, err := sandbox.StatsViaRelay(ctx, execSocketPath)
+		if err != nil {
+			if watch && ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if asJSON {
+			data, err := json.Marshal(stats)
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+		} else {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n",
+				(time.Duration(stats.CPUUsageUsec) * time.Microsecond).Round(time.Millisecond),
+				cpuPercent(prev, stats),
+				formatDiskBytes(stats.MemoryUsedBytes), formatDiskBytes(stats.MemoryTotalBytes),
+				formatDiskBytes(stats.VMMRSSBytes),
+				formatDiskBytes(stats.NetRxBytes), formatDiskBytes(stats.NetTxBytes),
+				stats.ActiveExecs)
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+		if !watch {
+			return nil
+		}
+		prev = stats
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// cpuPercent returns the guest CPU use between two samples as a share of
+// one vCPU, so a busy 2-vCPU guest shows 200%. It is "-" for the first
+// sample, which has nothing to compare against.
+func cpuPercent(prev, cur *api.Stats) string {
+	if prev == nil || !cur.Time.After(prev.Time) || cur.CPUUsageUsec < prev.CPUUsageUsec {
+		return "-"
+	}
+	wall := cur.Time.Sub(prev.Time).Microseconds()
+	return fmt.Sprintf("%.1f%%", float64(cur.CPUUsageUsec-prev.CPUUsageUsec)*100/float64(wall))
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestCPUPercent(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	prev := &api.Stats{CPUUsageUsec: 1_000_000, Time: start}
+
+	assert.Equal(t, "-", cpuPercent(nil, prev))
+	assert.Equal(t, "50.0%", cpuPercent(prev, &api.Stats{CPUUsageUsec: 2_000_000, Time: start.Add(2 * time.Second)}))
+	assert.Equal(t, "200.0%", cpuPercent(prev, &api.Stats{CPUUsageUsec: 3_000_000, Time: start.Add(time.Second)}))
+	assert.Equal(t, "-", cpuPercent(prev, &api.Stats{CPUUsageUsec: 500, Time: start.Add(time.Second)}), "counter reset after a restore")
+	assert.Equal(t, "-", cpuPercent(prev, &api.Stats{CPUUsageUsec: 2_000_000, Time: start}))
+}
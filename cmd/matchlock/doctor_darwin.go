@@ -0,0 +1,30 @@
+//go:build darwin
+
+package main
+
+import (
+	"syscall"
+)
+
+func platformDoctorChecks() []doctorCheck {
+	return []doctorCheck{
+		checkHypervisor(),
+	}
+}
+
+func checkHypervisor() doctorCheck {
+	c := doctorCheck{Name: "Hypervisor.framework", Critical: true}
+	supported, err := syscall.SysctlUint32("kern.hv_support")
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if supported != 1 {
+		c.Detail = "not supported on this Mac"
+		c.Hint = "Virtualization.framework needs Apple silicon or an Intel Mac with VT-x, and does not work inside most VMs"
+		return c
+	}
+	c.OK = true
+	c.Detail = "supported"
+	return c
+}
@@ -0,0 +1,128 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/google/nftables"
+
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+)
+
+const setupHint = "Run 'sudo matchlock setup linux'"
+
+func platformDoctorChecks() []doctorCheck {
+	return []doctorCheck{
+		checkKVMAccess(),
+		checkFirecracker(),
+		checkNetAdmin(),
+		checkTunDevice(),
+		checkNftablesUsable(),
+		checkIPForwarding(),
+	}
+}
+
+func checkKVMAccess() doctorCheck {
+	c := doctorCheck{Name: "KVM", Critical: true}
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		c.Detail = err.Error()
+		if errors.Is(err, os.ErrNotExist) {
+			c.Hint = "Enable virtualization in BIOS/UEFI, or run: sudo modprobe kvm kvm_intel (or kvm_amd)"
+		} else {
+			c.Hint = setupHint + " to add your user to the kvm group, then log in again"
+		}
+		return c
+	}
+	f.Close()
+	c.OK = true
+	c.Detail = "/dev/kvm is accessible"
+	return c
+}
+
+func checkFirecracker() doctorCheck {
+	c := doctorCheck{Name: "Firecracker", Critical: true}
+	path, err := exec.LookPath("firecracker")
+	if err != nil {
+		c.Detail = "not found in PATH"
+		c.Hint = setupHint + " to install it"
+		return c
+	}
+	version := getFirecrackerVersion()
+	if version == "" {
+		c.Detail = path + " does not report a version"
+		c.Hint = setupHint + " to reinstall it"
+		return c
+	}
+	c.OK = true
+	c.Detail = version + " (" + path + ")"
+	return c
+}
+
+func checkNetAdmin() doctorCheck {
+	c := doctorCheck{Name: "CAP_NET_ADMIN", Critical: true}
+	if err := sandbox.CheckNetworkPrivileges(); err != nil {
+		c.Detail = err.Error()
+		c.Hint = setupHint + " to grant it to the matchlock binary"
+		return c
+	}
+	c.OK = true
+	c.Detail = "effective"
+	return c
+}
+
+func checkTunDevice() doctorCheck {
+	c := doctorCheck{Name: "/dev/net/tun", Critical: true}
+	f, err := os.OpenFile("/dev/net/tun", os.O_RDWR, 0)
+	if err != nil {
+		c.Detail = err.Error()
+		c.Hint = setupHint + " to make it accessible to the netdev group"
+		return c
+	}
+	f.Close()
+	c.OK = true
+	c.Detail = "accessible"
+	return c
+}
+
+func checkNftablesUsable() doctorCheck {
+	c := doctorCheck{Name: "nftables", Critical: true}
+	conn, err := nftables.New()
+	if err == nil {
+		_, err = conn.ListTables()
+	}
+	if err != nil {
+		c.Detail = err.Error()
+		if errors.Is(err, syscall.EPERM) {
+			c.Hint = setupHint + " to grant CAP_NET_ADMIN, which nftables needs"
+		} else {
+			c.Hint = "Run 'sudo modprobe nf_tables'"
+		}
+		return c
+	}
+	c.OK = true
+	c.Detail = "netlink API usable"
+	return c
+}
+
+func checkIPForwarding() doctorCheck {
+	c := doctorCheck{Name: "IP forwarding"}
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ip_forward")
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	if strings.TrimSpace(string(data)) != "1" {
+		c.Detail = "disabled"
+		c.Hint = setupHint + " to enable it persistently; guest networking needs it and a rootless matchlock cannot switch it on"
+		return c
+	}
+	c.OK = true
+	c.Detail = "enabled"
+	return c
+}
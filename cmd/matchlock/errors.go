@@ -27,6 +27,18 @@ var (
 	ErrImportImage         = errors.New("import built image")
 )
 
+// Cp errors
+var (
+	ErrInvalidCp = errors.New("invalid cp arguments")
+	ErrCopy      = errors.New("copy failed")
+	ErrCpSymlink = errors.New("refusing to write through a symlink")
+)
+
+// Doctor errors
+var (
+	ErrDoctorFailed = errors.New("host checks failed")
+)
+
 // Exec errors
 var (
 	ErrVMNotFound      = errors.New("VM not found")
@@ -34,6 +46,23 @@ var (
 	ErrPipeExecFailed  = errors.New("pipe exec failed")
 	ErrSetRawMode      = errors.New("setting raw mode")
 	ErrInteractiveExec = errors.New("interactive exec failed")
+	ErrInputFile       = errors.New("open input file")
+)
+
+// Export errors
+var (
+	ErrExportDebug = errors.New("export debug archive")
+)
+
+// List errors
+var (
+	ErrInvalidListFormat = errors.New("invalid --format")
+	ErrInvalidListFilter = errors.New("invalid --filter")
+)
+
+// Output errors
+var (
+	ErrInvalidOutputFormat = errors.New("invalid --output")
 )
 
 // Pull errors
@@ -48,11 +77,19 @@ var (
 
 // Run errors
 var (
+	ErrImageRequired          = errors.New("--image is required (or set image in --config)")
 	ErrBuildingRootfs         = errors.New("building rootfs")
 	ErrInvalidVolume          = errors.New("invalid volume mount")
 	ErrInvalidSecret          = errors.New("invalid secret")
 	ErrInvalidAddHost         = errors.New("invalid add-host mapping")
+	ErrInvalidMirror          = errors.New("invalid --mirror")
 	ErrInvalidEnv             = errors.New("invalid environment variable")
+	ErrInvalidLabel           = errors.New("invalid label")
+	ErrInvalidUlimit          = errors.New("invalid ulimit")
+	ErrInvalidCPUSet          = errors.New("invalid --cpuset")
+	ErrInvalidCmd             = errors.New("invalid --cmd")
+	ErrInvalidCapability      = errors.New("invalid capability")
+	ErrInvalidConfig          = errors.New("invalid sandbox config")
 	ErrInvalidPortForward     = errors.New("invalid port-forward specification")
 	ErrInvalidPortForwardAddr = errors.New("invalid port-forward bind address")
 	ErrPortForwardListen      = errors.New("start port-forward listener")
@@ -61,6 +98,8 @@ var (
 	ErrCloseSandbox           = errors.New("closing sandbox")
 	ErrRemoveSandbox          = errors.New("removing sandbox")
 	ErrExecCommand            = errors.New("executing command")
+	ErrInvalidExitHook        = errors.New("invalid --on-exit hook")
+	ErrExitHook               = errors.New("on-exit hook failed")
 )
 
 // Setup errors (Linux)
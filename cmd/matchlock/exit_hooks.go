@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+)
+
+// exitHook is an action run after the command exits and before the sandbox
+// is torn down. "export" is currently the only kind.
+type exitHook struct {
+	kind      string
+	guestPath string
+	hostDir   string
+}
+
+// parseExitHooks parses --on-exit specs (KIND:ARGS) and appends the
+// --export-workspace shorthand, if set, as a final export of workspace.
+func parseExitHooks(specs []string, exportWorkspace, workspace string) ([]exitHook, error) {
+	hooks := make([]exitHook, 0, len(specs)+1)
+	for _, spec := range specs {
+		kind, args, _ := strings.Cut(spec, ":")
+		switch kind {
+		case "export":
+			guestPath, hostDir, ok := strings.Cut(args, ":")
+			if !ok || !path.IsAbs(guestPath) || hostDir == "" {
+				return nil, errx.With(ErrInvalidExitHook, " %q: expected export:GUEST_PATH:HOST_DIR with an absolute GUEST_PATH", spec)
+			}
+			hooks = append(hooks, exitHook{kind: kind, guestPath: guestPath, hostDir: hostDir})
+		default:
+			return nil, errx.With(ErrInvalidExitHook, " %q: unknown hook %q (supported: export)", spec, kind)
+		}
+	}
+	if exportWorkspace != "" {
+		hooks = append(hooks, exitHook{kind: "export", guestPath: workspace, hostDir: exportWorkspace})
+	}
+	return hooks, nil
+}
+
+// runExitHooks runs hooks in order. A failing hook is reported and does not
+// stop the ones after it.
+func runExitHooks(sb *sandbox.Sandbox, hooks []exitHook) error {
+	var errs []error
+	for _, hook := range hooks {
+		fmt.Fprintf(os.Stderr, "Exporting %s to %s\n", hook.guestPath, hook.hostDir)
+		if err := sb.ExportPath(context.Background(), hook.guestPath, hook.hostDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: on-exit export of %s failed: %v\n", hook.guestPath, err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errx.Wrap(ErrExitHook, errors.Join(errs...))
+	}
+	return nil
+}
+
+// exitAfterHooks returns the command's exit status, or the hook error when
+// the command itself succeeded.
+func exitAfterHooks(exitCode int, hookErr error) error {
+	if hookErr != nil && exitCode == 0 {
+		return hookErr
+	}
+	return commandExit(exitCode)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExitHooks(t *testing.T) {
+	hooks, err := parseExitHooks([]string{"export:/workspace/out:./out", "export:/tmp/log.txt:/var/tmp/logs"}, "./ws", "/workspace")
+	require.NoError(t, err)
+	assert.Equal(t, []exitHook{
+		{kind: "export", guestPath: "/workspace/out", hostDir: "./out"},
+		{kind: "export", guestPath: "/tmp/log.txt", hostDir: "/var/tmp/logs"},
+		{kind: "export", guestPath: "/workspace", hostDir: "./ws"},
+	}, hooks)
+}
+
+func TestParseExitHooksRejectsInvalid(t *testing.T) {
+	for _, spec := range []string{"export:/workspace", "export:relative:./out", "export:/workspace:", "upload:/workspace:s3://x"} {
+		_, err := parseExitHooks([]string{spec}, "", "/workspace")
+		require.ErrorIs(t, err, ErrInvalidExitHook, spec)
+	}
+}
+
+func TestExitAfterHooks(t *testing.T) {
+	hookErr := errors.New("export failed")
+	assert.ErrorIs(t, exitAfterHooks(0, hookErr), hookErr)
+	assert.NoError(t, exitAfterHooks(0, nil))
+
+	var exitErr *exitCodeError
+	require.ErrorAs(t, exitAfterHooks(3, hookErr), &exitErr, "the command's failure takes precedence")
+	assert.Equal(t, 3, exitErr.code)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"text/tabwriter"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/image"
 )
 
@@ -32,6 +34,13 @@ var imageRmCmd = &cobra.Command{
 	RunE:    runImageRm,
 }
 
+var imageInspectCmd = &cobra.Command{
+	Use:   "inspect <tag>",
+	Short: "Show image metadata as JSON, including the verified signer",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runImageInspect,
+}
+
 var imageImportCmd = &cobra.Command{
 	Use:   "import <tag>",
 	Short: "Import an image from a Docker/OCI tarball via stdin",
@@ -47,6 +56,7 @@ The tarball format is the same as "docker save" output.`,
 func init() {
 	imageCmd.AddCommand(imageLsCmd)
 	imageCmd.AddCommand(imageRmCmd)
+	imageCmd.AddCommand(imageInspectCmd)
 	imageCmd.AddCommand(imageImportCmd)
 	rootCmd.AddCommand(imageCmd)
 }
@@ -106,6 +116,51 @@ func runImageRm(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func runImageInspect(cmd *cobra.Command, args []string) error {
+	tag := args[0]
+	localImages, err := image.NewStore("").List()
+	if err != nil {
+		return err
+	}
+	registryImages, err := image.ListRegistryCache("")
+	if err != nil {
+		return err
+	}
+
+	for _, img := range append(localImages, registryImages...) {
+		if img.Tag != tag {
+			continue
+		}
+		if img.Meta.Source == "" {
+			img.Meta.Source = "local"
+		}
+		data, err := json.MarshalIndent(img.Meta, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	return errx.With(image.ErrImageNotFound, ": %q", tag)
+}
+
+// imageBuildOptions loads trustedKeys (PEM files or inline PEM) for
+// signature verification when building an image.
+func imageBuildOptions(forcePull, requireSignature bool, trustedKeys []string) (*image.BuildOptions, error) {
+	opts := &image.BuildOptions{
+		ForcePull:        forcePull,
+		RequireSignature: requireSignature,
+	}
+	if len(trustedKeys) > 0 {
+		keys, err := image.LoadTrustedKeys(trustedKeys)
+		if err != nil {
+			return nil, err
+		}
+		opts.TrustedKeys = keys
+	}
+	return opts, nil
+}
+
 func runImageImport(cmd *cobra.Command, args []string) error {
 	tag := args[0]
 
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// cliOutput holds the global --quiet and --output flags. Data a command
+// produces goes to stdout; warnings and progress notes go to stderr, so
+// scripts can read one without the other.
+var cliOutput struct {
+	quiet  bool
+	format string
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVarP(&cliOutput.quiet, "quiet", "q", false, "Suppress warnings and informational messages")
+	rootCmd.PersistentFlags().StringVar(&cliOutput.format, "output", outputText, "Result format for run, kill, rm, prune, list and doctor: text or json")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return validateOutputFormat()
+	}
+}
+
+func validateOutputFormat() error {
+	switch cliOutput.format {
+	case outputText, outputJSON:
+		return nil
+	}
+	return errx.With(ErrInvalidOutputFormat, " %q: expected text or json", cliOutput.format)
+}
+
+// infof prints an informational message to stderr unless --quiet is set.
+func infof(format string, args ...interface{}) {
+	if cliOutput.quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, args...)
+}
+
+// warnf prints a "Warning: " message to stderr unless --quiet is set.
+func warnf(format string, args ...interface{}) {
+	if cliOutput.quiet {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: "+format, args...)
+}
+
+// pullProgressBar draws image pull progress on a single stderr line.
+type pullProgressBar struct {
+	w     io.Writer
+	drawn bool
+}
+
+// newPullProgressBar returns nil, which draws nothing, under --quiet or
+// when stderr is not a terminal.
+func newPullProgressBar() *pullProgressBar {
+	if cliOutput.quiet || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return &pullProgressBar{w: os.Stderr}
+}
+
+// report returns the callback for image.BuildOptions.Progress.
+func (b *pullProgressBar) report() func(api.ImageProgress) {
+	if b == nil {
+		return nil
+	}
+	return func(p api.ImageProgress) {
+		fmt.Fprintf(b.w, "\r\033[K%s", formatPullProgress(p))
+		b.drawn = true
+	}
+}
+
+// clear erases the bar so later output starts on a clean line.
+func (b *pullProgressBar) clear() {
+	if b == nil || !b.drawn {
+		return
+	}
+	fmt.Fprint(b.w, "\r\033[K")
+	b.drawn = false
+}
+
+const pullProgressWidth = 30
+
+func formatPullProgress(p api.ImageProgress) string {
+	switch p.Phase {
+	case api.ImageProgressResolve:
+		return fmt.Sprintf("Resolving %s...", p.Image)
+	case api.ImageProgressRootfs:
+		return fmt.Sprintf("Building rootfs from %s...", p.Image)
+	}
+	filled := 0
+	if p.BytesTotal > 0 {
+		filled = int(p.BytesDone * pullProgressWidth / p.BytesTotal)
+	}
+	filled = min(filled, pullProgressWidth)
+	return fmt.Sprintf("Pulling %s [%s%s] %d/%d layers, %.1f/%.1f MB",
+		p.Image,
+		strings.Repeat("=", filled), strings.Repeat(" ", pullProgressWidth-filled),
+		p.LayersDone, p.Layers,
+		float64(p.BytesDone)/(1024*1024), float64(p.BytesTotal)/(1024*1024))
+}
+
+// emitResult writes result as one line of JSON to stdout with --output
+// json, and otherwise calls text, which prints the human form.
+func emitResult(result interface{}, text func()) error {
+	if cliOutput.format != outputJSON {
+		text()
+		return nil
+	}
+	return json.NewEncoder(os.Stdout).Encode(result)
+}
+
+// batchResult is the JSON result of kill, rm and prune: the sandboxes
+// acted on, and the error for each one that failed.
+type batchResult struct {
+	IDs    []string          `json:"ids"`
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+func newBatchResult() *batchResult {
+	return &batchResult{IDs: []string{}}
+}
+
+func (r *batchResult) add(id string, err error) {
+	if err == nil {
+		r.IDs = append(r.IDs, id)
+		return
+	}
+	if r.Failed == nil {
+		r.Failed = make(map[string]string)
+	}
+	r.Failed[id] = err.Error()
+}
+
+// printFailures reports each failed sandbox on stderr, in ID order.
+func (r *batchResult) printFailures(verb string) {
+	ids := make([]string, 0, len(r.Failed))
+	for id := range r.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(os.Stderr, "Failed to %s %s: %s\n", verb, id, r.Failed[id])
+	}
+}
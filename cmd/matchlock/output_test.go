@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestValidateOutputFormat(t *testing.T) {
+	t.Cleanup(func() { cliOutput.format = outputText })
+	for _, format := range []string{outputText, outputJSON} {
+		cliOutput.format = format
+		assert.NoError(t, validateOutputFormat())
+	}
+	cliOutput.format = "yaml"
+	assert.ErrorIs(t, validateOutputFormat(), ErrInvalidOutputFormat)
+}
+
+func TestBatchResultJSON(t *testing.T) {
+	result := newBatchResult()
+	data, err := json.Marshal(result)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ids":[]}`, string(data))
+
+	result.add("vm-a", nil)
+	result.add("vm-b", errors.New("permission denied"))
+	data, err = json.Marshal(result)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ids":["vm-a"],"failed":{"vm-b":"permission denied"}}`, string(data))
+}
+
+func TestFormatPullProgress(t *testing.T) {
+	assert.Equal(t, "Resolving alpine:latest...", formatPullProgress(api.ImageProgress{Image: "alpine:latest", Phase: api.ImageProgressResolve}))
+	assert.Equal(t, "Building rootfs from alpine:latest...", formatPullProgress(api.ImageProgress{Image: "alpine:latest", Phase: api.ImageProgressRootfs}))
+	assert.Equal(t,
+		"Pulling alpine:latest [===============               ] 1/2 layers, 1.0/2.0 MB",
+		formatPullProgress(api.ImageProgress{
+			Image:      "alpine:latest",
+			Phase:      api.ImageProgressDownload,
+			Layers:     2,
+			LayersDone: 1,
+			BytesDone:  1 << 20,
+			BytesTotal: 2 << 20,
+		}))
+}
+
+func TestPullProgressBarNilIsNoop(t *testing.T) {
+	var bar *pullProgressBar
+	assert.Nil(t, bar.report())
+	bar.clear()
+}
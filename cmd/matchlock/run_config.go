@@ -0,0 +1,199 @@
+package main
+
+import (
+	"maps"
+
+	"github.com/spf13/pflag"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// mergeRunConfig layers the flags that were set explicitly on top of a
+// config file. Flags left at their defaults never override file values.
+// Map-valued settings (env, secrets, mounts) are merged key by key.
+func mergeRunConfig(file, fromFlags *api.Config, flags *pflag.FlagSet) *api.Config {
+	merged := *file
+	// A null section in the file (e.g. a bare "network:") decodes to nil;
+	// fall back to the flag values, which carry the CLI defaults.
+	resources := *fromFlags.Resources
+	if file.Resources != nil {
+		resources = *file.Resources
+	}
+	network := *fromFlags.Network
+	if file.Network != nil {
+		network = *file.Network
+	}
+	merged.Resources = &resources
+	merged.Network = &network
+	merged.VFS = &api.VFSConfig{}
+	if file.VFS != nil {
+		*merged.VFS = *file.VFS
+	}
+	merged.ImageCfg = fromFlags.ImageCfg
+
+	set := flags.Changed
+	if set("image") {
+		merged.Image = fromFlags.Image
+	}
+	if set("privileged") {
+		merged.Privileged = fromFlags.Privileged
+	}
+	if set("cap-add") {
+		merged.CapAdd = fromFlags.CapAdd
+	}
+	if set("cap-drop") {
+		merged.CapDrop = fromFlags.CapDrop
+	}
+	if set("allow-syscall") {
+		merged.AllowSyscalls = fromFlags.AllowSyscalls
+	}
+	if set("disable-no-new-privs") {
+		merged.DisableNoNewPrivs = fromFlags.DisableNoNewPrivs
+	}
+	if set("ulimit") {
+		merged.Ulimits = fromFlags.Ulimits
+	}
+	if set("seccomp-audit") {
+		merged.SeccompAudit = fromFlags.SeccompAudit
+	}
+	if set("shared-rootfs") {
+		merged.SharedRootfs = fromFlags.SharedRootfs
+	}
+	if set("skip-rootfs-check") {
+		merged.SkipRootfsCheck = fromFlags.SkipRootfsCheck
+	}
+	if set("keep-on-exit") {
+		merged.KeepStateOnClose = fromFlags.KeepStateOnClose
+	}
+	if set("stop-grace-period") {
+		merged.StopGracePeriodSeconds = fromFlags.StopGracePeriodSeconds
+	}
+	if set("kernel") {
+		merged.KernelPath = fromFlags.KernelPath
+	}
+	if set("kernel-module") {
+		merged.KernelModules = fromFlags.KernelModules
+	}
+	if set("init-command") {
+		merged.InitCommands = fromFlags.InitCommands
+	}
+	if set("require-signature") {
+		merged.RequireSignature = fromFlags.RequireSignature
+	}
+	if set("trusted-key") {
+		merged.TrustedKeys = fromFlags.TrustedKeys
+	}
+
+	if set("cpus") {
+		resources.CPUs = fromFlags.Resources.CPUs
+	}
+	if set("memory") {
+		resources.MemoryMB = fromFlags.Resources.MemoryMB
+	}
+	if set("swap") {
+		resources.SwapMB = fromFlags.Resources.SwapMB
+	}
+	if set("cpuset") {
+		resources.CPUAffinity = fromFlags.Resources.CPUAffinity
+	}
+	if set("cgroup-parent") {
+		resources.CgroupParent = fromFlags.Resources.CgroupParent
+	}
+	if set("disk-size") {
+		resources.DiskSizeMB = fromFlags.Resources.DiskSizeMB
+	}
+	if set("timeout") {
+		resources.TimeoutSeconds = fromFlags.Resources.TimeoutSeconds
+	}
+
+	if set("allow-host") {
+		network.AllowedHosts = fromFlags.Network.AllowedHosts
+	}
+	if set("allow-private-host") {
+		network.AllowedPrivateHosts = fromFlags.Network.AllowedPrivateHosts
+	}
+	if set("allow-udp-host") {
+		network.AllowedUDPHosts = fromFlags.Network.AllowedUDPHosts
+	}
+	if set("add-host") {
+		network.AddHosts = fromFlags.Network.AddHosts
+	}
+	if set("dns-servers") {
+		network.DNSServers = fromFlags.Network.DNSServers
+	}
+	if set("upstream-dns") {
+		network.UpstreamDNS = fromFlags.Network.UpstreamDNS
+	}
+	if set("upstream-proxy") {
+		network.UpstreamProxy = fromFlags.Network.UpstreamProxy
+	}
+	if set("dns-search") {
+		network.SearchDomains = fromFlags.Network.SearchDomains
+	}
+	if set("dns-option") {
+		network.ResolvOptions = fromFlags.Network.ResolvOptions
+	}
+	if set("mirror") {
+		network.MirrorRoutes = fromFlags.Network.MirrorRoutes
+	}
+	if set("hostname") {
+		network.Hostname = fromFlags.Network.Hostname
+	}
+	if set("ip") {
+		network.StaticIP = fromFlags.Network.StaticIP
+	}
+	if set("mac-address") {
+		network.StaticMAC = fromFlags.Network.StaticMAC
+	}
+	if set("mtu") || set("auto-mtu") {
+		network.MTU = fromFlags.Network.MTU
+		network.AutoMTU = fromFlags.Network.AutoMTU
+	}
+	if set("clamp-mss") {
+		network.ClampMSS = fromFlags.Network.ClampMSS
+	}
+	if set("shared-bridge") {
+		network.SharedBridge = fromFlags.Network.SharedBridge
+	}
+	if set("metadata-service") {
+		network.MetadataService = fromFlags.Network.MetadataService
+	}
+	if set("wait-for-network") || set("network-probe") {
+		network.WaitForNetwork = fromFlags.Network.WaitForNetwork
+	}
+	if set("network-probe") {
+		network.NetworkProbe = fromFlags.Network.NetworkProbe
+	}
+	if set("max-connections") {
+		network.MaxConcurrentConnections = fromFlags.Network.MaxConcurrentConnections
+	}
+	if set("max-connections-per-host") {
+		network.MaxConnectionsPerHost = fromFlags.Network.MaxConnectionsPerHost
+	}
+	if set("secret") {
+		network.Secrets = mergeMaps(network.Secrets, fromFlags.Network.Secrets)
+	}
+
+	if set("workspace") {
+		merged.VFS.Workspace = fromFlags.VFS.Workspace
+	}
+	if set("volume") {
+		merged.VFS.Mounts = mergeMaps(merged.VFS.Mounts, fromFlags.VFS.Mounts)
+	}
+	if set("env") || set("env-file") {
+		merged.Env = mergeMaps(merged.Env, fromFlags.Env)
+	}
+	if set("label") {
+		merged.Labels = mergeMaps(merged.Labels, fromFlags.Labels)
+	}
+	return &merged
+}
+
+func mergeMaps[M ~map[K]V, K comparable, V any](base, overrides M) M {
+	out := maps.Clone(base)
+	if out == nil {
+		out = make(M, len(overrides))
+	}
+	maps.Copy(out, overrides)
+	return out
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestMergeRunConfigOnlyExplicitFlagsOverrideFile(t *testing.T) {
+	file, err := api.ParseConfigFile([]byte(`
+version: 1
+image: python:3.12-alpine
+resources: {memory_mb: 2048, swap_mb: 1024}
+network:
+  allowed_hosts: [api.openai.com]
+env: {MODE: file, KEEP: "1"}
+`), api.ConfigFileOptions{})
+	require.NoError(t, err)
+
+	flags := runCmd.Flags()
+	t.Cleanup(func() {
+		for _, name := range []string{"memory", "env"} {
+			flags.Lookup(name).Changed = false
+		}
+	})
+	require.NoError(t, flags.Set("memory", "4096"))
+	require.NoError(t, flags.Set("env", "MODE=flag"))
+
+	fromFlags := &api.Config{
+		Image:     "alpine:latest", // --image not set: file wins
+		Resources: &api.Resources{CPUs: 1, MemoryMB: 4096},
+		Network:   &api.NetworkConfig{BlockPrivateIPs: true},
+		VFS:       &api.VFSConfig{Workspace: api.DefaultWorkspace},
+		Env:       map[string]string{"MODE": "flag"},
+	}
+
+	merged := mergeRunConfig(file, fromFlags, flags)
+	assert.Equal(t, "python:3.12-alpine", merged.Image)
+	assert.Equal(t, 4096, merged.Resources.MemoryMB)
+	assert.Equal(t, 1024, merged.Resources.SwapMB)
+	assert.Equal(t, []string{"api.openai.com"}, merged.Network.AllowedHosts)
+	assert.True(t, merged.Network.BlockPrivateIPs)
+	assert.Equal(t, map[string]string{"MODE": "flag", "KEEP": "1"}, merged.Env)
+	assert.Equal(t, 2048, file.Resources.MemoryMB, "file config must not be modified")
+}
+
+func TestMergeRunConfigNullSections(t *testing.T) {
+	file, err := api.ParseConfigFile([]byte(`
+version: 1
+image: alpine:latest
+resources:
+network:
+`), api.ConfigFileOptions{})
+	require.NoError(t, err)
+
+	fromFlags := &api.Config{
+		Resources: &api.Resources{CPUs: 1, MemoryMB: 512},
+		Network:   &api.NetworkConfig{BlockPrivateIPs: true},
+		VFS:       &api.VFSConfig{Workspace: api.DefaultWorkspace},
+	}
+
+	merged := mergeRunConfig(file, fromFlags, runCmd.Flags())
+	require.NotNil(t, merged.Resources)
+	require.NotNil(t, merged.Network)
+	assert.Equal(t, 512, merged.Resources.MemoryMB)
+	assert.True(t, merged.Network.BlockPrivateIPs)
+}
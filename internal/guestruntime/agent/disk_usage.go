@@ -0,0 +1,52 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"syscall"
+)
+
+type diskUsageRequest struct {
+	Paths []string `json:"paths"`
+}
+
+type diskUsage struct {
+	Path       string `json:"path"`
+	TotalBytes uint64 `json:"total_bytes"`
+	UsedBytes  uint64 `json:"used_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	Error      string `json:"error,omitempty"`
+}
+
+// handleDiskUsage replies with df-style figures for each requested path.
+// Free is the space available to unprivileged users, as df reports it.
+func handleDiskUsage(fd int, data []byte) {
+	var req diskUsageRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		sendMessage(fd, MsgTypeStderr, []byte(fmt.Sprintf("invalid disk usage request: %v", err)))
+		return
+	}
+
+	usage := make([]diskUsage, 0, len(req.Paths))
+	for _, path := range req.Paths {
+		usage = append(usage, statDiskUsage(path))
+	}
+	out, _ := json.Marshal(usage)
+	sendMessage(fd, MsgTypeDiskUsage, out)
+}
+
+func statDiskUsage(path string) diskUsage {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return diskUsage{Path: path, Error: err.Error()}
+	}
+	bsize := uint64(st.Bsize)
+	return diskUsage{
+		Path:       path,
+		TotalBytes: st.Blocks * bsize,
+		UsedBytes:  (st.Blocks - st.Bfree) * bsize,
+		FreeBytes:  st.Bavail * bsize,
+	}
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatDiskUsage(t *testing.T) {
+	usage := statDiskUsage(t.TempDir())
+	assert.Empty(t, usage.Error)
+	assert.NotZero(t, usage.TotalBytes)
+	assert.LessOrEqual(t, usage.UsedBytes, usage.TotalBytes)
+	assert.LessOrEqual(t, usage.FreeBytes, usage.TotalBytes)
+
+	missing := statDiskUsage("/nonexistent/matchlock-disk")
+	assert.NotEmpty(t, missing.Error)
+	assert.Zero(t, missing.TotalBytes)
+}
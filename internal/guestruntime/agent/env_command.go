@@ -0,0 +1,28 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// runEnvCommand implements "guest-agent env", printing environ as a JSON
+// object. The host runs it like any command, so the output is exactly the
+// environment guest commands receive (see sandbox.Sandbox.GuestEnv); JSON
+// keeps values with newlines intact where env(1) output would not.
+func runEnvCommand(environ []string, stdout, stderr io.Writer) int {
+	env := make(map[string]string, len(environ))
+	for _, entry := range environ {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			env[key] = value
+		}
+	}
+	if err := json.NewEncoder(stdout).Encode(env); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,23 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunEnvCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runEnvCommand([]string{"PATH=/usr/bin", "MULTI=a\nb", "EQ=x=y", "EMPTY=", "garbage"}, &stdout, &stderr)
+	require.Equal(t, 0, code)
+	assert.Empty(t, stderr.String())
+
+	var env map[string]string
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &env))
+	assert.Equal(t, map[string]string{"PATH": "/usr/bin", "MULTI": "a\nb", "EQ": "x=y", "EMPTY": ""}, env)
+}
@@ -12,9 +12,18 @@ var (
 	ErrConnect = errors.New("connect")
 	ErrEOF     = errors.New("EOF")
 
+	// Policy query errors
+	ErrPolicyQuery = errors.New("policy query")
+
 	// User resolution errors
 	ErrResolveUID    = errors.New("resolve uid")
 	ErrResolveGID    = errors.New("resolve gid")
 	ErrUserNotFound  = errors.New("user not found")
 	ErrGroupNotFound = errors.New("group not found")
+
+	// Resource limit errors
+	ErrSetrlimit = errors.New("setrlimit")
+
+	// Stats errors
+	ErrParseStats = errors.New("parse stats")
 )
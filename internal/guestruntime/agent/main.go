@@ -15,27 +15,42 @@ import (
 	"net"
 	"os"
 	"os/exec"
-	"os/signal"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
 
 	"github.com/creack/pty"
 	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
 )
 
+// vsockPorts is the host's port assignment for guest services, read once
+// from matchlock.vsock_ports= on the kernel cmdline (defaults otherwise).
+var vsockPorts = sync.OnceValue(func() vsock.Ports {
+	data, _ := os.ReadFile("/proc/cmdline")
+	return vsock.ParsePorts(string(data))
+})
+
 const (
 	cancelGracePeriod = 5 * time.Second
+	ttyDrainTimeout   = 500 * time.Millisecond
+
+	// execTimeoutError is the ExecResponse.Error of a command killed when
+	// its TimeoutMS elapsed. It exits with execTimeoutExitCode, as with GNU
+	// timeout.
+	execTimeoutError    = "timeout"
+	execTimeoutExitCode = 124
+
+	// logPrefix tags agent diagnostics on the console so the host can
+	// attribute them (see api.ParseLogLine).
+	logPrefix = "[agent] "
 
 	AF_VSOCK        = 40
 	VMADDR_CID_HOST = 2
 
-	VsockPortExec  = 5000
-	VsockPortVFS   = 5001
-	VsockPortReady = 5002
-
 	MsgTypeExec        uint8 = 1
 	MsgTypeExecResult  uint8 = 2
 	MsgTypeStdout      uint8 = 3
@@ -49,6 +64,9 @@ const (
 	MsgTypeExecStream  uint8 = 11
 	MsgTypeExecPipe    uint8 = 12
 	MsgTypePortForward uint8 = 13
+	MsgTypeDiskUsage   uint8 = 14
+	MsgTypeTail        uint8 = 15
+	MsgTypeStats       uint8 = 16
 )
 
 type sockaddrVM struct {
@@ -62,27 +80,36 @@ type sockaddrVM struct {
 type ExecRequest struct {
 	Command    string            `json:"command"`
 	Args       []string          `json:"args"`
+	Shell      []string          `json:"shell,omitempty"`
 	WorkingDir string            `json:"working_dir"`
 	Env        map[string]string `json:"env"`
 	Stdin      []byte            `json:"stdin"`
 	User       string            `json:"user,omitempty"`
+	LoginShell bool              `json:"login_shell,omitempty"`
+	TimeoutMS  int               `json:"timeout_ms,omitempty"`
+	Setup      bool              `json:"setup,omitempty"`
 }
 
 type ExecTTYRequest struct {
 	Command    string            `json:"command"`
 	Args       []string          `json:"args"`
+	Shell      []string          `json:"shell,omitempty"`
 	WorkingDir string            `json:"working_dir"`
 	Env        map[string]string `json:"env"`
 	Rows       uint16            `json:"rows"`
 	Cols       uint16            `json:"cols"`
 	User       string            `json:"user,omitempty"`
+	LoginShell bool              `json:"login_shell,omitempty"`
 }
 
 type ExecResponse struct {
-	ExitCode int    `json:"exit_code"`
-	Stdout   []byte `json:"stdout"`
-	Stderr   []byte `json:"stderr"`
-	Error    string `json:"error"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     []byte `json:"stdout"`
+	Stderr     []byte `json:"stderr"`
+	Error      string `json:"error"`
+	UserTimeMS int64  `json:"user_time_ms,omitempty"`
+	SysTimeMS  int64  `json:"sys_time_ms,omitempty"`
+	MaxRSSKB   int64  `json:"max_rss_kb,omitempty"`
 }
 
 type PortForwardRequest struct {
@@ -91,17 +118,36 @@ type PortForwardRequest struct {
 }
 
 func Run() {
+	// Policy queries are run by code inside the sandbox, not by init
+	if len(os.Args) > 1 && os.Args[1] == "policy" {
+		os.Exit(runPolicyCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	// The host runs "env" as a command to see the environment commands get
+	if len(os.Args) > 1 && os.Args[1] == "env" {
+		os.Exit(runEnvCommand(os.Environ(), os.Stdout, os.Stderr))
+	}
+
 	// If re-execed as sandbox launcher, apply seccomp + drop caps + exec real command
 	if isSandboxLauncher() {
 		runSandboxLauncher()
 		return
 	}
 
-	fmt.Println("Guest agent starting...")
+	fmt.Println(logPrefix + "Guest agent starting...")
 
 	// Mount /proc inside new PID namespace (children need it)
 	ensureProcMounted()
 
+	// Commands that name no user run as the image USER, which guest-init
+	// has already resolved.
+	defaultUser = readDefaultUser()
+
+	// Stream seccomp audit records to the host when enabled
+	startSyscallAudit()
+
+	// Proxy unix socket mounts to the host
+	startSocketMounts()
+
 	// Start ready listener first
 	go serveReady()
 
@@ -117,14 +163,15 @@ func ensureProcMounted() {
 }
 
 func serveReady() {
-	listener, err := listenVsock(VsockPortReady)
+	port := vsockPorts().Port(vsock.ServiceReady)
+	listener, err := listenVsock(port)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to listen on ready port: %v\n", err)
+		fmt.Fprintf(os.Stderr, logPrefix+"Failed to listen on ready port: %v\n", err)
 		return
 	}
 	defer syscall.Close(listener)
 
-	fmt.Println("Ready signal listener started on port", VsockPortReady)
+	fmt.Println(logPrefix+"Ready signal listener started on port", port)
 
 	for {
 		conn, err := acceptVsock(listener)
@@ -137,19 +184,20 @@ func serveReady() {
 }
 
 func serveExec() {
-	listener, err := listenVsock(VsockPortExec)
+	port := vsockPorts().Port(vsock.ServiceExec)
+	listener, err := listenVsock(port)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to listen on exec port: %v\n", err)
+		fmt.Fprintf(os.Stderr, logPrefix+"Failed to listen on exec port: %v\n", err)
 		os.Exit(1)
 	}
 	defer syscall.Close(listener)
 
-	fmt.Println("Exec service started on port", VsockPortExec)
+	fmt.Println(logPrefix+"Exec service started on port", port)
 
 	for {
 		conn, err := acceptVsock(listener)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Accept error: %v\n", err)
+			fmt.Fprintf(os.Stderr, logPrefix+"Accept error: %v\n", err)
 			continue
 		}
 		go handleExec(conn)
@@ -172,24 +220,57 @@ func monitorVsockCancel(fd int, cmd *exec.Cmd) chan struct{} {
 			return
 		default:
 		}
-		pid := cmd.Process.Pid
-		syscall.Kill(-pid, syscall.SIGTERM)
-		timer := time.AfterFunc(cancelGracePeriod, func() {
-			select {
-			case <-waitDone:
-				return
-			default:
-			}
-			syscall.Kill(-pid, syscall.SIGKILL)
-		})
-		go func() {
-			<-waitDone
-			timer.Stop()
-		}()
+		terminateProcessGroup(cmd.Process.Pid, waitDone)
 	}()
 	return waitDone
 }
 
+// terminateProcessGroup sends SIGTERM to the process group pid leads and
+// SIGKILL after cancelGracePeriod unless waitDone closes first.
+func terminateProcessGroup(pid int, waitDone chan struct{}) {
+	syscall.Kill(-pid, syscall.SIGTERM)
+	timer := time.AfterFunc(cancelGracePeriod, func() {
+		select {
+		case <-waitDone:
+			return
+		default:
+		}
+		syscall.Kill(-pid, syscall.SIGKILL)
+	})
+	go func() {
+		<-waitDone
+		timer.Stop()
+	}()
+}
+
+// armExecTimeout terminates cmd's process group once timeoutMS elapses.
+// The returned func stops the timer and reports whether it fired; call it
+// once cmd.Wait returns.
+func armExecTimeout(cmd *exec.Cmd, timeoutMS int, waitDone chan struct{}) func() bool {
+	if timeoutMS <= 0 {
+		return func() bool { return false }
+	}
+	var fired atomic.Bool
+	pid := cmd.Process.Pid
+	timer := time.AfterFunc(time.Duration(timeoutMS)*time.Millisecond, func() {
+		fired.Store(true)
+		terminateProcessGroup(pid, waitDone)
+	})
+	return func() bool {
+		timer.Stop()
+		return fired.Load()
+	}
+}
+
+// applyExecTimeout marks resp as timed out when the command was killed by
+// its timeout rather than exiting on its own.
+func applyExecTimeout(resp *ExecResponse, timedOut bool) {
+	if timedOut {
+		resp.ExitCode = execTimeoutExitCode
+		resp.Error = execTimeoutError
+	}
+}
+
 func handleExec(fd int) {
 	// Read message header (type + length)
 	header := make([]byte, 5)
@@ -208,6 +289,12 @@ func handleExec(fd int) {
 		return
 	}
 
+	switch msgType {
+	case MsgTypeExec, MsgTypeExecStream, MsgTypeExecPipe, MsgTypeExecTTY:
+		activeExecs.Add(1)
+		defer activeExecs.Add(-1)
+	}
+
 	switch msgType {
 	case MsgTypeExec:
 		handleExecBatch(fd, data)
@@ -221,6 +308,15 @@ func handleExec(fd int) {
 		handlePortForward(fd, data)
 	case MsgTypeExecTTY:
 		handleExecTTY(fd, data)
+	case MsgTypeDiskUsage:
+		handleDiskUsage(fd, data)
+		syscall.Close(fd)
+	case MsgTypeTail:
+		handleTail(fd, data)
+		syscall.Close(fd)
+	case MsgTypeStats:
+		handleStats(fd)
+		syscall.Close(fd)
 	default:
 		syscall.Close(fd)
 	}
@@ -305,6 +401,31 @@ func copyConnToFD(src net.Conn, fd int) {
 	}
 }
 
+// shellCommand runs command with "sh -c", or with "sh -lc" for a login
+// shell that sources /etc/profile and ~/.profile first.
+func shellCommand(command string, login bool) *exec.Cmd {
+	if login {
+		return exec.Command("sh", "-lc", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// execCommand builds the process for an exec request: args run directly as
+// argv when set, for images without a shell; otherwise command runs under
+// shell, or under shellCommand's "sh -c" when shell is empty. Cmd.Path is
+// left unresolved because the sandbox launcher looks the binary up against
+// the command's own PATH.
+func execCommand(command string, args, shell []string, login bool) *exec.Cmd {
+	switch {
+	case len(args) > 0:
+		return &exec.Cmd{Path: args[0], Args: args}
+	case len(shell) > 0:
+		argv := append(append([]string(nil), shell...), command)
+		return &exec.Cmd{Path: argv[0], Args: argv}
+	}
+	return shellCommand(command, login)
+}
+
 func handleExecBatch(fd int, data []byte) {
 	var req ExecRequest
 	if err := json.Unmarshal(data, &req); err != nil {
@@ -314,8 +435,13 @@ func handleExecBatch(fd int, data []byte) {
 
 	wipeBytes(data)
 
+	if req.Setup && !admitSetupExec() {
+		sendExecResponse(fd, &ExecResponse{ExitCode: 1, Error: errSetupExecClosed})
+		return
+	}
+
 	var stdout, stderr bytes.Buffer
-	cmd := exec.Command("sh", "-c", req.Command)
+	cmd := execCommand(req.Command, req.Args, req.Shell, req.LoginShell)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
@@ -333,7 +459,8 @@ func handleExecBatch(fd int, data []byte) {
 
 	applyUserEnv(cmd, req.User)
 	applySandboxSysProcAttrBatch(cmd)
-	wrapCommandForSandbox(cmd)
+	releaseAudit := wrapCommandForSandbox(cmd, req.Setup)
+	defer releaseAudit()
 	wipeMap(req.Env)
 
 	if err := cmd.Start(); err != nil {
@@ -342,6 +469,7 @@ func handleExecBatch(fd int, data []byte) {
 	}
 
 	waitDone := monitorVsockCancel(fd, cmd)
+	timedOut := armExecTimeout(cmd, req.TimeoutMS, waitDone)
 
 	err := cmd.Wait()
 	close(waitDone)
@@ -350,6 +478,7 @@ func handleExecBatch(fd int, data []byte) {
 		Stdout: stdout.Bytes(),
 		Stderr: stderr.Bytes(),
 	}
+	applyRusage(resp, cmd.ProcessState)
 
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -359,6 +488,7 @@ func handleExecBatch(fd int, data []byte) {
 			resp.ExitCode = 1
 		}
 	}
+	applyExecTimeout(resp, timedOut())
 
 	sendExecResponse(fd, resp)
 }
@@ -374,7 +504,12 @@ func handleExecStreamBatch(fd int, data []byte) {
 
 	wipeBytes(data)
 
-	cmd := exec.Command("sh", "-c", req.Command)
+	if req.Setup && !admitSetupExec() {
+		sendExecResponse(fd, &ExecResponse{ExitCode: 1, Error: errSetupExecClosed})
+		return
+	}
+
+	cmd := execCommand(req.Command, req.Args, req.Shell, req.LoginShell)
 
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
@@ -402,7 +537,8 @@ func handleExecStreamBatch(fd int, data []byte) {
 	applyUserEnv(cmd, req.User)
 
 	applySandboxSysProcAttrBatch(cmd)
-	wrapCommandForSandbox(cmd)
+	releaseAudit := wrapCommandForSandbox(cmd, req.Setup)
+	defer releaseAudit()
 	wipeMap(req.Env)
 
 	if err := cmd.Start(); err != nil {
@@ -411,6 +547,7 @@ func handleExecStreamBatch(fd int, data []byte) {
 	}
 
 	waitDone := monitorVsockCancel(fd, cmd)
+	timedOut := armExecTimeout(cmd, req.TimeoutMS, waitDone)
 
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -448,6 +585,7 @@ func handleExecStreamBatch(fd int, data []byte) {
 	close(waitDone)
 
 	resp := &ExecResponse{}
+	applyRusage(resp, cmd.ProcessState)
 	if cmdErr != nil {
 		if exitErr, ok := cmdErr.(*exec.ExitError); ok {
 			resp.ExitCode = exitErr.ExitCode()
@@ -456,6 +594,7 @@ func handleExecStreamBatch(fd int, data []byte) {
 			resp.ExitCode = 1
 		}
 	}
+	applyExecTimeout(resp, timedOut())
 
 	sendExecResponse(fd, resp)
 }
@@ -474,7 +613,7 @@ func handleExecPipe(fd int, data []byte) {
 
 	wipeBytes(data)
 
-	cmd := exec.Command("sh", "-c", req.Command)
+	cmd := execCommand(req.Command, req.Args, req.Shell, req.LoginShell)
 
 	stdinPipe, err := cmd.StdinPipe()
 	if err != nil {
@@ -512,7 +651,8 @@ func handleExecPipe(fd int, data []byte) {
 
 	applyUserEnv(cmd, req.User)
 	applySandboxSysProcAttrBatch(cmd)
-	wrapCommandForSandbox(cmd)
+	releaseAudit := wrapCommandForSandbox(cmd, false)
+	defer releaseAudit()
 	wipeMap(req.Env)
 
 	if err := cmd.Start(); err != nil {
@@ -526,52 +666,36 @@ func handleExecPipe(fd int, data []byte) {
 	// signals to cmd.Process after this because the PID may be recycled.
 	waitDone := make(chan struct{})
 
-	// Read MsgTypeStdin from host and write to cmd stdin.
-	// On EOF or error from the vsock (host closed connection due to context
-	// cancellation), close the stdin pipe and SIGTERM→SIGKILL the child process.
 	// This replaces monitorVsockCancel for pipe mode since the stdin goroutine
 	// already owns the read side of the vsock fd.
-	go func() {
-		for {
-			msgType, msgData, err := readMessage(fd)
-			if err != nil {
-				stdinPipe.Close()
-				// Host closed connection — gracefully terminate the child
-				select {
-				case <-waitDone:
-					return
-				default:
-				}
-				pid := cmd.Process.Pid
-				syscall.Kill(-pid, syscall.SIGTERM)
-				timer := time.AfterFunc(cancelGracePeriod, func() {
-					select {
-					case <-waitDone:
-						return
-					default:
-					}
-					syscall.Kill(-pid, syscall.SIGKILL)
-				})
-				go func() {
-					<-waitDone
-					timer.Stop()
-				}()
+	go forwardPipeInput(fd, stdinPipe, func(sig syscall.Signal) {
+		select {
+		case <-waitDone:
+		default:
+			syscall.Kill(-cmd.Process.Pid, sig)
+		}
+	}, func() {
+		// Host closed connection — gracefully terminate the child
+		select {
+		case <-waitDone:
+			return
+		default:
+		}
+		pid := cmd.Process.Pid
+		syscall.Kill(-pid, syscall.SIGTERM)
+		timer := time.AfterFunc(cancelGracePeriod, func() {
+			select {
+			case <-waitDone:
 				return
+			default:
 			}
-			switch msgType {
-			case MsgTypeStdin:
-				if len(msgData) == 0 {
-					stdinPipe.Close()
-					return
-				}
-				stdinPipe.Write(msgData)
-			case MsgTypeSignal:
-				if len(msgData) >= 1 && cmd.Process != nil {
-					syscall.Kill(-cmd.Process.Pid, syscall.Signal(msgData[0]))
-				}
-			}
-		}
-	}()
+			syscall.Kill(-pid, syscall.SIGKILL)
+		})
+		go func() {
+			<-waitDone
+			timer.Stop()
+		}()
+	})
 
 	var wg sync.WaitGroup
 	wg.Add(2)
@@ -630,7 +754,7 @@ func handleExecTTY(fd int, data []byte) {
 	// Wipe the raw request data from memory
 	wipeBytes(data)
 
-	cmd := exec.Command("sh", "-c", req.Command)
+	cmd := execCommand(req.Command, req.Args, req.Shell, req.LoginShell)
 
 	if req.WorkingDir != "" {
 		cmd.Dir = req.WorkingDir
@@ -648,7 +772,8 @@ func handleExecTTY(fd int, data []byte) {
 
 	// Apply sandbox isolation: PID namespace + seccomp + cap drop via re-exec
 	applySandboxSysProcAttr(cmd)
-	wrapCommandForSandbox(cmd)
+	releaseAudit := wrapCommandForSandbox(cmd, false)
+	defer releaseAudit()
 
 	// Wipe the request's env map from memory before running
 	wipeMap(req.Env)
@@ -667,20 +792,18 @@ func handleExecTTY(fd int, data []byte) {
 		pty.Setsize(ptmx, &pty.Winsize{Rows: req.Rows, Cols: req.Cols})
 	}
 
-	// Handle SIGCHLD to know when process exits
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGCHLD)
-	defer signal.Stop(sigCh)
-
+	conn := newTTYConn(fd)
 	done := make(chan struct{})
+	outputDone := make(chan struct{})
 
 	// Copy PTY output to vsock (stdout)
 	go func() {
+		defer close(outputDone)
 		buf := make([]byte, 4096)
 		for {
 			n, err := ptmx.Read(buf)
 			if n > 0 {
-				sendMessage(fd, MsgTypeStdout, buf[:n])
+				conn.send(MsgTypeStdout, buf[:n])
 			}
 			if err != nil {
 				break
@@ -689,30 +812,23 @@ func handleExecTTY(fd int, data []byte) {
 	}()
 
 	// Read messages from vsock (stdin, resize, signal)
-	go func() {
-		for {
-			msgType, msgData, err := readMessage(fd)
-			if err != nil {
-				break
+	conn.readLoop(func(msgType uint8, msgData []byte) {
+		switch msgType {
+		case MsgTypeStdin:
+			ptmx.Write(msgData)
+		case MsgTypeResize:
+			if len(msgData) >= 4 {
+				rows := binary.BigEndian.Uint16(msgData[0:2])
+				cols := binary.BigEndian.Uint16(msgData[2:4])
+				pty.Setsize(ptmx, &pty.Winsize{Rows: rows, Cols: cols})
 			}
-
-			switch msgType {
-			case MsgTypeStdin:
-				ptmx.Write(msgData)
-			case MsgTypeResize:
-				if len(msgData) >= 4 {
-					rows := binary.BigEndian.Uint16(msgData[0:2])
-					cols := binary.BigEndian.Uint16(msgData[2:4])
-					pty.Setsize(ptmx, &pty.Winsize{Rows: rows, Cols: cols})
-				}
-			case MsgTypeSignal:
-				if len(msgData) >= 1 {
-					sig := syscall.Signal(msgData[0])
-					cmd.Process.Signal(sig)
-				}
+		case MsgTypeSignal:
+			if len(msgData) >= 1 {
+				sig := syscall.Signal(msgData[0])
+				cmd.Process.Signal(sig)
 			}
 		}
-	}()
+	})
 
 	// Wait for process to exit
 	go func() {
@@ -722,18 +838,30 @@ func handleExecTTY(fd int, data []byte) {
 
 	<-done
 
+	// Drain trailing PTY output so it is not lost behind the exit code. A
+	// backgrounded process holding the PTY open must not hold the session.
+	select {
+	case <-outputDone:
+	case <-time.After(ttyDrainTimeout):
+	}
+
 	exitCode := 0
 	if cmd.ProcessState != nil {
 		exitCode = cmd.ProcessState.ExitCode()
 	}
-	sendExitCode(fd, exitCode)
+	conn.sendExit(exitCode)
 
 	// Small delay to ensure exit code is transmitted before closing
 	time.Sleep(100 * time.Millisecond)
-	syscall.Close(fd)
+	conn.close()
 }
 
+// applyUserEnv makes the sandbox launcher run cmd as user, or as the image
+// default user when the request names none.
 func applyUserEnv(cmd *exec.Cmd, user string) {
+	if user == "" {
+		user = defaultUser
+	}
 	if user == "" {
 		return
 	}
@@ -743,13 +871,56 @@ func applyUserEnv(cmd *exec.Cmd, user string) {
 	cmd.Env = append(cmd.Env, "MATCHLOCK_USER="+user)
 }
 
+// forwardPipeInput reads MsgTypeStdin and MsgTypeSignal frames from the host
+// for a pipe-mode exec. An empty MsgTypeStdin frame is the stdin half-close:
+// stdin is closed so the process sees EOF, but the connection keeps being
+// read so that a later hang-up still reaches hangup and signals still reach
+// the process. On EOF or error from the vsock (host closed the connection on
+// cancellation), stdin is closed and hangup is called.
+func forwardPipeInput(fd int, stdin io.WriteCloser, signal func(syscall.Signal), hangup func()) {
+	stdinOpen := true
+	for {
+		msgType, msgData, err := readMessage(fd)
+		if err != nil {
+			stdin.Close()
+			hangup()
+			return
+		}
+		switch msgType {
+		case MsgTypeStdin:
+			if !stdinOpen {
+				continue
+			}
+			if len(msgData) == 0 {
+				stdin.Close()
+				stdinOpen = false
+				continue
+			}
+			stdin.Write(msgData)
+		case MsgTypeSignal:
+			if len(msgData) >= 1 {
+				signal(syscall.Signal(msgData[0]))
+			}
+		}
+	}
+}
+
+// sendMessage writes one framed message with a single write so the PTY output
+// pump and the exit code sender never interleave frames on a connection.
 func sendMessage(fd int, msgType uint8, data []byte) {
-	header := make([]byte, 5)
-	header[0] = msgType
-	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
-	syscall.Write(fd, header)
-	if len(data) > 0 {
-		syscall.Write(fd, data)
+	frame := make([]byte, 5+len(data))
+	frame[0] = msgType
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	for len(frame) > 0 {
+		n, err := syscall.Write(fd, frame)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+		frame = frame[n:]
 	}
 }
 
@@ -892,7 +1063,7 @@ type VFSClient struct {
 }
 
 func NewVFSClient() (*VFSClient, error) {
-	fd, err := dialVsock(VMADDR_CID_HOST, VsockPortVFS)
+	fd, err := dialVsock(VMADDR_CID_HOST, vsockPorts().Port(vsock.ServiceVFS))
 	if err != nil {
 		return nil, err
 	}
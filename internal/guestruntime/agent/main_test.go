@@ -0,0 +1,100 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"bytes"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellCommandLoginShell(t *testing.T) {
+	assert.Equal(t, []string{"sh", "-c", "echo $PATH"}, shellCommand("echo $PATH", false).Args)
+	assert.Equal(t, []string{"sh", "-lc", "echo $PATH"}, shellCommand("echo $PATH", true).Args)
+}
+
+func TestExecCommandShellAndArgs(t *testing.T) {
+	assert.Equal(t, []string{"sh", "-c", "ls"}, execCommand("ls", nil, nil, false).Args)
+	assert.Equal(t, []string{"bash", "-c", "ls"}, execCommand("ls", nil, []string{"bash", "-c"}, false).Args)
+
+	cmd := execCommand("ignored", []string{"/app/server", "--port", "8080"}, nil, false)
+	assert.Equal(t, "/app/server", cmd.Path)
+	assert.Equal(t, []string{"/app/server", "--port", "8080"}, cmd.Args)
+}
+
+func TestArmExecTimeoutKillsProcessGroup(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 30 & wait")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	require.NoError(t, cmd.Start())
+
+	waitDone := make(chan struct{})
+	timedOut := armExecTimeout(cmd, 50, waitDone)
+	start := time.Now()
+	err := cmd.Wait()
+	close(waitDone)
+
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), cancelGracePeriod)
+	require.True(t, timedOut())
+
+	resp := &ExecResponse{ExitCode: -1}
+	applyExecTimeout(resp, timedOut())
+	assert.Equal(t, execTimeoutExitCode, resp.ExitCode)
+	assert.Equal(t, execTimeoutError, resp.Error)
+}
+
+func TestArmExecTimeoutNotFired(t *testing.T) {
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Start())
+
+	waitDone := make(chan struct{})
+	timedOut := armExecTimeout(cmd, 10_000, waitDone)
+	require.NoError(t, cmd.Wait())
+	close(waitDone)
+	assert.False(t, timedOut())
+
+	assert.False(t, armExecTimeout(cmd, 0, waitDone)())
+}
+
+type recordingStdin struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (r *recordingStdin) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestForwardPipeInputKeepsReadingAfterStdinHalfClose(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	defer syscall.Close(fds[0])
+
+	go func() {
+		sendMessage(fds[1], MsgTypeStdin, []byte(`{"a":1}`))
+		sendMessage(fds[1], MsgTypeStdin, nil)
+		sendMessage(fds[1], MsgTypeStdin, []byte("late"))
+		sendMessage(fds[1], MsgTypeSignal, []byte{byte(syscall.SIGINT)})
+		syscall.Close(fds[1])
+	}()
+
+	stdin := &recordingStdin{}
+	var signals []syscall.Signal
+	hungUp := false
+	forwardPipeInput(fds[0], stdin, func(sig syscall.Signal) {
+		signals = append(signals, sig)
+	}, func() {
+		hungUp = true
+	})
+
+	assert.Equal(t, `{"a":1}`, stdin.String())
+	assert.True(t, stdin.closed)
+	assert.Equal(t, []syscall.Signal{syscall.SIGINT}, signals, "signal after half-close was dropped")
+	assert.True(t, hungUp, "hang-up after half-close was not detected")
+}
@@ -0,0 +1,81 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+)
+
+// policyQuery and policyAnswer are the wire forms of api.PolicyQuery and
+// api.PolicyAnswer.
+type policyQuery struct {
+	Host string `json:"host,omitempty"`
+}
+
+type policyAnswer struct {
+	Host    string   `json:"host,omitempty"`
+	Allowed bool     `json:"allowed"`
+	Secrets []string `json:"secrets"`
+}
+
+const policyUsage = `usage: guest-agent policy check HOST
+       guest-agent policy secrets`
+
+// runPolicyCommand implements "guest-agent policy", letting code inside the
+// sandbox ask the host about its network policy. "check" exits 0 when HOST
+// is allowed and 1 when it is not; "secrets" prints the configured secret
+// names, one per line.
+func runPolicyCommand(args []string, stdout, stderr io.Writer) int {
+	var query policyQuery
+	switch {
+	case len(args) == 2 && args[0] == "check":
+		query.Host = args[1]
+	case len(args) == 1 && args[0] == "secrets":
+	default:
+		fmt.Fprintln(stderr, policyUsage)
+		return 2
+	}
+
+	answer, err := queryPolicy(query)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if query.Host == "" {
+		for _, name := range answer.Secrets {
+			fmt.Fprintln(stdout, name)
+		}
+		return 0
+	}
+	if answer.Allowed {
+		fmt.Fprintf(stdout, "%s: allowed\n", query.Host)
+		return 0
+	}
+	fmt.Fprintf(stdout, "%s: denied\n", query.Host)
+	return 1
+}
+
+func queryPolicy(query policyQuery) (*policyAnswer, error) {
+	fd, err := dialVsock(VMADDR_CID_HOST, vsockPorts().Port(vsock.ServicePolicy))
+	if err != nil {
+		return nil, err
+	}
+	conn := os.NewFile(uintptr(fd), "policy-query")
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(query); err != nil {
+		return nil, errx.Wrap(ErrPolicyQuery, err)
+	}
+	var answer policyAnswer
+	if err := json.NewDecoder(conn).Decode(&answer); err != nil {
+		return nil, errx.Wrap(ErrPolicyQuery, err)
+	}
+	return &answer, nil
+}
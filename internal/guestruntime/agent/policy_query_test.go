@@ -0,0 +1,19 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPolicyCommandUsage(t *testing.T) {
+	for _, args := range [][]string{nil, {"check"}, {"check", "a", "b"}, {"list"}} {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, runPolicyCommand(args, &stdout, &stderr), args)
+		assert.Contains(t, stderr.String(), "usage:")
+		assert.Empty(t, stdout.String())
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"os"
+	"syscall"
+)
+
+// applyRusage records the CPU time and peak memory of a finished command.
+// wait4 accounts for the shell's reaped descendants too, so the numbers
+// cover the whole command, not just "sh -c". Missing usage leaves zeros.
+func applyRusage(resp *ExecResponse, state *os.ProcessState) {
+	if state == nil {
+		return
+	}
+	ru, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || ru == nil {
+		return
+	}
+	resp.UserTimeMS = ru.Utime.Nano() / 1e6
+	resp.SysTimeMS = ru.Stime.Nano() / 1e6
+	resp.MaxRSSKB = ru.Maxrss // kilobytes on Linux
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyRusage(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done")
+	require.NoError(t, cmd.Run())
+
+	var resp ExecResponse
+	applyRusage(&resp, cmd.ProcessState)
+	assert.Positive(t, resp.MaxRSSKB)
+	assert.GreaterOrEqual(t, resp.UserTimeMS, int64(0))
+	assert.GreaterOrEqual(t, resp.SysTimeMS, int64(0))
+}
+
+func TestApplyRusageWithoutProcessState(t *testing.T) {
+	var resp ExecResponse
+	applyRusage(&resp, nil)
+	assert.Zero(t, resp.UserTimeMS)
+	assert.Zero(t, resp.SysTimeMS)
+	assert.Zero(t, resp.MaxRSSKB)
+}
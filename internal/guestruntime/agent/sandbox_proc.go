@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"unsafe"
 
@@ -109,7 +110,17 @@ func blockedSyscalls() ([]uint32, uint32) {
 // with EPERM. All other syscalls are allowed.
 func buildSeccompFilter() []sockFilter {
 	blocked, auditArch := blockedSyscalls()
+	return buildSeccompFilterFor(blocked, auditArch)
+}
+
+func buildSeccompFilterFor(blocked []uint32, auditArch uint32) []sockFilter {
+	return buildSeccompFilterWithAction(blocked, auditArch, seccompRetErrno|errnoEPERM)
+}
 
+// buildSeccompFilterWithAction returns action for the listed syscalls and
+// allows everything else (including other architectures).
+func buildSeccompFilterWithAction(nrs []uint32, auditArch uint32, action uint32) []sockFilter {
+	blocked := nrs
 	filter := []sockFilter{
 		bpfStmt(bpfLD|bpfW|bpfABS, 4),
 		bpfJump(bpfJMP|bpfJEQ|bpfK, auditArch, 0, uint8(len(blocked)+1)),
@@ -122,7 +133,7 @@ func buildSeccompFilter() []sockFilter {
 	}
 
 	filter = append(filter, bpfStmt(bpfRET|bpfK, seccompRetAllow))
-	filter = append(filter, bpfStmt(bpfRET|bpfK, seccompRetErrno|errnoEPERM))
+	filter = append(filter, bpfStmt(bpfRET|bpfK, action))
 
 	return filter
 }
@@ -131,6 +142,24 @@ func buildSeccompFilter() []sockFilter {
 // process is a re-execed sandbox launcher (not the main agent).
 const sandboxLauncherEnvKey = "__MATCHLOCK_SANDBOX_LAUNCHER"
 
+// sandboxSetupEnvKey tells the launcher it is running a setup exec, which
+// keeps the agent's full privileges. Only wrapCommandForSandbox sets it.
+const sandboxSetupEnvKey = "__MATCHLOCK_SANDBOX_SETUP"
+
+// setupClosed is set by the first ordinary exec. Until then the host may
+// send setup execs (the sandbox's init commands); afterwards workload
+// processes exist that could reach the agent, so they are refused.
+var setupClosed atomic.Bool
+
+// errSetupExecClosed is the ExecResponse.Error of a setup exec that arrived
+// after the window closed.
+const errSetupExecClosed = "setup exec refused: a workload command has already run"
+
+// admitSetupExec reports whether a setup exec may still run.
+func admitSetupExec() bool {
+	return !setupClosed.Load()
+}
+
 // isPrivilegedMode checks /proc/cmdline for matchlock.privileged=1.
 // When privileged, the sandbox launcher skips cap drops, seccomp, and no_new_privs.
 func isPrivilegedMode() bool {
@@ -146,6 +175,132 @@ func isPrivilegedMode() bool {
 	return false
 }
 
+// defaultDroppedCaps are removed from the bounding set unless re-added via
+// matchlock.cap_add.
+var defaultDroppedCaps = []uintptr{capSysPtrace, capSysAdmin, capSysModule, capSysRawio, capSysBoot}
+
+// capOverrides holds the capability numbers from matchlock.cap_add and
+// matchlock.cap_drop, the syscall names from matchlock.allow_syscalls, and
+// matchlock.no_new_privs=0 on the kernel cmdline.
+type capOverrides struct {
+	add           map[uintptr]bool
+	drop          []uintptr
+	allowSyscalls map[string]bool
+	keepNewPrivs  bool
+}
+
+func readCapOverrides() capOverrides {
+	data, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return capOverrides{}
+	}
+	return parseCapOverrides(string(data))
+}
+
+func parseCapOverrides(cmdline string) capOverrides {
+	var o capOverrides
+	for _, field := range strings.Fields(cmdline) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "matchlock.allow_syscalls":
+			for _, name := range strings.Split(value, ",") {
+				if o.allowSyscalls == nil {
+					o.allowSyscalls = make(map[string]bool)
+				}
+				o.allowSyscalls[name] = true
+			}
+			continue
+		case "matchlock.no_new_privs":
+			o.keepNewPrivs = value == "0"
+			continue
+		case "matchlock.cap_add", "matchlock.cap_drop":
+		default:
+			continue
+		}
+		for _, s := range strings.Split(value, ",") {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				continue
+			}
+			if key == "matchlock.cap_add" {
+				if o.add == nil {
+					o.add = make(map[uintptr]bool)
+				}
+				o.add[uintptr(n)] = true
+			} else {
+				o.drop = append(o.drop, uintptr(n))
+			}
+		}
+	}
+	return o
+}
+
+// boundingSetDrops returns the default drops minus cap_add, plus cap_drop.
+// An explicit cap_drop wins over cap_add.
+func (o capOverrides) boundingSetDrops() []uintptr {
+	var drops []uintptr
+	for _, c := range defaultDroppedCaps {
+		if !o.add[c] {
+			drops = append(drops, c)
+		}
+	}
+	return append(drops, o.drop...)
+}
+
+// blockedSyscallsFor removes syscalls from the seccomp block list whose
+// guarding capability was re-added, so e.g. cap_add=SYS_PTRACE makes
+// debuggers work, and those named in allow_syscalls.
+func (o capOverrides) blockedSyscallsFor(blocked []uint32) []uint32 {
+	ptrace, kexec := blockedSyscallGroups()
+	allowed := make(map[uint32]bool)
+	if o.keeps(capSysPtrace) {
+		for _, nr := range ptrace {
+			allowed[nr] = true
+		}
+	}
+	if o.keeps(capSysBoot) {
+		for _, nr := range kexec {
+			allowed[nr] = true
+		}
+	}
+	names := auditedSyscalls()
+	var out []uint32
+	for _, nr := range blocked {
+		if !allowed[nr] && !o.allowSyscalls[names[nr]] {
+			out = append(out, nr)
+		}
+	}
+	return out
+}
+
+func (o capOverrides) keeps(c uintptr) bool {
+	if !o.add[c] {
+		return false
+	}
+	for _, d := range o.drop {
+		if d == c {
+			return false
+		}
+	}
+	return true
+}
+
+// blockedSyscallGroups splits blockedSyscalls by the capability that would
+// otherwise permit them: ptrace-family and kexec-family.
+func blockedSyscallGroups() (ptrace, kexec []uint32) {
+	switch runtime.GOARCH {
+	case "arm64":
+		return []uint32{sysProcessVMReadvArm64, sysProcessVMWritevArm64, sysPtraceArm64},
+			[]uint32{sysKexecLoadArm64, sysKexecFileLoadArm64}
+	default:
+		return []uint32{sysProcessVMReadvAmd64, sysProcessVMWritevAmd64, sysPtraceAmd64},
+			[]uint32{sysKexecLoadAmd64, sysKexecFileLoadAmd64}
+	}
+}
+
 // isSandboxLauncher returns true if this process was re-execed as a sandbox launcher.
 func isSandboxLauncher() bool {
 	return os.Getenv(sandboxLauncherEnvKey) == "1"
@@ -154,36 +309,71 @@ func isSandboxLauncher() bool {
 // runSandboxLauncher is the entrypoint for the re-execed process.
 // It drops capabilities, installs seccomp, then execs the real command.
 func runSandboxLauncher() {
+	// Seccomp filters and no_new_privs are per-thread; keep them on the
+	// thread that execs the workload.
+	runtime.LockOSThread()
+
 	// Remove our marker so child doesn't inherit it
 	os.Unsetenv(sandboxLauncherEnvKey)
 
+	setup := os.Getenv(sandboxSetupEnvKey) == "1"
+	os.Unsetenv(sandboxSetupEnvKey)
+
 	// Remount /proc for our new PID namespace so the workload only sees
 	// its own processes, not the guest-agent in the parent namespace.
-	syscall.Unmount("/proc", syscall.MNT_DETACH)
-	syscall.Mount("proc", "/proc", "proc", 0, "")
+	// Setup execs share the agent's namespaces and keep its /proc.
+	if !setup {
+		syscall.Unmount("/proc", syscall.MNT_DETACH)
+		syscall.Mount("proc", "/proc", "proc", 0, "")
+	}
+
+	privileged := setup || isPrivilegedMode()
 
-	privileged := isPrivilegedMode()
+	auditFD := -1
+	if v, ok := os.LookupEnv(auditFDEnvKey); ok {
+		os.Unsetenv(auditFDEnvKey)
+		if n, err := strconv.Atoi(v); err == nil {
+			auditFD = n
+		}
+	}
 
 	if !privileged {
-		// Drop specific dangerous capabilities from the bounding set
-		for _, cap := range []uintptr{capSysPtrace, capSysAdmin, capSysModule, capSysRawio, capSysBoot} {
+		caps := readCapOverrides()
+
+		// Drop dangerous capabilities (adjusted by cap_add/cap_drop) from the bounding set
+		for _, cap := range caps.boundingSetDrops() {
 			syscall.RawSyscall(syscall.SYS_PRCTL, prCapBSetDrop, cap, 0)
 		}
 
-		// Set no_new_privs (required for seccomp and prevents privilege escalation)
-		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
-			fmt.Fprintf(os.Stderr, "matchlock: failed to set no_new_privs: %v\n", errno)
-			os.Exit(127)
+		// Set no_new_privs (prevents privilege escalation). Without it,
+		// installing seccomp below needs CAP_SYS_ADMIN, which root has.
+		if !caps.keepNewPrivs {
+			if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+				fmt.Fprintf(os.Stderr, "matchlock: failed to set no_new_privs: %v\n", errno)
+				os.Exit(127)
+			}
 		}
 
-		// Install seccomp filter
-		filter := buildSeccompFilter()
-		prog := sockFprog{
-			Len:    uint16(len(filter)),
-			Filter: &filter[0],
+		// Install seccomp filter. In audit mode the guest agent enforces
+		// the block list while recording, so only the notify filter is used.
+		if auditFD < 0 {
+			blocked, auditArch := blockedSyscalls()
+			filter := buildSeccompFilterFor(caps.blockedSyscallsFor(blocked), auditArch)
+			prog := sockFprog{
+				Len:    uint16(len(filter)),
+				Filter: &filter[0],
+			}
+			if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+				fmt.Fprintf(os.Stderr, "matchlock: failed to install seccomp filter: %v\n", errno)
+				os.Exit(127)
+			}
 		}
-		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
-			fmt.Fprintf(os.Stderr, "matchlock: failed to install seccomp filter: %v\n", errno)
+	}
+
+	if auditFD >= 0 {
+		if err := installAuditFilter(auditFD); err != nil {
+			// Never run a non-privileged workload without its block list.
+			fmt.Fprintf(os.Stderr, "matchlock: failed to install seccomp audit filter: %v\n", err)
 			os.Exit(127)
 		}
 	}
@@ -218,11 +408,18 @@ func runSandboxLauncher() {
 
 	argv := append([]string{command}, args...)
 
+	// Resource limits apply in privileged mode too; set them while still
+	// root so hard limits can be raised.
+	if err := applyUlimits(readUlimits()); err != nil {
+		fmt.Fprintf(os.Stderr, "matchlock: %v\n", err)
+		os.Exit(127)
+	}
+
 	// Switch user if requested via MATCHLOCK_USER env var
 	userSpec := os.Getenv("MATCHLOCK_USER")
 	os.Unsetenv("MATCHLOCK_USER")
 	if userSpec != "" {
-		uid, gid, homeDir, err := resolveUser(userSpec)
+		uid, gid, homeDir, err := ResolveUser(userSpec)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "matchlock: resolve user %q: %v\n", userSpec, err)
 			os.Exit(127)
@@ -247,7 +444,7 @@ func runSandboxLauncher() {
 	// Filter out our internal env vars from the environment
 	var env []string
 	for _, e := range os.Environ() {
-		if strings.HasPrefix(e, "MATCHLOCK_CMD=") || strings.HasPrefix(e, "MATCHLOCK_ARG_") || strings.HasPrefix(e, sandboxLauncherEnvKey+"=") || strings.HasPrefix(e, "MATCHLOCK_USER=") {
+		if strings.HasPrefix(e, "MATCHLOCK_CMD=") || strings.HasPrefix(e, "MATCHLOCK_ARG_") || strings.HasPrefix(e, sandboxLauncherEnvKey+"=") || strings.HasPrefix(e, sandboxSetupEnvKey+"=") || strings.HasPrefix(e, "MATCHLOCK_USER=") || strings.HasPrefix(e, auditFDEnvKey+"=") {
 			continue
 		}
 		env = append(env, e)
@@ -286,19 +483,31 @@ func applySandboxSysProcAttrBatch(cmd *exec.Cmd) {
 
 // wrapCommandForSandbox rewrites the exec.Cmd to use the re-exec launcher pattern.
 // The original command is passed via environment variables, and the binary is
-// replaced with /proc/self/exe (the guest-agent itself).
-func wrapCommandForSandbox(cmd *exec.Cmd) {
+// replaced with /proc/self/exe (the guest-agent itself). The returned function
+// releases seccomp audit resources and must be called after cmd has started.
+//
+// A setup exec runs in the agent's PID and mount namespaces, so mounts and
+// daemons it starts outlive it, and the launcher keeps its privileges. The
+// caller must have checked admitSetupExec; any other exec closes the window.
+func wrapCommandForSandbox(cmd *exec.Cmd, setup bool) func() {
 	origArgs := cmd.Args // e.g. ["sh", "-c", "python3 script.py"]
 
 	// Set the binary to re-exec ourselves
 	cmd.Path = "/proc/self/exe"
 	cmd.Args = []string{"guest-agent"}
 
-	// Pass the original command via env vars
+	// Pass the original command via env vars. A request's own env must
+	// not be able to claim setup.
 	if cmd.Env == nil {
 		cmd.Env = os.Environ()
 	}
-	cmd.Env = append(cmd.Env, sandboxLauncherEnvKey+"=1")
+	env := cmd.Env[:0]
+	for _, e := range cmd.Env {
+		if !strings.HasPrefix(e, sandboxSetupEnvKey+"=") {
+			env = append(env, e)
+		}
+	}
+	cmd.Env = append(env, sandboxLauncherEnvKey+"=1")
 
 	if len(origArgs) > 0 {
 		cmd.Env = append(cmd.Env, "MATCHLOCK_CMD="+origArgs[0])
@@ -306,11 +515,21 @@ func wrapCommandForSandbox(cmd *exec.Cmd) {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("MATCHLOCK_ARG_%d=%s", i, arg))
 		}
 	}
+
+	if !setup {
+		setupClosed.Store(true)
+		return attachSyscallAudit(cmd)
+	}
+	cmd.Env = append(cmd.Env, sandboxSetupEnvKey+"=1")
+	if cmd.SysProcAttr != nil {
+		cmd.SysProcAttr.Cloneflags = 0
+	}
+	return func() {}
 }
 
-// resolveUser resolves a user spec ("uid", "uid:gid", or "username") to numeric
+// ResolveUser resolves a user spec ("uid", "uid:gid", or "username") to numeric
 // UID, GID, and home directory by parsing /etc/passwd and /etc/group.
-func resolveUser(spec string) (uid, gid int, homeDir string, err error) {
+func ResolveUser(spec string) (uid, gid int, homeDir string, err error) {
 	return resolveUserFrom(spec, "/etc/passwd", "/etc/group")
 }
 
@@ -3,6 +3,7 @@
 package guestagent
 
 import (
+	"os/exec"
 	"runtime"
 	"testing"
 
@@ -86,3 +87,69 @@ func TestIsSandboxLauncher(t *testing.T) {
 	t.Setenv(sandboxLauncherEnvKey, "1")
 	assert.True(t, isSandboxLauncher(), "should be sandbox launcher when env var is set")
 }
+
+func TestWrapCommandForSandboxSetupExec(t *testing.T) {
+	setupClosed.Store(false)
+	t.Cleanup(func() { setupClosed.Store(false) })
+
+	setup := exec.Command("mount", "-t", "tmpfs", "tmpfs", "/mnt")
+	applySandboxSysProcAttrBatch(setup)
+	wrapCommandForSandbox(setup, true)()
+	assert.Contains(t, setup.Env, sandboxSetupEnvKey+"=1")
+	assert.Zero(t, setup.SysProcAttr.Cloneflags, "setup execs share the agent's namespaces")
+	assert.True(t, admitSetupExec(), "a setup exec leaves the window open")
+
+	workload := exec.Command("true")
+	workload.Env = []string{sandboxSetupEnvKey + "=1"}
+	applySandboxSysProcAttrBatch(workload)
+	wrapCommandForSandbox(workload, false)()
+	assert.NotContains(t, workload.Env, sandboxSetupEnvKey+"=1", "a request's env must not claim setup")
+	assert.NotZero(t, workload.SysProcAttr.Cloneflags)
+	assert.False(t, admitSetupExec(), "the first ordinary exec closes the window")
+}
+
+func TestParseCapOverrides(t *testing.T) {
+	o := parseCapOverrides("console=ttyS0 matchlock.cap_add=19,13 matchlock.cap_drop=12 matchlock.mtu=1500")
+	assert.True(t, o.add[capSysPtrace])
+	assert.True(t, o.add[13])
+	assert.Equal(t, []uintptr{12}, o.drop)
+
+	drops := o.boundingSetDrops()
+	assert.NotContains(t, drops, uintptr(capSysPtrace))
+	assert.Contains(t, drops, uintptr(capSysAdmin))
+	assert.Contains(t, drops, uintptr(12))
+
+	empty := parseCapOverrides("console=ttyS0")
+	assert.Equal(t, defaultDroppedCaps, empty.boundingSetDrops())
+}
+
+func TestCapOverridesBlockedSyscalls(t *testing.T) {
+	blocked, _ := blockedSyscalls()
+	ptrace, kexec := blockedSyscallGroups()
+
+	o := parseCapOverrides("matchlock.cap_add=19")
+	assert.Equal(t, kexec, o.blockedSyscallsFor(blocked))
+
+	o = parseCapOverrides("matchlock.cap_add=19,22")
+	assert.Empty(t, o.blockedSyscallsFor(blocked))
+
+	// cap_drop wins over cap_add.
+	o = parseCapOverrides("matchlock.cap_add=19 matchlock.cap_drop=19")
+	assert.Equal(t, blocked, o.blockedSyscallsFor(blocked))
+	assert.Len(t, append(ptrace, kexec...), len(blocked))
+}
+
+func TestCapOverridesAllowSyscalls(t *testing.T) {
+	blocked, _ := blockedSyscalls()
+	names := auditedSyscalls()
+
+	o := parseCapOverrides("matchlock.allow_syscalls=ptrace,kexec_load matchlock.no_new_privs=0")
+	assert.True(t, o.keepNewPrivs)
+	remaining := o.blockedSyscallsFor(blocked)
+	assert.Len(t, remaining, len(blocked)-2)
+	for _, nr := range remaining {
+		assert.NotContains(t, []string{"ptrace", "kexec_load"}, names[nr])
+	}
+
+	assert.False(t, parseCapOverrides("console=ttyS0").keepNewPrivs)
+}
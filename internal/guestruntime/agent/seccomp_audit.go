@@ -0,0 +1,320 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+	"golang.org/x/sys/unix"
+)
+
+// auditFDEnvKey passes the launcher's end of the audit socketpair.
+const auditFDEnvKey = "MATCHLOCK_AUDIT_FD"
+
+// auditQueueSize bounds buffered audit records; excess records are dropped
+// so a slow host never stalls guest syscalls.
+const auditQueueSize = 1024
+
+// seccompNotif mirrors struct seccomp_notif (including struct seccomp_data).
+type seccompNotif struct {
+	ID    uint64
+	PID   uint32
+	Flags uint32
+	Nr    int32
+	Arch  uint32
+	IP    uint64
+	Args  [6]uint64
+}
+
+// seccompNotifResp mirrors struct seccomp_notif_resp.
+type seccompNotifResp struct {
+	ID    uint64
+	Val   int64
+	Error int32
+	Flags uint32
+}
+
+// syscallAuditRecord is the wire form of api.SyscallEvent.
+type syscallAuditRecord struct {
+	Name    string `json:"name"`
+	Nr      int    `json:"nr"`
+	Args    string `json:"args"`
+	PID     int    `json:"pid"`
+	Blocked bool   `json:"blocked,omitempty"`
+}
+
+// auditedSyscalls are the security-relevant syscalls reported in audit mode.
+// It is a superset of blockedSyscalls so denied attempts are visible too.
+func auditedSyscalls() map[uint32]string {
+	return map[uint32]string{
+		unix.SYS_MOUNT:             "mount",
+		unix.SYS_UMOUNT2:           "umount2",
+		unix.SYS_PIVOT_ROOT:        "pivot_root",
+		unix.SYS_CHROOT:            "chroot",
+		unix.SYS_UNSHARE:           "unshare",
+		unix.SYS_SETNS:             "setns",
+		unix.SYS_BPF:               "bpf",
+		unix.SYS_PERF_EVENT_OPEN:   "perf_event_open",
+		unix.SYS_USERFAULTFD:       "userfaultfd",
+		unix.SYS_INIT_MODULE:       "init_module",
+		unix.SYS_FINIT_MODULE:      "finit_module",
+		unix.SYS_DELETE_MODULE:     "delete_module",
+		unix.SYS_KEYCTL:            "keyctl",
+		unix.SYS_ADD_KEY:           "add_key",
+		unix.SYS_REQUEST_KEY:       "request_key",
+		unix.SYS_PERSONALITY:       "personality",
+		unix.SYS_REBOOT:            "reboot",
+		unix.SYS_PTRACE:            "ptrace",
+		unix.SYS_PROCESS_VM_READV:  "process_vm_readv",
+		unix.SYS_PROCESS_VM_WRITEV: "process_vm_writev",
+		unix.SYS_KEXEC_LOAD:        "kexec_load",
+		unix.SYS_KEXEC_FILE_LOAD:   "kexec_file_load",
+	}
+}
+
+// isSeccompAuditMode checks /proc/cmdline for matchlock.seccomp_audit=1.
+func isSeccompAuditMode() bool {
+	data, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return false
+	}
+	for _, field := range strings.Fields(string(data)) {
+		if field == "matchlock.seccomp_audit=1" {
+			return true
+		}
+	}
+	return false
+}
+
+// sandboxBlockedSyscalls is the deny list the launcher enforces, after
+// privileged mode and cap_add adjustments.
+func sandboxBlockedSyscalls() ([]uint32, uint32) {
+	blocked, auditArch := blockedSyscalls()
+	if isPrivilegedMode() {
+		return nil, auditArch
+	}
+	return readCapOverrides().blockedSyscallsFor(blocked), auditArch
+}
+
+// auditSink streams audit records to the host over vsock.
+type auditSink struct {
+	records chan syscallAuditRecord
+}
+
+var (
+	syscallAudit     *auditSink
+	syscallAuditOnce sync.Once
+)
+
+// startSyscallAudit enables audit mode for this agent when requested on the
+// kernel cmdline.
+func startSyscallAudit() {
+	syscallAuditOnce.Do(func() {
+		if !isSeccompAuditMode() {
+			return
+		}
+		syscallAudit = &auditSink{records: make(chan syscallAuditRecord, auditQueueSize)}
+		go syscallAudit.run()
+	})
+}
+
+func (s *auditSink) run() {
+	fd, err := dialVsock(VMADDR_CID_HOST, vsockPorts().Port(vsock.ServiceAudit))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, logPrefix+"seccomp audit: connect to host: %v\n", err)
+		for range s.records {
+		}
+		return
+	}
+	defer func() { syscall.Close(fd) }()
+
+	for record := range s.records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		line = append(line, '\n')
+		if writeAuditLine(fd, line) == nil {
+			continue
+		}
+		// Restoring a VM snapshot resets vsock and drops the stream; the
+		// restored host is listening again, so reconnect once.
+		syscall.Close(fd)
+		if fd, err = dialVsock(VMADDR_CID_HOST, vsockPorts().Port(vsock.ServiceAudit)); err != nil || writeAuditLine(fd, line) != nil {
+			for range s.records {
+			}
+			return
+		}
+	}
+}
+
+func writeAuditLine(fd int, line []byte) error {
+	for len(line) > 0 {
+		n, err := syscall.Write(fd, line)
+		if err != nil {
+			return err
+		}
+		line = line[n:]
+	}
+	return nil
+}
+
+func (s *auditSink) send(record syscallAuditRecord) {
+	select {
+	case s.records <- record:
+	default:
+	}
+}
+
+// attachSyscallAudit hands the launcher one end of a socketpair over which it
+// returns its seccomp notify listener, and supervises that listener in the
+// background. The returned function must be called once the command has
+// started (or failed to start) to release the agent's copy of the child end.
+func attachSyscallAudit(cmd *exec.Cmd) func() {
+	if syscallAudit == nil {
+		return func() {}
+	}
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return func() {}
+	}
+	parent := os.NewFile(uintptr(fds[0]), "seccomp-audit")
+	child := os.NewFile(uintptr(fds[1]), "seccomp-audit-child")
+
+	cmd.ExtraFiles = append(cmd.ExtraFiles, child)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%d", auditFDEnvKey, 2+len(cmd.ExtraFiles)))
+
+	go superviseSyscallAudit(parent)
+	return func() { child.Close() }
+}
+
+// superviseSyscallAudit receives the launcher's notify listener and answers
+// every notification: blocked syscalls fail with EPERM, the rest continue.
+func superviseSyscallAudit(sock *os.File) {
+	listenerFD, err := recvFD(sock)
+	sock.Close()
+	if err != nil {
+		return
+	}
+	defer unix.Close(listenerFD)
+
+	names := auditedSyscalls()
+	blockedList, _ := sandboxBlockedSyscalls()
+	blocked := make(map[uint32]bool, len(blockedList))
+	for _, nr := range blockedList {
+		blocked[nr] = true
+	}
+
+	for {
+		pfd := []unix.PollFd{{Fd: int32(listenerFD), Events: unix.POLLIN}}
+		if _, err := unix.Poll(pfd, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return
+		}
+		if pfd[0].Revents&(unix.POLLHUP|unix.POLLERR|unix.POLLNVAL) != 0 {
+			return
+		}
+
+		var notif seccompNotif
+		if err := notifIoctl(listenerFD, unix.SECCOMP_IOCTL_NOTIF_RECV, unsafe.Pointer(&notif)); err != nil {
+			if err == unix.EINTR || err == unix.ENOENT {
+				continue
+			}
+			return
+		}
+
+		nr := uint32(notif.Nr)
+		resp := seccompNotifResp{ID: notif.ID, Flags: unix.SECCOMP_USER_NOTIF_FLAG_CONTINUE}
+		if blocked[nr] {
+			resp = seccompNotifResp{ID: notif.ID, Error: -int32(unix.EPERM)}
+		}
+		// ENOENT means the task died while we were looking; nothing to answer.
+		_ = notifIoctl(listenerFD, unix.SECCOMP_IOCTL_NOTIF_SEND, unsafe.Pointer(&resp))
+
+		name := names[nr]
+		if name == "" {
+			name = strconv.Itoa(int(nr))
+		}
+		syscallAudit.send(syscallAuditRecord{
+			Name:    name,
+			Nr:      int(nr),
+			Args:    summarizeSyscallArgs(notif.Args),
+			PID:     int(notif.PID),
+			Blocked: blocked[nr],
+		})
+	}
+}
+
+func notifIoctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// summarizeSyscallArgs renders args in hex, omitting trailing zero args.
+func summarizeSyscallArgs(args [6]uint64) string {
+	n := len(args)
+	for n > 0 && args[n-1] == 0 {
+		n--
+	}
+	parts := make([]string, n)
+	for i := 0; i < n; i++ {
+		parts[i] = "0x" + strconv.FormatUint(args[i], 16)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// installAuditFilter installs a seccomp filter that routes audited syscalls to
+// a user-notification listener and sends the listener fd over auditFD. It runs
+// in the launcher after no_new_privs is set.
+func installAuditFilter(auditFD int) error {
+	defer unix.Close(auditFD)
+
+	_, auditArch := blockedSyscalls()
+	var nrs []uint32
+	for nr := range auditedSyscalls() {
+		nrs = append(nrs, nr)
+	}
+	filter := buildSeccompFilterWithAction(nrs, auditArch, unix.SECCOMP_RET_USER_NOTIF)
+	prog := sockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	listenerFD, _, errno := unix.RawSyscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, unix.SECCOMP_FILTER_FLAG_NEW_LISTENER, uintptr(unsafe.Pointer(&prog)))
+	if errno != 0 {
+		return errno
+	}
+	defer unix.Close(int(listenerFD))
+	return unix.Sendmsg(auditFD, []byte{0}, unix.UnixRights(int(listenerFD)), nil, 0)
+}
+
+func recvFD(sock *os.File) (int, error) {
+	buf := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(4))
+	_, oobn, _, _, err := unix.Recvmsg(int(sock.Fd()), buf, oob, unix.MSG_CMSG_CLOEXEC)
+	if err != nil {
+		return -1, err
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) == 0 {
+		return -1, unix.EBADMSG
+	}
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) == 0 {
+		return -1, unix.EBADMSG
+	}
+	return fds[0], nil
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestAuditedSyscallsCoverBlockedSyscalls(t *testing.T) {
+	audited := auditedSyscalls()
+	blocked, _ := blockedSyscalls()
+	for _, nr := range blocked {
+		assert.Contains(t, audited, nr, "blocked syscall %d must be audited", nr)
+	}
+}
+
+func TestBuildSeccompFilterWithAction(t *testing.T) {
+	filter := buildSeccompFilterWithAction([]uint32{1, 2}, auditArchX86_64, unix.SECCOMP_RET_USER_NOTIF)
+	assert.Len(t, filter, 3+2+2)
+	assert.Equal(t, uint32(seccompRetAllow), filter[len(filter)-2].K)
+	assert.Equal(t, uint32(unix.SECCOMP_RET_USER_NOTIF), filter[len(filter)-1].K)
+}
+
+func TestSummarizeSyscallArgs(t *testing.T) {
+	assert.Equal(t, "0x1, 0x0, 0xff", summarizeSyscallArgs([6]uint64{1, 0, 255}))
+	assert.Equal(t, "", summarizeSyscallArgs([6]uint64{}))
+}
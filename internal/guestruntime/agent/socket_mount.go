@@ -0,0 +1,101 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+)
+
+// startSocketMounts listens on each guest path named in
+// matchlock.socket_mounts= and proxies its connections to the host.
+func startSocketMounts() {
+	data, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return
+	}
+	for _, path := range parseSocketMounts(string(data)) {
+		listener, err := listenSocketMount(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, logPrefix+"Failed to listen on socket mount %s: %v\n", path, err)
+			continue
+		}
+		fmt.Println(logPrefix+"Socket mount listening on", path)
+		go serveSocketMount(listener, path)
+	}
+}
+
+// parseSocketMounts reads matchlock.socket_mounts=path,... from the kernel
+// cmdline. The host validates the paths before boot.
+func parseSocketMounts(cmdline string) []string {
+	for _, field := range strings.Fields(cmdline) {
+		if value, ok := strings.CutPrefix(field, "matchlock.socket_mounts="); ok && value != "" {
+			return strings.Split(value, ",")
+		}
+	}
+	return nil
+}
+
+// listenSocketMount creates the unix socket at path, replacing a stale one,
+// and opens it to every guest user as the host socket is shared as is.
+func listenSocketMount(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0666); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func serveSocketMount(listener net.Listener, path string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, logPrefix+"Socket mount %s accept error: %v\n", path, err)
+			return
+		}
+		go func() {
+			fd, err := dialVsock(VMADDR_CID_HOST, vsockPorts().Port(vsock.ServiceSocket))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, logPrefix+"Socket mount %s: %v\n", path, err)
+				conn.Close()
+				return
+			}
+			proxySocketMount(conn, fd, path)
+		}()
+	}
+}
+
+// proxySocketMount names path to the host on the vsock fd and relays bytes
+// until the host side closes. Like port-forward, a client half-close is not
+// propagated onto vsock.
+func proxySocketMount(conn net.Conn, fd int, path string) {
+	defer syscall.Close(fd)
+
+	if _, err := syscall.Write(fd, []byte(path+"\n")); err != nil {
+		conn.Close()
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		copyConnToFD(conn, fd)
+		close(done)
+	}()
+	copyFDToConn(fd, conn)
+	// Unblock the client reader before fd is closed and can be reused.
+	conn.Close()
+	<-done
+}
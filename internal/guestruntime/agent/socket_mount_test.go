@@ -0,0 +1,67 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSocketMounts(t *testing.T) {
+	assert.Nil(t, parseSocketMounts("console=ttyS0 quiet"))
+	assert.Equal(t, []string{"/var/run/docker.sock", "/run/model.sock"},
+		parseSocketMounts("console=ttyS0 matchlock.socket_mounts=/var/run/docker.sock,/run/model.sock quiet"))
+}
+
+func TestProxySocketMount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "app.sock")
+	listener, err := listenSocketMount(path)
+	require.NoError(t, err)
+	defer listener.Close()
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0666), info.Mode().Perm())
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	host := os.NewFile(uintptr(fds[1]), "host")
+	defer host.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		proxySocketMount(conn, fds[0], path)
+	}()
+
+	client, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = io.WriteString(client, "ping\n")
+	require.NoError(t, err)
+
+	hostReader := bufio.NewReader(host)
+	header, err := hostReader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, path+"\n", header)
+	line, err := hostReader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "ping\n", line)
+
+	_, err = io.WriteString(host, "pong\n")
+	require.NoError(t, err)
+	require.NoError(t, host.Close())
+
+	reply, err := io.ReadAll(client)
+	require.NoError(t, err)
+	assert.Equal(t, "pong\n", string(reply))
+}
@@ -0,0 +1,145 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// userHZ is the tick rate /proc/stat reports CPU time in. It is fixed at
+// 100 for the ABI, whatever CONFIG_HZ the kernel was built with.
+const userHZ = 100
+
+// activeExecs counts exec sessions that have started and not yet returned.
+var activeExecs atomic.Int64
+
+type guestStats struct {
+	CPUUsageUsec     uint64 `json:"cpu_usage_usec"`
+	MemoryUsedBytes  uint64 `json:"memory_used_bytes"`
+	MemoryTotalBytes uint64 `json:"memory_total_bytes"`
+	ActiveExecs      int64  `json:"active_execs"`
+}
+
+// handleStats replies with the guest's CPU time, memory use and number of
+// running exec sessions. CPU time comes from the root cgroup's cpu.stat
+// when cgroup2 is mounted and from /proc/stat otherwise.
+func handleStats(fd int) {
+	stats, err := readGuestStats("/sys/fs/cgroup/cpu.stat", "/proc/stat", "/proc/meminfo")
+	if err != nil {
+		sendMessage(fd, MsgTypeStderr, []byte(err.Error()))
+		return
+	}
+	stats.ActiveExecs = activeExecs.Load()
+	out, _ := json.Marshal(stats)
+	sendMessage(fd, MsgTypeStats, out)
+}
+
+func readGuestStats(cgroupCPUStat, procStat, meminfo string) (guestStats, error) {
+	var stats guestStats
+	cpu, err := readCPUUsage(cgroupCPUStat, procStat)
+	if err != nil {
+		return stats, err
+	}
+	data, err := os.ReadFile(meminfo)
+	if err != nil {
+		return stats, err
+	}
+	total, available, err := parseMeminfo(data)
+	if err != nil {
+		return stats, errx.With(ErrParseStats, " %s: %w", meminfo, err)
+	}
+	stats.CPUUsageUsec = cpu
+	stats.MemoryTotalBytes = total
+	stats.MemoryUsedBytes = total - min(available, total)
+	return stats, nil
+}
+
+func readCPUUsage(cgroupCPUStat, procStat string) (uint64, error) {
+	if data, err := os.ReadFile(cgroupCPUStat); err == nil {
+		if usec, ok := parseCgroupCPUStat(data); ok {
+			return usec, nil
+		}
+	}
+	data, err := os.ReadFile(procStat)
+	if err != nil {
+		return 0, err
+	}
+	usec, err := parseProcStat(data)
+	if err != nil {
+		return 0, errx.With(ErrParseStats, " %s: %w", procStat, err)
+	}
+	return usec, nil
+}
+
+// parseCgroupCPUStat returns usage_usec from a cgroup2 cpu.stat file.
+func parseCgroupCPUStat(data []byte) (uint64, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || key != "usage_usec" {
+			continue
+		}
+		usec, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		return usec, err == nil
+	}
+	return 0, false
+}
+
+// parseProcStat returns the busy CPU time on the aggregate "cpu" line of
+// /proc/stat: user, nice, system, irq, softirq and steal. guest time is
+// already counted in user and nice.
+func parseProcStat(data []byte) (uint64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var ticks uint64
+		for i, field := range fields[1:] {
+			if i == 3 || i == 4 || i >= 8 { // idle, iowait, guest, guest_nice
+				continue
+			}
+			n, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			ticks += n
+		}
+		return ticks * (1e6 / userHZ), nil
+	}
+	return 0, errx.With(ErrParseStats, ": no cpu line")
+}
+
+// parseMeminfo returns MemTotal and MemAvailable in bytes.
+func parseMeminfo(data []byte) (total, available uint64, err error) {
+	var haveTotal, haveAvailable bool
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || (key != "MemTotal" && key != "MemAvailable") {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		if key == "MemTotal" {
+			total, haveTotal = kb*1024, true
+		} else {
+			available, haveAvailable = kb*1024, true
+		}
+	}
+	if !haveTotal || !haveAvailable {
+		return 0, 0, errx.With(ErrParseStats, ": missing MemTotal or MemAvailable")
+	}
+	return total, available, nil
+}
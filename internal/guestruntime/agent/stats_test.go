@@ -0,0 +1,58 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMeminfo = `MemTotal:        2048000 kB
+MemFree:          512000 kB
+MemAvailable:    1536000 kB
+Buffers:           10000 kB
+`
+
+func TestParseProcStat(t *testing.T) {
+	data := []byte("cpu  100 5 50 9000 30 2 3 1 40 0\ncpu0 100 5 50 9000 30 2 3 1 40 0\nintr 12345\n")
+	usec, err := parseProcStat(data)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(161*10000), usec, "idle, iowait and guest time are excluded")
+
+	_, err = parseProcStat([]byte("intr 1\n"))
+	assert.ErrorIs(t, err, ErrParseStats)
+}
+
+func TestParseMeminfo(t *testing.T) {
+	total, available, err := parseMeminfo([]byte(testMeminfo))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2048000*1024), total)
+	assert.Equal(t, uint64(1536000*1024), available)
+
+	_, _, err = parseMeminfo([]byte("MemTotal: 1 kB\n"))
+	assert.ErrorIs(t, err, ErrParseStats)
+}
+
+func TestReadGuestStatsPrefersCgroup(t *testing.T) {
+	dir := t.TempDir()
+	cpuStat := filepath.Join(dir, "cpu.stat")
+	procStat := filepath.Join(dir, "stat")
+	meminfo := filepath.Join(dir, "meminfo")
+	require.NoError(t, os.WriteFile(procStat, []byte("cpu  1 0 0 0 0 0 0 0 0 0\n"), 0644))
+	require.NoError(t, os.WriteFile(meminfo, []byte(testMeminfo), 0644))
+
+	stats, err := readGuestStats(cpuStat, procStat, meminfo)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10000), stats.CPUUsageUsec, "falls back to /proc/stat without cgroup2")
+	assert.Equal(t, uint64(512000*1024), stats.MemoryUsedBytes)
+	assert.Equal(t, uint64(2048000*1024), stats.MemoryTotalBytes)
+
+	require.NoError(t, os.WriteFile(cpuStat, []byte("usage_usec 424242\nuser_usec 400000\n"), 0644))
+	stats, err = readGuestStats(cpuStat, procStat, meminfo)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(424242), stats.CPUUsageUsec)
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const tailPollInterval = 250 * time.Millisecond
+
+type tailRequest struct {
+	Path string `json:"path"`
+}
+
+// handleTail follows a guest file like tail -F. It replies MsgTypeReady once
+// the file is open, then sends the bytes appended after that point as
+// MsgTypeStdout frames until the host closes the connection.
+func handleTail(fd int, data []byte) {
+	var req tailRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		sendMessage(fd, MsgTypeStderr, []byte(fmt.Sprintf("invalid tail request: %v", err)))
+		return
+	}
+	f, err := os.Open(req.Path)
+	if err != nil {
+		sendMessage(fd, MsgTypeStderr, []byte(err.Error()))
+		return
+	}
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		f.Close()
+		sendMessage(fd, MsgTypeStderr, []byte(err.Error()))
+		return
+	}
+	sendMessage(fd, MsgTypeReady, nil)
+
+	// The host sends nothing more; a read error means it hung up.
+	done := make(chan struct{})
+	go func() {
+		for {
+			if _, _, err := readMessage(fd); err != nil {
+				close(done)
+				return
+			}
+		}
+	}()
+	followFile(f, req.Path, tailPollInterval, done, func(p []byte) {
+		sendMessage(fd, MsgTypeStdout, p)
+	})
+}
+
+// followFile sends whatever is appended to f until done is closed, polling
+// every interval. A file truncated below the read offset is read again from
+// the start. When path is replaced (log rotation), the rest of the old file
+// is sent and the new file is followed from its beginning. followFile takes
+// ownership of f.
+func followFile(f *os.File, path string, interval time.Duration, done <-chan struct{}, send func([]byte)) {
+	defer func() { f.Close() }()
+
+	buf := make([]byte, 32*1024)
+	drain := func() {
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				send(buf[:n])
+			}
+			if err != nil || n == 0 {
+				return
+			}
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		drain()
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			continue
+		}
+		if pos, err := f.Seek(0, io.SeekCurrent); err == nil && info.Size() < pos {
+			_, _ = f.Seek(0, io.SeekStart)
+			continue
+		}
+		if current, err := os.Stat(path); err == nil && !os.SameFile(info, current) {
+			next, err := os.Open(path)
+			if err != nil {
+				continue
+			}
+			drain()
+			f.Close()
+			f = next
+		}
+	}
+}
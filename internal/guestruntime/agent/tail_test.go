@@ -0,0 +1,71 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("before tail\n"), 0644))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	_, err = f.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var got []byte
+	received := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return string(got)
+	}
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		followFile(f, path, 10*time.Millisecond, done, func(p []byte) {
+			mu.Lock()
+			got = append(got, p...)
+			mu.Unlock()
+		})
+	}()
+
+	appendFile := func(text string) {
+		out, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+		require.NoError(t, err)
+		_, err = out.WriteString(text)
+		require.NoError(t, err)
+		require.NoError(t, out.Close())
+	}
+
+	appendFile("one\n")
+	assert.Eventually(t, func() bool { return received() == "one\n" }, time.Second, 5*time.Millisecond)
+
+	// Truncation restarts from the beginning of the file.
+	require.NoError(t, os.Truncate(path, 0))
+	time.Sleep(30 * time.Millisecond)
+	appendFile("two\n")
+	assert.Eventually(t, func() bool { return received() == "one\ntwo\n" }, time.Second, 5*time.Millisecond)
+
+	// Rotation switches to the new file at path.
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, os.WriteFile(path, []byte("three\n"), 0644))
+	assert.Eventually(t, func() bool { return received() == "one\ntwo\nthree\n" }, time.Second, 5*time.Millisecond)
+
+	close(done)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("followFile did not stop after done was closed")
+	}
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"encoding/binary"
+	"sync"
+	"syscall"
+)
+
+// ttyConn is the vsock connection of one exec_tty session. Its PTY output
+// and host input goroutines can outlive the command, so the fd is closed
+// only once neither can touch it again: the number is reused by the next
+// accepted connection, and a stray read or write would land in another
+// session's stream.
+type ttyConn struct {
+	fd int
+
+	mu      sync.Mutex // serializes frames and guards closing
+	closing bool
+	readers sync.WaitGroup
+}
+
+func newTTYConn(fd int) *ttyConn {
+	return &ttyConn{fd: fd}
+}
+
+// send writes one frame. It is a no-op once close has been called.
+func (c *ttyConn) send(msgType uint8, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing {
+		return
+	}
+	sendMessage(c.fd, msgType, data)
+}
+
+func (c *ttyConn) sendExit(code int) {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(code))
+	c.send(MsgTypeExit, data)
+}
+
+// readLoop starts a goroutine that passes each frame from the host to
+// handle until the connection fails or is closed.
+func (c *ttyConn) readLoop(handle func(msgType uint8, data []byte)) {
+	c.readers.Add(1)
+	go func() {
+		defer c.readers.Done()
+		for {
+			msgType, data, err := readMessage(c.fd)
+			if err != nil {
+				return
+			}
+			handle(msgType, data)
+		}
+	}()
+}
+
+// close stops further sends and wakes the reader with a shutdown. The fd
+// itself is closed once the reader has returned.
+func (c *ttyConn) close() {
+	c.mu.Lock()
+	c.closing = true
+	c.mu.Unlock()
+	syscall.Shutdown(c.fd, syscall.SHUT_RDWR)
+	go func() {
+		c.readers.Wait()
+		syscall.Close(c.fd)
+	}()
+}
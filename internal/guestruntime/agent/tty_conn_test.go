@@ -0,0 +1,51 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestTTYConnStopsTouchingFDAfterClose(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	local, peer := fds[0], fds[1]
+	defer unix.Close(peer)
+
+	conn := newTTYConn(local)
+	got := make(chan []byte, 1)
+	conn.readLoop(func(msgType uint8, data []byte) {
+		if msgType == MsgTypeStdin {
+			got <- data
+		}
+	})
+
+	sendMessage(peer, MsgTypeStdin, []byte("ls\n"))
+	select {
+	case data := <-got:
+		assert.Equal(t, "ls\n", string(data))
+	case <-time.After(time.Second):
+		t.Fatal("stdin frame not delivered")
+	}
+
+	conn.sendExit(3)
+	msgType, data, err := readMessage(peer)
+	require.NoError(t, err)
+	assert.Equal(t, MsgTypeExit, msgType)
+	assert.Equal(t, []byte{0, 0, 0, 3}, data)
+
+	conn.close()
+	conn.send(MsgTypeStdout, []byte("late output"))
+	_, _, err = readMessage(peer)
+	assert.Error(t, err, "nothing is sent after close")
+
+	assert.Eventually(t, func() bool {
+		_, err := unix.FcntlInt(uintptr(local), unix.F_GETFD, 0)
+		return err == unix.EBADF
+	}, time.Second, 10*time.Millisecond, "fd is closed once the reader returns")
+}
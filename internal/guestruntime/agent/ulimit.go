@@ -0,0 +1,86 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// rlimitResources maps matchlock.ulimits names to RLIMIT_* resources.
+var rlimitResources = map[string]int{
+	"core":   unix.RLIMIT_CORE,
+	"nofile": unix.RLIMIT_NOFILE,
+	"nproc":  unix.RLIMIT_NPROC,
+	"stack":  unix.RLIMIT_STACK,
+}
+
+type guestUlimit struct {
+	name     string
+	resource int
+	limit    syscall.Rlimit
+}
+
+func readUlimits() []guestUlimit {
+	data, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return nil
+	}
+	return parseUlimits(string(data))
+}
+
+// parseUlimits reads matchlock.ulimits=name:soft:hard,... from the kernel
+// cmdline. -1 means unlimited. Malformed and unknown entries are skipped;
+// the host validates them before boot.
+func parseUlimits(cmdline string) []guestUlimit {
+	var out []guestUlimit
+	for _, field := range strings.Fields(cmdline) {
+		value, ok := strings.CutPrefix(field, "matchlock.ulimits=")
+		if !ok {
+			continue
+		}
+		for _, entry := range strings.Split(value, ",") {
+			parts := strings.Split(entry, ":")
+			if len(parts) != 3 {
+				continue
+			}
+			resource, ok := rlimitResources[parts[0]]
+			if !ok {
+				continue
+			}
+			soft, err1 := parseRlimitValue(parts[1])
+			hard, err2 := parseRlimitValue(parts[2])
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			out = append(out, guestUlimit{name: parts[0], resource: resource, limit: syscall.Rlimit{Cur: soft, Max: hard}})
+		}
+	}
+	return out
+}
+
+func parseRlimitValue(s string) (uint64, error) {
+	if s == "-1" {
+		return unix.RLIM_INFINITY, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// applyUlimits sets each limit on the calling process so that the command
+// it execs inherits them. It must run before dropping root, since raising
+// a hard limit needs CAP_SYS_RESOURCE.
+func applyUlimits(ulimits []guestUlimit) error {
+	for _, u := range ulimits {
+		limit := u.limit
+		if err := syscall.Setrlimit(u.resource, &limit); err != nil {
+			return errx.With(ErrSetrlimit, " %s=%d:%d: %w", u.name, limit.Cur, limit.Max, err)
+		}
+	}
+	return nil
+}
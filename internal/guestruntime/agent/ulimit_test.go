@@ -0,0 +1,22 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseUlimits(t *testing.T) {
+	got := parseUlimits("console=ttyS0 matchlock.ulimits=core:0:0,nofile:1024:65536,stack:-1:-1,bogus:1:1,nproc:5 quiet")
+	assert.Equal(t, []guestUlimit{
+		{name: "core", resource: unix.RLIMIT_CORE, limit: syscall.Rlimit{Cur: 0, Max: 0}},
+		{name: "nofile", resource: unix.RLIMIT_NOFILE, limit: syscall.Rlimit{Cur: 1024, Max: 65536}},
+		{name: "stack", resource: unix.RLIMIT_STACK, limit: syscall.Rlimit{Cur: unix.RLIM_INFINITY, Max: unix.RLIM_INFINITY}},
+	}, got)
+
+	assert.Empty(t, parseUlimits("console=ttyS0 matchlock.swap_mb=512"))
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultUser is the user guest commands run as when the host names none:
+// the image USER passed as matchlock.user=, or "" for root.
+var defaultUser string
+
+func readDefaultUser() string {
+	data, err := os.ReadFile("/proc/cmdline")
+	if err != nil {
+		return ""
+	}
+	return parseDefaultUser(string(data))
+}
+
+// parseDefaultUser reads matchlock.user= from the kernel cmdline.
+func parseDefaultUser(cmdline string) string {
+	for _, field := range strings.Fields(cmdline) {
+		if value, ok := strings.CutPrefix(field, "matchlock.user="); ok {
+			return value
+		}
+	}
+	return ""
+}
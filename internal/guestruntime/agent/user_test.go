@@ -0,0 +1,30 @@
+//go:build linux
+
+package guestagent
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDefaultUser(t *testing.T) {
+	assert.Equal(t, "", parseDefaultUser("console=ttyS0 matchlock.dns=8.8.8.8"))
+	assert.Equal(t, "appuser", parseDefaultUser("console=ttyS0 matchlock.user=appuser matchlock.dns=8.8.8.8"))
+	assert.Equal(t, "1000:1000", parseDefaultUser("matchlock.user=1000:1000"))
+}
+
+func TestApplyUserEnvDefaultsToImageUser(t *testing.T) {
+	defer func(prev string) { defaultUser = prev }(defaultUser)
+	defaultUser = "appuser"
+
+	cmd := exec.Command("true")
+	cmd.Env = []string{}
+	applyUserEnv(cmd, "")
+	assert.Equal(t, []string{"MATCHLOCK_USER=appuser"}, cmd.Env)
+
+	cmd.Env = []string{}
+	applyUserEnv(cmd, "0:0")
+	assert.Equal(t, []string{"MATCHLOCK_USER=0:0"}, cmd.Env)
+}
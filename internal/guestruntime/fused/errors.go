@@ -6,4 +6,9 @@ var (
 	ErrSocket  = errors.New("socket")
 	ErrConnect = errors.New("connect")
 	ErrEOF     = errors.New("EOF")
+
+	ErrConnectionLost = errors.New("VFS connection lost")
+
+	ErrUnknownEncoding = errors.New("unknown payload encoding")
+	ErrPayloadTooLarge = errors.New("payload too large")
 )
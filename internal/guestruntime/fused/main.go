@@ -3,10 +3,13 @@
 package guestfused
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -20,12 +23,22 @@ import (
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+	"github.com/klauspost/compress/zstd"
 )
 
 const (
 	AF_VSOCK        = 40
 	VMADDR_CID_HOST = 2
-	VsockPortVFS    = 5001
+
+	// logPrefix tags daemon diagnostics on the console so the host can
+	// attribute them (see api.ParseLogLine).
+	logPrefix = "[fused] "
+
+	// maxWriteChunk bounds the data in one OpWrite request, keeping frames
+	// well under the host's 16 MiB frame limit (pkg/vfs maxFrameSize).
+	maxWriteChunk = 1 << 20
 )
 
 // VFS protocol (must match pkg/vfs/server.go)
@@ -51,9 +64,25 @@ const (
 	OpSymlink
 	OpReadlink
 	OpLink
+	OpHello
+)
+
+// Payload encodings (must match pkg/vfs/compress.go). The client offers
+// every encoding it can decode in its OpHello handshake.
+const (
+	EncodingNone uint8 = iota
+	EncodingGzip
+	EncodingZstd
+
+	helloEncodings = 1<<EncodingGzip | 1<<EncodingZstd
+
+	// maxPayloadSize bounds a decompressed response payload, matching the
+	// host's frame limit.
+	maxPayloadSize = 16 << 20
 )
 
 type VFSRequest struct {
+	ID      uint64 `cbor:"id,omitempty"`
 	Op      OpCode `cbor:"op"`
 	Path    string `cbor:"path,omitempty"`
 	NewPath string `cbor:"new_path,omitempty"`
@@ -68,12 +97,14 @@ type VFSRequest struct {
 }
 
 type VFSResponse struct {
-	Err     int32         `cbor:"err"`
-	Stat    *VFSStat      `cbor:"stat,omitempty"`
-	Data    []byte        `cbor:"data,omitempty"`
-	Written uint32        `cbor:"written,omitempty"`
-	Handle  uint64        `cbor:"fh,omitempty"`
-	Entries []VFSDirEntry `cbor:"entries,omitempty"`
+	ID       uint64        `cbor:"id,omitempty"`
+	Err      int32         `cbor:"err"`
+	Stat     *VFSStat      `cbor:"stat,omitempty"`
+	Data     []byte        `cbor:"data,omitempty"`
+	Encoding uint8         `cbor:"enc,omitempty"`
+	Written  uint32        `cbor:"written,omitempty"`
+	Handle   uint64        `cbor:"fh,omitempty"`
+	Entries  []VFSDirEntry `cbor:"entries,omitempty"`
 }
 
 type VFSStat struct {
@@ -82,6 +113,10 @@ type VFSStat struct {
 	ModTime int64  `cbor:"mtime"`
 	IsDir   bool   `cbor:"is_dir"`
 	Ino     uint64 `cbor:"ino,omitempty"`
+	UID     uint32 `cbor:"uid,omitempty"`
+	GID     uint32 `cbor:"gid,omitempty"`
+	// Volatile is set for paths under watched mounts.
+	Volatile bool `cbor:"volatile,omitempty"`
 }
 
 type VFSDirEntry struct {
@@ -92,57 +127,233 @@ type VFSDirEntry struct {
 	Ino   uint64 `cbor:"ino,omitempty"`
 }
 
-// VFSClient communicates with host VFS server over vsock
+// VFSClient communicates with host VFS server over vsock. Requests carry
+// IDs and are pipelined: any number may be in flight on the connection, and
+// a reader goroutine hands each response to the request with its ID, so
+// concurrent FUSE operations are not serialized behind one round trip.
 type VFSClient struct {
-	fd int
-	mu sync.Mutex
+	writeMu sync.Mutex // serializes request frames
+
+	mu      sync.Mutex // guards the fields below
+	fd      int
+	gen     uint64              // bumped on every reconnect
+	redial  func() (int, error) // replaces a failed connection; nil disables
+	nextID  uint64
+	pending map[uint64]chan *VFSResponse
+	err     error // set once the current connection has failed
 }
 
 func NewVFSClient() (*VFSClient, error) {
-	fd, err := dialVsock(VMADDR_CID_HOST, VsockPortVFS)
+	vfsPort := vsockPortFromCmdline(vsock.ServiceVFS)
+	dial := func() (int, error) {
+		fd, err := dialVsock(VMADDR_CID_HOST, vfsPort)
+		if err != nil {
+			return -1, err
+		}
+		if err := helloVFS(fd); err != nil {
+			syscall.Close(fd)
+			return -1, err
+		}
+		return fd, nil
+	}
+	fd, err := dial()
 	if err != nil {
 		return nil, err
 	}
-	return &VFSClient{fd: fd}, nil
+	c := newVFSClient(fd)
+	c.redial = dial
+	return c, nil
 }
 
-func (c *VFSClient) Close() error {
-	return syscall.Close(c.fd)
+// helloVFS offers the host compressed reads on a fresh connection, before
+// any other request. The answer needs no handling: responses say how their
+// data is encoded, and a host that predates the handshake answers ENOSYS
+// and sends raw data.
+func helloVFS(fd int) error {
+	data, err := cbor.Marshal(&VFSRequest{Op: OpHello, Flags: helloEncodings})
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	if _, err := writeFull(fd, frame); err != nil {
+		return err
+	}
+	var lenBuf [4]byte
+	if _, err := readFull(fd, lenBuf[:]); err != nil {
+		return err
+	}
+	_, err = readFull(fd, make([]byte, binary.BigEndian.Uint32(lenBuf[:])))
+	return err
 }
 
-func (c *VFSClient) Request(req *VFSRequest) (*VFSResponse, error) {
+var zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+	return zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxPayloadSize))
+})
+
+// decodePayload expands a compressed response payload.
+func decodePayload(enc uint8, data []byte) ([]byte, error) {
+	switch enc {
+	case EncodingZstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return dec.DecodeAll(data, nil)
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out, err := io.ReadAll(io.LimitReader(zr, maxPayloadSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > maxPayloadSize {
+			return nil, errx.With(ErrPayloadTooLarge, ": over %d bytes", maxPayloadSize)
+		}
+		return out, nil
+	default:
+		return nil, errx.With(ErrUnknownEncoding, ": %d", enc)
+	}
+}
+
+func newVFSClient(fd int) *VFSClient {
+	c := &VFSClient{fd: fd, pending: make(map[uint64]chan *VFSResponse)}
+	go c.readLoop(fd, 0)
+	return c
+}
+
+func (c *VFSClient) Close() error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.redial = nil
+	fd := c.fd
+	c.mu.Unlock()
+	syscall.Shutdown(fd, syscall.SHUT_RDWR)
+	return syscall.Close(fd)
+}
 
-	data, err := cbor.Marshal(req)
+// reconnectLocked replaces a failed connection with a new one. Restoring a
+// VM snapshot resets the guest's vsock transport, which drops the
+// connection while a fresh host VFS server is waiting for the next one.
+// Requests that were in flight have already failed.
+func (c *VFSClient) reconnectLocked() bool {
+	if c.redial == nil {
+		return false
+	}
+	fd, err := c.redial()
 	if err != nil {
+		return false
+	}
+	syscall.Close(c.fd)
+	c.fd = fd
+	c.gen++
+	c.err = nil
+	go c.readLoop(fd, c.gen)
+	return true
+}
+
+func (c *VFSClient) Request(req *VFSRequest) (*VFSResponse, error) {
+	ch := make(chan *VFSResponse, 1)
+	c.mu.Lock()
+	if c.err != nil && !c.reconnectLocked() {
+		err := c.err
+		c.mu.Unlock()
 		return nil, err
 	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	fd := c.fd
+	c.mu.Unlock()
 
-	var lenBuf [4]byte
-	binary.BigEndian.PutUint32(lenBuf[:], uint32(len(data)))
-	if _, err := writeFull(c.fd, lenBuf[:]); err != nil {
+	wire := *req
+	wire.ID = id
+	data, err := cbor.Marshal(&wire)
+	if err != nil {
+		c.forget(id)
 		return nil, err
 	}
-	if _, err := writeFull(c.fd, data); err != nil {
+
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	c.writeMu.Lock()
+	_, err = writeFull(fd, frame)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.forget(id)
 		return nil, err
 	}
 
-	if _, err := readFull(c.fd, lenBuf[:]); err != nil {
-		return nil, err
+	resp := <-ch
+	if resp == nil {
+		// The connection failed; it may already have been replaced, so
+		// c.err no longer describes this request.
+		return nil, ErrConnectionLost
 	}
-	respLen := binary.BigEndian.Uint32(lenBuf[:])
+	return resp, nil
+}
 
-	respData := make([]byte, respLen)
-	if _, err := readFull(c.fd, respData); err != nil {
-		return nil, err
+func (c *VFSClient) forget(id uint64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// readLoop delivers responses to their requests until connection fd
+// fails, then fails every pending request with that error. Later requests
+// get the error too unless the client can reconnect.
+func (c *VFSClient) readLoop(fd int, gen uint64) {
+	var lenBuf [4]byte
+	for {
+		if _, err := readFull(fd, lenBuf[:]); err != nil {
+			c.fail(gen, err)
+			return
+		}
+		respData := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+		if _, err := readFull(fd, respData); err != nil {
+			c.fail(gen, err)
+			return
+		}
+
+		var resp VFSResponse
+		if err := cbor.Unmarshal(respData, &resp); err != nil {
+			c.fail(gen, err)
+			return
+		}
+		if resp.Encoding != EncodingNone {
+			if data, err := decodePayload(resp.Encoding, resp.Data); err != nil {
+				fmt.Fprintf(os.Stderr, logPrefix+"decode response payload: %v\n", err)
+				resp.Err, resp.Data = -int32(syscall.EIO), nil
+			} else {
+				resp.Data = data
+			}
+			resp.Encoding = EncodingNone
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[resp.ID]
+		delete(c.pending, resp.ID)
+		c.mu.Unlock()
+		if ok {
+			ch <- &resp
+		}
 	}
+}
 
-	var resp VFSResponse
-	if err := cbor.Unmarshal(respData, &resp); err != nil {
-		return nil, err
+func (c *VFSClient) fail(gen uint64, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	c.err = err
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
 	}
-	return &resp, nil
 }
 
 func (c *VFSClient) RequestCtx(ctx context.Context, req *VFSRequest) (*VFSResponse, error) {
@@ -170,6 +381,8 @@ var _ = (fs.NodeCreater)((*VFSRoot)(nil))
 var _ = (fs.NodeUnlinker)((*VFSRoot)(nil))
 var _ = (fs.NodeRmdirer)((*VFSRoot)(nil))
 var _ = (fs.NodeRenamer)((*VFSRoot)(nil))
+var _ = (fs.NodeSymlinker)((*VFSRoot)(nil))
+var _ = (fs.NodeLinker)((*VFSRoot)(nil))
 
 // VFSNode represents a file or directory in the VFS
 type VFSNode struct {
@@ -189,6 +402,9 @@ var _ = (fs.NodeUnlinker)((*VFSNode)(nil))
 var _ = (fs.NodeRmdirer)((*VFSNode)(nil))
 var _ = (fs.NodeRenamer)((*VFSNode)(nil))
 var _ = (fs.NodeSetattrer)((*VFSNode)(nil))
+var _ = (fs.NodeSymlinker)((*VFSNode)(nil))
+var _ = (fs.NodeLinker)((*VFSNode)(nil))
+var _ = (fs.NodeReadlinker)((*VFSNode)(nil))
 
 func (r *VFSRoot) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
 	resp, err := r.client.RequestCtx(ctx, &VFSRequest{Op: OpGetattr, Path: r.basePath})
@@ -199,6 +415,9 @@ func (r *VFSRoot) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrO
 		return syscall.Errno(-resp.Err)
 	}
 	fillAttr(&out.Attr, resp.Stat)
+	if volatile(resp.Stat) {
+		out.SetTimeout(volatileTimeout)
+	}
 	return 0
 }
 
@@ -213,6 +432,10 @@ func (r *VFSRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (
 	}
 
 	fillAttr(&out.Attr, resp.Stat)
+	if volatile(resp.Stat) {
+		out.SetAttrTimeout(volatileTimeout)
+		out.SetEntryTimeout(volatileTimeout)
+	}
 	if out.Attr.Ino == 0 {
 		isDir := resp.Stat != nil && resp.Stat.IsDir
 		out.Attr.Ino = inodeForPath(path, isDir)
@@ -235,10 +458,7 @@ func (r *VFSRoot) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 
 	entries := make([]fuse.DirEntry, len(resp.Entries))
 	for i, e := range resp.Entries {
-		mode := uint32(syscall.S_IFREG)
-		if e.IsDir {
-			mode = syscall.S_IFDIR
-		}
+		mode := direntMode(e)
 		ino := e.Ino
 		if ino == 0 {
 			ino = inodeForPath(filepath.Join(r.basePath, e.Name), e.IsDir)
@@ -337,6 +557,14 @@ func (r *VFSRoot) Rename(ctx context.Context, name string, newParent fs.InodeEmb
 	return 0
 }
 
+func (r *VFSRoot) Symlink(ctx context.Context, target, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	return symlinkAt(ctx, &r.Inode, r.client, r.basePath, target, name, out)
+}
+
+func (r *VFSRoot) Link(ctx context.Context, target fs.InodeEmbedder, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	return linkAt(ctx, &r.Inode, r.client, r.basePath, target, name, out)
+}
+
 // VFSNode implementations
 
 func (n *VFSNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
@@ -348,6 +576,9 @@ func (n *VFSNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrO
 		return syscall.Errno(-resp.Err)
 	}
 	fillAttr(&out.Attr, resp.Stat)
+	if volatile(resp.Stat) {
+		out.SetTimeout(volatileTimeout)
+	}
 	return 0
 }
 
@@ -403,6 +634,10 @@ func (n *VFSNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (
 	}
 
 	fillAttr(&out.Attr, resp.Stat)
+	if volatile(resp.Stat) {
+		out.SetAttrTimeout(volatileTimeout)
+		out.SetEntryTimeout(volatileTimeout)
+	}
 	if out.Attr.Ino == 0 {
 		isDir := resp.Stat != nil && resp.Stat.IsDir
 		out.Attr.Ino = inodeForPath(path, isDir)
@@ -425,10 +660,7 @@ func (n *VFSNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 
 	entries := make([]fuse.DirEntry, len(resp.Entries))
 	for i, e := range resp.Entries {
-		mode := uint32(syscall.S_IFREG)
-		if e.IsDir {
-			mode = syscall.S_IFDIR
-		}
+		mode := direntMode(e)
 		ino := e.Ino
 		if ino == 0 {
 			ino = inodeForPath(filepath.Join(n.path, e.Name), e.IsDir)
@@ -538,6 +770,73 @@ func (n *VFSNode) Rename(ctx context.Context, name string, newParent fs.InodeEmb
 	return 0
 }
 
+func (n *VFSNode) Symlink(ctx context.Context, target, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	return symlinkAt(ctx, &n.Inode, n.client, n.path, target, name, out)
+}
+
+func (n *VFSNode) Link(ctx context.Context, target fs.InodeEmbedder, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	return linkAt(ctx, &n.Inode, n.client, n.path, target, name, out)
+}
+
+func (n *VFSNode) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	resp, err := n.client.RequestCtx(ctx, &VFSRequest{Op: OpReadlink, Path: n.path})
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	if resp.Err != 0 {
+		return nil, syscall.Errno(-resp.Err)
+	}
+	return resp.Data, 0
+}
+
+// symlinkAt creates name in the directory dir as a symlink to target. The
+// host stores target as is; the guest kernel resolves it.
+func symlinkAt(ctx context.Context, parent *fs.Inode, client *VFSClient, dir, target, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	path := filepath.Join(dir, name)
+	resp, err := client.RequestCtx(ctx, &VFSRequest{Op: OpSymlink, Path: path, NewPath: target})
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	if resp.Err != 0 {
+		return nil, syscall.Errno(-resp.Err)
+	}
+
+	fillEntryAttr(out, resp.Stat, entryAttrDefaults{
+		mode: syscall.S_IFLNK | 0777,
+		ino:  inodeForPath(path, false),
+	})
+	if resp.Stat == nil {
+		out.Attr.Size = uint64(len(target))
+	}
+	node := &VFSNode{client: client, path: path}
+	stable := fs.StableAttr{Mode: out.Attr.Mode, Ino: out.Attr.Ino}
+	return parent.NewInode(ctx, node, stable), 0
+}
+
+// linkAt adds name in the directory dir as a hard link to target.
+func linkAt(ctx context.Context, parent *fs.Inode, client *VFSClient, dir string, target fs.InodeEmbedder, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	src, ok := target.(*VFSNode)
+	if !ok || src.isDir {
+		return nil, syscall.EPERM
+	}
+	path := filepath.Join(dir, name)
+	resp, err := client.RequestCtx(ctx, &VFSRequest{Op: OpLink, Path: src.path, NewPath: path})
+	if err != nil {
+		return nil, syscall.EIO
+	}
+	if resp.Err != 0 {
+		return nil, syscall.Errno(-resp.Err)
+	}
+
+	fillEntryAttr(out, resp.Stat, entryAttrDefaults{
+		mode: syscall.S_IFREG | 0644,
+		ino:  inodeForPath(path, false),
+	})
+	node := &VFSNode{client: client, path: path}
+	stable := fs.StableAttr{Mode: out.Attr.Mode, Ino: out.Attr.Ino}
+	return parent.NewInode(ctx, node, stable), 0
+}
+
 // VFSFileHandle handles read/write operations on open files
 type VFSFileHandle struct {
 	client *VFSClient
@@ -567,12 +866,36 @@ func (h *VFSFileHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.
 	return fuse.ReadResultData(resp.Data), 0
 }
 
+// Write sends data in chunks of at most maxWriteChunk bytes and resends
+// whatever the host did not write. On an error after some bytes were
+// written, it reports the short count, as write(2) does.
 func (h *VFSFileHandle) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	var written uint32
+	for len(data) > 0 {
+		chunk := data
+		if len(chunk) > maxWriteChunk {
+			chunk = chunk[:maxWriteChunk]
+		}
+		n, errno := h.writeChunk(ctx, chunk, off)
+		if errno != 0 {
+			if written > 0 {
+				return written, 0
+			}
+			return 0, errno
+		}
+		written += n
+		data = data[n:]
+		off += int64(n)
+	}
+	return written, 0
+}
+
+func (h *VFSFileHandle) writeChunk(ctx context.Context, chunk []byte, off int64) (uint32, syscall.Errno) {
 	resp, err := h.client.RequestCtx(ctx, &VFSRequest{
 		Op:     OpWrite,
 		Handle: h.handle,
 		Offset: off,
-		Data:   data,
+		Data:   chunk,
 	})
 	if err != nil {
 		return 0, syscall.EIO
@@ -580,6 +903,10 @@ func (h *VFSFileHandle) Write(ctx context.Context, data []byte, off int64) (uint
 	if resp.Err != 0 {
 		return 0, syscall.Errno(-resp.Err)
 	}
+	// A zero or impossible count would loop forever or skip data.
+	if resp.Written == 0 || int(resp.Written) > len(chunk) {
+		return 0, syscall.EIO
+	}
 	return resp.Written, 0
 }
 
@@ -608,6 +935,9 @@ func (h *VFSFileHandle) Getattr(ctx context.Context, out *fuse.AttrOut) syscall.
 		return syscall.Errno(-resp.Err)
 	}
 	fillAttr(&out.Attr, resp.Stat)
+	if volatile(resp.Stat) {
+		out.SetTimeout(volatileTimeout)
+	}
 	return 0
 }
 
@@ -622,15 +952,48 @@ func fillAttr(attr *fuse.Attr, stat *VFSStat) {
 	attr.Blksize = 4096
 	attr.Blocks = (uint64(stat.Size) + 511) / 512
 	attr.Ino = stat.Ino
-	if stat.IsDir {
+	attr.Uid = stat.UID
+	attr.Gid = stat.GID
+	switch {
+	case stat.IsDir:
 		attr.Mode = syscall.S_IFDIR | (stat.Mode & 0777)
 		attr.Nlink = 2
-	} else {
+	case isSymlinkMode(stat.Mode):
+		attr.Mode = syscall.S_IFLNK | 0777
+		attr.Nlink = 1
+	default:
 		attr.Mode = syscall.S_IFREG | (stat.Mode & 0777)
 		attr.Nlink = 1
 	}
 }
 
+// isSymlinkMode reports whether a VFSStat or VFSDirEntry mode (host
+// os.FileMode bits) describes a symlink.
+func isSymlinkMode(mode uint32) bool {
+	return os.FileMode(mode)&os.ModeSymlink != 0
+}
+
+// direntMode returns the file type bits for a directory entry.
+func direntMode(e VFSDirEntry) uint32 {
+	switch {
+	case e.IsDir:
+		return syscall.S_IFDIR
+	case isSymlinkMode(e.Mode):
+		return syscall.S_IFLNK
+	default:
+		return syscall.S_IFREG
+	}
+}
+
+// volatileTimeout is the attr/entry cache lifetime for watched mounts. go-fuse
+// treats zero as "use the mount default", so the smallest nonzero value is
+// used to make the kernel revalidate on every access.
+const volatileTimeout = time.Nanosecond
+
+func volatile(stat *VFSStat) bool {
+	return stat != nil && stat.Volatile
+}
+
 type entryAttrDefaults struct {
 	mode  uint32
 	ino   uint64
@@ -737,17 +1100,24 @@ func writeFull(fd int, buf []byte) (int, error) {
 	return total, nil
 }
 
+// vsockPortFromCmdline returns the port the host assigned to service via
+// matchlock.vsock_ports=, or its default.
+func vsockPortFromCmdline(service string) uint32 {
+	data, _ := os.ReadFile("/proc/cmdline")
+	return vsock.ParsePorts(string(data)).Port(service)
+}
+
 func getWorkspaceFromCmdline() string {
 	data, err := os.ReadFile("/proc/cmdline")
 	if err != nil {
-		return "/workspace"
+		return api.DefaultWorkspace
 	}
 	for _, part := range strings.Fields(string(data)) {
 		if strings.HasPrefix(part, "matchlock.workspace=") {
 			return strings.TrimPrefix(part, "matchlock.workspace=")
 		}
 	}
-	return "/workspace"
+	return api.DefaultWorkspace
 }
 
 func Run() {
@@ -757,10 +1127,10 @@ func Run() {
 		mountpoint = os.Args[1]
 	}
 
-	fmt.Printf("Guest FUSE daemon (go-fuse) starting, mounting at %s...\n", mountpoint)
+	fmt.Printf(logPrefix+"Guest FUSE daemon (go-fuse) starting, mounting at %s...\n", mountpoint)
 
 	if err := os.MkdirAll(mountpoint, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to create mountpoint: %v\n", err)
+		fmt.Fprintf(os.Stderr, logPrefix+"Failed to create mountpoint: %v\n", err)
 		os.Exit(1)
 	}
 
@@ -775,11 +1145,11 @@ func Run() {
 		time.Sleep(100 * time.Millisecond)
 	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to connect to VFS server: %v\n", err)
+		fmt.Fprintf(os.Stderr, logPrefix+"Failed to connect to VFS server: %v\n", err)
 		os.Exit(1)
 	}
 	defer client.Close()
-	fmt.Println("Connected to VFS server")
+	fmt.Println(logPrefix + "Connected to VFS server")
 
 	// Create root node - basePath must match the VFS mount configuration on host
 	root := &VFSRoot{client: client, basePath: mountpoint}
@@ -799,11 +1169,11 @@ func Run() {
 
 	server, err := fs.Mount(mountpoint, root, opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to mount: %v\n", err)
+		fmt.Fprintf(os.Stderr, logPrefix+"Failed to mount: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("FUSE filesystem mounted at %s\n", mountpoint)
+	fmt.Printf(logPrefix+"FUSE filesystem mounted at %s\n", mountpoint)
 
 	// Handle signals for graceful shutdown
 	sigCh := make(chan os.Signal, 1)
@@ -811,7 +1181,7 @@ func Run() {
 
 	go func() {
 		<-sigCh
-		fmt.Println("Shutting down...")
+		fmt.Println(logPrefix + "Shutting down...")
 		server.Unmount()
 	}()
 
@@ -1,6 +1,7 @@
 package guestfused
 
 import (
+	"os"
 	"syscall"
 	"testing"
 
@@ -23,6 +24,21 @@ func TestFillAttrIncludesInode(t *testing.T) {
 	assert.Equal(t, uint32(2), attr.Nlink)
 }
 
+func TestFillAttrSymlink(t *testing.T) {
+	var attr fuse.Attr
+	fillAttr(&attr, &VFSStat{Size: 9, Mode: uint32(os.ModeSymlink | 0777), Ino: 7})
+
+	assert.Equal(t, uint32(syscall.S_IFLNK|0777), attr.Mode)
+	assert.Equal(t, uint64(9), attr.Size)
+	assert.Equal(t, uint32(1), attr.Nlink)
+}
+
+func TestDirentMode(t *testing.T) {
+	assert.Equal(t, uint32(syscall.S_IFDIR), direntMode(VFSDirEntry{IsDir: true, Mode: uint32(os.ModeDir)}))
+	assert.Equal(t, uint32(syscall.S_IFLNK), direntMode(VFSDirEntry{Mode: uint32(os.ModeSymlink)}))
+	assert.Equal(t, uint32(syscall.S_IFREG), direntMode(VFSDirEntry{}))
+}
+
 func TestFillEntryAttrFallbackUsesProvidedInode(t *testing.T) {
 	var out fuse.EntryOut
 	fillEntryAttr(&out, nil, entryAttrDefaults{
@@ -0,0 +1,246 @@
+package guestfused
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/vfs"
+)
+
+// slowStatProvider adds a fixed delay to Stat to stand in for host-side
+// filesystem latency, which is what pipelining overlaps.
+type slowStatProvider struct {
+	vfs.Provider
+	delay time.Duration
+}
+
+func (p slowStatProvider) Stat(path string) (vfs.FileInfo, error) {
+	time.Sleep(p.delay)
+	return p.Provider.Stat(path)
+}
+
+func newTestVFSClient(t testing.TB, provider vfs.Provider) *VFSClient {
+	t.Helper()
+	return newTestVFSClientWithServer(t, vfs.NewVFSServer(provider), false)
+}
+
+// newTestVFSClientWithServer connects a client to server, saying hello
+// first when hello is set, as NewVFSClient does.
+func newTestVFSClientWithServer(t testing.TB, server *vfs.VFSServer, hello bool) *VFSClient {
+	t.Helper()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+
+	f := os.NewFile(uintptr(fds[1]), "vfs-server")
+	conn, err := net.FileConn(f)
+	f.Close()
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		server.HandleConnection(conn)
+		close(done)
+	}()
+
+	if hello {
+		require.NoError(t, helloVFS(fds[0]))
+	}
+	client := newVFSClient(fds[0])
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	return client
+}
+
+func populatedProvider(t testing.TB, n int) vfs.Provider {
+	t.Helper()
+	p := vfs.NewMemoryProvider()
+	for i := 0; i < n; i++ {
+		require.NoError(t, p.WriteFile(fmt.Sprintf("/f%d", i), []byte(fmt.Sprintf("file %d", i)), 0644))
+	}
+	return p
+}
+
+func TestVFSClientPipelinedRequestsGetOwnResponses(t *testing.T) {
+	client := newTestVFSClient(t, populatedProvider(t, 100))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Request(&VFSRequest{Op: OpGetattr, Path: fmt.Sprintf("/f%d", i)})
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Zero(t, resp.Err)
+			if assert.NotNil(t, resp.Stat) {
+				assert.Equal(t, int64(len(fmt.Sprintf("file %d", i))), resp.Stat.Size)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	resp, err := client.Request(&VFSRequest{Op: OpGetattr, Path: "/missing"})
+	require.NoError(t, err)
+	assert.Equal(t, -int32(syscall.ENOENT), resp.Err)
+}
+
+func TestVFSClientFailsRequestsAfterClose(t *testing.T) {
+	client := newTestVFSClient(t, vfs.NewMemoryProvider())
+	require.NoError(t, syscall.Shutdown(client.fd, syscall.SHUT_RDWR))
+
+	_, err := client.Request(&VFSRequest{Op: OpGetattr, Path: "/"})
+	require.Error(t, err)
+}
+
+func TestVFSClientReconnectsAfterConnectionLoss(t *testing.T) {
+	provider := vfs.NewMemoryProvider()
+	require.NoError(t, provider.WriteFile("/hello", []byte("hi"), 0644))
+	serve := func() int {
+		fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+		require.NoError(t, err)
+		f := os.NewFile(uintptr(fds[1]), "vfs-server")
+		conn, err := net.FileConn(f)
+		f.Close()
+		require.NoError(t, err)
+		go vfs.NewVFSServer(provider).HandleConnection(conn)
+		return fds[0]
+	}
+
+	client := newVFSClient(serve())
+	client.redial = func() (int, error) { return serve(), nil }
+	t.Cleanup(func() { client.Close() })
+
+	// Simulate the vsock reset a snapshot restore causes.
+	client.mu.Lock()
+	fd := client.fd
+	client.mu.Unlock()
+	require.NoError(t, syscall.Shutdown(fd, syscall.SHUT_RDWR))
+	require.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.err != nil
+	}, time.Second, 10*time.Millisecond)
+
+	resp, err := client.Request(&VFSRequest{Op: OpGetattr, Path: "/hello"})
+	require.NoError(t, err)
+	require.Zero(t, resp.Err)
+	assert.Equal(t, int64(2), resp.Stat.Size)
+}
+
+func TestVFSClientDecodesCompressedReads(t *testing.T) {
+	data := bytes.Repeat([]byte("2024-01-01T00:00:00Z INFO request served path=/api/items\n"), 4096)
+	provider := vfs.NewMemoryProvider()
+	require.NoError(t, provider.WriteFile("/app.log", data, 0644))
+
+	for _, hello := range []bool{true, false} {
+		client := newTestVFSClientWithServer(t, vfs.NewVFSServer(provider, vfs.WithCompression(4096)), hello)
+		open, err := client.Request(&VFSRequest{Op: OpOpen, Path: "/app.log"})
+		require.NoError(t, err)
+		require.Zero(t, open.Err)
+
+		resp, err := client.Request(&VFSRequest{Op: OpRead, Handle: open.Handle, Size: uint32(len(data))})
+		require.NoError(t, err)
+		require.Zero(t, resp.Err)
+		assert.Equal(t, EncodingNone, resp.Encoding)
+		assert.True(t, bytes.Equal(data, resp.Data), "hello=%v", hello)
+	}
+}
+
+func TestHelloVFSAgainstServerWithoutHandshake(t *testing.T) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	// An older host answers the unknown op with ENOSYS.
+	go func() {
+		var lenBuf [4]byte
+		if _, err := readFull(fds[1], lenBuf[:]); err != nil {
+			return
+		}
+		if _, err := readFull(fds[1], make([]byte, binary.BigEndian.Uint32(lenBuf[:]))); err != nil {
+			return
+		}
+		body, _ := cbor.Marshal(&VFSResponse{Err: -int32(syscall.ENOSYS)})
+		frame := binary.BigEndian.AppendUint32(nil, uint32(len(body)))
+		writeFull(fds[1], append(frame, body...))
+	}()
+
+	require.NoError(t, helloVFS(fds[0]))
+}
+
+func TestVFSFileHandleWriteLargerThanFrameLimit(t *testing.T) {
+	provider := vfs.NewMemoryProvider()
+	client := newTestVFSClient(t, provider)
+
+	resp, err := client.Request(&VFSRequest{Op: OpCreate, Path: "/big", Mode: 0644})
+	require.NoError(t, err)
+	require.Zero(t, resp.Err)
+	h := &VFSFileHandle{client: client, handle: resp.Handle, path: "/big"}
+
+	// Larger than the host's 16 MiB frame limit and not chunk aligned.
+	data := make([]byte, 16<<20+maxWriteChunk/2+7)
+	for i := range data {
+		data[i] = byte(i * 31)
+	}
+	n, errno := h.Write(context.Background(), data, 5)
+	require.Zero(t, errno)
+	assert.Equal(t, uint32(len(data)), n)
+
+	got, err := provider.ReadFile("/big")
+	require.NoError(t, err)
+	require.Len(t, got, len(data)+5)
+	assert.True(t, bytes.Equal(data, got[5:]), "written data differs")
+}
+
+// BenchmarkStat1000Files stats 1000 files per iteration with a varying
+// number of concurrent callers, as the multithreaded FUSE server does.
+func BenchmarkStat1000Files(b *testing.B) {
+	const files = 1000
+	for _, workers := range []int{1, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			provider := slowStatProvider{Provider: populatedProvider(b, files), delay: 20 * time.Microsecond}
+			client := newTestVFSClient(b, provider)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				paths := make(chan string, files)
+				for j := 0; j < files; j++ {
+					paths <- fmt.Sprintf("/f%d", j)
+				}
+				close(paths)
+
+				var wg sync.WaitGroup
+				for w := 0; w < workers; w++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for path := range paths {
+							resp, err := client.Request(&VFSRequest{Op: OpGetattr, Path: path})
+							if err != nil || resp.Err != 0 {
+								b.Errorf("stat %s: err=%v errno=%d", path, err, resp.Err)
+								return
+							}
+						}
+					}()
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
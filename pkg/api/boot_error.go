@@ -0,0 +1,68 @@
+package api
+
+import "strings"
+
+// BootErrorMarker starts the line guest-init writes to the console when boot
+// fails, followed by a BootErrorCode and a message:
+//
+//	[init] MATCHLOCK_BOOT_ERROR: missing_dns missing matchlock.dns
+const BootErrorMarker = "MATCHLOCK_BOOT_ERROR:"
+
+// BootErrorCode identifies why guest-init failed to boot.
+type BootErrorCode string
+
+const (
+	BootErrorMissingDNS         BootErrorCode = "missing_dns"
+	BootErrorWorkspaceMountWait BootErrorCode = "workspace_mount_timeout"
+	BootErrorExecGuestAgent     BootErrorCode = "exec_guest_agent"
+	BootErrorStartGuestFused    BootErrorCode = "start_guest_fused"
+	BootErrorOverlayRoot        BootErrorCode = "overlay_root"
+	BootErrorResolveUser        BootErrorCode = "resolve_user"
+	BootErrorNetworkUnreachable BootErrorCode = "network_unreachable"
+	BootErrorInitFailed         BootErrorCode = "init_failed"
+)
+
+var bootErrorKinds = map[BootErrorCode]error{
+	BootErrorMissingDNS:         ErrBootMissingDNS,
+	BootErrorWorkspaceMountWait: ErrBootWorkspaceMountWait,
+	BootErrorExecGuestAgent:     ErrBootExecGuestAgent,
+	BootErrorStartGuestFused:    ErrBootStartGuestFused,
+	BootErrorOverlayRoot:        ErrBootOverlayRoot,
+	BootErrorResolveUser:        ErrBootResolveUser,
+	BootErrorNetworkUnreachable: ErrBootNetworkUnreachable,
+}
+
+// BootError is a guest-init boot failure reported on the console. It
+// matches ErrBootFailed and, for known codes, the code's ErrBoot* sentinel
+// with errors.Is.
+type BootError struct {
+	Code    BootErrorCode `json:"code"`
+	Message string        `json:"message"`
+}
+
+func (e *BootError) Error() string {
+	return "guest boot failed (" + string(e.Code) + "): " + e.Message
+}
+
+func (e *BootError) Is(target error) bool {
+	return target == ErrBootFailed
+}
+
+func (e *BootError) Unwrap() error {
+	return bootErrorKinds[e.Code]
+}
+
+// ParseBootError extracts a boot error from a console log line, with or
+// without its "[init] " source prefix. It returns nil for any other line.
+func ParseBootError(line string) *BootError {
+	text := ParseLogLine(line).Text
+	rest, ok := strings.CutPrefix(text, BootErrorMarker)
+	if !ok {
+		return nil
+	}
+	code, message, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	if code == "" {
+		return nil
+	}
+	return &BootError{Code: BootErrorCode(code), Message: message}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBootError(t *testing.T) {
+	bootErr := ParseBootError("[init] MATCHLOCK_BOOT_ERROR: exec_guest_agent exec guest-agent: no such file or directory\n")
+	require.NotNil(t, bootErr)
+	assert.Equal(t, BootErrorExecGuestAgent, bootErr.Code)
+	assert.Equal(t, "exec guest-agent: no such file or directory", bootErr.Message)
+	assert.ErrorIs(t, bootErr, ErrBootExecGuestAgent)
+	assert.ErrorIs(t, bootErr, ErrBootFailed)
+	assert.NotErrorIs(t, bootErr, ErrBootMissingDNS)
+
+	unknown := ParseBootError("MATCHLOCK_BOOT_ERROR: something_new boom")
+	require.NotNil(t, unknown)
+	assert.ErrorIs(t, unknown, ErrBootFailed)
+
+	assert.Nil(t, ParseBootError("[init] WARNING: swap disabled"))
+	assert.Nil(t, ParseBootError("[init] MATCHLOCK_BOOT_ERROR:"))
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// CapabilityAll expands to every known capability in CapAdd/CapDrop.
+const CapabilityAll = "ALL"
+
+// capabilityNumbers maps Linux capability names (without the CAP_ prefix) to
+// their numbers from linux/capability.h.
+var capabilityNumbers = map[string]int{
+	"CHOWN":              0,
+	"DAC_OVERRIDE":       1,
+	"DAC_READ_SEARCH":    2,
+	"FOWNER":             3,
+	"FSETID":             4,
+	"KILL":               5,
+	"SETGID":             6,
+	"SETUID":             7,
+	"SETPCAP":            8,
+	"LINUX_IMMUTABLE":    9,
+	"NET_BIND_SERVICE":   10,
+	"NET_BROADCAST":      11,
+	"NET_ADMIN":          12,
+	"NET_RAW":            13,
+	"IPC_LOCK":           14,
+	"IPC_OWNER":          15,
+	"SYS_MODULE":         16,
+	"SYS_RAWIO":          17,
+	"SYS_CHROOT":         18,
+	"SYS_PTRACE":         19,
+	"SYS_PACCT":          20,
+	"SYS_ADMIN":          21,
+	"SYS_BOOT":           22,
+	"SYS_NICE":           23,
+	"SYS_RESOURCE":       24,
+	"SYS_TIME":           25,
+	"SYS_TTY_CONFIG":     26,
+	"MKNOD":              27,
+	"LEASE":              28,
+	"AUDIT_WRITE":        29,
+	"AUDIT_CONTROL":      30,
+	"SETFCAP":            31,
+	"MAC_OVERRIDE":       32,
+	"MAC_ADMIN":          33,
+	"SYSLOG":             34,
+	"WAKE_ALARM":         35,
+	"BLOCK_SUSPEND":      36,
+	"AUDIT_READ":         37,
+	"PERFMON":            38,
+	"BPF":                39,
+	"CHECKPOINT_RESTORE": 40,
+}
+
+// DefaultDroppedCapabilities are removed from the bounding set of every
+// non-privileged guest command. CapAdd can keep them; each one re-opens an
+// escape or host-interference vector that the guest seccomp filter and cap
+// drop exist to close, so only add them for trusted workloads:
+//
+//   - SYS_PTRACE: ptrace and process_vm_readv/writev (also unblocks them in seccomp)
+//   - SYS_ADMIN: mounts, namespaces, bpf and most other admin operations
+//   - SYS_MODULE: kernel module loading
+//   - SYS_RAWIO: raw I/O port and device access
+//   - SYS_BOOT: reboot and kexec_load (also unblocks kexec in seccomp)
+var DefaultDroppedCapabilities = []string{"SYS_PTRACE", "SYS_ADMIN", "SYS_MODULE", "SYS_RAWIO", "SYS_BOOT"}
+
+// IsDangerousCapability reports whether name is one of the
+// DefaultDroppedCapabilities.
+func IsDangerousCapability(name string) bool {
+	normalized, err := NormalizeCapability(name)
+	if err != nil {
+		return false
+	}
+	for _, c := range DefaultDroppedCapabilities {
+		if c == normalized {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeCapability canonicalizes a capability name: case-insensitive, with
+// an optional CAP_ prefix (e.g. "cap_net_raw" -> "NET_RAW").
+func NormalizeCapability(name string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(name))
+	normalized = strings.TrimPrefix(normalized, "CAP_")
+	if normalized == CapabilityAll {
+		return normalized, nil
+	}
+	if _, ok := capabilityNumbers[normalized]; !ok {
+		return "", errx.With(ErrInvalidCapability, ": %q", name)
+	}
+	return normalized, nil
+}
+
+// CapabilityNumbers validates capability names and returns their sorted,
+// de-duplicated numbers. "ALL" expands to every known capability.
+func CapabilityNumbers(names []string) ([]int, error) {
+	seen := make(map[int]bool)
+	for _, name := range names {
+		normalized, err := NormalizeCapability(name)
+		if err != nil {
+			return nil, err
+		}
+		if normalized == CapabilityAll {
+			for _, n := range capabilityNumbers {
+				seen[n] = true
+			}
+			continue
+		}
+		seen[capabilityNumbers[normalized]] = true
+	}
+	if len(seen) == 0 {
+		return nil, nil
+	}
+	numbers := make([]int, 0, len(seen))
+	for n := range seen {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
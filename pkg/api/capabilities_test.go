@@ -0,0 +1,43 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeCapability(t *testing.T) {
+	for _, name := range []string{"NET_RAW", "net_raw", "CAP_NET_RAW", " cap_net_raw "} {
+		normalized, err := NormalizeCapability(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, "NET_RAW", normalized)
+	}
+
+	_, err := NormalizeCapability("NET_MAGIC")
+	require.ErrorIs(t, err, ErrInvalidCapability)
+}
+
+func TestCapabilityNumbers(t *testing.T) {
+	numbers, err := CapabilityNumbers([]string{"SYS_PTRACE", "net_raw", "CAP_SYS_PTRACE"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{13, 19}, numbers)
+
+	numbers, err = CapabilityNumbers([]string{"all"})
+	require.NoError(t, err)
+	assert.Len(t, numbers, len(capabilityNumbers))
+
+	numbers, err = CapabilityNumbers(nil)
+	require.NoError(t, err)
+	assert.Nil(t, numbers)
+
+	_, err = CapabilityNumbers([]string{"NET_RAW", "bogus"})
+	require.ErrorIs(t, err, ErrInvalidCapability)
+}
+
+func TestIsDangerousCapability(t *testing.T) {
+	assert.True(t, IsDangerousCapability("cap_sys_admin"))
+	assert.True(t, IsDangerousCapability("SYS_PTRACE"))
+	assert.False(t, IsDangerousCapability("NET_RAW"))
+	assert.False(t, IsDangerousCapability("bogus"))
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// CgroupParentEnv supplies Resources.CgroupParent on Linux hosts when the
+// config leaves it empty.
+const CgroupParentEnv = "MATCHLOCK_CGROUP_PARENT"
+
+// ValidateCgroupParent checks a Resources.CgroupParent path. It names a
+// cgroup relative to the host's cgroup v2 mount, e.g. "matchlock.slice" or
+// "/system.slice/matchlock.slice", and may not climb out of it.
+func ValidateCgroupParent(parent string) error {
+	if parent == "" {
+		return nil
+	}
+	for _, part := range strings.Split(strings.Trim(parent, "/"), "/") {
+		if part == "" || part == "." || part == ".." {
+			return errx.With(ErrInvalidCgroupParent, ": %q", parent)
+		}
+	}
+	return nil
+}
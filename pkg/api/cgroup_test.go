@@ -0,0 +1,16 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCgroupParent(t *testing.T) {
+	for _, parent := range []string{"", "matchlock.slice", "/system.slice/matchlock.slice", "kubepods/burstable/"} {
+		assert.NoError(t, ValidateCgroupParent(parent), parent)
+	}
+	for _, parent := range []string{"/", "a//b", "../etc", "matchlock/../../x", "./a"} {
+		assert.ErrorIs(t, ValidateCgroupParent(parent), ErrInvalidCgroupParent, parent)
+	}
+}
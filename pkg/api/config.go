@@ -19,6 +19,15 @@ const (
 	DefaultTimeoutSeconds         = 300
 	DefaultNetworkMTU             = 1500
 	DefaultGracefulShutdownPeriod = 0
+	// DefaultPortForwardWaitTimeout bounds how long a port forward with
+	// WaitForGuestPort polls the guest before giving up.
+	DefaultPortForwardWaitTimeout = 30 * time.Second
+	// DefaultEventBufferSize is the number of events buffered for a slow
+	// event consumer before further events are dropped.
+	DefaultEventBufferSize = 100
+	// DefaultHostApprovalTimeout bounds how long a connection to an
+	// unlisted host waits for runtime approval (NetworkConfig.HostApproval).
+	DefaultHostApprovalTimeout = 30 * time.Second
 )
 
 type ImageConfig struct {
@@ -27,6 +36,8 @@ type ImageConfig struct {
 	Entrypoint []string          `json:"entrypoint,omitempty"`
 	Cmd        []string          `json:"cmd,omitempty"`
 	Env        map[string]string `json:"env,omitempty"`
+	// ExposedPorts lists TCP ports declared by the image via EXPOSE.
+	ExposedPorts []int `json:"exposed_ports,omitempty"`
 }
 
 type Config struct {
@@ -37,8 +48,74 @@ type Config struct {
 	Network    *NetworkConfig    `json:"network,omitempty"`
 	VFS        *VFSConfig        `json:"vfs,omitempty"`
 	Env        map[string]string `json:"env,omitempty"`
+	// Labels are free-form key/value tags. They are not interpreted by
+	// matchlock; the guest can read them from the metadata service.
+	Labels     map[string]string `json:"labels,omitempty"`
 	ExtraDisks []DiskMount       `json:"extra_disks,omitempty"`
 	ImageCfg   *ImageConfig      `json:"image_config,omitempty"`
+	// CapAdd keeps capabilities that guest commands would otherwise lose
+	// (see DefaultDroppedCapabilities). CapDrop removes additional ones.
+	// Both are ignored in privileged mode.
+	CapAdd  []string `json:"cap_add,omitempty"`
+	CapDrop []string `json:"cap_drop,omitempty"`
+	// AllowSyscalls removes individual syscalls from the guest seccomp
+	// filter (see AllowableSyscalls). Ignored in privileged mode.
+	AllowSyscalls []string `json:"allow_syscalls,omitempty"`
+	// DisableNoNewPrivs leaves no_new_privs unset for guest commands, so
+	// setuid binaries and file capabilities work. The seccomp filter and
+	// capability drop still apply. Ignored in privileged mode.
+	DisableNoNewPrivs bool `json:"disable_no_new_privs,omitempty"`
+	// Ulimits sets resource limits on guest commands, keyed by name (see
+	// UlimitNames). Unset limits keep the guest kernel defaults.
+	Ulimits map[string]Ulimit `json:"ulimits,omitempty"`
+	// SeccompAudit reports security-relevant guest syscalls as "syscall"
+	// events. Each flagged syscall round-trips through the guest agent, so
+	// syscall-heavy workloads slow down noticeably; use it for profiling.
+	SeccompAudit bool `json:"seccomp_audit,omitempty"`
+	// SharedRootfs boots from a read-only base image prepared once per
+	// image and shared by every VM, with per-VM writes going to a small
+	// overlay disk instead of a full copy of the rootfs.
+	SharedRootfs bool `json:"shared_rootfs,omitempty"`
+	// SkipRootfsCheck skips the read-only e2fsck pass run on the VM's
+	// rootfs before boot, which costs time on large images. The cheap
+	// superblock check still runs.
+	SkipRootfsCheck bool `json:"skip_rootfs_check,omitempty"`
+	// KeepStateOnClose leaves the VM's rootfs and overlay snapshots in its
+	// state directory when the sandbox closes, for post-mortem debugging.
+	KeepStateOnClose bool `json:"keep_state_on_close,omitempty"`
+	// StopGracePeriodSeconds is how long Close waits for the VM to shut
+	// down after asking it to before killing it, when Close's context has
+	// no deadline of its own (default: 5). Linux hosts only.
+	StopGracePeriodSeconds int `json:"stop_grace_period_seconds,omitempty"`
+	// KernelPath boots this sandbox from a specific kernel image on the
+	// host instead of the default cached kernel. It must be an ELF vmlinux
+	// (x86_64) or an arm64 Image for the host architecture.
+	KernelPath string `json:"kernel_path,omitempty"`
+	// KernelModules are host paths of loadable modules (.ko) that
+	// guest-init loads, in order, before starting the guest agent. They
+	// reach the guest on a read-only disk, not through the rootfs, and
+	// must be built for the sandbox's kernel. Linux hosts only.
+	KernelModules []string `json:"kernel_modules,omitempty"`
+	// InitCommands run as root, in order, once the VM has booted and
+	// before the sandbox is reported started, so one-off privileged setup
+	// does not require running the workload privileged. A command that
+	// exits non-zero fails the start.
+	InitCommands []string `json:"init_commands,omitempty"`
+	// EventBufferSize is how many events are buffered between producers
+	// and the event consumer (default: DefaultEventBufferSize). Events are
+	// delivered at most once: when the buffer is full they are dropped and
+	// counted in a periodic "events_dropped" event (see EventsDropped).
+	EventBufferSize int `json:"event_buffer_size,omitempty"`
+	// RequireSignature refuses to boot Image unless its manifest carries a
+	// cosign signature by one of TrustedKeys. Each key is PEM text or the
+	// path of a PEM public key file. Only key-based signatures are checked.
+	RequireSignature bool     `json:"require_signature,omitempty"`
+	TrustedKeys      []string `json:"trusted_keys,omitempty"`
+	// SocketMounts maps guest paths to host unix sockets. The guest agent
+	// listens on each guest path and proxies every connection over vsock to
+	// the host socket, so only the listed sockets are reachable from the
+	// sandbox (see ValidateSocketMounts).
+	SocketMounts map[string]string `json:"socket_mounts,omitempty"`
 }
 
 // DiskMount describes a persistent ext4 disk image to attach as a block device.
@@ -60,9 +137,17 @@ func ValidateGuestMount(path string) error {
 }
 
 type Resources struct {
-	CPUs           int           `json:"cpus,omitempty"`
-	MemoryMB       int           `json:"memory_mb,omitempty"`
-	DiskSizeMB     int           `json:"disk_size_mb,omitempty"`
+	CPUs       int `json:"cpus,omitempty"`
+	MemoryMB   int `json:"memory_mb,omitempty"`
+	DiskSizeMB int `json:"disk_size_mb,omitempty"`
+	SwapMB     int `json:"swap_mb,omitempty"` // zram swap inside the guest; 0 disables
+	// CPUAffinity pins the VM's process, including its vCPU threads, to
+	// these host CPUs. Linux hosts only; empty leaves scheduling alone.
+	CPUAffinity []int `json:"cpu_affinity,omitempty"`
+	// CgroupParent runs the VM's process in its own cgroup under this
+	// cgroup v2 path, so host limits and accounting cover the whole VM.
+	// Linux hosts only; empty falls back to $MATCHLOCK_CGROUP_PARENT.
+	CgroupParent   string        `json:"cgroup_parent,omitempty"`
 	TimeoutSeconds int           `json:"timeout_seconds,omitempty"`
 	Timeout        time.Duration `json:"-"`
 }
@@ -81,10 +166,100 @@ type NetworkConfig struct {
 	BlockPrivateIPs     bool              `json:"block_private_ips,omitempty"`
 	AllowedPrivateHosts []string          `json:"allowed_private_hosts,omitempty"`
 	Secrets             map[string]Secret `json:"secrets,omitempty"`
-	PolicyScript    string            `json:"policy_script,omitempty"`
-	DNSServers      []string          `json:"dns_servers,omitempty"`
-	Hostname        string            `json:"hostname,omitempty"`
-	MTU             int               `json:"mtu,omitempty"`
+	PolicyScript        string            `json:"policy_script,omitempty"`
+	DNSServers          []string          `json:"dns_servers,omitempty"`
+	Hostname            string            `json:"hostname,omitempty"`
+	MTU                 int               `json:"mtu,omitempty"`
+	// AutoMTU sets the guest MTU to the host's outbound interface MTU when
+	// MTU is unset. An explicit MTU always takes precedence.
+	AutoMTU bool `json:"auto_mtu,omitempty"`
+	// ClampMSS rewrites the MSS option of forwarded TCP SYNs to fit the
+	// host route MTU so egress works when the real path MTU is smaller
+	// (Linux only; macOS terminates guest TCP on the host already).
+	ClampMSS bool `json:"clamp_mss,omitempty"`
+	// UpstreamDNS lists DNS servers (ip or ip:port) the host-side proxy
+	// uses to resolve allowed hostnames before connecting upstream, for
+	// split-horizon setups where the host's own resolver gives the wrong
+	// answer. Tried in order; empty uses the host resolver. The guest's
+	// resolver is still DNSServers.
+	UpstreamDNS []string `json:"upstream_dns,omitempty"`
+	// UpstreamProxy is an http://, https://, socks5:// or socks5h:// URL,
+	// with optional user:password@, that the host-side proxy tunnels its
+	// upstream TCP connections through, for hosts behind a corporate
+	// proxy. Empty falls back to the host's HTTPS_PROXY (honouring
+	// NO_PROXY); UpstreamProxyNone connects directly. Setting a proxy
+	// turns on interception. Hostnames are then resolved by the proxy, so
+	// UpstreamDNS only applies to the proxy's own name. UDP and DNS are not
+	// proxied.
+	UpstreamProxy string `json:"upstream_proxy,omitempty"`
+	// SearchDomains and ResolvOptions are written to the guest's
+	// /etc/resolv.conf as its "search" and "options" lines, e.g.
+	// ["ndots:2", "rotate"].
+	SearchDomains []string `json:"search_domains,omitempty"`
+	ResolvOptions []string `json:"resolv_options,omitempty"`
+	// MirrorRoutes copies matching HTTP(S) requests to a shadow endpoint
+	// (see MirrorRule). Mirrors get requests before secret substitution,
+	// so they see placeholders, never real secret values.
+	MirrorRoutes []MirrorRule `json:"mirror_routes,omitempty"`
+	// MetadataService serves sandbox metadata and scoped secret lookups to
+	// the guest at http://MetadataServiceIP (see metadata.go).
+	MetadataService bool `json:"metadata_service,omitempty"`
+	// MaxConcurrentConnections caps the guest TCP connections the
+	// host-side proxy handles at once; MaxConnectionsPerHost caps them per
+	// destination IP. Connections beyond a limit are reset and reported as
+	// "connection_limited" events. 0 means unlimited.
+	MaxConcurrentConnections int `json:"max_concurrent_connections,omitempty"`
+	MaxConnectionsPerHost    int `json:"max_connections_per_host,omitempty"`
+	// HostApproval holds guest connections to hosts outside AllowedHosts
+	// and emits a "host_denied" event instead of failing them at once. If
+	// the host is allowed at runtime (the allow_host RPC) within
+	// HostApprovalTimeoutSeconds (default DefaultHostApprovalTimeout), the
+	// connection proceeds; otherwise it is blocked as usual. Hosts rejected
+	// by BlockPrivateIPs are never held.
+	HostApproval               bool `json:"host_approval,omitempty"`
+	HostApprovalTimeoutSeconds int  `json:"host_approval_timeout_seconds,omitempty"`
+	// WaitForNetwork makes guest-init hold the ready signal until a TCP
+	// connect to NetworkProbe (host:port, default the first DNS server on
+	// port 53) succeeds, so the first command never races network setup.
+	// Boot fails with ErrBootNetworkUnreachable if it never does. Setting
+	// NetworkProbe alone turns the wait on.
+	WaitForNetwork bool   `json:"wait_for_network,omitempty"`
+	NetworkProbe   string `json:"network_probe,omitempty"`
+	// AllowedUDPHosts lets guest UDP reach the listed destinations, which
+	// is otherwise dropped apart from DNS to DNSServers. Entries are host or
+	// host:port (any port when omitted); hosts use the same patterns as
+	// AllowedHosts and BlockPrivateIPs still applies. Packets carry only
+	// addresses, so hostnames are resolved when the sandbox starts; the
+	// Linux firewall cannot match wildcard patterns, which only take effect
+	// on macOS (see ParseUDPHost).
+	AllowedUDPHosts []string `json:"allowed_udp_hosts,omitempty"`
+	// StaticMAC and StaticIP pin the guest's MAC address and IPv4 address
+	// instead of deriving them from the sandbox ID and its allocated
+	// subnet, for setups that need a reproducible address. StaticIP must
+	// lie in 192.168.100.0/24 - 192.168.254.0/24 and the sandbox takes its
+	// whole /24; creation fails if another sandbox holds that subnet or
+	// the same MAC. On macOS a StaticIP turns on network interception.
+	// With SharedBridge, StaticIP must lie in SharedBridgeSubnet instead.
+	StaticMAC string `json:"static_mac,omitempty"`
+	StaticIP  string `json:"static_ip,omitempty"`
+	// SharedBridge attaches the sandbox's TAP to the host bridge
+	// SharedBridgeName and gives the guest one address on the /16
+	// SharedBridgeSubnet, instead of a dedicated /24 per sandbox, so the
+	// 155-subnet pool no longer caps how many sandboxes run at once and no
+	// per-sandbox host address or NAT table is set up. Policy is enforced
+	// per guest IP, and each bridge port only accepts frames from its
+	// guest's MAC and IP and cannot reach other guests. Linux only; VM
+	// snapshots are not supported.
+	SharedBridge bool `json:"shared_bridge,omitempty"`
+}
+
+// GetHostApprovalTimeout returns the configured host approval timeout or
+// the default.
+func (n *NetworkConfig) GetHostApprovalTimeout() time.Duration {
+	if n != nil && n.HostApprovalTimeoutSeconds > 0 {
+		return time.Duration(n.HostApprovalTimeoutSeconds) * time.Second
+	}
+	return DefaultHostApprovalTimeout
 }
 
 // GetDNSServers returns the configured DNS servers or defaults.
@@ -95,6 +270,36 @@ func (n *NetworkConfig) GetDNSServers() []string {
 	return DefaultDNSServers
 }
 
+// GetSearchDomains returns the configured resolv.conf search domains.
+func (n *NetworkConfig) GetSearchDomains() []string {
+	if n == nil {
+		return nil
+	}
+	return n.SearchDomains
+}
+
+// GetResolvOptions returns the configured resolv.conf options.
+func (n *NetworkConfig) GetResolvOptions() []string {
+	if n == nil {
+		return nil
+	}
+	return n.ResolvOptions
+}
+
+// HasProxiedSecrets reports whether any secret relies on the proxy to swap
+// its placeholder for the real value. Raw file secrets do not.
+func (n *NetworkConfig) HasProxiedSecrets() bool {
+	if n == nil {
+		return false
+	}
+	for _, secret := range n.Secrets {
+		if !secret.FileRaw {
+			return true
+		}
+	}
+	return false
+}
+
 // GetMTU returns the configured network MTU or the default.
 func (n *NetworkConfig) GetMTU() int {
 	if n != nil && n.MTU > 0 {
@@ -107,6 +312,15 @@ type Secret struct {
 	Value       string   `json:"value"`
 	Placeholder string   `json:"placeholder,omitempty"`
 	Hosts       []string `json:"hosts"`
+	// File, when set, delivers the secret as a read-only VFS file at this
+	// guest path (under the workspace) instead of an environment variable.
+	// The file holds the placeholder, which the proxy swaps for the real
+	// value on requests to Hosts.
+	File string `json:"file,omitempty"`
+	// FileRaw writes the real value to File instead of the placeholder.
+	// This exposes the secret to everything in the guest and bypasses the
+	// proxy entirely, so it cannot be combined with Hosts.
+	FileRaw bool `json:"file_raw,omitempty"`
 }
 
 type VFSConfig struct {
@@ -114,6 +328,15 @@ type VFSConfig struct {
 	DirectMounts map[string]DirectMount `json:"direct_mounts,omitempty"`
 	Mounts       map[string]MountConfig `json:"mounts,omitempty"`
 	Interception *VFSInterceptionConfig `json:"interception,omitempty"`
+	// CompressMinBytes compresses guest reads of at least this many bytes
+	// on their way over vsock (zstd, or gzip for older guests). 0 disables.
+	CompressMinBytes int `json:"compress_min_bytes,omitempty"`
+}
+
+// GetStopGracePeriod returns StopGracePeriodSeconds as a duration, or 0 to
+// leave the backend default.
+func (c *Config) GetStopGracePeriod() time.Duration {
+	return time.Duration(c.StopGracePeriodSeconds) * time.Second
 }
 
 // GetWorkspace returns the configured workspace path or the default
@@ -133,8 +356,17 @@ type MountConfig struct {
 	Type     string       `json:"type"`
 	HostPath string       `json:"host_path,omitempty"`
 	Readonly bool         `json:"readonly,omitempty"`
+	Watch    bool         `json:"watch,omitempty"`
 	Upper    *MountConfig `json:"upper,omitempty"`
 	Lower    *MountConfig `json:"lower,omitempty"`
+	// HostUID/GuestUID remap ownership on host_fs mounts: host files owned
+	// by HostUID appear owned by GuestUID in the guest, and entries the
+	// guest creates are chowned to HostUID. HostGID/GuestGID do the same
+	// for groups. Each pair is set together or not at all.
+	HostUID  *int `json:"host_uid,omitempty"`
+	HostGID  *int `json:"host_gid,omitempty"`
+	GuestUID *int `json:"guest_uid,omitempty"`
+	GuestGID *int `json:"guest_gid,omitempty"`
 }
 
 const (
@@ -144,6 +376,7 @@ const (
 
 	MountOptionReadonlyShort = "ro"
 	MountOptionReadonly      = "readonly"
+	MountOptionWatch         = "watch"
 )
 
 // GetID returns the VM ID from config. Creates a new random ID if not set.
@@ -212,6 +445,15 @@ func (c *Config) Merge(other *Config) *Config {
 		if other.Resources.DiskSizeMB > 0 {
 			result.Resources.DiskSizeMB = other.Resources.DiskSizeMB
 		}
+		if other.Resources.SwapMB > 0 {
+			result.Resources.SwapMB = other.Resources.SwapMB
+		}
+		if len(other.Resources.CPUAffinity) > 0 {
+			result.Resources.CPUAffinity = other.Resources.CPUAffinity
+		}
+		if other.Resources.CgroupParent != "" {
+			result.Resources.CgroupParent = other.Resources.CgroupParent
+		}
 		if other.Resources.TimeoutSeconds > 0 {
 			result.Resources.TimeoutSeconds = other.Resources.TimeoutSeconds
 		}
@@ -228,12 +470,63 @@ func (c *Config) Merge(other *Config) *Config {
 	if other.Env != nil {
 		result.Env = other.Env
 	}
+	if other.Labels != nil {
+		result.Labels = other.Labels
+	}
 	if len(other.ExtraDisks) > 0 {
 		result.ExtraDisks = other.ExtraDisks
 	}
 	if other.ImageCfg != nil {
 		result.ImageCfg = other.ImageCfg
 	}
+	if len(other.CapAdd) > 0 {
+		result.CapAdd = other.CapAdd
+	}
+	if len(other.CapDrop) > 0 {
+		result.CapDrop = other.CapDrop
+	}
+	if len(other.AllowSyscalls) > 0 {
+		result.AllowSyscalls = other.AllowSyscalls
+	}
+	if other.DisableNoNewPrivs {
+		result.DisableNoNewPrivs = true
+	}
+	if len(other.Ulimits) > 0 {
+		result.Ulimits = other.Ulimits
+	}
+	if other.SeccompAudit {
+		result.SeccompAudit = true
+	}
+	if other.SharedRootfs {
+		result.SharedRootfs = true
+	}
+	if other.SkipRootfsCheck {
+		result.SkipRootfsCheck = true
+	}
+	if other.KeepStateOnClose {
+		result.KeepStateOnClose = true
+	}
+	if other.StopGracePeriodSeconds > 0 {
+		result.StopGracePeriodSeconds = other.StopGracePeriodSeconds
+	}
+	if other.KernelPath != "" {
+		result.KernelPath = other.KernelPath
+	}
+	if len(other.KernelModules) > 0 {
+		result.KernelModules = other.KernelModules
+	}
+	if len(other.InitCommands) > 0 {
+		result.InitCommands = other.InitCommands
+	}
+	if other.EventBufferSize > 0 {
+		result.EventBufferSize = other.EventBufferSize
+	}
+	if other.RequireSignature {
+		result.RequireSignature = true
+	}
+	if len(other.TrustedKeys) > 0 {
+		result.TrustedKeys = other.TrustedKeys
+	}
 	return &result
 }
 
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// ConfigFileOptions controls how a config file is loaded.
+type ConfigFileOptions struct {
+	// StrictEnv makes references to unset environment variables an error
+	// instead of expanding them to "".
+	StrictEnv bool
+	// LookupEnv resolves ${VAR} references (default: os.LookupEnv).
+	LookupEnv func(name string) (string, bool)
+}
+
+// configEnvRef matches ${NAME} and its escaped form $${NAME}.
+var configEnvRef = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// interpolateConfigEnv expands ${NAME} in every string value of a decoded
+// config document from the host environment, so secret values and host
+// lists can stay out of the file. Map keys are left alone. $${NAME} yields a
+// literal ${NAME}.
+func interpolateConfigEnv(doc any, opts ConfigFileOptions) (any, error) {
+	lookup := opts.LookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	var missing []string
+	var expand func(v any) any
+	expand = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			return configEnvRef.ReplaceAllStringFunc(v, func(ref string) string {
+				if strings.HasPrefix(ref, "$$") {
+					return ref[1:]
+				}
+				name := ref[2 : len(ref)-1]
+				value, ok := lookup(name)
+				if !ok && !slices.Contains(missing, name) {
+					missing = append(missing, name)
+				}
+				return value
+			})
+		case map[string]any:
+			for k, item := range v {
+				v[k] = expand(item)
+			}
+		case []any:
+			for i, item := range v {
+				v[i] = expand(item)
+			}
+		}
+		return v
+	}
+
+	doc = expand(doc)
+	if opts.StrictEnv && len(missing) > 0 {
+		slices.Sort(missing)
+		return nil, errx.With(ErrConfigEnvNotSet, ": %s", strings.Join(missing, ", "))
+	}
+	return doc, nil
+}
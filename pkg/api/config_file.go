@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// ConfigFileVersion is the current sandbox config file schema version.
+//
+// A config file is YAML or JSON with a top-level "version" and the same
+// fields as Config, using its JSON names:
+//
+//	version: 1
+//	image: python:3.12-alpine
+//	resources: {cpus: 2, memory_mb: 1024}
+//	network:
+//	  allowed_hosts: [api.openai.com]
+//	vfs:
+//	  mounts:
+//	    /workspace/src: {type: host_fs, host_path: ./src, readonly: true}
+//
+// String values may reference host environment variables as ${NAME} (see
+// ConfigFileOptions). Unknown fields are rejected so typos do not silently
+// drop settings. Fields that are derived at runtime (id, image_config) cannot
+// be set. Omitted fields keep the same defaults as the CLI and RPC create.
+const ConfigFileVersion = 1
+
+type configFile struct {
+	Version int `json:"version"`
+	*Config
+}
+
+// LoadConfigFile reads and validates a sandbox config file.
+func LoadConfigFile(path string, opts ConfigFileOptions) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errx.Wrap(ErrReadConfigFile, err)
+	}
+	config, err := ParseConfigFile(data, opts)
+	if err != nil {
+		return nil, errx.With(ErrParseConfigFile, " %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// ParseConfigFile decodes a YAML or JSON config file (JSON is valid YAML),
+// expands environment references and validates the result.
+func ParseConfigFile(data []byte, opts ConfigFileOptions) (*Config, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	doc, err := interpolateConfigEnv(doc, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Re-encode as JSON so the file shares Config's field names and types.
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	file := configFile{Config: &Config{
+		Resources: &Resources{
+			CPUs:           DefaultCPUs,
+			MemoryMB:       DefaultMemoryMB,
+			DiskSizeMB:     DefaultDiskSizeMB,
+			TimeoutSeconds: DefaultTimeoutSeconds,
+		},
+		Network: &NetworkConfig{BlockPrivateIPs: true},
+	}}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case file.Version == 0:
+		return nil, errx.With(ErrInvalidConfig, ": version is required (current: %d)", ConfigFileVersion)
+	case file.Version != ConfigFileVersion:
+		return nil, errx.With(ErrInvalidConfig, ": unsupported version %d (current: %d)", file.Version, ConfigFileVersion)
+	case file.ID != "":
+		return nil, errx.With(ErrInvalidConfig, ": id is assigned at runtime and cannot be set")
+	case file.ImageCfg != nil:
+		return nil, errx.With(ErrInvalidConfig, ": image_config is derived from the image and cannot be set")
+	}
+
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	return file.Config, nil
+}
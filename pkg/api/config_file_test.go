@@ -0,0 +1,93 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfigFileYAML(t *testing.T) {
+	config, err := ParseConfigFile([]byte(`
+version: 1
+image: python:3.12-alpine
+resources:
+  cpus: 2
+network:
+  allowed_hosts: [api.openai.com]
+  add_hosts:
+    - {host: db.internal, ip: 10.0.0.5}
+vfs:
+  mounts:
+    /workspace/src: {type: host_fs, host_path: /src, readonly: true}
+env:
+  MODE: test
+`), ConfigFileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "python:3.12-alpine", config.Image)
+	assert.Equal(t, 2, config.Resources.CPUs)
+	assert.Equal(t, DefaultMemoryMB, config.Resources.MemoryMB)
+	assert.True(t, config.Network.BlockPrivateIPs)
+	assert.Equal(t, []HostIPMapping{{Host: "db.internal", IP: "10.0.0.5"}}, config.Network.AddHosts)
+	assert.Equal(t, MountConfig{Type: MountTypeHostFS, HostPath: "/src", Readonly: true}, config.VFS.Mounts["/workspace/src"])
+	assert.Equal(t, map[string]string{"MODE": "test"}, config.Env)
+}
+
+func TestParseConfigFileJSON(t *testing.T) {
+	config, err := ParseConfigFile([]byte(`{"version": 1, "image": "alpine:latest", "network": {"block_private_ips": false}}`), ConfigFileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "alpine:latest", config.Image)
+	assert.False(t, config.Network.BlockPrivateIPs)
+}
+
+func TestParseConfigFileRejectsInvalid(t *testing.T) {
+	for name, doc := range map[string]string{
+		"missing version": "image: alpine:latest",
+		"future version":  "version: 2\nimage: alpine:latest",
+		"unknown field":   "version: 1\nimage: alpine:latest\nresources: {memroy_mb: 1}",
+		"runtime id":      "version: 1\nimage: alpine:latest\nid: vm-123",
+		"missing image":   "version: 1",
+		"mount outside":   "version: 1\nimage: alpine:latest\nvfs: {mounts: {/etc: {type: memory}}}",
+		"swap too large":  "version: 1\nimage: alpine:latest\nresources: {memory_mb: 256, swap_mb: 1024}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseConfigFile([]byte(doc), ConfigFileOptions{})
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestParseConfigFileInterpolatesEnv(t *testing.T) {
+	env := map[string]string{"OPENAI_KEY": "sk-live", "API_HOST": "api.openai.com"}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	config, err := ParseConfigFile([]byte(`
+version: 1
+image: alpine:latest
+network:
+  allowed_hosts: ["${API_HOST}"]
+  secrets:
+    OPENAI_KEY: {value: "${OPENAI_KEY}", hosts: ["${API_HOST}"]}
+env:
+  LITERAL: "$${API_HOST}"
+  MISSING: "x${UNSET_VAR}y"
+`), ConfigFileOptions{LookupEnv: lookup})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api.openai.com"}, config.Network.AllowedHosts)
+	assert.Equal(t, Secret{Value: "sk-live", Hosts: []string{"api.openai.com"}}, config.Network.Secrets["OPENAI_KEY"])
+	assert.Equal(t, "${API_HOST}", config.Env["LITERAL"])
+	assert.Equal(t, "xy", config.Env["MISSING"])
+}
+
+func TestParseConfigFileStrictEnvRejectsUnset(t *testing.T) {
+	_, err := ParseConfigFile([]byte(`
+version: 1
+image: alpine:latest
+env: {A: "${UNSET_B}", B: "${UNSET_A}", C: "${UNSET_A}"}
+`), ConfigFileOptions{StrictEnv: true, LookupEnv: func(string) (string, bool) { return "", false }})
+	require.ErrorIs(t, err, ErrConfigEnvNotSet)
+	assert.Contains(t, err.Error(), "UNSET_A, UNSET_B")
+}
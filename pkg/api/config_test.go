@@ -94,3 +94,34 @@ func TestGetHostname_NilNetworkFallsBackToGeneratedID(t *testing.T) {
 	assert.Regexp(t, `^vm-[0-9a-f]{8}$`, hostname)
 	assert.Equal(t, hostname, cfg.ID)
 }
+
+func TestValidateRequireSignatureNeedsTrustedKeys(t *testing.T) {
+	cfg := &Config{Image: "alpine:latest", RequireSignature: true}
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+
+	cfg.TrustedKeys = []string{"cosign.pub"}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateRejectsEmptyInitCommand(t *testing.T) {
+	cfg := &Config{Image: "alpine:latest", InitCommands: []string{"mount -a", " "}}
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidConfig)
+
+	cfg.InitCommands = []string{"mount -a"}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateRejectsAfterPhaseCallbackRule(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Image = "alpine:latest"
+	cfg.VFS.Interception = &VFSInterceptionConfig{Rules: []VFSHookRule{
+		{Name: "ask", Phase: "after", Action: VFSHookActionCallback},
+	}}
+	assert.ErrorIs(t, cfg.Validate(), ErrCallbackRulePhase)
+
+	cfg.VFS.Interception.Rules[0].Phase = "before"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.VFS.Interception.Rules[0] = VFSHookRule{Name: "redact", Phase: "after", Action: VFSHookActionMutateCallback}
+	assert.ErrorIs(t, cfg.Validate(), ErrCallbackRulePhase)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// ParseCPUSet parses a cpuset list such as "0-3" or "0,2,4-5" into sorted,
+// de-duplicated host CPU numbers. An empty spec means no pinning. A range
+// spanning more CPUs than this host has is rejected before it is expanded.
+func ParseCPUSet(spec string) ([]int, error) {
+	return parseCPUSet(spec, runtime.NumCPU())
+}
+
+func parseCPUSet(spec string, hostCPUs int) ([]int, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		loStr, hiStr, isRange := strings.Cut(part, "-")
+		lo, err := strconv.Atoi(loStr)
+		if err != nil || lo < 0 {
+			return nil, errx.With(ErrInvalidCPUSet, ": %q", part)
+		}
+		hi := lo
+		if isRange {
+			if hi, err = strconv.Atoi(hiStr); err != nil || hi < lo {
+				return nil, errx.With(ErrInvalidCPUSet, ": %q", part)
+			}
+			if hi-lo >= hostCPUs {
+				return nil, errx.With(ErrInvalidCPUSet, ": %q spans more CPUs than the host's %d", part, hostCPUs)
+			}
+		}
+		for cpu := lo; cpu <= hi; cpu++ {
+			seen[cpu] = true
+		}
+	}
+	cpus := make([]int, 0, len(seen))
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// ValidateCPUAffinity checks CPU numbers for Resources.CPUAffinity. Whether
+// the cores exist is only known on the host running the VM, which checks
+// them again before pinning.
+func ValidateCPUAffinity(cpus []int) error {
+	seen := make(map[int]bool, len(cpus))
+	for _, cpu := range cpus {
+		if cpu < 0 {
+			return errx.With(ErrInvalidCPUSet, ": CPU %d must not be negative", cpu)
+		}
+		if seen[cpu] {
+			return errx.With(ErrInvalidCPUSet, ": CPU %d listed twice", cpu)
+		}
+		seen[cpu] = true
+	}
+	return nil
+}
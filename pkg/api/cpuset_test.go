@@ -0,0 +1,51 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPUSet(t *testing.T) {
+	got, err := parseCPUSet("4-5, 0,2,5", 8)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 2, 4, 5}, got)
+
+	got, err = ParseCPUSet("")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestParseCPUSetRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"a", "1,", "-1", "3-1", "0-x", "1-2-3"} {
+		t.Run(spec, func(t *testing.T) {
+			_, err := ParseCPUSet(spec)
+			assert.ErrorIs(t, err, ErrInvalidCPUSet)
+		})
+	}
+}
+
+func TestParseCPUSetBoundsRangesByHostCPUs(t *testing.T) {
+	_, err := ParseCPUSet("0-4294967295")
+	assert.ErrorIs(t, err, ErrInvalidCPUSet)
+
+	_, err = parseCPUSet("0-4", 4)
+	assert.ErrorIs(t, err, ErrInvalidCPUSet)
+
+	got, err := parseCPUSet("4-7", 4)
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 5, 6, 7}, got)
+}
+
+func TestValidateCPUAffinity(t *testing.T) {
+	require.NoError(t, ValidateCPUAffinity(nil))
+	require.NoError(t, ValidateCPUAffinity([]int{0, 3}))
+	assert.ErrorIs(t, ValidateCPUAffinity([]int{-1}), ErrInvalidCPUSet)
+	assert.ErrorIs(t, ValidateCPUAffinity([]int{1, 1}), ErrInvalidCPUSet)
+
+	cfg := DefaultConfig()
+	cfg.Image = "alpine:latest"
+	cfg.Resources.CPUAffinity = []int{2, 2}
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidCPUSet)
+}
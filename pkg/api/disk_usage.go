@@ -0,0 +1,22 @@
+package api
+
+// Disk usage kinds reported by the disk_usage RPC.
+const (
+	DiskUsageRootfs    = "rootfs"
+	DiskUsageDisk      = "disk"
+	DiskUsageWorkspace = "workspace"
+)
+
+// DiskUsage is the space usage of one guest filesystem. The rootfs and
+// extra disks come from statfs inside the guest. The workspace is counted
+// on the host from the VFS provider, so only UsedBytes is set for it.
+type DiskUsage struct {
+	Path       string `json:"path"`
+	Kind       string `json:"kind"`
+	TotalBytes uint64 `json:"total_bytes"`
+	UsedBytes  uint64 `json:"used_bytes"`
+	FreeBytes  uint64 `json:"free_bytes"`
+	// Error is set instead of the sizes when the filesystem could not be
+	// read (for example, a disk that failed to mount).
+	Error string `json:"error,omitempty"`
+}
@@ -35,8 +35,10 @@ func ParseEnvVar(spec string) (string, string, error) {
 	return name, value, nil
 }
 
-// ParseEnvFile parses an env file with one variable per line using the same
-// semantics as ParseEnvVar. Blank lines and lines starting with '#' are ignored.
+// ParseEnvFile parses a dotenv-style file with one variable per line using the
+// same semantics as ParseEnvVar. Blank lines and lines starting with '#' are
+// ignored, an "export " prefix is dropped, and values may be quoted (see
+// unquoteEnvValue).
 func ParseEnvFile(path string) (map[string]string, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -56,9 +58,9 @@ func ParseEnvFile(path string) (map[string]string, error) {
 			continue
 		}
 
-		name, value, err := ParseEnvVar(line)
+		name, value, err := parseEnvFileLine(line)
 		if err != nil {
-			return nil, errx.With(ErrEnvFileLine, " %s:%d: %v", path, lineNo, err)
+			return nil, errx.With(ErrEnvFileLine, " %s:%d: %w", path, lineNo, err)
 		}
 		result[name] = value
 	}
@@ -69,6 +71,55 @@ func ParseEnvFile(path string) (map[string]string, error) {
 	return result, nil
 }
 
+func parseEnvFileLine(line string) (string, string, error) {
+	line = strings.TrimPrefix(line, "export ")
+	name, value, err := ParseEnvVar(line)
+	if err != nil || !strings.Contains(line, "=") {
+		return name, value, err
+	}
+	value, err = unquoteEnvValue(value)
+	return name, value, err
+}
+
+// unquoteEnvValue strips one level of quoting from an env file value.
+// Single-quoted values are literal; double-quoted values understand \n, \t,
+// \" and \\. A '#' comment may follow the closing quote. Unquoted values
+// are kept verbatim, as with Docker's --env-file.
+func unquoteEnvValue(value string) (string, error) {
+	trimmed := strings.TrimLeft(value, " \t")
+	if trimmed == "" || (trimmed[0] != '"' && trimmed[0] != '\'') {
+		return value, nil
+	}
+	quote := trimmed[0]
+	var b strings.Builder
+	for i := 1; i < len(trimmed); i++ {
+		c := trimmed[i]
+		switch {
+		case c == quote:
+			if rest := strings.TrimSpace(trimmed[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", errx.With(ErrEnvValueQuote, ": unexpected %q after closing quote", rest)
+			}
+			return b.String(), nil
+		case c == '\\' && quote == '"' && i+1 < len(trimmed):
+			i++
+			switch trimmed[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(trimmed[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(trimmed[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", errx.With(ErrEnvValueQuote, ": missing closing %c", quote)
+}
+
 // ParseEnvs merges env files and explicit env flags into one map.
 // Later values override earlier ones:
 // 1) env files in provided order, then 2) explicit env specs in provided order.
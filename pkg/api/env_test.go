@@ -3,6 +3,7 @@ package api
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -69,6 +70,44 @@ func TestParseEnvFileParsesLinesAndIgnoresComments(t *testing.T) {
 	assert.Equal(t, "quux", env["QUX"])
 }
 
+func TestParseEnvFileQuotedValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quoted.env")
+	content := strings.Join([]string{
+		`DOUBLE="hello world"`,
+		`SINGLE='it is $literal \n'`,
+		`ESCAPED="line1\nline2 \"q\" \\ \x"`,
+		`export EXPORTED=yes`,
+		`COMMENTED="value" # trailing comment`,
+		`EMPTY=""`,
+		`UNQUOTED=a "b" c`,
+		`HASH=abc#def`,
+	}, "\n")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	env, err := ParseEnvFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"DOUBLE":    "hello world",
+		"SINGLE":    `it is $literal \n`,
+		"ESCAPED":   "line1\nline2 \"q\" \\ \\x",
+		"EXPORTED":  "yes",
+		"COMMENTED": "value",
+		"EMPTY":     "",
+		"UNQUOTED":  `a "b" c`,
+		"HASH":      "abc#def",
+	}, env)
+}
+
+func TestParseEnvFileRejectsUnbalancedQuotes(t *testing.T) {
+	for _, line := range []string{`A="open`, `A='open`, `A="x" y`} {
+		path := filepath.Join(t.TempDir(), "bad.env")
+		require.NoError(t, os.WriteFile(path, []byte(line+"\n"), 0644))
+		_, err := ParseEnvFile(path)
+		require.ErrorIs(t, err, ErrEnvFileLine, line)
+		assert.ErrorIs(t, err, ErrEnvValueQuote, line)
+	}
+}
+
 func TestParseEnvFileReturnsLineNumberOnParseError(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "bad.env")
@@ -6,23 +6,46 @@ var (
 	ErrBlocked        = errors.New("request blocked by policy")
 	ErrHostNotAllowed = errors.New("host not in allowlist")
 	ErrSecretLeak     = errors.New("secret placeholder sent to unauthorized host")
+	ErrScrubEncoding  = errors.New("response content encoding cannot be scrubbed")
 	ErrVMNotRunning   = errors.New("VM is not running")
 	ErrVMNotFound     = errors.New("VM not found")
 	ErrTimeout        = errors.New("operation timed out")
 	ErrInvalidConfig  = errors.New("invalid configuration")
 
-	ErrInvalidVolumeFormat = errors.New("expected format host:guest or host:guest:" + MountOptionReadonlyShort)
-	ErrResolvePath         = errors.New("failed to resolve path")
-	ErrHostPathNotExist    = errors.New("host path does not exist")
-	ErrUnknownMountOption  = errors.New("unknown option")
-	ErrGuestPathNotAbs     = errors.New("guest path must be absolute")
-	ErrGuestPathOutside    = errors.New("guest path must be within workspace")
+	ErrInvalidExecOptions = errors.New("invalid exec options")
+	ErrExecTimeout        = errors.New("exec timed out")
+
+	ErrBootFailed             = errors.New("guest boot failed")
+	ErrBootMissingDNS         = errors.New("guest boot failed: missing DNS servers")
+	ErrBootWorkspaceMountWait = errors.New("guest boot failed: workspace mount timeout")
+	ErrBootExecGuestAgent     = errors.New("guest boot failed: exec guest agent")
+	ErrBootStartGuestFused    = errors.New("guest boot failed: start guest FUSE daemon")
+	ErrBootOverlayRoot        = errors.New("guest boot failed: set up overlay root")
+	ErrBootResolveUser        = errors.New("guest boot failed: resolve image user")
+	ErrBootNetworkUnreachable = errors.New("guest boot failed: network unreachable")
+
+	ErrReadConfigFile  = errors.New("read config file")
+	ErrParseConfigFile = errors.New("parse config file")
+	ErrConfigEnvNotSet = errors.New("config references unset environment variables")
+
+	ErrInvalidVolumeFormat     = errors.New("expected format host:guest or host:guest:" + MountOptionReadonlyShort)
+	ErrResolvePath             = errors.New("failed to resolve path")
+	ErrHostPathNotExist        = errors.New("host path does not exist")
+	ErrUnknownMountOption      = errors.New("unknown option")
+	ErrConflictingMountOptions = errors.New("overlay mounts cannot be combined with " + MountOptionReadonlyShort + ", " + MountTypeHostFS + ", or " + MountOptionWatch)
+	ErrWatchRequiresHostFS     = errors.New("watch is only supported on " + MountTypeHostFS + " mounts")
+	ErrInvalidMountLayers      = errors.New("invalid overlay layers")
+	ErrInvalidOwnerRemap       = errors.New("invalid owner remap")
+	ErrGuestPathNotAbs         = errors.New("guest path must be absolute")
+	ErrGuestPathOutside        = errors.New("guest path must be within workspace")
+	ErrInvalidWorkspace        = errors.New("invalid workspace")
 
 	ErrEnvNameEmpty   = errors.New("environment variable name cannot be empty")
 	ErrEnvNameInvalid = errors.New("environment variable name is invalid")
 	ErrEnvVarNotSet   = errors.New("environment variable is not set")
 	ErrReadEnvFile    = errors.New("read env file")
 	ErrEnvFileLine    = errors.New("parse env file line")
+	ErrEnvValueQuote  = errors.New("unbalanced quotes in env value")
 
 	ErrPortForwardSpecFormat = errors.New("invalid port-forward spec format")
 	ErrPortForwardPort       = errors.New("invalid port")
@@ -30,4 +53,42 @@ var (
 	ErrAddHostSpecFormat = errors.New("invalid add-host format")
 	ErrAddHostHost       = errors.New("invalid add-host hostname")
 	ErrAddHostIP         = errors.New("invalid add-host ip")
+
+	ErrShellSplit = errors.New("invalid shell command string")
+
+	ErrInvalidCapability = errors.New("invalid capability")
+	ErrInvalidSyscall    = errors.New("invalid allow_syscalls entry")
+
+	ErrInvalidSwap = errors.New("invalid swap size")
+
+	ErrInvalidCPUSet = errors.New("invalid cpuset")
+
+	ErrInvalidCgroupParent = errors.New("invalid cgroup parent")
+
+	ErrInvalidUlimit = errors.New("invalid ulimit")
+
+	ErrInvalidUpstreamDNS   = errors.New("invalid upstream DNS server")
+	ErrInvalidUpstreamProxy = errors.New("invalid upstream proxy")
+	ErrInvalidResolvOption  = errors.New("invalid resolv.conf option")
+	ErrInvalidSearchDomain  = errors.New("invalid DNS search domain")
+	ErrInvalidNetworkProbe  = errors.New("invalid network probe")
+	ErrInvalidUDPHost       = errors.New("invalid UDP allowlist entry")
+	ErrInvalidStaticMAC     = errors.New("invalid static MAC address")
+	ErrInvalidStaticIP      = errors.New("invalid static IP address")
+
+	ErrInvalidMirrorRule = errors.New("invalid mirror rule")
+
+	ErrInvalidLogSource = errors.New("invalid log source")
+
+	ErrInvalidEventType = errors.New("invalid event type")
+
+	ErrInvalidUser = errors.New("invalid user")
+
+	ErrInvalidSecret = errors.New("invalid secret")
+
+	ErrInvalidLabel = errors.New("invalid label")
+
+	ErrInvalidSocketMount = errors.New("invalid socket mount")
+
+	ErrCallbackRulePhase = errors.New("callback and mutate_callback VFS hook rules must use phase=before")
 )
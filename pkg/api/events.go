@@ -0,0 +1,84 @@
+package api
+
+import (
+	"sync/atomic"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// EventType is the kind of an Event, carried in Event.Type. Each type sets
+// the Event field of the same name, except EventTypeNetworkDenied.
+type EventType string
+
+const (
+	EventTypeNetwork           EventType = "network"
+	EventTypeFile              EventType = "file"
+	EventTypeExec              EventType = "exec"
+	EventTypeSyscall           EventType = "syscall"
+	EventTypeSecurity          EventType = "security"
+	EventTypeEventsDropped     EventType = "events_dropped"
+	EventTypeConnectionLimited EventType = "connection_limited"
+	EventTypeHostDenied        EventType = "host_denied"
+	EventTypeSecretInjected    EventType = "secret_injected"
+	// EventTypeNetworkDenied is never an Event.Type; as a subscription
+	// filter it selects the network events with Network.Blocked set.
+	EventTypeNetworkDenied EventType = "network_denied"
+)
+
+// EventTypes lists every known event type.
+var EventTypes = []EventType{
+	EventTypeNetwork,
+	EventTypeFile,
+	EventTypeExec,
+	EventTypeSyscall,
+	EventTypeSecurity,
+	EventTypeEventsDropped,
+	EventTypeConnectionLimited,
+	EventTypeHostDenied,
+	EventTypeSecretInjected,
+	EventTypeNetworkDenied,
+}
+
+// ParseEventType validates an event type name.
+func ParseEventType(name string) (EventType, error) {
+	for _, t := range EventTypes {
+		if string(t) == name {
+			return t, nil
+		}
+	}
+	return "", errx.With(ErrInvalidEventType, ": %q", name)
+}
+
+// EventSink is the producer end of a sandbox's event stream, shared by the
+// network proxy, VFS hooks and seccomp audit. Emit never blocks: an event
+// that does not fit in the buffer is dropped and counted, so a slow
+// consumer costs events rather than producer latency.
+type EventSink struct {
+	C       chan Event
+	dropped atomic.Uint64
+}
+
+// NewEventSink returns a sink that buffers size events.
+func NewEventSink(size int) *EventSink {
+	return &EventSink{C: make(chan Event, size)}
+}
+
+// Emit delivers evt if the buffer has room and reports whether it did. A
+// nil sink discards every event.
+func (s *EventSink) Emit(evt Event) bool {
+	if s == nil {
+		return false
+	}
+	select {
+	case s.C <- evt:
+		return true
+	default:
+		s.dropped.Add(1)
+		return false
+	}
+}
+
+// Dropped returns how many events Emit has dropped.
+func (s *EventSink) Dropped() uint64 {
+	return s.dropped.Load()
+}
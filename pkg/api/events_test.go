@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEventType(t *testing.T) {
+	eventType, err := ParseEventType("host_denied")
+	require.NoError(t, err)
+	assert.Equal(t, EventTypeHostDenied, eventType)
+
+	_, err = ParseEventType("dns")
+	require.ErrorIs(t, err, ErrInvalidEventType)
+}
+
+func TestEventSinkCountsDropsWhenFull(t *testing.T) {
+	sink := NewEventSink(1)
+	assert.True(t, sink.Emit(Event{Type: "file"}))
+	assert.False(t, sink.Emit(Event{Type: "file"}))
+	assert.False(t, sink.Emit(Event{Type: "file"}))
+	assert.Equal(t, uint64(2), sink.Dropped())
+	assert.Len(t, sink.C, 1)
+
+	var nilSink *EventSink
+	assert.False(t, nilSink.Emit(Event{Type: "file"}))
+}
@@ -0,0 +1,40 @@
+package api
+
+// HostMachineAlias is the allowlist token and guest hostname for the machine
+// running matchlock. Listing it in NetworkConfig.AllowedHosts maps it to the
+// VM's gateway IP in guest /etc/hosts and lets guest traffic to it through the
+// proxy, even when private IPs are blocked.
+//
+// This deliberately opens a path from the sandbox into the host: every TCP
+// port on the host's loopback interface becomes reachable, so only allow it
+// for workloads trusted with local services such as databases or model
+// servers.
+const HostMachineAlias = "host.matchlock.internal"
+
+// AllowsHostMachine reports whether HostMachineAlias is in the allowlist. The
+// alias must be listed literally; wildcards such as "*" do not grant it.
+func (n *NetworkConfig) AllowsHostMachine() bool {
+	if n == nil {
+		return false
+	}
+	for _, host := range n.AllowedHosts {
+		if host == HostMachineAlias {
+			return true
+		}
+	}
+	return false
+}
+
+// HostMachineAddHosts returns AddHosts plus the HostMachineAlias mapping to
+// gatewayIP when the alias is allowed.
+func (n *NetworkConfig) HostMachineAddHosts(gatewayIP string) []HostIPMapping {
+	if n == nil {
+		return nil
+	}
+	if !n.AllowsHostMachine() || gatewayIP == "" {
+		return n.AddHosts
+	}
+	hosts := make([]HostIPMapping, 0, len(n.AddHosts)+1)
+	hosts = append(hosts, n.AddHosts...)
+	return append(hosts, HostIPMapping{Host: HostMachineAlias, IP: gatewayIP})
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostMachineAddHosts(t *testing.T) {
+	custom := HostIPMapping{Host: "db.internal", IP: "10.0.0.5"}
+
+	n := &NetworkConfig{AddHosts: []HostIPMapping{custom}}
+	assert.Equal(t, []HostIPMapping{custom}, n.HostMachineAddHosts("192.168.100.1"))
+
+	n.AllowedHosts = []string{HostMachineAlias}
+	assert.Equal(t, []HostIPMapping{
+		custom,
+		{Host: HostMachineAlias, IP: "192.168.100.1"},
+	}, n.HostMachineAddHosts("192.168.100.1"))
+	assert.Len(t, n.AddHosts, 1, "config AddHosts must not be mutated")
+
+	var nilNetwork *NetworkConfig
+	assert.False(t, nilNetwork.AllowsHostMachine())
+	assert.Nil(t, nilNetwork.HostMachineAddHosts("192.168.100.1"))
+}
@@ -0,0 +1,20 @@
+package api
+
+// Image pull phases reported in ImageProgress.Phase.
+const (
+	ImageProgressResolve  = "resolve"  // fetching the image manifest and config
+	ImageProgressDownload = "download" // downloading and unpacking layers
+	ImageProgressRootfs   = "rootfs"   // building the ext4 rootfs
+)
+
+// ImageProgress is a progress update for an image that has to be pulled
+// before a sandbox can start. Cached images report nothing. BytesDone and
+// BytesTotal count compressed layer bytes, as the registry serves them.
+type ImageProgress struct {
+	Image      string `json:"image"`
+	Phase      string `json:"phase"`
+	Layers     int    `json:"layers,omitempty"`
+	LayersDone int    `json:"layers_done,omitempty"`
+	BytesDone  int64  `json:"bytes_done,omitempty"`
+	BytesTotal int64  `json:"bytes_total,omitempty"`
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// AllowableSyscalls are the syscalls the guest seccomp filter blocks by
+// default and that AllowSyscalls can unblock individually. Each one is
+// blocked because it reaches outside the calling process:
+//
+//   - ptrace: attach to, inspect and modify other guest processes
+//   - process_vm_readv / process_vm_writev: read or write another
+//     process's memory directly
+//   - kexec_load / kexec_file_load: replace the running guest kernel
+//
+// Unblocking a syscall does not grant the capability it usually needs
+// (SYS_PTRACE, SYS_BOOT); root in the guest already holds it in the
+// effective set, other users do not.
+var AllowableSyscalls = []string{"ptrace", "process_vm_readv", "process_vm_writev", "kexec_load", "kexec_file_load"}
+
+// NormalizeAllowSyscalls validates AllowSyscalls names (case-insensitive)
+// and returns them lowercased and de-duplicated, in input order.
+func NormalizeAllowSyscalls(names []string) ([]string, error) {
+	var out []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		normalized := strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, s := range AllowableSyscalls {
+			if s == normalized {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, errx.With(ErrInvalidSyscall, ": %q (allowed: %s)", name, strings.Join(AllowableSyscalls, ", "))
+		}
+		if !seen[normalized] {
+			seen[normalized] = true
+			out = append(out, normalized)
+		}
+	}
+	return out, nil
+}
+
+// IsolationWarnings describes each setting in c that weakens the default
+// guest isolation, for logging and "security" events when the sandbox is
+// created. Privileged overrides the scoped settings, so it is reported
+// alone.
+func (c *Config) IsolationWarnings() []string {
+	if c.Privileged {
+		return []string{"privileged mode disables the guest seccomp filter, capability drop and no_new_privs for every command; prefer cap_add, allow_syscalls or disable_no_new_privs for the specific access needed"}
+	}
+	var warnings []string
+	for _, name := range c.AllowSyscalls {
+		warnings = append(warnings, fmt.Sprintf("allow_syscalls %s removes it from the guest seccomp filter", name))
+	}
+	if c.DisableNoNewPrivs {
+		warnings = append(warnings, "disable_no_new_privs lets guest commands gain privileges through setuid binaries and file capabilities")
+	}
+	return warnings
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeAllowSyscalls(t *testing.T) {
+	names, err := NormalizeAllowSyscalls([]string{"PTRACE", " kexec_load", "ptrace"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ptrace", "kexec_load"}, names)
+
+	_, err = NormalizeAllowSyscalls([]string{"mount"})
+	require.ErrorIs(t, err, ErrInvalidSyscall)
+	assert.Contains(t, err.Error(), "process_vm_readv")
+}
+
+func TestIsolationWarnings(t *testing.T) {
+	assert.Empty(t, (&Config{}).IsolationWarnings())
+
+	privileged := &Config{Privileged: true, AllowSyscalls: []string{"ptrace"}, DisableNoNewPrivs: true}
+	warnings := privileged.IsolationWarnings()
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "privileged mode")
+
+	scoped := &Config{AllowSyscalls: []string{"ptrace"}, DisableNoNewPrivs: true}
+	warnings = scoped.IsolationWarnings()
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "ptrace")
+	assert.Contains(t, warnings[1], "no_new_privs")
+}
+
+func TestValidateRejectsUnknownAllowSyscall(t *testing.T) {
+	err := (&Config{Image: "alpine:latest", AllowSyscalls: []string{"bpf"}}).Validate()
+	require.ErrorIs(t, err, ErrInvalidSyscall)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// LogSource identifies which part of the VM wrote a line to its console log.
+type LogSource string
+
+const (
+	// LogSourceConsole covers kernel and VMM output, and any line without
+	// a guest runtime prefix.
+	LogSourceConsole LogSource = "console"
+	LogSourceInit    LogSource = "init"
+	LogSourceAgent   LogSource = "agent"
+	LogSourceFused   LogSource = "fused"
+)
+
+// LogSources lists every known log source.
+var LogSources = []LogSource{LogSourceConsole, LogSourceInit, LogSourceAgent, LogSourceFused}
+
+// LogLine is one line of a VM's console log.
+type LogLine struct {
+	Source LogSource `json:"source"`
+	Text   string    `json:"text"`
+}
+
+// ParseLogLine attributes a console line to its source. Guest runtime
+// components prefix their diagnostics with "[init] ", "[agent] " or
+// "[fused] "; the prefix is stripped from Text.
+func ParseLogLine(line string) LogLine {
+	line = strings.TrimRight(line, "\r\n")
+	for _, source := range []LogSource{LogSourceInit, LogSourceAgent, LogSourceFused} {
+		if text, ok := strings.CutPrefix(line, "["+string(source)+"] "); ok {
+			return LogLine{Source: source, Text: text}
+		}
+	}
+	return LogLine{Source: LogSourceConsole, Text: line}
+}
+
+// ParseLogSource validates a log source name.
+func ParseLogSource(name string) (LogSource, error) {
+	for _, source := range LogSources {
+		if string(source) == name {
+			return source, nil
+		}
+	}
+	return "", errx.With(ErrInvalidLogSource, ": %q", name)
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want LogLine
+	}{
+		{"[init] WARNING: mount failed\n", LogLine{Source: LogSourceInit, Text: "WARNING: mount failed"}},
+		{"[agent] Guest agent starting...", LogLine{Source: LogSourceAgent, Text: "Guest agent starting..."}},
+		{"[fused] Connected to VFS server\r\n", LogLine{Source: LogSourceFused, Text: "Connected to VFS server"}},
+		{"[    0.000000] Linux version 6.1", LogLine{Source: LogSourceConsole, Text: "[    0.000000] Linux version 6.1"}},
+		{"[agent]no space", LogLine{Source: LogSourceConsole, Text: "[agent]no space"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ParseLogLine(tt.line), tt.line)
+	}
+}
+
+func TestParseLogSource(t *testing.T) {
+	source, err := ParseLogSource("fused")
+	require.NoError(t, err)
+	assert.Equal(t, LogSourceFused, source)
+
+	_, err = ParseLogSource("kernel")
+	require.ErrorIs(t, err, ErrInvalidLogSource)
+}
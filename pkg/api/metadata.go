@@ -0,0 +1,90 @@
+package api
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// MetadataServiceIP is the link-local address where the guest reaches the
+// metadata service when NetworkConfig.MetadataService is set. It is served
+// over plain HTTP on port 80 by the host-side network proxy and never leaves
+// the host.
+//
+// Every request must carry MetadataHeader so that a guest service tricked
+// into fetching an attacker-chosen URL cannot read it. Endpoints:
+//
+//	GET /v1/sandbox                     SandboxMetadata as JSON
+//	GET /v1/secrets/NAME                the secret's placeholder as text/plain
+//
+// Like the environment, the service hands out placeholders only; the proxy
+// swaps a placeholder for the real value on requests to the secret's Hosts,
+// so the value never enters the VM.
+const MetadataServiceIP = "169.254.169.254"
+
+// MetadataHeader must be set to "true" on metadata service requests.
+const MetadataHeader = "Matchlock-Metadata"
+
+// SandboxMetadata is the non-secret view of a sandbox served to the guest.
+type SandboxMetadata struct {
+	ID           string            `json:"id"`
+	Image        string            `json:"image"`
+	Hostname     string            `json:"hostname"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Workspace    string            `json:"workspace,omitempty"`
+	CPUs         int               `json:"cpus,omitempty"`
+	MemoryMB     int               `json:"memory_mb,omitempty"`
+	AllowedHosts []string          `json:"allowed_hosts,omitempty"`
+	// Secrets lists secret names with the hosts each is scoped to.
+	Secrets []SecretScope `json:"secrets,omitempty"`
+}
+
+// SecretScope names a secret and the hosts it may be sent to (empty means
+// any allowed host). It never includes the value or placeholder.
+type SecretScope struct {
+	Name  string   `json:"name"`
+	Hosts []string `json:"hosts,omitempty"`
+}
+
+// Metadata returns the metadata service document for c.
+func (c *Config) Metadata() SandboxMetadata {
+	md := SandboxMetadata{
+		ID:       c.ID,
+		Image:    c.Image,
+		Hostname: c.GetHostname(),
+		Labels:   c.Labels,
+	}
+	if c.VFS != nil {
+		md.Workspace = c.VFS.GetWorkspace()
+	}
+	if c.Resources != nil {
+		md.CPUs = c.Resources.CPUs
+		md.MemoryMB = c.Resources.MemoryMB
+	}
+	if c.Network != nil {
+		md.AllowedHosts = c.Network.AllowedHosts
+		for name, secret := range c.Network.Secrets {
+			md.Secrets = append(md.Secrets, SecretScope{Name: name, Hosts: secret.Hosts})
+		}
+		sort.Slice(md.Secrets, func(i, j int) bool { return md.Secrets[i].Name < md.Secrets[j].Name })
+	}
+	return md
+}
+
+// ParseLabels parses KEY=VALUE label specs; later specs override earlier ones.
+func ParseLabels(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	labels := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		key, value, ok := strings.Cut(spec, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, errx.With(ErrInvalidLabel, ": %q (expected KEY=VALUE)", spec)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
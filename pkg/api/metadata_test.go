@@ -0,0 +1,55 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigMetadataOmitsSecretValues(t *testing.T) {
+	c := &Config{
+		ID:        "vm-abc",
+		Image:     "alpine:latest",
+		Labels:    map[string]string{"team": "infra"},
+		Resources: &Resources{CPUs: 2, MemoryMB: 1024},
+		VFS:       &VFSConfig{},
+		Network: &NetworkConfig{
+			AllowedHosts: []string{"api.openai.com"},
+			Secrets: map[string]Secret{
+				"OPENAI_KEY": {Value: "sk-real", Placeholder: "SANDBOX_SECRET_x", Hosts: []string{"api.openai.com"}},
+				"ANY":        {Value: "v"},
+			},
+		},
+	}
+
+	assert.Equal(t, SandboxMetadata{
+		ID:           "vm-abc",
+		Image:        "alpine:latest",
+		Hostname:     "vm-abc",
+		Labels:       map[string]string{"team": "infra"},
+		Workspace:    DefaultWorkspace,
+		CPUs:         2,
+		MemoryMB:     1024,
+		AllowedHosts: []string{"api.openai.com"},
+		Secrets: []SecretScope{
+			{Name: "ANY"},
+			{Name: "OPENAI_KEY", Hosts: []string{"api.openai.com"}},
+		},
+	}, c.Metadata())
+}
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels([]string{"team=infra", "run=1", "run=2", "empty="})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "infra", "run": "2", "empty": ""}, labels)
+
+	_, err = ParseLabels([]string{"novalue"})
+	assert.ErrorIs(t, err, ErrInvalidLabel)
+	_, err = ParseLabels([]string{"=x"})
+	assert.ErrorIs(t, err, ErrInvalidLabel)
+}
+
+func TestValidateRejectsEmptyLabelKey(t *testing.T) {
+	err := (&Config{Image: "alpine:latest", Labels: map[string]string{"": "x"}}).Validate()
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
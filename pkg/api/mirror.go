@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// MirrorRule sends a copy of every intercepted HTTP(S) request whose host
+// matches HostGlob to MirrorTo, a base URL such as http://localhost:8000.
+// The request path and query are appended to MirrorTo's path. The guest
+// only ever sees the real upstream's response.
+type MirrorRule struct {
+	HostGlob string `json:"host_glob"`
+	MirrorTo string `json:"mirror_to"`
+}
+
+// MirrorResult is the outcome of a mirrored request, reported next to the
+// real request in its network event.
+type MirrorResult struct {
+	URL           string `json:"url"`
+	StatusCode    int    `json:"status_code,omitempty"`
+	ResponseBytes int64  `json:"response_bytes,omitempty"`
+	DurationMS    int64  `json:"duration_ms"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ParseMirrorRule parses a host_glob=mirror_to spec, e.g.
+// "api.openai.com=http://localhost:8000".
+func ParseMirrorRule(spec string) (MirrorRule, error) {
+	hostGlob, mirrorTo, ok := strings.Cut(strings.TrimSpace(spec), "=")
+	if !ok {
+		return MirrorRule{}, errx.With(ErrInvalidMirrorRule, ": %q (expected host_glob=url)", spec)
+	}
+	rule := MirrorRule{HostGlob: strings.TrimSpace(hostGlob), MirrorTo: strings.TrimSpace(mirrorTo)}
+	if err := ValidateMirrorRule(rule); err != nil {
+		return MirrorRule{}, err
+	}
+	return rule, nil
+}
+
+// ValidateMirrorRule checks that rule has a host glob and an absolute
+// http(s) mirror URL.
+func ValidateMirrorRule(rule MirrorRule) error {
+	if rule.HostGlob == "" {
+		return errx.With(ErrInvalidMirrorRule, ": empty host_glob")
+	}
+	u, err := url.Parse(rule.MirrorTo)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errx.With(ErrInvalidMirrorRule, ": mirror_to %q must be an http(s) URL", rule.MirrorTo)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return errx.With(ErrInvalidMirrorRule, ": mirror_to %q must not have a query or fragment", rule.MirrorTo)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMirrorRule(t *testing.T) {
+	rule, err := ParseMirrorRule("api.openai.com=http://localhost:8000/v1")
+	require.NoError(t, err)
+	assert.Equal(t, MirrorRule{HostGlob: "api.openai.com", MirrorTo: "http://localhost:8000/v1"}, rule)
+
+	for _, spec := range []string{
+		"api.openai.com",
+		"=http://localhost:8000",
+		"api.openai.com=localhost:8000",
+		"api.openai.com=ftp://mirror",
+		"api.openai.com=http://mirror/?a=b",
+	} {
+		_, err := ParseMirrorRule(spec)
+		assert.ErrorIs(t, err, ErrInvalidMirrorRule, spec)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"math"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,6 +15,7 @@ type VolumeMountSpec struct {
 	GuestPath string
 	Type      string
 	Readonly  bool
+	Watch     bool
 }
 
 // ParseVolumeMount parses a volume mount string in format:
@@ -21,6 +23,7 @@ type VolumeMountSpec struct {
 // - "host:guest:ro"
 // - "host:guest:overlay"
 // - "host:guest:host_fs"
+// - "host:guest:ro:watch" (options may also be comma-separated)
 //
 // This is kept for backward compatibility with existing callers that only need
 // host/guest/readonly. Use ParseVolumeMountSpec for mount type aware parsing.
@@ -37,7 +40,7 @@ func ParseVolumeMount(vol string, workspace string) (hostPath, guestPath string,
 // ParseVolumeMountSpec parses a volume mount string and returns a typed spec.
 func ParseVolumeMountSpec(vol string, workspace string) (VolumeMountSpec, error) {
 	parts := strings.Split(vol, ":")
-	if len(parts) < 2 || len(parts) > 3 {
+	if len(parts) < 2 {
 		return VolumeMountSpec{}, ErrInvalidVolumeFormat
 	}
 
@@ -61,20 +64,33 @@ func ParseVolumeMountSpec(vol string, workspace string) (VolumeMountSpec, error)
 	// Default to overlay for safer snapshot-based isolation.
 	mountType := MountTypeOverlay
 	readonly := false
-
-	// Parse optional mount option.
-	if len(parts) == 3 {
-		switch strings.ToLower(strings.TrimSpace(parts[2])) {
-		case MountOptionReadonlyShort, MountOptionReadonly:
-			// Keep explicit read-only behavior as a host mount.
-			mountType = MountTypeHostFS
-			readonly = true
-		case MountTypeOverlay:
-			mountType = MountTypeOverlay
-		case MountTypeHostFS:
-			mountType = MountTypeHostFS
-		default:
-			return VolumeMountSpec{}, errx.With(ErrUnknownMountOption, " %q (use '%s', '%s', or '%s')", parts[2], MountOptionReadonlyShort, MountTypeOverlay, MountTypeHostFS)
+	watch := false
+
+	// Parse optional mount options. They are colon-separated so that the
+	// comma-splitting --volume flag passes them through intact.
+	if len(parts) > 2 {
+		options := strings.Join(parts[2:], ":")
+		explicitOverlay := false
+		for _, opt := range strings.FieldsFunc(options, func(r rune) bool { return r == ':' || r == ',' }) {
+			switch strings.ToLower(strings.TrimSpace(opt)) {
+			case MountOptionReadonlyShort, MountOptionReadonly:
+				// Keep explicit read-only behavior as a host mount.
+				mountType = MountTypeHostFS
+				readonly = true
+			case MountTypeOverlay:
+				explicitOverlay = true
+			case MountTypeHostFS:
+				mountType = MountTypeHostFS
+			case MountOptionWatch:
+				// Watching only makes sense when the guest reads the live host path.
+				mountType = MountTypeHostFS
+				watch = true
+			default:
+				return VolumeMountSpec{}, errx.With(ErrUnknownMountOption, " %q (use '%s', '%s', '%s', or '%s')", opt, MountOptionReadonlyShort, MountTypeOverlay, MountTypeHostFS, MountOptionWatch)
+			}
+		}
+		if explicitOverlay && mountType != MountTypeOverlay {
+			return VolumeMountSpec{}, errx.With(ErrConflictingMountOptions, " %q", options)
 		}
 	}
 
@@ -98,9 +114,20 @@ func ParseVolumeMountSpec(vol string, workspace string) (VolumeMountSpec, error)
 		GuestPath: guestPath,
 		Type:      mountType,
 		Readonly:  readonly,
+		Watch:     watch,
 	}, nil
 }
 
+// ValidateWorkspace checks a configured workspace path. It reaches the
+// guest on the kernel cmdline, so it must be a plain absolute path, and it
+// cannot be / since the VFS is mounted over it.
+func ValidateWorkspace(workspace string) error {
+	if !validGuestMountPath.MatchString(workspace) || filepath.Clean(workspace) == "/" {
+		return errx.With(ErrInvalidWorkspace, ": %q must be an absolute path below / containing only alphanumeric, '/', '_', '.', '-'", workspace)
+	}
+	return nil
+}
+
 // ValidateGuestPathWithinWorkspace checks that guestPath is absolute and inside workspace.
 func ValidateGuestPathWithinWorkspace(guestPath string, workspace string) error {
 	cleanGuestPath := filepath.Clean(guestPath)
@@ -118,14 +145,91 @@ func ValidateGuestPathWithinWorkspace(guestPath string, workspace string) error
 // ValidateVFSMountsWithinWorkspace checks that all VFS mount paths are valid
 // guest paths under the configured workspace.
 func ValidateVFSMountsWithinWorkspace(mounts map[string]MountConfig, workspace string) error {
-	for guestPath := range mounts {
+	for guestPath, mount := range mounts {
 		if err := ValidateGuestPathWithinWorkspace(guestPath, workspace); err != nil {
 			return err
 		}
+		if mount.Watch && mount.Type != MountTypeHostFS {
+			return errx.With(ErrWatchRequiresHostFS, ": %q", guestPath)
+		}
+		if err := validateMountLayers(mount); err != nil {
+			return errx.With(err, ": %q", guestPath)
+		}
+		if err := validateOwnerRemap(mount); err != nil {
+			return errx.With(err, ": %q", guestPath)
+		}
 	}
 	return nil
 }
 
+// validateOwnerRemap checks the host/guest UID and GID pairs of mount and
+// its layers. Only host_fs mounts touch host ownership, so only they may
+// remap it.
+func validateOwnerRemap(mount MountConfig) error {
+	uidSet, err := ownerPairSet("uid", mount.HostUID, mount.GuestUID)
+	if err != nil {
+		return err
+	}
+	gidSet, err := ownerPairSet("gid", mount.HostGID, mount.GuestGID)
+	if err != nil {
+		return err
+	}
+	if (uidSet || gidSet) && mount.Type != MountTypeHostFS {
+		return errx.With(ErrInvalidOwnerRemap, ": only %s mounts can remap ownership, not %q", MountTypeHostFS, mount.Type)
+	}
+	for _, layer := range []*MountConfig{mount.Upper, mount.Lower} {
+		if layer == nil {
+			continue
+		}
+		if err := validateOwnerRemap(*layer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ownerPairSet(kind string, host, guest *int) (bool, error) {
+	switch {
+	case host == nil && guest == nil:
+		return false, nil
+	case host == nil || guest == nil:
+		return false, errx.With(ErrInvalidOwnerRemap, ": host_%s and guest_%s must be set together", kind, kind)
+	case !validOwnerID(*host) || !validOwnerID(*guest):
+		return false, errx.With(ErrInvalidOwnerRemap, ": %s must be between 0 and %d", kind, uint32(math.MaxUint32))
+	}
+	return true, nil
+}
+
+// validateMountLayers checks the nested specs of a layered overlay, which
+// takes an upper and a lower layer instead of a host_path snapshot. Layers
+// may be overlays themselves but cannot be watched.
+func validateMountLayers(mount MountConfig) error {
+	if mount.Upper == nil && mount.Lower == nil {
+		return nil
+	}
+	switch {
+	case mount.Type != MountTypeOverlay:
+		return errx.With(ErrInvalidMountLayers, ": upper/lower need type %s, not %q", MountTypeOverlay, mount.Type)
+	case mount.Upper == nil || mount.Lower == nil:
+		return errx.With(ErrInvalidMountLayers, ": both upper and lower are required")
+	case mount.HostPath != "":
+		return errx.With(ErrInvalidMountLayers, ": use either host_path or upper/lower")
+	}
+	for _, layer := range []*MountConfig{mount.Upper, mount.Lower} {
+		if layer.Watch {
+			return errx.With(ErrInvalidMountLayers, ": watch is not supported on layers")
+		}
+		if err := validateMountLayers(*layer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validOwnerID(id int) bool {
+	return id >= 0 && int64(id) <= math.MaxUint32
+}
+
 func isWithinWorkspace(path string, workspace string) bool {
 	path = filepath.Clean(path)
 	workspace = filepath.Clean(workspace)
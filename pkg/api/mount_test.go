@@ -130,6 +130,53 @@ func TestParseVolumeMountWorkspaceRootAllowsAbsolutePaths(t *testing.T) {
 	assert.Equal(t, filepath.Clean("/etc/data"), gotGuest, "guest path")
 }
 
+func TestValidateWorkspace(t *testing.T) {
+	require.NoError(t, ValidateWorkspace("/workspace"))
+	require.NoError(t, ValidateWorkspace("/code"))
+	require.NoError(t, ValidateWorkspace("/home/agent/src"))
+
+	for _, ws := range []string{"code", "/", "//", "/my code", "/code\tquiet", "/code;x"} {
+		assert.ErrorIs(t, ValidateWorkspace(ws), ErrInvalidWorkspace, ws)
+	}
+}
+
+func TestConfigValidateChecksWorkspace(t *testing.T) {
+	config := &Config{Image: "alpine:latest", VFS: &VFSConfig{
+		Workspace: "/code",
+		Mounts:    map[string]MountConfig{"/code/data": {Type: MountTypeMemory}},
+	}}
+	require.NoError(t, config.Validate())
+
+	config.VFS.Mounts = map[string]MountConfig{"/workspace/data": {Type: MountTypeMemory}}
+	require.ErrorIs(t, config.Validate(), ErrGuestPathOutside)
+
+	config = &Config{Image: "alpine:latest", VFS: &VFSConfig{Workspace: "/my workspace"}}
+	require.ErrorIs(t, config.Validate(), ErrInvalidWorkspace)
+
+	config = &Config{Image: "alpine:latest", VFS: &VFSConfig{CompressMinBytes: -1}}
+	require.ErrorIs(t, config.Validate(), ErrInvalidConfig)
+}
+
+func TestValidateVFSMountsOwnerRemap(t *testing.T) {
+	id := func(v int) *int { return &v }
+	valid := map[string]MountConfig{
+		"/workspace/data": {Type: MountTypeHostFS, HostPath: "/srv/data", HostUID: id(501), GuestUID: id(0)},
+	}
+	require.NoError(t, ValidateVFSMountsWithinWorkspace(valid, "/workspace"))
+
+	for name, mount := range map[string]MountConfig{
+		"half pair":  {Type: MountTypeHostFS, HostPath: "/srv/data", HostGID: id(20)},
+		"negative":   {Type: MountTypeHostFS, HostPath: "/srv/data", HostUID: id(-1), GuestUID: id(0)},
+		"too large":  {Type: MountTypeHostFS, HostPath: "/srv/data", HostUID: id(1 << 33), GuestUID: id(0)},
+		"memory":     {Type: MountTypeMemory, HostUID: id(501), GuestUID: id(0)},
+		"overlay":    {Type: MountTypeOverlay, HostPath: "/srv/data", HostUID: id(501), GuestUID: id(0)},
+		"layer pair": {Type: MountTypeOverlay, Upper: &MountConfig{Type: MountTypeMemory}, Lower: &MountConfig{Type: MountTypeHostFS, HostPath: "/srv/data", GuestUID: id(0)}},
+	} {
+		err := ValidateVFSMountsWithinWorkspace(map[string]MountConfig{"/workspace/data": mount}, "/workspace")
+		assert.ErrorIs(t, err, ErrInvalidOwnerRemap, name)
+	}
+}
+
 func TestValidateVFSMountsWithinWorkspaceAllowsDescendants(t *testing.T) {
 	err := ValidateVFSMountsWithinWorkspace(
 		map[string]MountConfig{
@@ -162,3 +209,66 @@ func TestValidateVFSMountsWithinWorkspaceRejectsRelative(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "must be absolute")
 }
+
+func TestParseVolumeMountSpecWatchOption(t *testing.T) {
+	hostFile := filepath.Join(t.TempDir(), "app.conf")
+	require.NoError(t, os.WriteFile(hostFile, []byte("x"), 0644))
+
+	spec, err := ParseVolumeMountSpec(hostFile+":app.conf:ro:watch", "/workspace")
+	require.NoError(t, err)
+	assert.Equal(t, MountTypeHostFS, spec.Type)
+	assert.True(t, spec.Readonly)
+	assert.True(t, spec.Watch)
+
+	spec, err = ParseVolumeMountSpec(hostFile+":app.conf:ro,watch", "/workspace")
+	require.NoError(t, err)
+	assert.True(t, spec.Readonly)
+	assert.True(t, spec.Watch)
+
+	spec, err = ParseVolumeMountSpec(hostFile+":app.conf:"+MountOptionWatch, "/workspace")
+	require.NoError(t, err)
+	assert.Equal(t, MountTypeHostFS, spec.Type)
+	assert.False(t, spec.Readonly)
+	assert.True(t, spec.Watch)
+}
+
+func TestParseVolumeMountSpecWatchConflictsWithOverlay(t *testing.T) {
+	hostDir := t.TempDir()
+
+	_, err := ParseVolumeMountSpec(hostDir+":subdir:overlay:watch", "/workspace")
+	require.ErrorIs(t, err, ErrConflictingMountOptions)
+}
+
+func TestValidateVFSMountsWithinWorkspaceChecksOverlayLayers(t *testing.T) {
+	layered := MountConfig{
+		Type:  MountTypeOverlay,
+		Upper: &MountConfig{Type: MountTypeMemory},
+		Lower: &MountConfig{Type: MountTypeHostFS, HostPath: "/srv/data", Readonly: true},
+	}
+	require.NoError(t, ValidateVFSMountsWithinWorkspace(map[string]MountConfig{"/workspace/data": layered}, "/workspace"))
+
+	withHostPath := layered
+	withHostPath.HostPath = "/tmp"
+	upperOnly := MountConfig{Type: MountTypeOverlay, Upper: &MountConfig{Type: MountTypeMemory}}
+	wrongType := layered
+	wrongType.Type = MountTypeHostFS
+	watchedLayer := layered
+	watchedLayer.Lower = &MountConfig{Type: MountTypeHostFS, HostPath: "/srv/data", Watch: true}
+
+	for name, mount := range map[string]MountConfig{
+		"host_path":     withHostPath,
+		"upper only":    upperOnly,
+		"wrong type":    wrongType,
+		"watched layer": watchedLayer,
+	} {
+		err := ValidateVFSMountsWithinWorkspace(map[string]MountConfig{"/workspace/data": mount}, "/workspace")
+		assert.ErrorIs(t, err, ErrInvalidMountLayers, name)
+	}
+}
+
+func TestValidateVFSMountsWithinWorkspaceRejectsWatchOnOverlay(t *testing.T) {
+	err := ValidateVFSMountsWithinWorkspace(map[string]MountConfig{
+		"/workspace/data": {Type: MountTypeOverlay, HostPath: "/tmp", Watch: true},
+	}, "/workspace")
+	require.ErrorIs(t, err, ErrWatchRequiresHostFS)
+}
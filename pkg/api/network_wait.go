@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// NetworkWaitProbe returns the host:port guest-init must reach before the
+// sandbox is ready, or "" when there is no wait. Setting NetworkProbe
+// implies WaitForNetwork, as --network-probe does on the CLI.
+func (n *NetworkConfig) NetworkWaitProbe() string {
+	if n == nil || (!n.WaitForNetwork && n.NetworkProbe == "") {
+		return ""
+	}
+	if n.NetworkProbe != "" {
+		return n.NetworkProbe
+	}
+	return net.JoinHostPort(n.GetDNSServers()[0], "53")
+}
+
+// ValidateNetworkProbe checks a NetworkProbe is host:port with a usable
+// port and nothing that would break the kernel command line.
+func ValidateNetworkProbe(probe string) error {
+	host, port, err := net.SplitHostPort(probe)
+	if err != nil || host == "" || strings.ContainsAny(host, " \t,") {
+		return errx.With(ErrInvalidNetworkProbe, ": %q (expected host:port)", probe)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return errx.With(ErrInvalidNetworkProbe, ": %q (invalid port)", probe)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkWaitProbe(t *testing.T) {
+	var nilNet *NetworkConfig
+	assert.Empty(t, nilNet.NetworkWaitProbe())
+	assert.Equal(t, "example.com:443", (&NetworkConfig{NetworkProbe: "example.com:443"}).NetworkWaitProbe(), "a probe implies the wait")
+	assert.Equal(t, "8.8.8.8:53", (&NetworkConfig{WaitForNetwork: true}).NetworkWaitProbe())
+	assert.Equal(t, "1.1.1.1:53", (&NetworkConfig{WaitForNetwork: true, DNSServers: []string{"1.1.1.1"}}).NetworkWaitProbe())
+	assert.Equal(t, "example.com:443", (&NetworkConfig{WaitForNetwork: true, NetworkProbe: "example.com:443"}).NetworkWaitProbe())
+}
+
+func TestValidateNetworkProbe(t *testing.T) {
+	for _, probe := range []string{"example.com:443", "10.0.0.1:80", "[::1]:53"} {
+		require.NoError(t, ValidateNetworkProbe(probe), probe)
+	}
+	for _, probe := range []string{"example.com", ":443", "example.com:0", "example.com:http", "a,b:80", "host:70000"} {
+		require.ErrorIs(t, ValidateNetworkProbe(probe), ErrInvalidNetworkProbe, probe)
+	}
+}
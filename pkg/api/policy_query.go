@@ -0,0 +1,17 @@
+package api
+
+// PolicyQuery asks the host about the sandbox's effective network policy.
+// It is sent by the guest over the policy vsock port, one JSON object per
+// line.
+type PolicyQuery struct {
+	// Host is checked against the allowlist when set.
+	Host string `json:"host,omitempty"`
+}
+
+// PolicyAnswer is the host's reply to a PolicyQuery.
+type PolicyAnswer struct {
+	Host    string `json:"host,omitempty"`
+	Allowed bool   `json:"allowed"`
+	// Secrets lists the configured secret names; values are never exposed.
+	Secrets []string `json:"secrets"`
+}
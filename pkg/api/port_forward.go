@@ -1,8 +1,10 @@
 package api
 
 import (
+	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jingkaihe/matchlock/internal/errx"
 )
@@ -11,6 +13,23 @@ import (
 type PortForward struct {
 	LocalPort  int `json:"local_port"`
 	RemotePort int `json:"remote_port"`
+	// Address binds this forward on a single host address instead of the
+	// address list it is started with.
+	Address string `json:"address,omitempty"`
+	// WaitForGuestPort delays declaring the forward ready until a guest
+	// service accepts connections on RemotePort.
+	WaitForGuestPort bool `json:"wait_for_guest_port,omitempty"`
+	// WaitTimeoutMS bounds the readiness wait (default:
+	// DefaultPortForwardWaitTimeout).
+	WaitTimeoutMS int `json:"wait_timeout_ms,omitempty"`
+}
+
+// WaitTimeout returns the effective readiness wait timeout.
+func (pf PortForward) WaitTimeout() time.Duration {
+	if pf.WaitTimeoutMS > 0 {
+		return time.Duration(pf.WaitTimeoutMS) * time.Millisecond
+	}
+	return DefaultPortForwardWaitTimeout
 }
 
 // PortForwardBinding is a realized local listener binding.
@@ -73,6 +92,98 @@ func ParsePortForward(spec string) (PortForward, error) {
 	}
 }
 
+// ParsePublishSpecs parses docker-style publish specs; see ParsePublishSpec.
+func ParsePublishSpecs(specs []string) ([]PortForward, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+
+	result := make([]PortForward, 0, len(specs))
+	for _, spec := range specs {
+		pf, err := ParsePublishSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, pf)
+	}
+	return result, nil
+}
+
+// ParsePublishSpec parses a spec in `docker run -p` syntax:
+// [[ADDRESS:]HOST_PORT:]CONTAINER_PORT[/tcp]. Unlike ParsePortForward, a
+// bare CONTAINER_PORT or an empty HOST_PORT (ADDRESS::CONTAINER_PORT) binds
+// an ephemeral host port. ADDRESS must be an IP literal, with IPv6 written
+// in brackets.
+func ParsePublishSpec(spec string) (PortForward, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return PortForward{}, errx.With(ErrPortForwardSpecFormat, ": empty spec")
+	}
+	const expected = "[[ADDRESS:]HOST_PORT:]CONTAINER_PORT[/tcp]"
+
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		if proto := spec[i+1:]; proto != "tcp" {
+			return PortForward{}, errx.With(ErrPortForwardSpecFormat, ": %q: unsupported protocol %q (only tcp)", spec, proto)
+		}
+		spec = spec[:i]
+	}
+
+	var address string
+	rest := spec
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 || !strings.HasPrefix(rest[end+1:], ":") {
+			return PortForward{}, errx.With(ErrPortForwardSpecFormat, ": %q (expected %s)", spec, expected)
+		}
+		address = rest[1:end]
+		rest = rest[end+2:]
+		if !strings.Contains(rest, ":") {
+			return PortForward{}, errx.With(ErrPortForwardSpecFormat, ": %q (expected %s)", spec, expected)
+		}
+	}
+
+	parts := strings.Split(rest, ":")
+	var hostPort string
+	switch {
+	case len(parts) == 1:
+	case len(parts) == 2:
+		hostPort = parts[0]
+	case len(parts) == 3 && address == "":
+		address, hostPort = parts[0], parts[1]
+	default:
+		return PortForward{}, errx.With(ErrPortForwardSpecFormat, ": %q (expected %s)", spec, expected)
+	}
+
+	if address != "" && net.ParseIP(address) == nil {
+		return PortForward{}, errx.With(ErrPortForwardSpecFormat, ": %q: invalid bind address %q (use an IP literal)", spec, address)
+	}
+
+	remotePort, err := parsePort(parts[len(parts)-1], "container")
+	if err != nil {
+		return PortForward{}, err
+	}
+	pf := PortForward{RemotePort: remotePort, Address: address}
+	if strings.TrimSpace(hostPort) != "" {
+		if pf.LocalPort, err = parsePort(hostPort, "host"); err != nil {
+			return PortForward{}, err
+		}
+	}
+	return pf, nil
+}
+
+// PublishAllPortForwards returns one forward per exposed port, each bound to
+// an ephemeral host port (LocalPort 0), mirroring `docker run -P`.
+func PublishAllPortForwards(exposedPorts []int) []PortForward {
+	if len(exposedPorts) == 0 {
+		return nil
+	}
+	result := make([]PortForward, 0, len(exposedPorts))
+	for _, p := range exposedPorts {
+		result = append(result, PortForward{RemotePort: p})
+	}
+	return result
+}
+
 func parsePort(value string, role string) (int, error) {
 	value = strings.TrimSpace(value)
 	if value == "" {
@@ -29,6 +29,12 @@ func TestParsePortForwards(t *testing.T) {
 	assert.Equal(t, PortForward{LocalPort: 19090, RemotePort: 9090}, pfs[1])
 }
 
+func TestPublishAllPortForwards(t *testing.T) {
+	pfs := PublishAllPortForwards([]int{80, 443})
+	assert.Equal(t, []PortForward{{RemotePort: 80}, {RemotePort: 443}}, pfs)
+	assert.Nil(t, PublishAllPortForwards(nil))
+}
+
 func TestParsePortForwardInvalidSpec(t *testing.T) {
 	_, err := ParsePortForward("1:2:3")
 	require.Error(t, err)
@@ -40,3 +46,35 @@ func TestParsePortForwardInvalidPort(t *testing.T) {
 	require.Error(t, err)
 	require.ErrorIs(t, err, ErrPortForwardPort)
 }
+
+func TestParsePublishSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		want PortForward
+	}{
+		{"80", PortForward{RemotePort: 80}},
+		{"80/tcp", PortForward{RemotePort: 80}},
+		{"8080:80", PortForward{LocalPort: 8080, RemotePort: 80}},
+		{"127.0.0.1:8080:80", PortForward{Address: "127.0.0.1", LocalPort: 8080, RemotePort: 80}},
+		{"127.0.0.1::80", PortForward{Address: "127.0.0.1", RemotePort: 80}},
+		{"[::1]:8080:80", PortForward{Address: "::1", LocalPort: 8080, RemotePort: 80}},
+		{"[::1]::80/tcp", PortForward{Address: "::1", RemotePort: 80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			pf, err := ParsePublishSpec(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, pf)
+		})
+	}
+}
+
+func TestParsePublishSpecInvalid(t *testing.T) {
+	for _, spec := range []string{"", "80/udp", "host:8080:80", "1:2:3:4", "[::1]:80", "::1:8080:80"} {
+		_, err := ParsePublishSpec(spec)
+		require.ErrorIs(t, err, ErrPortForwardSpecFormat, spec)
+	}
+
+	_, err := ParsePublishSpec("127.0.0.1:0:80")
+	require.ErrorIs(t, err, ErrPortForwardPort)
+}
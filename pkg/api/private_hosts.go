@@ -0,0 +1,25 @@
+package api
+
+import "net"
+
+// PrivateHostRoutes returns the AllowedPrivateHosts entries that are literal
+// IPv4 addresses. These get a host route via the gateway in the guest, and
+// the VM subnet is allocated around them, so an allowed private service is
+// never mistaken for an on-link neighbour of the guest. Patterns and
+// hostnames are matched by policy only.
+func (n *NetworkConfig) PrivateHostRoutes() []string {
+	if n == nil {
+		return nil
+	}
+	var routes []string
+	seen := make(map[string]bool)
+	for _, host := range n.AllowedPrivateHosts {
+		ip := net.ParseIP(host).To4()
+		if ip == nil || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		routes = append(routes, ip.String())
+	}
+	return routes
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrivateHostRoutes(t *testing.T) {
+	n := &NetworkConfig{AllowedPrivateHosts: []string{"192.168.1.50", "10.*", "db.internal", "fd00::1", "192.168.1.50", "172.16.0.9"}}
+	assert.Equal(t, []string{"192.168.1.50", "172.16.0.9"}, n.PrivateHostRoutes())
+
+	var nilConfig *NetworkConfig
+	assert.Nil(t, nilConfig.PrivateHostRoutes())
+}
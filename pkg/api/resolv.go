@@ -0,0 +1,38 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+var (
+	resolvOptionRe = regexp.MustCompile(`^[a-z][a-z0-9-]*(:[0-9]+)?$`)
+	dnsLabelRe     = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+)
+
+// ValidateResolvOption checks that option is a resolv.conf "options" entry
+// such as "rotate" or "ndots:2". Unknown option names are accepted so new
+// resolver features need no matchlock change.
+func ValidateResolvOption(option string) error {
+	if !resolvOptionRe.MatchString(option) {
+		return errx.With(ErrInvalidResolvOption, ": %q (expected name or name:number)", option)
+	}
+	return nil
+}
+
+// ValidateSearchDomain checks that domain is a DNS name usable as a
+// resolv.conf "search" entry. A trailing dot is allowed.
+func ValidateSearchDomain(domain string) error {
+	name := strings.TrimSuffix(domain, ".")
+	if name == "" || len(name) > 253 {
+		return errx.With(ErrInvalidSearchDomain, ": %q", domain)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !dnsLabelRe.MatchString(label) {
+			return errx.With(ErrInvalidSearchDomain, ": %q", domain)
+		}
+	}
+	return nil
+}
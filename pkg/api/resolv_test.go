@@ -0,0 +1,25 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateResolvOption(t *testing.T) {
+	for _, option := range []string{"rotate", "ndots:2", "timeout:1", "single-request-reopen"} {
+		assert.NoError(t, ValidateResolvOption(option), option)
+	}
+	for _, option := range []string{"", "ndots:", "ndots:two", "ndots 2", "Rotate", "rotate\nnameserver 1.1.1.1"} {
+		assert.ErrorIs(t, ValidateResolvOption(option), ErrInvalidResolvOption, option)
+	}
+}
+
+func TestValidateSearchDomain(t *testing.T) {
+	for _, domain := range []string{"svc.cluster.local", "corp.example.com.", "local"} {
+		assert.NoError(t, ValidateSearchDomain(domain), domain)
+	}
+	for _, domain := range []string{"", ".", "bad..domain", "-lead.example", "has space.example", "a,b"} {
+		assert.ErrorIs(t, ValidateSearchDomain(domain), ErrInvalidSearchDomain, domain)
+	}
+}
@@ -3,7 +3,10 @@ package api
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
 )
 
 // ParseSecret parses a secret string in the format "NAME=VALUE@host1,host2" or "NAME@host1,host2".
@@ -47,3 +50,37 @@ func ParseSecret(s string) (string, Secret, error) {
 		Hosts: hosts,
 	}, nil
 }
+
+// ValidateSecretFiles checks the file delivery settings of secrets: file
+// paths must be distinct guest paths strictly under the workspace that no
+// VFS mount already claims, and file_raw secrets need a file and no hosts
+// since the proxy never sees them.
+func ValidateSecretFiles(secrets map[string]Secret, mounts map[string]MountConfig, workspace string) error {
+	files := make(map[string]string, len(secrets)+len(mounts))
+	for guestPath := range mounts {
+		files[filepath.Clean(guestPath)] = "a VFS mount"
+	}
+	for name, secret := range secrets {
+		if secret.File == "" {
+			if secret.FileRaw {
+				return errx.With(ErrInvalidSecret, " %s: file_raw requires file", name)
+			}
+			continue
+		}
+		if secret.FileRaw && len(secret.Hosts) > 0 {
+			return errx.With(ErrInvalidSecret, " %s: file_raw secrets are not substituted by the proxy and cannot have hosts", name)
+		}
+		if err := ValidateGuestPathWithinWorkspace(secret.File, workspace); err != nil {
+			return errx.With(ErrInvalidSecret, " %s: %w", name, err)
+		}
+		file := filepath.Clean(secret.File)
+		if file == filepath.Clean(workspace) {
+			return errx.With(ErrInvalidSecret, " %s: file cannot be the workspace root", name)
+		}
+		if other, ok := files[file]; ok {
+			return errx.With(ErrInvalidSecret, " %s: file %q already used by %s", name, file, other)
+		}
+		files[file] = name
+	}
+	return nil
+}
@@ -80,3 +80,40 @@ func TestParseSecretHostTrimSpaces(t *testing.T) {
 	assert.Equal(t, "host1.com", secret.Hosts[0])
 	assert.Equal(t, "host2.com", secret.Hosts[1])
 }
+
+func TestValidateSecretFiles(t *testing.T) {
+	mounts := map[string]MountConfig{"/workspace/src": {Type: MountTypeMemory}}
+	tests := []struct {
+		name    string
+		secret  Secret
+		wantErr error
+	}{
+		{"env only", Secret{Value: "v", Hosts: []string{"a.com"}}, nil},
+		{"placeholder file", Secret{Value: "v", Hosts: []string{"a.com"}, File: "/workspace/.secrets/k"}, nil},
+		{"raw file", Secret{Value: "v", File: "/workspace/.ssh/id", FileRaw: true}, nil},
+		{"raw without file", Secret{Value: "v", FileRaw: true}, ErrInvalidSecret},
+		{"raw with hosts", Secret{Value: "v", Hosts: []string{"a.com"}, File: "/workspace/k", FileRaw: true}, ErrInvalidSecret},
+		{"outside workspace", Secret{Value: "v", File: "/etc/k"}, ErrGuestPathOutside},
+		{"relative", Secret{Value: "v", File: "k"}, ErrGuestPathNotAbs},
+		{"workspace root", Secret{Value: "v", File: "/workspace/"}, ErrInvalidSecret},
+		{"mount path", Secret{Value: "v", File: "/workspace/src"}, ErrInvalidSecret},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSecretFiles(map[string]Secret{"K": tt.secret}, mounts, "/workspace")
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateSecretFilesRejectsSharedPath(t *testing.T) {
+	err := ValidateSecretFiles(map[string]Secret{
+		"A": {Value: "a", File: "/workspace/k"},
+		"B": {Value: "b", File: "/workspace/./k"},
+	}, nil, "/workspace")
+	require.ErrorIs(t, err, ErrInvalidSecret)
+}
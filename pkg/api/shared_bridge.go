@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// SharedBridgeName is the host bridge sandboxes with
+// NetworkConfig.SharedBridge attach their TAP devices to. It owns
+// SharedBridgeGatewayIP and is created on first use and left in place.
+const (
+	SharedBridgeName      = "matchlock0"
+	SharedBridgeGatewayIP = "10.99.0.1"
+	SharedBridgeSubnet    = "10.99.0.0/16"
+)
+
+// UsesSharedBridge reports whether the sandbox joins the shared bridge
+// instead of getting its own TAP subnet.
+func (n *NetworkConfig) UsesSharedBridge() bool {
+	return n != nil && n.SharedBridge
+}
+
+// ValidateSharedBridgeIP checks a NetworkConfig.StaticIP for a sandbox on
+// the shared bridge: an address in SharedBridgeSubnet other than the
+// network, gateway or broadcast address.
+func ValidateSharedBridgeIP(ip string) error {
+	_, subnet, _ := net.ParseCIDR(SharedBridgeSubnet)
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil || !subnet.Contains(ip4) {
+		return errx.With(ErrInvalidStaticIP, ": %q (expected an address in %s on the shared bridge)", ip, SharedBridgeSubnet)
+	}
+	if (ip4[2] == 0 && ip4[3] <= 1) || (ip4[2] == 255 && ip4[3] == 255) {
+		return errx.With(ErrInvalidStaticIP, ": %q is the network, gateway or broadcast address", ip)
+	}
+	return nil
+}
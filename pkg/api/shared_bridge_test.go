@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSharedBridgeIP(t *testing.T) {
+	for _, ip := range []string{"10.99.0.2", "10.99.0.255", "10.99.17.1", "10.99.255.254"} {
+		require.NoError(t, ValidateSharedBridgeIP(ip), ip)
+	}
+	for _, ip := range []string{"", "192.168.120.7", "10.98.0.2", "10.99.0.0", "10.99.0.1", "10.99.255.255", "::1"} {
+		require.ErrorIs(t, ValidateSharedBridgeIP(ip), ErrInvalidStaticIP, ip)
+	}
+}
+
+func TestConfigValidateSharedBridgeStaticIP(t *testing.T) {
+	cfg := &Config{Image: "alpine", Network: &NetworkConfig{SharedBridge: true, StaticIP: "10.99.3.20"}}
+	require.NoError(t, cfg.Validate())
+	require.True(t, cfg.Network.UsesSharedBridge())
+
+	cfg.Network.StaticIP = "192.168.120.7"
+	require.ErrorIs(t, cfg.Validate(), ErrInvalidStaticIP)
+
+	cfg.Network.SharedBridge = false
+	require.NoError(t, cfg.Validate())
+	require.False(t, cfg.Network.UsesSharedBridge())
+}
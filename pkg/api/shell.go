@@ -1,9 +1,22 @@
 package api
 
-import shellquote "github.com/kballard/go-shellquote"
+import (
+	"github.com/jingkaihe/matchlock/internal/errx"
+	shellquote "github.com/kballard/go-shellquote"
+)
 
 // ShellQuoteArgs joins command arguments into a single shell-safe string
 // using POSIX shell quoting rules.
 func ShellQuoteArgs(args []string) string {
 	return shellquote.Join(args...)
 }
+
+// ShellSplitArgs splits a shell-style command string into arguments using
+// POSIX shell quoting rules. It is the inverse of ShellQuoteArgs.
+func ShellSplitArgs(s string) ([]string, error) {
+	args, err := shellquote.Split(s)
+	if err != nil {
+		return nil, errx.With(ErrShellSplit, " %q: %w", s, err)
+	}
+	return args, nil
+}
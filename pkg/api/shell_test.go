@@ -52,6 +52,23 @@ func TestShellQuoteArgsBackslash(t *testing.T) {
 	assertRoundTrips(t, ShellQuoteArgs([]string{"echo", `a\b`}), []string{"echo", `a\b`})
 }
 
+func TestShellSplitArgs(t *testing.T) {
+	got, err := ShellSplitArgs(`node server.js --name "hello world"`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"node", "server.js", "--name", "hello world"}, got)
+}
+
+func TestShellSplitArgsEmpty(t *testing.T) {
+	got, err := ShellSplitArgs("")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestShellSplitArgsUnterminatedQuote(t *testing.T) {
+	_, err := ShellSplitArgs(`echo "oops`)
+	require.ErrorIs(t, err, ErrShellSplit)
+}
+
 // assertRoundTrips verifies that the quoted string splits back into the original args.
 func assertRoundTrips(t *testing.T, quoted string, want []string) {
 	t.Helper()
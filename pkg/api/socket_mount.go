@@ -0,0 +1,42 @@
+package api
+
+import (
+	"path/filepath"
+	"sort"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// maxSocketPathLen is the usable length of sockaddr_un.sun_path on Linux.
+const maxSocketPathLen = 107
+
+// ValidateSocketMounts checks Config.SocketMounts. Guest paths reach the
+// guest on the kernel cmdline, so they must be plain absolute paths, short
+// enough for a unix socket address and outside the workspace (the VFS cannot
+// hold sockets). Host paths must be absolute.
+func ValidateSocketMounts(mounts map[string]string, workspace string) error {
+	for _, guestPath := range SocketMountPaths(mounts) {
+		hostPath := mounts[guestPath]
+		switch {
+		case !validGuestMountPath.MatchString(guestPath) || filepath.Clean(guestPath) != guestPath:
+			return errx.With(ErrInvalidSocketMount, ": guest path %q must be a clean absolute path containing only alphanumeric, '/', '_', '.', '-'", guestPath)
+		case len(guestPath) > maxSocketPathLen:
+			return errx.With(ErrInvalidSocketMount, ": guest path %q is longer than %d bytes", guestPath, maxSocketPathLen)
+		case isWithinWorkspace(guestPath, workspace):
+			return errx.With(ErrInvalidSocketMount, ": guest path %q must be outside the workspace %q", guestPath, workspace)
+		case !filepath.IsAbs(hostPath):
+			return errx.With(ErrInvalidSocketMount, ": host path %q for %s must be absolute", hostPath, guestPath)
+		}
+	}
+	return nil
+}
+
+// SocketMountPaths returns the guest paths of mounts in sorted order.
+func SocketMountPaths(mounts map[string]string) []string {
+	paths := make([]string, 0, len(mounts))
+	for guestPath := range mounts {
+		paths = append(paths, guestPath)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSocketMounts(t *testing.T) {
+	require.NoError(t, ValidateSocketMounts(nil, DefaultWorkspace))
+	require.NoError(t, ValidateSocketMounts(map[string]string{
+		"/var/run/docker.sock": "/var/run/docker.sock",
+		"/run/model.sock":      "/tmp/model.sock",
+	}, DefaultWorkspace))
+
+	for _, mounts := range []map[string]string{
+		{"var/run/docker.sock": "/var/run/docker.sock"},
+		{"/run/my socket": "/tmp/s.sock"},
+		{"/run/../etc/s.sock": "/tmp/s.sock"},
+		{"/workspace/docker.sock": "/var/run/docker.sock"},
+		{"/run/s.sock": "s.sock"},
+		{"/run/" + strings.Repeat("a", 120): "/tmp/s.sock"},
+	} {
+		assert.ErrorIs(t, ValidateSocketMounts(mounts, DefaultWorkspace), ErrInvalidSocketMount, "%v", mounts)
+	}
+}
+
+func TestConfigValidateChecksSocketMounts(t *testing.T) {
+	config := &Config{Image: "alpine:latest", SocketMounts: map[string]string{"/code/app.sock": "/tmp/app.sock"}}
+	require.NoError(t, config.Validate())
+
+	config.VFS = &VFSConfig{Workspace: "/code"}
+	err := config.Validate()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.ErrorIs(t, err, ErrInvalidSocketMount)
+}
+
+func TestSocketMountPathsSorted(t *testing.T) {
+	paths := SocketMountPaths(map[string]string{"/run/b.sock": "/b", "/run/a.sock": "/a"})
+	assert.Equal(t, []string{"/run/a.sock", "/run/b.sock"}, paths)
+}
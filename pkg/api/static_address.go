@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"net"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// derivedMACPrefix starts the MACs the Linux backend derives from sandbox
+// IDs; static MACs stay out of it so they cannot collide with a default.
+var derivedMACPrefix = []byte{0xaa, 0xfc}
+
+// StaticAddress returns the pinned guest IP and MAC, either of which may be
+// empty.
+func (n *NetworkConfig) StaticAddress() (ip, mac string) {
+	if n == nil {
+		return "", ""
+	}
+	return n.StaticIP, n.StaticMAC
+}
+
+// ValidateStaticMAC checks NetworkConfig.StaticMAC is a unicast Ethernet
+// address outside the range matchlock derives default MACs from.
+func ValidateStaticMAC(mac string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 {
+		return errx.With(ErrInvalidStaticMAC, ": %q (expected xx:xx:xx:xx:xx:xx)", mac)
+	}
+	if hw[0]&0x01 != 0 {
+		return errx.With(ErrInvalidStaticMAC, ": %q is a multicast address", mac)
+	}
+	if bytes.Equal(hw, make(net.HardwareAddr, 6)) {
+		return errx.With(ErrInvalidStaticMAC, ": %q is the zero address", mac)
+	}
+	if bytes.HasPrefix(hw, derivedMACPrefix) {
+		return errx.With(ErrInvalidStaticMAC, ": %q is in the aa:fc:... range reserved for derived MACs", mac)
+	}
+	return nil
+}
+
+// ValidateStaticIP checks NetworkConfig.StaticIP is a guest address in one
+// of the per-VM subnets, 192.168.100.0/24 through 192.168.254.0/24. The
+// sandbox gets the whole /24; .1 is its gateway, so the guest may use .2
+// through .254.
+func ValidateStaticIP(ip string) error {
+	ip4 := net.ParseIP(ip).To4()
+	if ip4 == nil || ip4[0] != 192 || ip4[1] != 168 || ip4[2] < 100 || ip4[2] > 254 {
+		return errx.With(ErrInvalidStaticIP, ": %q (expected 192.168.100.2 - 192.168.254.254)", ip)
+	}
+	if ip4[3] < 2 || ip4[3] > 254 {
+		return errx.With(ErrInvalidStaticIP, ": %q is the network, gateway or broadcast address", ip)
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateStaticMAC(t *testing.T) {
+	for _, mac := range []string{"02:00:00:12:34:56", "52:54:00:ab:cd:ef", "06-00-00-00-00-01"} {
+		require.NoError(t, ValidateStaticMAC(mac), mac)
+	}
+	for _, mac := range []string{"", "02:00:00:12:34", "01:00:5e:00:00:01", "00:00:00:00:00:00", "aa:fc:00:00:00:01", "02:00:00:00:00:00:00:01", "nope"} {
+		require.ErrorIs(t, ValidateStaticMAC(mac), ErrInvalidStaticMAC, mac)
+	}
+}
+
+func TestValidateStaticIP(t *testing.T) {
+	for _, ip := range []string{"192.168.100.2", "192.168.150.42", "192.168.254.254"} {
+		require.NoError(t, ValidateStaticIP(ip), ip)
+	}
+	for _, ip := range []string{"", "10.0.0.2", "192.168.99.2", "192.168.255.2", "192.168.120.0", "192.168.120.1", "192.168.120.255", "::1"} {
+		require.ErrorIs(t, ValidateStaticIP(ip), ErrInvalidStaticIP, ip)
+	}
+}
+
+func TestConfigValidateStaticAddress(t *testing.T) {
+	cfg := &Config{Image: "alpine", Network: &NetworkConfig{StaticMAC: "02:00:00:00:00:01", StaticIP: "192.168.120.7"}}
+	require.NoError(t, cfg.Validate())
+
+	cfg.Network.StaticIP = "192.168.120.1"
+	require.ErrorIs(t, cfg.Validate(), ErrInvalidStaticIP)
+
+	cfg.Network.StaticIP = ""
+	cfg.Network.StaticMAC = "ff:ff:ff:ff:ff:ff"
+	require.ErrorIs(t, cfg.Validate(), ErrInvalidStaticMAC)
+}
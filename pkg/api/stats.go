@@ -0,0 +1,33 @@
+package api
+
+import "time"
+
+// Stats is a point-in-time resource usage sample for one sandbox, as
+// reported by the stats RPC. Guest figures come from the guest agent; the
+// host figures are only filled in by backends that can read them, and are
+// zero otherwise.
+type Stats struct {
+	// CPUUsageUsec is the total CPU time the guest has spent across all
+	// vCPUs since boot.
+	CPUUsageUsec uint64 `json:"cpu_usage_usec"`
+	// MemoryUsedBytes and MemoryTotalBytes are guest memory in use and
+	// guest memory in total, as free(1) reports them inside the VM.
+	MemoryUsedBytes  uint64 `json:"memory_used_bytes"`
+	MemoryTotalBytes uint64 `json:"memory_total_bytes"`
+	// ActiveExecs is the number of exec sessions running in the guest.
+	ActiveExecs int `json:"active_execs"`
+
+	// VMMRSSBytes is the resident memory of the host VMM process.
+	VMMRSSBytes uint64 `json:"vmm_rss_bytes,omitempty"`
+	// NetRxBytes and NetTxBytes are bytes received and sent by the guest
+	// over its network device, read from the host side of the device.
+	NetRxBytes uint64 `json:"net_rx_bytes,omitempty"`
+	NetTxBytes uint64 `json:"net_tx_bytes,omitempty"`
+	// CgroupCPUUsageUsec and CgroupMemoryBytes cover the whole VM (vCPUs,
+	// device emulation and VMM overhead) as the host accounts it in the
+	// VM's cgroup. They are only set for VMs run under a CgroupParent.
+	CgroupCPUUsageUsec uint64 `json:"cgroup_cpu_usage_usec,omitempty"`
+	CgroupMemoryBytes  uint64 `json:"cgroup_memory_bytes,omitempty"`
+
+	Time time.Time `json:"time"`
+}
@@ -0,0 +1,20 @@
+package api
+
+import "github.com/jingkaihe/matchlock/internal/errx"
+
+// MaxSwapRatio caps zram swap relative to guest memory. zram keeps swapped
+// pages compressed in guest RAM, so swap well beyond memory only buys
+// thrashing.
+const MaxSwapRatio = 2
+
+// ValidateSwap checks a zram swap size in MB against the guest memory size.
+// Zero disables swap.
+func ValidateSwap(swapMB, memoryMB int) error {
+	if swapMB < 0 {
+		return errx.With(ErrInvalidSwap, ": %d MB must not be negative", swapMB)
+	}
+	if memoryMB > 0 && swapMB > memoryMB*MaxSwapRatio {
+		return errx.With(ErrInvalidSwap, ": %d MB exceeds %dx memory (%d MB)", swapMB, MaxSwapRatio, memoryMB)
+	}
+	return nil
+}
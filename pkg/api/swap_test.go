@@ -0,0 +1,15 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateSwap(t *testing.T) {
+	require.NoError(t, ValidateSwap(0, 512))
+	require.NoError(t, ValidateSwap(1024, 512))
+	assert.ErrorIs(t, ValidateSwap(-1, 512), ErrInvalidSwap)
+	assert.ErrorIs(t, ValidateSwap(1025, 512), ErrInvalidSwap)
+}
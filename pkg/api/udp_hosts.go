@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// ParseUDPHost splits an AllowedUDPHosts entry into its host pattern and
+// port. A bare host allows every port and returns port 0.
+func ParseUDPHost(entry string) (host string, port int, err error) {
+	host = entry
+	if strings.Contains(entry, ":") {
+		var rawPort string
+		host, rawPort, err = net.SplitHostPort(entry)
+		if err != nil {
+			return "", 0, errx.With(ErrInvalidUDPHost, ": %q (expected host or host:port)", entry)
+		}
+		port, err = strconv.Atoi(rawPort)
+		if err != nil || port < 1 || port > 65535 {
+			return "", 0, errx.With(ErrInvalidUDPHost, ": %q (invalid port)", entry)
+		}
+	}
+	if host == "" || strings.ContainsAny(host, " \t,") {
+		return "", 0, errx.With(ErrInvalidUDPHost, ": %q (invalid host)", entry)
+	}
+	return host, port, nil
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUDPHost(t *testing.T) {
+	host, port, err := ParseUDPHost("dns.example.com:53")
+	require.NoError(t, err)
+	assert.Equal(t, "dns.example.com", host)
+	assert.Equal(t, 53, port)
+
+	host, port, err = ParseUDPHost("*.quic.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "*.quic.example.com", host)
+	assert.Zero(t, port)
+
+	host, port, err = ParseUDPHost("10.0.0.5:443")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.5", host)
+	assert.Equal(t, 443, port)
+
+	for _, entry := range []string{"", ":53", "host:0", "host:dns", "host:70000", "a,b", "a b:53", "a:b:c"} {
+		_, _, err := ParseUDPHost(entry)
+		require.ErrorIs(t, err, ErrInvalidUDPHost, entry)
+	}
+}
+
+func TestValidateRejectsInvalidUDPHost(t *testing.T) {
+	cfg := &Config{Image: "alpine:latest", Network: &NetworkConfig{AllowedUDPHosts: []string{"resolver.example.com:0"}}}
+	err := cfg.Validate()
+	require.ErrorIs(t, err, ErrInvalidConfig)
+	require.ErrorIs(t, err, ErrInvalidUDPHost)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// UlimitUnlimited is RLIM_INFINITY, written "unlimited" in ulimit specs.
+const UlimitUnlimited = uint64(math.MaxUint64)
+
+// UlimitNames are the resource limits Ulimits can set on guest commands.
+var UlimitNames = []string{"core", "nofile", "nproc", "stack"}
+
+// Ulimit is a soft/hard resource limit pair applied with setrlimit to every
+// guest command before it starts.
+type Ulimit struct {
+	Soft uint64 `json:"soft"`
+	Hard uint64 `json:"hard"`
+}
+
+// ParseUlimit parses a docker-style "name=soft[:hard]" spec, for example
+// "nofile=65536" or "nofile=1024:65536". A missing hard limit equals the
+// soft one; either may be "unlimited".
+func ParseUlimit(spec string) (string, Ulimit, error) {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok || value == "" {
+		return "", Ulimit{}, errx.With(ErrInvalidUlimit, ": %q (expected name=soft[:hard])", spec)
+	}
+	name = strings.ToLower(strings.TrimSpace(name))
+
+	softStr, hardStr, hasHard := strings.Cut(value, ":")
+	soft, err := parseUlimitValue(softStr)
+	if err != nil {
+		return "", Ulimit{}, errx.With(ErrInvalidUlimit, ": %q: %w", spec, err)
+	}
+	hard := soft
+	if hasHard {
+		if hard, err = parseUlimitValue(hardStr); err != nil {
+			return "", Ulimit{}, errx.With(ErrInvalidUlimit, ": %q: %w", spec, err)
+		}
+	}
+
+	limit := Ulimit{Soft: soft, Hard: hard}
+	if err := validateUlimit(name, limit); err != nil {
+		return "", Ulimit{}, err
+	}
+	return name, limit, nil
+}
+
+// ParseUlimits parses repeated ParseUlimit specs; a later spec for the same
+// name wins.
+func ParseUlimits(specs []string) (map[string]Ulimit, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	ulimits := make(map[string]Ulimit, len(specs))
+	for _, spec := range specs {
+		name, limit, err := ParseUlimit(spec)
+		if err != nil {
+			return nil, err
+		}
+		ulimits[name] = limit
+	}
+	return ulimits, nil
+}
+
+func parseUlimitValue(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if strings.EqualFold(s, "unlimited") {
+		return UlimitUnlimited, nil
+	}
+	return strconv.ParseUint(s, 10, 64)
+}
+
+// ValidateUlimits checks that every name is in UlimitNames and that no soft
+// limit exceeds its hard limit.
+func ValidateUlimits(ulimits map[string]Ulimit) error {
+	for _, name := range sortedUlimitNames(ulimits) {
+		if err := validateUlimit(name, ulimits[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateUlimit(name string, limit Ulimit) error {
+	known := false
+	for _, n := range UlimitNames {
+		if n == name {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return errx.With(ErrInvalidUlimit, ": unknown limit %q (allowed: %s)", name, strings.Join(UlimitNames, ", "))
+	}
+	if limit.Soft > limit.Hard {
+		return errx.With(ErrInvalidUlimit, ": %s soft limit %d exceeds hard limit %d", name, limit.Soft, limit.Hard)
+	}
+	return nil
+}
+
+// FormatUlimits encodes ulimits as "name:soft:hard" entries joined by
+// commas, sorted by name, for the guest kernel cmdline. Unlimited values
+// are written as -1.
+func FormatUlimits(ulimits map[string]Ulimit) string {
+	entries := make([]string, 0, len(ulimits))
+	for _, name := range sortedUlimitNames(ulimits) {
+		limit := ulimits[name]
+		entries = append(entries, name+":"+formatUlimitValue(limit.Soft)+":"+formatUlimitValue(limit.Hard))
+	}
+	return strings.Join(entries, ",")
+}
+
+func formatUlimitValue(v uint64) string {
+	if v == UlimitUnlimited {
+		return "-1"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func sortedUlimitNames(ulimits map[string]Ulimit) []string {
+	names := make([]string, 0, len(ulimits))
+	for name := range ulimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
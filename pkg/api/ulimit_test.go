@@ -0,0 +1,67 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUlimit(t *testing.T) {
+	tests := []struct {
+		spec string
+		name string
+		want Ulimit
+	}{
+		{"nofile=65536", "nofile", Ulimit{Soft: 65536, Hard: 65536}},
+		{"NOFILE=1024:65536", "nofile", Ulimit{Soft: 1024, Hard: 65536}},
+		{"core=0", "core", Ulimit{}},
+		{"stack=8388608:unlimited", "stack", Ulimit{Soft: 8388608, Hard: UlimitUnlimited}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			name, got, err := ParseUlimit(tt.spec)
+			require.NoError(t, err)
+			assert.Equal(t, tt.name, name)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseUlimits(t *testing.T) {
+	got, err := ParseUlimits([]string{"nofile=1024", "core=0", "nofile=4096:8192"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Ulimit{"nofile": {Soft: 4096, Hard: 8192}, "core": {}}, got)
+
+	got, err = ParseUlimits(nil)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestParseUlimitRejectsInvalidSpecs(t *testing.T) {
+	for _, spec := range []string{"nofile", "nofile=", "nofile=abc", "nofile=10:x", "nofile=65536:1024", "fsize=10"} {
+		t.Run(spec, func(t *testing.T) {
+			_, _, err := ParseUlimit(spec)
+			assert.ErrorIs(t, err, ErrInvalidUlimit)
+		})
+	}
+}
+
+func TestValidateRejectsInvalidUlimits(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Image = "alpine:latest"
+	cfg.Ulimits = map[string]Ulimit{"nproc": {Soft: 10, Hard: 5}}
+	assert.ErrorIs(t, cfg.Validate(), ErrInvalidUlimit)
+
+	cfg.Ulimits = map[string]Ulimit{"nproc": {Soft: 5, Hard: 10}}
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestFormatUlimits(t *testing.T) {
+	assert.Equal(t, "core:0:0,nofile:1024:65536,stack:-1:-1", FormatUlimits(map[string]Ulimit{
+		"nofile": {Soft: 1024, Hard: 65536},
+		"core":   {},
+		"stack":  {Soft: UlimitUnlimited, Hard: UlimitUnlimited},
+	}))
+	assert.Empty(t, FormatUlimits(nil))
+}
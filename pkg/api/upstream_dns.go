@@ -0,0 +1,20 @@
+package api
+
+import (
+	"net"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// UpstreamDNSAddr returns the host:port of an upstream DNS server given as
+// an IP address or IP:port. The port defaults to 53.
+func UpstreamDNSAddr(server string) (string, error) {
+	if ip := net.ParseIP(server); ip != nil {
+		return net.JoinHostPort(ip.String(), "53"), nil
+	}
+	host, port, err := net.SplitHostPort(server)
+	if err != nil || net.ParseIP(host) == nil || port == "" {
+		return "", errx.With(ErrInvalidUpstreamDNS, ": %q (expected ip or ip:port)", server)
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpstreamDNSAddr(t *testing.T) {
+	for server, want := range map[string]string{
+		"10.0.0.53":       "10.0.0.53:53",
+		"10.0.0.53:5353":  "10.0.0.53:5353",
+		"2001:db8::1":     "[2001:db8::1]:53",
+		"[2001:db8::1]:5": "[2001:db8::1]:5",
+	} {
+		got, err := UpstreamDNSAddr(server)
+		require.NoError(t, err, server)
+		assert.Equal(t, want, got, server)
+	}
+
+	for _, server := range []string{"", "dns.internal", "dns.internal:53", "10.0.0.53:"} {
+		_, err := UpstreamDNSAddr(server)
+		assert.ErrorIs(t, err, ErrInvalidUpstreamDNS, server)
+	}
+}
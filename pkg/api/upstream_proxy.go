@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// UpstreamProxyNone as NetworkConfig.UpstreamProxy makes the host-side
+// proxy connect upstream directly, ignoring HTTPS_PROXY.
+const UpstreamProxyNone = "none"
+
+// ParseUpstreamProxy parses an upstream proxy URL with scheme http, https,
+// socks5 or socks5h and optional user:password credentials. A value with
+// no scheme is taken as http://, as curl does. It returns nil for "" and
+// UpstreamProxyNone.
+func ParseUpstreamProxy(raw string) (*url.URL, error) {
+	if raw == "" || raw == UpstreamProxyNone {
+		return nil, nil
+	}
+	value := raw
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, errx.With(ErrInvalidUpstreamProxy, ": %q: %w", raw, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, errx.With(ErrInvalidUpstreamProxy, ": %q: unsupported scheme %q (expected http, https, socks5 or socks5h)", raw, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errx.With(ErrInvalidUpstreamProxy, ": %q: missing host", raw)
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return nil, errx.With(ErrInvalidUpstreamProxy, ": %q: unexpected path or query", raw)
+	}
+	return u, nil
+}
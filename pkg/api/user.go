@@ -0,0 +1,19 @@
+package api
+
+import (
+	"regexp"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+var userSpecRe = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*(:[A-Za-z0-9_][A-Za-z0-9._-]*)?$`)
+
+// ValidateUserSpec checks that spec is a user as the guest resolves it:
+// "name", "uid", "name:group" or "uid:gid". It does not check that the user
+// exists in the image; guest-init does that at boot.
+func ValidateUserSpec(spec string) error {
+	if !userSpecRe.MatchString(spec) {
+		return errx.With(ErrInvalidUser, ": %q (expected user, uid, user:group or uid:gid)", spec)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateUserSpec(t *testing.T) {
+	for _, spec := range []string{"appuser", "1000", "1000:1000", "www-data:www-data", "_apt", "nginx.svc"} {
+		assert.NoError(t, ValidateUserSpec(spec), spec)
+	}
+	for _, spec := range []string{"", "app user", "1000:", ":1000", "a:b:c", "-root", "user,evil"} {
+		require.ErrorIs(t, ValidateUserSpec(spec), ErrInvalidUser, spec)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// Validate checks a sandbox configuration before any resources are created.
+// It is shared by the CLI, config files and the RPC create method.
+func (c *Config) Validate() error {
+	if c.Image == "" {
+		return errx.With(ErrInvalidConfig, ": image is required")
+	}
+
+	if r := c.Resources; r != nil {
+		if r.CPUs < 0 || r.MemoryMB < 0 || r.DiskSizeMB < 0 || r.TimeoutSeconds < 0 {
+			return errx.With(ErrInvalidConfig, ": resources must not be negative")
+		}
+		if err := ValidateSwap(r.SwapMB, r.MemoryMB); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+		if err := ValidateCPUAffinity(r.CPUAffinity); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+		if err := ValidateCgroupParent(r.CgroupParent); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+	}
+
+	if c.StopGracePeriodSeconds < 0 {
+		return errx.With(ErrInvalidConfig, ": stop_grace_period_seconds must not be negative")
+	}
+
+	if c.EventBufferSize < 0 {
+		return errx.With(ErrInvalidConfig, ": event_buffer_size must not be negative")
+	}
+
+	if c.RequireSignature && len(c.TrustedKeys) == 0 {
+		return errx.With(ErrInvalidConfig, ": require_signature needs at least one trusted key")
+	}
+
+	if ic := c.ImageCfg; ic != nil && ic.User != "" {
+		if err := ValidateUserSpec(ic.User); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+	}
+
+	for _, command := range c.InitCommands {
+		if strings.TrimSpace(command) == "" {
+			return errx.With(ErrInvalidConfig, ": init commands must not be empty")
+		}
+	}
+
+	for key := range c.Labels {
+		if key == "" {
+			return errx.With(ErrInvalidConfig, ": label keys must not be empty")
+		}
+	}
+
+	if n := c.Network; n != nil {
+		if n.MTU < 0 {
+			return errx.With(ErrInvalidConfig, ": network mtu must not be negative")
+		}
+		if n.MaxConcurrentConnections < 0 || n.MaxConnectionsPerHost < 0 {
+			return errx.With(ErrInvalidConfig, ": connection limits must not be negative")
+		}
+		if n.HostApprovalTimeoutSeconds < 0 {
+			return errx.With(ErrInvalidConfig, ": host approval timeout must not be negative")
+		}
+		for _, mapping := range n.AddHosts {
+			if err := ValidateAddHost(mapping); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		for _, rule := range n.MirrorRoutes {
+			if err := ValidateMirrorRule(rule); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		for _, server := range n.UpstreamDNS {
+			if _, err := UpstreamDNSAddr(server); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		if _, err := ParseUpstreamProxy(n.UpstreamProxy); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+		if n.StaticMAC != "" {
+			if err := ValidateStaticMAC(n.StaticMAC); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		if n.StaticIP != "" {
+			validateIP := ValidateStaticIP
+			if n.SharedBridge {
+				validateIP = ValidateSharedBridgeIP
+			}
+			if err := validateIP(n.StaticIP); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		if n.NetworkProbe != "" {
+			if err := ValidateNetworkProbe(n.NetworkProbe); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		for _, entry := range n.AllowedUDPHosts {
+			if _, _, err := ParseUDPHost(entry); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		for _, domain := range n.SearchDomains {
+			if err := ValidateSearchDomain(domain); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		for _, option := range n.ResolvOptions {
+			if err := ValidateResolvOption(option); err != nil {
+				return errx.With(ErrInvalidConfig, ": %w", err)
+			}
+		}
+		var mounts map[string]MountConfig
+		if c.VFS != nil {
+			mounts = c.VFS.Mounts
+		}
+		if err := ValidateSecretFiles(n.Secrets, mounts, c.GetWorkspace()); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+	}
+
+	if _, err := CapabilityNumbers(c.CapAdd); err != nil {
+		return errx.With(ErrInvalidConfig, " (cap_add): %w", err)
+	}
+	if _, err := CapabilityNumbers(c.CapDrop); err != nil {
+		return errx.With(ErrInvalidConfig, " (cap_drop): %w", err)
+	}
+	if _, err := NormalizeAllowSyscalls(c.AllowSyscalls); err != nil {
+		return errx.With(ErrInvalidConfig, " (allow_syscalls): %w", err)
+	}
+	if err := ValidateUlimits(c.Ulimits); err != nil {
+		return errx.With(ErrInvalidConfig, ": %w", err)
+	}
+
+	if err := ValidateSocketMounts(c.SocketMounts, c.GetWorkspace()); err != nil {
+		return errx.With(ErrInvalidConfig, ": %w", err)
+	}
+
+	if c.VFS != nil && c.VFS.CompressMinBytes < 0 {
+		return errx.With(ErrInvalidConfig, ": vfs.compress_min_bytes must not be negative")
+	}
+	if c.VFS != nil && c.VFS.Workspace != "" {
+		if err := ValidateWorkspace(c.VFS.Workspace); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+	}
+	if c.VFS != nil && len(c.VFS.Mounts) > 0 {
+		if err := ValidateVFSMountsWithinWorkspace(c.VFS.Mounts, c.GetWorkspace()); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+	}
+	if c.VFS != nil && c.VFS.Interception != nil {
+		for _, rule := range c.VFS.Interception.Rules {
+			if isVFSHookCallbackAction(rule.Action) && strings.EqualFold(rule.Phase, "after") {
+				return errx.With(ErrInvalidConfig, ": %w %q", ErrCallbackRulePhase, rule.Name)
+			}
+		}
+	}
+	for _, disk := range c.ExtraDisks {
+		if err := ValidateGuestMount(disk.GuestMount); err != nil {
+			return errx.With(ErrInvalidConfig, ": %w", err)
+		}
+	}
+	return nil
+}
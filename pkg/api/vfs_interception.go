@@ -1,11 +1,86 @@
 package api
 
+import (
+	"context"
+	"strings"
+)
+
+// VFSHookActionCallback makes the host ask the RPC client that created the
+// sandbox for an allow/block decision before each matching operation the
+// guest makes through its mounted workspace.
+const VFSHookActionCallback = "callback"
+
+// VFSHookActionMutateCallback makes the host ask the RPC client that created
+// the sandbox for replacement bytes before each matching write the guest
+// makes through its mounted workspace.
+const VFSHookActionMutateCallback = "mutate_callback"
+
 // VFSInterceptionConfig configures host-side VFS interception rules.
 type VFSInterceptionConfig struct {
 	// EmitEvents enables file-operation event notifications.
 	EmitEvents bool `json:"emit_events,omitempty"`
 
 	Rules []VFSHookRule `json:"rules,omitempty"`
+
+	// Decider answers callback rules. It is set by the RPC handler and is
+	// never serialized; without it callback rules block.
+	Decider VFSHookDecider `json:"-"`
+
+	// Mutator answers mutate_callback rules. Like Decider it is set by the
+	// RPC handler; without it matching guest writes fail.
+	Mutator VFSHookMutator `json:"-"`
+}
+
+// VFSHookDecisionRequest describes a guest operation waiting for a callback
+// rule's decision. Rule is the index of the rule among the callback rules of
+// the interception config, in order.
+type VFSHookDecisionRequest struct {
+	Rule int    `json:"rule"`
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	Size int    `json:"size,omitempty"`
+	Mode uint32 `json:"mode,omitempty"`
+	UID  int    `json:"uid"`
+	GID  int    `json:"gid"`
+}
+
+// VFSHookDecider returns "allow" or "block" for a callback rule. Anything
+// else, including an expired ctx, is treated as block.
+type VFSHookDecider func(ctx context.Context, req VFSHookDecisionRequest) string
+
+// VFSHookMutateRequest describes a guest write waiting for a
+// mutate_callback rule's replacement bytes. Rule is the index of the rule
+// among the mutate_callback rules of the interception config, in order.
+// Data holds a single write as the guest issued it, not the whole file.
+type VFSHookMutateRequest struct {
+	Rule   int    `json:"rule"`
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data"`
+	Mode   uint32 `json:"mode,omitempty"`
+	UID    int    `json:"uid"`
+	GID    int    `json:"gid"`
+}
+
+// VFSHookMutator returns the bytes to write in place of req.Data. An error,
+// including an expired ctx, fails the guest write.
+type VFSHookMutator func(ctx context.Context, req VFSHookMutateRequest) ([]byte, error)
+
+// HasCallbackRules reports whether any rule needs a Decider or a Mutator.
+func (c *VFSInterceptionConfig) HasCallbackRules() bool {
+	if c == nil {
+		return false
+	}
+	for _, rule := range c.Rules {
+		if isVFSHookCallbackAction(rule.Action) {
+			return true
+		}
+	}
+	return false
+}
+
+func isVFSHookCallbackAction(action string) bool {
+	return strings.EqualFold(action, VFSHookActionCallback) || strings.EqualFold(action, VFSHookActionMutateCallback)
 }
 
 // VFSHookRule describes a single interception rule.
@@ -24,10 +99,11 @@ type VFSHookRule struct {
 	// Empty matches all paths.
 	Path string `json:"path,omitempty"`
 
-	// Action is one of: allow, block.
+	// Action is one of: allow, block, callback, mutate_callback.
 	Action string `json:"action"`
 
-	// TimeoutMS is interpreted by SDK-local callback execution and ignored by
-	// host wire rules.
+	// TimeoutMS bounds SDK-local callbacks and, for callback and
+	// mutate_callback rules, how long the host waits for an answer before
+	// failing the operation (default 5s).
 	TimeoutMS int `json:"timeout_ms,omitempty"`
 }
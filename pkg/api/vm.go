@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
 )
 
 type ExecOptions struct {
@@ -13,6 +15,51 @@ type ExecOptions struct {
 	Stdout     io.Writer
 	Stderr     io.Writer
 	User       string // "uid", "uid:gid", or username — resolved in guest
+	TraceID    string // correlates this exec's events; generated when empty
+	// LoginShell runs the command with "sh -lc" instead of "sh -c", so
+	// /etc/profile and ~/.profile run first and PATH additions made there
+	// (conda, nvm, ...) apply. Profile scripts may override Env values.
+	LoginShell bool
+	// Shell is the argv the command string is appended to, e.g.
+	// ["bash", "-c"]. Empty means "sh -c".
+	Shell []string
+	// Args, when set, is run directly as the process argv with no shell, so
+	// images without /bin/sh (distroless, scratch) can exec. Args[0] is
+	// looked up in the command's PATH; the command string then only
+	// describes the exec in events.
+	Args []string
+	// TimeoutMS, when positive, has the guest agent kill the command's
+	// process group after that many milliseconds. The result then has
+	// TimedOut set and ExitCode ExecTimeoutExitCode, and Exec returns it
+	// alongside ErrExecTimeout.
+	TimeoutMS int
+	// Setup runs the command as a guest setup step: in the guest's root
+	// namespaces, with the agent's full capabilities and no seccomp
+	// filter or no_new_privs. The guest agent accepts it only until the
+	// first ordinary exec. The sandbox sets it for Config.InitCommands;
+	// it is not exposed over RPC.
+	Setup bool
+}
+
+// ExecTimeoutExitCode is the exit code of a command killed by its
+// ExecOptions.TimeoutMS, matching GNU timeout.
+const ExecTimeoutExitCode = 124
+
+// Validate reports option combinations the guest cannot honour.
+func (o *ExecOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if len(o.Args) > 0 && (len(o.Shell) > 0 || o.LoginShell) {
+		return errx.With(ErrInvalidExecOptions, ": args run without a shell and cannot be combined with shell or login_shell")
+	}
+	if len(o.Shell) > 0 && o.LoginShell {
+		return errx.With(ErrInvalidExecOptions, ": shell cannot be combined with login_shell")
+	}
+	if o.TimeoutMS < 0 {
+		return errx.With(ErrInvalidExecOptions, ": timeout must not be negative")
+	}
+	return nil
 }
 
 type ExecResult struct {
@@ -21,6 +68,13 @@ type ExecResult struct {
 	Stderr     []byte        `json:"stderr,omitempty"`
 	DurationMS int64         `json:"duration_ms"`
 	Duration   time.Duration `json:"-"`
+	// Resource usage of the command and its reaped descendants, as reported
+	// by the guest's wait4. Zero when the guest could not report it.
+	UserTimeMS int64 `json:"user_time_ms,omitempty"`
+	SysTimeMS  int64 `json:"sys_time_ms,omitempty"`
+	MaxRSSKB   int64 `json:"max_rss_kb,omitempty"`
+	// TimedOut reports the guest killed the command at its TimeoutMS.
+	TimedOut bool `json:"timed_out,omitempty"`
 }
 
 type FileInfo struct {
@@ -45,11 +99,66 @@ type VM interface {
 }
 
 type Event struct {
-	Type      string        `json:"type"`
-	Timestamp int64         `json:"timestamp"`
-	Network   *NetworkEvent `json:"network,omitempty"`
-	File      *FileEvent    `json:"file,omitempty"`
-	Exec      *ExecEvent    `json:"exec,omitempty"`
+	Type      string         `json:"type"`
+	Timestamp int64          `json:"timestamp"`
+	TraceID   string         `json:"trace_id,omitempty"`
+	Network   *NetworkEvent  `json:"network,omitempty"`
+	File      *FileEvent     `json:"file,omitempty"`
+	Exec      *ExecEvent     `json:"exec,omitempty"`
+	Syscall   *SyscallEvent  `json:"syscall,omitempty"`
+	Security  *SecurityEvent `json:"security,omitempty"`
+	Dropped   *EventsDropped `json:"dropped,omitempty"`
+	// ConnectionLimited is set on "connection_limited" events.
+	ConnectionLimited *ConnectionLimited `json:"connection_limited,omitempty"`
+	// HostDenied is set on "host_denied" events.
+	HostDenied *HostDenied `json:"host_denied,omitempty"`
+	// SecretInjected is set on "secret_injected" events.
+	SecretInjected *SecretInjected `json:"secret_injected,omitempty"`
+}
+
+// SecretInjected reports a guest request to Host in which the proxy
+// replaced the placeholders of Secrets with their real values.
+type SecretInjected struct {
+	Host    string   `json:"host"`
+	Secrets []string `json:"secrets"`
+}
+
+// HostDenied reports a guest connection to a host outside the allowlist
+// that is being held for approval (NetworkConfig.HostApproval). Allowing
+// Host within TimeoutMS lets the connection through.
+type HostDenied struct {
+	Host      string `json:"host"`
+	TimeoutMS int64  `json:"timeout_ms"`
+}
+
+// ConnectionLimited reports a guest TCP connection that was reset because
+// a NetworkConfig connection limit was reached.
+type ConnectionLimited struct {
+	DestIP   string `json:"dest_ip"`
+	DestPort int    `json:"dest_port"`
+	// Limit is "total" for MaxConcurrentConnections or "per_host" for
+	// MaxConnectionsPerHost.
+	Limit string `json:"limit"`
+	Max   int    `json:"max"`
+}
+
+// EventsDropped reports events that were not delivered to the live event
+// consumer because it fell behind and the buffer was full (see
+// Config.EventBufferSize). It is sent as an "events_dropped" event at most
+// once per second while drops continue. Dropped events are still written to
+// the sandbox's event log, so `matchlock history` remains complete.
+type EventsDropped struct {
+	// Count is the number of events dropped since the previous report.
+	Count uint64 `json:"count"`
+	// Total is the number of events dropped since the sandbox started.
+	Total uint64 `json:"total"`
+}
+
+// SecurityEvent records a sandbox setting that weakens guest isolation. One
+// is emitted per warning when the sandbox is created (see
+// Config.IsolationWarnings).
+type SecurityEvent struct {
+	Warning string `json:"warning"`
 }
 
 type NetworkEvent struct {
@@ -62,6 +171,21 @@ type NetworkEvent struct {
 	DurationMS    int64  `json:"duration_ms"`
 	Blocked       bool   `json:"blocked"`
 	BlockReason   string `json:"block_reason,omitempty"`
+	// Mirror is set when the request was copied to a mirror endpoint (see
+	// NetworkConfig.MirrorRoutes); the event is emitted once both finish.
+	Mirror *MirrorResult `json:"mirror,omitempty"`
+	// TLS is set on the connection-level event emitted for every guest TLS
+	// connection, whether or not its traffic is intercepted.
+	TLS *TLSConnection `json:"tls,omitempty"`
+}
+
+// TLSConnection describes a guest TLS connection as seen in its ClientHello.
+type TLSConnection struct {
+	// SNI is empty when the client sent no server_name extension.
+	SNI         string `json:"sni,omitempty"`
+	DestIP      string `json:"dest_ip"`
+	DestPort    int    `json:"dest_port"`
+	Intercepted bool   `json:"intercepted"`
 }
 
 type FileEvent struct {
@@ -73,7 +197,25 @@ type FileEvent struct {
 	GID  int    `json:"gid,omitempty"`
 }
 
+// SyscallEvent records a flagged syscall observed in seccomp audit mode.
+type SyscallEvent struct {
+	Name    string `json:"name"`
+	Nr      int    `json:"nr"`
+	Args    string `json:"args"`
+	PID     int    `json:"pid"`
+	Blocked bool   `json:"blocked,omitempty"`
+}
+
 type ExecEvent struct {
 	Command  string `json:"command"`
 	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
 }
+
+const (
+	// TraceIDEnvKey exports an exec's trace ID to the guest command.
+	TraceIDEnvKey = "MATCHLOCK_TRACE_ID"
+	// TraceIDHeader lets guest HTTP clients attribute a request to a trace.
+	// The proxy strips it before forwarding upstream.
+	TraceIDHeader = "X-Matchlock-Trace-Id"
+)
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecOptionsValidate(t *testing.T) {
+	var nilOpts *ExecOptions
+	require.NoError(t, nilOpts.Validate())
+	require.NoError(t, (&ExecOptions{Args: []string{"/app/server"}}).Validate())
+	require.NoError(t, (&ExecOptions{Shell: []string{"bash", "-c"}}).Validate())
+
+	for _, opts := range []*ExecOptions{
+		{Args: []string{"/app/server"}, Shell: []string{"bash", "-c"}},
+		{Args: []string{"/app/server"}, LoginShell: true},
+		{Shell: []string{"bash", "-c"}, LoginShell: true},
+		{TimeoutMS: -1},
+	} {
+		assert.ErrorIs(t, opts.Validate(), ErrInvalidExecOptions)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,17 +19,29 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 
 	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
 )
 
 type Builder struct {
-	cacheDir  string
-	forcePull bool
-	store     *Store
+	cacheDir         string
+	forcePull        bool
+	requireSignature bool
+	trustedKeys      []TrustedKey
+	progress         func(api.ImageProgress)
+	store            *Store
 }
 
 type BuildOptions struct {
 	CacheDir  string
 	ForcePull bool
+	// RequireSignature makes Build fail unless the image manifest carries a
+	// cosign signature by one of TrustedKeys. Cached images are only reused
+	// when they were verified against one of the same keys.
+	RequireSignature bool
+	TrustedKeys      []TrustedKey
+	// Progress, when set, receives progress updates while an image is
+	// pulled and turned into a rootfs. It is not called for cached images.
+	Progress func(api.ImageProgress)
 }
 
 func NewBuilder(opts *BuildOptions) *Builder {
@@ -37,9 +51,12 @@ func NewBuilder(opts *BuildOptions) *Builder {
 		cacheDir = filepath.Join(home, ".cache", "matchlock", "images")
 	}
 	return &Builder{
-		cacheDir:  cacheDir,
-		forcePull: opts.ForcePull,
-		store:     NewStore(""),
+		cacheDir:         cacheDir,
+		forcePull:        opts.ForcePull,
+		requireSignature: opts.RequireSignature,
+		trustedKeys:      opts.TrustedKeys,
+		progress:         opts.Progress,
+		store:            NewStore(""),
 	}
 }
 
@@ -49,14 +66,20 @@ type BuildResult struct {
 	Size       int64
 	Cached     bool
 	OCI        *OCIConfig
+	// Signer is set when the image's signature was verified against a
+	// trusted key (see BuildOptions.RequireSignature).
+	Signer string
 }
 
 func (b *Builder) Build(ctx context.Context, imageRef string) (*BuildResult, error) {
+	if b.requireSignature && len(b.trustedKeys) == 0 {
+		return nil, ErrNoTrustedKeys
+	}
 	if !b.forcePull {
-		if result, err := b.store.Get(imageRef); err == nil {
+		if result, err := b.store.Get(imageRef); err == nil && b.acceptCached(result) {
 			return result, nil
 		}
-		if result, err := GetRegistryCache(imageRef, b.cacheDir); err == nil {
+		if result, err := GetRegistryCache(imageRef, b.cacheDir); err == nil && b.acceptCached(result) {
 			return result, nil
 		}
 	}
@@ -74,6 +97,9 @@ func (b *Builder) Build(ctx context.Context, imageRef string) (*BuildResult, err
 	}
 	remoteOpts = append(remoteOpts, b.platformOptions()...)
 
+	progress := newPullProgress(imageRef, b.progress)
+	progress.phase(api.ImageProgressResolve)
+
 	img, err := remote.Image(ref, remoteOpts...)
 	if err != nil {
 		return nil, errx.Wrap(ErrPullImage, err)
@@ -84,6 +110,15 @@ func (b *Builder) Build(ctx context.Context, imageRef string) (*BuildResult, err
 		return nil, errx.Wrap(ErrImageDigest, err)
 	}
 
+	var signer string
+	if b.requireSignature {
+		digests := signatureDigests(ref, digest, remoteOpts...)
+		signer, err = verifySignature(ref, digests, b.trustedKeys, remoteOpts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	rootfsPath := filepath.Join(cacheDir, digest.Hex[:12]+".ext4")
 
 	if err := os.MkdirAll(filepath.Dir(rootfsPath), 0755); err != nil {
@@ -99,6 +134,7 @@ func (b *Builder) Build(ctx context.Context, imageRef string) (*BuildResult, err
 			CreatedAt: time.Now().UTC(),
 			Source:    "registry",
 			OCI:       ociConfig,
+			Signer:    signer,
 		})
 		return &BuildResult{
 			RootfsPath: rootfsPath,
@@ -106,6 +142,7 @@ func (b *Builder) Build(ctx context.Context, imageRef string) (*BuildResult, err
 			Size:       fi.Size(),
 			Cached:     true,
 			OCI:        ociConfig,
+			Signer:     signer,
 		}, nil
 	}
 
@@ -115,11 +152,16 @@ func (b *Builder) Build(ctx context.Context, imageRef string) (*BuildResult, err
 	}
 	defer os.RemoveAll(extractDir)
 
-	fileMetas, err := b.extractImage(img, extractDir)
+	layers, err := progress.wrap(img)
+	if err != nil {
+		return nil, errx.Wrap(ErrExtract, err)
+	}
+	fileMetas, err := b.extractImage(layers, extractDir)
 	if err != nil {
 		return nil, errx.Wrap(ErrExtract, err)
 	}
 
+	progress.phase(api.ImageProgressRootfs)
 	if err := b.createExt4(extractDir, rootfsPath, fileMetas); err != nil {
 		os.Remove(rootfsPath)
 		return nil, errx.Wrap(ErrCreateExt4, err)
@@ -136,6 +178,7 @@ func (b *Builder) Build(ctx context.Context, imageRef string) (*BuildResult, err
 		CreatedAt: time.Now().UTC(),
 		Source:    "registry",
 		OCI:       ociConfig,
+		Signer:    signer,
 	}
 	if err := SaveRegistryCache(imageRef, b.cacheDir, rootfsPath, imageMeta); err != nil {
 		return nil, errx.Wrap(ErrMetadata, err)
@@ -146,9 +189,16 @@ func (b *Builder) Build(ctx context.Context, imageRef string) (*BuildResult, err
 		Digest:     digest.String(),
 		Size:       fi.Size(),
 		OCI:        ociConfig,
+		Signer:     signer,
 	}, nil
 }
 
+// acceptCached reports whether a cached image may be used without pulling:
+// with RequireSignature it must have been verified against a trusted key.
+func (b *Builder) acceptCached(result *BuildResult) bool {
+	return !b.requireSignature || trustedSigner(result.Signer, b.trustedKeys)
+}
+
 type fileMeta struct {
 	uid  int
 	gid  int
@@ -294,6 +344,7 @@ func (b *Builder) SaveTag(tag string, result *BuildResult) error {
 	meta := ImageMeta{
 		Digest: result.Digest,
 		Source: "tag",
+		Signer: result.Signer,
 	}
 	return b.store.Save(tag, result.RootfsPath, meta)
 }
@@ -325,9 +376,37 @@ func extractOCIConfig(img v1.Image) *OCIConfig {
 		}
 	}
 
+	oci.ExposedPorts = parseExposedPorts(c.ExposedPorts)
+
 	return oci
 }
 
+// parseExposedPorts converts OCI ExposedPorts keys ("8080/tcp", "53/udp",
+// "9000") into a sorted list of TCP port numbers. Non-TCP and malformed
+// entries are ignored since port forwarding only proxies TCP.
+func parseExposedPorts(exposed map[string]struct{}) []int {
+	if len(exposed) == 0 {
+		return nil
+	}
+	ports := make([]int, 0, len(exposed))
+	for key := range exposed {
+		portStr, proto, _ := strings.Cut(key, "/")
+		if proto != "" && !strings.EqualFold(proto, "tcp") {
+			continue
+		}
+		p, err := strconv.Atoi(portStr)
+		if err != nil || p < 1 || p > 65535 {
+			continue
+		}
+		ports = append(ports, p)
+	}
+	if len(ports) == 0 {
+		return nil
+	}
+	sort.Ints(ports)
+	return ports
+}
+
 // lstatWalk walks a directory tree using Lstat (not following symlinks) and
 // calls fn for every entry. Errors are silently ignored.
 func lstatWalk(root string, fn func(path string, info os.FileInfo)) {
@@ -378,9 +457,21 @@ func lstatWalkDir(dir string, fn func(string, os.FileInfo) error) error {
 }
 
 // hasDebugfsUnsafeChars returns true if the path contains characters that
-// would break debugfs command parsing (newlines, null bytes, or unbalanced quotes).
+// would break debugfs command parsing (newlines, null bytes, or quotes).
+// Such entries are left out of the image rather than risk a newline
+// starting a new debugfs request.
 func hasDebugfsUnsafeChars(path string) bool {
-	return strings.ContainsAny(path, "\n\r\x00")
+	return strings.ContainsAny(path, "\n\r\x00\"")
+}
+
+// debugfsQuote quotes a debugfs request argument so that paths containing
+// spaces survive its tokenizer. Arguments must already have passed
+// hasDebugfsUnsafeChars.
+func debugfsQuote(s string) string {
+	if !strings.ContainsAny(s, " \t") {
+		return s
+	}
+	return `"` + s + `"`
 }
 
 func sanitizeRef(ref string) string {
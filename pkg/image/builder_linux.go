@@ -66,24 +66,25 @@ func (b *Builder) createExt4(sourceDir, destPath string, meta map[string]fileMet
 
 		ext4Path := "/" + relPath
 
-		if hasDebugfsUnsafeChars(ext4Path) {
+		if hasDebugfsUnsafeChars(ext4Path) || hasDebugfsUnsafeChars(path) {
 			return nil
 		}
+		quoted := debugfsQuote(ext4Path)
 
 		if info.IsDir() {
-			debugfsCommands.WriteString(fmt.Sprintf("mkdir %s\n", ext4Path))
+			debugfsCommands.WriteString(fmt.Sprintf("mkdir %s\n", quoted))
 		} else if info.Mode().IsRegular() {
-			debugfsCommands.WriteString(fmt.Sprintf("write %s %s\n", path, ext4Path))
+			debugfsCommands.WriteString(fmt.Sprintf("write %s %s\n", debugfsQuote(path), quoted))
 		} else if info.Mode()&os.ModeSymlink != 0 {
 			target, err := os.Readlink(path)
-			if err == nil {
-				debugfsCommands.WriteString(fmt.Sprintf("symlink %s %s\n", ext4Path, target))
+			if err == nil && !hasDebugfsUnsafeChars(target) {
+				debugfsCommands.WriteString(fmt.Sprintf("symlink %s %s\n", quoted, debugfsQuote(target)))
 			}
 		}
 
 		if fm, ok := meta[ext4Path]; ok {
-			debugfsCommands.WriteString(fmt.Sprintf("set_inode_field %s uid %d\n", ext4Path, fm.uid))
-			debugfsCommands.WriteString(fmt.Sprintf("set_inode_field %s gid %d\n", ext4Path, fm.gid))
+			debugfsCommands.WriteString(fmt.Sprintf("set_inode_field %s uid %d\n", quoted, fm.uid))
+			debugfsCommands.WriteString(fmt.Sprintf("set_inode_field %s gid %d\n", quoted, fm.gid))
 			var typeBits uint32
 			if info.IsDir() {
 				typeBits = 0o040000
@@ -92,7 +93,7 @@ func (b *Builder) createExt4(sourceDir, destPath string, meta map[string]fileMet
 			} else {
 				typeBits = 0o100000
 			}
-			debugfsCommands.WriteString(fmt.Sprintf("set_inode_field %s mode 0%o\n", ext4Path, typeBits|uint32(fm.mode)))
+			debugfsCommands.WriteString(fmt.Sprintf("set_inode_field %s mode 0%o\n", quoted, typeBits|uint32(fm.mode)))
 		}
 		return nil
 	})
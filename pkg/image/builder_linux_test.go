@@ -0,0 +1,39 @@
+//go:build linux
+
+package image
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateExt4SkipsDebugfsUnsafeEntries(t *testing.T) {
+	for _, tool := range []string{"debugfs", "mke2fs"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub dir", "data.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "evil\nmkdir injected"), []byte("x"), 0644))
+	require.NoError(t, os.Symlink("target\nmkdir injected-link", filepath.Join(src, "link")))
+
+	dest := filepath.Join(t.TempDir(), "rootfs.ext4")
+	require.NoError(t, (&Builder{}).createExt4(src, dest, nil))
+
+	out, err := exec.Command("debugfs", "-R", `cat "/sub dir/data.txt"`, dest).Output()
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(out))
+
+	out, err = exec.Command("debugfs", "-R", "ls -l /", dest).Output()
+	require.NoError(t, err)
+	assert.NotContains(t, string(out), "injected")
+	assert.NotContains(t, string(out), "link")
+}
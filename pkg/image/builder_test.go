@@ -64,6 +64,24 @@ func TestExtractOCIConfig_EnvWithoutEquals(t *testing.T) {
 	assert.Equal(t, "val", oci.Env["KEY"])
 }
 
+func TestExtractOCIConfig_ExposedPorts(t *testing.T) {
+	base := empty.Image
+	cfg, err := base.ConfigFile()
+	require.NoError(t, err)
+	cfg.Config.ExposedPorts = map[string]struct{}{
+		"8080/tcp": {},
+		"443":      {},
+		"53/udp":   {},
+		"bad/tcp":  {},
+	}
+	img, err := mutate.ConfigFile(base, cfg)
+	require.NoError(t, err)
+
+	oci := extractOCIConfig(img)
+	require.NotNil(t, oci)
+	assert.Equal(t, []int{443, 8080}, oci.ExposedPorts)
+}
+
 func TestExtractOCIConfig_EnvEmptyValue(t *testing.T) {
 	img := fakeImage(t, "", "", nil, nil, []string{"EMPTY="})
 	oci := extractOCIConfig(img)
@@ -572,6 +590,7 @@ func TestHasDebugfsUnsafeChars(t *testing.T) {
 		{"/path\nwith\nnewlines", true},
 		{"/path\rwith\rCR", true},
 		{"/path\x00with\x00null", true},
+		{"/path\"with\"quotes", true},
 		{"/clean-file.txt", false},
 	}
 	for _, tc := range tests {
@@ -64,5 +64,10 @@ CREATE INDEX IF NOT EXISTS idx_images_scope_created ON images(scope, created_at
 CREATE INDEX IF NOT EXISTS idx_images_digest ON images(digest);
 `,
 		},
+		{
+			Version: 2,
+			Name:    "add_images_signer",
+			SQL:     `ALTER TABLE images ADD COLUMN signer TEXT;`,
+		},
 	}
 }
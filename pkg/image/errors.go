@@ -16,4 +16,7 @@ var (
 	ErrStoreRead      = errors.New("read from store")
 	ErrMetadata       = errors.New("metadata")
 	ErrImageNotFound  = errors.New("image not found")
+	ErrSignature      = errors.New("verify image signature")
+	ErrNoTrustedKeys  = errors.New("signature required but no trusted keys configured")
+	ErrTrustedKey     = errors.New("load trusted key")
 )
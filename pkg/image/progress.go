@@ -0,0 +1,145 @@
+package image
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// progressInterval is the least time between two byte count updates.
+// Phase and layer changes are reported right away.
+const progressInterval = 100 * time.Millisecond
+
+// pullProgress tracks an image pull and reports it to a
+// BuildOptions.Progress callback.
+type pullProgress struct {
+	report func(api.ImageProgress)
+
+	mu      sync.Mutex
+	state   api.ImageProgress
+	started int
+	last    time.Time
+}
+
+func newPullProgress(imageRef string, report func(api.ImageProgress)) *pullProgress {
+	if report == nil {
+		return nil
+	}
+	return &pullProgress{report: report, state: api.ImageProgress{Image: imageRef}}
+}
+
+// phase reports the start of a new phase. It is a no-op on a nil tracker.
+func (p *pullProgress) phase(phase string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.Phase = phase
+	if phase == api.ImageProgressRootfs {
+		p.state.LayersDone = p.state.Layers
+		p.state.BytesDone = p.state.BytesTotal
+	}
+	p.emit()
+}
+
+// wrap returns img with layers that count the compressed bytes read from
+// them, and reports the start of the download phase.
+func (p *pullProgress) wrap(img v1.Image) (v1.Image, error) {
+	if p == nil {
+		return img, nil
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return nil, err
+	}
+	wrapped := make([]v1.Layer, len(layers))
+	var total int64
+	for i, layer := range layers {
+		if size, err := layer.Size(); err == nil {
+			total += size
+		}
+		if wrapped[i], err = partial.CompressedToLayer(&countingLayer{Layer: layer, progress: p}); err != nil {
+			return nil, err
+		}
+	}
+
+	p.mu.Lock()
+	p.state.Layers = len(layers)
+	p.state.BytesTotal = total
+	p.mu.Unlock()
+	p.phase(api.ImageProgressDownload)
+	return &layersImage{Image: img, layers: wrapped}, nil
+}
+
+// startLayer counts every layer started before this one as done. Layers
+// are read one after the other, so the previous one is finished.
+func (p *pullProgress) startLayer() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.LayersDone = p.started
+	p.started++
+	p.emit()
+}
+
+func (p *pullProgress) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state.BytesDone += int64(n)
+	if time.Since(p.last) >= progressInterval {
+		p.emit()
+	}
+}
+
+// emit reports the current state. p.mu must be held; reports are
+// serialized by it, so callbacks see them in order.
+func (p *pullProgress) emit() {
+	p.last = time.Now()
+	p.report(p.state)
+}
+
+// layersImage is an image whose layers are replaced, for reading them
+// through mutate.Extract.
+type layersImage struct {
+	v1.Image
+	layers []v1.Layer
+}
+
+func (i *layersImage) Layers() ([]v1.Layer, error) {
+	return i.layers, nil
+}
+
+// countingLayer reports the bytes read from its compressed stream.
+// partial.CompressedToLayer decompresses that stream for Uncompressed, so
+// counting covers extraction too.
+type countingLayer struct {
+	v1.Layer
+	progress *pullProgress
+}
+
+func (l *countingLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	l.progress.startLayer()
+	return &countingReadCloser{ReadCloser: rc, progress: l.progress}, nil
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	progress *pullProgress
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.progress.add(n)
+	}
+	return n, err
+}
@@ -0,0 +1,67 @@
+package image
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestPullProgressCountsLayers(t *testing.T) {
+	img := buildMultiLayerImage(t,
+		buildTarLayer(t, []tar.Header{{Name: "a", Typeflag: tar.TypeReg, Mode: 0644}}, map[string][]byte{"a": []byte("first")}),
+		buildTarLayer(t, []tar.Header{{Name: "b", Typeflag: tar.TypeReg, Mode: 0644}}, map[string][]byte{"b": []byte("second")}),
+	)
+
+	var updates []api.ImageProgress
+	progress := newPullProgress("example:latest", func(p api.ImageProgress) { updates = append(updates, p) })
+	progress.phase(api.ImageProgressResolve)
+	wrapped, err := progress.wrap(img)
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	_, err = (&Builder{}).extractImage(wrapped, dest)
+	require.NoError(t, err)
+	for _, name := range []string{"a", "b"} {
+		_, err := os.Stat(filepath.Join(dest, name))
+		require.NoError(t, err, "layers still extract through the wrapper")
+	}
+	progress.phase(api.ImageProgressRootfs)
+
+	require.GreaterOrEqual(t, len(updates), 5)
+	assert.Equal(t, api.ImageProgress{Image: "example:latest", Phase: api.ImageProgressResolve}, updates[0])
+	download := updates[1]
+	assert.Equal(t, api.ImageProgressDownload, download.Phase)
+	assert.Equal(t, 2, download.Layers)
+	assert.Positive(t, download.BytesTotal)
+	assert.Zero(t, download.LayersDone)
+
+	var sawSecondLayer bool
+	for _, u := range updates[1 : len(updates)-1] {
+		assert.Equal(t, api.ImageProgressDownload, u.Phase)
+		assert.LessOrEqual(t, u.BytesDone, u.BytesTotal)
+		sawSecondLayer = sawSecondLayer || u.LayersDone == 1
+	}
+	assert.True(t, sawSecondLayer, "starting the second layer marks the first done")
+
+	last := updates[len(updates)-1]
+	assert.Equal(t, api.ImageProgressRootfs, last.Phase)
+	assert.Equal(t, 2, last.LayersDone)
+	assert.Equal(t, last.BytesTotal, last.BytesDone)
+}
+
+func TestPullProgressNilIsNoop(t *testing.T) {
+	progress := newPullProgress("example:latest", nil)
+	assert.Nil(t, progress)
+	progress.phase(api.ImageProgressResolve)
+
+	img := buildTarImage(t, nil, nil)
+	wrapped, err := progress.wrap(img)
+	require.NoError(t, err)
+	assert.Same(t, img, wrapped)
+}
@@ -0,0 +1,200 @@
+package image
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// cosignSignatureAnnotation holds the base64 signature of a cosign
+// simple-signing payload layer.
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// maxSignaturePayload bounds how much of a signature layer is read.
+const maxSignaturePayload = 1 << 20
+
+// TrustedKey is a public key that image signatures are verified against.
+type TrustedKey struct {
+	// Fingerprint is "sha256:" plus the hex SHA-256 of the PKIX-encoded key.
+	Fingerprint string
+	key         crypto.PublicKey
+}
+
+// LoadTrustedKeys parses PEM public keys (ECDSA, Ed25519 or RSA, as written
+// by "cosign generate-key-pair"). Each entry is either PEM text or the path
+// of a PEM file.
+func LoadTrustedKeys(entries []string) ([]TrustedKey, error) {
+	keys := make([]TrustedKey, 0, len(entries))
+	for _, entry := range entries {
+		data := []byte(entry)
+		if !strings.Contains(entry, "-----BEGIN") {
+			var err error
+			data, err = os.ReadFile(entry)
+			if err != nil {
+				return nil, errx.With(ErrTrustedKey, " %s: %w", entry, err)
+			}
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, errx.With(ErrTrustedKey, ": no PEM block in %s", keyLabel(entry))
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errx.With(ErrTrustedKey, " %s: %w", keyLabel(entry), err)
+		}
+		switch pub.(type) {
+		case *ecdsa.PublicKey, ed25519.PublicKey, *rsa.PublicKey:
+		default:
+			return nil, errx.With(ErrTrustedKey, ": unsupported key type %T in %s", pub, keyLabel(entry))
+		}
+		sum := sha256.Sum256(block.Bytes)
+		keys = append(keys, TrustedKey{Fingerprint: "sha256:" + hex.EncodeToString(sum[:]), key: pub})
+	}
+	return keys, nil
+}
+
+func keyLabel(entry string) string {
+	if strings.Contains(entry, "-----BEGIN") {
+		return "inline key"
+	}
+	return entry
+}
+
+func (k TrustedKey) verify(payload, sig []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch pub := k.key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(pub, digest[:], sig)
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, payload, sig)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) == nil
+	}
+	return false
+}
+
+// simpleSigning is the part of a cosign signature payload that is checked.
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// signatureDigests returns the digests a signature may cover to vouch for
+// the pulled platform manifest digest. A multi-platform tag is usually
+// signed at its index digest, so that digest is accepted too, but only when
+// the index actually lists digest; otherwise a signature on any index would
+// vouch for an unrelated manifest.
+func signatureDigests(ref name.Reference, digest v1.Hash, opts ...remote.Option) []v1.Hash {
+	digests := []v1.Hash{digest}
+	desc, err := remote.Head(ref, opts...)
+	if err != nil || desc.Digest == digest {
+		return digests
+	}
+	// Fetching by digest makes remote verify the index content against it.
+	idx, err := remote.Index(ref.Context().Digest(desc.Digest.String()), opts...)
+	if err != nil {
+		return digests
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return digests
+	}
+	for _, m := range manifest.Manifests {
+		if m.Digest == digest {
+			return append([]v1.Hash{desc.Digest}, digests...)
+		}
+	}
+	return digests
+}
+
+// verifySignature looks up the cosign signatures stored next to ref in its
+// registry (the "sha256-<hex>.sig" tag) and returns the fingerprint of the
+// first trusted key that signed one of digests. Only key-based signatures
+// are supported; keyless (Fulcio/Rekor) signatures are not verified.
+func verifySignature(ref name.Reference, digests []v1.Hash, keys []TrustedKey, opts ...remote.Option) (string, error) {
+	if len(keys) == 0 {
+		return "", ErrNoTrustedKeys
+	}
+	for _, digest := range digests {
+		sigTag := ref.Context().Tag(fmt.Sprintf("%s-%s.sig", digest.Algorithm, digest.Hex))
+		sigImg, err := remote.Image(sigTag, opts...)
+		if err != nil {
+			continue
+		}
+		if signer, ok := signedBy(sigImg, digest, keys); ok {
+			return signer, nil
+		}
+	}
+	return "", errx.With(ErrSignature, ": no signature by a trusted key for %s", ref)
+}
+
+func signedBy(sigImg v1.Image, digest v1.Hash, keys []TrustedKey) (string, bool) {
+	manifest, err := sigImg.Manifest()
+	if err != nil {
+		return "", false
+	}
+	for _, desc := range manifest.Layers {
+		sig, err := base64.StdEncoding.DecodeString(desc.Annotations[cosignSignatureAnnotation])
+		if err != nil || len(sig) == 0 {
+			continue
+		}
+		payload, err := layerPayload(sigImg, desc.Digest)
+		if err != nil {
+			continue
+		}
+		var claim simpleSigning
+		if err := json.Unmarshal(payload, &claim); err != nil || claim.Critical.Image.DockerManifestDigest != digest.String() {
+			continue
+		}
+		for _, key := range keys {
+			if key.verify(payload, sig) {
+				return key.Fingerprint, true
+			}
+		}
+	}
+	return "", false
+}
+
+func layerPayload(img v1.Image, digest v1.Hash) ([]byte, error) {
+	layer, err := img.LayerByDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(io.LimitReader(rc, maxSignaturePayload))
+}
+
+// trustedSigner reports whether signer is one of keys.
+func trustedSigner(signer string, keys []TrustedKey) bool {
+	for _, key := range keys {
+		if signer != "" && key.Fingerprint == signer {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package image
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSigningKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	return priv, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// pushSignedImage pushes a random image to a test registry and, like
+// "cosign sign --key", a signature for payloadDigest under the image's .sig tag.
+func pushSignedImage(t *testing.T, priv *ecdsa.PrivateKey, payloadDigest func(v1.Hash) string) (name.Reference, v1.Hash) {
+	t.Helper()
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/agents/app:v1")
+	require.NoError(t, err)
+	img, err := random.Image(64, 1)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+
+	payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`,
+		ref.Context().Name(), payloadDigest(digest)))
+	sum := sha256.Sum256(payload)
+	sig, err := ecdsa.SignASN1(rand.Reader, priv, sum[:])
+	require.NoError(t, err)
+
+	sigImg, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType("application/vnd.dev.cosign.simplesigning.v1+json")),
+		Annotations: map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	})
+	require.NoError(t, err)
+	sigTag := ref.Context().Tag(fmt.Sprintf("%s-%s.sig", digest.Algorithm, digest.Hex))
+	require.NoError(t, remote.Write(sigTag, sigImg))
+	return ref, digest
+}
+
+func TestVerifySignatureTrustedKey(t *testing.T) {
+	priv, pub := newSigningKey(t)
+	ref, digest := pushSignedImage(t, priv, v1.Hash.String)
+
+	keys, err := LoadTrustedKeys([]string{pub})
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.True(t, strings.HasPrefix(keys[0].Fingerprint, "sha256:"))
+
+	signer, err := verifySignature(ref, []v1.Hash{digest}, keys)
+	require.NoError(t, err)
+	assert.Equal(t, keys[0].Fingerprint, signer)
+}
+
+func TestVerifySignatureRejectsUntrustedKey(t *testing.T) {
+	priv, _ := newSigningKey(t)
+	ref, digest := pushSignedImage(t, priv, v1.Hash.String)
+
+	_, otherPub := newSigningKey(t)
+	keys, err := LoadTrustedKeys([]string{otherPub})
+	require.NoError(t, err)
+
+	_, err = verifySignature(ref, []v1.Hash{digest}, keys)
+	require.ErrorIs(t, err, ErrSignature)
+}
+
+func TestVerifySignatureRejectsPayloadForOtherDigest(t *testing.T) {
+	priv, pub := newSigningKey(t)
+	ref, digest := pushSignedImage(t, priv, func(v1.Hash) string {
+		return "sha256:" + strings.Repeat("0", 64)
+	})
+	keys, err := LoadTrustedKeys([]string{pub})
+	require.NoError(t, err)
+
+	_, err = verifySignature(ref, []v1.Hash{digest}, keys)
+	require.ErrorIs(t, err, ErrSignature)
+}
+
+func TestVerifySignatureRequiresKeys(t *testing.T) {
+	_, err := verifySignature(name.MustParseReference("example.com/app:v1"), nil, nil)
+	require.ErrorIs(t, err, ErrNoTrustedKeys)
+}
+
+func TestLoadTrustedKeysFromFile(t *testing.T) {
+	_, pub := newSigningKey(t)
+	path := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(t, os.WriteFile(path, []byte(pub), 0644))
+
+	keys, err := LoadTrustedKeys([]string{path})
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	_, err = LoadTrustedKeys([]string{filepath.Join(t.TempDir(), "missing.pub")})
+	require.ErrorIs(t, err, ErrTrustedKey)
+	_, err = LoadTrustedKeys([]string{"-----BEGIN PUBLIC KEY-----\nnot base64\n-----END PUBLIC KEY-----\n"})
+	require.ErrorIs(t, err, ErrTrustedKey)
+}
+
+func TestBuilderAcceptCachedRequiresTrustedSigner(t *testing.T) {
+	_, pub := newSigningKey(t)
+	keys, err := LoadTrustedKeys([]string{pub})
+	require.NoError(t, err)
+
+	b := &Builder{requireSignature: true, trustedKeys: keys}
+	assert.False(t, b.acceptCached(&BuildResult{}))
+	assert.False(t, b.acceptCached(&BuildResult{Signer: "sha256:other"}))
+	assert.True(t, b.acceptCached(&BuildResult{Signer: keys[0].Fingerprint}))
+
+	assert.True(t, (&Builder{}).acceptCached(&BuildResult{}))
+}
+
+func TestSignatureDigestsIncludesIndexOnlyWhenItListsManifest(t *testing.T) {
+	srv := httptest.NewServer(registry.New())
+	t.Cleanup(srv.Close)
+	ref, err := name.ParseReference(strings.TrimPrefix(srv.URL, "http://") + "/agents/app:v1")
+	require.NoError(t, err)
+
+	member, err := random.Image(64, 1)
+	require.NoError(t, err)
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: member})
+	require.NoError(t, remote.WriteIndex(ref, idx))
+	idxDigest, err := idx.Digest()
+	require.NoError(t, err)
+	memberDigest, err := member.Digest()
+	require.NoError(t, err)
+
+	assert.Equal(t, []v1.Hash{idxDigest, memberDigest}, signatureDigests(ref, memberDigest))
+
+	unrelated, err := random.Image(64, 1)
+	require.NoError(t, err)
+	unrelatedDigest, err := unrelated.Digest()
+	require.NoError(t, err)
+	assert.Equal(t, []v1.Hash{unrelatedDigest}, signatureDigests(ref, unrelatedDigest))
+}
@@ -22,6 +22,8 @@ type OCIConfig struct {
 	Entrypoint []string          `json:"entrypoint,omitempty"`
 	Cmd        []string          `json:"cmd,omitempty"`
 	Env        map[string]string `json:"env,omitempty"`
+	// ExposedPorts lists TCP ports declared via EXPOSE, sorted ascending.
+	ExposedPorts []int `json:"exposed_ports,omitempty"`
 }
 
 type ImageMeta struct {
@@ -31,6 +33,9 @@ type ImageMeta struct {
 	CreatedAt time.Time  `json:"created_at"`
 	Source    string     `json:"source,omitempty"`
 	OCI       *OCIConfig `json:"oci,omitempty"`
+	// Signer is the fingerprint of the trusted key whose signature was
+	// verified when the image was pulled (see BuildOptions.RequireSignature).
+	Signer string `json:"signer,omitempty"`
 }
 
 type ImageInfo struct {
@@ -132,6 +137,7 @@ func (s *Store) Get(tag string) (*BuildResult, error) {
 		Size:       fi.Size(),
 		Cached:     true,
 		OCI:        info.Meta.OCI,
+		Signer:     info.Meta.Signer,
 	}, nil
 }
 
@@ -212,6 +218,7 @@ func GetRegistryCache(tag string, cacheDir string) (*BuildResult, error) {
 		Size:       fi.Size(),
 		Cached:     true,
 		OCI:        info.Meta.OCI,
+		Signer:     info.Meta.Signer,
 	}, nil
 }
 
@@ -275,8 +282,8 @@ func upsertImageMeta(db *sql.DB, scope, tag string, meta ImageMeta, rootfsPath s
 	createdAt := meta.CreatedAt.UTC().Format(time.RFC3339Nano)
 	updatedAt := time.Now().UTC().Format(time.RFC3339Nano)
 	_, err := db.Exec(
-		`INSERT INTO images(scope, tag, digest, size, created_at, source, rootfs_path, oci_json, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`INSERT INTO images(scope, tag, digest, size, created_at, source, rootfs_path, oci_json, signer, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 		 ON CONFLICT(scope, tag) DO UPDATE SET
 		   digest = excluded.digest,
 		   size = excluded.size,
@@ -284,6 +291,7 @@ func upsertImageMeta(db *sql.DB, scope, tag string, meta ImageMeta, rootfsPath s
 		   source = excluded.source,
 		   rootfs_path = excluded.rootfs_path,
 		   oci_json = excluded.oci_json,
+		   signer = excluded.signer,
 		   updated_at = excluded.updated_at`,
 		scope,
 		tag,
@@ -293,6 +301,7 @@ func upsertImageMeta(db *sql.DB, scope, tag string, meta ImageMeta, rootfsPath s
 		meta.Source,
 		rootfsPath,
 		ociJSON,
+		meta.Signer,
 		updatedAt,
 	)
 	if err != nil {
@@ -303,7 +312,7 @@ func upsertImageMeta(db *sql.DB, scope, tag string, meta ImageMeta, rootfsPath s
 
 func getImageMeta(db *sql.DB, scope, tag string) (*ImageInfo, error) {
 	row := db.QueryRow(
-		`SELECT tag, digest, size, created_at, source, rootfs_path, oci_json
+		`SELECT tag, digest, size, created_at, source, rootfs_path, oci_json, COALESCE(signer, '')
 		   FROM images
 		  WHERE scope = ? AND tag = ?`,
 		scope,
@@ -315,7 +324,7 @@ func getImageMeta(db *sql.DB, scope, tag string) (*ImageInfo, error) {
 		createdAt string
 		ociJSON   []byte
 	)
-	if err := row.Scan(&info.Tag, &info.Meta.Digest, &info.Meta.Size, &createdAt, &info.Meta.Source, &info.RootfsPath, &ociJSON); err != nil {
+	if err := row.Scan(&info.Tag, &info.Meta.Digest, &info.Meta.Size, &createdAt, &info.Meta.Source, &info.RootfsPath, &ociJSON, &info.Meta.Signer); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, errx.With(ErrImageNotFound, ": %q", tag)
 		}
@@ -344,7 +353,7 @@ func getImageMeta(db *sql.DB, scope, tag string) (*ImageInfo, error) {
 
 func listImageMeta(db *sql.DB, scope string) ([]ImageInfo, error) {
 	rows, err := db.Query(
-		`SELECT tag, digest, size, created_at, source, rootfs_path, oci_json
+		`SELECT tag, digest, size, created_at, source, rootfs_path, oci_json, COALESCE(signer, '')
 		   FROM images
 		  WHERE scope = ?
 		  ORDER BY created_at DESC`,
@@ -362,7 +371,7 @@ func listImageMeta(db *sql.DB, scope string) ([]ImageInfo, error) {
 			createdAt string
 			ociJSON   []byte
 		)
-		if err := rows.Scan(&info.Tag, &info.Meta.Digest, &info.Meta.Size, &createdAt, &info.Meta.Source, &info.RootfsPath, &ociJSON); err != nil {
+		if err := rows.Scan(&info.Tag, &info.Meta.Digest, &info.Meta.Size, &createdAt, &info.Meta.Source, &info.RootfsPath, &ociJSON, &info.Meta.Signer); err != nil {
 			return nil, errx.With(ErrStoreRead, ": scan image metadata: %w", err)
 		}
 		if createdAt != "" {
@@ -17,4 +17,7 @@ var (
 	ErrRenameKernel    = errors.New("rename kernel")
 	ErrCreateFile      = errors.New("create file")
 	ErrKernelNotFound  = errors.New("kernel file not found in archive")
+	ErrInvalidKernel   = errors.New("invalid kernel image")
+	ErrKernelRelease   = errors.New("read kernel release")
+	ErrInvalidModule   = errors.New("invalid kernel module")
 )
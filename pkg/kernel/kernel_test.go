@@ -1,6 +1,9 @@
 package kernel
 
 import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
 	"os"
 	"path/filepath"
 	"testing"
@@ -90,3 +93,122 @@ func TestParseVersion(t *testing.T) {
 		assert.Equal(t, tt.expected, ParseVersion(tt.ref))
 	}
 }
+
+func TestValidateImage(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, header []byte) string {
+		p := filepath.Join(dir, name)
+		data := make([]byte, 128)
+		copy(data, header)
+		require.NoError(t, os.WriteFile(p, data, 0644))
+		return p
+	}
+	elf := func(machine uint16) []byte {
+		h := []byte("\x7fELF")
+		h = append(h, make([]byte, 14)...)
+		return append(h, byte(machine), byte(machine>>8))
+	}
+	arm64Image := make([]byte, 64)
+	copy(arm64Image[56:], "ARM\x64")
+
+	vmlinux := write("vmlinux", elf(62))
+	arm64Vmlinux := write("vmlinux-arm64", elf(183))
+	image := write("Image", arm64Image)
+	garbage := write("garbage", []byte("not a kernel"))
+
+	require.NoError(t, ValidateImage(vmlinux, ArchX86_64))
+	require.NoError(t, ValidateImage(image, ArchARM64))
+	require.NoError(t, ValidateImage(arm64Vmlinux, ArchARM64))
+
+	assert.ErrorIs(t, ValidateImage(arm64Vmlinux, ArchX86_64), ErrInvalidKernel)
+	assert.ErrorIs(t, ValidateImage(image, ArchX86_64), ErrInvalidKernel)
+	assert.ErrorIs(t, ValidateImage(vmlinux, ArchARM64), ErrInvalidKernel)
+	assert.ErrorIs(t, ValidateImage(garbage, ArchX86_64), ErrInvalidKernel)
+	assert.ErrorIs(t, ValidateImage(filepath.Join(dir, "missing"), ArchX86_64), ErrInvalidKernel)
+	assert.ErrorIs(t, ValidateImage(dir, ArchX86_64), ErrInvalidKernel)
+
+	short := filepath.Join(dir, "short")
+	require.NoError(t, os.WriteFile(short, []byte("\x7fELF"), 0644))
+	assert.ErrorIs(t, ValidateImage(short, ArchX86_64), ErrInvalidKernel)
+}
+
+// writeTestModule writes a minimal relocatable ELF whose .modinfo carries
+// vermagic, which is all ModuleVermagic and ValidateModule read.
+func writeTestModule(t *testing.T, path string, machine elf.Machine, vermagic string) {
+	t.Helper()
+	modinfo := []byte("license=GPL\x00vermagic=" + vermagic + "\x00name=test\x00")
+	shstrtab := []byte("\x00.modinfo\x00.shstrtab\x00")
+
+	const headerSize = 64
+	modinfoOff := uint64(headerSize)
+	shstrtabOff := modinfoOff + uint64(len(modinfo))
+	shoff := (shstrtabOff + uint64(len(shstrtab)) + 7) &^ 7
+
+	var buf bytes.Buffer
+	header := elf.Header64{
+		Type:      uint16(elf.ET_REL),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Shoff:     shoff,
+		Ehsize:    headerSize,
+		Shentsize: 64,
+		Shnum:     3,
+		Shstrndx:  2,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, header))
+	buf.Write(modinfo)
+	buf.Write(shstrtab)
+	buf.Write(make([]byte, shoff-uint64(buf.Len())))
+	for _, s := range []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Off: modinfoOff, Size: uint64(len(modinfo)), Addralign: 1},
+		{Name: 10, Type: uint32(elf.SHT_STRTAB), Off: shstrtabOff, Size: uint64(len(shstrtab)), Addralign: 1},
+	} {
+		require.NoError(t, binary.Write(&buf, binary.LittleEndian, s))
+	}
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestValidateModule(t *testing.T) {
+	dir := t.TempDir()
+	mod := filepath.Join(dir, "nf_tables.ko")
+	writeTestModule(t, mod, elf.EM_X86_64, "6.1.137 SMP preempt mod_unload ")
+
+	vermagic, err := ModuleVermagic(mod)
+	require.NoError(t, err)
+	assert.Equal(t, "6.1.137", vermagic)
+
+	require.NoError(t, ValidateModule(mod, "6.1.137", ArchX86_64))
+	err = ValidateModule(mod, "6.6.0", ArchX86_64)
+	require.ErrorIs(t, err, ErrInvalidModule)
+	assert.Contains(t, err.Error(), "built for kernel 6.1.137")
+	assert.ErrorIs(t, ValidateModule(mod, "6.1.137", ArchARM64), ErrInvalidModule)
+
+	notELF := filepath.Join(dir, "bogus.ko")
+	require.NoError(t, os.WriteFile(notELF, []byte("nope"), 0644))
+	assert.ErrorIs(t, ValidateModule(notELF, "6.1.137", ArchX86_64), ErrInvalidModule)
+}
+
+func TestImageRelease(t *testing.T) {
+	dir := t.TempDir()
+
+	// Put the banner across the 1 MiB read boundary.
+	data := make([]byte, 1<<20+4096)
+	banner := "Linux version 6.1.137-matchlock (builder@ci) #1 SMP\n"
+	copy(data[1<<20-20:], banner)
+	img := filepath.Join(dir, "vmlinux")
+	require.NoError(t, os.WriteFile(img, data, 0644))
+
+	release, err := ImageRelease(img)
+	require.NoError(t, err)
+	assert.Equal(t, "6.1.137-matchlock", release)
+
+	empty := filepath.Join(dir, "bzImage")
+	require.NoError(t, os.WriteFile(empty, make([]byte, 4096), 0644))
+	_, err = ImageRelease(empty)
+	assert.ErrorIs(t, err, ErrKernelRelease)
+}
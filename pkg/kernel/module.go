@@ -0,0 +1,113 @@
+package kernel
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// bannerPrefix starts linux_banner, which every uncompressed kernel image
+// embeds, e.g. "Linux version 6.1.137 (user@host) ...".
+var bannerPrefix = []byte("Linux version ")
+
+// ImageRelease returns the release string (uname -r) of the uncompressed
+// kernel image at path by locating its linux_banner.
+func ImageRelease(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errx.With(ErrKernelRelease, ": %w", err)
+	}
+	defer f.Close()
+
+	// Keep enough of the previous chunk to match a banner split across
+	// reads, including the release that follows the prefix.
+	const chunkSize = 1 << 20
+	overlap := len(bannerPrefix) + 128
+	buf := make([]byte, 0, chunkSize+overlap)
+	chunk := make([]byte, chunkSize)
+	for {
+		n, readErr := f.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		i := bytes.Index(buf, bannerPrefix)
+		if i >= 0 {
+			rest := buf[i+len(bannerPrefix):]
+			if end := bytes.IndexAny(rest, " \x00\n"); end > 0 {
+				return string(rest[:end]), nil
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return "", errx.With(ErrKernelRelease, ": %s: %w", path, readErr)
+		}
+		// Keep a found banner whose release is cut off by the chunk end.
+		if i < 0 && len(buf) > overlap {
+			buf = append(buf[:0], buf[len(buf)-overlap:]...)
+		}
+	}
+	return "", errx.With(ErrKernelRelease, ": %s: no linux_banner found (compressed kernel?)", path)
+}
+
+// ModuleVermagic returns the kernel release a loadable module (.ko) was
+// built for, from the vermagic entry of its .modinfo section.
+func ModuleVermagic(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", errx.With(ErrInvalidModule, ": %s: %w", path, err)
+	}
+	defer f.Close()
+	if f.Type != elf.ET_REL {
+		return "", errx.With(ErrInvalidModule, ": %s is not a relocatable ELF object", path)
+	}
+
+	section := f.Section(".modinfo")
+	if section == nil {
+		return "", errx.With(ErrInvalidModule, ": %s has no .modinfo section", path)
+	}
+	data, err := section.Data()
+	if err != nil {
+		return "", errx.With(ErrInvalidModule, ": %s: read .modinfo: %w", path, err)
+	}
+	for _, entry := range bytes.Split(data, []byte{0}) {
+		value, ok := strings.CutPrefix(string(entry), "vermagic=")
+		if !ok {
+			continue
+		}
+		if fields := strings.Fields(value); len(fields) > 0 {
+			return fields[0], nil
+		}
+	}
+	return "", errx.With(ErrInvalidModule, ": %s has no vermagic", path)
+}
+
+// ValidateModule checks that the module at path was built for release and
+// for arch, so that loading it in the guest will not be refused.
+func ValidateModule(path, release string, arch Architecture) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		return errx.With(ErrInvalidModule, ": %s: %w", path, err)
+	}
+	machine := f.Machine
+	f.Close()
+	want := elf.EM_X86_64
+	if arch == ArchARM64 {
+		want = elf.EM_AARCH64
+	}
+	if machine != want {
+		return errx.With(ErrInvalidModule, ": %s is built for %s, not %s", path, machine, arch)
+	}
+
+	vermagic, err := ModuleVermagic(path)
+	if err != nil {
+		return err
+	}
+	if vermagic != release {
+		return errx.With(ErrInvalidModule, ": %s is built for kernel %s, not %s", path, vermagic, release)
+	}
+	return nil
+}
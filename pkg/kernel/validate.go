@@ -0,0 +1,64 @@
+package kernel
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+const (
+	elfMachineX86_64  = 62
+	elfMachineAArch64 = 183
+
+	// arm64Magic is "ARM\x64" at offset 56 of an arm64 Image header (see the
+	// kernel's Documentation/arch/arm64/booting.rst).
+	arm64Magic       = 0x644d5241
+	arm64MagicOffset = 56
+)
+
+// ValidateImage checks that path is a kernel the VM backend can boot on
+// arch: an uncompressed ELF vmlinux for x86_64, or an arm64 Image (or an
+// arm64 ELF vmlinux) for arm64. It reads only the file header, so it
+// catches wrong files and wrong architectures, not a corrupt kernel.
+func ValidateImage(path string, arch Architecture) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errx.With(ErrInvalidKernel, ": %w", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return errx.With(ErrInvalidKernel, ": %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return errx.With(ErrInvalidKernel, ": %s is not a regular file", path)
+	}
+
+	header := make([]byte, 64)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return errx.With(ErrInvalidKernel, ": %s: read header: %w", path, err)
+	}
+
+	if string(header[:4]) == "\x7fELF" {
+		machine := binary.LittleEndian.Uint16(header[18:])
+		want := uint16(elfMachineX86_64)
+		if arch == ArchARM64 {
+			want = elfMachineAArch64
+		}
+		if machine != want {
+			return errx.With(ErrInvalidKernel, ": %s: ELF machine %d is not %s", path, machine, arch)
+		}
+		return nil
+	}
+
+	if arch == ArchARM64 && binary.LittleEndian.Uint32(header[arm64MagicOffset:]) == arm64Magic {
+		return nil
+	}
+	if arch == ArchARM64 {
+		return errx.With(ErrInvalidKernel, ": %s is neither an arm64 Image nor an ELF vmlinux", path)
+	}
+	return errx.With(ErrInvalidKernel, ": %s is not an ELF vmlinux", path)
+}
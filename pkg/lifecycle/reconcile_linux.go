@@ -48,6 +48,7 @@ func (r *Reconciler) reconcilePlatform(rec *Record, store *Store, report *Reconc
 	for _, tap := range tapNameCandidates(rec.VMID, rec.Resources.TAPName) {
 		addTable("matchlock_" + tap)
 		addTable("matchlock_nat_" + tap)
+		addTable("matchlock_br_" + tap)
 	}
 
 	var tableErrs []error
@@ -0,0 +1,30 @@
+package net
+
+import (
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+)
+
+// hostAllowed reports whether the guest may reach host. With
+// NetworkConfig.HostApproval, a host outside the allowlist is not denied at
+// once: a "host_denied" event is emitted and the caller is held until the
+// host is allowed at runtime or the approval timeout passes.
+func hostAllowed(pol *policy.Engine, events *api.EventSink, host string) bool {
+	if pol.IsHostAllowed(host) {
+		return true
+	}
+	if !pol.HostApprovable(host) {
+		return false
+	}
+	events.Emit(api.Event{
+		Type:      string(api.EventTypeHostDenied),
+		Timestamp: time.Now().Unix(),
+		HostDenied: &api.HostDenied{
+			Host:      host,
+			TimeoutMS: pol.HostApprovalTimeout().Milliseconds(),
+		},
+	})
+	return pol.AwaitHostAllowed(host)
+}
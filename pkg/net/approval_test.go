@@ -0,0 +1,34 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostAllowedWaitsForApproval(t *testing.T) {
+	pol := policy.NewEngine(&api.NetworkConfig{
+		AllowedHosts:               []string{"api.openai.com"},
+		HostApproval:               true,
+		HostApprovalTimeoutSeconds: 5,
+	})
+	events := api.NewEventSink(1)
+
+	go func() {
+		event := <-events.C
+		pol.AddAllowedHost(event.HostDenied.Host)
+	}()
+	require.True(t, hostAllowed(pol, events, "example.com"))
+}
+
+func TestHostAllowedWithoutApprovalDeniesImmediately(t *testing.T) {
+	pol := policy.NewEngine(&api.NetworkConfig{AllowedHosts: []string{"api.openai.com"}})
+	events := api.NewEventSink(1)
+
+	assert.True(t, hostAllowed(pol, events, "api.openai.com"))
+	assert.False(t, hostAllowed(pol, events, "example.com"))
+	assert.Empty(t, events.C, "no host_denied event without HostApproval")
+}
@@ -0,0 +1,81 @@
+package net
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+const (
+	connLimitTotal   = "total"
+	connLimitPerHost = "per_host"
+)
+
+// connLimiter bounds the guest TCP connections the proxy handles at once, in
+// total and per destination IP, so a guest cannot exhaust host file
+// descriptors and goroutines. A nil limiter admits everything.
+type connLimiter struct {
+	maxTotal   int
+	maxPerHost int
+
+	mu      sync.Mutex
+	total   int
+	perHost map[string]int
+}
+
+// newConnLimiter returns nil when both limits are 0 (unlimited).
+func newConnLimiter(maxTotal, maxPerHost int) *connLimiter {
+	if maxTotal <= 0 && maxPerHost <= 0 {
+		return nil
+	}
+	return &connLimiter{
+		maxTotal:   maxTotal,
+		maxPerHost: maxPerHost,
+		perHost:    make(map[string]int),
+	}
+}
+
+// acquire admits a connection to dstIP. On success release must be called
+// once the connection is done; otherwise the exceeded limit is returned.
+func (l *connLimiter) acquire(dstIP string) (release func(), exceeded string, allowed int) {
+	if l == nil {
+		return func() {}, "", 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return nil, connLimitTotal, l.maxTotal
+	}
+	if l.maxPerHost > 0 && l.perHost[dstIP] >= l.maxPerHost {
+		return nil, connLimitPerHost, l.maxPerHost
+	}
+	l.total++
+	l.perHost[dstIP]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			l.total--
+			if l.perHost[dstIP]--; l.perHost[dstIP] == 0 {
+				delete(l.perHost, dstIP)
+			}
+		})
+	}, "", 0
+}
+
+func emitConnectionLimited(events *api.EventSink, dstIP string, dstPort int, limit string, allowed int) {
+	events.Emit(api.Event{
+		Type:      string(api.EventTypeConnectionLimited),
+		Timestamp: time.Now().Unix(),
+		ConnectionLimited: &api.ConnectionLimited{
+			DestIP:   dstIP,
+			DestPort: dstPort,
+			Limit:    limit,
+			Max:      allowed,
+		},
+	})
+}
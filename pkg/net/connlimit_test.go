@@ -0,0 +1,73 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnLimiterUnlimitedIsNil(t *testing.T) {
+	l := newConnLimiter(0, 0)
+	require.Nil(t, l)
+
+	release, exceeded, _ := l.acquire("10.0.0.1")
+	require.NotNil(t, release)
+	assert.Empty(t, exceeded)
+	release()
+}
+
+func TestConnLimiterTotal(t *testing.T) {
+	l := newConnLimiter(2, 0)
+
+	r1, _, _ := l.acquire("10.0.0.1")
+	r2, _, _ := l.acquire("10.0.0.2")
+	require.NotNil(t, r1)
+	require.NotNil(t, r2)
+
+	r3, exceeded, allowed := l.acquire("10.0.0.3")
+	assert.Nil(t, r3)
+	assert.Equal(t, connLimitTotal, exceeded)
+	assert.Equal(t, 2, allowed)
+
+	r1()
+	r1() // release is idempotent
+	r3, _, _ = l.acquire("10.0.0.3")
+	require.NotNil(t, r3)
+	r4, _, _ := l.acquire("10.0.0.4")
+	assert.Nil(t, r4, "a double release must not free a second slot")
+}
+
+func TestConnLimiterPerHost(t *testing.T) {
+	l := newConnLimiter(0, 1)
+
+	r1, _, _ := l.acquire("10.0.0.1")
+	require.NotNil(t, r1)
+
+	r2, exceeded, allowed := l.acquire("10.0.0.1")
+	assert.Nil(t, r2)
+	assert.Equal(t, connLimitPerHost, exceeded)
+	assert.Equal(t, 1, allowed)
+
+	other, _, _ := l.acquire("10.0.0.2")
+	require.NotNil(t, other, "the limit is per destination")
+
+	r1()
+	r2, _, _ = l.acquire("10.0.0.1")
+	require.NotNil(t, r2)
+	assert.Len(t, l.perHost, 2)
+}
+
+func TestEmitConnectionLimited(t *testing.T) {
+	events := api.NewEventSink(1)
+	emitConnectionLimited(events, "10.0.0.1", 443, connLimitPerHost, 4)
+
+	event := <-events.C
+	assert.Equal(t, "connection_limited", event.Type)
+	assert.Equal(t, &api.ConnectionLimited{DestIP: "10.0.0.1", DestPort: 443, Limit: connLimitPerHost, Max: 4}, event.ConnectionLimited)
+
+	// A full channel must not block the accept path.
+	events.C <- event
+	emitConnectionLimited(events, "10.0.0.1", 443, connLimitPerHost, 4)
+}
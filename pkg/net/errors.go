@@ -8,4 +8,7 @@ var (
 	ErrListen        = errors.New("listen failed")
 	ErrSyscall       = errors.New("syscall conn failed")
 	ErrOriginalDst   = errors.New("getsockopt SO_ORIGINAL_DST failed")
+	ErrDetectMTU     = errors.New("detect outbound interface MTU")
+	ErrLoadCA        = errors.New("load CA")
+	ErrUpstreamProxy = errors.New("upstream proxy")
 )
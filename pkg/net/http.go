@@ -16,18 +16,34 @@ import (
 
 type HTTPInterceptor struct {
 	policy   *policy.Engine
-	events   chan api.Event
+	events   *api.EventSink
 	caPool   *CAPool
 	connPool *upstreamConnPool
+	dialer   *upstreamDialer
+
+	mirrorClient *http.Client
+
+	// metadata, when set, serves plain HTTP to api.MetadataServiceIP.
+	metadata *MetadataService
 }
 
-func NewHTTPInterceptor(pol *policy.Engine, events chan api.Event, caPool *CAPool) *HTTPInterceptor {
-	return &HTTPInterceptor{
+// NewHTTPInterceptor returns an interceptor that resolves upstream hosts
+// with resolver, or the host's default resolver when it is nil.
+func NewHTTPInterceptor(pol *policy.Engine, events *api.EventSink, caPool *CAPool, resolver *net.Resolver) *HTTPInterceptor {
+	i := &HTTPInterceptor{
 		policy:   pol,
 		events:   events,
 		caPool:   caPool,
 		connPool: newUpstreamConnPool(),
 	}
+	i.setDialer(newUpstreamDialer(resolver, nil))
+	return i
+}
+
+// setDialer makes upstream and mirror connections go through dialer.
+func (i *HTTPInterceptor) setDialer(dialer *upstreamDialer) {
+	i.dialer = dialer
+	i.mirrorClient = newMirrorClient(dialer)
 }
 
 func (i *HTTPInterceptor) HandleHTTP(guestConn net.Conn, dstIP string, dstPort int) {
@@ -42,31 +58,48 @@ func (i *HTTPInterceptor) HandleHTTP(guestConn net.Conn, dstIP string, dstPort i
 		}
 
 		start := time.Now()
+		traceID := takeTraceID(req)
+
+		if i.metadata != nil && dstIP == api.MetadataServiceIP {
+			if !i.serveMetadata(guestConn, req, start, traceID) {
+				return
+			}
+			continue
+		}
 
 		host := req.Host
 		if host == "" {
 			host = dstIP
 		}
 
-		if !i.policy.IsHostAllowed(host) {
-			i.emitBlockedEvent(req, host, "host not in allowlist")
+		if !hostAllowed(i.policy, i.events, host) {
+			i.emitBlockedEvent(req, host, "host not in allowlist", traceID)
 			writeHTTPError(guestConn, http.StatusForbidden, "Blocked by policy")
 			return
 		}
 
+		mirrorReq, err := i.prepareMirror(req, host)
+		if err != nil {
+			writeHTTPError(guestConn, http.StatusBadRequest, "Failed to read request")
+			return
+		}
+
+		injected := i.policy.InjectedSecrets(req, host)
 		modifiedReq, err := i.policy.OnRequest(req, host)
 		if err != nil {
-			i.emitBlockedEvent(req, host, err.Error())
+			i.emitBlockedEvent(req, host, err.Error(), traceID)
 			writeHTTPError(guestConn, http.StatusForbidden, "Blocked by policy")
 			return
 		}
+		i.emitSecretInjected(host, injected, traceID)
+		mirror := i.startMirror(mirrorReq)
 
-		targetHost := net.JoinHostPort(host, fmt.Sprintf("%d", dstPort))
+		targetHost := net.JoinHostPort(i.policy.UpstreamHost(host), fmt.Sprintf("%d", dstPort))
 
 		// Try to reuse an existing upstream connection from the pool.
 		pc := i.connPool.get(targetHost)
 		if pc == nil {
-			realConn, err := net.DialTimeout("tcp", targetHost, 30*time.Second)
+			realConn, err := i.dialer.DialHTTP("tcp", targetHost)
 			if err != nil {
 				writeHTTPError(guestConn, http.StatusBadGateway, "Failed to connect")
 				return
@@ -77,7 +110,7 @@ func (i *HTTPInterceptor) HandleHTTP(guestConn net.Conn, dstIP string, dstPort i
 			}
 		}
 
-		if err := modifiedReq.Write(pc.conn); err != nil {
+		if err := i.dialer.writeHTTPRequest(pc.conn, modifiedReq, targetHost); err != nil {
 			pc.conn.Close()
 			writeHTTPError(guestConn, http.StatusBadGateway, "Failed to write request")
 			return
@@ -112,7 +145,7 @@ func (i *HTTPInterceptor) HandleHTTP(guestConn net.Conn, dstIP string, dstPort i
 		modifiedResp.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
 
 		duration := time.Since(start)
-		i.emitEvent(modifiedReq, modifiedResp, host, duration)
+		i.emitEvent(modifiedReq, modifiedResp, host, duration, traceID, mirror)
 
 		if err := writeResponse(guestConn, modifiedResp); err != nil {
 			pc.conn.Close()
@@ -152,12 +185,12 @@ func (i *HTTPInterceptor) HandleHTTPS(guestConn net.Conn, dstIP string, dstPort
 		serverName = dstIP
 	}
 
-	if !i.policy.IsHostAllowed(serverName) {
-		i.emitBlockedEvent(nil, serverName, "host not in allowlist")
+	if !hostAllowed(i.policy, i.events, serverName) {
+		i.emitBlockedEvent(nil, serverName, "host not in allowlist", "")
 		return
 	}
 
-	realConn, err := tls.Dial("tcp", net.JoinHostPort(serverName, fmt.Sprintf("%d", dstPort)), &tls.Config{
+	realConn, err := i.dialer.DialTLS("tcp", net.JoinHostPort(i.policy.UpstreamHost(serverName), fmt.Sprintf("%d", dstPort)), &tls.Config{
 		ServerName: serverName,
 	})
 	if err != nil {
@@ -175,13 +208,23 @@ func (i *HTTPInterceptor) HandleHTTPS(guestConn net.Conn, dstIP string, dstPort
 		}
 
 		start := time.Now()
+		traceID := takeTraceID(req)
+
+		mirrorReq, err := i.prepareMirror(req, serverName)
+		if err != nil {
+			writeHTTPError(tlsConn, http.StatusBadRequest, "Failed to read request")
+			return
+		}
 
+		injected := i.policy.InjectedSecrets(req, serverName)
 		modifiedReq, err := i.policy.OnRequest(req, serverName)
 		if err != nil {
-			i.emitBlockedEvent(req, serverName, err.Error())
+			i.emitBlockedEvent(req, serverName, err.Error(), traceID)
 			writeHTTPError(tlsConn, http.StatusForbidden, "Blocked by policy")
 			return
 		}
+		i.emitSecretInjected(serverName, injected, traceID)
+		mirror := i.startMirror(mirrorReq)
 
 		if err := modifiedReq.Write(realConn); err != nil {
 			return
@@ -214,7 +257,7 @@ func (i *HTTPInterceptor) HandleHTTPS(guestConn net.Conn, dstIP string, dstPort
 		modifiedResp.Header.Set("Content-Length", fmt.Sprintf("%d", len(body)))
 
 		duration := time.Since(start)
-		i.emitEvent(modifiedReq, modifiedResp, serverName, duration)
+		i.emitEvent(modifiedReq, modifiedResp, serverName, duration, traceID, mirror)
 
 		if err := writeResponse(tlsConn, modifiedResp); err != nil {
 			return
@@ -226,7 +269,17 @@ func (i *HTTPInterceptor) HandleHTTPS(guestConn net.Conn, dstIP string, dstPort
 	}
 }
 
-func (i *HTTPInterceptor) emitEvent(req *http.Request, resp *http.Response, host string, duration time.Duration) {
+// takeTraceID removes the guest's trace header from req so it never reaches
+// the upstream, and returns its value.
+func takeTraceID(req *http.Request) string {
+	traceID := req.Header.Get(api.TraceIDHeader)
+	req.Header.Del(api.TraceIDHeader)
+	return traceID
+}
+
+// emitEvent reports a completed request. When it was mirrored, the event
+// is sent once the mirror finishes, carrying both results.
+func (i *HTTPInterceptor) emitEvent(req *http.Request, resp *http.Response, host string, duration time.Duration, traceID string, mirror <-chan *api.MirrorResult) {
 	if i.events == nil {
 		return
 	}
@@ -244,10 +297,10 @@ func (i *HTTPInterceptor) emitEvent(req *http.Request, resp *http.Response, host
 		scheme = "https"
 	}
 
-	select {
-	case i.events <- api.Event{
-		Type:      "network",
+	event := api.Event{
+		Type:      string(api.EventTypeNetwork),
 		Timestamp: time.Now().Unix(),
+		TraceID:   traceID,
 		Network: &api.NetworkEvent{
 			Method:        req.Method,
 			URL:           fmt.Sprintf("%s://%s%s", scheme, host, req.URL.Path),
@@ -258,19 +311,44 @@ func (i *HTTPInterceptor) emitEvent(req *http.Request, resp *http.Response, host
 			DurationMS:    duration.Milliseconds(),
 			Blocked:       false,
 		},
-	}:
-	default:
 	}
+	if mirror != nil {
+		go func() {
+			event.Network.Mirror = <-mirror
+			i.sendEvent(event)
+		}()
+		return
+	}
+	i.sendEvent(event)
+}
+
+// serveMetadata answers req from the metadata service and reports whether
+// the connection can carry another request.
+func (i *HTTPInterceptor) serveMetadata(guestConn net.Conn, req *http.Request, start time.Time, traceID string) bool {
+	if _, err := io.Copy(io.Discard, req.Body); err != nil {
+		return false
+	}
+	resp := i.metadata.respond(req)
+	i.emitEvent(req, resp, api.MetadataServiceIP, time.Since(start), traceID, nil)
+	if err := writeResponse(guestConn, resp); err != nil {
+		return false
+	}
+	return !req.Close
 }
 
-func (i *HTTPInterceptor) emitBlockedEvent(req *http.Request, host, reason string) {
+func (i *HTTPInterceptor) sendEvent(event api.Event) {
+	i.events.Emit(event)
+}
+
+func (i *HTTPInterceptor) emitBlockedEvent(req *http.Request, host, reason, traceID string) {
 	if i.events == nil {
 		return
 	}
 
 	event := api.Event{
-		Type:      "network",
+		Type:      string(api.EventTypeNetwork),
 		Timestamp: time.Now().Unix(),
+		TraceID:   traceID,
 		Network: &api.NetworkEvent{
 			Host:        host,
 			Blocked:     true,
@@ -283,10 +361,23 @@ func (i *HTTPInterceptor) emitBlockedEvent(req *http.Request, host, reason strin
 		event.Network.URL = req.URL.String()
 	}
 
-	select {
-	case i.events <- event:
-	default:
+	i.events.Emit(event)
+}
+
+// emitSecretInjected reports the secrets substituted into a request to host.
+func (i *HTTPInterceptor) emitSecretInjected(host string, secrets []string, traceID string) {
+	if i.events == nil || len(secrets) == 0 {
+		return
 	}
+	i.sendEvent(api.Event{
+		Type:      string(api.EventTypeSecretInjected),
+		Timestamp: time.Now().Unix(),
+		TraceID:   traceID,
+		SecretInjected: &api.SecretInjected{
+			Host:    host,
+			Secrets: secrets,
+		},
+	})
 }
 
 func writeHTTPError(conn net.Conn, status int, message string) {
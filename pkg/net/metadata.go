@@ -0,0 +1,68 @@
+package net
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+)
+
+// MetadataService answers guest HTTP requests to api.MetadataServiceIP on the
+// host instead of forwarding them. Secret lookups return placeholders, never
+// values, so the proxy stays the only place a secret is substituted.
+type MetadataService struct {
+	metadata api.SandboxMetadata
+	policy   *policy.Engine
+}
+
+// NewMetadataService returns a service serving metadata and the secrets of pol.
+func NewMetadataService(metadata api.SandboxMetadata, pol *policy.Engine) *MetadataService {
+	return &MetadataService{metadata: metadata, policy: pol}
+}
+
+func (m *MetadataService) respond(req *http.Request) *http.Response {
+	if req.Header.Get(api.MetadataHeader) != "true" {
+		return metadataResponse(req, http.StatusForbidden, "text/plain", []byte(api.MetadataHeader+": true header required\n"))
+	}
+	if req.Method != http.MethodGet {
+		return metadataResponse(req, http.StatusMethodNotAllowed, "text/plain", []byte("only GET is supported\n"))
+	}
+
+	switch path := req.URL.Path; {
+	case path == "/v1/sandbox":
+		body, err := json.Marshal(m.metadata)
+		if err != nil {
+			return metadataResponse(req, http.StatusInternalServerError, "text/plain", []byte(err.Error()+"\n"))
+		}
+		return metadataResponse(req, http.StatusOK, "application/json", body)
+	case strings.HasPrefix(path, "/v1/secrets/"):
+		name := strings.TrimPrefix(path, "/v1/secrets/")
+		placeholder, ok := m.policy.SecretPlaceholder(name)
+		if !ok {
+			return metadataResponse(req, http.StatusNotFound, "text/plain", []byte(fmt.Sprintf("unknown secret %q\n", name)))
+		}
+		return metadataResponse(req, http.StatusOK, "text/plain", []byte(placeholder))
+	default:
+		return metadataResponse(req, http.StatusNotFound, "text/plain", []byte("not found\n"))
+	}
+}
+
+func metadataResponse(req *http.Request, status int, contentType string, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}, "Cache-Control": {"no-store"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Close:         req.Close,
+		Request:       req,
+	}
+}
@@ -0,0 +1,84 @@
+package net
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+)
+
+func TestHandleHTTPServesMetadata(t *testing.T) {
+	config := &api.Config{
+		ID:     "vm-meta",
+		Image:  "alpine:latest",
+		Labels: map[string]string{"team": "infra"},
+		Network: &api.NetworkConfig{
+			AllowedHosts: []string{"api.openai.com"},
+			Secrets: map[string]api.Secret{
+				"OPENAI_KEY": {Value: "sk-real", Hosts: []string{"api.openai.com"}},
+			},
+		},
+	}
+	engine := policy.NewEngine(config.Network)
+	events := api.NewEventSink(10)
+	interceptor := NewHTTPInterceptor(engine, events, nil, nil)
+	interceptor.metadata = NewMetadataService(config.Metadata(), engine)
+
+	guest, host := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		interceptor.HandleHTTP(host, api.MetadataServiceIP, 80)
+		close(done)
+	}()
+	defer func() {
+		guest.Close()
+		<-done
+	}()
+	reader := bufio.NewReader(guest)
+
+	get := func(path string, withHeader bool) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, "http://"+api.MetadataServiceIP+path, nil)
+		require.NoError(t, err)
+		if withHeader {
+			req.Header.Set(api.MetadataHeader, "true")
+		}
+		go func() { _ = req.Write(guest) }()
+		resp, err := http.ReadResponse(reader, req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := get("/v1/sandbox", true)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"id":"vm-meta","image":"alpine:latest","hostname":"vm-meta","labels":{"team":"infra"},"allowed_hosts":["api.openai.com"],"secrets":[{"name":"OPENAI_KEY","hosts":["api.openai.com"]}]}`, body)
+	assert.NotContains(t, body, "sk-real")
+
+	status, _ = get("/v1/sandbox", false)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, body = get("/v1/secrets/OPENAI_KEY", true)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, engine.GetPlaceholder("OPENAI_KEY"), body)
+
+	status, body = get("/v1/secrets/OPENAI_KEY?host=api.openai.com", true)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotContains(t, body, "sk-real", "the host parameter unlocks nothing")
+
+	status, _ = get("/v1/secrets/MISSING", true)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	event := <-events.C
+	require.NotNil(t, event.Network)
+	assert.Equal(t, api.MetadataServiceIP, event.Network.Host)
+	assert.Equal(t, http.StatusOK, event.Network.StatusCode)
+}
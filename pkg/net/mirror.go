@@ -0,0 +1,113 @@
+package net
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// mirrorTimeout bounds a mirrored request, so a slow mirror never holds
+// back the network event of the real request for long.
+const mirrorTimeout = 60 * time.Second
+
+// hopHeaders are connection-scoped and not copied to mirrored requests.
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+func newMirrorClient(dialer *upstreamDialer) *http.Client {
+	return &http.Client{
+		Timeout: mirrorTimeout,
+		// The transport forwards plain HTTP through the upstream proxy
+		// itself, so it dials the proxy directly.
+		Transport: &http.Transport{Proxy: dialer.transportProxy, DialContext: dialer.direct.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// prepareMirror returns a copy of req for host's mirror route, or nil when
+// host is not mirrored. It buffers req's body so it can be sent twice, and
+// must run before policy.OnRequest so the mirror never sees real secret
+// values.
+func (i *HTTPInterceptor) prepareMirror(req *http.Request, host string) (*http.Request, error) {
+	target := i.policy.MirrorTarget(host)
+	if target == "" {
+		return nil, nil
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.TransferEncoding = nil
+
+	return newMirrorRequest(req, body, target)
+}
+
+// startMirror sends mirrorReq in the background, fire-and-forget. The
+// returned channel yields its result, or is nil when mirrorReq is nil.
+func (i *HTTPInterceptor) startMirror(mirrorReq *http.Request) <-chan *api.MirrorResult {
+	if mirrorReq == nil {
+		return nil
+	}
+	result := make(chan *api.MirrorResult, 1)
+	go func() {
+		result <- i.sendMirror(mirrorReq)
+	}()
+	return result
+}
+
+// newMirrorRequest copies req for the mirror base URL target.
+func newMirrorRequest(req *http.Request, body []byte, target string) (*http.Request, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + req.URL.Path
+	u.RawPath = ""
+	u.RawQuery = req.URL.RawQuery
+
+	mirrorReq, err := http.NewRequest(req.Method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	mirrorReq.Header = req.Header.Clone()
+	for _, h := range hopHeaders {
+		mirrorReq.Header.Del(h)
+	}
+	return mirrorReq, nil
+}
+
+func (i *HTTPInterceptor) sendMirror(req *http.Request) *api.MirrorResult {
+	result := &api.MirrorResult{URL: req.URL.String()}
+	start := time.Now()
+	resp, err := i.mirrorClient.Do(req)
+	if err != nil {
+		result.DurationMS = time.Since(start).Milliseconds()
+		result.Error = err.Error()
+		return result
+	}
+	n, err := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	result.DurationMS = time.Since(start).Milliseconds()
+	result.StatusCode = resp.StatusCode
+	result.ResponseBytes = n
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
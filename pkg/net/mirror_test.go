@@ -0,0 +1,124 @@
+package net
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type seenRequest struct {
+	path, auth, body string
+}
+
+func recordingServer(t *testing.T, status int, reply string) (*httptest.Server, <-chan seenRequest) {
+	t.Helper()
+	seen := make(chan seenRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen <- seenRequest{path: r.URL.RequestURI(), auth: r.Header.Get("Authorization"), body: string(body)}
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, seen
+}
+
+func TestHTTPInterceptorMirrorsRequest(t *testing.T) {
+	upstream, upstreamSeen := recordingServer(t, http.StatusOK, "real")
+	mirror, mirrorSeen := recordingServer(t, http.StatusCreated, "shadow response")
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	engine := policy.NewEngine(&api.NetworkConfig{
+		AllowedHosts: []string{"127.0.0.1"},
+		Secrets:      map[string]api.Secret{"KEY": {Value: "real-key", Hosts: []string{"127.0.0.1"}}},
+		MirrorRoutes: []api.MirrorRule{{HostGlob: "127.0.0.1", MirrorTo: mirror.URL + "/shadow"}},
+	})
+	placeholder := engine.GetPlaceholder("KEY")
+	events := api.NewEventSink(10)
+	interceptor := NewHTTPInterceptor(engine, events, nil, nil)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go interceptor.HandleHTTP(server, "127.0.0.1", port)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(client, "POST /v1/chat?stream=false HTTP/1.1\r\nHost: 127.0.0.1\r\n"+
+		"Authorization: Bearer "+placeholder+"\r\nContent-Length: 5\r\nConnection: close\r\n\r\nhello")
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "real", string(body), "the guest only sees the real response")
+
+	got := <-upstreamSeen
+	assert.Equal(t, seenRequest{path: "/v1/chat?stream=false", auth: "Bearer real-key", body: "hello"}, got)
+	shadow := <-mirrorSeen
+	assert.Equal(t, seenRequest{path: "/shadow/v1/chat?stream=false", auth: "Bearer " + placeholder, body: "hello"}, shadow)
+
+	injected := <-events.C
+	require.NotNil(t, injected.SecretInjected, "secret substitution is reported before the request's network event")
+	assert.Equal(t, &api.SecretInjected{Host: "127.0.0.1", Secrets: []string{"KEY"}}, injected.SecretInjected)
+
+	select {
+	case ev := <-events.C:
+		require.NotNil(t, ev.Network.Mirror)
+		assert.Equal(t, http.StatusOK, ev.Network.StatusCode)
+		assert.Equal(t, http.StatusCreated, ev.Network.Mirror.StatusCode)
+		assert.Equal(t, int64(len("shadow response")), ev.Network.Mirror.ResponseBytes)
+		assert.True(t, strings.HasPrefix(ev.Network.Mirror.URL, mirror.URL+"/shadow/v1/chat"))
+		assert.Empty(t, ev.Network.Mirror.Error)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "expected a network event with the mirror result")
+	}
+}
+
+func TestHTTPInterceptorMirrorFailureIsReported(t *testing.T) {
+	upstream, _ := recordingServer(t, http.StatusOK, "real")
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	engine := policy.NewEngine(&api.NetworkConfig{
+		AllowedHosts: []string{"127.0.0.1"},
+		MirrorRoutes: []api.MirrorRule{{HostGlob: "*", MirrorTo: "http://127.0.0.1:1"}},
+	})
+	events := api.NewEventSink(10)
+	interceptor := NewHTTPInterceptor(engine, events, nil, nil)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go interceptor.HandleHTTP(server, "127.0.0.1", port)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(client, "GET / HTTP/1.1\r\nHost: 127.0.0.1\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "a failing mirror does not affect the guest")
+
+	select {
+	case ev := <-events.C:
+		require.NotNil(t, ev.Network.Mirror)
+		assert.NotEmpty(t, ev.Network.Mirror.Error)
+		assert.Zero(t, ev.Network.Mirror.StatusCode)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "expected a network event with the mirror result")
+	}
+}
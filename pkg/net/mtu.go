@@ -0,0 +1,48 @@
+package net
+
+import (
+	"net"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// defaultMTUProbeTarget is only used to select the outbound route; UDP
+// "dials" send no packets.
+const defaultMTUProbeTarget = "8.8.8.8:53"
+
+// DetectOutboundMTU returns the MTU of the host interface used to reach
+// target (default: a public resolver), i.e. the interface carrying guest
+// egress traffic.
+func DetectOutboundMTU(target string) (int, error) {
+	if target == "" {
+		target = defaultMTUProbeTarget
+	}
+	conn, err := net.Dial("udp", target)
+	if err != nil {
+		return 0, errx.Wrap(ErrDetectMTU, err)
+	}
+	localIP := conn.LocalAddr().(*net.UDPAddr).IP
+	_ = conn.Close()
+
+	return interfaceMTUForIP(localIP)
+}
+
+func interfaceMTUForIP(ip net.IP) (int, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return 0, errx.Wrap(ErrDetectMTU, err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.Equal(ip) && iface.MTU > 0 {
+				return iface.MTU, nil
+			}
+		}
+	}
+	return 0, errx.With(ErrDetectMTU, ": no interface with address %s", ip)
+}
@@ -0,0 +1,20 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterfaceMTUForIPLoopback(t *testing.T) {
+	mtu, err := interfaceMTUForIP(net.IPv4(127, 0, 0, 1))
+	require.NoError(t, err)
+	assert.Greater(t, mtu, 0)
+}
+
+func TestInterfaceMTUForIPUnknownAddress(t *testing.T) {
+	_, err := interfaceMTUForIP(net.ParseIP("192.0.2.254"))
+	require.ErrorIs(t, err, ErrDetectMTU)
+}
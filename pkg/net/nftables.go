@@ -3,6 +3,7 @@
 package net
 
 import (
+	"errors"
 	"net"
 
 	"github.com/google/nftables"
@@ -20,16 +21,22 @@ const (
 
 type NFTablesRules struct {
 	tapInterface    string
+	bridge          string
+	guestIP         net.IP
 	gatewayIP       net.IP
 	httpPort        uint16
 	httpsPort       uint16
 	passthroughPort uint16
 	dnsServers      []net.IP
+	udpAllow        []UDPAllowRule
 	conn            *nftables.Conn
 	table           *nftables.Table
 }
 
-func NewNFTablesRules(tapInterface, gatewayIP string, httpPort, httpsPort, passthroughPort int, dnsServers []string) *NFTablesRules {
+// NewNFTablesRules builds the interception rules for tapInterface. Guest
+// UDP is dropped except DNS to dnsServers and the udpAllow destinations (see
+// ResolveUDPAllowRules).
+func NewNFTablesRules(tapInterface, gatewayIP string, httpPort, httpsPort, passthroughPort int, dnsServers []string, udpAllow []UDPAllowRule) *NFTablesRules {
 	var dnsIPs []net.IP
 	for _, s := range dnsServers {
 		if ip := net.ParseIP(s).To4(); ip != nil {
@@ -43,9 +50,21 @@ func NewNFTablesRules(tapInterface, gatewayIP string, httpPort, httpsPort, passt
 		httpsPort:       uint16(httpsPort),
 		passthroughPort: uint16(passthroughPort),
 		dnsServers:      dnsIPs,
+		udpAllow:        udpAllow,
 	}
 }
 
+// NewNFTablesBridgeRules builds the same rules for a guest on the shared
+// bridge. The guest's TAP is a bridge port, so routed traffic arrives on
+// the bridge and is told apart by guestIP; the table is still named after
+// tapInterface.
+func NewNFTablesBridgeRules(bridge, tapInterface, guestIP, gatewayIP string, httpPort, httpsPort, passthroughPort int, dnsServers []string, udpAllow []UDPAllowRule) *NFTablesRules {
+	r := NewNFTablesRules(tapInterface, gatewayIP, httpPort, httpsPort, passthroughPort, dnsServers, udpAllow)
+	r.bridge = bridge
+	r.guestIP = net.ParseIP(guestIP).To4()
+	return r
+}
+
 func (r *NFTablesRules) Setup() error {
 	conn, err := nftables.New()
 	if err != nil {
@@ -105,8 +124,18 @@ func (r *NFTablesRules) Setup() error {
 		})
 	}
 
+	// Allow UDP to the destinations in AllowedUDPHosts.
+	for _, rule := range r.udpAllow {
+		conn.AddRule(&nftables.Rule{
+			Table: r.table,
+			Chain: fwdChain,
+			Exprs: r.buildUDPAcceptRule(rule.IP, rule.Port),
+		})
+	}
+
 	// Drop all other UDP from the VM to match macOS behavior where gVisor
-	// silently discards non-DNS UDP. This prevents UDP-based data exfiltration.
+	// discards UDP outside DNS and AllowedUDPHosts. This prevents UDP-based
+	// data exfiltration.
 	conn.AddRule(&nftables.Rule{
 		Table: r.table,
 		Chain: fwdChain,
@@ -133,13 +162,7 @@ func (r *NFTablesRules) Setup() error {
 }
 
 func (r *NFTablesRules) buildDNATRule(srcPort, dstPort uint16) []expr.Any {
-	return []expr.Any{
-		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
-		&expr.Cmp{
-			Op:       expr.CmpOpEq,
-			Register: 1,
-			Data:     ifname(r.tapInterface),
-		},
+	return append(r.fromGuest(),
 		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
 		&expr.Cmp{
 			Op:       expr.CmpOpEq,
@@ -171,20 +194,14 @@ func (r *NFTablesRules) buildDNATRule(srcPort, dstPort uint16) []expr.Any {
 			RegAddrMin:  1,
 			RegProtoMin: 2,
 		},
-	}
+	)
 }
 
 // buildCatchAllDNATRule redirects all TCP traffic from the TAP interface to the
 // passthrough proxy port. This rule must be added after port-specific DNAT rules
 // (80→HTTP, 443→HTTPS) so they match first; this catches everything else.
 func (r *NFTablesRules) buildCatchAllDNATRule(dstPort uint16) []expr.Any {
-	return []expr.Any{
-		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
-		&expr.Cmp{
-			Op:       expr.CmpOpEq,
-			Register: 1,
-			Data:     ifname(r.tapInterface),
-		},
+	return append(r.fromGuest(),
 		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
 		&expr.Cmp{
 			Op:       expr.CmpOpEq,
@@ -205,36 +222,74 @@ func (r *NFTablesRules) buildCatchAllDNATRule(dstPort uint16) []expr.Any {
 			RegAddrMin:  1,
 			RegProtoMin: 2,
 		},
-	}
+	)
 }
 
 func (r *NFTablesRules) buildForwardRule(isInput bool) []expr.Any {
-	metaKey := expr.MetaKeyIIFNAME
-	if !isInput {
-		metaKey = expr.MetaKeyOIFNAME
+	match := r.toGuest()
+	if isInput {
+		match = r.fromGuest()
 	}
+	return append(match, &expr.Verdict{Kind: expr.VerdictAccept})
+}
+
+// fromGuest matches packets sent by the guest: those arriving on its TAP,
+// or on a shared bridge, those arriving on the bridge from its IP.
+func (r *NFTablesRules) fromGuest() []expr.Any {
+	if r.bridge == "" {
+		return matchIfname(expr.MetaKeyIIFNAME, r.tapInterface)
+	}
+	return append(matchIfname(expr.MetaKeyIIFNAME, r.bridge), matchIPv4(12, r.guestIP)...)
+}
+
+// toGuest matches packets routed to the guest.
+func (r *NFTablesRules) toGuest() []expr.Any {
+	if r.bridge == "" {
+		return matchIfname(expr.MetaKeyOIFNAME, r.tapInterface)
+	}
+	return append(matchIfname(expr.MetaKeyOIFNAME, r.bridge), matchIPv4(16, r.guestIP)...)
+}
 
+// matchIfname matches the input or output interface name.
+func matchIfname(key expr.MetaKey, name string) []expr.Any {
 	return []expr.Any{
-		&expr.Meta{Key: metaKey, Register: 1},
+		&expr.Meta{Key: key, Register: 1},
 		&expr.Cmp{
 			Op:       expr.CmpOpEq,
 			Register: 1,
-			Data:     ifname(r.tapInterface),
+			Data:     ifname(name),
 		},
-		&expr.Verdict{Kind: expr.VerdictAccept},
 	}
 }
 
-// buildUDPDNSAcceptRule accepts UDP port 53 traffic from the TAP interface
-// to a specific destination IP (e.g. 8.8.8.8).
-func (r *NFTablesRules) buildUDPDNSAcceptRule(dstIP net.IP) []expr.Any {
+// matchIPv4 matches the IPv4 source (offset 12) or destination (offset
+// 16) address.
+func matchIPv4(offset uint32, ip net.IP) []expr.Any {
 	return []expr.Any{
-		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       offset,
+			Len:          4,
+		},
 		&expr.Cmp{
 			Op:       expr.CmpOpEq,
 			Register: 1,
-			Data:     ifname(r.tapInterface),
+			Data:     ip.To4(),
 		},
+	}
+}
+
+// buildUDPDNSAcceptRule accepts UDP port 53 traffic from the TAP interface
+// to a specific destination IP (e.g. 8.8.8.8).
+func (r *NFTablesRules) buildUDPDNSAcceptRule(dstIP net.IP) []expr.Any {
+	return r.buildUDPAcceptRule(dstIP, 53)
+}
+
+// buildUDPAcceptRule accepts UDP traffic from the TAP interface to dstIP on
+// dstPort, or on any port when dstPort is 0.
+func (r *NFTablesRules) buildUDPAcceptRule(dstIP net.IP, dstPort uint16) []expr.Any {
+	exprs := append(r.fromGuest(),
 		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
 		&expr.Cmp{
 			Op:       expr.CmpOpEq,
@@ -253,32 +308,30 @@ func (r *NFTablesRules) buildUDPDNSAcceptRule(dstIP net.IP) []expr.Any {
 			Register: 1,
 			Data:     dstIP.To4(),
 		},
-		// Match destination port 53
-		&expr.Payload{
-			DestRegister: 1,
-			Base:         expr.PayloadBaseTransportHeader,
-			Offset:       2,
-			Len:          2,
-		},
-		&expr.Cmp{
-			Op:       expr.CmpOpEq,
-			Register: 1,
-			Data:     binaryutil.BigEndian.PutUint16(53),
-		},
-		&expr.Verdict{Kind: expr.VerdictAccept},
+	)
+	if dstPort != 0 {
+		exprs = append(exprs,
+			// Match destination port
+			&expr.Payload{
+				DestRegister: 1,
+				Base:         expr.PayloadBaseTransportHeader,
+				Offset:       2,
+				Len:          2,
+			},
+			&expr.Cmp{
+				Op:       expr.CmpOpEq,
+				Register: 1,
+				Data:     binaryutil.BigEndian.PutUint16(dstPort),
+			},
+		)
 	}
+	return append(exprs, &expr.Verdict{Kind: expr.VerdictAccept})
 }
 
 // buildUDPDropRule drops all UDP traffic from the TAP interface. Must be placed
 // after any port-specific UDP accept rules (e.g. DNS on port 53).
 func (r *NFTablesRules) buildUDPDropRule() []expr.Any {
-	return []expr.Any{
-		&expr.Meta{Key: expr.MetaKeyIIFNAME, Register: 1},
-		&expr.Cmp{
-			Op:       expr.CmpOpEq,
-			Register: 1,
-			Data:     ifname(r.tapInterface),
-		},
+	return append(r.fromGuest(),
 		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
 		&expr.Cmp{
 			Op:       expr.CmpOpEq,
@@ -286,7 +339,7 @@ func (r *NFTablesRules) buildUDPDropRule() []expr.Any {
 			Data:     []byte{unix.IPPROTO_UDP},
 		},
 		&expr.Verdict{Kind: expr.VerdictDrop},
-	}
+	)
 }
 
 func (r *NFTablesRules) Cleanup() error {
@@ -322,27 +375,66 @@ func ifname(n string) []byte {
 
 type NFTablesNAT struct {
 	tapInterface string
+	clampMSS     bool
+	shared       bool
 	conn         *nftables.Conn
 	table        *nftables.Table
 }
 
-func NewNFTablesNAT(tapInterface string) *NFTablesNAT {
+// NewNFTablesNAT creates NAT rules for the TAP interface. When clampMSS is
+// set, forwarded TCP SYNs have their MSS clamped to the route MTU.
+func NewNFTablesNAT(tapInterface string, clampMSS bool) *NFTablesNAT {
 	return &NFTablesNAT{
 		tapInterface: tapInterface,
+		clampMSS:     clampMSS,
 	}
 }
 
+// NewNFTablesBridgeNAT creates NAT rules shared by every guest on bridge.
+// They also stop guests routing to each other through the host. Use
+// Ensure rather than Setup, and leave them in place while the bridge
+// exists. MSS clamping is per guest (see NewNFTablesBridgePort), since
+// guests on one bridge may disagree about it.
+func NewNFTablesBridgeNAT(bridge string) *NFTablesNAT {
+	return &NFTablesNAT{
+		tapInterface: bridge,
+		shared:       true,
+	}
+}
+
+// Ensure sets up the rules unless their table already exists. The check
+// and the creation are one nftables transaction, so concurrent callers,
+// in this process or another, cannot both install the rules.
+func (n *NFTablesNAT) Ensure() error {
+	err := n.setup(true)
+	if errors.Is(err, unix.EEXIST) {
+		return nil
+	}
+	return err
+}
+
 func (n *NFTablesNAT) Setup() error {
+	return n.setup(false)
+}
+
+// setup installs the rules; exclusive fails the whole batch with EEXIST
+// when the table already exists.
+func (n *NFTablesNAT) setup(exclusive bool) error {
 	conn, err := nftables.New()
 	if err != nil {
 		return errx.Wrap(ErrNFTablesConn, err)
 	}
 	n.conn = conn
 
-	n.table = conn.AddTable(&nftables.Table{
+	table := &nftables.Table{
 		Family: nftables.TableFamilyIPv4,
 		Name:   "matchlock_nat_" + n.tapInterface,
-	})
+	}
+	if exclusive {
+		n.table = conn.CreateTable(table)
+	} else {
+		n.table = conn.AddTable(table)
+	}
 
 	postChain := conn.AddChain(&nftables.Chain{
 		Name:     "postrouting",
@@ -380,6 +472,26 @@ func (n *NFTablesNAT) Setup() error {
 		},
 	})
 
+	// MSS clamping must run before the accept verdicts below.
+	if n.clampMSS {
+		conn.AddRule(&nftables.Rule{
+			Table: n.table,
+			Chain: fwdChain,
+			Exprs: buildMSSClampRule(),
+		})
+	}
+
+	if n.shared {
+		conn.AddRule(&nftables.Rule{
+			Table: n.table,
+			Chain: fwdChain,
+			Exprs: append(
+				append(matchIfname(expr.MetaKeyIIFNAME, n.tapInterface), matchIfname(expr.MetaKeyOIFNAME, n.tapInterface)...),
+				&expr.Verdict{Kind: expr.VerdictDrop},
+			),
+		})
+	}
+
 	conn.AddRule(&nftables.Rule{
 		Table: n.table,
 		Chain: fwdChain,
@@ -415,6 +527,55 @@ func (n *NFTablesNAT) Setup() error {
 	return nil
 }
 
+// buildMSSClampRule is the equivalent of
+// `tcp flags syn tcp option maxseg size set rt mtu`: it rewrites the MSS of
+// forwarded SYN packets to fit the MTU of the route they leave through.
+func buildMSSClampRule() []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{
+			Op:       expr.CmpOpEq,
+			Register: 1,
+			Data:     []byte{unix.IPPROTO_TCP},
+		},
+		// TCP flags byte, SYN bit
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseTransportHeader,
+			Offset:       13,
+			Len:          1,
+		},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            1,
+			Mask:           []byte{0x02},
+			Xor:            []byte{0x00},
+		},
+		&expr.Cmp{
+			Op:       expr.CmpOpNeq,
+			Register: 1,
+			Data:     []byte{0x00},
+		},
+		&expr.Rt{Register: 1, Key: expr.RtTCPMSS},
+		&expr.Byteorder{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Op:             expr.ByteorderHton,
+			Len:            2,
+			Size:           2,
+		},
+		// TCP option kind 2 (maxseg), 2-byte size at offset 2
+		&expr.Exthdr{
+			SourceRegister: 1,
+			Type:           2,
+			Offset:         2,
+			Len:            2,
+			Op:             expr.ExthdrOpTcpopt,
+		},
+	}
+}
+
 func (n *NFTablesNAT) Cleanup() error {
 	if n.conn == nil {
 		conn, err := nftables.New()
@@ -0,0 +1,189 @@
+//go:build linux
+
+package net
+
+import (
+	"net"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+)
+
+// NFTablesBridgePort pins a guest's port on the shared bridge to its MAC
+// and IP, so a guest cannot pose as another to escape that guest's
+// per-IP policy, and stops guests on the bridge reaching each other.
+// With clampMSS it also clamps the MSS of the guest's routed TCP SYNs.
+type NFTablesBridgePort struct {
+	bridge       string
+	tapInterface string
+	mac          net.HardwareAddr
+	guestIP      net.IP
+	clampMSS     bool
+	conn         *nftables.Conn
+	table        *nftables.Table
+}
+
+// NewNFTablesBridgePort creates the port rules for tapInterface on bridge,
+// whose guest uses mac and guestIP.
+func NewNFTablesBridgePort(bridge, tapInterface, mac, guestIP string, clampMSS bool) *NFTablesBridgePort {
+	hw, _ := net.ParseMAC(mac)
+	return &NFTablesBridgePort{
+		bridge:       bridge,
+		tapInterface: tapInterface,
+		mac:          hw,
+		guestIP:      net.ParseIP(guestIP).To4(),
+		clampMSS:     clampMSS,
+	}
+}
+
+func (p *NFTablesBridgePort) tableName() string {
+	return "matchlock_br_" + p.tapInterface
+}
+
+// mssTableName is the name a TAP-mode VM uses for its NAT table. It is
+// free on the shared bridge, and lifecycle reconcile already reclaims it.
+func (p *NFTablesBridgePort) mssTableName() string {
+	return "matchlock_nat_" + p.tapInterface
+}
+
+func (p *NFTablesBridgePort) Setup() error {
+	conn, err := nftables.New()
+	if err != nil {
+		return errx.Wrap(ErrNFTablesConn, err)
+	}
+	p.conn = conn
+
+	p.table = conn.AddTable(&nftables.Table{
+		Family: nftables.TableFamilyBridge,
+		Name:   p.tableName(),
+	})
+
+	preChain := conn.AddChain(&nftables.Chain{
+		Name:     chainPreNAT,
+		Table:    p.table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookPrerouting,
+		Priority: nftables.ChainPriorityFilter,
+	})
+
+	fwdChain := conn.AddChain(&nftables.Chain{
+		Name:     chainFwd,
+		Table:    p.table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookForward,
+		Priority: nftables.ChainPriorityFilter,
+	})
+
+	for _, exprs := range p.buildSpoofDropRules() {
+		conn.AddRule(&nftables.Rule{Table: p.table, Chain: preChain, Exprs: exprs})
+	}
+	for _, exprs := range p.buildIsolationRules() {
+		conn.AddRule(&nftables.Rule{Table: p.table, Chain: fwdChain, Exprs: exprs})
+	}
+
+	// Routed traffic never passes the bridge family's forward hook, so the
+	// clamp lives in an IPv4 table of its own.
+	if p.clampMSS {
+		mssTable := conn.AddTable(&nftables.Table{
+			Family: nftables.TableFamilyIPv4,
+			Name:   p.mssTableName(),
+		})
+		mssChain := conn.AddChain(&nftables.Chain{
+			Name:     chainFwd,
+			Table:    mssTable,
+			Type:     nftables.ChainTypeFilter,
+			Hooknum:  nftables.ChainHookForward,
+			Priority: nftables.ChainPriorityMangle,
+		})
+		for _, exprs := range p.buildMSSClampRules() {
+			conn.AddRule(&nftables.Rule{Table: mssTable, Chain: mssChain, Exprs: exprs})
+		}
+	}
+
+	if err := conn.Flush(); err != nil {
+		return errx.Wrap(ErrNFTablesApply, err)
+	}
+	return nil
+}
+
+// buildSpoofDropRules drops frames from the port with another source MAC,
+// IPv4 packets and ARP with another sender address, and anything that is
+// neither IPv4 nor ARP.
+func (p *NFTablesBridgePort) buildSpoofDropRules() [][]expr.Any {
+	fromPort := func(exprs ...expr.Any) []expr.Any {
+		return append(append(matchIfname(expr.MetaKeyIIFNAME, p.tapInterface), exprs...), &expr.Verdict{Kind: expr.VerdictDrop})
+	}
+	etherType := func(op expr.CmpOp, t uint16) []expr.Any {
+		return []expr.Any{
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseLLHeader, Offset: 12, Len: 2},
+			&expr.Cmp{Op: op, Register: 1, Data: binaryutil.BigEndian.PutUint16(t)},
+		}
+	}
+	// offset is the sender address in the network header: 12 for IPv4,
+	// 14 for ARP.
+	senderNot := func(offset uint32) []expr.Any {
+		return []expr.Any{
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: 4},
+			&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: p.guestIP},
+		}
+	}
+
+	return [][]expr.Any{
+		fromPort(
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseLLHeader, Offset: 6, Len: 6},
+			&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: []byte(p.mac)},
+		),
+		fromPort(append(etherType(expr.CmpOpEq, etherTypeIPv4), senderNot(12)...)...),
+		fromPort(append(etherType(expr.CmpOpEq, etherTypeARP), senderNot(14)...)...),
+		fromPort(append(etherType(expr.CmpOpNeq, etherTypeIPv4), etherType(expr.CmpOpNeq, etherTypeARP)...)...),
+	}
+}
+
+// buildIsolationRules drops frames the bridge would switch between this
+// port and another one. Traffic to and from the host goes through the
+// bridge's own input and output hooks and is unaffected.
+func (p *NFTablesBridgePort) buildIsolationRules() [][]expr.Any {
+	return [][]expr.Any{
+		append(matchIfname(expr.MetaKeyIIFNAME, p.tapInterface), &expr.Verdict{Kind: expr.VerdictDrop}),
+		append(matchIfname(expr.MetaKeyOIFNAME, p.tapInterface), &expr.Verdict{Kind: expr.VerdictDrop}),
+	}
+}
+
+// buildMSSClampRules clamps SYNs the host routes from or to the guest.
+func (p *NFTablesBridgePort) buildMSSClampRules() [][]expr.Any {
+	from := append(matchIfname(expr.MetaKeyIIFNAME, p.bridge), matchIPv4(12, p.guestIP)...)
+	to := append(matchIfname(expr.MetaKeyOIFNAME, p.bridge), matchIPv4(16, p.guestIP)...)
+	return [][]expr.Any{
+		append(from, buildMSSClampRule()...),
+		append(to, buildMSSClampRule()...),
+	}
+}
+
+func (p *NFTablesBridgePort) Cleanup() error {
+	if p.conn == nil {
+		conn, err := nftables.New()
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	tables, err := p.conn.ListTables()
+	if err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if (t.Name == p.tableName() && t.Family == nftables.TableFamilyBridge) ||
+			(t.Name == p.mssTableName() && t.Family == nftables.TableFamilyIPv4) {
+			p.conn.DelTable(t)
+		}
+	}
+	return p.conn.Flush()
+}
@@ -0,0 +1,64 @@
+//go:build linux
+
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/nftables/expr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNFTablesBridgeRulesMatchGuestIP(t *testing.T) {
+	tap := NewNFTablesRules("fc-abc", "192.168.100.1", 1, 2, 0, nil, nil)
+	require.Len(t, tap.fromGuest(), 2)
+	assert.Equal(t, ifname("fc-abc"), tap.fromGuest()[1].(*expr.Cmp).Data)
+
+	shared := NewNFTablesBridgeRules("matchlock0", "fc-abc", "192.168.99.7", "192.168.99.1", 1, 2, 0, nil, nil)
+	from := shared.fromGuest()
+	require.Len(t, from, 4)
+	assert.Equal(t, ifname("matchlock0"), from[1].(*expr.Cmp).Data)
+	assert.Equal(t, uint32(12), from[2].(*expr.Payload).Offset)
+	assert.Equal(t, []byte(net.ParseIP("192.168.99.7").To4()), from[3].(*expr.Cmp).Data)
+
+	to := shared.toGuest()
+	require.Len(t, to, 4)
+	assert.Equal(t, expr.MetaKeyOIFNAME, to[0].(*expr.Meta).Key)
+	assert.Equal(t, uint32(16), to[2].(*expr.Payload).Offset)
+}
+
+func TestNFTablesBridgePortRules(t *testing.T) {
+	p := NewNFTablesBridgePort("matchlock0", "fc-abc", "02:00:00:00:00:07", "192.168.99.7", false)
+
+	spoof := p.buildSpoofDropRules()
+	require.Len(t, spoof, 4)
+	for _, rule := range spoof {
+		assert.Equal(t, ifname("fc-abc"), rule[1].(*expr.Cmp).Data)
+		assert.Equal(t, expr.VerdictDrop, rule[len(rule)-1].(*expr.Verdict).Kind)
+	}
+	assert.Equal(t, []byte{0x02, 0, 0, 0, 0, 0x07}, spoof[0][3].(*expr.Cmp).Data)
+	assert.Equal(t, expr.CmpOpNeq, spoof[0][3].(*expr.Cmp).Op)
+	assert.Equal(t, uint32(14), spoof[2][4].(*expr.Payload).Offset)
+
+	isolation := p.buildIsolationRules()
+	require.Len(t, isolation, 2)
+	assert.Equal(t, expr.MetaKeyIIFNAME, isolation[0][0].(*expr.Meta).Key)
+	assert.Equal(t, expr.MetaKeyOIFNAME, isolation[1][0].(*expr.Meta).Key)
+}
+
+func TestNFTablesBridgePortMSSClampIsPerGuest(t *testing.T) {
+	p := NewNFTablesBridgePort("matchlock0", "fc-abc", "02:00:00:00:00:07", "192.168.99.7", true)
+	assert.Equal(t, "matchlock_nat_fc-abc", p.mssTableName(), "the clamp lives in a per-guest table, not the shared NAT table")
+
+	rules := p.buildMSSClampRules()
+	require.Len(t, rules, 2)
+	guestIP := []byte(net.ParseIP("192.168.99.7").To4())
+	for i, offset := range []uint32{12, 16} {
+		assert.Equal(t, ifname("matchlock0"), rules[i][1].(*expr.Cmp).Data)
+		assert.Equal(t, offset, rules[i][2].(*expr.Payload).Offset)
+		assert.Equal(t, guestIP, rules[i][3].(*expr.Cmp).Data)
+		assert.IsType(t, &expr.Exthdr{}, rules[i][len(rules[i])-1])
+	}
+}
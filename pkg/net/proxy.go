@@ -27,7 +27,9 @@ type TransparentProxy struct {
 	passthroughListener net.Listener
 	interceptor         *HTTPInterceptor
 	policy              *policy.Engine
-	events              chan api.Event
+	events              *api.EventSink
+	dialer              *upstreamDialer
+	limiter             *connLimiter
 
 	httpPort        int
 	httpsPort       int
@@ -45,8 +47,13 @@ type ProxyConfig struct {
 	HTTPSPort       int    // Port for HTTPS interception (e.g., 8443)
 	PassthroughPort int    // Port for policy-gated TCP passthrough (non-80/443). 0 = OS-assigned, negative = disabled
 	Policy          *policy.Engine
-	Events          chan api.Event
+	Events          *api.EventSink
 	CAPool          *CAPool
+	Resolver        *net.Resolver    // Resolves upstream hostnames (nil = host resolver; see NewResolver)
+	UpstreamProxy   UpstreamProxy    // Proxy upstream TCP is tunnelled through (nil = direct; see NewUpstreamProxy)
+	Metadata        *MetadataService // Serves api.MetadataServiceIP (nil = disabled)
+	MaxConnections  int              // Concurrent guest connections across all listeners (0 = unlimited)
+	MaxPerHost      int              // Concurrent guest connections per destination IP (0 = unlimited)
 }
 
 func NewTransparentProxy(cfg *ProxyConfig) (*TransparentProxy, error) {
@@ -82,18 +89,23 @@ func NewTransparentProxy(cfg *ProxyConfig) (*TransparentProxy, error) {
 		actualPassthroughPort = passthroughLn.Addr().(*net.TCPAddr).Port
 	}
 
+	dialer := newUpstreamDialer(cfg.Resolver, cfg.UpstreamProxy)
 	tp := &TransparentProxy{
 		httpListener:        httpLn,
 		httpsListener:       httpsLn,
 		passthroughListener: passthroughLn,
-		interceptor:         NewHTTPInterceptor(cfg.Policy, cfg.Events, cfg.CAPool),
+		interceptor:         NewHTTPInterceptor(cfg.Policy, cfg.Events, cfg.CAPool, cfg.Resolver),
 		policy:              cfg.Policy,
 		events:              cfg.Events,
+		dialer:              dialer,
+		limiter:             newConnLimiter(cfg.MaxConnections, cfg.MaxPerHost),
 		httpPort:            actualHTTPPort,
 		httpsPort:           actualHTTPSPort,
 		passthroughPort:     actualPassthroughPort,
 		bindAddr:            cfg.BindAddr,
 	}
+	tp.interceptor.metadata = cfg.Metadata
+	tp.interceptor.setDialer(dialer)
 
 	return tp, nil
 }
@@ -138,7 +150,20 @@ func (tp *TransparentProxy) acceptLoop(ln net.Listener, handler func(net.Conn, s
 			continue
 		}
 
-		go handler(conn, origDst.IP.String(), origDst.Port)
+		dstIP := origDst.IP.String()
+		release, exceeded, allowed := tp.limiter.acquire(dstIP)
+		if release == nil {
+			// Reset rather than close so the guest fails fast instead of
+			// waiting on a half-open connection.
+			tcpConn.SetLinger(0)
+			conn.Close()
+			emitConnectionLimited(tp.events, dstIP, origDst.Port, exceeded, allowed)
+			continue
+		}
+		go func() {
+			defer release()
+			handler(conn, dstIP, origDst.Port)
+		}()
 	}
 }
 
@@ -149,24 +174,25 @@ func (tp *TransparentProxy) handleHTTP(conn net.Conn, dstIP string, dstPort int)
 
 func (tp *TransparentProxy) handleHTTPS(conn net.Conn, dstIP string, dstPort int) {
 	// Don't pre-check policy on IP - the HTTPS interceptor will check using SNI
-	tp.interceptor.HandleHTTPS(conn, dstIP, dstPort)
+	tp.interceptor.HandleHTTPS(sniffTLS(conn, dstIP, dstPort, true, tp.events), dstIP, dstPort)
 }
 
 func (tp *TransparentProxy) handlePassthrough(conn net.Conn, dstIP string, dstPort int) {
 	defer conn.Close()
 
-	host := net.JoinHostPort(dstIP, fmt.Sprintf("%d", dstPort))
-	if !tp.policy.IsHostAllowed(dstIP) {
-		tp.emitBlockedEvent(host, "host not in allowlist")
+	if !hostAllowed(tp.policy, tp.events, dstIP) {
+		tp.emitBlockedEvent(sniffBlockedTLS(conn, dstIP, dstPort, tp.events), "host not in allowlist")
 		return
 	}
 
-	realConn, err := net.DialTimeout("tcp", host, 30*time.Second)
+	upstream := net.JoinHostPort(tp.policy.UpstreamHost(dstIP), fmt.Sprintf("%d", dstPort))
+	realConn, err := tp.dialer.Dial("tcp", upstream)
 	if err != nil {
 		return
 	}
 	defer realConn.Close()
 
+	conn = sniffTLS(conn, dstIP, dstPort, false, tp.events)
 	done := make(chan struct{}, 2)
 	go func() {
 		io.Copy(realConn, conn)
@@ -184,20 +210,15 @@ func (tp *TransparentProxy) handlePassthrough(conn net.Conn, dstIP string, dstPo
 }
 
 func (tp *TransparentProxy) emitBlockedEvent(host, reason string) {
-	if tp.events == nil {
-		return
-	}
-	select {
-	case tp.events <- api.Event{
-		Type: "network",
+	tp.events.Emit(api.Event{
+		Type:      string(api.EventTypeNetwork),
+		Timestamp: time.Now().Unix(),
 		Network: &api.NetworkEvent{
 			Host:        host,
 			Blocked:     true,
 			BlockReason: reason,
 		},
-	}:
-	default:
-	}
+	})
 }
 
 func (tp *TransparentProxy) Close() error {
@@ -22,7 +22,8 @@ func TestHandlePassthrough_Allowed(t *testing.T) {
 		policy: policy.NewEngine(&api.NetworkConfig{
 			AllowedHosts: []string{"127.0.0.1"},
 		}),
-		events: make(chan api.Event, 10),
+		events: api.NewEventSink(10),
+		dialer: newUpstreamDialer(nil, nil),
 	}
 
 	client, server := net.Pipe()
@@ -45,12 +46,45 @@ func TestHandlePassthrough_Allowed(t *testing.T) {
 	assert.Equal(t, string(msg), string(buf))
 }
 
+func TestHandlePassthrough_HostMachine(t *testing.T) {
+	upstream := startEchoServer(t)
+	defer upstream.Close()
+
+	engine := policy.NewEngine(&api.NetworkConfig{
+		AllowedHosts:    []string{api.HostMachineAlias},
+		BlockPrivateIPs: true,
+	})
+	engine.SetHostMachineIP("192.168.100.1")
+	tp := &TransparentProxy{policy: engine, events: api.NewEventSink(10), dialer: newUpstreamDialer(nil, nil)}
+
+	client, server := net.Pipe()
+	defer client.Close()
+
+	_, portStr, _ := net.SplitHostPort(upstream.Addr().String())
+
+	// The guest dials the gateway IP; the proxy must reach the host loopback.
+	go tp.handlePassthrough(server, "192.168.100.1", mustAtoi(portStr))
+
+	msg := []byte("hello host")
+	client.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	_, err := client.Write(msg)
+	require.NoError(t, err)
+
+	buf := make([]byte, len(msg))
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = io.ReadFull(client, buf)
+	require.NoError(t, err)
+
+	assert.Equal(t, string(msg), string(buf))
+}
+
 func TestHandlePassthrough_Blocked(t *testing.T) {
 	tp := &TransparentProxy{
 		policy: policy.NewEngine(&api.NetworkConfig{
 			AllowedHosts: []string{"allowed.example.com"},
 		}),
-		events: make(chan api.Event, 10),
+		events: api.NewEventSink(10),
+		dialer: newUpstreamDialer(nil, nil),
 	}
 
 	client, server := net.Pipe()
@@ -69,7 +103,7 @@ func TestHandlePassthrough_Blocked(t *testing.T) {
 	}
 
 	select {
-	case ev := <-tp.events:
+	case ev := <-tp.events.C:
 		assert.True(t, ev.Network.Blocked, "expected blocked event")
 		assert.Equal(t, "93.184.216.34:8080", ev.Network.Host)
 	default:
@@ -77,13 +111,43 @@ func TestHandlePassthrough_Blocked(t *testing.T) {
 	}
 }
 
+func TestHandlePassthrough_BlockedTLSReportsSNI(t *testing.T) {
+	tp := &TransparentProxy{
+		policy: policy.NewEngine(&api.NetworkConfig{
+			AllowedHosts: []string{"allowed.example.com"},
+		}),
+		events: api.NewEventSink(10),
+		dialer: newUpstreamDialer(nil, nil),
+	}
+
+	hello := captureClientHello(t, "db.example.com")
+	client, server := net.Pipe()
+	defer client.Close()
+	go client.Write(hello)
+
+	tp.handlePassthrough(server, "93.184.216.34", 5432)
+
+	require.Len(t, tp.events.C, 2)
+	tlsEvt := <-tp.events.C
+	require.NotNil(t, tlsEvt.Network.TLS)
+	assert.Equal(t, "db.example.com", tlsEvt.Network.TLS.SNI)
+	assert.False(t, tlsEvt.Network.TLS.Intercepted)
+
+	blocked := <-tp.events.C
+	assert.True(t, blocked.Network.Blocked)
+	assert.Equal(t, "db.example.com", blocked.Network.Host)
+	assert.Equal(t, "host not in allowlist", blocked.Network.BlockReason)
+	assert.NotZero(t, blocked.Timestamp)
+}
+
 func TestHandlePassthrough_EmptyAllowlist(t *testing.T) {
 	upstream := startEchoServer(t)
 	defer upstream.Close()
 
 	tp := &TransparentProxy{
 		policy: policy.NewEngine(&api.NetworkConfig{}),
-		events: make(chan api.Event, 10),
+		events: api.NewEventSink(10),
+		dialer: newUpstreamDialer(nil, nil),
 	}
 
 	client, server := net.Pipe()
@@ -110,7 +174,8 @@ func TestHandlePassthrough_UpstreamRefused(t *testing.T) {
 		policy: policy.NewEngine(&api.NetworkConfig{
 			AllowedHosts: []string{"127.0.0.1"},
 		}),
-		events: make(chan api.Event, 10),
+		events: api.NewEventSink(10),
+		dialer: newUpstreamDialer(nil, nil),
 	}
 
 	// Use a port with nothing listening — connection refused
@@ -152,7 +217,8 @@ func TestHandlePassthrough_HalfClose(t *testing.T) {
 		policy: policy.NewEngine(&api.NetworkConfig{
 			AllowedHosts: []string{"127.0.0.1"},
 		}),
-		events: make(chan api.Event, 10),
+		events: api.NewEventSink(10),
+		dialer: newUpstreamDialer(nil, nil),
 	}
 
 	client, server := net.Pipe()
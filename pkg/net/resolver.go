@@ -0,0 +1,46 @@
+package net
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// upstreamDialTimeout bounds connecting to an upstream host, including
+// resolving its name.
+const upstreamDialTimeout = 30 * time.Second
+
+// NewResolver returns a resolver that sends queries to servers (see
+// api.NetworkConfig.UpstreamDNS), trying them in order, or nil for the
+// host's default resolver when servers is empty.
+func NewResolver(servers []string) (*net.Resolver, error) {
+	if len(servers) == 0 {
+		return nil, nil
+	}
+	addrs := make([]string, 0, len(servers))
+	for _, server := range servers {
+		addr, err := api.UpstreamDNSAddr(server)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			var lastErr error
+			for _, addr := range addrs {
+				conn, err := d.DialContext(ctx, network, addr)
+				if err == nil {
+					return conn, nil
+				}
+				lastErr = err
+			}
+			return nil, lastErr
+		},
+	}, nil
+}
@@ -0,0 +1,105 @@
+package net
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startFakeDNS answers every A query with answer and every other query
+// with an empty NOERROR response.
+func startFakeDNS(t *testing.T, answer net.IP) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 12 {
+				continue
+			}
+			// Question: name labels, then qtype and qclass.
+			end := 12
+			for end < n && buf[end] != 0 {
+				end += int(buf[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(buf[end-4:])
+
+			resp := append([]byte{}, buf[:end]...)
+			binary.BigEndian.PutUint16(resp[2:], 0x8180)
+			binary.BigEndian.PutUint16(resp[6:], 0) // ancount
+			binary.BigEndian.PutUint16(resp[8:], 0) // nscount
+			binary.BigEndian.PutUint16(resp[10:], 0)
+			if qtype == 1 {
+				binary.BigEndian.PutUint16(resp[6:], 1)
+				resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				resp = append(resp, answer.To4()...)
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNewResolverEmptyUsesHostResolver(t *testing.T) {
+	r, err := NewResolver(nil)
+	require.NoError(t, err)
+	assert.Nil(t, r)
+}
+
+func TestNewResolverRejectsInvalidServer(t *testing.T) {
+	_, err := NewResolver([]string{"dns.internal"})
+	assert.ErrorIs(t, err, api.ErrInvalidUpstreamDNS)
+}
+
+func TestHTTPInterceptorUsesUpstreamResolver(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "regional")
+	}))
+	defer upstream.Close()
+	_, portStr, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+	port, err := strconv.Atoi(portStr)
+	require.NoError(t, err)
+
+	resolver, err := NewResolver([]string{startFakeDNS(t, net.ParseIP("127.0.0.1"))})
+	require.NoError(t, err)
+	engine := policy.NewEngine(&api.NetworkConfig{AllowedHosts: []string{"api.regional.test"}})
+	interceptor := NewHTTPInterceptor(engine, api.NewEventSink(10), nil, resolver)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go interceptor.HandleHTTP(server, "10.0.0.1", port)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(client, "GET / HTTP/1.1\r\nHost: api.regional.test\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "regional", string(body))
+}
@@ -0,0 +1,239 @@
+package net
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+const (
+	tlsRecordHeaderLen      = 5
+	tlsRecordTypeHandshake  = 0x16
+	tlsHandshakeClientHello = 0x01
+	tlsExtServerName        = 0x0000
+	tlsServerNameHostName   = 0x00
+
+	// maxClientHelloRecord bounds how much of the first record is buffered
+	// while looking for the SNI (2^14 plaintext plus header).
+	maxClientHelloRecord = tlsRecordHeaderLen + 1<<14
+
+	// blockedClientHelloTimeout bounds how long a refused passthrough
+	// connection is held open waiting for its ClientHello.
+	blockedClientHelloTimeout = time.Second
+)
+
+// sniffTLS wraps a guest connection so the first TLS ClientHello read from
+// it is reported as a network event carrying its SNI, or the destination
+// address when the client sent none. Bytes are passed through unchanged as
+// they are read, so protocols where the server speaks first are not delayed;
+// connections that do not start with a TLS handshake record emit nothing.
+func sniffTLS(conn net.Conn, dstIP string, dstPort int, intercepted bool, events *api.EventSink) net.Conn {
+	if events == nil {
+		return conn
+	}
+	return &sniffConn{
+		Conn: conn,
+		report: func(sni string) {
+			events.Emit(tlsConnectionEvent(dstIP, dstPort, sni, intercepted))
+		},
+	}
+}
+
+// sniffBlockedTLS reads the ClientHello of a passthrough connection that is
+// about to be refused, reports it as sniffTLS would, and returns the host the
+// refusal should be reported against: the SNI, or the destination address
+// when the client sent none or did not start with TLS.
+func sniffBlockedTLS(conn net.Conn, dstIP string, dstPort int, events *api.EventSink) string {
+	host := net.JoinHostPort(dstIP, fmt.Sprintf("%d", dstPort))
+	if events == nil {
+		return host
+	}
+
+	var sni string
+	sc := &sniffConn{
+		Conn: conn,
+		report: func(name string) {
+			sni = name
+			events.Emit(tlsConnectionEvent(dstIP, dstPort, name, false))
+		},
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(blockedClientHelloTimeout))
+	buf := make([]byte, 4096)
+	for !sc.finished() {
+		if _, err := sc.Read(buf); err != nil {
+			break
+		}
+	}
+	if sni != "" {
+		host = sni
+	}
+	return host
+}
+
+func tlsConnectionEvent(dstIP string, dstPort int, sni string, intercepted bool) api.Event {
+	host := sni
+	if host == "" {
+		host = net.JoinHostPort(dstIP, fmt.Sprintf("%d", dstPort))
+	}
+	return api.Event{
+		Type:      string(api.EventTypeNetwork),
+		Timestamp: time.Now().Unix(),
+		Network: &api.NetworkEvent{
+			Host: host,
+			TLS: &api.TLSConnection{
+				SNI:         sni,
+				DestIP:      dstIP,
+				DestPort:    dstPort,
+				Intercepted: intercepted,
+			},
+		},
+	}
+}
+
+type sniffConn struct {
+	net.Conn
+	report func(sni string)
+
+	mu   sync.Mutex
+	buf  []byte
+	done bool
+}
+
+func (c *sniffConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.observe(p[:n], err != nil)
+	return n, err
+}
+
+func (c *sniffConn) observe(data []byte, eof bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return
+	}
+
+	c.buf = append(c.buf, data...)
+	sni, isTLS, complete := parseClientHelloSNI(c.buf)
+	if !isTLS || (eof && len(c.buf) == 0) {
+		c.finish()
+		return
+	}
+	if complete || eof || len(c.buf) >= maxClientHelloRecord {
+		c.finish()
+		c.report(sni)
+	}
+}
+
+func (c *sniffConn) finished() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done
+}
+
+func (c *sniffConn) finish() {
+	c.done = true
+	c.buf = nil
+}
+
+// parseClientHelloSNI extracts the server name from the ClientHello at the
+// start of data. isTLS is false once data can no longer be the start of a
+// TLS handshake; complete is true once the whole first record was examined.
+// A ClientHello spread over several records is only searched within the
+// first one, which is where clients put it in practice.
+func parseClientHelloSNI(data []byte) (sni string, isTLS, complete bool) {
+	if len(data) == 0 {
+		return "", true, false
+	}
+	if data[0] != tlsRecordTypeHandshake {
+		return "", false, false
+	}
+	if len(data) < tlsRecordHeaderLen {
+		return "", true, false
+	}
+	if data[1] != 0x03 {
+		return "", false, false
+	}
+	recordLen := int(binary.BigEndian.Uint16(data[3:5]))
+	if len(data) < tlsRecordHeaderLen+recordLen {
+		return "", true, false
+	}
+	msg := data[tlsRecordHeaderLen : tlsRecordHeaderLen+recordLen]
+	if len(msg) < 4 || msg[0] != tlsHandshakeClientHello {
+		return "", false, false
+	}
+	return clientHelloServerName(msg[4:]), true, true
+}
+
+// clientHelloServerName walks a ClientHello body to its server_name
+// extension. Truncated or malformed input yields "".
+func clientHelloServerName(b []byte) string {
+	// legacy_version(2) + random(32)
+	if len(b) < 34 {
+		return ""
+	}
+	b = b[34:]
+
+	skip := func(lenBytes int) bool {
+		if len(b) < lenBytes {
+			return false
+		}
+		n := 0
+		for _, v := range b[:lenBytes] {
+			n = n<<8 | int(v)
+		}
+		if len(b) < lenBytes+n {
+			return false
+		}
+		b = b[lenBytes+n:]
+		return true
+	}
+	// session_id, cipher_suites, compression_methods
+	if !skip(1) || !skip(2) || !skip(1) {
+		return ""
+	}
+
+	if len(b) < 2 {
+		return ""
+	}
+	extLen := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) > extLen {
+		b = b[:extLen]
+	}
+	for len(b) >= 4 {
+		extType := binary.BigEndian.Uint16(b)
+		n := int(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+		if len(b) < n {
+			return ""
+		}
+		ext := b[:n]
+		b = b[n:]
+		if extType != tlsExtServerName {
+			continue
+		}
+
+		if len(ext) < 2 {
+			return ""
+		}
+		ext = ext[2:]
+		for len(ext) >= 3 {
+			nameType := ext[0]
+			nameLen := int(binary.BigEndian.Uint16(ext[1:]))
+			ext = ext[3:]
+			if len(ext) < nameLen {
+				return ""
+			}
+			if nameType == tlsServerNameHostName {
+				return string(ext[:nameLen])
+			}
+			ext = ext[nameLen:]
+		}
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,117 @@
+package net
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureClientHello returns the bytes a TLS client sends first for serverName.
+func captureClientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		tlsClient := tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+		tlsClient.Handshake()
+		client.Close()
+	}()
+
+	server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, maxClientHelloRecord)
+	n, err := io.ReadAtLeast(server, buf, tlsRecordHeaderLen)
+	require.NoError(t, err)
+	for {
+		_, _, complete := parseClientHelloSNI(buf[:n])
+		if complete {
+			return buf[:n]
+		}
+		m, err := server.Read(buf[n:])
+		require.NoError(t, err)
+		n += m
+	}
+}
+
+func TestParseClientHelloSNI(t *testing.T) {
+	hello := captureClientHello(t, "api.example.com")
+
+	sni, isTLS, complete := parseClientHelloSNI(hello)
+	assert.True(t, isTLS)
+	assert.True(t, complete)
+	assert.Equal(t, "api.example.com", sni)
+
+	_, isTLS, complete = parseClientHelloSNI(hello[:20])
+	assert.True(t, isTLS)
+	assert.False(t, complete)
+
+	_, isTLS, _ = parseClientHelloSNI([]byte("GET / HTTP/1.1\r\n"))
+	assert.False(t, isTLS)
+}
+
+func TestParseClientHelloSNI_NoServerName(t *testing.T) {
+	// Go clients omit SNI when the server name is an IP address.
+	hello := captureClientHello(t, "10.0.0.1")
+
+	sni, isTLS, complete := parseClientHelloSNI(hello)
+	assert.True(t, isTLS)
+	assert.True(t, complete)
+	assert.Empty(t, sni)
+}
+
+func readSniffed(t *testing.T, payload []byte, chunk int, events *api.EventSink) {
+	t.Helper()
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		for len(payload) > 0 {
+			n := min(chunk, len(payload))
+			client.Write(payload[:n])
+			payload = payload[n:]
+		}
+		client.Close()
+	}()
+
+	conn := sniffTLS(server, "93.184.216.34", 8443, false, events)
+	_, err := io.ReadAll(conn)
+	require.NoError(t, err)
+}
+
+func TestSniffTLS_ReportsSNI(t *testing.T) {
+	events := api.NewEventSink(4)
+	readSniffed(t, captureClientHello(t, "db.example.com"), 7, events)
+
+	require.Len(t, events.C, 1)
+	evt := <-events.C
+	require.NotNil(t, evt.Network)
+	require.NotNil(t, evt.Network.TLS)
+	assert.Equal(t, "db.example.com", evt.Network.Host)
+	assert.Equal(t, "db.example.com", evt.Network.TLS.SNI)
+	assert.Equal(t, "93.184.216.34", evt.Network.TLS.DestIP)
+	assert.Equal(t, 8443, evt.Network.TLS.DestPort)
+	assert.False(t, evt.Network.TLS.Intercepted)
+}
+
+func TestSniffTLS_NoSNIFallsBackToDestination(t *testing.T) {
+	events := api.NewEventSink(4)
+	readSniffed(t, captureClientHello(t, "10.0.0.1"), 1024, events)
+
+	require.Len(t, events.C, 1)
+	evt := <-events.C
+	assert.Equal(t, "93.184.216.34:8443", evt.Network.Host)
+	assert.Empty(t, evt.Network.TLS.SNI)
+}
+
+func TestSniffTLS_IgnoresNonTLS(t *testing.T) {
+	events := api.NewEventSink(4)
+	readSniffed(t, []byte("SSH-2.0-OpenSSH_9.6\r\n"), 1024, events)
+
+	assert.Empty(t, events.C)
+}
@@ -167,7 +167,7 @@ func benchTCPThroughput(b *testing.B, chunkSize int) {
 
 	// Empty AllowedHosts = allow all traffic.
 	pol := policy.NewEngine(&api.NetworkConfig{})
-	events := make(chan api.Event, 100)
+	events := api.NewEventSink(100)
 
 	a, bFile := socketpairFiles(b)
 	defer a.Close()
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/jingkaihe/matchlock/pkg/api"
 	"github.com/jingkaihe/matchlock/pkg/policy"
@@ -37,16 +39,23 @@ const (
 
 	// writeBufSize is the capacity of pooled write buffers for outbound packets.
 	writeBufSize = 64 * 1024
+
+	// udpIdleTimeout ends a relayed UDP flow once a direction has been idle
+	// this long; the guest's next packet starts a new flow.
+	udpIdleTimeout = 60 * time.Second
 )
 
 type NetworkStack struct {
 	stack       *stack.Stack
 	policy      *policy.Engine
 	interceptor *HTTPInterceptor
-	events      chan api.Event
+	dialer      *upstreamDialer
+	limiter     *connLimiter
+	events      *api.EventSink
 	linkEP      *socketPairEndpoint
 	dnsServers  []string
 	dnsIndex    atomic.Uint64
+	udpAllow    []UDPAllowRule
 	mu          sync.Mutex
 	closed      bool
 }
@@ -58,9 +67,19 @@ type Config struct {
 	GuestIP    string
 	MTU        uint32
 	Policy     *policy.Engine
-	Events     chan api.Event
+	Events     *api.EventSink
 	CAPool     *CAPool
 	DNSServers []string
+	UDPAllow   []UDPAllowRule   // Resolved AllowedUDPHosts addresses (see ResolveUDPAllowRules)
+	Resolver   *net.Resolver    // Resolves upstream hostnames (nil = host resolver; see NewResolver)
+	Metadata   *MetadataService // Serves api.MetadataServiceIP (nil = disabled)
+	// UpstreamProxy is the proxy upstream TCP is tunnelled through (nil =
+	// direct; see NewUpstreamProxy).
+	UpstreamProxy UpstreamProxy
+	// MaxConnections and MaxPerHost bound concurrent guest TCP connections
+	// in total and per destination IP (0 = unlimited).
+	MaxConnections int
+	MaxPerHost     int
 }
 
 // writeBufPool provides reusable buffers for serializing outbound packets
@@ -311,9 +330,14 @@ func NewNetworkStack(cfg *Config) (*NetworkStack, error) {
 		events:     cfg.Events,
 		linkEP:     linkEP,
 		dnsServers: cfg.DNSServers,
+		udpAllow:   cfg.UDPAllow,
 	}
 
-	ns.interceptor = NewHTTPInterceptor(cfg.Policy, cfg.Events, cfg.CAPool)
+	ns.interceptor = NewHTTPInterceptor(cfg.Policy, cfg.Events, cfg.CAPool, cfg.Resolver)
+	ns.interceptor.metadata = cfg.Metadata
+	ns.dialer = newUpstreamDialer(cfg.Resolver, cfg.UpstreamProxy)
+	ns.interceptor.setDialer(ns.dialer)
+	ns.limiter = newConnLimiter(cfg.MaxConnections, cfg.MaxPerHost)
 
 	tcpForwarder := tcp.NewForwarder(s, tcpReceiveWindowSize, 65535, ns.handleTCPConnection)
 	s.SetTransportProtocolHandler(tcp.ProtocolNumber, tcpForwarder.HandlePacket)
@@ -327,10 +351,19 @@ func NewNetworkStack(cfg *Config) (*NetworkStack, error) {
 func (ns *NetworkStack) handleTCPConnection(r *tcp.ForwarderRequest) {
 	id := r.ID()
 	dstPort := id.LocalPort
+	dstIP := id.LocalAddress.String()
+
+	release, exceeded, allowed := ns.limiter.acquire(dstIP)
+	if release == nil {
+		r.Complete(true)
+		emitConnectionLimited(ns.events, dstIP, int(dstPort), exceeded, allowed)
+		return
+	}
 
 	var wq waiter.Queue
 	ep, tcpipErr := r.CreateEndpoint(&wq)
 	if tcpipErr != nil {
+		release()
 		r.Complete(true)
 		return
 	}
@@ -338,38 +371,49 @@ func (ns *NetworkStack) handleTCPConnection(r *tcp.ForwarderRequest) {
 	r.Complete(false)
 	guestConn := gonet.NewTCPConn(&wq, ep)
 
-	dstIP := id.LocalAddress.String()
-
 	switch dstPort {
 	case 80:
-		go ns.interceptor.HandleHTTP(guestConn, dstIP, int(dstPort))
+		go func() {
+			defer release()
+			ns.interceptor.HandleHTTP(guestConn, dstIP, int(dstPort))
+		}()
 	case 443:
-		go ns.interceptor.HandleHTTPS(guestConn, dstIP, int(dstPort))
+		go func() {
+			defer release()
+			ns.interceptor.HandleHTTPS(sniffTLS(guestConn, dstIP, int(dstPort), true, ns.events), dstIP, int(dstPort))
+		}()
 	default:
 		host := fmt.Sprintf("%s:%d", dstIP, dstPort)
-		if !ns.policy.IsHostAllowed(host) {
-			ns.emitBlockedEvent(host, "host not in allowlist")
-			guestConn.Close()
+		if !ns.policy.IsHostAllowed(host) && !ns.policy.HostApprovable(host) {
+			release()
+			go func() {
+				defer guestConn.Close()
+				ns.emitBlockedEvent(sniffBlockedTLS(guestConn, dstIP, int(dstPort), ns.events), "host not in allowlist")
+			}()
 			return
 		}
-		go ns.handlePassthrough(guestConn, dstIP, int(dstPort))
+		go func() {
+			defer release()
+			ns.handlePassthrough(guestConn, dstIP, int(dstPort))
+		}()
 	}
 }
 
 func (ns *NetworkStack) handlePassthrough(guestConn net.Conn, dstIP string, dstPort int) {
 	defer guestConn.Close()
 
-	if !ns.policy.IsHostAllowed(dstIP) {
-		ns.emitBlockedEvent(net.JoinHostPort(dstIP, fmt.Sprintf("%d", dstPort)), "host not in allowlist")
+	if !hostAllowed(ns.policy, ns.events, dstIP) {
+		ns.emitBlockedEvent(sniffBlockedTLS(guestConn, dstIP, dstPort, ns.events), "host not in allowlist")
 		return
 	}
 
-	realConn, err := net.Dial("tcp", net.JoinHostPort(dstIP, fmt.Sprintf("%d", dstPort)))
+	realConn, err := ns.dialer.Dial("tcp", net.JoinHostPort(ns.policy.UpstreamHost(dstIP), fmt.Sprintf("%d", dstPort)))
 	if err != nil {
 		return
 	}
 	defer realConn.Close()
 
+	guestConn = sniffTLS(guestConn, dstIP, dstPort, false, ns.events)
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -412,10 +456,67 @@ func (ns *NetworkStack) handleUDPPacket(r *udp.ForwarderRequest) bool {
 		return true
 	}
 
-	// Non-DNS UDP: silently drop by not creating an endpoint.
+	dstIP := id.LocalAddress.String()
+	dstPort := id.LocalPort
+	if ns.policy.IsUDPAllowed(dstIP, int(dstPort)) || matchUDPAllowRules(ns.udpAllow, net.IP(id.LocalAddress.AsSlice()), dstPort) {
+		ns.relayUDP(r, dstIP, int(dstPort))
+		return true
+	}
+
+	// Other UDP: silently drop by not creating an endpoint.
 	return true
 }
 
+// relayUDP forwards an allowed guest UDP flow to dstIP:dstPort and relays
+// replies back until either direction is idle for udpIdleTimeout. The
+// endpoint must be created before the forwarder handler returns; the
+// relaying itself runs in the background.
+func (ns *NetworkStack) relayUDP(r *udp.ForwarderRequest, dstIP string, dstPort int) {
+	var wq waiter.Queue
+	ep, tcpipErr := r.CreateEndpoint(&wq)
+	if tcpipErr != nil {
+		return
+	}
+	guestConn := gonet.NewUDPConn(&wq, ep)
+
+	realConn, err := net.Dial("udp", net.JoinHostPort(ns.policy.UpstreamHost(dstIP), strconv.Itoa(dstPort)))
+	if err != nil {
+		guestConn.Close()
+		return
+	}
+
+	go func() {
+		defer guestConn.Close()
+		defer realConn.Close()
+		done := make(chan struct{}, 2)
+		go func() {
+			copyUDPPackets(realConn, guestConn)
+			done <- struct{}{}
+		}()
+		go func() {
+			copyUDPPackets(guestConn, realConn)
+			done <- struct{}{}
+		}()
+		<-done
+	}()
+}
+
+// copyUDPPackets copies datagrams from src to dst until src errors or has
+// been idle for udpIdleTimeout.
+func copyUDPPackets(dst, src net.Conn) {
+	buf := make([]byte, 65535)
+	for {
+		src.SetReadDeadline(time.Now().Add(udpIdleTimeout))
+		n, err := src.Read(buf)
+		if err != nil {
+			return
+		}
+		if _, err := dst.Write(buf[:n]); err != nil {
+			return
+		}
+	}
+}
+
 func (ns *NetworkStack) handleDNS(r *udp.ForwarderRequest) {
 	var wq waiter.Queue
 	ep, tcpipErr := r.CreateEndpoint(&wq)
@@ -455,19 +556,15 @@ func (ns *NetworkStack) handleDNS(r *udp.ForwarderRequest) {
 }
 
 func (ns *NetworkStack) emitBlockedEvent(host, reason string) {
-	if ns.events != nil {
-		select {
-		case ns.events <- api.Event{
-			Type: "network",
-			Network: &api.NetworkEvent{
-				Host:        host,
-				Blocked:     true,
-				BlockReason: reason,
-			},
-		}:
-		default:
-		}
-	}
+	ns.events.Emit(api.Event{
+		Type:      string(api.EventTypeNetwork),
+		Timestamp: time.Now().Unix(),
+		Network: &api.NetworkEvent{
+			Host:        host,
+			Blocked:     true,
+			BlockReason: reason,
+		},
+	})
 }
 
 func (ns *NetworkStack) Close() error {
@@ -10,6 +10,8 @@ import (
 	"math/big"
 	"sync"
 	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
 )
 
 type CAPool struct {
@@ -28,6 +30,31 @@ func NewCAPool() (*CAPool, error) {
 	return pool, nil
 }
 
+// LoadCAPool rebuilds a pool from a CA saved with CACertPEM and CAKeyPEM,
+// for a restored VM whose guest already trusts that CA.
+func LoadCAPool(certPEM, keyPEM []byte) (*CAPool, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, errx.With(ErrLoadCA, ": no certificate PEM block")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, errx.Wrap(ErrLoadCA, err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil || keyBlock.Type != "RSA PRIVATE KEY" {
+		return nil, errx.With(ErrLoadCA, ": no RSA private key PEM block")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, errx.Wrap(ErrLoadCA, err)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, errx.With(ErrLoadCA, ": key does not match certificate")
+	}
+	return &CAPool{caCert: cert, caKey: key}, nil
+}
+
 func (p *CAPool) generateCA() error {
 	key, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
@@ -111,3 +138,12 @@ func (p *CAPool) CACertPEM() []byte {
 		Bytes: p.caCert.Raw,
 	})
 }
+
+// CAKeyPEM returns the CA private key. It is only needed to persist the CA
+// alongside a VM snapshot and must never reach the guest.
+func (p *CAPool) CAKeyPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(p.caKey),
+	})
+}
@@ -79,3 +79,31 @@ func TestCAPool_DifferentDomains(t *testing.T) {
 		assert.Equal(t, domain, x509Cert.Subject.CommonName)
 	}
 }
+
+func TestLoadCAPoolRoundTrip(t *testing.T) {
+	pool, err := NewCAPool()
+	require.NoError(t, err)
+
+	loaded, err := LoadCAPool(pool.CACertPEM(), pool.CAKeyPEM())
+	require.NoError(t, err)
+	assert.Equal(t, pool.CACertPEM(), loaded.CACertPEM())
+
+	cert, err := loaded.GetCertificate("example.com")
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(pool.CACertPEM())
+	_, err = leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: roots})
+	require.NoError(t, err)
+}
+
+func TestLoadCAPoolRejectsMismatchedKey(t *testing.T) {
+	a, err := NewCAPool()
+	require.NoError(t, err)
+	b, err := NewCAPool()
+	require.NoError(t, err)
+
+	_, err = LoadCAPool(a.CACertPEM(), b.CAKeyPEM())
+	require.ErrorIs(t, err, ErrLoadCA)
+}
@@ -0,0 +1,75 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+)
+
+// UDPAllowRule lets guest UDP through to one IPv4 address, on Port or on
+// every port when Port is 0.
+type UDPAllowRule struct {
+	IP   net.IP
+	Port uint16
+}
+
+// ResolveUDPAllowRules turns api.NetworkConfig.AllowedUDPHosts entries into
+// address rules. UDP packets carry only addresses, so hostnames are resolved
+// now with resolver (nil = host resolver) and BlockPrivateIPs is applied to
+// each address they resolve to. Wildcard patterns name no fixed address and
+// are left out (macOS still matches them against destination IPs through
+// Engine.IsUDPAllowed), as are names that do not resolve and addresses the
+// engine blocks; each is described in the returned warnings.
+func ResolveUDPAllowRules(ctx context.Context, engine *policy.Engine, entries []string, resolver *net.Resolver) ([]UDPAllowRule, []string) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	var (
+		rules    []UDPAllowRule
+		warnings []string
+	)
+	for _, entry := range entries {
+		host, port, err := api.ParseUDPHost(entry)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("allowed UDP host %q ignored: %v", entry, err))
+			continue
+		}
+		if strings.Contains(host, "*") {
+			warnings = append(warnings, fmt.Sprintf("allowed UDP host %q not resolved: wildcards match no fixed address", entry))
+			continue
+		}
+		var ips []net.IP
+		if ip := net.ParseIP(host); ip != nil {
+			ips = []net.IP{ip}
+		} else if ips, err = resolver.LookupIP(ctx, "ip4", host); err != nil {
+			warnings = append(warnings, fmt.Sprintf("allowed UDP host %q ignored: %v", entry, err))
+			continue
+		}
+		for _, ip := range ips {
+			ip4 := ip.To4()
+			if ip4 == nil {
+				continue
+			}
+			if !engine.IsResolvedUDPAllowed(host, ip4) {
+				warnings = append(warnings, fmt.Sprintf("allowed UDP host %q: %s ignored: blocked by block_private_ips", entry, ip4))
+				continue
+			}
+			rules = append(rules, UDPAllowRule{IP: ip4, Port: uint16(port)})
+		}
+	}
+	return rules, warnings
+}
+
+// matchUDPAllowRules reports whether rules let UDP through to ip:port.
+func matchUDPAllowRules(rules []UDPAllowRule, ip net.IP, port uint16) bool {
+	for _, rule := range rules {
+		if (rule.Port == 0 || rule.Port == port) && rule.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package net
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveUDPAllowRules(t *testing.T) {
+	dns := startFakeDNS(t, net.ParseIP("203.0.113.9"))
+	resolver, err := NewResolver([]string{dns})
+	require.NoError(t, err)
+
+	entries := []string{"resolver.example.com:53", "9.9.9.9", "*.quic.example.com:443", "10.0.0.5:53"}
+	engine := policy.NewEngine(&api.NetworkConfig{BlockPrivateIPs: true, AllowedUDPHosts: entries})
+
+	rules, warnings := ResolveUDPAllowRules(context.Background(), engine, entries, resolver)
+	require.Len(t, rules, 2, "wildcard and blocked private entries are skipped")
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "*.quic.example.com:443")
+	assert.Contains(t, warnings[1], "10.0.0.5")
+	assert.Equal(t, UDPAllowRule{IP: net.ParseIP("203.0.113.9").To4(), Port: 53}, rules[0])
+	assert.Equal(t, UDPAllowRule{IP: net.ParseIP("9.9.9.9").To4()}, rules[1])
+
+	assert.True(t, matchUDPAllowRules(rules, net.ParseIP("203.0.113.9"), 53))
+	assert.False(t, matchUDPAllowRules(rules, net.ParseIP("203.0.113.9"), 443))
+	assert.True(t, matchUDPAllowRules(rules, net.ParseIP("9.9.9.9"), 443))
+	assert.False(t, matchUDPAllowRules(rules, net.ParseIP("1.1.1.1"), 53))
+}
+
+func TestResolveUDPAllowRulesChecksResolvedAddresses(t *testing.T) {
+	dns := startFakeDNS(t, net.ParseIP("10.1.2.3"))
+	resolver, err := NewResolver([]string{dns})
+	require.NoError(t, err)
+
+	entries := []string{"internal.example.com:53", "hidden.onion:53"}
+	engine := policy.NewEngine(&api.NetworkConfig{BlockPrivateIPs: true, AllowedUDPHosts: entries})
+
+	rules, warnings := ResolveUDPAllowRules(context.Background(), engine, entries, resolver)
+	assert.Empty(t, rules, "a public name resolving to a private address is still blocked")
+	require.Len(t, warnings, 2)
+	assert.Contains(t, warnings[0], "10.1.2.3")
+	assert.Contains(t, warnings[1], "hidden.onion:53", "unresolvable names are reported")
+
+	engine = policy.NewEngine(&api.NetworkConfig{BlockPrivateIPs: true, AllowedUDPHosts: entries, AllowedPrivateHosts: []string{"internal.example.com"}})
+	rules, _ = ResolveUDPAllowRules(context.Background(), engine, entries, resolver)
+	assert.Equal(t, []UDPAllowRule{{IP: net.ParseIP("10.1.2.3").To4(), Port: 53}}, rules)
+}
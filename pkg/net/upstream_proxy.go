@@ -0,0 +1,300 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// UpstreamProxy returns the proxy an upstream connection to addr
+// (host:port) goes through, or nil to connect directly.
+type UpstreamProxy func(addr string) *url.URL
+
+// NewUpstreamProxy returns the upstream proxy for network (see
+// api.NetworkConfig.UpstreamProxy), reading HTTPS_PROXY and NO_PROXY (or
+// their lowercase forms) through getenv when none is configured. It
+// returns nil when upstream connections should be made directly.
+func NewUpstreamProxy(network *api.NetworkConfig, getenv func(string) string) (UpstreamProxy, error) {
+	configured := ""
+	if network != nil {
+		configured = network.UpstreamProxy
+	}
+	if configured == api.UpstreamProxyNone {
+		return nil, nil
+	}
+	if configured != "" {
+		u, err := api.ParseUpstreamProxy(configured)
+		if err != nil {
+			return nil, err
+		}
+		return func(string) *url.URL { return u }, nil
+	}
+
+	u, err := api.ParseUpstreamProxy(envOr(getenv, "HTTPS_PROXY", "https_proxy"))
+	if err != nil || u == nil {
+		return nil, err
+	}
+	// httpproxy only decides which hosts NO_PROXY exempts; the proxy
+	// URL is the one parsed above, which also allows socks5h.
+	exempt := (&httpproxy.Config{
+		HTTPSProxy: "http://upstream.proxy",
+		NoProxy:    envOr(getenv, "NO_PROXY", "no_proxy"),
+	}).ProxyFunc()
+	return func(addr string) *url.URL {
+		if p, err := exempt(&url.URL{Scheme: "https", Host: addr}); err != nil || p == nil {
+			return nil
+		}
+		return u
+	}, nil
+}
+
+func envOr(getenv func(string) string, names ...string) string {
+	for _, name := range names {
+		if v := getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// upstreamDialer connects to upstream hosts, either directly or by
+// tunnelling through an upstream proxy: HTTP CONNECT for http:// and
+// https:// proxies, SOCKS5 otherwise. Plain HTTP is the exception: it is
+// forwarded by http:// and https:// proxies rather than tunnelled, since
+// they commonly refuse CONNECT to anything but 443 (see DialHTTP).
+type upstreamDialer struct {
+	direct *net.Dialer
+	proxy  UpstreamProxy
+}
+
+// newUpstreamDialer dials upstream hosts, resolving names with resolver
+// (nil means the host's default resolver) and going through upstream when
+// it is set.
+func newUpstreamDialer(resolver *net.Resolver, upstream UpstreamProxy) *upstreamDialer {
+	return &upstreamDialer{
+		direct: &net.Dialer{Timeout: upstreamDialTimeout, Resolver: resolver},
+		proxy:  upstream,
+	}
+}
+
+// Dial connects to addr within upstreamDialTimeout.
+func (d *upstreamDialer) Dial(network, addr string) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamDialTimeout)
+	defer cancel()
+	return d.DialContext(ctx, network, addr)
+}
+
+// DialTLS connects to addr and completes a TLS handshake with config.
+func (d *upstreamDialer) DialTLS(network, addr string, config *tls.Config) (*tls.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamDialTimeout)
+	defer cancel()
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// DialHTTP connects for plain HTTP requests to addr: to the forward proxy
+// when one applies, otherwise as Dial does. Send the requests with
+// writeHTTPRequest.
+func (d *upstreamDialer) DialHTTP(network, addr string) (net.Conn, error) {
+	proxyURL := d.forwardProxy(addr)
+	if proxyURL == nil {
+		return d.Dial(network, addr)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), upstreamDialTimeout)
+	defer cancel()
+	return d.dialProxy(ctx, proxyURL)
+}
+
+// writeHTTPRequest writes req, bound for addr, to a connection from
+// DialHTTP. Through a forward proxy it goes as an absolute-URI request
+// carrying the proxy's credentials.
+func (d *upstreamDialer) writeHTTPRequest(conn net.Conn, req *http.Request, addr string) error {
+	proxyURL := d.forwardProxy(addr)
+	if proxyURL == nil {
+		return req.Write(conn)
+	}
+	// WriteProxy takes the absolute URI's authority from Host, which a
+	// proxy must route by and substitute for the Host header anyway.
+	out := req.Clone(req.Context())
+	out.URL.Scheme = "http"
+	out.URL.Host = addr
+	out.Host = addr
+	if auth := proxyAuthorization(proxyURL); auth != "" {
+		out.Header.Set("Proxy-Authorization", auth)
+	}
+	return out.WriteProxy(conn)
+}
+
+// forwardProxy returns the http:// or https:// proxy plain HTTP to addr is
+// forwarded through, or nil when it goes direct or over SOCKS5.
+func (d *upstreamDialer) forwardProxy(addr string) *url.URL {
+	if d.proxy == nil {
+		return nil
+	}
+	if u := d.proxy(addr); u != nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return u
+	}
+	return nil
+}
+
+// transportProxy is the upstream proxy as an http.Transport Proxy func,
+// for clients whose transport dials with d.direct.
+func (d *upstreamDialer) transportProxy(req *http.Request) (*url.URL, error) {
+	if d.proxy == nil {
+		return nil, nil
+	}
+	port := req.URL.Port()
+	if port == "" {
+		port = "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return d.proxy(net.JoinHostPort(req.URL.Hostname(), port)), nil
+}
+
+// DialContext connects to addr, through the upstream proxy when one
+// applies to it.
+func (d *upstreamDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	var proxyURL *url.URL
+	if d.proxy != nil {
+		proxyURL = d.proxy(addr)
+	}
+	if proxyURL == nil {
+		return d.direct.DialContext(ctx, network, addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		socks, err := proxy.SOCKS5("tcp", proxyAddr(proxyURL), auth, d.direct)
+		if err != nil {
+			return nil, errx.With(ErrUpstreamProxy, " %s: %w", proxyURL.Redacted(), err)
+		}
+		conn, err := socks.(proxy.ContextDialer).DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, errx.With(ErrUpstreamProxy, " %s: %w", proxyURL.Redacted(), err)
+		}
+		return conn, nil
+	default:
+		return d.dialConnect(ctx, proxyURL, addr)
+	}
+}
+
+// dialProxy connects to an http:// or https:// proxy itself.
+func (d *upstreamDialer) dialProxy(ctx context.Context, proxyURL *url.URL) (net.Conn, error) {
+	conn, err := d.direct.DialContext(ctx, "tcp", proxyAddr(proxyURL))
+	if err != nil {
+		return nil, errx.With(ErrUpstreamProxy, " %s: %w", proxyURL.Redacted(), err)
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, errx.With(ErrUpstreamProxy, " %s: %w", proxyURL.Redacted(), err)
+		}
+		conn = tlsConn
+	}
+	return conn, nil
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request.
+func (d *upstreamDialer) dialConnect(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	conn, err := d.dialProxy(ctx, proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if auth := proxyAuthorization(proxyURL); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, errx.With(ErrUpstreamProxy, " %s: %w", proxyURL.Redacted(), err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, errx.With(ErrUpstreamProxy, " %s: %w", proxyURL.Redacted(), err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errx.With(ErrUpstreamProxy, " %s: CONNECT %s: %s", proxyURL.Redacted(), addr, resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// proxyAuthorization returns the Proxy-Authorization value for the
+// proxy's credentials, or "" when it has none.
+func proxyAuthorization(u *url.URL) string {
+	if u.User == nil {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password))
+}
+
+// proxyAddr returns host:port of the proxy, filling in the scheme's
+// default port.
+func proxyAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// bufferedConn serves bytes the proxy sent right after its CONNECT
+// response before reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,182 @@
+package net
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startFakeConnectProxy accepts HTTP CONNECT requests carrying wantAuth
+// as their Proxy-Authorization and tunnels every one of them to target,
+// whatever host was asked for. It records the requested hosts on seen.
+func startFakeConnectProxy(t *testing.T, target, wantAuth string, seen chan<- string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				req, err := http.ReadRequest(br)
+				if err != nil {
+					return
+				}
+				seen <- req.Host
+				if req.Method != http.MethodConnect || req.Header.Get("Proxy-Authorization") != wantAuth {
+					io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+					return
+				}
+				upstream, err := net.Dial("tcp", target)
+				if err != nil {
+					io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+					return
+				}
+				defer upstream.Close()
+				io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+				go io.Copy(upstream, br)
+				io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startFakeForwardProxy serves absolute-URI requests carrying wantAuth as
+// their Proxy-Authorization from handler, and refuses CONNECT, as forward
+// proxies commonly do for port 80. It records the requested URLs on seen.
+func startFakeForwardProxy(t *testing.T, wantAuth string, handler http.Handler, seen chan<- string) string {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen <- r.URL.String()
+		switch {
+		case r.Method == http.MethodConnect || !r.URL.IsAbs():
+			http.Error(w, "CONNECT not allowed", http.StatusForbidden)
+		case r.Header.Get("Proxy-Authorization") != wantAuth:
+			w.WriteHeader(http.StatusProxyAuthRequired)
+		default:
+			handler.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy.Listener.Addr().String()
+}
+
+func TestNewUpstreamProxy(t *testing.T) {
+	env := map[string]string{
+		"https_proxy": "socks5h://proxy.corp:1080",
+		"NO_PROXY":    "internal.corp,10.0.0.0/8",
+	}
+	getenv := func(name string) string { return env[name] }
+
+	fromEnv, err := NewUpstreamProxy(&api.NetworkConfig{}, getenv)
+	require.NoError(t, err)
+	require.NotNil(t, fromEnv)
+	assert.Equal(t, "socks5h://proxy.corp:1080", fromEnv("api.example.com:443").String())
+	assert.Nil(t, fromEnv("git.internal.corp:443"), "NO_PROXY domains connect directly")
+	assert.Nil(t, fromEnv("10.1.2.3:22"), "NO_PROXY CIDRs connect directly")
+	assert.Nil(t, fromEnv("localhost:80"))
+
+	configured, err := NewUpstreamProxy(&api.NetworkConfig{UpstreamProxy: "http://squid:3128"}, getenv)
+	require.NoError(t, err)
+	assert.Equal(t, "http://squid:3128", configured("git.internal.corp:443").String(), "an explicit proxy ignores NO_PROXY")
+
+	none, err := NewUpstreamProxy(&api.NetworkConfig{UpstreamProxy: api.UpstreamProxyNone}, getenv)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	unset, err := NewUpstreamProxy(nil, func(string) string { return "" })
+	require.NoError(t, err)
+	assert.Nil(t, unset)
+
+	_, err = NewUpstreamProxy(nil, func(string) string { return "ftp://proxy.corp" })
+	assert.ErrorIs(t, err, api.ErrInvalidUpstreamProxy)
+}
+
+func TestProxyAddrDefaultsPort(t *testing.T) {
+	for raw, want := range map[string]string{
+		"http://proxy:3128":    "proxy:3128",
+		"http://proxy":         "proxy:80",
+		"https://proxy":        "proxy:443",
+		"socks5h://proxy":      "proxy:1080",
+		"http://[2001:db8::1]": "[2001:db8::1]:80",
+	} {
+		u, err := url.Parse(raw)
+		require.NoError(t, err)
+		assert.Equal(t, want, proxyAddr(u), raw)
+	}
+}
+
+func TestHTTPInterceptorForwardsThroughUpstreamProxy(t *testing.T) {
+	seen := make(chan string, 1)
+	proxyAddr := startFakeForwardProxy(t, "Basic dXNlcjpzM2NyZXQ=", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "via proxy")
+	}), seen)
+	proxyURL, err := url.Parse("http://user:s3cret@" + proxyAddr)
+	require.NoError(t, err)
+
+	engine := policy.NewEngine(&api.NetworkConfig{AllowedHosts: []string{"only.behind.proxy"}})
+	interceptor := NewHTTPInterceptor(engine, api.NewEventSink(10), nil, nil)
+	interceptor.setDialer(newUpstreamDialer(nil, func(string) *url.URL { return proxyURL }))
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go interceptor.HandleHTTP(server, "10.0.0.1", 80)
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(client, "GET /path?q=1 HTTP/1.1\r\nHost: only.behind.proxy\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(client), nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "via proxy", string(body))
+	assert.Equal(t, "http://only.behind.proxy:80/path?q=1", <-seen, "plain HTTP is forwarded, not tunnelled, and the proxy resolves the hostname")
+}
+
+func TestMirrorClientForwardsThroughUpstreamProxy(t *testing.T) {
+	seen := make(chan string, 1)
+	proxyAddr := startFakeForwardProxy(t, "Basic dXNlcjpzM2NyZXQ=", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}), seen)
+	proxyURL, err := url.Parse("http://user:s3cret@" + proxyAddr)
+	require.NoError(t, err)
+
+	client := newMirrorClient(newUpstreamDialer(nil, func(string) *url.URL { return proxyURL }))
+	resp, err := client.Post("http://shadow.internal/v1", "text/plain", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "http://shadow.internal/v1", <-seen)
+}
+
+func TestUpstreamDialerReportsRejectedConnect(t *testing.T) {
+	seen := make(chan string, 1)
+	proxyAddr := startFakeConnectProxy(t, "127.0.0.1:1", "Basic right", seen)
+	proxyURL, err := url.Parse("http://" + proxyAddr)
+	require.NoError(t, err)
+
+	dialer := newUpstreamDialer(nil, func(string) *url.URL { return proxyURL })
+	_, err = dialer.Dial("tcp", "example.com:443")
+	require.ErrorIs(t, err, ErrUpstreamProxy)
+	assert.Contains(t, err.Error(), "407")
+	assert.Equal(t, "example.com:443", <-seen)
+}
@@ -5,33 +5,71 @@ import (
 	"encoding/hex"
 	"net"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/jingkaihe/matchlock/pkg/api"
 )
 
 type Engine struct {
-	config       *api.NetworkConfig
-	placeholders map[string]string
+	config        *api.NetworkConfig
+	placeholders  map[string]string
+	hostMachineIP string // guest-facing gateway IP for api.HostMachineAlias
+
+	// Host patterns from config, compiled once by NewEngine.
+	allowedHosts *globSet
+	privateHosts *globSet
+	secretHosts  map[string]*globSet
+	mirrorHosts  []glob // parallel to config.MirrorRoutes
+	udpHosts     []udpRule
+	scrubPairs   []scrubPair // secret values to placeholders, for OnResponse
+
+	// approved holds hosts allowed at runtime by AddAllowedHost; changed is
+	// closed and replaced whenever it grows, waking AwaitHostAllowed.
+	mu            sync.RWMutex
+	approved      []string
+	approvedHosts *globSet
+	changed       chan struct{}
 }
 
 func NewEngine(config *api.NetworkConfig) *Engine {
 	e := &Engine{
-		config:       config,
-		placeholders: make(map[string]string),
+		config:        config,
+		placeholders:  make(map[string]string),
+		allowedHosts:  newGlobSet(config.AllowedHosts),
+		privateHosts:  newGlobSet(config.AllowedPrivateHosts),
+		secretHosts:   make(map[string]*globSet),
+		approvedHosts: newGlobSet(nil),
+		changed:       make(chan struct{}),
+	}
+	for _, rule := range config.MirrorRoutes {
+		e.mirrorHosts = append(e.mirrorHosts, compileGlob(rule.HostGlob))
+	}
+	for _, entry := range config.AllowedUDPHosts {
+		// Entries are validated with the config; a bad one matches nothing.
+		if host, port, err := api.ParseUDPHost(entry); err == nil {
+			e.udpHosts = append(e.udpHosts, udpRule{host: compileGlob(host), port: port})
+		}
 	}
 
+	scrub := make(map[string]string)
 	for name, secret := range config.Secrets {
+		// Raw file secrets are handed to the guest as-is; the proxy never
+		// substitutes them, so they get no placeholder.
+		if secret.FileRaw {
+			continue
+		}
 		if secret.Placeholder == "" {
-			placeholder := generatePlaceholder()
-			config.Secrets[name] = api.Secret{
-				Value:       secret.Value,
-				Placeholder: placeholder,
-				Hosts:       secret.Hosts,
-			}
+			secret.Placeholder = generatePlaceholder()
+			config.Secrets[name] = secret
 		}
 		e.placeholders[name] = config.Secrets[name].Placeholder
+		e.secretHosts[name] = newGlobSet(secret.Hosts)
+		scrub[secret.Value] = secret.Placeholder
 	}
+	e.scrubPairs = newScrubPairs(scrub)
 
 	return e
 }
@@ -54,8 +92,38 @@ func (e *Engine) GetPlaceholders() map[string]string {
 	return result
 }
 
+// SecretNames returns the configured secret names, sorted. Values and
+// placeholders are never included.
+func (e *Engine) SecretNames() []string {
+	names := make([]string, 0, len(e.placeholders))
+	for name := range e.placeholders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SecretPlaceholder returns the placeholder of secret name, which OnRequest
+// replaces with the real value only on requests to the secret's hosts. Raw
+// file secrets have no placeholder.
+func (e *Engine) SecretPlaceholder(name string) (string, bool) {
+	placeholder, ok := e.placeholders[name]
+	return placeholder, ok
+}
+
+// SetHostMachineIP records the gateway IP that api.HostMachineAlias resolves
+// to inside the guest, so connections addressed to it by IP are recognized.
+func (e *Engine) SetHostMachineIP(ip string) {
+	e.hostMachineIP = ip
+}
+
 func (e *Engine) IsHostAllowed(host string) bool {
-	host = strings.Split(host, ":")[0]
+	host = stripPort(host)
+
+	// An explicitly allowed host machine bypasses BlockPrivateIPs.
+	if e.isHostMachine(host) {
+		return true
+	}
 
 	if e.config.BlockPrivateIPs {
 		if isPrivateIP(host) {
@@ -69,28 +137,142 @@ func (e *Engine) IsHostAllowed(host string) bool {
 		return true
 	}
 
-	for _, pattern := range e.config.AllowedHosts {
-		if matchGlob(pattern, host) {
+	if e.allowedHosts.match(host) {
+		return true
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.approvedHosts.match(host)
+}
+
+// udpRule is a compiled AllowedUDPHosts entry; port 0 matches any port.
+type udpRule struct {
+	host glob
+	port int
+}
+
+// IsUDPAllowed reports whether the guest may send UDP to host (a hostname
+// or IP) on port. Unlike TCP, UDP is denied unless an AllowedUDPHosts entry
+// matches; BlockPrivateIPs and AllowedPrivateHosts apply as for TCP. DNS to
+// the configured resolvers is allowed separately by the network layer.
+func (e *Engine) IsUDPAllowed(host string, port int) bool {
+	if e.config.BlockPrivateIPs && !e.isHostMachine(host) && isPrivateIP(host) && !e.isPrivateHostAllowed(host) {
+		return false
+	}
+	for _, rule := range e.udpHosts {
+		if (rule.port == 0 || rule.port == port) && rule.host.match(host) {
 			return true
 		}
 	}
-
 	return false
 }
 
-func (e *Engine) isPrivateHostAllowed(host string) bool {
-	for _, pattern := range e.config.AllowedPrivateHosts {
-		if matchGlob(pattern, host) {
+// IsResolvedUDPAllowed reports whether ip, an address host resolved to,
+// passes BlockPrivateIPs for UDP. AllowedPrivateHosts may name either.
+func (e *Engine) IsResolvedUDPAllowed(host string, ip net.IP) bool {
+	addr := ip.String()
+	if !e.config.BlockPrivateIPs || e.isHostMachine(host) || e.isHostMachine(addr) {
+		return true
+	}
+	return !isPrivateIP(addr) || e.isPrivateHostAllowed(host) || e.isPrivateHostAllowed(addr)
+}
+
+// AddAllowedHost adds a host or glob pattern to the allowlist at runtime.
+// It does not override BlockPrivateIPs. Safe for concurrent use.
+func (e *Engine) AddAllowedHost(pattern string) {
+	pattern = stripPort(pattern)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, p := range e.approved {
+		if p == pattern {
+			return
+		}
+	}
+	e.approved = append(e.approved, pattern)
+	e.approvedHosts.add(pattern)
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
+
+// HostApprovable reports whether a connection to host, which IsHostAllowed
+// rejected, should be held for runtime approval: HostApproval is enabled and
+// only the allowlist, which AddAllowedHost can extend, stands in the way.
+func (e *Engine) HostApprovable(host string) bool {
+	if !e.config.HostApproval || len(e.config.AllowedHosts) == 0 {
+		return false
+	}
+	host = stripPort(host)
+	return !e.config.BlockPrivateIPs || !isPrivateIP(host) || e.isPrivateHostAllowed(host)
+}
+
+// HostApprovalTimeout returns how long AwaitHostAllowed waits.
+func (e *Engine) HostApprovalTimeout() time.Duration {
+	return e.config.GetHostApprovalTimeout()
+}
+
+// AwaitHostAllowed waits up to HostApprovalTimeout for host to become
+// allowed and reports whether it did.
+func (e *Engine) AwaitHostAllowed(host string) bool {
+	timer := time.NewTimer(e.HostApprovalTimeout())
+	defer timer.Stop()
+	for {
+		e.mu.RLock()
+		changed := e.changed
+		e.mu.RUnlock()
+		if e.IsHostAllowed(host) {
 			return true
 		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return false
+		}
 	}
-	return false
+}
+
+// isHostMachine reports whether host addresses the host machine through an
+// allowed api.HostMachineAlias.
+func (e *Engine) isHostMachine(host string) bool {
+	if !e.config.AllowsHostMachine() {
+		return false
+	}
+	return host == api.HostMachineAlias || (e.hostMachineIP != "" && host == e.hostMachineIP)
+}
+
+// UpstreamHost returns the host the proxy should dial for host. Traffic to
+// the host machine goes to the host's loopback interface; the gateway IP the
+// guest sees is not routable from the host on every platform.
+func (e *Engine) UpstreamHost(host string) string {
+	if e.isHostMachine(strings.Split(host, ":")[0]) {
+		return "127.0.0.1"
+	}
+	return host
+}
+
+// MirrorTarget returns the mirror base URL of the first mirror route
+// matching host, or "" when requests to host are not mirrored.
+func (e *Engine) MirrorTarget(host string) string {
+	host = strings.Split(host, ":")[0]
+	for i, g := range e.mirrorHosts {
+		if g.match(host) {
+			return e.config.MirrorRoutes[i].MirrorTo
+		}
+	}
+	return ""
+}
+
+func (e *Engine) isPrivateHostAllowed(host string) bool {
+	return e.privateHosts.match(host)
 }
 
 func (e *Engine) OnRequest(req *http.Request, host string) (*http.Request, error) {
 	host = strings.Split(host, ":")[0]
 
 	for name, secret := range e.config.Secrets {
+		if secret.FileRaw {
+			continue
+		}
 		if !e.isSecretAllowedForHost(name, host) {
 			if e.requestContainsPlaceholder(req, secret.Placeholder) {
 				return nil, api.ErrSecretLeak
@@ -99,11 +281,59 @@ func (e *Engine) OnRequest(req *http.Request, host string) (*http.Request, error
 		}
 		e.replaceInRequest(req, secret.Placeholder, secret.Value)
 	}
+	// Only offer encodings OnResponse can decode and scrub.
+	if len(e.scrubPairs) > 0 {
+		req.Header.Set("Accept-Encoding", scrubAcceptEncoding)
+	}
 
 	return req, nil
 }
 
+// InjectedSecrets returns the names, sorted, of the secrets OnRequest will
+// substitute into req for host. Call it before OnRequest, which removes the
+// placeholders it looks for.
+func (e *Engine) InjectedSecrets(req *http.Request, host string) []string {
+	host = strings.Split(host, ":")[0]
+
+	var names []string
+	for name, secret := range e.config.Secrets {
+		if secret.FileRaw || !e.isSecretAllowedForHost(name, host) {
+			continue
+		}
+		if substitutesPlaceholder(req, secret.Placeholder) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OnResponse closes the substitution round trip: any real secret value an
+// upstream echoes back, in a header or the body, is replaced with its
+// placeholder before the guest sees it. The body is scrubbed as it streams,
+// so its length is no longer known up front. gzip and deflate bodies are
+// decoded first and reach the guest uncompressed; any other encoding is
+// refused with api.ErrScrubEncoding, since an echo inside it could not be
+// found.
 func (e *Engine) OnResponse(resp *http.Response, req *http.Request, host string) (*http.Response, error) {
+	if len(e.scrubPairs) == 0 {
+		return resp, nil
+	}
+	if resp.Body != nil && resp.Body != http.NoBody {
+		body, err := decodeBody(resp.Body, resp.Header.Get("Content-Encoding"))
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = newScrubReader(body, e.scrubPairs)
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+		resp.Header.Del("Content-Encoding")
+	}
+	for key, values := range resp.Header {
+		for i, v := range values {
+			resp.Header[key][i] = scrubString(v, e.scrubPairs)
+		}
+	}
 	return resp, nil
 }
 
@@ -116,14 +346,7 @@ func (e *Engine) isSecretAllowedForHost(secretName, host string) bool {
 	if len(secret.Hosts) == 0 {
 		return true
 	}
-
-	for _, pattern := range secret.Hosts {
-		if matchGlob(pattern, host) {
-			return true
-		}
-	}
-
-	return false
+	return e.secretHosts[secretName].match(host)
 }
 
 func (e *Engine) requestContainsPlaceholder(req *http.Request, placeholder string) bool {
@@ -144,6 +367,19 @@ func (e *Engine) requestContainsPlaceholder(req *http.Request, placeholder strin
 	return false
 }
 
+// substitutesPlaceholder reports whether replaceInRequest would replace
+// placeholder somewhere in req.
+func substitutesPlaceholder(req *http.Request, placeholder string) bool {
+	for _, values := range req.Header {
+		for _, v := range values {
+			if strings.Contains(v, placeholder) {
+				return true
+			}
+		}
+	}
+	return req.URL != nil && strings.Contains(req.URL.RawQuery, placeholder)
+}
+
 // replaceInRequest substitutes the placeholder with the real secret in headers
 // and URL query params only. We intentionally skip the request body because the
 // body is processed by the remote server's application layer, which may log or
@@ -165,66 +401,17 @@ func (e *Engine) replaceInRequest(req *http.Request, placeholder, value string)
 
 }
 
-func matchGlob(pattern, str string) bool {
-	if pattern == "*" {
-		return true
-	}
-
-	// Simple prefix wildcard: *.example.com
-	if strings.HasPrefix(pattern, "*.") && !strings.Contains(pattern[2:], "*") {
-		suffix := pattern[1:]
-		return strings.HasSuffix(str, suffix)
+// stripPort returns host without a trailing port. A bare IPv6 address,
+// which net.SplitHostPort rejects, is returned unbracketed as is.
+func stripPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
 	}
-
-	// Simple suffix wildcard: example.*
-	if strings.HasSuffix(pattern, ".*") && !strings.Contains(pattern[:len(pattern)-2], "*") {
-		prefix := pattern[:len(pattern)-2]
-		return strings.HasPrefix(str, prefix+".")
-	}
-
-	// General glob matching with * as wildcard
-	if strings.Contains(pattern, "*") {
-		return matchWildcard(pattern, str)
-	}
-
-	return pattern == str
-}
-
-// matchWildcard handles patterns with * wildcards anywhere
-func matchWildcard(pattern, str string) bool {
-	parts := strings.Split(pattern, "*")
-	if len(parts) == 1 {
-		return pattern == str
+	if strings.Count(host, ":") > 1 {
+		return strings.Trim(host, "[]")
 	}
-
-	// Check prefix (before first *)
-	if parts[0] != "" && !strings.HasPrefix(str, parts[0]) {
-		return false
-	}
-	str = str[len(parts[0]):]
-
-	// Check suffix (after last *)
-	lastPart := parts[len(parts)-1]
-	if lastPart != "" && !strings.HasSuffix(str, lastPart) {
-		return false
-	}
-	if lastPart != "" {
-		str = str[:len(str)-len(lastPart)]
-	}
-
-	// Check middle parts in order
-	for i := 1; i < len(parts)-1; i++ {
-		if parts[i] == "" {
-			continue
-		}
-		idx := strings.Index(str, parts[i])
-		if idx < 0 {
-			return false
-		}
-		str = str[idx+len(parts[i]):]
-	}
-
-	return true
+	h, _, _ := strings.Cut(host, ":")
+	return h
 }
 
 func isPrivateIP(host string) bool {
@@ -1,11 +1,13 @@
 package policy
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jingkaihe/matchlock/pkg/api"
 	"github.com/stretchr/testify/assert"
@@ -363,3 +365,266 @@ func TestIsPrivateIP(t *testing.T) {
 		})
 	}
 }
+
+func TestEngine_HostMachineAlias(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		AllowedHosts:    []string{"api.example.com", api.HostMachineAlias},
+		BlockPrivateIPs: true,
+	})
+	engine.SetHostMachineIP("192.168.105.1")
+
+	assert.True(t, engine.IsHostAllowed(api.HostMachineAlias))
+	assert.True(t, engine.IsHostAllowed(api.HostMachineAlias+":11434"))
+	assert.True(t, engine.IsHostAllowed("192.168.105.1"), "gateway IP should bypass BlockPrivateIPs")
+	assert.False(t, engine.IsHostAllowed("192.168.105.2"))
+
+	assert.Equal(t, "127.0.0.1", engine.UpstreamHost(api.HostMachineAlias))
+	assert.Equal(t, "127.0.0.1", engine.UpstreamHost("192.168.105.1"))
+	assert.Equal(t, "api.example.com", engine.UpstreamHost("api.example.com"))
+}
+
+func TestEngine_HostMachineAliasRequiresExplicitEntry(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		AllowedHosts:    []string{"*"},
+		BlockPrivateIPs: true,
+	})
+	engine.SetHostMachineIP("192.168.105.1")
+
+	assert.False(t, engine.IsHostAllowed("192.168.105.1"))
+	assert.Equal(t, "192.168.105.1", engine.UpstreamHost("192.168.105.1"))
+}
+
+func TestEngine_MirrorTarget(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		MirrorRoutes: []api.MirrorRule{
+			{HostGlob: "api.openai.com", MirrorTo: "http://localhost:8000"},
+			{HostGlob: "*.anthropic.com", MirrorTo: "http://localhost:9000"},
+		},
+	})
+
+	assert.Equal(t, "http://localhost:8000", engine.MirrorTarget("api.openai.com:443"))
+	assert.Equal(t, "http://localhost:9000", engine.MirrorTarget("api.anthropic.com"))
+	assert.Empty(t, engine.MirrorTarget("example.com"))
+}
+
+func TestEngine_IsUDPAllowed(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		AllowedHosts:    []string{"*"},
+		AllowedUDPHosts: []string{"9.9.9.9:53", "*.quic.example.com", "203.0.113.*:443"},
+	})
+
+	assert.True(t, engine.IsUDPAllowed("9.9.9.9", 53))
+	assert.False(t, engine.IsUDPAllowed("9.9.9.9", 853), "port is part of the entry")
+	assert.True(t, engine.IsUDPAllowed("edge.quic.example.com", 443))
+	assert.True(t, engine.IsUDPAllowed("edge.quic.example.com", 8443), "entry without port allows any port")
+	assert.True(t, engine.IsUDPAllowed("203.0.113.7", 443))
+	assert.False(t, engine.IsUDPAllowed("203.0.113.7", 80))
+	assert.False(t, engine.IsUDPAllowed("8.8.8.8", 53), "AllowedHosts does not cover UDP")
+
+	assert.False(t, NewEngine(&api.NetworkConfig{}).IsUDPAllowed("8.8.8.8", 53), "UDP is denied by default")
+}
+
+func TestEngine_IsUDPAllowed_BlockPrivateIPs(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		BlockPrivateIPs:     true,
+		AllowedPrivateHosts: []string{"10.0.0.53"},
+		AllowedUDPHosts:     []string{"10.0.0.*:53"},
+	})
+
+	assert.True(t, engine.IsUDPAllowed("10.0.0.53", 53))
+	assert.False(t, engine.IsUDPAllowed("10.0.0.54", 53))
+}
+
+func TestEngine_SecretNames(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"OPENAI_KEY":    {Value: "sk-1"},
+			"ANTHROPIC_KEY": {Value: "sk-2"},
+		},
+	})
+	assert.Equal(t, []string{"ANTHROPIC_KEY", "OPENAI_KEY"}, engine.SecretNames())
+	assert.Empty(t, NewEngine(&api.NetworkConfig{}).SecretNames())
+}
+
+func TestEngine_SecretPlaceholder(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		AllowedHosts: []string{"api.openai.com"},
+		Secrets: map[string]api.Secret{
+			"OPENAI_KEY": {Value: "sk-1", Hosts: []string{"api.openai.com"}},
+		},
+	})
+
+	placeholder, ok := engine.SecretPlaceholder("OPENAI_KEY")
+	assert.True(t, ok)
+	assert.Equal(t, engine.GetPlaceholder("OPENAI_KEY"), placeholder)
+	assert.NotEqual(t, "sk-1", placeholder)
+
+	_, ok = engine.SecretPlaceholder("MISSING")
+	assert.False(t, ok)
+}
+
+func TestEngine_AddAllowedHost(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{AllowedHosts: []string{"api.openai.com"}})
+	require.False(t, engine.IsHostAllowed("example.com"))
+
+	engine.AddAllowedHost("*.example.com")
+	engine.AddAllowedHost("example.com:443")
+	engine.AddAllowedHost("example.com")
+
+	assert.True(t, engine.IsHostAllowed("example.com"))
+	assert.True(t, engine.IsHostAllowed("api.example.com:8443"))
+	assert.False(t, engine.IsHostAllowed("evil.com"))
+	assert.Len(t, engine.approved, 2)
+}
+
+func TestEngine_AddAllowedHostIPv6(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{AllowedHosts: []string{"api.openai.com"}})
+
+	engine.AddAllowedHost("2001:db8::1")
+	engine.AddAllowedHost("[2001:db8::2]:443")
+	engine.AddAllowedHost("[2001:db8::3]")
+
+	assert.Equal(t, []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"}, engine.approved)
+	assert.True(t, engine.IsHostAllowed("2001:db8::1"))
+	assert.True(t, engine.IsHostAllowed("[2001:db8::2]:8443"))
+	assert.True(t, engine.IsHostAllowed("[2001:db8::3]:443"))
+	assert.False(t, engine.IsHostAllowed("2001:db8::4"))
+}
+
+func TestEngine_HostApprovable(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		AllowedHosts:    []string{"api.openai.com"},
+		BlockPrivateIPs: true,
+		HostApproval:    true,
+	})
+	assert.True(t, engine.HostApprovable("example.com"))
+	assert.False(t, engine.HostApprovable("10.0.0.1"), "the allowlist cannot unblock private IPs")
+
+	off := NewEngine(&api.NetworkConfig{AllowedHosts: []string{"api.openai.com"}})
+	assert.False(t, off.HostApprovable("example.com"), "approval is opt-in")
+}
+
+func TestEngine_AwaitHostAllowed(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		AllowedHosts:               []string{"api.openai.com"},
+		HostApproval:               true,
+		HostApprovalTimeoutSeconds: 5,
+	})
+
+	done := make(chan bool, 1)
+	go func() { done <- engine.AwaitHostAllowed("example.com:443") }()
+	engine.AddAllowedHost("other.com")
+	engine.AddAllowedHost("example.com")
+
+	select {
+	case allowed := <-done:
+		assert.True(t, allowed)
+	case <-time.After(2 * time.Second):
+		t.Fatal("AwaitHostAllowed did not wake up on AddAllowedHost")
+	}
+}
+
+func TestGlobSetMatchesLinearScan(t *testing.T) {
+	patterns := []string{
+		"api.example.com", "*.example.org", "internal.*", "api-*.corp.net", "*-prod.svc", "*.*.deep.io", "",
+	}
+	hosts := []string{
+		"api.example.com", "example.com", "a.example.org", "a.b.example.org", "example.org",
+		"internal.local", "internal", "api-v1.corp.net", "corp.net", "db-prod.svc", "x.y.deep.io",
+		"deep.io", "", ".", "a..example.org",
+	}
+	set := newGlobSet(patterns)
+	for _, host := range hosts {
+		linear := false
+		for _, pattern := range patterns {
+			if matchGlob(pattern, host) {
+				linear = true
+				break
+			}
+		}
+		assert.Equal(t, linear, set.match(host), host)
+	}
+}
+
+// benchmarkAllowlist returns 1000 allow rules, mostly exact hosts and
+// "*.domain" patterns with some inner wildcards, and hosts to check
+// against them.
+func benchmarkAllowlist() ([]string, []string) {
+	var patterns []string
+	for i := 0; i < 1000; i++ {
+		switch i % 10 {
+		case 0:
+			patterns = append(patterns, fmt.Sprintf("api-*.tenant%d.example.com", i))
+		case 1, 2, 3, 4:
+			patterns = append(patterns, fmt.Sprintf("*.service%d.example.com", i))
+		default:
+			patterns = append(patterns, fmt.Sprintf("host%d.example.com", i))
+		}
+	}
+	hosts := []string{
+		"host999.example.com",
+		"a.b.service994.example.com",
+		"api-v2.tenant990.example.com",
+		"denied.example.net",
+	}
+	return patterns, hosts
+}
+
+func BenchmarkIsHostAllowed1000Rules(b *testing.B) {
+	patterns, hosts := benchmarkAllowlist()
+	engine := NewEngine(&api.NetworkConfig{AllowedHosts: patterns})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.IsHostAllowed(hosts[i%len(hosts)])
+	}
+}
+
+// BenchmarkMatchGlobLinear1000Rules is the per-pattern scan IsHostAllowed
+// did before patterns were compiled, kept for comparison.
+func BenchmarkMatchGlobLinear1000Rules(b *testing.B) {
+	patterns, hosts := benchmarkAllowlist()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		host := hosts[i%len(hosts)]
+		for _, pattern := range patterns {
+			if matchGlob(pattern, host) {
+				break
+			}
+		}
+	}
+}
+
+func TestEngine_RawFileSecretIsNeverProxied(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"DEPLOY_KEY": {Value: "raw-key", File: "/workspace/.ssh/id", FileRaw: true},
+		},
+	})
+
+	assert.Empty(t, engine.GetPlaceholders())
+	_, ok := engine.SecretPlaceholder("DEPLOY_KEY")
+	assert.False(t, ok)
+
+	req := &http.Request{
+		Header: http.Header{"Authorization": []string{"Bearer token"}},
+		URL:    &url.URL{},
+	}
+	result, err := engine.OnRequest(req, "api.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token", result.Header.Get("Authorization"))
+}
+
+func TestEngine_FileSecretKeepsFileWhenPlaceholderGenerated(t *testing.T) {
+	config := &api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"GH_TOKEN": {Value: "gh", Hosts: []string{"api.github.com"}, File: "/workspace/.secrets/gh"},
+		},
+	}
+	engine := NewEngine(config)
+
+	secret := config.Secrets["GH_TOKEN"]
+	assert.Equal(t, engine.GetPlaceholder("GH_TOKEN"), secret.Placeholder)
+	assert.Equal(t, "/workspace/.secrets/gh", secret.File)
+}
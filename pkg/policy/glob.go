@@ -0,0 +1,156 @@
+package policy
+
+import "strings"
+
+type globKind int
+
+const (
+	globExact    globKind = iota // "api.example.com"
+	globAny                      // "*"
+	globSuffix                   // "*.example.com"
+	globPrefix                   // "example.*"
+	globWildcard                 // "api-*.example.com" and other inner wildcards
+)
+
+// glob is a host pattern parsed once, when the engine is built, so matching
+// a host does not re-parse it.
+type glob struct {
+	kind  globKind
+	value string   // exact host, suffix (".example.com") or prefix ("example.")
+	parts []string // pattern split on "*" for globWildcard
+}
+
+func compileGlob(pattern string) glob {
+	switch {
+	case pattern == "*":
+		return glob{kind: globAny}
+	case strings.HasPrefix(pattern, "*.") && !strings.Contains(pattern[2:], "*"):
+		return glob{kind: globSuffix, value: pattern[1:]}
+	case strings.HasSuffix(pattern, ".*") && !strings.Contains(pattern[:len(pattern)-2], "*"):
+		return glob{kind: globPrefix, value: pattern[:len(pattern)-1]}
+	case strings.Contains(pattern, "*"):
+		return glob{kind: globWildcard, parts: strings.Split(pattern, "*")}
+	}
+	return glob{kind: globExact, value: pattern}
+}
+
+func (g glob) match(host string) bool {
+	switch g.kind {
+	case globAny:
+		return true
+	case globSuffix:
+		return strings.HasSuffix(host, g.value)
+	case globPrefix:
+		return strings.HasPrefix(host, g.value)
+	case globWildcard:
+		return matchWildcard(g.parts, host)
+	}
+	return g.value == host
+}
+
+// globSet matches a host against many patterns at once. Exact hosts and
+// "*.x" / "x.*" patterns sit in maps keyed by what they must equal, and a
+// host is looked up by its dot-delimited suffixes and prefixes, so the cost
+// grows with the host's labels rather than with the number of patterns.
+// Only patterns with inner wildcards are tried one by one.
+type globSet struct {
+	any       bool
+	exact     map[string]struct{}
+	suffixes  map[string]struct{}
+	prefixes  map[string]struct{}
+	wildcards []glob
+}
+
+func newGlobSet(patterns []string) *globSet {
+	s := &globSet{
+		exact:    make(map[string]struct{}),
+		suffixes: make(map[string]struct{}),
+		prefixes: make(map[string]struct{}),
+	}
+	for _, pattern := range patterns {
+		s.add(pattern)
+	}
+	return s
+}
+
+func (s *globSet) add(pattern string) {
+	g := compileGlob(pattern)
+	switch g.kind {
+	case globAny:
+		s.any = true
+	case globExact:
+		s.exact[g.value] = struct{}{}
+	case globSuffix:
+		s.suffixes[g.value] = struct{}{}
+	case globPrefix:
+		s.prefixes[g.value] = struct{}{}
+	default:
+		s.wildcards = append(s.wildcards, g)
+	}
+}
+
+func (s *globSet) match(host string) bool {
+	if s.any {
+		return true
+	}
+	if _, ok := s.exact[host]; ok {
+		return true
+	}
+	// A suffix pattern's value starts with "." and a prefix pattern's ends
+	// with one, so only the splits at dots can match.
+	if len(s.suffixes) > 0 || len(s.prefixes) > 0 {
+		for i := 0; i < len(host); i++ {
+			if host[i] != '.' {
+				continue
+			}
+			if _, ok := s.suffixes[host[i:]]; ok {
+				return true
+			}
+			if _, ok := s.prefixes[host[:i+1]]; ok {
+				return true
+			}
+		}
+	}
+	for _, g := range s.wildcards {
+		if g.match(host) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGlob(pattern, str string) bool {
+	return compileGlob(pattern).match(str)
+}
+
+// matchWildcard matches str against a pattern already split on "*".
+func matchWildcard(parts []string, str string) bool {
+	// Check prefix (before first *)
+	if parts[0] != "" && !strings.HasPrefix(str, parts[0]) {
+		return false
+	}
+	str = str[len(parts[0]):]
+
+	// Check suffix (after last *)
+	lastPart := parts[len(parts)-1]
+	if lastPart != "" && !strings.HasSuffix(str, lastPart) {
+		return false
+	}
+	if lastPart != "" {
+		str = str[:len(str)-len(lastPart)]
+	}
+
+	// Check middle parts in order
+	for i := 1; i < len(parts)-1; i++ {
+		if parts[i] == "" {
+			continue
+		}
+		idx := strings.Index(str, parts[i])
+		if idx < 0 {
+			return false
+		}
+		str = str[idx+len(parts[i]):]
+	}
+
+	return true
+}
@@ -0,0 +1,177 @@
+package policy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// scrubChunkSize is how much of the upstream body scrubReader reads at once.
+const scrubChunkSize = 32 << 10
+
+// scrubAcceptEncoding replaces a request's Accept-Encoding while secrets
+// are scrubbed from responses: the encodings decodeBody understands.
+const scrubAcceptEncoding = "gzip, deflate"
+
+// decodeBody returns body decoded from the given Content-Encoding. Closing
+// the result closes body.
+func decodeBody(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	var (
+		decoded io.Reader
+		err     error
+	)
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		decoded, err = gzip.NewReader(body)
+	case "deflate":
+		decoded, err = zlib.NewReader(body)
+	default:
+		return nil, errx.With(api.ErrScrubEncoding, " %q", encoding)
+	}
+	if err != nil {
+		return nil, errx.With(api.ErrScrubEncoding, " %q: %w", encoding, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{decoded, body}, nil
+}
+
+// scrubPair maps a real secret value back to its placeholder.
+type scrubPair struct {
+	value       []byte
+	placeholder []byte
+}
+
+// newScrubPairs returns the pairs for values, longest value first so that
+// of two secrets matching at the same offset the longer one wins.
+func newScrubPairs(values map[string]string) []scrubPair {
+	pairs := make([]scrubPair, 0, len(values))
+	for value, placeholder := range values {
+		if value == "" {
+			continue
+		}
+		pairs = append(pairs, scrubPair{value: []byte(value), placeholder: []byte(placeholder)})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if len(pairs[i].value) != len(pairs[j].value) {
+			return len(pairs[i].value) > len(pairs[j].value)
+		}
+		return bytes.Compare(pairs[i].value, pairs[j].value) < 0
+	})
+	return pairs
+}
+
+// scrubString replaces every secret value in s with its placeholder.
+func scrubString(s string, pairs []scrubPair) string {
+	for _, pair := range pairs {
+		s = strings.ReplaceAll(s, string(pair.value), string(pair.placeholder))
+	}
+	return s
+}
+
+// scrubReader replaces secret values in a stream with their placeholders
+// without buffering the whole stream: it holds back only the tail that
+// could still be the start of a value split across reads.
+type scrubReader struct {
+	src    io.ReadCloser
+	pairs  []scrubPair
+	maxLen int
+
+	in  []byte // read but not yet scanned
+	out []byte // scrubbed and ready to return
+	eof bool
+	err error
+}
+
+func newScrubReader(src io.ReadCloser, pairs []scrubPair) *scrubReader {
+	r := &scrubReader{src: src, pairs: pairs}
+	for _, pair := range pairs {
+		r.maxLen = max(r.maxLen, len(pair.value))
+	}
+	return r
+}
+
+func (r *scrubReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.eof {
+			if len(r.in) == 0 {
+				return 0, io.EOF
+			}
+		} else {
+			r.fill()
+		}
+		r.scan()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *scrubReader) Close() error {
+	return r.src.Close()
+}
+
+func (r *scrubReader) fill() {
+	start := len(r.in)
+	r.in = append(r.in, make([]byte, scrubChunkSize)...)
+	n, err := r.src.Read(r.in[start:])
+	r.in = r.in[:start+n]
+	switch {
+	case err == io.EOF:
+		r.eof = true
+	case err != nil:
+		// Return what is already scrubbed first; never release held-back
+		// bytes, which may be part of a secret.
+		r.eof = true
+		r.err = err
+		r.in = r.in[:0]
+	}
+}
+
+// scan moves scrubbed bytes from in to out. A match is only taken once
+// maxLen bytes from its start are buffered (or the stream ended), so a
+// longer secret starting at the same offset cannot be cut short.
+func (r *scrubReader) scan() {
+	for {
+		at, pair := r.firstMatch()
+		if at >= 0 && (r.eof || at+r.maxLen <= len(r.in)) {
+			r.out = append(r.out, r.in[:at]...)
+			r.out = append(r.out, pair.placeholder...)
+			r.in = r.in[at+len(pair.value):]
+			continue
+		}
+		limit := len(r.in)
+		if !r.eof {
+			limit -= r.maxLen - 1
+		}
+		if limit > 0 {
+			r.out = append(r.out, r.in[:limit]...)
+			r.in = r.in[limit:]
+		}
+		// Compact so in does not keep growing into its backing array.
+		r.in = append([]byte(nil), r.in...)
+		return
+	}
+}
+
+func (r *scrubReader) firstMatch() (int, *scrubPair) {
+	at, match := -1, (*scrubPair)(nil)
+	for i := range r.pairs {
+		if idx := bytes.Index(r.in, r.pairs[i].value); idx >= 0 && (at < 0 || idx < at) {
+			at, match = idx, &r.pairs[i]
+		}
+	}
+	return at, match
+}
@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestEngine_OnResponse_ScrubsEchoedSecrets(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"API_KEY": {Value: "sk-real-secret", Hosts: []string{"api.example.com"}},
+		},
+	})
+	placeholder := engine.GetPlaceholder("API_KEY")
+
+	body := `{"error":"invalid key sk-real-secret","debug":{"auth":"Bearer sk-real-secret"}}`
+	resp := &http.Response{
+		StatusCode:    401,
+		Header:        http.Header{"X-Echo-Key": {"sk-real-secret"}, "Content-Length": {"80"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+
+	result, err := engine.OnResponse(resp, nil, "api.example.com")
+	require.NoError(t, err)
+	got, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.ReplaceAll(body, "sk-real-secret", placeholder), string(got))
+	assert.Equal(t, placeholder, result.Header.Get("X-Echo-Key"))
+	assert.Equal(t, int64(-1), result.ContentLength)
+	assert.Empty(t, result.Header.Get("Content-Length"))
+}
+
+func TestEngine_OnResponse_SkipsRawFileSecrets(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"DEPLOY_KEY": {Value: "raw-key", File: "/workspace/.ssh/id", FileRaw: true},
+		},
+	})
+	resp := &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader("raw-key"))}
+
+	result, err := engine.OnResponse(resp, nil, "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, resp, result)
+	got, _ := io.ReadAll(result.Body)
+	assert.Equal(t, "raw-key", string(got))
+}
+
+func TestEngine_OnResponse_ScrubsGzipBody(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"API_KEY": {Value: "sk-real-secret", Hosts: []string{"api.example.com"}},
+		},
+	})
+	placeholder := engine.GetPlaceholder("API_KEY")
+
+	body := `{"echo":"sk-real-secret"}`
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       io.NopCloser(&compressed),
+	}
+	result, err := engine.OnResponse(resp, nil, "api.example.com")
+	require.NoError(t, err)
+	got, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, strings.ReplaceAll(body, "sk-real-secret", placeholder), string(got))
+	assert.Empty(t, result.Header.Get("Content-Encoding"), "the guest gets the decoded body")
+}
+
+func TestEngine_OnResponse_RefusesUndecodableEncoding(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"API_KEY": {Value: "sk-real-secret", Hosts: []string{"api.example.com"}},
+		},
+	})
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Encoding": {"br"}},
+		Body:       io.NopCloser(strings.NewReader("opaque")),
+	}
+	_, err := engine.OnResponse(resp, nil, "api.example.com")
+	require.ErrorIs(t, err, api.ErrScrubEncoding)
+}
+
+func TestEngine_OnRequest_LimitsAcceptEncodingWhenScrubbing(t *testing.T) {
+	engine := NewEngine(&api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"API_KEY": {Value: "sk-real-secret", Hosts: []string{"api.example.com"}},
+		},
+	})
+	req, err := http.NewRequest(http.MethodGet, "https://api.example.com/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "br, gzip, zstd")
+
+	result, err := engine.OnRequest(req, "api.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, scrubAcceptEncoding, result.Header.Get("Accept-Encoding"))
+
+	plain := NewEngine(&api.NetworkConfig{})
+	req.Header.Set("Accept-Encoding", "br")
+	result, err = plain.OnRequest(req, "api.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "br", result.Header.Get("Accept-Encoding"), "left alone without secrets")
+}
+
+func TestScrubReaderAcrossReadBoundaries(t *testing.T) {
+	pairs := newScrubPairs(map[string]string{
+		"secret":      "<S>",
+		"secret-long": "<L>",
+		"xy":          "<XY>",
+	})
+	input := "a secret, a secret-long, xy and secre" + strings.Repeat("-", scrubChunkSize) + "secret-lon"
+	want := "a <S>, a <L>, <XY> and secre" + strings.Repeat("-", scrubChunkSize) + "<S>-lon"
+
+	for name, src := range map[string]io.Reader{
+		"whole":    strings.NewReader(input),
+		"one byte": iotest.OneByteReader(strings.NewReader(input)),
+		"half":     iotest.HalfReader(strings.NewReader(input)),
+	} {
+		got, err := io.ReadAll(newScrubReader(io.NopCloser(src), pairs))
+		require.NoError(t, err, name)
+		assert.Equal(t, want, string(got), name)
+	}
+}
+
+func TestScrubReaderPropagatesErrors(t *testing.T) {
+	pairs := newScrubPairs(map[string]string{"secret": "<S>"})
+	src := io.MultiReader(strings.NewReader("all good, sec"), iotest.ErrReader(io.ErrUnexpectedEOF))
+
+	got, err := io.ReadAll(newScrubReader(io.NopCloser(src), pairs))
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, "all good", string(got), "a possible secret prefix is never released")
+}
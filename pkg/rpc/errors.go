@@ -0,0 +1,7 @@
+package rpc
+
+import "errors"
+
+var (
+	ErrVFSHookMutation = errors.New("vfs mutate hook failed")
+)
@@ -0,0 +1,118 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// eventFilter is the set of event types a subscription wants; nil means
+// every type.
+type eventFilter map[api.EventType]bool
+
+func (f eventFilter) matches(event api.Event) bool {
+	if f == nil || f[api.EventType(event.Type)] {
+		return true
+	}
+	return f[api.EventTypeNetworkDenied] && event.Network != nil && event.Network.Blocked
+}
+
+// handleSubscribeEvents streams the events whose type is in params.types
+// (every type when empty) as subscribe_events.event notifications until the
+// request is cancelled:
+//
+//	{"jsonrpc":"2.0","method":"subscribe_events.event","params":{"id":<req_id>,"event":{...}}}
+//
+// Filtering happens here, so an event no subscription wants is never
+// serialized for it. While any subscription is open the plain "event"
+// notifications stop, so a client that subscribes must subscribe to every
+// type it relies on.
+func (h *Handler) handleSubscribeEvents(ctx context.Context, req *Request) *Response {
+	var params struct {
+		Types []string `json:"types,omitempty"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+				ID:      req.ID,
+			}
+		}
+	}
+	if req.ID == nil {
+		return nil
+	}
+
+	var filter eventFilter
+	for _, name := range params.Types {
+		eventType, err := api.ParseEventType(name)
+		if err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+				ID:      req.ID,
+			}
+		}
+		if filter == nil {
+			filter = make(eventFilter)
+		}
+		filter[eventType] = true
+	}
+
+	h.eventSubsMu.Lock()
+	h.eventSubs[*req.ID] = filter
+	h.eventSubsMu.Unlock()
+	defer func() {
+		h.eventSubsMu.Lock()
+		delete(h.eventSubs, *req.ID)
+		h.eventSubsMu.Unlock()
+	}()
+
+	<-ctx.Done()
+	return &Response{
+		JSONRPC: "2.0",
+		Error:   &Error{Code: ErrCodeCancelled, Message: ctx.Err().Error()},
+		ID:      req.ID,
+	}
+}
+
+// publishEvent sends event to each subscription whose filter matches it,
+// serializing it at most once. It reports whether any subscription is open,
+// in which case the plain "event" broadcast is skipped.
+func (h *Handler) publishEvent(event api.Event) bool {
+	h.eventSubsMu.Lock()
+	subscribed := len(h.eventSubs) > 0
+	var ids []uint64
+	for id, filter := range h.eventSubs {
+		if filter.matches(event) {
+			ids = append(ids, id)
+		}
+	}
+	h.eventSubsMu.Unlock()
+	if len(ids) == 0 {
+		return subscribed
+	}
+
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return subscribed
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, id := range ids {
+		notification := map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "subscribe_events.event",
+			"params": map[string]interface{}{
+				"id":    id,
+				"event": json.RawMessage(encoded),
+			},
+		}
+		data, _ := json.Marshal(notification)
+		fmt.Fprintln(h.stdout, string(data))
+	}
+	return subscribed
+}
@@ -5,14 +5,18 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/image"
+	"github.com/jingkaihe/matchlock/pkg/policy"
 	"github.com/jingkaihe/matchlock/pkg/sandbox"
 	"github.com/jingkaihe/matchlock/pkg/state"
 )
@@ -32,8 +36,31 @@ type Response struct {
 }
 
 type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// vmFailed reports a VM creation or start failure. Guest boot failures carry
+// their code in data.boot_error so clients can return typed errors.
+func vmFailed(err error) *Error {
+	e := &Error{Code: ErrCodeVMFailed, Message: err.Error()}
+	var bootErr *api.BootError
+	if errors.As(err, &bootErr) {
+		e.Data = map[string]interface{}{"boot_error": bootErr}
+	}
+	return e
+}
+
+// fileFailed reports a failed file operation. A path that does not exist
+// is flagged in data.not_found so clients can tell it from transient
+// failures.
+func fileFailed(err error) *Error {
+	e := &Error{Code: ErrCodeFileFailed, Message: err.Error()}
+	if errors.Is(err, os.ErrNotExist) {
+		e.Data = map[string]interface{}{"not_found": true}
+	}
+	return e
 }
 
 const (
@@ -63,34 +90,122 @@ type VM interface {
 
 type VMFactory func(ctx context.Context, config *api.Config) (VM, error)
 
+type createProgressKey struct{}
+
+// CreateProgress returns the callback a VMFactory reports image pull
+// progress to while serving create. Each update reaches the client as a
+// create.progress notification. It returns nil outside of create.
+func CreateProgress(ctx context.Context) func(api.ImageProgress) {
+	report, _ := ctx.Value(createProgressKey{}).(func(api.ImageProgress))
+	return report
+}
+
+// RestoreVMFactory creates a VM from VM snapshot snapshotID. configure is
+// applied to the config rebuilt from the snapshot before the VM is created.
+type RestoreVMFactory func(ctx context.Context, snapshotID string, configure func(*api.Config)) (VM, error)
+
+// HandlerOption configures optional Handler capabilities.
+type HandlerOption func(*Handler)
+
+// WithRestoreFactory enables the restore_snapshot method.
+func WithRestoreFactory(factory RestoreVMFactory) HandlerOption {
+	return func(h *Handler) {
+		h.restoreFactory = factory
+	}
+}
+
 type portForwardVM interface {
 	StartPortForwards(ctx context.Context, addresses []string, forwards []api.PortForward) (*sandbox.PortForwardManager, error)
 }
 
+type workspaceSnapshotVM interface {
+	SnapshotWorkspace(ctx context.Context) (string, error)
+	RestoreWorkspace(ctx context.Context, id string) error
+}
+
+type readFileToVM interface {
+	ReadFileTo(ctx context.Context, path string, w io.Writer) (int64, error)
+}
+
+type readFileRangeVM interface {
+	ReadFileRange(ctx context.Context, path string, off int64, length int) ([]byte, error)
+}
+
+type vmSnapshotVM interface {
+	Snapshot(ctx context.Context) (string, error)
+}
+
+type workspaceFreezeVM interface {
+	FreezeWorkspace(ctx context.Context) error
+	UnfreezeWorkspace(ctx context.Context) error
+}
+
+type commitVM interface {
+	Commit(ctx context.Context, tag string, opts sandbox.CommitOptions) (*image.BuildResult, error)
+}
+
+type diskUsageVM interface {
+	DiskUsage(ctx context.Context) ([]api.DiskUsage, error)
+}
+
+type statsVM interface {
+	Stats(ctx context.Context) (*api.Stats, error)
+}
+
+type guestEnvVM interface {
+	GuestEnv(ctx context.Context) (map[string]string, error)
+}
+
+type policyVM interface {
+	Policy() *policy.Engine
+}
+
 type Handler struct {
-	factory   VMFactory
-	vm        VM
-	pfManager *sandbox.PortForwardManager
-	pfMu      sync.Mutex   // serializes port-forward manager replacement
-	vmMu      sync.RWMutex // protects vm field
-	events    chan api.Event
-	stdin     io.Reader
-	stdout    io.Writer
-	mu        sync.Mutex // protects stdout writes
-	closed    atomic.Bool
-	wg        sync.WaitGroup // tracks in-flight requests
-	cancelsMu sync.Mutex
-	cancels   map[uint64]context.CancelFunc // per-request cancel funcs
-}
-
-func NewHandler(factory VMFactory, stdin io.Reader, stdout io.Writer) *Handler {
-	return &Handler{
-		factory: factory,
-		events:  make(chan api.Event, 100),
-		stdin:   stdin,
-		stdout:  stdout,
-		cancels: make(map[uint64]context.CancelFunc),
-	}
+	factory        VMFactory
+	restoreFactory RestoreVMFactory
+	vm             *vmSlot
+	pfManager      *sandbox.PortForwardManager
+	pfMu           sync.Mutex   // serializes port-forward manager replacement
+	vmMu           sync.RWMutex // protects vm and pfManager fields
+	events         chan api.Event
+	stdin          io.Reader
+	stdout         io.Writer
+	mu             sync.Mutex // protects stdout writes
+	closed         atomic.Bool
+	wg             sync.WaitGroup // tracks in-flight requests
+	cancelsMu      sync.Mutex
+	cancels        map[uint64]context.CancelFunc // per-request cancel funcs
+	ttyMu          sync.Mutex
+	ttySessions    map[string]*ttySession // running exec_tty sessions by ID
+
+	decisionsMu  sync.Mutex
+	decisions    map[uint64]chan string // pending vfs_hook.decide by decision ID
+	nextDecision atomic.Uint64
+
+	mutationsMu  sync.Mutex
+	mutations    map[uint64]chan vfsHookMutation // pending vfs_hook.mutate by mutation ID
+	nextMutation atomic.Uint64
+
+	eventSubsMu sync.Mutex
+	eventSubs   map[uint64]eventFilter // subscribe_events filters by request ID
+}
+
+func NewHandler(factory VMFactory, stdin io.Reader, stdout io.Writer, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		factory:     factory,
+		events:      make(chan api.Event, 100),
+		stdin:       stdin,
+		stdout:      stdout,
+		cancels:     make(map[uint64]context.CancelFunc),
+		ttySessions: make(map[string]*ttySession),
+		decisions:   make(map[uint64]chan string),
+		mutations:   make(map[uint64]chan vfsHookMutation),
+		eventSubs:   make(map[uint64]eventFilter),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *Handler) Run(ctx context.Context) error {
@@ -124,9 +239,44 @@ func (h *Handler) Run(ctx context.Context) error {
 			continue
 		}
 
-		// Create and close run synchronously to avoid races
+		if req.Method == "vfs_hook.decision" {
+			if resp := h.handleVFSHookDecision(&req); req.ID != nil {
+				h.sendResponse(resp)
+			}
+			continue
+		}
+		if req.Method == "vfs_hook.mutation" {
+			if resp := h.handleVFSHookMutation(&req); req.ID != nil {
+				h.sendResponse(resp)
+			}
+			continue
+		}
+
+		// TTY input and resizes are cheap and must keep their order, so they
+		// are routed on the read loop like cancel.
+		if req.Method == "exec_tty.stdin" || req.Method == "exec_tty.resize" {
+			var resp *Response
+			if req.Method == "exec_tty.stdin" {
+				resp = h.handleTTYStdin(&req)
+			} else {
+				resp = h.handleTTYResize(&req)
+			}
+			h.sendResponse(resp)
+			continue
+		}
+		if req.Method == "exec_tty" {
+			if resp := h.registerTTYSession(&req); resp != nil {
+				h.sendResponse(resp)
+				continue
+			}
+		}
+
+		// Create and close run synchronously to avoid races. Close waits
+		// only for the requests using the VM it closes (see vmSlot).
 		if req.Method == "create" || req.Method == "close" {
-			h.wg.Wait()
+			if req.Method == "create" {
+				h.wg.Wait()
+			}
 			resp := h.handleRequest(ctx, &req)
 			if resp != nil {
 				h.sendResponse(resp)
@@ -180,14 +330,50 @@ func (h *Handler) handleRequest(ctx context.Context, req *Request) *Response {
 		return h.handleExec(ctx, req)
 	case "exec_stream":
 		return h.handleExecStream(ctx, req)
+	case "exec_tty":
+		return h.handleExecTTY(ctx, req)
 	case "write_file":
 		return h.handleWriteFile(ctx, req)
 	case "read_file":
 		return h.handleReadFile(ctx, req)
+	case "read_file_stream":
+		return h.handleReadFileStream(ctx, req)
+	case "read_file_range":
+		return h.handleReadFileRange(ctx, req)
 	case "list_files":
 		return h.handleListFiles(ctx, req)
 	case "port_forward":
 		return h.handlePortForward(ctx, req)
+	case "snapshot_workspace":
+		return h.handleSnapshotWorkspace(ctx, req)
+	case "restore_workspace":
+		return h.handleRestoreWorkspace(ctx, req)
+	case "snapshot":
+		return h.handleSnapshot(ctx, req)
+	case "restore_snapshot":
+		return h.handleRestoreSnapshot(ctx, req)
+	case "freeze_workspace":
+		return h.handleFreezeWorkspace(ctx, req, true)
+	case "unfreeze_workspace":
+		return h.handleFreezeWorkspace(ctx, req, false)
+	case "disk_usage":
+		return h.handleDiskUsage(ctx, req)
+	case "stats":
+		return h.handleStats(ctx, req)
+	case "guest_env":
+		return h.handleGuestEnv(ctx, req)
+	case "commit":
+		return h.handleCommit(ctx, req)
+	case "logs":
+		return h.handleLogs(ctx, req)
+	case "tail_file":
+		return h.handleTailFile(ctx, req)
+	case "subscribe_events":
+		return h.handleSubscribeEvents(ctx, req)
+	case "check_host":
+		return h.handleCheckHost(req)
+	case "allow_host":
+		return h.handleAllowHost(req)
 	case "close":
 		return h.handleClose(ctx, req)
 	default:
@@ -199,10 +385,30 @@ func (h *Handler) handleRequest(ctx context.Context, req *Request) *Response {
 	}
 }
 
-func (h *Handler) getVM() VM {
+// requestTraceID correlates the events of an exec with the RPC request that
+// started it.
+func requestTraceID(req *Request) string {
+	if req.ID == nil {
+		return ""
+	}
+	return fmt.Sprintf("rpc-%d", *req.ID)
+}
+
+// acquireVM returns the VM and a release func to call once the request is
+// done with it; close waits for every acquired VM to be released. It returns
+// a nil VM when none has been created or the VM is closing.
+func (h *Handler) acquireVM() (VM, func()) {
 	h.vmMu.RLock()
-	defer h.vmMu.RUnlock()
-	return h.vm
+	slot := h.vm
+	h.vmMu.RUnlock()
+	if slot == nil {
+		return nil, func() {}
+	}
+	vm, release, ok := slot.acquire()
+	if !ok {
+		return nil, func() {}
+	}
+	return vm, release
 }
 
 func (h *Handler) handleCreate(ctx context.Context, req *Request) *Response {
@@ -233,41 +439,66 @@ func (h *Handler) handleCreate(ctx context.Context, req *Request) *Response {
 	}
 
 	config := api.DefaultConfig().Merge(&params)
-	if config.VFS != nil && len(config.VFS.Mounts) > 0 {
-		if err := api.ValidateVFSMountsWithinWorkspace(config.VFS.Mounts, config.GetWorkspace()); err != nil {
-			return &Response{
-				JSONRPC: "2.0",
-				Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
-				ID:      req.ID,
-			}
+	if err := config.Validate(); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
 		}
 	}
+	if config.VFS != nil && config.VFS.Interception.HasCallbackRules() {
+		config.VFS.Interception.Decider = h.decideVFSHook
+		config.VFS.Interception.Mutator = h.mutateVFSHook
+	}
 
+	ctx = context.WithValue(ctx, createProgressKey{}, func(progress api.ImageProgress) {
+		h.sendCreateProgress(req.ID, progress)
+	})
 	vm, err := h.factory(ctx, config)
 	if err != nil {
 		return &Response{
 			JSONRPC: "2.0",
-			Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+			Error:   vmFailed(err),
 			ID:      req.ID,
 		}
 	}
-
-	if err := vm.Start(ctx); err != nil {
-		vm.Close(ctx)
-		state.NewManager().Remove(vm.ID())
+	if err := h.startVM(ctx, vm); err != nil {
 		return &Response{
 			JSONRPC: "2.0",
-			Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+			Error:   vmFailed(err),
 			ID:      req.ID,
 		}
 	}
 
+	result := map[string]interface{}{
+		"id": vm.ID(),
+	}
+	if config.ImageCfg != nil && len(config.ImageCfg.ExposedPorts) > 0 {
+		result["exposed_ports"] = config.ImageCfg.ExposedPorts
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  result,
+		ID:      req.ID,
+	}
+}
+
+// startVM starts a newly created VM and makes it the handler's VM. On
+// failure the VM is closed and its state removed.
+func (h *Handler) startVM(ctx context.Context, vm VM) error {
+	if err := vm.Start(ctx); err != nil {
+		vm.Close(ctx)
+		state.NewManager().Remove(vm.ID())
+		return err
+	}
+
 	h.vmMu.Lock()
 	if h.pfManager != nil {
 		_ = h.pfManager.Close()
 		h.pfManager = nil
 	}
-	h.vm = vm
+	h.vm = newVMSlot(vm)
 	h.vmMu.Unlock()
 
 	go func() {
@@ -275,20 +506,71 @@ func (h *Handler) handleCreate(ctx context.Context, req *Request) *Response {
 			h.events <- event
 		}
 	}()
+	return nil
+}
 
-	result := map[string]interface{}{
-		"id": vm.ID(),
+func (h *Handler) handleRestoreSnapshot(ctx context.Context, req *Request) *Response {
+	if h.restoreFactory == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support VM snapshots"},
+			ID:      req.ID,
+		}
+	}
+
+	var params struct {
+		SnapshotID string `json:"snapshot_id"`
+	}
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+				ID:      req.ID,
+			}
+		}
+	}
+	if params.SnapshotID == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "snapshot_id is required"},
+			ID:      req.ID,
+		}
+	}
+
+	vm, err := h.restoreFactory(ctx, params.SnapshotID, func(config *api.Config) {
+		if config.VFS != nil && config.VFS.Interception.HasCallbackRules() {
+			config.VFS.Interception.Decider = h.decideVFSHook
+			config.VFS.Interception.Mutator = h.mutateVFSHook
+		}
+	})
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   vmFailed(err),
+			ID:      req.ID,
+		}
+	}
+	if err := h.startVM(ctx, vm); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   vmFailed(err),
+			ID:      req.ID,
+		}
 	}
 
 	return &Response{
 		JSONRPC: "2.0",
-		Result:  result,
-		ID:      req.ID,
+		Result: map[string]interface{}{
+			"id": vm.ID(),
+		},
+		ID: req.ID,
 	}
 }
 
 func (h *Handler) handleExec(ctx context.Context, req *Request) *Response {
-	vm := h.getVM()
+	vm, release := h.acquireVM()
+	defer release()
 	if vm == nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -298,9 +580,14 @@ func (h *Handler) handleExec(ctx context.Context, req *Request) *Response {
 	}
 
 	var params struct {
-		Command    string `json:"command"`
-		WorkingDir string `json:"working_dir,omitempty"`
-		User       string `json:"user,omitempty"`
+		Command    string            `json:"command"`
+		Args       []string          `json:"args,omitempty"`
+		Shell      []string          `json:"shell,omitempty"`
+		WorkingDir string            `json:"working_dir,omitempty"`
+		User       string            `json:"user,omitempty"`
+		LoginShell bool              `json:"login_shell,omitempty"`
+		TimeoutMS  int               `json:"timeout_ms,omitempty"`
+		Env        map[string]string `json:"env,omitempty"`
 	}
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return &Response{
@@ -312,11 +599,17 @@ func (h *Handler) handleExec(ctx context.Context, req *Request) *Response {
 
 	opts := &api.ExecOptions{
 		WorkingDir: params.WorkingDir,
+		Env:        params.Env,
 		User:       params.User,
+		LoginShell: params.LoginShell,
+		Shell:      params.Shell,
+		Args:       params.Args,
+		TimeoutMS:  params.TimeoutMS,
+		TraceID:    requestTraceID(req),
 	}
 
-	result, err := vm.Exec(ctx, params.Command, opts)
-	if err != nil {
+	result, err := vm.Exec(ctx, execCommandText(params.Command, params.Args), opts)
+	if err != nil && !execTimedOut(result, err) {
 		code := ErrCodeExecFailed
 		if ctx.Err() != nil {
 			code = ErrCodeCancelled
@@ -331,15 +624,36 @@ func (h *Handler) handleExec(ctx context.Context, req *Request) *Response {
 	return &Response{
 		JSONRPC: "2.0",
 		Result: map[string]interface{}{
-			"exit_code":   result.ExitCode,
-			"stdout":      base64.StdEncoding.EncodeToString(result.Stdout),
-			"stderr":      base64.StdEncoding.EncodeToString(result.Stderr),
-			"duration_ms": result.DurationMS,
+			"exit_code":    result.ExitCode,
+			"stdout":       base64.StdEncoding.EncodeToString(result.Stdout),
+			"stderr":       base64.StdEncoding.EncodeToString(result.Stderr),
+			"duration_ms":  result.DurationMS,
+			"user_time_ms": result.UserTimeMS,
+			"sys_time_ms":  result.SysTimeMS,
+			"max_rss_kb":   result.MaxRSSKB,
+			"timed_out":    result.TimedOut,
 		},
 		ID: req.ID,
 	}
 }
 
+// execTimedOut reports whether err is the guest killing a command at its
+// timeout_ms. That is answered with the partial result and timed_out set,
+// not an RPC error, so clients keep the output and see exit code 124.
+func execTimedOut(result *api.ExecResult, err error) bool {
+	return result != nil && errors.Is(err, api.ErrExecTimeout)
+}
+
+// execCommandText returns the command string for an exec request. Requests
+// that only carry args get their argv joined, so events still describe what
+// ran.
+func execCommandText(command string, args []string) string {
+	if command == "" && len(args) > 0 {
+		return strings.Join(args, " ")
+	}
+	return command
+}
+
 // handleExecStream executes a command and streams stdout/stderr as JSON-RPC
 // notifications before sending the final response with the exit code.
 //
@@ -352,7 +666,8 @@ func (h *Handler) handleExec(ctx context.Context, req *Request) *Response {
 //
 //	{"jsonrpc":"2.0","id":<req_id>,"result":{"exit_code":0,"duration_ms":123}}
 func (h *Handler) handleExecStream(ctx context.Context, req *Request) *Response {
-	vm := h.getVM()
+	vm, release := h.acquireVM()
+	defer release()
 	if vm == nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -362,9 +677,14 @@ func (h *Handler) handleExecStream(ctx context.Context, req *Request) *Response
 	}
 
 	var params struct {
-		Command    string `json:"command"`
-		WorkingDir string `json:"working_dir,omitempty"`
-		User       string `json:"user,omitempty"`
+		Command    string            `json:"command"`
+		Args       []string          `json:"args,omitempty"`
+		Shell      []string          `json:"shell,omitempty"`
+		WorkingDir string            `json:"working_dir,omitempty"`
+		User       string            `json:"user,omitempty"`
+		LoginShell bool              `json:"login_shell,omitempty"`
+		TimeoutMS  int               `json:"timeout_ms,omitempty"`
+		Env        map[string]string `json:"env,omitempty"`
 	}
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return &Response{
@@ -380,13 +700,19 @@ func (h *Handler) handleExecStream(ctx context.Context, req *Request) *Response
 
 	opts := &api.ExecOptions{
 		WorkingDir: params.WorkingDir,
+		Env:        params.Env,
 		User:       params.User,
+		LoginShell: params.LoginShell,
+		Shell:      params.Shell,
+		Args:       params.Args,
 		Stdout:     stdoutWriter,
 		Stderr:     stderrWriter,
+		TimeoutMS:  params.TimeoutMS,
+		TraceID:    requestTraceID(req),
 	}
 
-	result, err := vm.Exec(ctx, params.Command, opts)
-	if err != nil {
+	result, err := vm.Exec(ctx, execCommandText(params.Command, params.Args), opts)
+	if err != nil && !execTimedOut(result, err) {
 		code := ErrCodeExecFailed
 		if ctx.Err() != nil {
 			code = ErrCodeCancelled
@@ -410,8 +736,12 @@ func (h *Handler) handleExecStream(ctx context.Context, req *Request) *Response
 	return &Response{
 		JSONRPC: "2.0",
 		Result: map[string]interface{}{
-			"exit_code":   result.ExitCode,
-			"duration_ms": result.DurationMS,
+			"exit_code":    result.ExitCode,
+			"duration_ms":  result.DurationMS,
+			"user_time_ms": result.UserTimeMS,
+			"sys_time_ms":  result.SysTimeMS,
+			"max_rss_kb":   result.MaxRSSKB,
+			"timed_out":    result.TimedOut,
 		},
 		ID: req.ID,
 	}
@@ -447,8 +777,25 @@ func (h *Handler) sendStreamData(reqID *uint64, method string, data []byte) {
 	fmt.Fprintln(h.stdout, string(encoded))
 }
 
+func (h *Handler) sendCreateProgress(reqID *uint64, progress api.ImageProgress) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	notification := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "create.progress",
+		"params": map[string]interface{}{
+			"id":       reqID,
+			"progress": progress,
+		},
+	}
+	encoded, _ := json.Marshal(notification)
+	fmt.Fprintln(h.stdout, string(encoded))
+}
+
 func (h *Handler) handleWriteFile(ctx context.Context, req *Request) *Response {
-	vm := h.getVM()
+	vm, release := h.acquireVM()
+	defer release()
 	if vm == nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -487,7 +834,7 @@ func (h *Handler) handleWriteFile(ctx context.Context, req *Request) *Response {
 	if err := vm.WriteFile(ctx, params.Path, content, mode); err != nil {
 		return &Response{
 			JSONRPC: "2.0",
-			Error:   &Error{Code: ErrCodeFileFailed, Message: err.Error()},
+			Error:   fileFailed(err),
 			ID:      req.ID,
 		}
 	}
@@ -500,7 +847,8 @@ func (h *Handler) handleWriteFile(ctx context.Context, req *Request) *Response {
 }
 
 func (h *Handler) handleReadFile(ctx context.Context, req *Request) *Response {
-	vm := h.getVM()
+	vm, release := h.acquireVM()
+	defer release()
 	if vm == nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -524,7 +872,7 @@ func (h *Handler) handleReadFile(ctx context.Context, req *Request) *Response {
 	if err != nil {
 		return &Response{
 			JSONRPC: "2.0",
-			Error:   &Error{Code: ErrCodeFileFailed, Message: err.Error()},
+			Error:   fileFailed(err),
 			ID:      req.ID,
 		}
 	}
@@ -538,8 +886,12 @@ func (h *Handler) handleReadFile(ctx context.Context, req *Request) *Response {
 	}
 }
 
-func (h *Handler) handleListFiles(ctx context.Context, req *Request) *Response {
-	vm := h.getVM()
+// handleReadFileStream sends a file as read_file_stream.data notifications
+// instead of one base64 result, so large files are never held in memory
+// whole on either side. The final result carries the byte count.
+func (h *Handler) handleReadFileStream(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
 	if vm == nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -547,6 +899,14 @@ func (h *Handler) handleListFiles(ctx context.Context, req *Request) *Response {
 			ID:      req.ID,
 		}
 	}
+	rvm, ok := vm.(readFileToVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support read_file_stream"},
+			ID:      req.ID,
+		}
+	}
 
 	var params struct {
 		Path string `json:"path"`
@@ -559,11 +919,16 @@ func (h *Handler) handleListFiles(ctx context.Context, req *Request) *Response {
 		}
 	}
 
-	files, err := vm.ListFiles(ctx, params.Path)
+	w := &ctxWriter{ctx: ctx, w: &streamWriter{handler: h, reqID: req.ID, method: "read_file_stream.data"}}
+	n, err := rvm.ReadFileTo(ctx, params.Path, w)
 	if err != nil {
+		code := ErrCodeFileFailed
+		if ctx.Err() != nil {
+			code = ErrCodeCancelled
+		}
 		return &Response{
 			JSONRPC: "2.0",
-			Error:   &Error{Code: ErrCodeFileFailed, Message: err.Error()},
+			Error:   &Error{Code: code, Message: err.Error()},
 			ID:      req.ID,
 		}
 	}
@@ -571,65 +936,17 @@ func (h *Handler) handleListFiles(ctx context.Context, req *Request) *Response {
 	return &Response{
 		JSONRPC: "2.0",
 		Result: map[string]interface{}{
-			"files": files,
+			"size": n,
 		},
 		ID: req.ID,
 	}
 }
 
-func (h *Handler) handleClose(ctx context.Context, req *Request) *Response {
-	h.closed.Store(true)
-
-	var params struct {
-		TimeoutSeconds float64 `json:"timeout_seconds"`
-	}
-	if req.Params != nil {
-		json.Unmarshal(req.Params, &params)
-	}
-
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(params.TimeoutSeconds*float64(time.Second)))
-	defer cancel()
-
-	h.vmMu.Lock()
-	vm := h.vm
-	h.vm = nil
-	pfManager := h.pfManager
-	h.pfManager = nil
-	h.vmMu.Unlock()
-
-	if pfManager != nil {
-		if err := pfManager.Close(); err != nil {
-			return &Response{
-				JSONRPC: "2.0",
-				Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
-				ID:      req.ID,
-			}
-		}
-	}
-
-	if vm != nil {
-		if err := vm.Close(ctx); err != nil {
-			code := ErrCodeVMFailed
-			if ctx.Err() != nil {
-				code = ErrCodeCancelled
-			}
-			return &Response{
-				JSONRPC: "2.0",
-				Error:   &Error{Code: code, Message: err.Error()},
-				ID:      req.ID,
-			}
-		}
-	}
-
-	return &Response{
-		JSONRPC: "2.0",
-		Result:  map[string]interface{}{},
-		ID:      req.ID,
-	}
-}
-
-func (h *Handler) handlePortForward(ctx context.Context, req *Request) *Response {
-	vm := h.getVM()
+// handleReadFileRange returns up to length bytes of a file from offset, so
+// callers can inspect part of a large file without transferring all of it.
+func (h *Handler) handleReadFileRange(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
 	if vm == nil {
 		return &Response{
 			JSONRPC: "2.0",
@@ -637,19 +954,19 @@ func (h *Handler) handlePortForward(ctx context.Context, req *Request) *Response
 			ID:      req.ID,
 		}
 	}
-
-	pfvm, ok := vm.(portForwardVM)
+	rvm, ok := vm.(readFileRangeVM)
 	if !ok {
 		return &Response{
 			JSONRPC: "2.0",
-			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support port-forward"},
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support read_file_range"},
 			ID:      req.ID,
 		}
 	}
 
 	var params struct {
-		Forwards  []api.PortForward `json:"forwards"`
-		Addresses []string          `json:"addresses,omitempty"`
+		Path   string `json:"path"`
+		Offset int64  `json:"offset"`
+		Length int    `json:"length"`
 	}
 	if err := json.Unmarshal(req.Params, &params); err != nil {
 		return &Response{
@@ -658,62 +975,686 @@ func (h *Handler) handlePortForward(ctx context.Context, req *Request) *Response
 			ID:      req.ID,
 		}
 	}
-	if len(params.Forwards) == 0 {
+	if params.Offset < 0 || params.Length < 0 {
 		return &Response{
 			JSONRPC: "2.0",
-			Error:   &Error{Code: ErrCodeInvalidParams, Message: "forwards is required"},
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "offset and length must not be negative"},
 			ID:      req.ID,
 		}
 	}
-	if len(params.Addresses) == 0 {
-		params.Addresses = []string{"127.0.0.1"}
-	}
-
-	h.pfMu.Lock()
-	defer h.pfMu.Unlock()
-
-	h.vmMu.Lock()
-	old := h.pfManager
-	h.pfManager = nil
-	h.vmMu.Unlock()
-	if old != nil {
-		_ = old.Close()
-	}
 
-	manager, err := pfvm.StartPortForwards(ctx, params.Addresses, params.Forwards)
+	content, err := rvm.ReadFileRange(ctx, params.Path, params.Offset, params.Length)
 	if err != nil {
 		return &Response{
 			JSONRPC: "2.0",
-			Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+			Error:   fileFailed(err),
 			ID:      req.ID,
 		}
 	}
 
-	h.vmMu.Lock()
-	h.pfManager = manager
-	h.vmMu.Unlock()
-
 	return &Response{
 		JSONRPC: "2.0",
 		Result: map[string]interface{}{
-			"bindings": manager.Bindings(),
+			"content": base64.StdEncoding.EncodeToString(content),
 		},
 		ID: req.ID,
 	}
 }
 
-func (h *Handler) handleCancel(req *Request) *Response {
-	var params struct {
-		ID uint64 `json:"id"`
-	}
-	if req.Params != nil {
-		if err := json.Unmarshal(req.Params, &params); err != nil {
-			return &Response{
-				JSONRPC: "2.0",
-				Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
-				ID:      req.ID,
-			}
-		}
+// ctxWriter fails writes once ctx is done, so a copy into it stops when the
+// request is cancelled.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *ctxWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
+
+func (h *Handler) handleListFiles(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+
+	var params struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	files, err := vm.ListFiles(ctx, params.Path)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   fileFailed(err),
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"files": files,
+		},
+		ID: req.ID,
+	}
+}
+
+// getSnapshotVM acquires the VM for a workspace snapshot request. The caller
+// must call the returned release func when done, even on error.
+func (h *Handler) getSnapshotVM(req *Request) (workspaceSnapshotVM, func(), *Response) {
+	vm, release := h.acquireVM()
+	if vm == nil {
+		return nil, release, &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	svm, ok := vm.(workspaceSnapshotVM)
+	if !ok {
+		return nil, release, &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support workspace snapshots"},
+			ID:      req.ID,
+		}
+	}
+	return svm, release, nil
+}
+
+func (h *Handler) handleSnapshotWorkspace(ctx context.Context, req *Request) *Response {
+	svm, release, errResp := h.getSnapshotVM(req)
+	defer release()
+	if errResp != nil {
+		return errResp
+	}
+
+	id, err := svm.SnapshotWorkspace(ctx)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   fileFailed(err),
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"snapshot_id": id,
+		},
+		ID: req.ID,
+	}
+}
+
+func (h *Handler) handleSnapshot(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	svm, ok := vm.(vmSnapshotVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support VM snapshots"},
+			ID:      req.ID,
+		}
+	}
+
+	id, err := svm.Snapshot(ctx)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   vmFailed(err),
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"snapshot_id": id,
+		},
+		ID: req.ID,
+	}
+}
+
+func (h *Handler) handleDiskUsage(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	dvm, ok := vm.(diskUsageVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support disk usage"},
+			ID:      req.ID,
+		}
+	}
+
+	disks, err := dvm.DiskUsage(ctx)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"disks": disks,
+		},
+		ID: req.ID,
+	}
+}
+
+func (h *Handler) handleStats(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	svm, ok := vm.(statsVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support stats"},
+			ID:      req.ID,
+		}
+	}
+
+	stats, err := svm.Stats(ctx)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  stats,
+		ID:      req.ID,
+	}
+}
+
+func (h *Handler) handleGuestEnv(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	gvm, ok := vm.(guestEnvVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support guest env"},
+			ID:      req.ID,
+		}
+	}
+
+	env, err := gvm.GuestEnv(ctx)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeExecFailed, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"env": env,
+		},
+		ID: req.ID,
+	}
+}
+
+func (h *Handler) handleFreezeWorkspace(ctx context.Context, req *Request, frozen bool) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	fvm, ok := vm.(workspaceFreezeVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support freezing the workspace"},
+			ID:      req.ID,
+		}
+	}
+
+	var err error
+	if frozen {
+		err = fvm.FreezeWorkspace(ctx)
+	} else {
+		err = fvm.UnfreezeWorkspace(ctx)
+	}
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   fileFailed(err),
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"frozen": frozen,
+		},
+		ID: req.ID,
+	}
+}
+
+func (h *Handler) handleCheckHost(req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	pvm, ok := vm.(policyVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not expose its network policy"},
+			ID:      req.ID,
+		}
+	}
+
+	var params struct {
+		Host string `json:"host"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+	if params.Host == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "host is required"},
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"host":    params.Host,
+			"allowed": pvm.Policy().IsHostAllowed(params.Host),
+		},
+		ID: req.ID,
+	}
+}
+
+// handleAllowHost adds a host to the sandbox allowlist at runtime, releasing
+// connections held for approval (NetworkConfig.HostApproval).
+func (h *Handler) handleAllowHost(req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	pvm, ok := vm.(policyVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not expose its network policy"},
+			ID:      req.ID,
+		}
+	}
+
+	var params struct {
+		Host string `json:"host"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+	if params.Host == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "host is required"},
+			ID:      req.ID,
+		}
+	}
+
+	pvm.Policy().AddAllowedHost(params.Host)
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  map[string]interface{}{"host": params.Host},
+		ID:      req.ID,
+	}
+}
+
+func (h *Handler) handleRestoreWorkspace(ctx context.Context, req *Request) *Response {
+	svm, release, errResp := h.getSnapshotVM(req)
+	defer release()
+	if errResp != nil {
+		return errResp
+	}
+
+	var params struct {
+		SnapshotID string `json:"snapshot_id"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+	if params.SnapshotID == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "snapshot_id is required"},
+			ID:      req.ID,
+		}
+	}
+
+	if err := svm.RestoreWorkspace(ctx, params.SnapshotID); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   fileFailed(err),
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  map[string]interface{}{},
+		ID:      req.ID,
+	}
+}
+
+func (h *Handler) handleCommit(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	cvm, ok := vm.(commitVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support commit"},
+			ID:      req.ID,
+		}
+	}
+
+	var params struct {
+		Tag           string `json:"tag"`
+		WorkspaceDest string `json:"workspace_dest,omitempty"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+	if params.Tag == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "tag is required"},
+			ID:      req.ID,
+		}
+	}
+
+	result, err := cvm.Commit(ctx, params.Tag, sandbox.CommitOptions{WorkspaceDest: params.WorkspaceDest})
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"tag":         params.Tag,
+			"rootfs_path": result.RootfsPath,
+			"size":        result.Size,
+		},
+		ID: req.ID,
+	}
+}
+
+// cancelInFlight cancels every request that is still running.
+func (h *Handler) cancelInFlight() {
+	h.cancelsMu.Lock()
+	defer h.cancelsMu.Unlock()
+	for _, cancel := range h.cancels {
+		cancel()
+	}
+}
+
+func (h *Handler) handleClose(ctx context.Context, req *Request) *Response {
+	h.closed.Store(true)
+
+	var params struct {
+		TimeoutSeconds float64 `json:"timeout_seconds"`
+	}
+	if req.Params != nil {
+		json.Unmarshal(req.Params, &params)
+	}
+
+	h.vmMu.RLock()
+	slot := h.vm
+	h.vmMu.RUnlock()
+	if slot == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Result:  map[string]interface{}{},
+			ID:      req.ID,
+		}
+	}
+
+	// Wait for the requests using this VM before tearing it down, so none
+	// of them touches the machine or its vsock after Close. Requests still
+	// running when the timeout expires are cancelled and then waited for;
+	// whatever budget is left goes to closing the VM.
+	timeout := time.Duration(params.TimeoutSeconds * float64(time.Second))
+	deadline := time.Now().Add(timeout)
+	drainTimer := time.AfterFunc(timeout, h.cancelInFlight)
+	defer drainTimer.Stop()
+
+	var errResp *Response
+	err := slot.close(func(vm VM) error {
+		drainTimer.Stop()
+
+		h.vmMu.Lock()
+		pfManager := h.pfManager
+		h.pfManager = nil
+		h.vmMu.Unlock()
+
+		if pfManager != nil {
+			if err := pfManager.Close(); err != nil {
+				errResp = &Response{
+					JSONRPC: "2.0",
+					Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+					ID:      req.ID,
+				}
+				return err
+			}
+		}
+
+		ctx, cancel := context.WithDeadline(ctx, deadline)
+		defer cancel()
+		if err := vm.Close(ctx); err != nil {
+			code := ErrCodeVMFailed
+			if ctx.Err() != nil {
+				code = ErrCodeCancelled
+			}
+			errResp = &Response{
+				JSONRPC: "2.0",
+				Error:   &Error{Code: code, Message: err.Error()},
+				ID:      req.ID,
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return errResp
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  map[string]interface{}{},
+		ID:      req.ID,
+	}
+}
+
+func (h *Handler) handlePortForward(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+
+	pfvm, ok := vm.(portForwardVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support port-forward"},
+			ID:      req.ID,
+		}
+	}
+
+	var params struct {
+		Forwards  []api.PortForward `json:"forwards"`
+		Addresses []string          `json:"addresses,omitempty"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+	if len(params.Forwards) == 0 {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "forwards is required"},
+			ID:      req.ID,
+		}
+	}
+	if len(params.Addresses) == 0 {
+		params.Addresses = []string{"127.0.0.1"}
+	}
+
+	h.pfMu.Lock()
+	defer h.pfMu.Unlock()
+
+	h.vmMu.Lock()
+	old := h.pfManager
+	h.pfManager = nil
+	h.vmMu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+
+	manager, err := pfvm.StartPortForwards(ctx, params.Addresses, params.Forwards)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	h.vmMu.Lock()
+	h.pfManager = manager
+	h.vmMu.Unlock()
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"bindings": manager.Bindings(),
+		},
+		ID: req.ID,
+	}
+}
+
+func (h *Handler) handleCancel(req *Request) *Response {
+	var params struct {
+		ID uint64 `json:"id"`
+	}
+	if req.Params != nil {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+				ID:      req.ID,
+			}
+		}
 	}
 
 	h.cancelsMu.Lock()
@@ -740,7 +1681,9 @@ func (h *Handler) eventLoop(ctx context.Context) {
 			if !ok {
 				return
 			}
-			h.sendEvent(event)
+			if !h.publishEvent(event) {
+				h.sendEvent(event)
+			}
 		}
 	}
 }
@@ -774,7 +1717,7 @@ func (h *Handler) sendEvent(event api.Event) {
 	fmt.Fprintln(h.stdout, string(data))
 }
 
-func RunRPC(ctx context.Context, factory VMFactory) error {
-	handler := NewHandler(factory, os.Stdin, os.Stdout)
+func RunRPC(ctx context.Context, factory VMFactory, opts ...HandlerOption) error {
+	handler := NewHandler(factory, os.Stdin, os.Stdout, opts...)
 	return handler.Run(ctx)
 }
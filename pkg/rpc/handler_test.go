@@ -2,20 +2,27 @@ package rpc
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/image"
+	"github.com/jingkaihe/matchlock/pkg/policy"
 	"github.com/jingkaihe/matchlock/pkg/sandbox"
 )
 
@@ -53,6 +60,133 @@ func (m *mockPortForwardVM) StartPortForwards(ctx context.Context, addresses []s
 	return &sandbox.PortForwardManager{}, nil
 }
 
+type mockSnapshotVM struct {
+	mockVM
+	restored string
+}
+
+func (m *mockSnapshotVM) SnapshotWorkspace(ctx context.Context) (string, error) {
+	return "snap-1", nil
+}
+
+func (m *mockSnapshotVM) RestoreWorkspace(ctx context.Context, id string) error {
+	m.restored = id
+	return nil
+}
+
+type mockDiskUsageVM struct {
+	mockVM
+}
+
+func (m *mockDiskUsageVM) DiskUsage(ctx context.Context) ([]api.DiskUsage, error) {
+	return []api.DiskUsage{
+		{Path: "/", Kind: api.DiskUsageRootfs, TotalBytes: 4096, UsedBytes: 1024, FreeBytes: 3072},
+		{Path: "/workspace", Kind: api.DiskUsageWorkspace, UsedBytes: 12},
+	}, nil
+}
+
+type mockStatsVM struct {
+	mockVM
+}
+
+func (m *mockStatsVM) Stats(ctx context.Context) (*api.Stats, error) {
+	return &api.Stats{CPUUsageUsec: 1500, MemoryUsedBytes: 4096, MemoryTotalBytes: 8192, ActiveExecs: 2, NetRxBytes: 100}, nil
+}
+
+type mockGuestEnvVM struct {
+	mockVM
+}
+
+func (m *mockGuestEnvVM) GuestEnv(ctx context.Context) (map[string]string, error) {
+	return map[string]string{"PATH": "/usr/bin:/bin", "API_KEY": "SANDBOX_SECRET_abc"}, nil
+}
+
+type mockCommitVM struct {
+	mockVM
+	tag  string
+	opts sandbox.CommitOptions
+}
+
+func (m *mockCommitVM) Commit(ctx context.Context, tag string, opts sandbox.CommitOptions) (*image.BuildResult, error) {
+	m.tag = tag
+	m.opts = opts
+	return &image.BuildResult{RootfsPath: "/cache/" + tag + "/rootfs.ext4", Size: 4096}, nil
+}
+
+type mockFreezeVM struct {
+	mockVM
+	frozen bool
+}
+
+func (m *mockFreezeVM) FreezeWorkspace(ctx context.Context) error {
+	m.frozen = true
+	return nil
+}
+
+func (m *mockFreezeVM) UnfreezeWorkspace(ctx context.Context) error {
+	m.frozen = false
+	return nil
+}
+
+type mockPolicyVM struct {
+	mockVM
+	engine *policy.Engine
+}
+
+func (m *mockPolicyVM) Policy() *policy.Engine { return m.engine }
+
+type mockLogVM struct {
+	mockVM
+	logPath string
+}
+
+func (m *mockLogVM) LogPath() string {
+	return m.logPath
+}
+
+type mockTailVM struct {
+	mockVM
+	path string
+}
+
+type mockReadFileToVM struct {
+	mockVM
+	content []byte
+}
+
+func (m *mockReadFileToVM) ReadFileTo(ctx context.Context, path string, w io.Writer) (int64, error) {
+	return io.Copy(w, bytes.NewReader(m.content))
+}
+
+type mockReadFileRangeVM struct {
+	mockVM
+	content []byte
+}
+
+func (m *mockReadFileRangeVM) ReadFileRange(ctx context.Context, path string, off int64, length int) ([]byte, error) {
+	end := min(off+int64(length), int64(len(m.content)))
+	if off >= end {
+		return nil, nil
+	}
+	return m.content[off:end], nil
+}
+
+func (m *mockTailVM) TailFile(ctx context.Context, path string, w io.Writer) error {
+	m.path = path
+	if _, err := w.Write([]byte("line 1\n")); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type mockEventsVM struct {
+	mockVM
+	events chan api.Event
+}
+
+func (m *mockEventsVM) Events() <-chan api.Event { return m.events }
+
 type blockingPortForwardVM struct {
 	mockVM
 	started chan struct{}
@@ -247,6 +381,118 @@ func TestHandlerExecStream(t *testing.T) {
 	assert.Equal(t, int64(42), result.DurationMS)
 }
 
+func TestHandlerExecLoginShell(t *testing.T) {
+	loginShell := make(chan bool, 2)
+	vm := &mockVM{
+		id: "vm-test",
+		execFunc: func(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+			loginShell <- opts.LoginShell
+			return &api.ExecResult{}, nil
+		},
+	}
+
+	rpc := newTestRPC(vm)
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("exec", 2, map[string]interface{}{"command": "conda list", "login_shell": true})
+	require.Nil(t, rpc.read().Error)
+	assert.True(t, <-loginShell)
+
+	rpc.send("exec", 3, map[string]string{"command": "conda list"})
+	require.Nil(t, rpc.read().Error)
+	assert.False(t, <-loginShell)
+}
+
+func TestHandlerExecArgs(t *testing.T) {
+	type call struct {
+		command string
+		opts    *api.ExecOptions
+	}
+	calls := make(chan call, 1)
+	vm := &mockVM{
+		id: "vm-test",
+		execFunc: func(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+			calls <- call{command, opts}
+			return &api.ExecResult{}, nil
+		},
+	}
+
+	rpc := newTestRPC(vm)
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("exec", 2, map[string]interface{}{"args": []string{"/app/server", "--version"}})
+	require.Nil(t, rpc.read().Error)
+	c := <-calls
+	assert.Equal(t, "/app/server --version", c.command)
+	assert.Equal(t, []string{"/app/server", "--version"}, c.opts.Args)
+	assert.Empty(t, c.opts.Shell)
+}
+
+func TestHandlerExecPassesEnv(t *testing.T) {
+	envs := make(chan map[string]string, 2)
+	vm := &mockVM{
+		id: "vm-test",
+		execFunc: func(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+			envs <- opts.Env
+			return &api.ExecResult{}, nil
+		},
+	}
+
+	rpc := newTestRPC(vm)
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	env := map[string]interface{}{"DEBUG": "1"}
+	rpc.send("exec", 2, map[string]interface{}{"command": "env", "env": env})
+	require.Nil(t, rpc.read().Error)
+	assert.Equal(t, map[string]string{"DEBUG": "1"}, <-envs)
+
+	rpc.send("exec_stream", 3, map[string]interface{}{"command": "env", "env": env})
+	require.Nil(t, rpc.read().Error)
+	assert.Equal(t, map[string]string{"DEBUG": "1"}, <-envs)
+}
+
+func TestHandlerExecTimeoutReturnsPartialResult(t *testing.T) {
+	timeouts := make(chan int, 1)
+	vm := &mockVM{
+		id: "vm-test",
+		execFunc: func(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+			timeouts <- opts.TimeoutMS
+			return &api.ExecResult{ExitCode: api.ExecTimeoutExitCode, Stdout: []byte("partial\n"), TimedOut: true},
+				errx.With(api.ErrExecTimeout, " after %dms", opts.TimeoutMS)
+		},
+	}
+
+	rpc := newTestRPC(vm)
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("exec", 2, map[string]interface{}{"command": "sleep 60", "timeout_ms": 500})
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	assert.Equal(t, 500, <-timeouts)
+
+	var result struct {
+		ExitCode int    `json:"exit_code"`
+		Stdout   string `json:"stdout"`
+		TimedOut bool   `json:"timed_out"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	assert.Equal(t, 124, result.ExitCode)
+	assert.True(t, result.TimedOut)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("partial\n")), result.Stdout)
+}
+
 func TestHandlerCreateRejectsMountOutsideWorkspace(t *testing.T) {
 	vm := &mockVM{id: "vm-test"}
 	factoryCalls := 0
@@ -296,6 +542,53 @@ func TestHandlerCreateRejectsUserProvidedID(t *testing.T) {
 	require.Equal(t, 0, factoryCalls, "factory should not have been called")
 }
 
+func TestHandlerCreateReportsExposedPorts(t *testing.T) {
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		config.ImageCfg = &api.ImageConfig{ExposedPorts: []int{80, 443}}
+		return &mockVM{id: "vm-test"}, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "nginx:alpine"})
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+
+	var result struct {
+		ID           string `json:"id"`
+		ExposedPorts []int  `json:"exposed_ports"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	assert.Equal(t, "vm-test", result.ID)
+	assert.Equal(t, []int{80, 443}, result.ExposedPorts)
+}
+
+func TestHandlerCreateStreamsImageProgress(t *testing.T) {
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		report := CreateProgress(ctx)
+		require.NotNil(t, report)
+		report(api.ImageProgress{Image: config.Image, Phase: api.ImageProgressDownload, Layers: 2, BytesDone: 10, BytesTotal: 40})
+		return &mockVM{id: "vm-test"}, nil
+	})
+	defer rpc.close()
+
+	assert.Nil(t, CreateProgress(context.Background()))
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	msg := rpc.read()
+	require.Equal(t, "create.progress", msg.Method)
+	var params struct {
+		ID       uint64            `json:"id"`
+		Progress api.ImageProgress `json:"progress"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Params, &params))
+	assert.Equal(t, uint64(1), params.ID)
+	assert.Equal(t, api.ImageProgress{Image: "alpine:latest", Phase: api.ImageProgressDownload, Layers: 2, BytesDone: 10, BytesTotal: 40}, params.Progress)
+
+	msg = rpc.read()
+	require.Nil(t, msg.Error)
+	require.NotNil(t, msg.Result)
+}
+
 func TestHandlerPortForwardUnsupported(t *testing.T) {
 	vm := &mockVM{id: "vm-test"}
 	rpc := newTestRPC(vm)
@@ -343,55 +636,648 @@ func TestHandlerPortForwardSuccess(t *testing.T) {
 	}
 }
 
-func TestHandlerPortForwardSerializesReplacement(t *testing.T) {
-	vm := &blockingPortForwardVM{
-		mockVM:  mockVM{id: "vm-test"},
-		started: make(chan struct{}, 2),
-		release: make(chan struct{}, 2),
-	}
+func TestHandlerCreateReportsBootError(t *testing.T) {
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return nil, fmt.Errorf("start VM: %w", &api.BootError{Code: api.BootErrorWorkspaceMountWait, Message: "workspace mount timeout: /workspace"})
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeVMFailed, msg.Error.Code)
+	assert.Equal(t, map[string]interface{}{
+		"boot_error": map[string]interface{}{
+			"code":    "workspace_mount_timeout",
+			"message": "workspace mount timeout: /workspace",
+		},
+	}, msg.Error.Data)
+}
+
+func TestFileFailedFlagsNotFound(t *testing.T) {
+	e := fileFailed(fmt.Errorf("open /workspace/x: %w", os.ErrNotExist))
+	assert.Equal(t, ErrCodeFileFailed, e.Code)
+	assert.Equal(t, map[string]interface{}{"not_found": true}, e.Data)
+
+	assert.Nil(t, fileFailed(os.ErrPermission).Data)
+}
 
+func TestHandlerWorkspaceSnapshotRestore(t *testing.T) {
+	vm := &mockSnapshotVM{mockVM: mockVM{id: "vm-test"}}
 	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
 		return vm, nil
 	})
 	defer rpc.close()
 
 	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("snapshot_workspace", 2, nil)
 	msg := rpc.read()
 	require.Nil(t, msg.Error)
-
-	params := map[string]interface{}{
-		"forwards": []map[string]int{{"local_port": 8080, "remote_port": 8080}},
+	var result struct {
+		SnapshotID string `json:"snapshot_id"`
 	}
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	assert.Equal(t, "snap-1", result.SnapshotID)
 
-	rpc.send("port_forward", 2, params)
-	select {
-	case <-vm.started:
-	case <-time.After(2 * time.Second):
-		t.Fatal("timed out waiting for first port_forward to start")
-	}
+	rpc.send("restore_workspace", 3, map[string]string{"snapshot_id": result.SnapshotID})
+	msg = rpc.read()
+	require.Nil(t, msg.Error)
+	assert.Equal(t, "snap-1", vm.restored)
 
-	rpc.send("port_forward", 3, params)
+	rpc.send("restore_workspace", 4, map[string]string{})
+	msg = rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+}
 
-	secondStartedEarly := false
-	select {
-	case <-vm.started:
-		secondStartedEarly = true
-	case <-time.After(500 * time.Millisecond):
+func TestHandlerDiskUsage(t *testing.T) {
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return &mockDiskUsageVM{mockVM: mockVM{id: "vm-test"}}, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("disk_usage", 2, nil)
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	var result struct {
+		Disks []api.DiskUsage `json:"disks"`
 	}
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	require.Len(t, result.Disks, 2)
+	assert.Equal(t, api.DiskUsageRootfs, result.Disks[0].Kind)
+	assert.Equal(t, uint64(3072), result.Disks[0].FreeBytes)
+	assert.Equal(t, uint64(12), result.Disks[1].UsedBytes)
+}
 
-	vm.release <- struct{}{}
+func TestHandlerDiskUsageUnsupported(t *testing.T) {
+	rpc := newTestRPC(&mockVM{id: "vm-test"})
+	defer rpc.close()
 
-	if !secondStartedEarly {
-		select {
-		case <-vm.started:
-		case <-time.After(2 * time.Second):
-			t.Fatal("timed out waiting for second port_forward to start")
-		}
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("disk_usage", 2, nil)
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeVMFailed, msg.Error.Code)
+}
+
+func TestHandlerStats(t *testing.T) {
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return &mockStatsVM{mockVM: mockVM{id: "vm-test"}}, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("stats", 2, nil)
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	var stats api.Stats
+	require.NoError(t, json.Unmarshal(msg.Result, &stats))
+	assert.Equal(t, uint64(1500), stats.CPUUsageUsec)
+	assert.Equal(t, 2, stats.ActiveExecs)
+	assert.Equal(t, uint64(100), stats.NetRxBytes)
+}
+
+func TestHandlerStatsUnsupported(t *testing.T) {
+	rpc := newTestRPC(&mockVM{id: "vm-test"})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("stats", 2, nil)
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeVMFailed, msg.Error.Code)
+}
+
+func TestHandlerGuestEnv(t *testing.T) {
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return &mockGuestEnvVM{mockVM: mockVM{id: "vm-test"}}, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("guest_env", 2, nil)
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	var result struct {
+		Env map[string]string `json:"env"`
 	}
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	assert.Equal(t, "/usr/bin:/bin", result.Env["PATH"])
+	assert.Equal(t, "SANDBOX_SECRET_abc", result.Env["API_KEY"])
+}
 
-	vm.release <- struct{}{}
+func TestHandlerGuestEnvUnsupported(t *testing.T) {
+	rpc := newTestRPC(&mockVM{id: "vm-test"})
+	defer rpc.close()
 
-	msgA := rpc.read()
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("guest_env", 2, nil)
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeVMFailed, msg.Error.Code)
+}
+
+func TestHandlerCommit(t *testing.T) {
+	vm := &mockCommitVM{mockVM: mockVM{id: "vm-test"}}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("commit", 2, map[string]string{"tag": "snap:v1", "workspace_dest": "/opt/app"})
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	var result struct {
+		Tag        string `json:"tag"`
+		RootfsPath string `json:"rootfs_path"`
+		Size       int64  `json:"size"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	assert.Equal(t, "snap:v1", result.Tag)
+	assert.Equal(t, "/cache/snap:v1/rootfs.ext4", result.RootfsPath)
+	assert.Equal(t, int64(4096), result.Size)
+	assert.Equal(t, "snap:v1", vm.tag)
+	assert.Equal(t, "/opt/app", vm.opts.WorkspaceDest)
+
+	rpc.send("commit", 3, map[string]string{})
+	msg = rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+}
+
+func TestHandlerFreezeWorkspace(t *testing.T) {
+	vm := &mockFreezeVM{mockVM: mockVM{id: "vm-test"}}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("freeze_workspace", 2, nil)
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	var result struct {
+		Frozen bool `json:"frozen"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	assert.True(t, result.Frozen)
+	assert.True(t, vm.frozen)
+
+	rpc.send("unfreeze_workspace", 3, nil)
+	msg = rpc.read()
+	require.Nil(t, msg.Error)
+	assert.False(t, vm.frozen)
+}
+
+func TestHandlerCheckHost(t *testing.T) {
+	vm := &mockPolicyVM{
+		mockVM: mockVM{id: "vm-test"},
+		engine: policy.NewEngine(&api.NetworkConfig{AllowedHosts: []string{"api.openai.com"}}),
+	}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	var result struct {
+		Host    string `json:"host"`
+		Allowed bool   `json:"allowed"`
+	}
+	rpc.send("check_host", 2, map[string]string{"host": "api.openai.com"})
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	assert.Equal(t, "api.openai.com", result.Host)
+	assert.True(t, result.Allowed)
+
+	rpc.send("check_host", 3, map[string]string{"host": "example.com"})
+	msg = rpc.read()
+	require.Nil(t, msg.Error)
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	assert.False(t, result.Allowed)
+
+	rpc.send("check_host", 4, map[string]string{})
+	msg = rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+}
+
+func TestHandlerAllowHost(t *testing.T) {
+	vm := &mockPolicyVM{
+		mockVM: mockVM{id: "vm-test"},
+		engine: policy.NewEngine(&api.NetworkConfig{AllowedHosts: []string{"api.openai.com"}}),
+	}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	require.False(t, vm.engine.IsHostAllowed("example.com"))
+	rpc.send("allow_host", 2, map[string]string{"host": "example.com"})
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	assert.True(t, vm.engine.IsHostAllowed("example.com"))
+
+	rpc.send("allow_host", 3, map[string]string{})
+	msg = rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+}
+
+func TestHandlerLogsFiltersBySource(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "vm.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("[    0.1] kernel\n[init] WARNING: x\n[agent] Guest agent starting...\n"), 0644))
+	vm := &mockLogVM{mockVM: mockVM{id: "vm-test"}, logPath: logPath}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("logs", 2, map[string]interface{}{"sources": []string{"agent", "console"}})
+	var lines []api.LogLine
+	var final *rpcMsg
+	for final == nil {
+		msg := rpc.read()
+		switch {
+		case msg.Method == "logs.line":
+			var line api.LogLine
+			require.NoError(t, json.Unmarshal(msg.Params, &line))
+			lines = append(lines, line)
+		case msg.ID != nil && *msg.ID == 2:
+			final = msg
+		}
+	}
+	require.Nil(t, final.Error)
+	assert.Equal(t, []api.LogLine{
+		{Source: api.LogSourceConsole, Text: "[    0.1] kernel"},
+		{Source: api.LogSourceAgent, Text: "Guest agent starting..."},
+	}, lines)
+
+	rpc.send("logs", 3, map[string]interface{}{"sources": []string{"kernel"}})
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+
+	// Seeking to the last line's start leaves only that line.
+	rpc.send("logs", 4, map[string]interface{}{"since": -len("[agent] Guest agent starting...\n")})
+	lines = nil
+	for {
+		msg := rpc.read()
+		if msg.Method == "logs.line" {
+			var line api.LogLine
+			require.NoError(t, json.Unmarshal(msg.Params, &line))
+			lines = append(lines, line)
+			continue
+		}
+		require.Nil(t, msg.Error)
+		break
+	}
+	assert.Equal(t, []api.LogLine{{Source: api.LogSourceAgent, Text: "Guest agent starting..."}}, lines)
+}
+
+func TestHandlerReadFileStream(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 16*1024) // 256 KiB
+	vm := &mockReadFileToVM{mockVM: mockVM{id: "vm-test"}, content: content}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("read_file_stream", 2, map[string]string{"path": "/workspace/model.bin"})
+	var got []byte
+	var final *rpcMsg
+	for final == nil {
+		msg := rpc.read()
+		switch {
+		case msg.Method == "read_file_stream.data":
+			var params struct {
+				Data string `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(msg.Params, &params))
+			data, err := base64.StdEncoding.DecodeString(params.Data)
+			require.NoError(t, err)
+			got = append(got, data...)
+		case msg.ID != nil && *msg.ID == 2:
+			final = msg
+		}
+	}
+	require.Nil(t, final.Error)
+	assert.True(t, bytes.Equal(content, got))
+	assert.Contains(t, string(final.Result), fmt.Sprintf(`"size":%d`, len(content)))
+}
+
+func TestHandlerReadFileStreamUnsupported(t *testing.T) {
+	rpc := newTestRPC(&mockVM{id: "vm-test"})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("read_file_stream", 2, map[string]string{"path": "/workspace/a"})
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeVMFailed, msg.Error.Code)
+}
+
+func TestHandlerReadFileRange(t *testing.T) {
+	vm := &mockReadFileRangeVM{mockVM: mockVM{id: "vm-test"}, content: []byte("0123456789")}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("read_file_range", 2, map[string]interface{}{"path": "/workspace/app.log", "offset": 7, "length": 100})
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	var result struct {
+		Content string `json:"content"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Result, &result))
+	data, err := base64.StdEncoding.DecodeString(result.Content)
+	require.NoError(t, err)
+	assert.Equal(t, "789", string(data))
+
+	rpc.send("read_file_range", 3, map[string]interface{}{"path": "/workspace/app.log", "offset": -1, "length": 4})
+	msg = rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+}
+
+func TestHandlerReadFileRangeUnsupported(t *testing.T) {
+	rpc := newTestRPC(&mockVM{id: "vm-test"})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("read_file_range", 2, map[string]interface{}{"path": "/workspace/a", "offset": 0, "length": 1})
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeVMFailed, msg.Error.Code)
+}
+
+func TestHandlerTailFileStreamsUntilCancelled(t *testing.T) {
+	vm := &mockTailVM{mockVM: mockVM{id: "vm-test"}}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("tail_file", 2, map[string]string{"path": "/var/log/app.log"})
+	msg := rpc.read()
+	require.Equal(t, "tail_file.data", msg.Method)
+	var params struct {
+		Data string `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Params, &params))
+	data, err := base64.StdEncoding.DecodeString(params.Data)
+	require.NoError(t, err)
+	assert.Equal(t, "line 1\n", string(data))
+	assert.Equal(t, "/var/log/app.log", vm.path)
+
+	rpc.send("cancel", 3, map[string]uint64{"id": 2})
+	var final, cancelled *rpcMsg
+	for final == nil || cancelled == nil {
+		msg := rpc.read()
+		switch {
+		case msg.ID != nil && *msg.ID == 2:
+			final = msg
+		case msg.ID != nil && *msg.ID == 3:
+			cancelled = msg
+		}
+	}
+	require.NotNil(t, final.Error)
+	assert.Equal(t, ErrCodeCancelled, final.Error.Code)
+
+	rpc.send("tail_file", 4, map[string]string{})
+	msg = rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+}
+
+func TestHandlerSubscribeEventsFiltersByType(t *testing.T) {
+	vm := &mockEventsVM{mockVM: mockVM{id: "vm-test"}, events: make(chan api.Event)}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("subscribe_events", 2, map[string][]string{"types": {"dns"}})
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+
+	rpc.send("subscribe_events", 3, map[string][]string{"types": {"host_denied"}})
+
+	// The subscription registers asynchronously, so keep emitting until
+	// one event reaches it.
+	stop := make(chan struct{})
+	go func() {
+		for {
+			for _, event := range []api.Event{
+				{Type: "network", Network: &api.NetworkEvent{Host: "example.com"}},
+				{Type: "host_denied", HostDenied: &api.HostDenied{Host: "evil.com"}},
+			} {
+				select {
+				case vm.events <- event:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		msg := rpc.read()
+		if msg.Method != "subscribe_events.event" {
+			continue
+		}
+		var params struct {
+			ID    uint64    `json:"id"`
+			Event api.Event `json:"event"`
+		}
+		require.NoError(t, json.Unmarshal(msg.Params, &params))
+		assert.Equal(t, uint64(3), params.ID)
+		assert.Equal(t, "host_denied", params.Event.Type)
+		require.NotNil(t, params.Event.HostDenied)
+		assert.Equal(t, "evil.com", params.Event.HostDenied.Host)
+		break
+	}
+	close(stop)
+
+	rpc.send("cancel", 4, map[string]uint64{"id": 3})
+	var final, cancelled *rpcMsg
+	for final == nil || cancelled == nil {
+		msg := rpc.read()
+		switch {
+		case msg.ID != nil && *msg.ID == 3:
+			final = msg
+		case msg.ID != nil && *msg.ID == 4:
+			cancelled = msg
+		}
+	}
+	require.NotNil(t, final.Error)
+	assert.Equal(t, ErrCodeCancelled, final.Error.Code)
+}
+
+func TestHandlerSubscribeEventsSuppressesBroadcast(t *testing.T) {
+	vm := &mockEventsVM{mockVM: mockVM{id: "vm-test"}, events: make(chan api.Event)}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("subscribe_events", 2, map[string][]string{"types": {"network_denied"}})
+
+	allowed := api.Event{Type: string(api.EventTypeNetwork), Network: &api.NetworkEvent{Host: "example.com"}}
+	denied := api.Event{Type: string(api.EventTypeNetwork), Network: &api.NetworkEvent{Host: "evil.com", Blocked: true}}
+	stop := make(chan struct{})
+	go func() {
+		for {
+			for _, event := range []api.Event{allowed, denied} {
+				select {
+				case vm.events <- event:
+				case <-stop:
+					return
+				}
+			}
+		}
+	}()
+
+	// Once the subscription delivers, the plain broadcast has stopped.
+	subscribed := false
+	for delivered := 0; delivered < 3; {
+		msg := rpc.read()
+		switch msg.Method {
+		case "event":
+			require.False(t, subscribed, "event broadcast while a subscription is open")
+		case "subscribe_events.event":
+			subscribed = true
+			delivered++
+			var params struct {
+				Event api.Event `json:"event"`
+			}
+			require.NoError(t, json.Unmarshal(msg.Params, &params))
+			require.NotNil(t, params.Event.Network)
+			assert.Equal(t, "evil.com", params.Event.Network.Host, "network_denied selects blocked network events")
+		}
+	}
+	close(stop)
+
+	rpc.send("cancel", 3, map[string]uint64{"id": 2})
+	for done := 0; done < 2; {
+		if msg := rpc.read(); msg.ID != nil && (*msg.ID == 2 || *msg.ID == 3) {
+			done++
+		}
+	}
+}
+
+func TestEventFilterMatches(t *testing.T) {
+	var all eventFilter
+	assert.True(t, all.matches(api.Event{Type: "file"}))
+
+	filter := eventFilter{api.EventTypeNetwork: true}
+	assert.True(t, filter.matches(api.Event{Type: "network"}))
+	assert.False(t, filter.matches(api.Event{Type: "file"}))
+
+	denied := eventFilter{api.EventTypeNetworkDenied: true}
+	assert.True(t, denied.matches(api.Event{Type: "network", Network: &api.NetworkEvent{Blocked: true}}))
+	assert.False(t, denied.matches(api.Event{Type: "network", Network: &api.NetworkEvent{}}))
+}
+
+func TestHandlerPortForwardSerializesReplacement(t *testing.T) {
+	vm := &blockingPortForwardVM{
+		mockVM:  mockVM{id: "vm-test"},
+		started: make(chan struct{}, 2),
+		release: make(chan struct{}, 2),
+	}
+
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+
+	params := map[string]interface{}{
+		"forwards": []map[string]int{{"local_port": 8080, "remote_port": 8080}},
+	}
+
+	rpc.send("port_forward", 2, params)
+	select {
+	case <-vm.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for first port_forward to start")
+	}
+
+	rpc.send("port_forward", 3, params)
+
+	secondStartedEarly := false
+	select {
+	case <-vm.started:
+		secondStartedEarly = true
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	vm.release <- struct{}{}
+
+	if !secondStartedEarly {
+		select {
+		case <-vm.started:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for second port_forward to start")
+		}
+	}
+
+	vm.release <- struct{}{}
+
+	msgA := rpc.read()
 	msgB := rpc.read()
 	require.NotNil(t, msgA.ID)
 	require.NotNil(t, msgB.ID)
@@ -400,3 +1286,400 @@ func TestHandlerPortForwardSerializesReplacement(t *testing.T) {
 	assert.ElementsMatch(t, []uint64{2, 3}, []uint64{*msgA.ID, *msgB.ID})
 	assert.False(t, secondStartedEarly, "second port_forward started before first replacement completed")
 }
+
+type mockTTYVM struct {
+	mockVM
+	sizes chan [2]uint16
+}
+
+func (m *mockTTYVM) ExecInteractive(ctx context.Context, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error) {
+	m.sizes <- [2]uint16{rows, cols}
+	go func() {
+		for size := range resizeCh {
+			m.sizes <- size
+		}
+	}()
+	data, _ := io.ReadAll(stdin)
+	stdout.Write(data)
+	return 3, nil
+}
+
+func TestHandlerExecTTYRoutesStdinAndResize(t *testing.T) {
+	vm := &mockTTYVM{mockVM: mockVM{id: "vm-test"}, sizes: make(chan [2]uint16, 4)}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("exec_tty", 2, map[string]interface{}{"session_id": "tty-1", "command": "sh", "rows": 10, "cols": 20})
+	rpc.send("exec_tty.resize", 3, map[string]interface{}{"session_id": "tty-1", "rows": 50, "cols": 120})
+	msg := rpc.read()
+	require.Nil(t, msg.Error)
+	assert.Equal(t, [2]uint16{10, 20}, <-vm.sizes)
+	assert.Equal(t, [2]uint16{50, 120}, <-vm.sizes)
+
+	rpc.send("exec_tty.stdin", 4, map[string]interface{}{
+		"session_id": "tty-1",
+		"data":       base64.StdEncoding.EncodeToString([]byte("echo hi\n")),
+		"eof":        true,
+	})
+
+	var stdout []byte
+	var final *rpcMsg
+	for final == nil {
+		msg := rpc.read()
+		switch {
+		case msg.Method == "exec_tty.stdout":
+			var chunk struct {
+				Data string `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(msg.Params, &chunk))
+			decoded, _ := base64.StdEncoding.DecodeString(chunk.Data)
+			stdout = append(stdout, decoded...)
+		case msg.ID != nil && *msg.ID == 2:
+			final = msg
+		default:
+			require.Nil(t, msg.Error)
+		}
+	}
+	require.Nil(t, final.Error)
+	assert.Equal(t, "echo hi\n", string(stdout))
+	var result struct {
+		SessionID string `json:"session_id"`
+		ExitCode  int    `json:"exit_code"`
+	}
+	require.NoError(t, json.Unmarshal(final.Result, &result))
+	assert.Equal(t, "tty-1", result.SessionID)
+	assert.Equal(t, 3, result.ExitCode)
+
+	rpc.send("exec_tty.resize", 5, map[string]interface{}{"session_id": "tty-1", "rows": 1, "cols": 1})
+	msg = rpc.read()
+	require.NotNil(t, msg.Error, "finished sessions must be forgotten")
+	assert.Equal(t, ErrCodeInvalidParams, msg.Error.Code)
+}
+
+type echoTTYVM struct {
+	mockVM
+	mu    sync.Mutex
+	sizes map[string][][2]uint16
+}
+
+func (m *echoTTYVM) ExecInteractive(ctx context.Context, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error) {
+	resized := make(chan struct{})
+	go func() {
+		defer close(resized)
+		size := <-resizeCh
+		m.mu.Lock()
+		m.sizes[command] = append(m.sizes[command], size)
+		m.mu.Unlock()
+	}()
+	data, _ := io.ReadAll(stdin)
+	<-resized
+	stdout.Write([]byte(command + ":" + string(data)))
+	return 0, nil
+}
+
+func TestHandlerExecTTYConcurrentSessionsAreIndependent(t *testing.T) {
+	vm := &echoTTYVM{mockVM: mockVM{id: "vm-test"}, sizes: make(map[string][][2]uint16)}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	// Responses are written on the read loop, so drain them concurrently.
+	msgs := make(chan *rpcMsg, 32)
+	go func() {
+		for i := 0; i < 9; i++ {
+			msgs <- rpc.read()
+		}
+	}()
+
+	rpc.send("exec_tty", 10, map[string]interface{}{"session_id": "a", "command": "shell-a"})
+	rpc.send("exec_tty", 20, map[string]interface{}{"session_id": "b", "command": "shell-b"})
+	rpc.send("exec_tty", 30, map[string]interface{}{"session_id": "a", "command": "dup"})
+	rpc.send("exec_tty.resize", 21, map[string]interface{}{"session_id": "b", "rows": 20, "cols": 200})
+	rpc.send("exec_tty.resize", 11, map[string]interface{}{"session_id": "a", "rows": 10, "cols": 100})
+	rpc.send("exec_tty.stdin", 22, map[string]interface{}{"session_id": "b", "data": base64.StdEncoding.EncodeToString([]byte("bbb")), "eof": true})
+	rpc.send("exec_tty.stdin", 12, map[string]interface{}{"session_id": "a", "data": base64.StdEncoding.EncodeToString([]byte("aaa")), "eof": true})
+
+	stdout := map[uint64]string{}
+	finals := map[uint64]*rpcMsg{}
+	for len(finals) < 7 {
+		msg := <-msgs
+		if msg.Method == "exec_tty.stdout" {
+			var chunk struct {
+				ID   uint64 `json:"id"`
+				Data string `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(msg.Params, &chunk))
+			decoded, _ := base64.StdEncoding.DecodeString(chunk.Data)
+			stdout[chunk.ID] += string(decoded)
+			continue
+		}
+		require.NotNil(t, msg.ID)
+		finals[*msg.ID] = msg
+	}
+
+	require.NotNil(t, finals[30].Error, "duplicate session IDs must be rejected")
+	for _, id := range []uint64{10, 11, 12, 20, 21, 22} {
+		require.Nil(t, finals[id].Error, "request %d", id)
+	}
+	assert.Equal(t, "shell-a:aaa", stdout[10])
+	assert.Equal(t, "shell-b:bbb", stdout[20])
+
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	assert.Equal(t, [][2]uint16{{10, 100}}, vm.sizes["shell-a"])
+	assert.Equal(t, [][2]uint16{{20, 200}}, vm.sizes["shell-b"])
+}
+
+type closeRecordingVM struct {
+	mockVM
+	closedAfter func()
+}
+
+func (m *closeRecordingVM) Close(context.Context) error {
+	m.closedAfter()
+	return nil
+}
+
+func TestHandlerCloseWaitsForInFlightRequests(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	var execDone atomic.Bool
+	var closedBeforeExecDone atomic.Bool
+
+	vm := &closeRecordingVM{
+		mockVM: mockVM{
+			id: "vm-test",
+			execFunc: func(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+				close(started)
+				<-unblock
+				execDone.Store(true)
+				return &api.ExecResult{Stdout: []byte(command)}, nil
+			},
+		},
+		closedAfter: func() {
+			if !execDone.Load() {
+				closedBeforeExecDone.Store(true)
+			}
+		},
+	}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	require.Nil(t, rpc.read().Error)
+
+	rpc.send("exec", 2, map[string]string{"command": "slow"})
+	<-started
+	rpc.send("close", 3, nil)
+
+	time.Sleep(50 * time.Millisecond)
+	close(unblock)
+
+	got := make(map[uint64]*rpcMsg)
+	for len(got) < 2 {
+		msg := rpc.read()
+		require.NotNil(t, msg.ID)
+		got[*msg.ID] = msg
+	}
+	require.Nil(t, got[2].Error, "in-flight exec failed")
+	require.Nil(t, got[3].Error, "close failed")
+	assert.False(t, closedBeforeExecDone.Load(), "VM closed while an exec was in flight")
+}
+
+func TestHandlerCloseCancelsRequestsThatOutliveTimeout(t *testing.T) {
+	started := make(chan struct{})
+	var execDone atomic.Bool
+	var closedBeforeExecDone atomic.Bool
+
+	vm := &closeRecordingVM{
+		mockVM: mockVM{
+			id: "vm-test",
+			execFunc: func(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+				close(started)
+				<-ctx.Done()
+				execDone.Store(true)
+				return nil, ctx.Err()
+			},
+		},
+		closedAfter: func() {
+			if !execDone.Load() {
+				closedBeforeExecDone.Store(true)
+			}
+		},
+	}
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		return vm, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	require.Nil(t, rpc.read().Error)
+
+	rpc.send("exec", 2, map[string]string{"command": "sleep infinity"})
+	<-started
+	rpc.send("close", 3, map[string]float64{"timeout_seconds": 0.05})
+
+	got := make(map[uint64]*rpcMsg)
+	for len(got) < 2 {
+		msg := rpc.read()
+		require.NotNil(t, msg.ID)
+		got[*msg.ID] = msg
+	}
+	require.NotNil(t, got[2].Error, "exec outliving the close timeout must fail")
+	assert.Equal(t, ErrCodeCancelled, got[2].Error.Code)
+	require.Nil(t, got[3].Error, "close failed")
+	assert.False(t, closedBeforeExecDone.Load(), "VM closed while an exec was in flight")
+}
+
+func TestHandlerVFSHookDecisionRoundTrip(t *testing.T) {
+	deciders := make(chan api.VFSHookDecider, 1)
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		deciders <- config.VFS.Interception.Decider
+		return &mockVM{id: "vm-test"}, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]interface{}{
+		"image": "alpine:latest",
+		"vfs": map[string]interface{}{
+			"interception": map[string]interface{}{
+				"rules": []map[string]interface{}{
+					{"name": "ask", "action": api.VFSHookActionCallback, "ops": []string{"write"}},
+				},
+			},
+		},
+	})
+	require.Nil(t, rpc.read().Error)
+	decide := <-deciders
+	require.NotNil(t, decide)
+
+	decision := make(chan string, 1)
+	go func() {
+		decision <- decide(context.Background(), api.VFSHookDecisionRequest{Op: "write", Path: "/workspace/.env", Size: 7})
+	}()
+
+	msg := rpc.read()
+	require.Equal(t, "vfs_hook.decide", msg.Method)
+	var params struct {
+		DecisionID uint64 `json:"decision_id"`
+		Rule       int    `json:"rule"`
+		Op         string `json:"op"`
+		Path       string `json:"path"`
+		Size       int    `json:"size"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Params, &params))
+	assert.Equal(t, "/workspace/.env", params.Path)
+	assert.Equal(t, 7, params.Size)
+
+	rpc.send("vfs_hook.decision", 2, map[string]interface{}{"decision_id": params.DecisionID, "action": "block"})
+	assert.Equal(t, "block", <-decision)
+	resp := rpc.read()
+	require.Nil(t, resp.Error)
+	assert.JSONEq(t, `{"delivered":true}`, string(resp.Result))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go func() { decision <- decide(ctx, api.VFSHookDecisionRequest{Op: "write", Path: "/workspace/a"}) }()
+	assert.Equal(t, "vfs_hook.decide", rpc.read().Method)
+	assert.Equal(t, "block", <-decision, "unanswered decision must block")
+}
+
+func TestHandlerVFSHookMutationRoundTrip(t *testing.T) {
+	mutators := make(chan api.VFSHookMutator, 1)
+	rpc := newTestRPCWithFactory(func(ctx context.Context, config *api.Config) (VM, error) {
+		mutators <- config.VFS.Interception.Mutator
+		return &mockVM{id: "vm-test"}, nil
+	})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]interface{}{
+		"image": "alpine:latest",
+		"vfs": map[string]interface{}{
+			"interception": map[string]interface{}{
+				"rules": []map[string]interface{}{
+					{"name": "redact", "action": api.VFSHookActionMutateCallback, "ops": []string{"write"}},
+				},
+			},
+		},
+	})
+	require.Nil(t, rpc.read().Error)
+	mutate := <-mutators
+	require.NotNil(t, mutate)
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		data, err := mutate(context.Background(), api.VFSHookMutateRequest{Path: "/workspace/.env", Offset: 3, Data: []byte("token=abc")})
+		results <- result{data, err}
+	}()
+
+	msg := rpc.read()
+	require.Equal(t, "vfs_hook.mutate", msg.Method)
+	var params struct {
+		MutationID uint64 `json:"mutation_id"`
+		Path       string `json:"path"`
+		Offset     int64  `json:"offset"`
+		Data       []byte `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(msg.Params, &params))
+	assert.Equal(t, "/workspace/.env", params.Path)
+	assert.Equal(t, int64(3), params.Offset)
+	assert.Equal(t, "token=abc", string(params.Data))
+
+	rpc.send("vfs_hook.mutation", 2, map[string]interface{}{"mutation_id": params.MutationID, "data": []byte("token=***")})
+	got := <-results
+	require.NoError(t, got.err)
+	assert.Equal(t, "token=***", string(got.data))
+	resp := rpc.read()
+	require.Nil(t, resp.Error)
+	assert.JSONEq(t, `{"delivered":true}`, string(resp.Result))
+
+	go func() {
+		data, err := mutate(context.Background(), api.VFSHookMutateRequest{Path: "/workspace/a"})
+		results <- result{data, err}
+	}()
+	msg = rpc.read()
+	require.NoError(t, json.Unmarshal(msg.Params, &params))
+	rpc.send("vfs_hook.mutation", 3, map[string]interface{}{"mutation_id": params.MutationID, "error": "hook failed"})
+	got = <-results
+	assert.ErrorIs(t, got.err, ErrVFSHookMutation)
+	require.Nil(t, rpc.read().Error)
+}
+
+func TestHandlerSnapshotUnsupported(t *testing.T) {
+	rpc := newTestRPC(&mockVM{id: "vm-test"})
+	defer rpc.close()
+
+	rpc.send("create", 1, map[string]string{"image": "alpine:latest"})
+	rpc.read()
+
+	rpc.send("snapshot", 2, nil)
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeVMFailed, msg.Error.Code)
+	assert.Contains(t, msg.Error.Message, "does not support VM snapshots")
+}
+
+func TestHandlerRestoreSnapshotWithoutFactory(t *testing.T) {
+	rpc := newTestRPC(&mockVM{id: "vm-test"})
+	defer rpc.close()
+
+	rpc.send("restore_snapshot", 1, map[string]string{"snapshot_id": "snap-0123456789ab"})
+	msg := rpc.read()
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ErrCodeVMFailed, msg.Error.Code)
+}
@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/sandbox"
+)
+
+type logVM interface {
+	LogPath() string
+}
+
+// handleLogs streams the VM console log as logs.line notifications:
+//
+//	{"jsonrpc":"2.0","method":"logs.line","params":{"id":<req_id>,"source":"agent","text":"..."}}
+//
+// With follow set, it keeps streaming until the request is cancelled.
+// vmLogPath returns the VM's console log path. The VM is released as soon as
+// the path is known, so a following log stream does not hold up close.
+func (h *Handler) vmLogPath(req *Request) (string, *Response) {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return "", &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	lvm, ok := vm.(logVM)
+	if !ok {
+		return "", &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support logs"},
+			ID:      req.ID,
+		}
+	}
+	return lvm.LogPath(), nil
+}
+
+func (h *Handler) handleLogs(ctx context.Context, req *Request) *Response {
+	logPath, errResp := h.vmLogPath(req)
+	if errResp != nil {
+		return errResp
+	}
+
+	var params struct {
+		Sources []string `json:"sources,omitempty"`
+		Follow  bool     `json:"follow,omitempty"`
+		Since   int64    `json:"since,omitempty"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+				ID:      req.ID,
+			}
+		}
+	}
+	opts := sandbox.LogOptions{Follow: params.Follow, Since: params.Since}
+	for _, name := range params.Sources {
+		source, err := api.ParseLogSource(name)
+		if err != nil {
+			return &Response{
+				JSONRPC: "2.0",
+				Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+				ID:      req.ID,
+			}
+		}
+		opts.Sources = append(opts.Sources, source)
+	}
+
+	lines := 0
+	err := sandbox.StreamLogs(ctx, logPath, opts, func(line api.LogLine) error {
+		lines++
+		h.sendLogLine(req.ID, line)
+		return nil
+	})
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"lines": lines,
+		},
+		ID: req.ID,
+	}
+}
+
+func (h *Handler) sendLogLine(reqID *uint64, line api.LogLine) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	notification := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "logs.line",
+		"params": map[string]interface{}{
+			"id":     reqID,
+			"source": line.Source,
+			"text":   line.Text,
+		},
+	}
+	encoded, _ := json.Marshal(notification)
+	fmt.Fprintln(h.stdout, string(encoded))
+}
@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+)
+
+type tailVM interface {
+	TailFile(ctx context.Context, path string, w io.Writer) error
+}
+
+// handleTailFile follows a guest file and streams the appended bytes as
+// tail_file.data notifications until the request is cancelled:
+//
+//	{"jsonrpc":"2.0","method":"tail_file.data","params":{"id":<req_id>,"data":"<base64>"}}
+//
+// Unlike logs, the VM is held for the whole stream because the bytes come
+// over its vsock; close cancels the stream once its timeout expires.
+func (h *Handler) handleTailFile(ctx context.Context, req *Request) *Response {
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+	tvm, ok := vm.(tailVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support tail_file"},
+			ID:      req.ID,
+		}
+	}
+
+	var params struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.Path == "" {
+		msg := "path is required"
+		if err != nil {
+			msg = err.Error()
+		}
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: msg},
+			ID:      req.ID,
+		}
+	}
+
+	w := &streamWriter{handler: h, reqID: req.ID, method: "tail_file.data"}
+	if err := tvm.TailFile(ctx, params.Path, w); err != nil {
+		code := ErrCodeVMFailed
+		if ctx.Err() != nil {
+			code = ErrCodeCancelled
+		}
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: code, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  map[string]interface{}{},
+		ID:      req.ID,
+	}
+}
@@ -0,0 +1,299 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// ttyStdinQueueSize bounds stdin chunks buffered ahead of the guest PTY.
+const ttyStdinQueueSize = 256
+
+type ttyVM interface {
+	ExecInteractive(ctx context.Context, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error)
+}
+
+// ttySession routes stdin and resize requests to a running exec_tty.
+type ttySession struct {
+	stdin    chan []byte // nil chunk closes guest stdin
+	resizeCh chan [2]uint16
+	done     chan struct{}
+}
+
+type ttyParams struct {
+	SessionID  string   `json:"session_id,omitempty"`
+	Command    string   `json:"command"`
+	Args       []string `json:"args,omitempty"`
+	Shell      []string `json:"shell,omitempty"`
+	WorkingDir string   `json:"working_dir,omitempty"`
+	User       string   `json:"user,omitempty"`
+	LoginShell bool     `json:"login_shell,omitempty"`
+	Rows       uint16   `json:"rows,omitempty"`
+	Cols       uint16   `json:"cols,omitempty"`
+}
+
+// ttySessionID returns the session ID for an exec_tty request, defaulting to
+// the request ID when the client did not pick one.
+func ttySessionID(req *Request, params *ttyParams) string {
+	if params.SessionID != "" {
+		return params.SessionID
+	}
+	if req.ID != nil {
+		return strconv.FormatUint(*req.ID, 10)
+	}
+	return ""
+}
+
+// registerTTYSession records an exec_tty session before the request is
+// dispatched, so stdin and resize requests sent right after it are routed
+// instead of racing the handler goroutine. A non-nil response rejects the
+// request.
+func (h *Handler) registerTTYSession(req *Request) *Response {
+	var params ttyParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+	id := ttySessionID(req, &params)
+	if id == "" {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "session_id is required"},
+			ID:      req.ID,
+		}
+	}
+
+	h.ttyMu.Lock()
+	defer h.ttyMu.Unlock()
+	if _, exists := h.ttySessions[id]; exists {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "tty session already exists: " + id},
+			ID:      req.ID,
+		}
+	}
+	h.ttySessions[id] = &ttySession{
+		stdin:    make(chan []byte, ttyStdinQueueSize),
+		resizeCh: make(chan [2]uint16, 1),
+		done:     make(chan struct{}),
+	}
+	return nil
+}
+
+func (h *Handler) lookupTTYSession(id string) *ttySession {
+	h.ttyMu.Lock()
+	defer h.ttyMu.Unlock()
+	return h.ttySessions[id]
+}
+
+func (h *Handler) handleExecTTY(ctx context.Context, req *Request) *Response {
+	var params ttyParams
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	id := ttySessionID(req, &params)
+	session := h.lookupTTYSession(id)
+	if session == nil {
+		return unknownTTYSession(req, id)
+	}
+	defer func() {
+		close(session.done)
+		h.ttyMu.Lock()
+		delete(h.ttySessions, id)
+		h.ttyMu.Unlock()
+	}()
+
+	vm, release := h.acquireVM()
+	defer release()
+	if vm == nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM not created"},
+			ID:      req.ID,
+		}
+	}
+
+	tvm, ok := vm.(ttyVM)
+	if !ok {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeVMFailed, Message: "VM backend does not support interactive exec"},
+			ID:      req.ID,
+		}
+	}
+
+	if params.Rows == 0 {
+		params.Rows = 24
+	}
+	if params.Cols == 0 {
+		params.Cols = 80
+	}
+
+	stdinReader, stdinWriter := io.Pipe()
+	defer stdinReader.Close()
+	go func() {
+		defer stdinWriter.Close()
+		for {
+			select {
+			case chunk := <-session.stdin:
+				if chunk == nil {
+					return
+				}
+				if _, err := stdinWriter.Write(chunk); err != nil {
+					return
+				}
+			case <-session.done:
+				return
+			}
+		}
+	}()
+
+	opts := &api.ExecOptions{
+		WorkingDir: params.WorkingDir,
+		User:       params.User,
+		LoginShell: params.LoginShell,
+		Shell:      params.Shell,
+		Args:       params.Args,
+		TraceID:    requestTraceID(req),
+	}
+	stdout := &streamWriter{handler: h, reqID: req.ID, method: "exec_tty.stdout"}
+
+	exitCode, err := tvm.ExecInteractive(ctx, execCommandText(params.Command, params.Args), opts, params.Rows, params.Cols, stdinReader, stdout, session.resizeCh)
+	if err != nil {
+		code := ErrCodeExecFailed
+		if ctx.Err() != nil {
+			code = ErrCodeCancelled
+		}
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: code, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result: map[string]interface{}{
+			"session_id": id,
+			"exit_code":  exitCode,
+		},
+		ID: req.ID,
+	}
+}
+
+// handleTTYStdin queues input for a session. It runs on the read loop so
+// chunks reach the guest in the order they were sent.
+func (h *Handler) handleTTYStdin(req *Request) *Response {
+	var params struct {
+		SessionID string `json:"session_id"`
+		Data      string `json:"data,omitempty"`
+		EOF       bool   `json:"eof,omitempty"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+	data, err := base64.StdEncoding.DecodeString(params.Data)
+	if err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "invalid base64 data"},
+			ID:      req.ID,
+		}
+	}
+
+	session := h.lookupTTYSession(params.SessionID)
+	if session == nil {
+		return unknownTTYSession(req, params.SessionID)
+	}
+
+	chunks := [][]byte{}
+	if len(data) > 0 {
+		chunks = append(chunks, data)
+	}
+	if params.EOF {
+		chunks = append(chunks, nil)
+	}
+	for _, chunk := range chunks {
+		select {
+		case session.stdin <- chunk:
+		case <-session.done:
+			return unknownTTYSession(req, params.SessionID)
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  map[string]interface{}{},
+		ID:      req.ID,
+	}
+}
+
+// handleTTYResize applies a new terminal size to a session. Only the most
+// recent size matters, so a pending unapplied size is replaced.
+func (h *Handler) handleTTYResize(req *Request) *Response {
+	var params struct {
+		SessionID string `json:"session_id"`
+		Rows      uint16 `json:"rows"`
+		Cols      uint16 `json:"cols"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+	if params.Rows == 0 || params.Cols == 0 {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: "rows and cols must be positive"},
+			ID:      req.ID,
+		}
+	}
+
+	session := h.lookupTTYSession(params.SessionID)
+	if session == nil {
+		return unknownTTYSession(req, params.SessionID)
+	}
+
+	size := [2]uint16{params.Rows, params.Cols}
+	for {
+		select {
+		case session.resizeCh <- size:
+			return &Response{
+				JSONRPC: "2.0",
+				Result:  map[string]interface{}{},
+				ID:      req.ID,
+			}
+		default:
+		}
+		select {
+		case <-session.resizeCh:
+		default:
+		}
+	}
+}
+
+func unknownTTYSession(req *Request, id string) *Response {
+	return &Response{
+		JSONRPC: "2.0",
+		Error:   &Error{Code: ErrCodeInvalidParams, Message: "unknown tty session: " + id},
+		ID:      req.ID,
+	}
+}
@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// decideVFSHook asks the client for a callback rule's decision by sending a
+// vfs_hook.decide notification, and waits for the matching
+// vfs_hook.decision request. It returns "block" if ctx expires first.
+func (h *Handler) decideVFSHook(ctx context.Context, req api.VFSHookDecisionRequest) string {
+	id := h.nextDecision.Add(1)
+	ch := make(chan string, 1)
+
+	h.decisionsMu.Lock()
+	h.decisions[id] = ch
+	h.decisionsMu.Unlock()
+	defer func() {
+		h.decisionsMu.Lock()
+		delete(h.decisions, id)
+		h.decisionsMu.Unlock()
+	}()
+
+	h.sendDecisionRequest(id, req)
+
+	select {
+	case action := <-ch:
+		return action
+	case <-ctx.Done():
+		return "block"
+	}
+}
+
+func (h *Handler) sendDecisionRequest(id uint64, req api.VFSHookDecisionRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	notification := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "vfs_hook.decide",
+		"params": struct {
+			DecisionID uint64 `json:"decision_id"`
+			api.VFSHookDecisionRequest
+		}{id, req},
+	}
+	encoded, _ := json.Marshal(notification)
+	fmt.Fprintln(h.stdout, string(encoded))
+}
+
+// handleVFSHookDecision delivers a client's answer to a pending
+// vfs_hook.decide. It runs on the read loop so that answers are never queued
+// behind the file operations waiting for them.
+func (h *Handler) handleVFSHookDecision(req *Request) *Response {
+	var params struct {
+		DecisionID uint64 `json:"decision_id"`
+		Action     string `json:"action"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	h.decisionsMu.Lock()
+	ch, ok := h.decisions[params.DecisionID]
+	h.decisionsMu.Unlock()
+	if ok {
+		select {
+		case ch <- params.Action:
+		default:
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  map[string]interface{}{"delivered": ok},
+		ID:      req.ID,
+	}
+}
+
+// vfsHookMutation is a client's answer to a vfs_hook.mutate notification.
+type vfsHookMutation struct {
+	data []byte
+	err  string
+}
+
+// mutateVFSHook asks the client for a mutate_callback rule's replacement
+// bytes by sending a vfs_hook.mutate notification, and waits for the
+// matching vfs_hook.mutation request.
+func (h *Handler) mutateVFSHook(ctx context.Context, req api.VFSHookMutateRequest) ([]byte, error) {
+	id := h.nextMutation.Add(1)
+	ch := make(chan vfsHookMutation, 1)
+
+	h.mutationsMu.Lock()
+	h.mutations[id] = ch
+	h.mutationsMu.Unlock()
+	defer func() {
+		h.mutationsMu.Lock()
+		delete(h.mutations, id)
+		h.mutationsMu.Unlock()
+	}()
+
+	h.sendMutationRequest(id, req)
+
+	select {
+	case m := <-ch:
+		if m.err != "" {
+			return nil, errx.With(ErrVFSHookMutation, ": %s", m.err)
+		}
+		return m.data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (h *Handler) sendMutationRequest(id uint64, req api.VFSHookMutateRequest) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	notification := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "vfs_hook.mutate",
+		"params": struct {
+			MutationID uint64 `json:"mutation_id"`
+			api.VFSHookMutateRequest
+		}{id, req},
+	}
+	encoded, _ := json.Marshal(notification)
+	fmt.Fprintln(h.stdout, string(encoded))
+}
+
+// handleVFSHookMutation delivers a client's answer to a pending
+// vfs_hook.mutate. Data is base64 encoded; a non-empty error fails the
+// guest write.
+func (h *Handler) handleVFSHookMutation(req *Request) *Response {
+	var params struct {
+		MutationID uint64 `json:"mutation_id"`
+		Data       []byte `json:"data"`
+		Error      string `json:"error"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		return &Response{
+			JSONRPC: "2.0",
+			Error:   &Error{Code: ErrCodeInvalidParams, Message: err.Error()},
+			ID:      req.ID,
+		}
+	}
+
+	h.mutationsMu.Lock()
+	ch, ok := h.mutations[params.MutationID]
+	h.mutationsMu.Unlock()
+	if ok {
+		select {
+		case ch <- vfsHookMutation{data: params.Data, err: params.Error}:
+		default:
+		}
+	}
+
+	return &Response{
+		JSONRPC: "2.0",
+		Result:  map[string]interface{}{"delivered": ok},
+		ID:      req.ID,
+	}
+}
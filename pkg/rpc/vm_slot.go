@@ -0,0 +1,41 @@
+package rpc
+
+import "sync"
+
+// vmSlot holds one VM and orders the requests that use it. Requests hold the
+// slot's lock for reading while they use the VM and close holds it for
+// writing, so closing a VM waits for the operations in flight on that VM
+// only, and operations on different VMs never contend.
+type vmSlot struct {
+	lock   sync.RWMutex
+	vm     VM
+	closed bool
+}
+
+func newVMSlot(vm VM) *vmSlot {
+	return &vmSlot{vm: vm}
+}
+
+// acquire returns the VM and a release func that must be called when the
+// operation using it finishes. It returns false once close has started.
+func (s *vmSlot) acquire() (VM, func(), bool) {
+	s.lock.RLock()
+	if s.closed {
+		s.lock.RUnlock()
+		return nil, nil, false
+	}
+	return s.vm, s.lock.RUnlock, true
+}
+
+// close waits for in-flight operations, then runs closeFn with the lock
+// still held so that no new operation can start. Only the first call runs
+// closeFn.
+func (s *vmSlot) close(closeFn func(VM) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return closeFn(s.vm)
+}
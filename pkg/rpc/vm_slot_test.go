@@ -0,0 +1,95 @@
+package rpc
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVMSlotCloseWaitsForInFlightOps(t *testing.T) {
+	slot := newVMSlot(&mockVM{id: "vm-a"})
+
+	_, release, ok := slot.acquire()
+	require.True(t, ok)
+
+	var released atomic.Bool
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		require.NoError(t, slot.close(func(VM) error {
+			assert.True(t, released.Load(), "close ran while an operation was in flight")
+			return nil
+		}))
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("close returned while an operation was in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	released.Store(true)
+	release()
+	<-closed
+
+	_, _, ok = slot.acquire()
+	assert.False(t, ok, "acquire succeeded after close")
+}
+
+func TestVMSlotCloseRunsOnce(t *testing.T) {
+	slot := newVMSlot(&mockVM{id: "vm-a"})
+	calls := 0
+	for i := 0; i < 2; i++ {
+		require.NoError(t, slot.close(func(VM) error {
+			calls++
+			return nil
+		}))
+	}
+	assert.Equal(t, 1, calls)
+}
+
+func TestVMSlotsDoNotContend(t *testing.T) {
+	a := newVMSlot(&mockVM{id: "vm-a"})
+	b := newVMSlot(&mockVM{id: "vm-b"})
+
+	// A long-running operation on vm-a.
+	_, releaseA, ok := a.acquire()
+	require.True(t, ok)
+	defer releaseA()
+
+	// Concurrent operations on both VMs proceed, and vm-b closes without
+	// waiting for vm-a.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			vm, release, ok := a.acquire()
+			if assert.True(t, ok) {
+				assert.Equal(t, "vm-a", vm.ID())
+				release()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			vm, release, ok := b.acquire()
+			if assert.True(t, ok) {
+				assert.Equal(t, "vm-b", vm.ID())
+				release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	done := make(chan error, 1)
+	go func() { done <- b.close(func(VM) error { return nil }) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("closing vm-b waited for an operation on vm-a")
+	}
+}
@@ -0,0 +1,139 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/image"
+)
+
+// CommitOptions configures Commit.
+type CommitOptions struct {
+	// WorkspaceDest copies the workspace (and the mounts under it) into the
+	// committed image at this guest path. Empty leaves the workspace out.
+	// It cannot be the workspace path itself: the workspace is mounted
+	// over that directory at boot, which would hide the copied files.
+	WorkspaceDest string
+}
+
+// commit captures the VM's rootfs into the local image store under tag, so
+// it can be booted again with --image tag. The guest is synced first, but
+// the disk is copied while the VM keeps running, so the copy is only
+// crash-consistent; e2fsck replays the journal on the copy before it is
+// stored. The image config the sandbox booted with is recorded with it.
+func (s *Sandbox) commit(ctx context.Context, tag string, opts CommitOptions, copyFn func(src, dst string) error) (*image.BuildResult, error) {
+	if tag == "" {
+		return nil, errx.With(ErrCommit, ": tag is required")
+	}
+	if s.config.SharedRootfs {
+		return nil, ErrCommitSharedRootfs
+	}
+	if opts.WorkspaceDest != "" {
+		dest := path.Clean(opts.WorkspaceDest)
+		if !path.IsAbs(dest) || dest == "/" || dest == path.Clean(s.config.GetWorkspace()) {
+			return nil, errx.With(ErrCommit, ": invalid workspace destination %q", opts.WorkspaceDest)
+		}
+		opts.WorkspaceDest = dest
+	}
+
+	result, err := s.Exec(ctx, "sync", nil)
+	if err != nil {
+		return nil, errx.With(ErrCommit, ": sync guest: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, errx.With(ErrCommit, ": sync guest exited %d: %s", result.ExitCode, result.Stderr)
+	}
+
+	stateDir := s.stateMgr.Dir(s.id)
+	tmp, err := os.CreateTemp(stateDir, "commit-*.ext4")
+	if err != nil {
+		return nil, errx.Wrap(ErrCommit, err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := copyFn(filepath.Join(stateDir, "rootfs.ext4"), tmpPath); err != nil {
+		return nil, errx.With(ErrCommit, ": copy rootfs: %w", err)
+	}
+	if err := fsckRootfs(tmpPath); err != nil {
+		return nil, errx.Wrap(ErrCommit, err)
+	}
+	// The interception CA belongs to this sandbox; a VM booted from the
+	// committed image gets its own.
+	if err := removeFromRootfs(tmpPath, caCertGuestPath); err != nil {
+		return nil, errx.Wrap(ErrCommit, err)
+	}
+
+	if opts.WorkspaceDest != "" {
+		if err := s.commitWorkspace(tmpPath, stateDir, opts.WorkspaceDest); err != nil {
+			return nil, err
+		}
+	}
+
+	store := image.NewStore("")
+	meta := image.ImageMeta{
+		Source: "commit:" + s.id,
+		OCI:    ociConfigFromImageConfig(s.config.ImageCfg),
+	}
+	if err := store.Save(tag, tmpPath, meta); err != nil {
+		return nil, errx.Wrap(ErrCommit, err)
+	}
+	return store.Get(tag)
+}
+
+// commitWorkspace copies the workspace into rootfsPath at dest. Secret
+// files are skipped: a file_raw secret holds the real value, which must not
+// end up in an image.
+func (s *Sandbox) commitWorkspace(rootfsPath, stateDir, dest string) error {
+	exportDir, err := os.MkdirTemp(stateDir, "commit-workspace-*")
+	if err != nil {
+		return errx.Wrap(ErrCommit, err)
+	}
+	defer os.RemoveAll(exportDir)
+	if err := exportPath(s.vfsRoot, s.config.GetWorkspace(), exportDir, s.secretFiles); err != nil {
+		return errx.Wrap(ErrCommit, err)
+	}
+	if err := injectDirIntoRootfs(rootfsPath, exportDir, dest, 0, 0); err != nil {
+		return errx.Wrap(ErrCommit, err)
+	}
+	return nil
+}
+
+func ociConfigFromImageConfig(cfg *api.ImageConfig) *image.OCIConfig {
+	if cfg == nil {
+		return nil
+	}
+	return &image.OCIConfig{
+		User:         cfg.User,
+		WorkingDir:   cfg.WorkingDir,
+		Entrypoint:   cfg.Entrypoint,
+		Cmd:          cfg.Cmd,
+		Env:          cfg.Env,
+		ExposedPorts: cfg.ExposedPorts,
+	}
+}
+
+// fsckRootfs repairs an ext4 image copied from a running VM. e2fsck exits
+// 1 or 2 when it corrected something, which is expected here.
+func fsckRootfs(rootfsPath string) error {
+	e2fsckPath, err := exec.LookPath("e2fsck")
+	if err != nil {
+		return errx.With(ErrE2fsck, ": e2fsck not found; install e2fsprogs")
+	}
+	out, err := exec.Command(e2fsckPath, "-fy", rootfsPath).CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() < 4 {
+		return nil
+	}
+	if err != nil {
+		return errx.With(ErrE2fsck, ": %w: %s", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package sandbox
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+	"github.com/jingkaihe/matchlock/pkg/vfs"
+)
+
+func TestCommitWorkspaceSkipsRawSecretFile(t *testing.T) {
+	if !hasDebugfs() || !hasMkfsExt4() {
+		t.Skip("debugfs or mkfs.ext4 not available")
+	}
+
+	config := &api.Config{
+		VFS: &api.VFSConfig{Workspace: "/workspace"},
+		Network: &api.NetworkConfig{
+			Secrets: map[string]api.Secret{
+				"DEPLOY_KEY": {Value: "raw-key", File: "/workspace/.ssh/id", FileRaw: true},
+			},
+		},
+	}
+	policy.NewEngine(config.Network)
+	providers, err := buildVFSProviders(config, "/workspace")
+	require.NoError(t, err)
+	secretFiles := addSecretFileMounts(providers, config)
+	s := &Sandbox{config: config, vfsRoot: vfs.NewMountRouter(providers), secretFiles: secretFiles}
+	require.NoError(t, writeFile(s.vfsRoot, "/workspace/main.go", []byte("package main\n"), 0644))
+
+	rootfs := createTestExt4(t, 10)
+	require.NoError(t, s.commitWorkspace(rootfs, t.TempDir(), "/app"))
+
+	assert.Equal(t, "package main\n", debugfsCat(t, rootfs, "/app/main.go"))
+	out, err := exec.Command("debugfs", "-R", "stat /app/.ssh/id", rootfs).CombinedOutput()
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "File not found")
+	assert.NotContains(t, string(out), "raw-key")
+}
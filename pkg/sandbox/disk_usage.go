@@ -0,0 +1,56 @@
+package sandbox
+
+import (
+	"context"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vfs"
+	"github.com/jingkaihe/matchlock/pkg/vm"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+)
+
+// DiskUsage reports space usage for the rootfs, each extra disk and the
+// workspace. The workspace has no fixed size, so only its used bytes (the
+// files held by the host-side VFS provider) are reported.
+func (s *Sandbox) DiskUsage(ctx context.Context) ([]api.DiskUsage, error) {
+	dialer, ok := s.machine.(vm.VsockDialer)
+	if !ok {
+		return nil, ErrNoVsockDialer
+	}
+
+	paths := []string{"/"}
+	for _, disk := range s.config.ExtraDisks {
+		paths = append(paths, disk.GuestMount)
+	}
+
+	conn, err := dialer.DialVsock(s.vsockPorts.Port(vsock.ServiceExec))
+	if err != nil {
+		return nil, errx.Wrap(ErrDiskUsage, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	usage, err := vsock.QueryDiskUsage(conn, paths)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrDiskUsage, err)
+	}
+	for i := range usage {
+		usage[i].Kind = api.DiskUsageDisk
+		if usage[i].Path == "/" {
+			usage[i].Kind = api.DiskUsageRootfs
+		}
+	}
+
+	workspace := api.DiskUsage{Path: s.config.GetWorkspace(), Kind: api.DiskUsageWorkspace}
+	if used, err := vfs.Usage(s.vfsRoot, workspace.Path); err != nil {
+		workspace.Error = err.Error()
+	} else {
+		workspace.UsedBytes = uint64(used)
+	}
+	return append(usage, workspace), nil
+}
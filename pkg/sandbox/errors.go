@@ -12,51 +12,93 @@ var (
 	ErrRelayDecode     = errors.New("decode exec result")
 	ErrRelayListen     = errors.New("listen on relay socket")
 	ErrRelayProxy      = errors.New("relay port-forward proxy")
+	ErrRelayFile       = errors.New("relay file operation")
 
 	// Rootfs errors
-	ErrGuestAgent   = errors.New("guest-agent not found")
-	ErrGuestFused   = errors.New("guest-fused not found")
-	ErrGuestInit    = errors.New("guest-init not found")
-	ErrResizeRootfs = errors.New("resize rootfs")
-	ErrCreateTemp   = errors.New("create temp file")
-	ErrWriteTemp    = errors.New("write temp file")
-	ErrDebugfs      = errors.New("debugfs")
-	ErrStatRootfs   = errors.New("stat rootfs")
-	ErrTruncate     = errors.New("truncate rootfs")
-	ErrResize2fs    = errors.New("resize2fs")
+	ErrGuestAgent       = errors.New("guest-agent not found")
+	ErrGuestFused       = errors.New("guest-fused not found")
+	ErrGuestInit        = errors.New("guest-init not found")
+	ErrResizeRootfs     = errors.New("resize rootfs")
+	ErrCreateTemp       = errors.New("create temp file")
+	ErrWriteTemp        = errors.New("write temp file")
+	ErrDebugfs          = errors.New("debugfs")
+	ErrStatRootfs       = errors.New("stat rootfs")
+	ErrTruncate         = errors.New("truncate rootfs")
+	ErrResize2fs        = errors.New("resize2fs")
+	ErrE2fsck           = errors.New("e2fsck")
+	ErrUnsafeRootfsPath = errors.New("unsafe rootfs path")
+	ErrRootfsCorrupt    = errors.New("rootfs corrupt")
 
 	// Sandbox lifecycle errors (shared between darwin and linux)
-	ErrRegisterState         = errors.New("register VM state")
-	ErrAllocateSubnet        = errors.New("allocate subnet")
-	ErrCreateCAPool          = errors.New("create CA pool")
-	ErrCopyRootfs            = errors.New("copy rootfs")
-	ErrPrepareRootfs         = errors.New("prepare rootfs")
-	ErrInjectCACert          = errors.New("inject CA cert into rootfs")
-	ErrInvalidDiskCfg        = errors.New("invalid extra disk config")
-	ErrCreateVM              = errors.New("create VM")
-	ErrCreateProxy           = errors.New("create transparent proxy")
-	ErrFirewallSetup         = errors.New("setup firewall rules")
-	ErrNetworkStack          = errors.New("create network stack")
-	ErrVFSListener           = errors.New("setup VFS listener")
-	ErrVFSServer             = errors.New("start VFS server")
-	ErrMachineClose          = errors.New("machine close")
-	ErrPrepareOverlayMount   = errors.New("prepare overlay mount snapshot")
-	ErrCopyOverlaySource     = errors.New("copy overlay mount source")
-	ErrRemoveOverlaySnapshot = errors.New("remove overlay mount snapshot")
-	ErrFirewallCleanup       = errors.New("firewall cleanup")
-	ErrNATCleanup            = errors.New("NAT cleanup")
-	ErrNetworkFile           = errors.New("get network file")
-	ErrReleaseSubnet         = errors.New("release subnet")
-	ErrUnregisterState       = errors.New("unregister VM state")
-	ErrRemoveRootfs          = errors.New("remove rootfs copy")
-	ErrProxyClose            = errors.New("proxy close")
-	ErrLifecycleInit         = errors.New("initialize lifecycle record")
-	ErrLifecycleUpdate       = errors.New("update lifecycle record")
-	ErrPortForwardDial       = errors.New("dial guest port-forward service")
-	ErrPortForwardInit       = errors.New("initialize guest port-forward")
-	ErrPortForwardBind       = errors.New("bind local port-forward listener")
-	ErrPortForwardCopy       = errors.New("proxy port-forward stream")
-	ErrNoVsockDialer         = errors.New("vm backend does not support vsock dial")
+	ErrRegisterState          = errors.New("register VM state")
+	ErrAllocateSubnet         = errors.New("allocate subnet")
+	ErrCreateCAPool           = errors.New("create CA pool")
+	ErrCopyRootfs             = errors.New("copy rootfs")
+	ErrPrepareRootfs          = errors.New("prepare rootfs")
+	ErrInjectCACert           = errors.New("inject CA cert into rootfs")
+	ErrKernelModules          = errors.New("kernel modules")
+	ErrKernelModulesDarwin    = errors.New("kernel modules are only supported on Linux hosts")
+	ErrCPUAffinityDarwin      = errors.New("CPU affinity is only supported on Linux hosts")
+	ErrCgroupParentDarwin     = errors.New("cgroup parent is only supported on Linux hosts")
+	ErrSharedBridgeDarwin     = errors.New("shared bridge networking is only supported on Linux hosts")
+	ErrInitCommand            = errors.New("init command")
+	ErrSharedRootfs           = errors.New("prepare shared rootfs")
+	ErrCreateRootfsOverlay    = errors.New("create rootfs overlay disk")
+	ErrInvalidDiskCfg         = errors.New("invalid extra disk config")
+	ErrInvalidCapabilities    = errors.New("invalid capability config")
+	ErrCreateVM               = errors.New("create VM")
+	ErrCreateProxy            = errors.New("create transparent proxy")
+	ErrFirewallSetup          = errors.New("setup firewall rules")
+	ErrNetworkStack           = errors.New("create network stack")
+	ErrVFSListener            = errors.New("setup VFS listener")
+	ErrVFSServer              = errors.New("start VFS server")
+	ErrSyscallAuditListener   = errors.New("setup seccomp audit listener")
+	ErrPolicyQueryListener    = errors.New("setup policy query listener")
+	ErrSocketMountListener    = errors.New("setup socket mount listener")
+	ErrReadEventLog           = errors.New("read event log")
+	ErrReadLog                = errors.New("read VM log")
+	ErrMachineClose           = errors.New("machine close")
+	ErrPrepareOverlayMount    = errors.New("prepare overlay mount snapshot")
+	ErrBuildVFSProvider       = errors.New("build vfs mount")
+	ErrCopyOverlaySource      = errors.New("copy overlay mount source")
+	ErrRemoveOverlaySnapshot  = errors.New("remove overlay mount snapshot")
+	ErrFirewallCleanup        = errors.New("firewall cleanup")
+	ErrNATSetup               = errors.New("NAT setup")
+	ErrNATCleanup             = errors.New("NAT cleanup")
+	ErrNetworkFile            = errors.New("get network file")
+	ErrReleaseSubnet          = errors.New("release subnet")
+	ErrUnregisterState        = errors.New("unregister VM state")
+	ErrRemoveRootfs           = errors.New("remove rootfs copy")
+	ErrProxyClose             = errors.New("proxy close")
+	ErrLifecycleInit          = errors.New("initialize lifecycle record")
+	ErrLifecycleUpdate        = errors.New("update lifecycle record")
+	ErrPortForwardDial        = errors.New("dial guest port-forward service")
+	ErrPortForwardInit        = errors.New("initialize guest port-forward")
+	ErrPortForwardBind        = errors.New("bind local port-forward listener")
+	ErrPortForwardCopy        = errors.New("proxy port-forward stream")
+	ErrGuestPortNotReady      = errors.New("guest port not ready")
+	ErrNoVsockDialer          = errors.New("vm backend does not support vsock dial")
+	ErrInteractiveUnsupported = errors.New("vm backend does not support interactive exec")
+	ErrSnapshotUnsupported    = errors.New("workspace provider does not support snapshots")
+	ErrRestoreWorkspace       = errors.New("restore workspace snapshot")
+	ErrExport                 = errors.New("export sandbox files")
+	ErrDiskUsage              = errors.New("read guest disk usage")
+	ErrStats                  = errors.New("read sandbox stats")
+	ErrTailFile               = errors.New("tail guest file")
+	ErrGuestEnv               = errors.New("read guest environment")
+	ErrInvalidReadRange       = errors.New("invalid read range")
+	ErrCommit                 = errors.New("commit sandbox image")
+	ErrCommitSharedRootfs     = errors.New("cannot commit a sandbox booted with shared_rootfs")
+	ErrVMSnapshot             = errors.New("VM snapshot")
+	ErrVMSnapshotNotFound     = errors.New("VM snapshot not found")
+	ErrVMSnapshotUnsupported  = errors.New("vm backend does not support VM snapshots")
+	ErrSharedBridgeSnapshot   = errors.New("VM snapshots are not supported on the shared bridge")
+	ErrVMSnapshotMismatch     = errors.New("VM snapshot does not match this host")
+
+	// Privilege errors (linux only)
+	ErrReadCapabilities = errors.New("read process capabilities")
+	ErrMissingNetAdmin  = errors.New("missing CAP_NET_ADMIN")
+	ErrDropPrivileges   = errors.New("drop privileges")
 
 	// copyRootfs errors (linux only)
 	ErrOpenSource = errors.New("open source")
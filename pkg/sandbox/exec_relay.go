@@ -14,6 +14,7 @@ import (
 	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/api"
 	"github.com/jingkaihe/matchlock/pkg/vm"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
 )
 
 const (
@@ -26,6 +27,9 @@ const (
 	relayMsgExit            uint8 = 7
 	relayMsgExecPipe        uint8 = 8
 	relayMsgPortForward     uint8 = 9
+	relayMsgDiskUsage       uint8 = 10
+	relayMsgFile            uint8 = 11
+	relayMsgStats           uint8 = 12
 )
 
 type relayExecRequest struct {
@@ -46,6 +50,16 @@ type relayPortForwardRequest struct {
 	RemotePort int `json:"remote_port"`
 }
 
+type relayDiskUsageResult struct {
+	Disks []api.DiskUsage `json:"disks,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type relayStatsResult struct {
+	Stats *api.Stats `json:"stats,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
 type relayExecResult struct {
 	ExitCode int    `json:"exit_code"`
 	Stdout   []byte `json:"stdout,omitempty"`
@@ -119,6 +133,12 @@ func (r *ExecRelay) handleConn(conn net.Conn) {
 		r.handleExecPipe(conn, data)
 	case relayMsgPortForward:
 		r.handlePortForward(conn, data)
+	case relayMsgDiskUsage:
+		r.handleDiskUsage(conn)
+	case relayMsgFile:
+		r.handleFile(conn, data)
+	case relayMsgStats:
+		r.handleStats(conn)
 	}
 }
 
@@ -167,25 +187,27 @@ func (r *ExecRelay) handleExecInteractive(conn net.Conn, data []byte) {
 		return
 	}
 
-	interactiveMachine, ok := r.sb.Machine().(vm.InteractiveMachine)
-	if !ok {
+	if _, ok := r.sb.Machine().(vm.InteractiveMachine); !ok {
 		sendRelayMsg(conn, relayMsgExit, []byte{0, 0, 0, 1})
 		return
 	}
 
-	opts := r.sb.PrepareExecEnv()
-	if req.WorkingDir != "" {
-		opts.WorkingDir = req.WorkingDir
-	}
-	if req.User != "" {
-		opts.User = req.User
+	opts := &api.ExecOptions{
+		WorkingDir: req.WorkingDir,
+		User:       req.User,
 	}
 
 	stdinReader, stdinWriter := io.Pipe()
 	stdoutWriter := &relayWriter{conn: conn, msgType: relayMsgStdout}
 
+	// Cancel the session when the relay client disconnects, so a detached
+	// `matchlock exec -it` does not leave its command running in the guest.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Read stdin from relay client and write to pipe
 	go func() {
+		defer cancel()
 		defer stdinWriter.Close()
 		for {
 			msgType, data, err := readRelayMsg(conn)
@@ -200,8 +222,8 @@ func (r *ExecRelay) handleExecInteractive(conn net.Conn, data []byte) {
 
 	resizeCh := make(chan [2]uint16, 1)
 
-	exitCode, err := interactiveMachine.ExecInteractive(
-		context.Background(), req.Command, opts,
+	exitCode, err := r.sb.ExecInteractive(
+		ctx, req.Command, opts,
 		req.Rows, req.Cols,
 		stdinReader, stdoutWriter, resizeCh,
 	)
@@ -241,6 +263,8 @@ func (r *ExecRelay) handleExecPipe(conn net.Conn, data []byte) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// An empty stdin message half-closes stdin; keep reading afterwards so a
+	// client disconnect still cancels the exec.
 	go func() {
 		defer stdinWriter.Close()
 		for {
@@ -251,7 +275,8 @@ func (r *ExecRelay) handleExecPipe(conn net.Conn, data []byte) {
 			}
 			if msgType == relayMsgStdin {
 				if len(msgData) == 0 {
-					return
+					stdinWriter.Close()
+					continue
 				}
 				stdinWriter.Write(msgData)
 			}
@@ -328,6 +353,28 @@ func (r *ExecRelay) handlePortForward(conn net.Conn, data []byte) {
 	}
 }
 
+func (r *ExecRelay) handleDiskUsage(conn net.Conn) {
+	var result relayDiskUsageResult
+	disks, err := r.sb.DiskUsage(context.Background())
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Disks = disks
+	data, _ := json.Marshal(result)
+	_ = sendRelayMsg(conn, relayMsgDiskUsage, data)
+}
+
+func (r *ExecRelay) handleStats(conn net.Conn) {
+	var result relayStatsResult
+	stats, err := r.sb.Stats(context.Background())
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Stats = stats
+	data, _ := json.Marshal(result)
+	_ = sendRelayMsg(conn, relayMsgStats, data)
+}
+
 // relayWriter forwards writes to the relay connection as messages.
 type relayWriter struct {
 	conn    net.Conn
@@ -362,19 +409,10 @@ func readRelayMsg(conn net.Conn) (uint8, []byte, error) {
 	return msgType, data, nil
 }
 
+// sendRelayMsg writes one framed message in a single Write so concurrent
+// relay sessions' writers cannot interleave frames.
 func sendRelayMsg(conn net.Conn, msgType uint8, data []byte) error {
-	header := make([]byte, 5)
-	header[0] = msgType
-	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
-	if _, err := conn.Write(header); err != nil {
-		return err
-	}
-	if len(data) > 0 {
-		if _, err := conn.Write(data); err != nil {
-			return err
-		}
-	}
-	return nil
+	return vsock.SendMessage(conn, msgType, data)
 }
 
 func sendRelayResult(conn net.Conn, result *relayExecResult) {
@@ -449,6 +487,82 @@ func ExecViaRelay(ctx context.Context, socketPath, command, workingDir, user str
 	}, nil
 }
 
+// DiskUsageViaRelay connects to an exec relay socket and reports the
+// sandbox's disk usage (see Sandbox.DiskUsage).
+func DiskUsageViaRelay(ctx context.Context, socketPath string) ([]api.DiskUsage, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, errx.Wrap(ErrRelayConnect, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := sendRelayMsg(conn, relayMsgDiskUsage, nil); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrRelaySend, err)
+	}
+	msgType, data, err := readRelayMsg(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrRelayRead, err)
+	}
+	if msgType != relayMsgDiskUsage {
+		return nil, errx.With(ErrRelayUnexpected, ": %d", msgType)
+	}
+
+	var result relayDiskUsageResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errx.Wrap(ErrRelayDecode, err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("%s", result.Error)
+	}
+	return result.Disks, nil
+}
+
+// StatsViaRelay connects to an exec relay socket and samples the sandbox's
+// resource usage (see Sandbox.Stats).
+func StatsViaRelay(ctx context.Context, socketPath string) (*api.Stats, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, errx.Wrap(ErrRelayConnect, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := sendRelayMsg(conn, relayMsgStats, nil); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrRelaySend, err)
+	}
+	msgType, data, err := readRelayMsg(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrRelayRead, err)
+	}
+	if msgType != relayMsgStats {
+		return nil, errx.With(ErrRelayUnexpected, ": %d", msgType)
+	}
+
+	var result relayStatsResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errx.Wrap(ErrRelayDecode, err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("%s", result.Error)
+	}
+	return result.Stats, nil
+}
+
 // ExecInteractiveViaRelay connects to an exec relay socket and runs an interactive command.
 func ExecInteractiveViaRelay(ctx context.Context, socketPath, command, workingDir, user string, rows, cols uint16, stdin io.Reader, stdout io.Writer) (int, error) {
 	conn, err := net.Dial("unix", socketPath)
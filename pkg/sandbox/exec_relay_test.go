@@ -1,15 +1,18 @@
 package sandbox
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"io"
 	"net"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/jingkaihe/matchlock/pkg/api"
 	"github.com/jingkaihe/matchlock/pkg/vm"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -92,9 +95,92 @@ func (m *fakeInteractiveMachine) Close(ctx context.Context) error {
 }
 func (m *fakeInteractiveMachine) RootfsPath() string { return "" }
 
+// echoTTYMachine answers each interactive session with its command name
+// and first stdin chunk once every expected session has started, so the
+// sessions only finish if they run side by side.
+type echoTTYMachine struct {
+	fakeInteractiveMachine
+	started     sync.WaitGroup
+	ctxCanceled chan struct{}
+}
+
+func (m *echoTTYMachine) ExecInteractive(ctx context.Context, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error) {
+	m.started.Done()
+	m.started.Wait()
+	buf := make([]byte, 64)
+	n, err := stdin.Read(buf)
+	if err != nil {
+		<-ctx.Done()
+		close(m.ctxCanceled)
+		return 1, ctx.Err()
+	}
+	stdout.Write([]byte(command + ":" + string(buf[:n])))
+	return len(command), nil
+}
+
+func TestExecRelayInteractiveSessionsRunConcurrently(t *testing.T) {
+	machine := &echoTTYMachine{}
+	machine.started.Add(2)
+	sb := &Sandbox{config: &api.Config{}, machine: machine, events: newEventRecorder(0)}
+	relay := NewExecRelay(sb)
+	socketPath := t.TempDir() + "/exec.sock"
+	require.NoError(t, relay.Start(socketPath))
+	defer relay.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, command := range []string{"sh", "htop"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var stdout bytes.Buffer
+			exitCode, err := ExecInteractiveViaRelay(ctx, socketPath, command, "", "", 24, 80, bytes.NewReader([]byte("q")), &stdout)
+			assert.NoError(t, err)
+			assert.Equal(t, len(command), exitCode)
+			assert.Equal(t, command+":q", stdout.String())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExecRelayInteractiveDisconnectCancels(t *testing.T) {
+	machine := &echoTTYMachine{ctxCanceled: make(chan struct{})}
+	machine.started.Add(1)
+	sb := &Sandbox{config: &api.Config{}, machine: machine, events: newEventRecorder(0)}
+	relay := NewExecRelay(sb)
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+
+	reqData, err := json.Marshal(relayExecInteractiveRequest{Command: "htop", Rows: 24, Cols: 80})
+	require.NoError(t, err, "marshal request")
+
+	done := make(chan struct{})
+	go func() {
+		relay.handleExecInteractive(serverConn, reqData)
+		close(done)
+	}()
+
+	require.NoError(t, clientConn.Close(), "close client conn")
+
+	select {
+	case <-machine.ctxCanceled:
+	case <-time.After(1 * time.Second):
+		require.Fail(t, "expected context cancellation on disconnect")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		require.Fail(t, "timed out waiting for relay")
+	}
+}
+
 func TestExecRelayPipeStdinEOFDoesNotCancel(t *testing.T) {
 	machine := newFakeMachine()
-	sb := &Sandbox{config: &api.Config{}, machine: machine}
+	sb := &Sandbox{config: &api.Config{}, machine: machine, events: newEventRecorder(0)}
 	relay := NewExecRelay(sb)
 
 	serverConn, clientConn := net.Pipe()
@@ -150,7 +236,7 @@ func TestExecRelayPipeStdinEOFDoesNotCancel(t *testing.T) {
 
 func TestExecRelayPipeDisconnectCancels(t *testing.T) {
 	machine := newFakeMachine()
-	sb := &Sandbox{config: &api.Config{}, machine: machine}
+	sb := &Sandbox{config: &api.Config{}, machine: machine, events: newEventRecorder(0)}
 	relay := NewExecRelay(sb)
 
 	serverConn, clientConn := net.Pipe()
@@ -182,9 +268,44 @@ func TestExecRelayPipeDisconnectCancels(t *testing.T) {
 	}
 }
 
+func TestExecRelayPipeDisconnectAfterStdinEOFCancels(t *testing.T) {
+	machine := newFakeMachine()
+	sb := &Sandbox{config: &api.Config{}, machine: machine, events: newEventRecorder(0)}
+	relay := NewExecRelay(sb)
+
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+
+	reqData, err := json.Marshal(relayExecRequest{Command: "noop"})
+	require.NoError(t, err, "marshal request")
+
+	done := make(chan struct{})
+	go func() {
+		relay.handleExecPipe(serverConn, reqData)
+		close(done)
+	}()
+
+	<-machine.execStarted
+
+	require.NoError(t, sendRelayMsg(clientConn, relayMsgStdin, nil), "send stdin EOF")
+	require.NoError(t, clientConn.Close(), "close client conn")
+
+	select {
+	case <-machine.ctxCanceled:
+	case <-time.After(1 * time.Second):
+		require.Fail(t, "expected context cancellation on disconnect after stdin EOF")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(1 * time.Second):
+		require.Fail(t, "timed out waiting for relay")
+	}
+}
+
 func TestExecRelayInteractiveDisconnectClosesStdin(t *testing.T) {
 	machine := newFakeInteractiveMachine()
-	sb := &Sandbox{config: &api.Config{}, machine: machine}
+	sb := &Sandbox{config: &api.Config{}, machine: machine, events: newEventRecorder(0)}
 	relay := NewExecRelay(sb)
 
 	serverConn, clientConn := net.Pipe()
@@ -0,0 +1,130 @@
+package sandbox
+
+import (
+	"io"
+	"os"
+	"path"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/vfs"
+)
+
+// exporter copies guest entries into a host directory. Host writes go
+// through an os.Root so a symlink exported earlier (guest content) cannot
+// redirect a later write outside the directory.
+type exporter struct {
+	vfsRoot vfs.Provider
+	host    *os.Root
+	skip    map[string]struct{}
+}
+
+// exportPath copies guestPath out of the sandbox VFS into hostDir, which is
+// created if needed. A directory's contents are copied into hostDir; a file
+// is copied to hostDir/<name>. Permission bits and symlinks are preserved.
+// Guest paths in skip (the sandbox's secret files) are left out.
+func exportPath(vfsRoot vfs.Provider, guestPath, hostDir string, skip map[string]struct{}) error {
+	guestPath = path.Clean(guestPath)
+	info, err := vfsRoot.Stat(guestPath)
+	if err != nil {
+		return errx.With(ErrExport, " %s: %w", guestPath, err)
+	}
+	if err := os.MkdirAll(hostDir, 0755); err != nil {
+		return errx.With(ErrExport, ": %w", err)
+	}
+	host, err := os.OpenRoot(hostDir)
+	if err != nil {
+		return errx.With(ErrExport, ": %w", err)
+	}
+	defer host.Close()
+
+	e := &exporter{vfsRoot: vfsRoot, host: host, skip: skip}
+	if !info.IsDir() {
+		return e.entry(guestPath, path.Base(guestPath), info.Mode())
+	}
+	return e.dir(guestPath, ".")
+}
+
+func (e *exporter) dir(guestDir, hostName string) error {
+	entries, err := e.vfsRoot.ReadDir(guestDir)
+	if err != nil {
+		return errx.With(ErrExport, " %s: %w", guestDir, err)
+	}
+	for _, d := range entries {
+		info, err := d.Info()
+		if err != nil {
+			return errx.With(ErrExport, " %s: %w", path.Join(guestDir, d.Name()), err)
+		}
+		if err := e.entry(path.Join(guestDir, d.Name()), path.Join(hostName, d.Name()), info.Mode()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *exporter) entry(guestPath, hostName string, mode os.FileMode) error {
+	if _, ok := e.skip[guestPath]; ok {
+		return nil
+	}
+	switch {
+	case mode&os.ModeSymlink != 0:
+		target, err := e.vfsRoot.Readlink(guestPath)
+		if err != nil {
+			return errx.With(ErrExport, " %s: %w", guestPath, err)
+		}
+		_ = e.host.Remove(hostName)
+		if err := e.host.Symlink(target, hostName); err != nil {
+			return errx.With(ErrExport, ": %w", err)
+		}
+		return nil
+	case mode.IsDir():
+		if err := e.refuseSymlink(hostName); err != nil {
+			return err
+		}
+		if err := e.host.MkdirAll(hostName, mode.Perm()|0700); err != nil {
+			return errx.With(ErrExport, ": %w", err)
+		}
+		return e.dir(guestPath, hostName)
+	case mode.IsRegular():
+		return e.file(guestPath, hostName, mode.Perm())
+	default:
+		// Devices, sockets and FIFOs have no meaningful host copy.
+		return nil
+	}
+}
+
+func (e *exporter) file(guestPath, hostName string, perm os.FileMode) error {
+	if err := e.refuseSymlink(hostName); err != nil {
+		return err
+	}
+	src, err := e.vfsRoot.Open(guestPath, os.O_RDONLY, 0)
+	if err != nil {
+		return errx.With(ErrExport, " %s: %w", guestPath, err)
+	}
+	defer src.Close()
+
+	dst, err := e.host.OpenFile(hostName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return errx.With(ErrExport, ": %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return errx.With(ErrExport, " %s: %w", guestPath, err)
+	}
+	if err := dst.Close(); err != nil {
+		return errx.With(ErrExport, ": %w", err)
+	}
+	if err := e.host.Chmod(hostName, perm); err != nil {
+		return errx.With(ErrExport, ": %w", err)
+	}
+	return nil
+}
+
+// refuseSymlink fails when hostName is already a symlink, which a previous
+// export of guest content may have left there.
+func (e *exporter) refuseSymlink(hostName string) error {
+	info, err := e.host.Lstat(hostName)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return errx.With(ErrExport, ": %s is a symlink on the host", hostName)
+	}
+	return nil
+}
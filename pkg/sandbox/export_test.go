@@ -0,0 +1,91 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/vfs"
+)
+
+func TestExportPathCopiesDirectoryContents(t *testing.T) {
+	fs := vfs.NewMemoryProvider()
+	require.NoError(t, fs.MkdirAll("/workspace/out/nested", 0755))
+	require.NoError(t, fs.WriteFile("/workspace/out/result.txt", []byte("done"), 0644))
+	require.NoError(t, fs.WriteFile("/workspace/out/nested/run.sh", []byte("#!/bin/sh"), 0755))
+
+	hostDir := filepath.Join(t.TempDir(), "out")
+	require.NoError(t, exportPath(fs, "/workspace/out", hostDir, nil))
+
+	data, err := os.ReadFile(filepath.Join(hostDir, "result.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "done", string(data))
+
+	info, err := os.Stat(filepath.Join(hostDir, "nested", "run.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+}
+
+func TestExportPathCopiesSingleFile(t *testing.T) {
+	fs := vfs.NewMemoryProvider()
+	require.NoError(t, fs.MkdirAll("/workspace", 0755))
+	require.NoError(t, fs.WriteFile("/workspace/report.json", []byte("{}"), 0600))
+
+	hostDir := t.TempDir()
+	require.NoError(t, exportPath(fs, "/workspace/report.json", hostDir, nil))
+
+	data, err := os.ReadFile(filepath.Join(hostDir, "report.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+}
+
+func TestExportPathMissing(t *testing.T) {
+	err := exportPath(vfs.NewMemoryProvider(), "/workspace/missing", t.TempDir(), nil)
+	require.ErrorIs(t, err, ErrExport)
+}
+
+func TestExportPathSkipsSecretFiles(t *testing.T) {
+	fs := vfs.NewMemoryProvider()
+	require.NoError(t, fs.MkdirAll("/workspace", 0755))
+	require.NoError(t, fs.WriteFile("/workspace/keep.txt", []byte("keep"), 0644))
+	require.NoError(t, fs.WriteFile("/workspace/token", []byte("secret"), 0444))
+
+	hostDir := t.TempDir()
+	require.NoError(t, exportPath(fs, "/workspace", hostDir, map[string]struct{}{"/workspace/token": {}}))
+
+	assert.FileExists(t, filepath.Join(hostDir, "keep.txt"))
+	assert.NoFileExists(t, filepath.Join(hostDir, "token"))
+}
+
+func TestExportPathDoesNotWriteThroughExportedSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "victim"), []byte("original"), 0644))
+
+	fs := vfs.NewMemoryProvider()
+	require.NoError(t, fs.MkdirAll("/workspace", 0755))
+	require.NoError(t, fs.Symlink(filepath.Join(outside, "victim"), "/workspace/file"))
+	require.NoError(t, fs.Symlink(outside, "/workspace/dir"))
+
+	hostDir := t.TempDir()
+	require.NoError(t, exportPath(fs, "/workspace", hostDir, nil))
+
+	// The guest swaps the symlinks for real entries before the next export.
+	require.NoError(t, fs.Remove("/workspace/file"))
+	require.NoError(t, fs.WriteFile("/workspace/file", []byte("pwned"), 0644))
+	err := exportPath(fs, "/workspace", hostDir, nil)
+	require.ErrorIs(t, err, ErrExport)
+
+	require.NoError(t, fs.Remove("/workspace/file"))
+	require.NoError(t, fs.Remove("/workspace/dir"))
+	require.NoError(t, fs.MkdirAll("/workspace/dir", 0755))
+	require.NoError(t, fs.WriteFile("/workspace/dir/victim", []byte("pwned"), 0644))
+	err = exportPath(fs, "/workspace", hostDir, nil)
+	require.ErrorIs(t, err, ErrExport)
+
+	data, err := os.ReadFile(filepath.Join(outside, "victim"))
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data))
+}
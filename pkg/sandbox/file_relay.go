@@ -0,0 +1,227 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vfs"
+)
+
+// Relay file operations, used by `matchlock cp`. They act on the sandbox VFS
+// (the workspace and its mounts), like the read_file/write_file/list_files
+// RPC methods.
+const (
+	relayFileStat     = "stat"  // stat path, following symlinks
+	relayFileLstat    = "lstat" // stat path without following a final symlink
+	relayFileList     = "list"
+	relayFileRead     = "read"
+	relayFileReadlink = "readlink"
+	relayFileWrite    = "write"
+	relayFileMkdir    = "mkdir"
+	relayFileSymlink  = "symlink"
+)
+
+type relayFileRequest struct {
+	Op      string `json:"op"`
+	Path    string `json:"path"`
+	Mode    uint32 `json:"mode,omitempty"`
+	Content []byte `json:"content,omitempty"`
+	Target  string `json:"target,omitempty"`
+}
+
+type relayFileResult struct {
+	Info    *api.FileInfo  `json:"info,omitempty"`
+	Files   []api.FileInfo `json:"files,omitempty"`
+	Content []byte         `json:"content,omitempty"`
+	Target  string         `json:"target,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+func (r *ExecRelay) handleFile(conn net.Conn, data []byte) {
+	var result relayFileResult
+	var req relayFileRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		result.Error = err.Error()
+	} else if err := relayFileOp(r.sb.vfsRoot, &req, &result); err != nil {
+		result.Error = err.Error()
+	}
+	resp, _ := json.Marshal(result)
+	_ = sendRelayMsg(conn, relayMsgFile, resp)
+}
+
+func relayFileOp(fs vfs.Provider, req *relayFileRequest, result *relayFileResult) error {
+	switch req.Op {
+	case relayFileStat:
+		info, err := fs.Stat(req.Path)
+		if err != nil {
+			return err
+		}
+		result.Info = &api.FileInfo{Name: info.Name(), Size: info.Size(), Mode: uint32(info.Mode()), IsDir: info.IsDir()}
+		return nil
+	case relayFileLstat:
+		info, err := lstat(fs, req.Path)
+		if err != nil {
+			return err
+		}
+		result.Info = &info
+		return nil
+	case relayFileList:
+		files, err := listFiles(fs, req.Path)
+		result.Files = files
+		return err
+	case relayFileRead:
+		content, err := readFile(fs, req.Path)
+		result.Content = content
+		return err
+	case relayFileReadlink:
+		target, err := fs.Readlink(req.Path)
+		result.Target = target
+		return err
+	case relayFileWrite:
+		return writeFile(fs, req.Path, req.Content, req.Mode)
+	case relayFileMkdir:
+		err := fs.Mkdir(req.Path, os.FileMode(req.Mode))
+		if err != nil {
+			// An existing directory is fine: cp merges into it.
+			if info, statErr := fs.Stat(req.Path); statErr == nil && info.IsDir() {
+				return nil
+			}
+		}
+		return err
+	case relayFileSymlink:
+		return fs.Symlink(req.Target, req.Path)
+	}
+	return fmt.Errorf("unknown file operation %q", req.Op)
+}
+
+// lstat reports p without following a final symlink. Providers only
+// offer a following Stat, but directory listings describe symlinks as
+// such, so p is looked up in its parent's listing.
+func lstat(fs vfs.Provider, p string) (api.FileInfo, error) {
+	p = path.Clean(p)
+	if dir, name := path.Split(p); name != "" {
+		entries, err := listFiles(fs, dir)
+		if err == nil {
+			for _, e := range entries {
+				if e.Name == name {
+					return e, nil
+				}
+			}
+		}
+	}
+	info, err := fs.Stat(p)
+	if err != nil {
+		return api.FileInfo{}, err
+	}
+	return api.FileInfo{Name: info.Name(), Size: info.Size(), Mode: uint32(info.Mode()), IsDir: info.IsDir()}, nil
+}
+
+func fileOpViaRelay(ctx context.Context, socketPath string, req relayFileRequest) (*relayFileResult, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, errx.Wrap(ErrRelayConnect, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	reqData, _ := json.Marshal(req)
+	if err := sendRelayMsg(conn, relayMsgFile, reqData); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrRelaySend, err)
+	}
+	msgType, data, err := readRelayMsg(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrRelayRead, err)
+	}
+	if msgType != relayMsgFile {
+		return nil, errx.With(ErrRelayUnexpected, ": %d", msgType)
+	}
+
+	var result relayFileResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, errx.Wrap(ErrRelayDecode, err)
+	}
+	if result.Error != "" {
+		return nil, errx.With(ErrRelayFile, " %s %s: %w", req.Op, req.Path, errors.New(result.Error))
+	}
+	return &result, nil
+}
+
+// StatViaRelay stats a sandbox VFS path through an exec relay socket. With
+// follow unset, a symlink is reported as itself.
+func StatViaRelay(ctx context.Context, socketPath, path string, follow bool) (api.FileInfo, error) {
+	op := relayFileLstat
+	if follow {
+		op = relayFileStat
+	}
+	result, err := fileOpViaRelay(ctx, socketPath, relayFileRequest{Op: op, Path: path})
+	if err != nil {
+		return api.FileInfo{}, err
+	}
+	if result.Info == nil {
+		return api.FileInfo{}, errx.With(ErrRelayFile, " %s %s: no file info", op, path)
+	}
+	return *result.Info, nil
+}
+
+// ListFilesViaRelay lists a sandbox VFS directory through an exec relay
+// socket. Symlinks are listed as themselves.
+func ListFilesViaRelay(ctx context.Context, socketPath, path string) ([]api.FileInfo, error) {
+	result, err := fileOpViaRelay(ctx, socketPath, relayFileRequest{Op: relayFileList, Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return result.Files, nil
+}
+
+// ReadFileViaRelay reads a sandbox VFS file through an exec relay socket.
+func ReadFileViaRelay(ctx context.Context, socketPath, path string) ([]byte, error) {
+	result, err := fileOpViaRelay(ctx, socketPath, relayFileRequest{Op: relayFileRead, Path: path})
+	if err != nil {
+		return nil, err
+	}
+	return result.Content, nil
+}
+
+// ReadlinkViaRelay returns the target of a sandbox VFS symlink through an
+// exec relay socket.
+func ReadlinkViaRelay(ctx context.Context, socketPath, path string) (string, error) {
+	result, err := fileOpViaRelay(ctx, socketPath, relayFileRequest{Op: relayFileReadlink, Path: path})
+	if err != nil {
+		return "", err
+	}
+	return result.Target, nil
+}
+
+// WriteFileViaRelay writes a sandbox VFS file through an exec relay socket.
+func WriteFileViaRelay(ctx context.Context, socketPath, path string, content []byte, mode uint32) error {
+	_, err := fileOpViaRelay(ctx, socketPath, relayFileRequest{Op: relayFileWrite, Path: path, Content: content, Mode: mode})
+	return err
+}
+
+// MkdirViaRelay creates a sandbox VFS directory through an exec relay
+// socket. An existing directory is not an error.
+func MkdirViaRelay(ctx context.Context, socketPath, path string, mode uint32) error {
+	_, err := fileOpViaRelay(ctx, socketPath, relayFileRequest{Op: relayFileMkdir, Path: path, Mode: mode})
+	return err
+}
+
+// SymlinkViaRelay creates a sandbox VFS symlink at path pointing to target
+// through an exec relay socket.
+func SymlinkViaRelay(ctx context.Context, socketPath, target, path string) error {
+	_, err := fileOpViaRelay(ctx, socketPath, relayFileRequest{Op: relayFileSymlink, Path: path, Target: target})
+	return err
+}
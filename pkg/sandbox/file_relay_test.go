@@ -0,0 +1,63 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func startFileRelay(t *testing.T) string {
+	t.Helper()
+	// Unix socket paths are length-limited, so avoid the long t.TempDir.
+	dir, err := os.MkdirTemp("", "relay")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	sb := &Sandbox{config: &api.Config{}, vfsRoot: vfs.NewMemoryProvider(), events: newEventRecorder(0)}
+	relay := NewExecRelay(sb)
+	socketPath := filepath.Join(dir, "exec.sock")
+	require.NoError(t, relay.Start(socketPath))
+	t.Cleanup(relay.Stop)
+	return socketPath
+}
+
+func TestFileRelayRoundTrip(t *testing.T) {
+	socketPath := startFileRelay(t)
+	ctx := context.Background()
+
+	require.NoError(t, MkdirViaRelay(ctx, socketPath, "/workspace", 0755))
+	require.NoError(t, MkdirViaRelay(ctx, socketPath, "/workspace/out", 0750))
+	require.NoError(t, MkdirViaRelay(ctx, socketPath, "/workspace/out", 0750), "existing dir is not an error")
+	require.NoError(t, WriteFileViaRelay(ctx, socketPath, "/workspace/out/run.sh", []byte("#!/bin/sh\n"), 0755))
+
+	files, err := ListFilesViaRelay(ctx, socketPath, "/workspace/out")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "run.sh", files[0].Name)
+
+	content, err := ReadFileViaRelay(ctx, socketPath, "/workspace/out/run.sh")
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\n", string(content))
+
+	info, err := StatViaRelay(ctx, socketPath, "/workspace/out/run.sh", false)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), os.FileMode(info.Mode).Perm())
+	assert.EqualValues(t, 10, info.Size)
+
+	info, err = StatViaRelay(ctx, socketPath, "/workspace/out", true)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir)
+}
+
+func TestFileRelayReportsErrors(t *testing.T) {
+	socketPath := startFileRelay(t)
+
+	_, err := ReadFileViaRelay(context.Background(), socketPath, "/workspace/missing")
+	require.ErrorIs(t, err, ErrRelayFile)
+}
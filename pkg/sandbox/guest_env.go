@@ -0,0 +1,54 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// guestAgentPath is where the guest agent binary sits in every rootfs.
+const guestAgentPath = "/opt/matchlock/guest-agent"
+
+// GuestEnv returns the environment guest commands run with: image ENV,
+// config env, the CA bundle variables and secret placeholders. It runs the
+// guest agent's "env" command, so it works in images without a shell and
+// records no exec event. Secret placeholders are shown as they are; should
+// a real secret value appear anyway (e.g. copied into config env), it is
+// replaced by "<redacted:NAME>".
+func (s *Sandbox) GuestEnv(ctx context.Context) (map[string]string, error) {
+	result, err := execCommand(ctx, s.machine, s.config, s.caPool, s.policy, "", &api.ExecOptions{
+		Args: []string{guestAgentPath, "env"},
+	})
+	if err != nil {
+		return nil, errx.Wrap(ErrGuestEnv, err)
+	}
+	if result.ExitCode != 0 {
+		return nil, errx.With(ErrGuestEnv, ": exit code %d: %s", result.ExitCode, strings.TrimSpace(string(result.Stderr)))
+	}
+	var env map[string]string
+	if err := json.Unmarshal(result.Stdout, &env); err != nil {
+		return nil, errx.Wrap(ErrGuestEnv, err)
+	}
+	redactSecretValues(env, s.config.Network)
+	return env, nil
+}
+
+// redactSecretValues replaces real secret values found in env values.
+func redactSecretValues(env map[string]string, network *api.NetworkConfig) {
+	if network == nil {
+		return
+	}
+	for name, secret := range network.Secrets {
+		if secret.Value == "" {
+			continue
+		}
+		for key, value := range env {
+			if strings.Contains(value, secret.Value) {
+				env[key] = strings.ReplaceAll(value, secret.Value, "<redacted:"+name+">")
+			}
+		}
+	}
+}
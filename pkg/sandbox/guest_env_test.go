@@ -0,0 +1,80 @@
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+)
+
+// envEchoMachine answers Exec like the guest agent's env command: it
+// prints the env it was given, plus extra variables, as JSON.
+type envEchoMachine struct {
+	fakeInteractiveMachine
+	extra    map[string]string
+	exitCode int
+	opts     *api.ExecOptions
+}
+
+func (m *envEchoMachine) Exec(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+	m.opts = opts
+	env := make(map[string]string)
+	for k, v := range opts.Env {
+		env[k] = v
+	}
+	for k, v := range m.extra {
+		env[k] = v
+	}
+	out, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ExecResult{ExitCode: m.exitCode, Stdout: out, Stderr: []byte("boom\n")}, nil
+}
+
+func TestGuestEnvShowsPlaceholdersAndRedactsValues(t *testing.T) {
+	network := &api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"API_KEY": {Value: "real-secret"},
+		},
+	}
+	pol := policy.NewEngine(network)
+	machine := &envEchoMachine{extra: map[string]string{
+		"COPIED": "Bearer real-secret",
+	}}
+	sb := &Sandbox{
+		config:  &api.Config{Env: map[string]string{"FOO": "bar"}, Network: network},
+		machine: machine,
+		policy:  pol,
+		events:  newEventRecorder(0),
+	}
+
+	env, err := sb.GuestEnv(context.Background())
+	require.NoError(t, err)
+
+	require.NotNil(t, machine.opts)
+	assert.Equal(t, []string{guestAgentPath, "env"}, machine.opts.Args)
+	assert.Equal(t, "bar", env["FOO"])
+	assert.Equal(t, pol.GetPlaceholder("API_KEY"), env["API_KEY"])
+	assert.Equal(t, "Bearer <redacted:API_KEY>", env["COPIED"])
+	for _, value := range env {
+		assert.NotContains(t, value, "real-secret")
+	}
+}
+
+func TestGuestEnvNonZeroExit(t *testing.T) {
+	sb := &Sandbox{
+		config:  &api.Config{},
+		machine: &envEchoMachine{exitCode: 127},
+		events:  newEventRecorder(0),
+	}
+
+	_, err := sb.GuestEnv(context.Background())
+	require.ErrorIs(t, err, ErrGuestEnv)
+	assert.Contains(t, err.Error(), "exit code 127: boom")
+}
@@ -0,0 +1,60 @@
+package sandbox
+
+import (
+	"net"
+	"sync"
+)
+
+// serveGuestConns accepts guest vsock connections on listener and runs handle
+// for each in its own goroutine. The returned stop function closes the
+// listener and open connections and waits for all handlers to exit.
+func serveGuestConns(listener net.Listener, handle func(net.Conn)) func() {
+	var (
+		mu     sync.Mutex
+		conns  = make(map[net.Conn]struct{})
+		closed bool
+		wg     sync.WaitGroup
+	)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			if closed {
+				mu.Unlock()
+				conn.Close()
+				return
+			}
+			conns[conn] = struct{}{}
+			mu.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					mu.Lock()
+					delete(conns, conn)
+					mu.Unlock()
+					conn.Close()
+				}()
+				handle(conn)
+			}()
+		}
+	}()
+
+	return func() {
+		listener.Close()
+		mu.Lock()
+		closed = true
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}
+}
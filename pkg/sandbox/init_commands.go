@@ -0,0 +1,56 @@
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// initCommandsUser runs init commands as root whatever user the image or
+// exec defaults name, so setup can do what the workload is not allowed to.
+const initCommandsUser = "0:0"
+
+// InitCommandsLogPath is where the output of the sandbox's init commands is
+// written, in its state directory.
+func (s *Sandbox) InitCommandsLogPath() string {
+	return filepath.Join(s.stateMgr.Dir(s.id), "init-commands.log")
+}
+
+// runInitCommands runs config.InitCommands in order once the VM is up,
+// before Start returns and so before any workload command. They run as
+// setup execs, without the capability drop, seccomp filter and
+// no_new_privs that confine the workload, so mount, sysctl and the like
+// work and their effects are visible to later commands. Their combined
+// output goes to InitCommandsLogPath. The first command that fails or
+// exits non-zero aborts the rest.
+func (s *Sandbox) runInitCommands(ctx context.Context) error {
+	if len(s.config.InitCommands) == 0 {
+		return nil
+	}
+	logFile, err := os.Create(s.InitCommandsLogPath())
+	if err != nil {
+		return errx.Wrap(ErrInitCommand, err)
+	}
+	defer logFile.Close()
+
+	for _, command := range s.config.InitCommands {
+		fmt.Fprintf(logFile, "$ %s\n", command)
+		result, err := s.Exec(ctx, command, &api.ExecOptions{
+			User:   initCommandsUser,
+			Stdout: logFile,
+			Stderr: logFile,
+			Setup:  true,
+		})
+		if err != nil {
+			return errx.With(ErrInitCommand, " %q: %w", command, err)
+		}
+		if result.ExitCode != 0 {
+			return errx.With(ErrInitCommand, " %q exited %d: %s", command, result.ExitCode, lastLines(string(result.Stderr), 5))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/state"
+)
+
+// scriptedExecMachine answers Exec with a fixed result per command and
+// records the commands, users and setup flags it saw.
+type scriptedExecMachine struct {
+	fakeInteractiveMachine
+	results  map[string]*api.ExecResult
+	commands []string
+	users    []string
+	setup    []bool
+}
+
+func (m *scriptedExecMachine) Exec(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+	m.commands = append(m.commands, command)
+	m.users = append(m.users, opts.User)
+	m.setup = append(m.setup, opts.Setup)
+	result := m.results[command]
+	if result == nil {
+		result = &api.ExecResult{}
+	}
+	if opts.Stdout != nil {
+		opts.Stdout.Write(result.Stdout)
+	}
+	if opts.Stderr != nil {
+		opts.Stderr.Write(result.Stderr)
+	}
+	return result, nil
+}
+
+func newInitCommandsSandbox(t *testing.T, machine *scriptedExecMachine, commands ...string) *Sandbox {
+	t.Helper()
+	stateMgr := state.NewManagerWithDir(t.TempDir())
+	require.NoError(t, os.MkdirAll(stateMgr.Dir("vm-init"), 0755))
+	return &Sandbox{
+		id:       "vm-init",
+		config:   &api.Config{InitCommands: commands, ImageCfg: &api.ImageConfig{User: "nobody"}},
+		machine:  machine,
+		stateMgr: stateMgr,
+		events:   newEventRecorder(0),
+	}
+}
+
+func TestRunInitCommandsRunsAsRootAndLogsOutput(t *testing.T) {
+	machine := &scriptedExecMachine{results: map[string]*api.ExecResult{
+		"mount -t tmpfs tmpfs /data": {Stdout: []byte("mounted\n")},
+	}}
+	sb := newInitCommandsSandbox(t, machine, "mount -t tmpfs tmpfs /data", "chown nobody /data")
+
+	require.NoError(t, sb.runInitCommands(context.Background()))
+	assert.Equal(t, []string{"mount -t tmpfs tmpfs /data", "chown nobody /data"}, machine.commands)
+	assert.Equal(t, []string{"0:0", "0:0"}, machine.users)
+	assert.Equal(t, []bool{true, true}, machine.setup, "init commands must run as setup execs")
+
+	log, err := os.ReadFile(sb.InitCommandsLogPath())
+	require.NoError(t, err)
+	assert.Equal(t, "$ mount -t tmpfs tmpfs /data\nmounted\n$ chown nobody /data\n", string(log))
+}
+
+func TestRunInitCommandsStopsAtFirstFailure(t *testing.T) {
+	machine := &scriptedExecMachine{results: map[string]*api.ExecResult{
+		"false": {ExitCode: 1, Stderr: []byte("boom\n")},
+	}}
+	sb := newInitCommandsSandbox(t, machine, "false", "echo unreachable")
+
+	err := sb.runInitCommands(context.Background())
+	require.ErrorIs(t, err, ErrInitCommand)
+	assert.Contains(t, err.Error(), `"false" exited 1: boom`)
+	assert.Equal(t, []string{"false"}, machine.commands)
+}
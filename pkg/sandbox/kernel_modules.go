@@ -0,0 +1,93 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/kernel"
+)
+
+// modulesDiskName is the VM state dir file that carries
+// config.KernelModules to guest-init (see cmd/guest-init/modules.go).
+const modulesDiskName = "kernel-modules.ext4"
+
+// validateKernelModules checks that every module in config.KernelModules
+// was built for the kernel at kernelPath, so a mismatch fails create
+// instead of being refused by the guest kernel at boot.
+func validateKernelModules(config *api.Config, kernelPath string) error {
+	if len(config.KernelModules) == 0 {
+		return nil
+	}
+	release, err := kernel.ImageRelease(kernelPath)
+	if err != nil {
+		return errx.Wrap(ErrKernelModules, err)
+	}
+	for _, m := range config.KernelModules {
+		if filepath.Ext(m) != ".ko" {
+			return errx.With(ErrKernelModules, ": %s: expected a .ko file", m)
+		}
+		if err := kernel.ValidateModule(m, release, kernel.CurrentArch()); err != nil {
+			return errx.Wrap(ErrKernelModules, err)
+		}
+	}
+	return nil
+}
+
+// kernelModuleNames returns the file names config.KernelModules get on the
+// modules disk. Each is prefixed with its position, so names stay unique
+// and guest-init loads them in the order given, dependencies first.
+func kernelModuleNames(modules []string) []string {
+	names := make([]string, len(modules))
+	for i, m := range modules {
+		names[i] = fmt.Sprintf("%02d-%s", i, filepath.Base(m))
+	}
+	return names
+}
+
+// buildModulesDisk writes modules into a fresh ext4 image at diskPath,
+// which the VM gets as a read-only drive. guest-init loads only the names
+// listed on the kernel cmdline from that drive, never from the rootfs: an
+// image or an earlier session controls the rootfs, and loading from it
+// would hand them kernel code despite the CAP_SYS_MODULE drop.
+func buildModulesDisk(modules []string, diskPath string) error {
+	staging, err := os.MkdirTemp(filepath.Dir(diskPath), "kernel-modules-*")
+	if err != nil {
+		return errx.Wrap(ErrKernelModules, err)
+	}
+	defer os.RemoveAll(staging)
+
+	var total int64
+	for i, name := range kernelModuleNames(modules) {
+		data, err := os.ReadFile(modules[i])
+		if err != nil {
+			return errx.Wrap(ErrKernelModules, err)
+		}
+		if err := os.WriteFile(filepath.Join(staging, name), data, 0644); err != nil {
+			return errx.Wrap(ErrKernelModules, err)
+		}
+		total += int64(len(data))
+	}
+
+	f, err := os.Create(diskPath)
+	if err != nil {
+		return errx.Wrap(ErrKernelModules, err)
+	}
+	// Room for the files twice over plus filesystem metadata.
+	err = f.Truncate(2*total + 8<<20)
+	f.Close()
+	if err != nil {
+		return errx.Wrap(ErrKernelModules, err)
+	}
+	mkfsPath, err := exec.LookPath("mkfs.ext4")
+	if err != nil {
+		return errx.With(ErrKernelModules, ": mkfs.ext4 not found; install e2fsprogs")
+	}
+	if out, err := exec.Command(mkfsPath, "-F", "-q", "-d", staging, diskPath).CombinedOutput(); err != nil {
+		return errx.With(ErrKernelModules, ": mkfs.ext4: %w: %s", err, out)
+	}
+	return nil
+}
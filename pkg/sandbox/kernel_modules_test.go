@@ -0,0 +1,58 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/kernel"
+)
+
+func TestValidateKernelModules(t *testing.T) {
+	dir := t.TempDir()
+	kernelImage := filepath.Join(dir, "vmlinux")
+	require.NoError(t, os.WriteFile(kernelImage, []byte("\x00Linux version 6.1.137 (ci) #1\n"), 0644))
+
+	require.NoError(t, validateKernelModules(&api.Config{}, "/does/not/matter"))
+
+	err := validateKernelModules(&api.Config{KernelModules: []string{filepath.Join(dir, "nf_tables.o")}}, kernelImage)
+	require.ErrorIs(t, err, ErrKernelModules)
+	assert.Contains(t, err.Error(), "expected a .ko file")
+
+	bogus := filepath.Join(dir, "bogus.ko")
+	require.NoError(t, os.WriteFile(bogus, []byte("not elf"), 0644))
+	err = validateKernelModules(&api.Config{KernelModules: []string{bogus}}, kernelImage)
+	require.ErrorIs(t, err, ErrKernelModules)
+	assert.ErrorIs(t, err, kernel.ErrInvalidModule)
+
+	err = validateKernelModules(&api.Config{KernelModules: []string{bogus}}, bogus)
+	assert.ErrorIs(t, err, kernel.ErrKernelRelease)
+}
+
+func TestBuildModulesDisk(t *testing.T) {
+	if !hasDebugfs() || !hasMkfsExt4() {
+		t.Skip("debugfs or mkfs.ext4 not available")
+	}
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "nf_tables.ko")
+	second := filepath.Join(dir, "nft_chain_nat.ko")
+	require.NoError(t, os.WriteFile(first, []byte("first"), 0600))
+	require.NoError(t, os.WriteFile(second, []byte("second"), 0600))
+	modules := []string{first, second}
+
+	assert.Equal(t, []string{"00-nf_tables.ko", "01-nft_chain_nat.ko"}, kernelModuleNames(modules))
+
+	disk := filepath.Join(t.TempDir(), modulesDiskName)
+	require.NoError(t, buildModulesDisk(modules, disk))
+	assert.Equal(t, "first", debugfsCat(t, disk, "/00-nf_tables.ko"))
+	assert.Equal(t, "second", debugfsCat(t, disk, "/01-nft_chain_nat.ko"))
+	assert.Contains(t, debugfsStatMode(t, disk, "/00-nf_tables.ko"), "0644")
+
+	err := buildModulesDisk([]string{filepath.Join(dir, "missing.ko")}, disk)
+	require.ErrorIs(t, err, ErrKernelModules)
+}
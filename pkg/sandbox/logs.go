@@ -0,0 +1,114 @@
+package sandbox
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// logFollowInterval is how often a followed log is polled for new data.
+const logFollowInterval = 250 * time.Millisecond
+
+// LogOptions filters and controls StreamLogs.
+type LogOptions struct {
+	// Sources limits output to these sources; empty means all.
+	Sources []api.LogSource
+	// Follow keeps streaming appended lines until ctx is done.
+	Follow bool
+	// Since starts reading at this byte offset, or this many bytes before
+	// the end of the file when negative. An offset inside a line skips to
+	// the start of the next one.
+	Since int64
+}
+
+// StreamLogs calls fn for each line of a VM console log. Without Follow it
+// returns at end of file; with Follow it polls for new lines until ctx is
+// cancelled, which is not reported as an error.
+func StreamLogs(ctx context.Context, path string, opts LogOptions, fn func(api.LogLine) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errx.Wrap(ErrReadLog, err)
+	}
+	defer f.Close()
+
+	skip, err := seekLog(f, opts.Since)
+	if err != nil {
+		return errx.Wrap(ErrReadLog, err)
+	}
+
+	reader := bufio.NewReader(f)
+	var partial string
+	for {
+		chunk, err := reader.ReadString('\n')
+		partial += chunk
+		if err == nil {
+			if skip {
+				skip = false
+				partial = ""
+				continue
+			}
+			line := api.ParseLogLine(partial)
+			partial = ""
+			if len(opts.Sources) == 0 || slices.Contains(opts.Sources, line.Source) {
+				if err := fn(line); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err != io.EOF {
+			return errx.Wrap(ErrReadLog, err)
+		}
+
+		// A trailing line without newline may still be written to.
+		if !opts.Follow {
+			if partial != "" && !skip {
+				line := api.ParseLogLine(partial)
+				if len(opts.Sources) == 0 || slices.Contains(opts.Sources, line.Source) {
+					return fn(line)
+				}
+			}
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(logFollowInterval):
+		}
+	}
+}
+
+// seekLog positions f for LogOptions.Since, clamped to the file, and
+// reports whether the offset fell inside a line, whose remainder the
+// caller must skip.
+func seekLog(f *os.File, since int64) (bool, error) {
+	if since == 0 {
+		return false, nil
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	offset := min(since, info.Size())
+	if since < 0 {
+		offset = max(info.Size()+since, 0)
+	}
+	if offset == 0 {
+		return false, nil
+	}
+	// The byte before offset tells whether offset starts a line.
+	if _, err := f.Seek(offset-1, io.SeekStart); err != nil {
+		return false, err
+	}
+	prev := make([]byte, 1)
+	if _, err := io.ReadFull(f, prev); err != nil {
+		return false, err
+	}
+	return prev[0] != '\n', nil
+}
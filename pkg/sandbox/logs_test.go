@@ -0,0 +1,96 @@
+package sandbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestStreamLogsFiltersSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.log")
+	require.NoError(t, os.WriteFile(path, []byte("boot\n[init] WARNING: a\n[fused] mounted\n[init] FATAL: b"), 0644))
+
+	var got []api.LogLine
+	err := StreamLogs(context.Background(), path, LogOptions{Sources: []api.LogSource{api.LogSourceInit}}, func(line api.LogLine) error {
+		got = append(got, line)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []api.LogLine{
+		{Source: api.LogSourceInit, Text: "WARNING: a"},
+		{Source: api.LogSourceInit, Text: "FATAL: b"},
+	}, got)
+}
+
+func TestStreamLogsFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.log")
+	require.NoError(t, os.WriteFile(path, []byte("[agent] one\n"), 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	lines := make(chan api.LogLine, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- StreamLogs(ctx, path, LogOptions{Follow: true}, func(line api.LogLine) error {
+			lines <- line
+			return nil
+		})
+	}()
+
+	assert.Equal(t, "one", (<-lines).Text)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("[agent] tw")
+	require.NoError(t, err)
+	time.Sleep(2 * logFollowInterval)
+	_, err = f.WriteString("o\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	select {
+	case line := <-lines:
+		assert.Equal(t, api.LogLine{Source: api.LogSourceAgent, Text: "two"}, line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("followed line not delivered")
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestStreamLogsSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.log")
+	content := "boot\n[init] one\n[init] two\n[agent] three"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	collect := func(since int64) []string {
+		var got []string
+		err := StreamLogs(context.Background(), path, LogOptions{Since: since}, func(line api.LogLine) error {
+			got = append(got, line.Text)
+			return nil
+		})
+		require.NoError(t, err)
+		return got
+	}
+
+	assert.Equal(t, []string{"boot", "one", "two", "three"}, collect(0))
+	assert.Equal(t, []string{"one", "two", "three"}, collect(5), "offset at a line start")
+	assert.Equal(t, []string{"two", "three"}, collect(7), "offset inside a line skips to the next")
+	assert.Equal(t, []string{"three"}, collect(-13), "negative offset counts from the end")
+	assert.Empty(t, collect(-8), "a partial last line is skipped")
+	assert.Equal(t, []string{"boot", "one", "two", "three"}, collect(-1000))
+	assert.Empty(t, collect(1000))
+}
+
+func TestStreamLogsMissingFile(t *testing.T) {
+	err := StreamLogs(context.Background(), filepath.Join(t.TempDir(), "missing.log"), LogOptions{}, func(api.LogLine) error { return nil })
+	require.ErrorIs(t, err, ErrReadLog)
+}
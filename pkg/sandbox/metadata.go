@@ -0,0 +1,16 @@
+package sandbox
+
+import (
+	"github.com/jingkaihe/matchlock/pkg/api"
+	sandboxnet "github.com/jingkaihe/matchlock/pkg/net"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+)
+
+// metadataService returns the guest metadata service for config, or nil
+// when it is not enabled.
+func metadataService(config *api.Config, engine *policy.Engine) *sandboxnet.MetadataService {
+	if config.Network == nil || !config.Network.MetadataService {
+		return nil
+	}
+	return sandboxnet.NewMetadataService(config.Metadata(), engine)
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/jingkaihe/matchlock/pkg/api"
 )
 
+// prepareOverlaySnapshots copies the host_path of each overlay mount into
+// stateDir and rewrites the mount as a host_fs mount of the copy. Layered
+// overlays (upper/lower) are left for vfs.BuildProvider.
 func prepareOverlaySnapshots(config *api.Config, stateDir string) ([]string, error) {
 	if config == nil || config.VFS == nil || len(config.VFS.Mounts) == 0 {
 		return nil, nil
@@ -23,14 +26,17 @@ func prepareOverlaySnapshots(config *api.Config, stateDir string) ([]string, err
 		if mount.Type != api.MountTypeOverlay {
 			continue
 		}
+		if mount.Upper != nil || mount.Lower != nil {
+			if mount.HostPath != "" {
+				cleanupSnapshotPaths(snapshots)
+				return nil, errx.With(ErrPrepareOverlayMount, ": %s: use either host_path or upper/lower", guestPath)
+			}
+			continue
+		}
 		if mount.HostPath == "" {
 			cleanupSnapshotPaths(snapshots)
 			return nil, errx.With(ErrPrepareOverlayMount, ": %s: host_path is required for overlay mounts", guestPath)
 		}
-		if mount.Upper != nil || mount.Lower != nil {
-			cleanupSnapshotPaths(snapshots)
-			return nil, errx.With(ErrPrepareOverlayMount, ": %s: upper/lower overlay config is not supported; use host_path", guestPath)
-		}
 
 		if err := os.MkdirAll(snapshotRoot, 0700); err != nil {
 			cleanupSnapshotPaths(snapshots)
@@ -46,8 +52,6 @@ func prepareOverlaySnapshots(config *api.Config, stateDir string) ([]string, err
 		mount.Type = api.MountTypeHostFS
 		mount.HostPath = dstPath
 		mount.Readonly = false
-		mount.Upper = nil
-		mount.Lower = nil
 		config.VFS.Mounts[guestPath] = mount
 
 		snapshots = append(snapshots, dstPath)
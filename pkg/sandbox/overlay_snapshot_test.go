@@ -101,7 +101,7 @@ func TestPrepareOverlaySnapshotsRejectsOverlayWithoutHostPath(t *testing.T) {
 	require.Contains(t, err.Error(), "host_path is required")
 }
 
-func TestPrepareOverlaySnapshotsRejectsUpperLowerOverlayConfig(t *testing.T) {
+func TestPrepareOverlaySnapshotsRejectsHostPathWithLayers(t *testing.T) {
 	stateDir := t.TempDir()
 	hostDir := t.TempDir()
 	cfg := &api.Config{
@@ -119,5 +119,24 @@ func TestPrepareOverlaySnapshotsRejectsUpperLowerOverlayConfig(t *testing.T) {
 
 	_, err := prepareOverlaySnapshots(cfg, stateDir)
 	require.Error(t, err)
-	require.Contains(t, err.Error(), "upper/lower overlay config is not supported")
+	require.Contains(t, err.Error(), "use either host_path or upper/lower")
+}
+
+func TestPrepareOverlaySnapshotsLeavesLayeredOverlays(t *testing.T) {
+	stateDir := t.TempDir()
+	layered := api.MountConfig{
+		Type:  api.MountTypeOverlay,
+		Upper: &api.MountConfig{Type: api.MountTypeMemory},
+		Lower: &api.MountConfig{Type: api.MountTypeHostFS, HostPath: t.TempDir(), Readonly: true},
+	}
+	cfg := &api.Config{
+		VFS: &api.VFSConfig{
+			Mounts: map[string]api.MountConfig{"/workspace/data": layered},
+		},
+	}
+
+	snapshots, err := prepareOverlaySnapshots(cfg, stateDir)
+	require.NoError(t, err)
+	require.Empty(t, snapshots)
+	require.Equal(t, layered, cfg.VFS.Mounts["/workspace/data"])
 }
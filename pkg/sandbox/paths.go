@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/jingkaihe/matchlock/pkg/api"
 	"github.com/jingkaihe/matchlock/pkg/kernel"
 )
 
@@ -28,6 +29,23 @@ func DefaultKernelPath() string {
 	return path
 }
 
+// resolveKernelPath picks the kernel a sandbox boots: an explicit
+// Options.KernelPath, then config.KernelPath, then DefaultKernelPath. A
+// kernel chosen through the config is checked with kernel.ValidateImage, so
+// a wrong file fails create instead of the boot.
+func resolveKernelPath(config *api.Config, optsPath string) (string, error) {
+	if optsPath != "" {
+		return optsPath, nil
+	}
+	if config.KernelPath == "" {
+		return DefaultKernelPath(), nil
+	}
+	if err := kernel.ValidateImage(config.KernelPath, kernel.CurrentArch()); err != nil {
+		return "", err
+	}
+	return config.KernelPath, nil
+}
+
 // DefaultKernelPathWithVersion returns the path to a specific kernel version.
 func DefaultKernelPathWithVersion(version string) (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
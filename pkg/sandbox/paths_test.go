@@ -0,0 +1,40 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/kernel"
+)
+
+func TestResolveKernelPath(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "not-a-kernel")
+	require.NoError(t, os.WriteFile(garbage, make([]byte, 128), 0644))
+
+	got, err := resolveKernelPath(&api.Config{KernelPath: garbage}, "/explicit/vmlinux")
+	require.NoError(t, err)
+	assert.Equal(t, "/explicit/vmlinux", got, "Options.KernelPath wins and is trusted")
+
+	_, err = resolveKernelPath(&api.Config{KernelPath: garbage}, "")
+	assert.ErrorIs(t, err, kernel.ErrInvalidKernel)
+
+	header := make([]byte, 128)
+	copy(header, "\x7fELF")
+	machine := uint16(62)
+	if kernel.CurrentArch() == kernel.ArchARM64 {
+		machine = 183
+	}
+	header[18], header[19] = byte(machine), byte(machine>>8)
+	vmlinux := filepath.Join(dir, "vmlinux")
+	require.NoError(t, os.WriteFile(vmlinux, header, 0644))
+
+	got, err = resolveKernelPath(&api.Config{KernelPath: vmlinux}, "")
+	require.NoError(t, err)
+	assert.Equal(t, vmlinux, got)
+}
@@ -0,0 +1,39 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"net"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+)
+
+// servePolicyQueries answers guest api.PolicyQuery requests on listener from
+// engine, so code in the sandbox can ask whether a host is reachable without
+// making a failing request. Each connection may send any number of queries.
+func servePolicyQueries(listener net.Listener, engine *policy.Engine) func() {
+	return serveGuestConns(listener, func(conn net.Conn) {
+		answerPolicyQueries(conn, engine)
+	})
+}
+
+func answerPolicyQueries(conn net.Conn, engine *policy.Engine) {
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var query api.PolicyQuery
+		if err := dec.Decode(&query); err != nil {
+			return
+		}
+		answer := api.PolicyAnswer{
+			Host:    query.Host,
+			Secrets: engine.SecretNames(),
+		}
+		if query.Host != "" {
+			answer.Allowed = engine.IsHostAllowed(query.Host)
+		}
+		if err := enc.Encode(answer); err != nil {
+			return
+		}
+	}
+}
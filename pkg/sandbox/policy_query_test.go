@@ -0,0 +1,47 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/policy"
+)
+
+func TestServePolicyQueries(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	engine := policy.NewEngine(&api.NetworkConfig{
+		AllowedHosts: []string{"*.openai.com"},
+		Secrets: map[string]api.Secret{
+			"OPENAI_KEY": {Value: "sk-secret", Hosts: []string{"api.openai.com"}},
+		},
+	})
+	stop := servePolicyQueries(listener, engine)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	enc := json.NewEncoder(conn)
+	dec := json.NewDecoder(conn)
+
+	var answer api.PolicyAnswer
+	require.NoError(t, enc.Encode(api.PolicyQuery{Host: "api.openai.com"}))
+	require.NoError(t, dec.Decode(&answer))
+	assert.Equal(t, "api.openai.com", answer.Host)
+	assert.True(t, answer.Allowed)
+	assert.Equal(t, []string{"OPENAI_KEY"}, answer.Secrets)
+
+	answer = api.PolicyAnswer{}
+	require.NoError(t, enc.Encode(api.PolicyQuery{Host: "example.com:443"}))
+	require.NoError(t, dec.Decode(&answer))
+	assert.False(t, answer.Allowed)
+
+	// stop must return even with the guest connection still open.
+	stop()
+}
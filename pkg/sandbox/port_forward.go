@@ -18,6 +18,9 @@ import (
 
 const guestLoopbackAddress = "127.0.0.1"
 
+// guestPortPollInterval is the delay between readiness probes of a guest port.
+const guestPortPollInterval = 100 * time.Millisecond
+
 type listenerSpec struct {
 	listener   net.Listener
 	remotePort int
@@ -65,7 +68,9 @@ func (m *PortForwardManager) Close() error {
 	return nil
 }
 
-// StartPortForwards starts local listeners and proxies connections to the guest.
+// StartPortForwards starts local listeners and proxies connections to the
+// guest. Each forward listens on every address, or only on its own Address
+// when set.
 func (s *Sandbox) StartPortForwards(ctx context.Context, addresses []string, forwards []api.PortForward) (*PortForwardManager, error) {
 	if len(forwards) == 0 {
 		return nil, nil
@@ -86,13 +91,20 @@ func (s *Sandbox) StartPortForwards(ctx context.Context, addresses []string, for
 	used := make(map[string]struct{})
 
 	for _, pf := range forwards {
-		for _, addr := range addresses {
+		bindAddrs := addresses
+		if pf.Address != "" {
+			bindAddrs = []string{pf.Address}
+		}
+		for _, addr := range bindAddrs {
 			listenAddr := net.JoinHostPort(addr, strconv.Itoa(pf.LocalPort))
-			if _, ok := used[listenAddr]; ok {
-				_ = manager.Close()
-				return nil, errx.With(ErrPortForwardBind, ": duplicate listen address %s", listenAddr)
+			// Port 0 asks the OS for an ephemeral port, so it never collides.
+			if pf.LocalPort != 0 {
+				if _, ok := used[listenAddr]; ok {
+					_ = manager.Close()
+					return nil, errx.With(ErrPortForwardBind, ": duplicate listen address %s", listenAddr)
+				}
+				used[listenAddr] = struct{}{}
 			}
-			used[listenAddr] = struct{}{}
 
 			ln, err := net.Listen("tcp", listenAddr)
 			if err != nil {
@@ -118,6 +130,16 @@ func (s *Sandbox) StartPortForwards(ctx context.Context, addresses []string, for
 		}
 	}
 
+	for _, pf := range forwards {
+		if !pf.WaitForGuestPort {
+			continue
+		}
+		if err := manager.waitForGuestPort(ctx, pf.RemotePort, pf.WaitTimeout()); err != nil {
+			_ = manager.Close()
+			return nil, err
+		}
+	}
+
 	for _, l := range manager.listeners {
 		manager.wg.Add(1)
 		go func(spec listenerSpec) {
@@ -129,6 +151,33 @@ func (s *Sandbox) StartPortForwards(ctx context.Context, addresses []string, for
 	return manager, nil
 }
 
+// waitForGuestPort polls the guest until a service accepts connections on
+// remotePort. Each probe opens a port-forward stream, which the guest agent
+// only acknowledges once its TCP dial succeeds.
+func (m *PortForwardManager) waitForGuestPort(ctx context.Context, remotePort int, timeout time.Duration) error {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(guestPortPollInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		conn, err := m.dialGuest(remotePort)
+		if err == nil {
+			_ = conn.Close()
+			return nil
+		}
+		lastErr = err
+
+		select {
+		case <-waitCtx.Done():
+			return errx.With(ErrGuestPortNotReady, " %d after %s: %w", remotePort, timeout, lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
 func (m *PortForwardManager) serveListener(ctx context.Context, spec listenerSpec) {
 	for {
 		conn, err := spec.listener.Accept()
@@ -202,7 +251,7 @@ func (s *Sandbox) openGuestPort(remotePort int) (net.Conn, error) {
 		return nil, ErrNoVsockDialer
 	}
 
-	conn, err := dialer.DialVsock(vsock.ServicePortExec)
+	conn, err := dialer.DialVsock(s.vsockPorts.Port(vsock.ServiceExec))
 	if err != nil {
 		return nil, errx.Wrap(ErrPortForwardDial, err)
 	}
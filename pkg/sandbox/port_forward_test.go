@@ -0,0 +1,74 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestWaitForGuestPortSucceedsOnceListening(t *testing.T) {
+	var attempts atomic.Int32
+	m := &PortForwardManager{
+		dialGuest: func(remotePort int) (net.Conn, error) {
+			if attempts.Add(1) < 3 {
+				return nil, errors.New("connection refused")
+			}
+			client, server := net.Pipe()
+			_ = server.Close()
+			return client, nil
+		},
+	}
+
+	err := m.waitForGuestPort(context.Background(), 8080, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), attempts.Load())
+}
+
+func TestWaitForGuestPortTimesOut(t *testing.T) {
+	m := &PortForwardManager{
+		dialGuest: func(remotePort int) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+
+	err := m.waitForGuestPort(context.Background(), 8080, 250*time.Millisecond)
+	require.ErrorIs(t, err, ErrGuestPortNotReady)
+	assert.Contains(t, err.Error(), "connection refused")
+}
+
+type dialerMachine struct {
+	*fakeMachine
+}
+
+func (dialerMachine) DialVsock(port uint32) (net.Conn, error) {
+	return nil, errors.New("not connected")
+}
+
+func TestStartPortForwardsHonorsPerForwardAddress(t *testing.T) {
+	sb := &Sandbox{config: &api.Config{}, machine: dialerMachine{newFakeMachine()}, events: newEventRecorder(0)}
+
+	manager, err := sb.StartPortForwards(context.Background(), []string{"127.0.0.1", "::1"}, []api.PortForward{
+		{RemotePort: 80},
+		{RemotePort: 443, Address: "127.0.0.1"},
+	})
+	if errors.Is(err, ErrPortForwardBind) {
+		t.Skipf("loopback listeners unavailable: %v", err)
+	}
+	require.NoError(t, err)
+	defer manager.Close()
+
+	bindings := manager.Bindings()
+	require.Len(t, bindings, 3)
+	assert.Equal(t, "127.0.0.1", bindings[0].Address)
+	assert.Equal(t, "::1", bindings[1].Address)
+	assert.Equal(t, api.PortForwardBinding{Address: "127.0.0.1", LocalPort: bindings[2].LocalPort, RemotePort: 443}, bindings[2])
+	assert.NotZero(t, bindings[2].LocalPort)
+}
@@ -0,0 +1,8 @@
+//go:build darwin
+
+package sandbox
+
+// DropPrivileges is a no-op on macOS, where sandboxes never need root.
+func DropPrivileges() error {
+	return nil
+}
@@ -0,0 +1,118 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// capNetAdmin is CAP_NET_ADMIN from linux/capability.h. It is required to
+// create the TAP device and install the nftables rules for each sandbox.
+const capNetAdmin = 12
+
+// CheckNetworkPrivileges fails fast when the process can neither create TAP
+// devices nor program nftables. Root is not required: `matchlock setup linux`
+// grants CAP_NET_ADMIN to the binary so the RPC process can run rootless.
+func CheckNetworkPrivileges() error {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		return errx.Wrap(ErrReadCapabilities, err)
+	}
+	capEff, err := parseCapEff(string(status))
+	if err != nil {
+		return err
+	}
+	if capEff&(1<<capNetAdmin) == 0 {
+		return errx.With(ErrMissingNetAdmin, ": run 'sudo matchlock setup linux' to grant it to the matchlock binary, or run as root")
+	}
+	return nil
+}
+
+// retainedCapabilities are what a root process keeps once the sandbox is up.
+// The network ones cover TAP/nftables teardown, raw sockets and privileged
+// port forwards. The file ones let the VFS server work on host volumes owned
+// by other users. Mounts, module loading, ptrace and uid changes go.
+var retainedCapabilities = []int{
+	unix.CAP_NET_ADMIN,
+	unix.CAP_NET_RAW,
+	unix.CAP_NET_BIND_SERVICE,
+	unix.CAP_DAC_OVERRIDE,
+	unix.CAP_CHOWN,
+	unix.CAP_FOWNER,
+	unix.CAP_FSETID,
+}
+
+func retainedCapabilityMask() uint64 {
+	var mask uint64
+	for _, c := range retainedCapabilities {
+		mask |= 1 << c
+	}
+	return mask
+}
+
+// DropPrivileges narrows a root process to retainedCapabilities for the
+// long-running proxy, VFS and exec-forwarding phase. The bounding set is
+// trimmed too, and no_new_privs is set, so helpers it spawns later (e2fsck,
+// debugfs, firecracker) cannot regain the rest. It is a no-op for a rootless
+// process, which only holds the capabilities granted to the binary.
+//
+// Every thread is updated, which the Go runtime only supports without cgo;
+// a cgo build fails here rather than keep running as full root.
+func DropPrivileges() error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_CAPBSET_READ, 0, 0); errno == unix.ENOTSUP {
+		return errx.With(ErrDropPrivileges, ": matchlock was built with cgo; rebuild with CGO_ENABLED=0 or run it rootless via 'sudo matchlock setup linux'")
+	}
+	keep := retainedCapabilityMask()
+	for c := 0; c <= unix.CAP_LAST_CAP; c++ {
+		if keep&(1<<c) != 0 {
+			continue
+		}
+		_, _, errno := syscall.AllThreadsSyscall6(unix.SYS_PRCTL, unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0, 0)
+		// EINVAL: the running kernel predates this capability.
+		if errno != 0 && errno != unix.EINVAL {
+			return errx.Wrap(ErrDropPrivileges, errno)
+		}
+	}
+	if _, _, errno := syscall.AllThreadsSyscall6(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0, 0); errno != 0 {
+		return errx.Wrap(ErrDropPrivileges, errno)
+	}
+
+	hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{
+		{Effective: uint32(keep), Permitted: uint32(keep)},
+		{Effective: uint32(keep >> 32), Permitted: uint32(keep >> 32)},
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(unix.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return errx.Wrap(ErrDropPrivileges, errno)
+	}
+	return nil
+}
+
+// parseCapEff extracts the effective capability mask from /proc/<pid>/status.
+func parseCapEff(status string) (uint64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(status))
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "CapEff:")
+		if !ok {
+			continue
+		}
+		capEff, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return 0, errx.Wrap(ErrReadCapabilities, err)
+		}
+		return capEff, nil
+	}
+	return 0, errx.With(ErrReadCapabilities, ": CapEff not found")
+}
@@ -0,0 +1,110 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestParseCapEff(t *testing.T) {
+	status := "Name:\tmatchlock\nCapInh:\t0000000000000000\nCapPrm:\t0000000000003000\nCapEff:\t0000000000003000\n"
+	capEff, err := parseCapEff(status)
+	require.NoError(t, err)
+	assert.NotZero(t, capEff&(1<<capNetAdmin))
+
+	capEff, err = parseCapEff("CapEff:\t0000000000000000\n")
+	require.NoError(t, err)
+	assert.Zero(t, capEff&(1<<capNetAdmin))
+}
+
+func TestParseCapEffMissing(t *testing.T) {
+	_, err := parseCapEff("Name:\tmatchlock\n")
+	require.ErrorIs(t, err, ErrReadCapabilities)
+}
+
+func TestRetainedCapabilityMask(t *testing.T) {
+	mask := retainedCapabilityMask()
+	assert.NotZero(t, mask&(1<<capNetAdmin), "TAP and nftables teardown need CAP_NET_ADMIN")
+	assert.Zero(t, mask&(1<<unix.CAP_SYS_ADMIN))
+	assert.Zero(t, mask&(1<<unix.CAP_SYS_PTRACE))
+	assert.Zero(t, mask&(1<<unix.CAP_SETUID))
+}
+
+const dropHelperEnv = "MATCHLOCK_DROP_PRIVILEGES_HELPER"
+
+// TestDropPrivilegesHelperProcess is not a real test: TestDropPrivileges runs
+// it in a child process, which drops privileges and prints its
+// /proc/self/status, so the test process itself keeps root.
+func TestDropPrivilegesHelperProcess(t *testing.T) {
+	if os.Getenv(dropHelperEnv) == "" {
+		return
+	}
+	if err := DropPrivileges(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Stdout.Write(status)
+	os.Exit(0)
+}
+
+// statusField returns the value of field in /proc/<pid>/status.
+func statusField(t *testing.T, status, field string) string {
+	t.Helper()
+	scanner := bufio.NewScanner(strings.NewReader(status))
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), field+":"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	t.Fatalf("%s not found in status", field)
+	return ""
+}
+
+func statusMask(t *testing.T, status, field string) uint64 {
+	t.Helper()
+	mask, err := strconv.ParseUint(statusField(t, status, field), 16, 64)
+	require.NoError(t, err)
+	return mask
+}
+
+func TestDropPrivileges(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("dropping privileges needs root")
+	}
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	cmd := exec.Command(exe, "-test.run=^TestDropPrivilegesHelperProcess$")
+	cmd.Env = append(os.Environ(), dropHelperEnv+"=1")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if strings.Contains(stderr.String(), "built with cgo") {
+		t.Skip("test binary links cgo; run with CGO_ENABLED=0")
+	}
+	require.NoError(t, err, stderr.String())
+	status := string(out)
+
+	keep := retainedCapabilityMask()
+	capEff, err := parseCapEff(status)
+	require.NoError(t, err)
+	assert.Equal(t, keep, capEff, "CapEff")
+	assert.Equal(t, keep, statusMask(t, status, "CapPrm"), "CapPrm")
+	assert.Equal(t, keep, statusMask(t, status, "CapBnd"), "CapBnd")
+	assert.Zero(t, statusMask(t, status, "CapInh"), "CapInh")
+	assert.Equal(t, "1", statusField(t, status, "NoNewPrivs"))
+}
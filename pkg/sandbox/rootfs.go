@@ -1,9 +1,12 @@
 package sandbox
 
 import (
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -33,7 +36,7 @@ func prepareRootfs(rootfsPath string, diskSizeMB int64) error {
 	// Build debugfs commands to inject all components.
 	// debugfs cannot traverse symlinks, so we write to both /sbin/ and /usr/sbin/
 	// to handle distros where /sbin is real (Alpine) or a symlink (Ubuntu).
-	// rm before write because debugfs write silently fails on existing files.
+	// Components are owned by root whoever runs matchlock.
 	var commands []string
 
 	// Create directories that may not exist (mkdir on existing dirs/symlinks is harmless)
@@ -51,29 +54,24 @@ func prepareRootfs(rootfsPath string, diskSizeMB int64) error {
 		commands = append(commands, fmt.Sprintf("mkdir %s", dir))
 	}
 
-	type injection struct {
-		hostPath  string
-		guestPath string
-	}
-
-	injections := []injection{
-		{guestInitPath, "/opt/matchlock/guest-init"},
-		{guestInitPath, "/opt/matchlock/guest-agent"},
-		{guestInitPath, "/opt/matchlock/guest-fused"},
+	for _, guestPath := range []string{
+		"/opt/matchlock/guest-init",
+		"/opt/matchlock/guest-agent",
+		"/opt/matchlock/guest-fused",
 		// Write init binary to both real and usr-merged paths for cross-distro compat.
-		{guestInitPath, "/sbin/matchlock-init"},
-		{guestInitPath, "/usr/sbin/matchlock-init"},
+		"/sbin/matchlock-init",
+		"/usr/sbin/matchlock-init",
 		// The kernel cmdline uses init=/init to boot guest-init directly.
-		{guestInitPath, "/init"},
+		"/init",
 		// NOTE: We intentionally do NOT overwrite /sbin/init or /usr/sbin/init.
 		// Images with ENTRYPOINT ["/sbin/init"] (e.g. systemd) would re-execute
 		// the image's init, while matchlock boots through init=/init.
-	}
-
-	for _, inj := range injections {
-		commands = append(commands, fmt.Sprintf("rm %s", inj.guestPath))
-		commands = append(commands, fmt.Sprintf("write %s %s", inj.hostPath, inj.guestPath))
-		commands = append(commands, fmt.Sprintf("set_inode_field %s mode 0100755", inj.guestPath))
+	} {
+		commands = append(commands, debugfsWriteCommands(rootfsFile{
+			hostPath:  guestInitPath,
+			guestPath: guestPath,
+			mode:      0755,
+		})...)
 	}
 
 	cmdStr := strings.Join(commands, "\n")
@@ -129,10 +127,183 @@ func resizeRootfs(rootfsPath string, sizeMB int64) error {
 	return nil
 }
 
+// rootfsFile is a host file to place in an ext4 image with debugfs.
+type rootfsFile struct {
+	hostPath  string
+	guestPath string
+	// mode holds the permission bits plus setuid, setgid and sticky.
+	mode     os.FileMode
+	uid, gid int
+}
+
+// debugfsWriteCommands returns the debugfs requests that replace
+// f.guestPath with f.hostPath. The owner is always set explicitly: debugfs
+// write copies the host file's owner, which is the invoking user rather
+// than root when matchlock runs unprivileged.
+func debugfsWriteCommands(f rootfsFile) []string {
+	quoted := debugfsQuote(f.guestPath)
+	// rm before write because debugfs write silently fails on existing files.
+	return []string{
+		fmt.Sprintf("rm %s", quoted),
+		fmt.Sprintf("write %s %s", debugfsQuote(f.hostPath), quoted),
+		fmt.Sprintf("set_inode_field %s mode 0%o", quoted, 0o100000|unixModeBits(f.mode)),
+		fmt.Sprintf("set_inode_field %s uid %d", quoted, f.uid),
+		fmt.Sprintf("set_inode_field %s gid %d", quoted, f.gid),
+	}
+}
+
+// unixModeBits converts mode to st_mode permission bits, keeping setuid,
+// setgid and sticky, which os.FileMode.Perm drops.
+func unixModeBits(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
+
+// validateRootfsPath rejects guest paths that debugfs would misparse or
+// that could resolve outside the intended location: relative or unclean
+// paths, and paths with newlines, NUL bytes or double quotes.
+func validateRootfsPath(p string) error {
+	if !path.IsAbs(p) || path.Clean(p) != p {
+		return errx.With(ErrUnsafeRootfsPath, ": %q is not a clean absolute path", p)
+	}
+	if strings.ContainsAny(p, "\n\r\x00\"") {
+		return errx.With(ErrUnsafeRootfsPath, ": %q", p)
+	}
+	return nil
+}
+
+// debugfsQuote quotes an argument for a debugfs request so that paths
+// containing spaces survive its tokenizer. Arguments must already have
+// passed validateRootfsPath.
+func debugfsQuote(s string) string {
+	if !strings.ContainsAny(s, " \t") {
+		return s
+	}
+	return `"` + s + `"`
+}
+
+// mkdirParentsCommands returns debugfs mkdir requests for every parent of
+// guestPath. mkdir on an existing directory is a harmless error, and the
+// owner and mode of existing directories are left alone.
+func mkdirParentsCommands(guestPath string) []string {
+	var dirs []string
+	for d := path.Dir(guestPath); d != "/" && d != "."; d = path.Dir(d) {
+		dirs = append([]string{d}, dirs...)
+	}
+	commands := make([]string, 0, len(dirs))
+	for _, d := range dirs {
+		commands = append(commands, fmt.Sprintf("mkdir %s", debugfsQuote(d)))
+	}
+	return commands
+}
+
+func runDebugfs(rootfsPath string, commands []string) error {
+	cmd := exec.Command("debugfs", "-w", rootfsPath)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n"))
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return errx.With(ErrDebugfs, ": %w: %s", err, output)
+	}
+	return nil
+}
+
+// removeFromRootfs deletes a file from an ext4 image using debugfs. A
+// missing file is not an error.
+func removeFromRootfs(rootfsPath, guestPath string) error {
+	if err := validateRootfsPath(guestPath); err != nil {
+		return err
+	}
+	return runDebugfs(rootfsPath, []string{fmt.Sprintf("rm %s", debugfsQuote(guestPath))})
+}
+
+// injectDirIntoRootfs copies the tree under hostDir into an ext4 image at
+// guestDir using debugfs, creating guestDir and its parents as needed.
+// Modes, including setuid/setgid/sticky, and symlinks are preserved; every
+// copied entry is owned by uid:gid.
+func injectDirIntoRootfs(rootfsPath, hostDir, guestDir string, uid, gid int) error {
+	if err := validateRootfsPath(guestDir); err != nil {
+		return err
+	}
+	commands := mkdirParentsCommands(guestDir)
+
+	err := filepath.Walk(hostDir, func(hostPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(hostDir, hostPath)
+		if err != nil {
+			return err
+		}
+		guestPath := path.Join(guestDir, filepath.ToSlash(rel))
+		if err := validateRootfsPath(guestPath); err != nil {
+			return err
+		}
+		quoted := debugfsQuote(guestPath)
+		mode := info.Mode()
+		switch {
+		case mode.IsDir():
+			commands = append(commands,
+				fmt.Sprintf("mkdir %s", quoted),
+				fmt.Sprintf("set_inode_field %s mode 0%o", quoted, 0o40000|unixModeBits(mode)))
+		case mode&os.ModeSymlink != 0:
+			target, err := os.Readlink(hostPath)
+			if err != nil {
+				return err
+			}
+			if strings.ContainsAny(target, "\n\r\x00\"") {
+				return errx.With(ErrUnsafeRootfsPath, ": symlink target %q", target)
+			}
+			commands = append(commands,
+				fmt.Sprintf("rm %s", quoted),
+				fmt.Sprintf("symlink %s %s", quoted, debugfsQuote(target)))
+		case mode.IsRegular():
+			commands = append(commands, debugfsWriteCommands(rootfsFile{
+				hostPath:  hostPath,
+				guestPath: guestPath,
+				mode:      mode,
+				uid:       uid,
+				gid:       gid,
+			})...)
+			return nil
+		default:
+			return nil
+		}
+		commands = append(commands,
+			fmt.Sprintf("set_inode_field %s uid %d", quoted, uid),
+			fmt.Sprintf("set_inode_field %s gid %d", quoted, gid))
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrUnsafeRootfsPath) {
+			return err
+		}
+		return errx.With(ErrDebugfs, ": walk %s: %w", hostDir, err)
+	}
+	return runDebugfs(rootfsPath, commands)
+}
+
 // injectConfigFileIntoRootfs writes a config file with 0644 into an ext4 image using debugfs.
 // This allows injecting files (like CA certs) without mounting the filesystem.
 // Requires debugfs to be installed (part of e2fsprogs).
 func injectConfigFileIntoRootfs(rootfsPath, guestPath string, content []byte) error {
+	return injectFileIntoRootfs(rootfsPath, guestPath, content, 0644, 0, 0)
+}
+
+// injectFileIntoRootfs writes content to guestPath in an ext4 image with the
+// given mode and owner, creating missing parent directories.
+func injectFileIntoRootfs(rootfsPath, guestPath string, content []byte, mode os.FileMode, uid, gid int) error {
+	if err := validateRootfsPath(guestPath); err != nil {
+		return err
+	}
+
 	tmpFile, err := os.CreateTemp("", "inject-*")
 	if err != nil {
 		return errx.Wrap(ErrCreateTemp, err)
@@ -146,27 +317,93 @@ func injectConfigFileIntoRootfs(rootfsPath, guestPath string, content []byte) er
 	}
 	tmpFile.Close()
 
-	var commands []string
-	dir := filepath.Dir(guestPath)
-	if dir != "/" && dir != "." {
-		var dirs []string
-		for d := dir; d != "/" && d != "."; d = filepath.Dir(d) {
-			dirs = append([]string{d}, dirs...)
-		}
-		for _, d := range dirs {
-			commands = append(commands, fmt.Sprintf("mkdir %s", d))
-		}
+	commands := mkdirParentsCommands(guestPath)
+	commands = append(commands, debugfsWriteCommands(rootfsFile{
+		hostPath:  tmpPath,
+		guestPath: guestPath,
+		mode:      mode,
+		uid:       uid,
+		gid:       gid,
+	})...)
+	return runDebugfs(rootfsPath, commands)
+}
+
+// ext4 superblock fields read by checkRootfsSuperblock (see the kernel's
+// fs/ext4/ext4.h).
+const (
+	ext4SuperblockOffset   = 1024
+	ext4SuperblockSize     = 1024
+	ext4BlocksCountLo      = 0x04
+	ext4LogBlockSize       = 0x18
+	ext4Magic              = 0x38
+	ext4FeatureIncompat    = 0x60
+	ext4BlocksCountHi      = 0x150
+	ext4MagicValue         = 0xEF53
+	ext4FeatureIncompat64b = 0x80
+)
+
+// checkRootfs verifies that rootfsPath holds a usable ext4 filesystem, so a
+// truncated or corrupt disk fails create with ErrRootfsCorrupt rather than
+// a kernel panic when the guest mounts it. The superblock check always
+// runs; full adds a read-only e2fsck pass when e2fsck is installed.
+func checkRootfs(rootfsPath string, full bool) error {
+	if err := checkRootfsSuperblock(rootfsPath); err != nil {
+		return err
+	}
+	if !full {
+		return nil
+	}
+	e2fsckPath, err := exec.LookPath("e2fsck")
+	if err != nil {
+		return nil
+	}
+	if out, err := exec.Command(e2fsckPath, "-fn", rootfsPath).CombinedOutput(); err != nil {
+		return errx.With(ErrRootfsCorrupt, ": %s: e2fsck: %w: %s", rootfsPath, err, lastLines(string(out), 5))
 	}
-	commands = append(commands, fmt.Sprintf("rm %s", guestPath))
-	commands = append(commands, fmt.Sprintf("write %s %s", tmpPath, guestPath))
-	commands = append(commands, fmt.Sprintf("set_inode_field %s mode 0100644", guestPath))
+	return nil
+}
 
-	cmdStr := strings.Join(commands, "\n")
-	cmd := exec.Command("debugfs", "-w", rootfsPath)
-	cmd.Stdin = strings.NewReader(cmdStr)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return errx.With(ErrDebugfs, ": %w: %s", err, output)
+// checkRootfsSuperblock checks the ext4 magic and that the filesystem fits
+// in the file, which catches empty, truncated and non-ext4 images.
+func checkRootfsSuperblock(rootfsPath string) error {
+	f, err := os.Open(rootfsPath)
+	if err != nil {
+		return errx.With(ErrRootfsCorrupt, ": %w", err)
+	}
+	defer f.Close()
+
+	sb := make([]byte, ext4SuperblockSize)
+	if _, err := f.ReadAt(sb, ext4SuperblockOffset); err != nil {
+		return errx.With(ErrRootfsCorrupt, ": %s: read superblock: %w", rootfsPath, err)
+	}
+	if magic := binary.LittleEndian.Uint16(sb[ext4Magic:]); magic != ext4MagicValue {
+		return errx.With(ErrRootfsCorrupt, ": %s: bad ext4 magic %#x", rootfsPath, magic)
+	}
+
+	logBlockSize := binary.LittleEndian.Uint32(sb[ext4LogBlockSize:])
+	if logBlockSize > 6 {
+		return errx.With(ErrRootfsCorrupt, ": %s: invalid block size exponent %d", rootfsPath, logBlockSize)
+	}
+	blocks := uint64(binary.LittleEndian.Uint32(sb[ext4BlocksCountLo:]))
+	if binary.LittleEndian.Uint32(sb[ext4FeatureIncompat:])&ext4FeatureIncompat64b != 0 {
+		blocks |= uint64(binary.LittleEndian.Uint32(sb[ext4BlocksCountHi:])) << 32
 	}
+	fsSize := blocks * (1024 << logBlockSize)
 
+	fi, err := f.Stat()
+	if err != nil {
+		return errx.With(ErrRootfsCorrupt, ": %w", err)
+	}
+	if uint64(fi.Size()) < fsSize {
+		return errx.With(ErrRootfsCorrupt, ": %s: file is %d bytes but the filesystem needs %d (truncated copy?)", rootfsPath, fi.Size(), fsSize)
+	}
 	return nil
 }
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -49,6 +49,22 @@ func debugfsStatMode(t *testing.T, rootfsPath, guestPath string) string {
 	return ""
 }
 
+// debugfsStatOwner returns the uid and gid debugfs reports for guestPath.
+func debugfsStatOwner(t *testing.T, rootfsPath, guestPath string) (string, string) {
+	t.Helper()
+	cmd := exec.Command("debugfs", "-R", "stat "+guestPath, rootfsPath)
+	out, err := cmd.Output()
+	require.NoError(t, err, "debugfs stat failed")
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[0] == "User:" && fields[2] == "Group:" {
+			return fields[1], fields[3]
+		}
+	}
+	t.Fatalf("no owner in debugfs stat output: %s", out)
+	return "", ""
+}
+
 func debugfsCat(t *testing.T, rootfsPath, guestPath string) string {
 	t.Helper()
 	cmd := exec.Command("debugfs", "-R", "cat "+guestPath, rootfsPath)
@@ -110,3 +126,163 @@ func TestInjectConfigFileIntoRootfs_Overwrites(t *testing.T) {
 	got := debugfsCat(t, rootfs, "/etc/test.conf")
 	assert.Equal(t, "second", got)
 }
+
+func TestInjectDirIntoRootfs(t *testing.T) {
+	if !hasDebugfs() || !hasMkfsExt4() {
+		t.Skip("debugfs or mkfs.ext4 not available")
+	}
+
+	rootfs := createTestExt4(t, 10)
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub dir"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub dir", "data.txt"), []byte("hello"), 0600))
+	require.NoError(t, os.Symlink("run.sh", filepath.Join(src, "link")))
+
+	require.NoError(t, injectDirIntoRootfs(rootfs, src, "/opt/app", 1000, 1000))
+
+	assert.Equal(t, "#!/bin/sh\n", debugfsCat(t, rootfs, "/opt/app/run.sh"))
+	assert.Contains(t, debugfsStatMode(t, rootfs, "/opt/app/run.sh"), "0755")
+	assert.Equal(t, "hello", debugfsCat(t, rootfs, `"/opt/app/sub dir/data.txt"`))
+	assert.Contains(t, debugfsStatMode(t, rootfs, `"/opt/app/sub dir/data.txt"`), "0600")
+	assert.Contains(t, debugfsStatMode(t, rootfs, `"/opt/app/sub dir"`), "0750")
+	uid, gid := debugfsStatOwner(t, rootfs, `"/opt/app/sub dir/data.txt"`)
+	assert.Equal(t, "1000", uid)
+	assert.Equal(t, "1000", gid)
+
+	out, err := exec.Command("debugfs", "-R", "stat /opt/app/link", rootfs).Output()
+	require.NoError(t, err)
+	assert.Contains(t, string(out), `Fast link dest: "run.sh"`)
+}
+
+func TestRemoveFromRootfs(t *testing.T) {
+	if !hasDebugfs() || !hasMkfsExt4() {
+		t.Skip("debugfs or mkfs.ext4 not available")
+	}
+
+	rootfs := createTestExt4(t, 10)
+	require.NoError(t, injectConfigFileIntoRootfs(rootfs, caCertGuestPath, []byte("ca")))
+
+	require.NoError(t, removeFromRootfs(rootfs, caCertGuestPath))
+	out, _ := exec.Command("debugfs", "-R", "stat "+caCertGuestPath, rootfs).CombinedOutput()
+	assert.Contains(t, string(out), "File not found")
+
+	require.NoError(t, removeFromRootfs(rootfs, caCertGuestPath), "removing a missing file is not an error")
+}
+
+func TestFsckRootfs(t *testing.T) {
+	if _, err := exec.LookPath("e2fsck"); err != nil || !hasMkfsExt4() {
+		t.Skip("e2fsck or mkfs.ext4 not available")
+	}
+
+	rootfs := createTestExt4(t, 10)
+	require.NoError(t, fsckRootfs(rootfs))
+
+	notExt4 := filepath.Join(t.TempDir(), "garbage.ext4")
+	require.NoError(t, os.WriteFile(notExt4, make([]byte, 1024*1024), 0644))
+	assert.ErrorIs(t, fsckRootfs(notExt4), ErrE2fsck)
+}
+
+func TestInjectFileIntoRootfs_PreservesModeAndOwner(t *testing.T) {
+	if !hasDebugfs() || !hasMkfsExt4() {
+		t.Skip("debugfs or mkfs.ext4 not available")
+	}
+
+	rootfs := createTestExt4(t, 10)
+
+	require.NoError(t, injectFileIntoRootfs(rootfs, "/usr/bin/suid", []byte("x"), 0755|os.ModeSetuid, 1000, 2000))
+	assert.Contains(t, debugfsStatMode(t, rootfs, "/usr/bin/suid"), "04755")
+	uid, gid := debugfsStatOwner(t, rootfs, "/usr/bin/suid")
+	assert.Equal(t, "1000", uid)
+	assert.Equal(t, "2000", gid)
+
+	require.NoError(t, injectFileIntoRootfs(rootfs, "/usr/bin/sgid", []byte("x"), 0750|os.ModeSetgid, 0, 50))
+	assert.Contains(t, debugfsStatMode(t, rootfs, "/usr/bin/sgid"), "02750")
+	_, gid = debugfsStatOwner(t, rootfs, "/usr/bin/sgid")
+	assert.Equal(t, "50", gid)
+}
+
+func TestInjectConfigFileIntoRootfs_OwnedByRoot(t *testing.T) {
+	if !hasDebugfs() || !hasMkfsExt4() {
+		t.Skip("debugfs or mkfs.ext4 not available")
+	}
+
+	rootfs := createTestExt4(t, 10)
+
+	require.NoError(t, injectConfigFileIntoRootfs(rootfs, "/etc/test.conf", []byte("data")))
+	uid, gid := debugfsStatOwner(t, rootfs, "/etc/test.conf")
+	assert.Equal(t, "0", uid)
+	assert.Equal(t, "0", gid)
+}
+
+func TestInjectFileIntoRootfs_RejectsUnsafePaths(t *testing.T) {
+	for _, p := range []string{
+		"etc/relative",
+		"/etc/../../escape",
+		"/etc//double",
+		"/etc/new\nline",
+		"/etc/car\rriage",
+		"/etc/nul\x00byte",
+		`/etc/quo"te`,
+	} {
+		err := injectFileIntoRootfs("/nonexistent.ext4", p, []byte("x"), 0644, 0, 0)
+		assert.ErrorIs(t, err, ErrUnsafeRootfsPath, "path %q", p)
+	}
+}
+
+func TestInjectDirIntoRootfs_RejectsUnsafeNames(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "bad\nname"), []byte("x"), 0644))
+
+	err := injectDirIntoRootfs("/nonexistent.ext4", src, "/opt/app", 0, 0)
+	assert.ErrorIs(t, err, ErrUnsafeRootfsPath)
+}
+
+func TestUnixModeBits(t *testing.T) {
+	assert.Equal(t, uint32(0o644), unixModeBits(0644))
+	assert.Equal(t, uint32(0o4755), unixModeBits(0755|os.ModeSetuid))
+	assert.Equal(t, uint32(0o2755), unixModeBits(0755|os.ModeSetgid))
+	assert.Equal(t, uint32(0o1777), unixModeBits(0777|os.ModeSticky))
+}
+
+func TestCheckRootfs(t *testing.T) {
+	if !hasMkfsExt4() {
+		t.Skip("mkfs.ext4 not available")
+	}
+
+	rootfs := createTestExt4(t, 10)
+	require.NoError(t, checkRootfs(rootfs, true))
+
+	empty := filepath.Join(t.TempDir(), "empty.ext4")
+	require.NoError(t, os.WriteFile(empty, nil, 0644))
+	assert.ErrorIs(t, checkRootfs(empty, false), ErrRootfsCorrupt)
+
+	zeros := filepath.Join(t.TempDir(), "zeros.ext4")
+	require.NoError(t, os.WriteFile(zeros, make([]byte, 1024*1024), 0644))
+	err := checkRootfs(zeros, false)
+	require.ErrorIs(t, err, ErrRootfsCorrupt)
+	assert.Contains(t, err.Error(), "bad ext4 magic")
+
+	require.NoError(t, os.Truncate(rootfs, 5*1024*1024))
+	err = checkRootfs(rootfs, false)
+	require.ErrorIs(t, err, ErrRootfsCorrupt)
+	assert.Contains(t, err.Error(), "truncated")
+}
+
+func TestCheckRootfsFullDetectsCorruption(t *testing.T) {
+	if _, err := exec.LookPath("e2fsck"); err != nil || !hasMkfsExt4() {
+		t.Skip("e2fsck or mkfs.ext4 not available")
+	}
+
+	rootfs := createTestExt4(t, 10)
+	// Zero the block group descriptors that follow the superblock; the
+	// superblock itself stays intact.
+	f, err := os.OpenFile(rootfs, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt(make([]byte, 4096), 4096)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, checkRootfs(rootfs, false), "superblock alone looks fine")
+	assert.ErrorIs(t, checkRootfs(rootfs, true), ErrRootfsCorrupt)
+}
@@ -2,10 +2,13 @@ package sandbox
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/api"
 	sandboxnet "github.com/jingkaihe/matchlock/pkg/net"
 	"github.com/jingkaihe/matchlock/pkg/policy"
@@ -13,11 +16,60 @@ import (
 	"github.com/jingkaihe/matchlock/pkg/vm"
 )
 
-func buildVFSProviders(config *api.Config, workspace string) map[string]vfs.Provider {
+// resolveAutoMTU fills in the guest MTU from the host's outbound interface
+// when AutoMTU is requested and no explicit MTU was given. Detection failures
+// fall back to the default MTU.
+func resolveAutoMTU(config *api.Config, detect func(target string) (int, error)) {
+	network := config.Network
+	if network == nil || !network.AutoMTU || network.MTU > 0 {
+		return
+	}
+	mtu, err := detect("")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v; using default MTU %d\n", err, api.DefaultNetworkMTU)
+		return
+	}
+	network.MTU = mtu
+}
+
+// resolveCapabilities converts the config's CapAdd/CapDrop names into the
+// capability numbers passed to the guest on the kernel cmdline, and
+// normalizes AllowSyscalls.
+func resolveCapabilities(config *api.Config) (capAdd, capDrop []int, err error) {
+	if capAdd, err = api.CapabilityNumbers(config.CapAdd); err != nil {
+		return nil, nil, errx.With(ErrInvalidCapabilities, " (cap_add): %w", err)
+	}
+	if capDrop, err = api.CapabilityNumbers(config.CapDrop); err != nil {
+		return nil, nil, errx.With(ErrInvalidCapabilities, " (cap_drop): %w", err)
+	}
+	if config.AllowSyscalls, err = api.NormalizeAllowSyscalls(config.AllowSyscalls); err != nil {
+		return nil, nil, errx.With(ErrInvalidCapabilities, " (allow_syscalls): %w", err)
+	}
+	return capAdd, capDrop, nil
+}
+
+// warnWeakenedIsolation logs each setting that weakens guest isolation and
+// records it as a "security" event, so privileged sandboxes stand out in
+// both the console and the event history.
+func warnWeakenedIsolation(config *api.Config, events *api.EventSink) {
+	for _, warning := range config.IsolationWarnings() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		events.Emit(api.Event{
+			Type:      string(api.EventTypeSecurity),
+			Timestamp: time.Now().UnixMilli(),
+			Security:  &api.SecurityEvent{Warning: warning},
+		})
+	}
+}
+
+func buildVFSProviders(config *api.Config, workspace string) (map[string]vfs.Provider, error) {
 	vfsProviders := make(map[string]vfs.Provider)
 	if config.VFS != nil && config.VFS.Mounts != nil {
 		for path, mount := range config.VFS.Mounts {
-			provider := createProvider(mount)
+			provider, err := vfs.BuildProvider(mount)
+			if err != nil {
+				return nil, errx.With(ErrBuildVFSProvider, " %s: %w", path, err)
+			}
 			vfsProviders[path] = provider
 		}
 	}
@@ -37,7 +89,85 @@ func buildVFSProviders(config *api.Config, workspace string) map[string]vfs.Prov
 		vfsProviders[cleanWorkspace] = vfs.NewMemoryProvider()
 	}
 
-	return vfsProviders
+	return vfsProviders, nil
+}
+
+// addSecretFileMounts mounts a read-only file for every secret delivered via
+// File. It must run after policy.NewEngine has filled in the placeholders.
+// The file holds the placeholder unless the secret opted into FileRaw.
+// Validate has already rejected paths that collide with VFS mounts.
+// It returns the mounted paths, which export and commit skip so a raw
+// value never leaves the VM.
+func addSecretFileMounts(providers map[string]vfs.Provider, config *api.Config) map[string]struct{} {
+	if config.Network == nil {
+		return nil
+	}
+	files := make(map[string]struct{})
+	for _, secret := range config.Network.Secrets {
+		if secret.File == "" {
+			continue
+		}
+		content := secret.Placeholder
+		if secret.FileRaw {
+			content = secret.Value
+		}
+		file := filepath.Clean(secret.File)
+		providers[file] = vfs.NewStaticFileProvider([]byte(content), 0444)
+		files[file] = struct{}{}
+	}
+	return files
+}
+
+// vfsServerOptions returns the VFS server options config asks for.
+func vfsServerOptions(config *api.Config) []vfs.ServerOption {
+	if config.VFS == nil || config.VFS.CompressMinBytes <= 0 {
+		return nil
+	}
+	return []vfs.ServerOption{vfs.WithCompression(config.VFS.CompressMinBytes)}
+}
+
+// watchedMountPaths returns the guest paths of mounts with watch enabled.
+func watchedMountPaths(config *api.Config) []string {
+	if config.VFS == nil {
+		return nil
+	}
+	var paths []string
+	for path, mount := range config.VFS.Mounts {
+		if mount.Watch {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// workspaceProvider returns the provider mounted at the workspace root.
+func workspaceProvider(providers map[string]vfs.Provider, workspace string) vfs.Provider {
+	cleanWorkspace := filepath.Clean(workspace)
+	for path, provider := range providers {
+		if filepath.Clean(path) == cleanWorkspace {
+			return provider
+		}
+	}
+	return nil
+}
+
+func snapshotWorkspace(workspaceFS vfs.Provider) (string, error) {
+	snapshotter, ok := workspaceFS.(vfs.Snapshotter)
+	if !ok {
+		return "", ErrSnapshotUnsupported
+	}
+	return string(snapshotter.Snapshot()), nil
+}
+
+func restoreWorkspace(workspaceFS vfs.Provider, id string) error {
+	snapshotter, ok := workspaceFS.(vfs.Snapshotter)
+	if !ok {
+		return ErrSnapshotUnsupported
+	}
+	if err := snapshotter.Restore(vfs.SnapshotID(id)); err != nil {
+		return errx.With(ErrRestoreWorkspace, " %q: %w", id, err)
+	}
+	return nil
 }
 
 func prepareExecEnv(config *api.Config, caPool *sandboxnet.CAPool, pol *policy.Engine) *api.ExecOptions {
@@ -61,23 +191,45 @@ func prepareExecEnv(config *api.Config, caPool *sandboxnet.CAPool, pol *policy.E
 	for k, v := range config.Env {
 		opts.Env[k] = v
 	}
+	for k, v := range injectedExecEnv(config, caPool, pol) {
+		opts.Env[k] = v
+	}
+	return opts
+}
 
+// injectedExecEnv is the env matchlock itself sets for guest commands: the
+// interception CA bundle paths and secret placeholders. Callers' env never
+// overrides it, or TLS interception and secret substitution would break.
+func injectedExecEnv(config *api.Config, caPool *sandboxnet.CAPool, pol *policy.Engine) map[string]string {
+	env := make(map[string]string)
 	if caPool != nil {
 		certPath := "/etc/ssl/certs/matchlock-ca.crt"
-		opts.Env["SSL_CERT_FILE"] = certPath
-		opts.Env["REQUESTS_CA_BUNDLE"] = certPath
-		opts.Env["CURL_CA_BUNDLE"] = certPath
-		opts.Env["NODE_EXTRA_CA_CERTS"] = certPath
+		env["SSL_CERT_FILE"] = certPath
+		env["REQUESTS_CA_BUNDLE"] = certPath
+		env["CURL_CA_BUNDLE"] = certPath
+		env["NODE_EXTRA_CA_CERTS"] = certPath
 	}
 	if pol != nil {
 		for name, placeholder := range pol.GetPlaceholders() {
-			opts.Env[name] = placeholder
+			if config.Network != nil && config.Network.Secrets[name].File != "" {
+				continue
+			}
+			env[name] = placeholder
 		}
 	}
-	return opts
+	return env
 }
 
-func execCommand(ctx context.Context, machine vm.Machine, config *api.Config, caPool *sandboxnet.CAPool, pol *policy.Engine, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+// imageUser is the image USER (or its override) that guest commands run as
+// when an exec names no user.
+func imageUser(config *api.Config) string {
+	if config.ImageCfg == nil {
+		return ""
+	}
+	return config.ImageCfg.User
+}
+
+func mergeExecEnv(config *api.Config, caPool *sandboxnet.CAPool, pol *policy.Engine, opts *api.ExecOptions) *api.ExecOptions {
 	if opts == nil {
 		opts = &api.ExecOptions{}
 	}
@@ -92,11 +244,35 @@ func execCommand(ctx context.Context, machine vm.Machine, config *api.Config, ca
 	if opts.User == "" {
 		opts.User = prepared.User
 	}
+	// Per-exec env wins over image ENV and config env, but not over the
+	// CA paths and secret placeholders matchlock injects.
 	for k, v := range prepared.Env {
+		if _, ok := opts.Env[k]; !ok {
+			opts.Env[k] = v
+		}
+	}
+	for k, v := range injectedExecEnv(config, caPool, pol) {
 		opts.Env[k] = v
 	}
+	return opts
+}
 
-	return machine.Exec(ctx, command, opts)
+func execCommand(ctx context.Context, machine vm.Machine, config *api.Config, caPool *sandboxnet.CAPool, pol *policy.Engine, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	return machine.Exec(ctx, command, mergeExecEnv(config, caPool, pol, opts))
+}
+
+func execInteractive(ctx context.Context, machine vm.Machine, config *api.Config, caPool *sandboxnet.CAPool, pol *policy.Engine, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error) {
+	interactive, ok := machine.(vm.InteractiveMachine)
+	if !ok {
+		return 1, ErrInteractiveUnsupported
+	}
+	if err := opts.Validate(); err != nil {
+		return 1, err
+	}
+	return interactive.ExecInteractive(ctx, command, mergeExecEnv(config, caPool, pol, opts), rows, cols, stdin, stdout, resizeCh)
 }
 
 func writeFile(vfsRoot vfs.Provider, path string, content []byte, mode uint32) error {
@@ -112,33 +288,61 @@ func writeFile(vfsRoot vfs.Provider, path string, content []byte, mode uint32) e
 	return err
 }
 
+// readFile reads path until EOF. Handles may return short reads (host
+// files, FUSE-backed mounts), so a single Read is not enough.
 func readFile(vfsRoot vfs.Provider, path string) ([]byte, error) {
 	h, err := vfsRoot.Open(path, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
 	defer h.Close()
+	return io.ReadAll(h)
+}
+
+func readFileTo(vfsRoot vfs.Provider, path string, w io.Writer) (int64, error) {
+	h, err := vfsRoot.Open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer h.Close()
+	return io.Copy(w, h)
+}
 
-	info, err := vfsRoot.Stat(path)
+// readFileRange reads up to length bytes of path starting at off. It
+// returns fewer bytes only when the file ends first, and none past EOF.
+func readFileRange(vfsRoot vfs.Provider, path string, off int64, length int) ([]byte, error) {
+	if off < 0 || length < 0 {
+		return nil, errx.With(ErrInvalidReadRange, ": offset %d, length %d", off, length)
+	}
+	h, err := vfsRoot.Open(path, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
+	defer h.Close()
 
-	content := make([]byte, info.Size())
-	_, err = h.Read(content)
+	// Size the buffer by what the file holds, not by the caller's length.
+	info, err := h.Stat()
 	if err != nil {
 		return nil, err
 	}
-	return content, nil
-}
+	if remaining := max(info.Size()-off, 0); int64(length) > remaining {
+		length = int(remaining)
+	}
 
-func readFileTo(vfsRoot vfs.Provider, path string, w io.Writer) (int64, error) {
-	h, err := vfsRoot.Open(path, os.O_RDONLY, 0)
-	if err != nil {
-		return 0, err
+	// Loop like readFile: not every handle's ReadAt fills buf in one call.
+	buf := make([]byte, length)
+	read := 0
+	for read < length {
+		n, err := h.ReadAt(buf[read:], off+int64(read))
+		read += n
+		if err == io.EOF || (err == nil && n == 0) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
-	defer h.Close()
-	return io.Copy(w, h)
+	return buf[:read], nil
 }
 
 func listFiles(vfsRoot vfs.Provider, path string) ([]api.FileInfo, error) {
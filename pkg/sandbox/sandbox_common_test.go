@@ -1,10 +1,16 @@
 package sandbox
 
 import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"math"
+	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/jingkaihe/matchlock/pkg/api"
+	sandboxnet "github.com/jingkaihe/matchlock/pkg/net"
 	"github.com/jingkaihe/matchlock/pkg/policy"
 	"github.com/jingkaihe/matchlock/pkg/vfs"
 	"github.com/stretchr/testify/require"
@@ -20,14 +26,15 @@ func TestBuildVFSProvidersAddsWorkspaceRootForNestedMounts(t *testing.T) {
 		},
 	}
 
-	providers := buildVFSProviders(config, workspace)
+	providers, err := buildVFSProviders(config, workspace)
+	require.NoError(t, err)
 	_, ok := providers[workspace]
 	require.True(t, ok, "expected workspace mount %q to exist", workspace)
 	_, ok = providers["/workspace/not_exist_folder"]
 	require.True(t, ok, "expected nested mount to exist")
 
 	router := vfs.NewMountRouter(providers)
-	_, err := router.Stat(workspace)
+	_, err = router.Stat(workspace)
 	require.NoError(t, err, "expected workspace root to resolve")
 }
 
@@ -41,7 +48,8 @@ func TestBuildVFSProvidersKeepsExplicitWorkspaceMount(t *testing.T) {
 		},
 	}
 
-	providers := buildVFSProviders(config, workspace)
+	providers, err := buildVFSProviders(config, workspace)
+	require.NoError(t, err)
 	require.Len(t, providers, 1)
 }
 
@@ -55,7 +63,8 @@ func TestBuildVFSProvidersDoesNotDuplicateCanonicalWorkspaceMount(t *testing.T)
 		},
 	}
 
-	providers := buildVFSProviders(config, workspace)
+	providers, err := buildVFSProviders(config, workspace)
+	require.NoError(t, err)
 
 	var workspaceMounts int
 	for path := range providers {
@@ -67,6 +76,20 @@ func TestBuildVFSProvidersDoesNotDuplicateCanonicalWorkspaceMount(t *testing.T)
 	require.Equal(t, 1, workspaceMounts, "expected exactly one canonical workspace mount (providers=%d)", len(providers))
 }
 
+func TestWatchedMountPathsListsOnlyWatchedMounts(t *testing.T) {
+	config := &api.Config{
+		VFS: &api.VFSConfig{
+			Mounts: map[string]api.MountConfig{
+				"/workspace/app.conf": {Type: api.MountTypeHostFS, HostPath: "/etc/hostname", Readonly: true, Watch: true},
+				"/workspace/data":     {Type: api.MountTypeHostFS, HostPath: "/tmp"},
+			},
+		},
+	}
+
+	require.Equal(t, []string{"/workspace/app.conf"}, watchedMountPaths(config))
+	require.Empty(t, watchedMountPaths(&api.Config{}))
+}
+
 func TestPrepareExecEnv_ConfigEnvOverridesImageEnv(t *testing.T) {
 	config := &api.Config{
 		VFS: &api.VFSConfig{Workspace: "/workspace"},
@@ -86,6 +109,25 @@ func TestPrepareExecEnv_ConfigEnvOverridesImageEnv(t *testing.T) {
 	require.Equal(t, "from-image", opts.Env["BAR"])
 }
 
+func TestMergeExecEnv_ExecEnvOverridesImageAndConfigEnv(t *testing.T) {
+	config := &api.Config{
+		VFS: &api.VFSConfig{Workspace: "/workspace"},
+		ImageCfg: &api.ImageConfig{
+			Env: map[string]string{
+				"PATH": "/opt/conda/bin:/usr/bin",
+				"FOO":  "from-image",
+				"BAR":  "from-image",
+			},
+		},
+		Env: map[string]string{"BAR": "from-config"},
+	}
+
+	opts := mergeExecEnv(config, nil, nil, &api.ExecOptions{Env: map[string]string{"FOO": "from-exec"}})
+	require.Equal(t, "/opt/conda/bin:/usr/bin", opts.Env["PATH"])
+	require.Equal(t, "from-exec", opts.Env["FOO"])
+	require.Equal(t, "from-config", opts.Env["BAR"])
+}
+
 func TestPrepareExecEnv_DefaultWorkingDirUsesImageWorkdir(t *testing.T) {
 	config := &api.Config{
 		VFS: &api.VFSConfig{Workspace: "/workspace/project"},
@@ -131,3 +173,180 @@ func TestPrepareExecEnv_SecretPlaceholderOverridesConfigEnv(t *testing.T) {
 	require.NotEqual(t, "not-secret", opts.Env["API_KEY"])
 	require.Contains(t, opts.Env["API_KEY"], "SANDBOX_SECRET_")
 }
+
+func TestMergeExecEnv_ExecEnvCannotOverrideInjectedEnv(t *testing.T) {
+	config := &api.Config{VFS: &api.VFSConfig{Workspace: "/workspace"}}
+	pol := policy.NewEngine(&api.NetworkConfig{
+		Secrets: map[string]api.Secret{
+			"API_KEY": {Value: "real-secret"},
+		},
+	})
+	caPool, err := sandboxnet.NewCAPool()
+	require.NoError(t, err)
+
+	opts := mergeExecEnv(config, caPool, pol, &api.ExecOptions{Env: map[string]string{
+		"REQUEST_ID":    "req-42",
+		"API_KEY":       "caller-value",
+		"SSL_CERT_FILE": "/tmp/other.crt",
+	}})
+
+	require.Equal(t, "req-42", opts.Env["REQUEST_ID"])
+	require.Equal(t, pol.GetPlaceholder("API_KEY"), opts.Env["API_KEY"])
+	require.Equal(t, "/etc/ssl/certs/matchlock-ca.crt", opts.Env["SSL_CERT_FILE"])
+}
+
+func TestResolveAutoMTU(t *testing.T) {
+	detect := func(string) (int, error) { return 1400, nil }
+
+	config := &api.Config{Network: &api.NetworkConfig{AutoMTU: true}}
+	resolveAutoMTU(config, detect)
+	require.Equal(t, 1400, config.Network.MTU)
+
+	config = &api.Config{Network: &api.NetworkConfig{AutoMTU: true, MTU: 1200}}
+	resolveAutoMTU(config, detect)
+	require.Equal(t, 1200, config.Network.MTU, "explicit MTU must win")
+
+	config = &api.Config{Network: &api.NetworkConfig{AutoMTU: true}}
+	resolveAutoMTU(config, func(string) (int, error) { return 0, errors.New("no route") })
+	require.Equal(t, api.DefaultNetworkMTU, config.Network.GetMTU())
+}
+
+func TestWarnWeakenedIsolationEmitsSecurityEvents(t *testing.T) {
+	events := api.NewEventSink(10)
+	warnWeakenedIsolation(&api.Config{Privileged: true}, events)
+	require.Len(t, events.C, 1)
+	evt := <-events.C
+	require.Equal(t, "security", evt.Type)
+	require.NotNil(t, evt.Security)
+	require.Contains(t, evt.Security.Warning, "privileged mode")
+
+	warnWeakenedIsolation(&api.Config{}, events)
+	require.Empty(t, events.C)
+}
+
+func TestResolveCapabilitiesNormalizesAllowSyscalls(t *testing.T) {
+	config := &api.Config{AllowSyscalls: []string{"PTRACE"}}
+	_, _, err := resolveCapabilities(config)
+	require.NoError(t, err)
+	require.Equal(t, []string{"ptrace"}, config.AllowSyscalls)
+
+	_, _, err = resolveCapabilities(&api.Config{AllowSyscalls: []string{"mount"}})
+	require.ErrorIs(t, err, api.ErrInvalidSyscall)
+}
+
+func TestBuildVFSProvidersRejectsUnknownMountType(t *testing.T) {
+	config := &api.Config{
+		VFS: &api.VFSConfig{
+			Mounts: map[string]api.MountConfig{
+				"/workspace/data": {Type: "tarball"},
+			},
+		},
+	}
+
+	_, err := buildVFSProviders(config, "/workspace")
+	require.ErrorIs(t, err, ErrBuildVFSProvider)
+	require.ErrorIs(t, err, vfs.ErrUnknownMountType)
+}
+
+func TestSecretFilesSkipEnvAndMountPlaceholderOrValue(t *testing.T) {
+	config := &api.Config{
+		VFS: &api.VFSConfig{Workspace: "/workspace"},
+		Network: &api.NetworkConfig{
+			Secrets: map[string]api.Secret{
+				"API_KEY":    {Value: "real-secret", Hosts: []string{"api.example.com"}},
+				"GH_TOKEN":   {Value: "gh-secret", Hosts: []string{"api.github.com"}, File: "/workspace/.secrets/gh"},
+				"DEPLOY_KEY": {Value: "raw-key", File: "/workspace/.ssh/id", FileRaw: true},
+			},
+		},
+	}
+	pol := policy.NewEngine(config.Network)
+	providers, err := buildVFSProviders(config, "/workspace")
+	require.NoError(t, err)
+	addSecretFileMounts(providers, config)
+
+	opts := prepareExecEnv(config, nil, pol)
+	require.Contains(t, opts.Env["API_KEY"], "SANDBOX_SECRET_")
+	require.NotContains(t, opts.Env, "GH_TOKEN")
+	require.NotContains(t, opts.Env, "DEPLOY_KEY")
+
+	root := vfs.NewMountRouter(providers)
+	data, err := readFile(root, "/workspace/.secrets/gh")
+	require.NoError(t, err)
+	require.Equal(t, pol.GetPlaceholder("GH_TOKEN"), string(data))
+
+	data, err = readFile(root, "/workspace/.ssh/id")
+	require.NoError(t, err)
+	require.Equal(t, "raw-key", string(data))
+}
+
+// shortReadProvider caps every Read on its handles, like a host file or
+// FUSE-backed mount returning one chunk at a time.
+type shortReadProvider struct {
+	vfs.Provider
+}
+
+func (p shortReadProvider) Open(path string, flags int, mode os.FileMode) (vfs.Handle, error) {
+	h, err := p.Provider.Open(path, flags, mode)
+	if err != nil {
+		return nil, err
+	}
+	return shortReadHandle{h}, nil
+}
+
+type shortReadHandle struct {
+	vfs.Handle
+}
+
+func (h shortReadHandle) Read(p []byte) (int, error) {
+	if len(p) > 64*1024 {
+		p = p[:64*1024]
+	}
+	return h.Handle.Read(p)
+}
+
+func TestReadFileRange(t *testing.T) {
+	mem := vfs.NewMemoryProvider()
+	require.NoError(t, mem.WriteFile("/app.log", []byte("0123456789"), 0644))
+
+	got, err := readFileRange(mem, "/app.log", 6, 3)
+	require.NoError(t, err)
+	require.Equal(t, "678", string(got))
+
+	got, err = readFileRange(mem, "/app.log", 8, 100)
+	require.NoError(t, err)
+	require.Equal(t, "89", string(got), "range past EOF is truncated")
+
+	got, err = readFileRange(mem, "/app.log", 20, 4)
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	got, err = readFileRange(mem, "/app.log", 0, math.MaxInt)
+	require.NoError(t, err)
+	require.Equal(t, "0123456789", string(got), "the buffer is sized by the file, not the requested length")
+
+	_, err = readFileRange(mem, "/app.log", -1, 4)
+	require.ErrorIs(t, err, ErrInvalidReadRange)
+
+	_, err = readFileRange(mem, "/missing", 0, 4)
+	require.Error(t, err)
+}
+
+func TestReadFileReadsPastShortReads(t *testing.T) {
+	content := make([]byte, 10*1024*1024)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	mem := vfs.NewMemoryProvider()
+	require.NoError(t, mem.WriteFile("/big.bin", content, 0644))
+	fs := shortReadProvider{mem}
+
+	got, err := readFile(fs, "/big.bin")
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(content, got), "readFile returned %d of %d bytes", len(got), len(content))
+
+	var buf bytes.Buffer
+	n, err := readFileTo(fs, "/big.bin", &buf)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(content)), n)
+	require.True(t, bytes.Equal(content, buf.Bytes()))
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/image"
 	"github.com/jingkaihe/matchlock/pkg/lifecycle"
 	sandboxnet "github.com/jingkaihe/matchlock/pkg/net"
 	"github.com/jingkaihe/matchlock/pkg/policy"
@@ -20,19 +21,28 @@ import (
 	"github.com/jingkaihe/matchlock/pkg/vfs"
 	"github.com/jingkaihe/matchlock/pkg/vm"
 	"github.com/jingkaihe/matchlock/pkg/vm/darwin"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
 )
 
 type Sandbox struct {
 	id               string
 	config           *api.Config
 	machine          vm.Machine
+	vsockPorts       vsock.Ports
 	netStack         *sandboxnet.NetworkStack
 	policy           *policy.Engine
 	vfsRoot          vfs.Provider
+	secretFiles      map[string]struct{} // secret file mounts; never exported or committed
+	workspaceFS      vfs.Provider        // provider mounted at the workspace root
+	guestFS          *vfs.FreezeProvider // guest view of vfsRoot; frozen by FreezeWorkspace
 	vfsHooks         *vfs.HookEngine
+	guestVFSHooks    *vfs.HookEngine // callback rules; guest-originated ops only
 	vfsServer        *vfs.VFSServer
 	vfsStopFunc      func()
-	events           chan api.Event
+	auditStopFunc    func()
+	policyStopFunc   func()
+	socketStopFunc   func()
+	events           *eventRecorder // stamps, logs and forwards sandbox events
 	stateMgr         *state.Manager
 	caPool           *sandboxnet.CAPool
 	subnetInfo       *state.SubnetInfo
@@ -55,10 +65,35 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 	if opts.RootfsPath == "" {
 		return nil, fmt.Errorf("RootfsPath is required")
 	}
+	if len(config.KernelModules) > 0 {
+		return nil, ErrKernelModulesDarwin
+	}
+	if len(config.Resources.CPUAffinity) > 0 {
+		return nil, ErrCPUAffinityDarwin
+	}
+	if config.Resources.CgroupParent != "" {
+		return nil, ErrCgroupParentDarwin
+	}
+	if config.Network.UsesSharedBridge() {
+		return nil, ErrSharedBridgeDarwin
+	}
+	kernelPath, err := resolveKernelPath(config, opts.KernelPath)
+	if err != nil {
+		return nil, err
+	}
 
 	id := config.GetID()
 	hostname := config.GetHostname()
 	workspace := config.GetWorkspace()
+	resolveAutoMTU(config, sandboxnet.DetectOutboundMTU)
+	capAdd, capDrop, err := resolveCapabilities(config)
+	if err != nil {
+		return nil, err
+	}
+	upstreamProxy, err := sandboxnet.NewUpstreamProxy(config.Network, os.Getenv)
+	if err != nil {
+		return nil, errx.Wrap(ErrNetworkStack, err)
+	}
 
 	stateMgr := state.NewManager()
 	if err := stateMgr.Register(id, config); err != nil {
@@ -81,7 +116,13 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 	}()
 
 	subnetAlloc := state.NewSubnetAllocator()
-	subnetInfo, err := subnetAlloc.Allocate(id)
+	var subnetInfo *state.SubnetInfo
+	staticIP, staticMAC := config.Network.StaticAddress()
+	if staticIP != "" || staticMAC != "" {
+		subnetInfo, err = subnetAlloc.AllocateStatic(id, staticIP, staticMAC, config.Network.PrivateHostRoutes()...)
+	} else {
+		subnetInfo, err = subnetAlloc.Allocate(id, config.Network.PrivateHostRoutes()...)
+	}
 	if err != nil {
 		stateMgr.Unregister(id)
 		return nil, errx.Wrap(ErrAllocateSubnet, err)
@@ -94,10 +135,6 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 
 	backend := darwin.NewDarwinBackend()
 
-	kernelPath := opts.KernelPath
-	if kernelPath == "" {
-		kernelPath = DefaultKernelPath()
-	}
 	initramfsPath := opts.InitramfsPath
 	if initramfsPath == "" {
 		initramfsPath = DefaultInitramfsPath()
@@ -105,7 +142,7 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 	rootfsPath := opts.RootfsPath
 
 	// Determine if we need network interception (calculated before VM creation)
-	needsInterception := config.Network != nil && (len(config.Network.AllowedHosts) > 0 || len(config.Network.Secrets) > 0)
+	needsInterception := config.Network != nil && (len(config.Network.AllowedHosts) > 0 || config.Network.HasProxiedSecrets() || len(config.Network.MirrorRoutes) > 0 || config.Network.MetadataService || config.Network.MaxConcurrentConnections > 0 || config.Network.MaxConnectionsPerHost > 0 || len(config.Network.AllowedUDPHosts) > 0 || staticIP != "" || upstreamProxy != nil)
 
 	// Create CAPool early so we can inject the cert into rootfs before the VM sees the disk
 	var caPool *sandboxnet.CAPool
@@ -118,35 +155,31 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		}
 	}
 
-	// Copy rootfs into the VM state directory, then inject components and resize
-	// before backend.Create() so VZ sees the final image.
+	// Stage the VM's rootfs in its state directory (a prepared copy, or an
+	// overlay disk over a shared read-only base) before backend.Create() so
+	// VZ sees the final image.
 	prebuiltRootfs := filepath.Join(stateMgr.Dir(id), "rootfs.ext4")
-	if err := copyRootfsDarwin(rootfsPath, prebuiltRootfs); err != nil {
+	bootRootfsPath, err := stageRootfs(config, rootfsPath, prebuiltRootfs, copyRootfsDarwin)
+	if err != nil {
 		subnetAlloc.Release(id)
 		stateMgr.Unregister(id)
-		return nil, errx.Wrap(ErrCopyRootfs, err)
+		return nil, err
 	}
 	_ = lifecycleStore.SetResource(func(r *lifecycle.Resources) {
 		r.RootfsPath = prebuiltRootfs
 	})
-	var diskSizeMB int64
-	if config.Resources != nil {
-		diskSizeMB = int64(config.Resources.DiskSizeMB)
-	}
-	if err := prepareRootfs(prebuiltRootfs, diskSizeMB); err != nil {
-		os.Remove(prebuiltRootfs)
-		subnetAlloc.Release(id)
-		stateMgr.Unregister(id)
-		return nil, errx.Wrap(ErrPrepareRootfs, err)
+	var rootfsOverlay string
+	if config.SharedRootfs {
+		rootfsOverlay = prebuiltRootfs
 	}
 
 	// Inject CA cert into rootfs before backend.Create() attaches the disk
 	if caPool != nil {
-		if err := injectConfigFileIntoRootfs(prebuiltRootfs, "/etc/ssl/certs/matchlock-ca.crt", caPool.CACertPEM()); err != nil {
+		if err := injectCACert(config, prebuiltRootfs, caPool.CACertPEM()); err != nil {
 			os.Remove(prebuiltRootfs)
 			subnetAlloc.Release(id)
 			stateMgr.Unregister(id)
-			return nil, errx.Wrap(ErrInjectCACert, err)
+			return nil, err
 		}
 	}
 
@@ -168,22 +201,38 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		ID:              id,
 		KernelPath:      kernelPath,
 		InitramfsPath:   initramfsPath,
-		RootfsPath:      prebuiltRootfs,
+		RootfsPath:      bootRootfsPath,
 		CPUs:            config.Resources.CPUs,
 		MemoryMB:        config.Resources.MemoryMB,
+		SwapMB:          config.Resources.SwapMB,
+		Ulimits:         config.Ulimits,
+		User:            imageUser(config),
 		SocketPath:      stateMgr.SocketPath(id) + ".sock",
 		LogPath:         stateMgr.LogPath(id),
+		VsockPorts:      vsock.DefaultPorts(),
 		GatewayIP:       subnetInfo.GatewayIP,
 		GuestIP:         subnetInfo.GuestIP,
 		SubnetCIDR:      subnetInfo.GatewayIP + "/24",
+		MACAddress:      staticMAC,
 		Workspace:       workspace,
 		UseInterception: needsInterception,
 		Privileged:      config.Privileged,
+		CapAdd:          capAdd,
+		CapDrop:         capDrop,
+		AllowSyscalls:   config.AllowSyscalls,
+		KeepNewPrivs:    config.DisableNoNewPrivs,
+		SeccompAudit:    config.SeccompAudit,
 		PrebuiltRootfs:  prebuiltRootfs,
+		RootfsOverlay:   rootfsOverlay,
 		ExtraDisks:      extraDisks,
 		DNSServers:      config.Network.GetDNSServers(),
+		SearchDomains:   config.Network.GetSearchDomains(),
+		ResolvOptions:   config.Network.GetResolvOptions(),
 		Hostname:        hostname,
-		AddHosts:        config.Network.AddHosts,
+		Routes:          config.Network.PrivateHostRoutes(),
+		NetworkProbe:    config.Network.NetworkWaitProbe(),
+		SocketMounts:    api.SocketMountPaths(config.SocketMounts),
+		AddHosts:        config.Network.HostMachineAddHosts(subnetInfo.GatewayIP),
 		MTU:             config.Network.GetMTU(),
 	}
 	_ = lifecycleStore.SetResource(func(r *lifecycle.Resources) {
@@ -202,6 +251,16 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		stateMgr.Unregister(id)
 		return nil, err
 	}
+	vfsProviders, err := buildVFSProviders(config, workspace)
+	if err != nil {
+		cleanupSnapshotPaths(overlaySnapshots)
+		if prebuiltRootfs != "" {
+			os.Remove(prebuiltRootfs)
+		}
+		subnetAlloc.Release(id)
+		stateMgr.Unregister(id)
+		return nil, err
+	}
 
 	machine, err := backend.Create(ctx, vmConfig)
 	if err != nil {
@@ -231,7 +290,11 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 	}
 
 	policyEngine := policy.NewEngine(config.Network)
-	events := make(chan api.Event, 100)
+	secretFiles := addSecretFileMounts(vfsProviders, config)
+	policyEngine.SetHostMachineIP(subnetInfo.GatewayIP)
+	recorder := newEventRecorder(config.EventBufferSize)
+	events := recorder.in
+	warnWeakenedIsolation(config, events)
 
 	var netStack *sandboxnet.NetworkStack
 
@@ -244,15 +307,32 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 			return nil, ErrNetworkFile
 		}
 
+		resolver, err := sandboxnet.NewResolver(config.Network.UpstreamDNS)
+		if err != nil {
+			machine.Close(ctx)
+			subnetAlloc.Release(id)
+			stateMgr.Unregister(id)
+			return nil, errx.Wrap(ErrNetworkStack, err)
+		}
+		udpAllow, warnings := sandboxnet.ResolveUDPAllowRules(ctx, policyEngine, config.Network.AllowedUDPHosts, resolver)
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
 		netStack, err = sandboxnet.NewNetworkStack(&sandboxnet.Config{
-			File:       networkFile,
-			GatewayIP:  subnetInfo.GatewayIP,
-			GuestIP:    subnetInfo.GuestIP,
-			MTU:        uint32(config.Network.GetMTU()),
-			Policy:     policyEngine,
-			Events:     events,
-			CAPool:     caPool,
-			DNSServers: config.Network.GetDNSServers(),
+			File:           networkFile,
+			GatewayIP:      subnetInfo.GatewayIP,
+			GuestIP:        subnetInfo.GuestIP,
+			MTU:            uint32(config.Network.GetMTU()),
+			Policy:         policyEngine,
+			Events:         events,
+			CAPool:         caPool,
+			DNSServers:     config.Network.GetDNSServers(),
+			UDPAllow:       udpAllow,
+			Resolver:       resolver,
+			UpstreamProxy:  upstreamProxy,
+			Metadata:       metadataService(config, policyEngine),
+			MaxConnections: config.Network.MaxConcurrentConnections,
+			MaxPerHost:     config.Network.MaxConnectionsPerHost,
 		})
 		if err != nil {
 			machine.Close(ctx)
@@ -262,7 +342,6 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		}
 	}
 
-	vfsProviders := buildVFSProviders(config, workspace)
 	vfsRouter := vfs.NewMountRouter(vfsProviders)
 	var vfsRoot vfs.Provider = vfsRouter
 	vfsHooks := buildVFSHookEngine(config)
@@ -271,7 +350,14 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		vfsRoot = vfs.NewInterceptProvider(vfsRoot, vfsHooks)
 	}
 
-	vfsServer := vfs.NewVFSServer(vfsRoot)
+	guestRoot := vfsRoot
+	guestVFSHooks := buildGuestVFSHookEngine(config)
+	if guestVFSHooks != nil {
+		guestRoot = vfs.NewInterceptProvider(vfsRoot, guestVFSHooks)
+	}
+	guestFS := vfs.NewFreezeProvider(guestRoot)
+	vfsServer := vfs.NewVFSServer(guestFS, vfsServerOptions(config)...)
+	vfsServer.SetVolatilePaths(watchedMountPaths(config)...)
 
 	vfsListener, err := darwinMachine.SetupVFSListener()
 	if err != nil {
@@ -284,6 +370,58 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		return nil, errx.Wrap(ErrVFSListener, err)
 	}
 
+	var auditStopFunc func()
+	if config.SeccompAudit {
+		auditListener, err := darwinMachine.SetupAuditListener()
+		if err != nil {
+			vfsListener.Close()
+			if netStack != nil {
+				netStack.Close()
+			}
+			machine.Close(ctx)
+			subnetAlloc.Release(id)
+			stateMgr.Unregister(id)
+			return nil, errx.Wrap(ErrSyscallAuditListener, err)
+		}
+		auditStopFunc = serveSyscallAudit(auditListener, events)
+	}
+
+	policyListener, err := darwinMachine.SetupPolicyListener()
+	if err != nil {
+		if auditStopFunc != nil {
+			auditStopFunc()
+		}
+		vfsListener.Close()
+		if netStack != nil {
+			netStack.Close()
+		}
+		machine.Close(ctx)
+		subnetAlloc.Release(id)
+		stateMgr.Unregister(id)
+		return nil, errx.Wrap(ErrPolicyQueryListener, err)
+	}
+	policyStopFunc := servePolicyQueries(policyListener, policyEngine)
+
+	var socketStopFunc func()
+	if len(config.SocketMounts) > 0 {
+		socketListener, err := darwinMachine.SetupSocketListener()
+		if err != nil {
+			policyStopFunc()
+			if auditStopFunc != nil {
+				auditStopFunc()
+			}
+			vfsListener.Close()
+			if netStack != nil {
+				netStack.Close()
+			}
+			machine.Close(ctx)
+			subnetAlloc.Release(id)
+			stateMgr.Unregister(id)
+			return nil, errx.Wrap(ErrSocketMountListener, err)
+		}
+		socketStopFunc = serveSocketMounts(socketListener, config.SocketMounts)
+	}
+
 	vfsStopCh := make(chan struct{})
 	vfsStopFunc := func() {
 		close(vfsStopCh)
@@ -312,13 +450,21 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		id:               id,
 		config:           config,
 		machine:          machine,
+		vsockPorts:       vmConfig.VsockPorts,
 		netStack:         netStack,
 		policy:           policyEngine,
 		vfsRoot:          vfsRoot,
+		secretFiles:      secretFiles,
+		workspaceFS:      workspaceProvider(vfsProviders, workspace),
+		guestFS:          guestFS,
 		vfsHooks:         vfsHooks,
+		guestVFSHooks:    guestVFSHooks,
 		vfsServer:        vfsServer,
 		vfsStopFunc:      vfsStopFunc,
-		events:           events,
+		auditStopFunc:    auditStopFunc,
+		policyStopFunc:   policyStopFunc,
+		socketStopFunc:   socketStopFunc,
+		events:           recorder,
 		stateMgr:         stateMgr,
 		caPool:           caPool,
 		subnetInfo:       subnetInfo,
@@ -327,6 +473,7 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		overlaySnapshots: overlaySnapshots,
 		lifecycle:        lifecycleStore,
 	}
+	recorder.start(stateMgr.EventLogPath(id))
 	if err := lifecycleStore.SetPhase(lifecycle.PhaseCreated); err != nil {
 		_ = sb.Close(ctx)
 		return nil, errx.Wrap(ErrLifecycleUpdate, err)
@@ -358,6 +505,13 @@ func (s *Sandbox) Start(ctx context.Context) error {
 		}
 		return err
 	}
+	if err := s.runInitCommands(ctx); err != nil {
+		if s.lifecycle != nil {
+			_ = s.lifecycle.SetLastError(err)
+			_ = s.lifecycle.SetPhase(lifecycle.PhaseStartFailed)
+		}
+		return err
+	}
 	if s.lifecycle != nil {
 		if err := s.lifecycle.SetPhase(lifecycle.PhaseRunning); err != nil {
 			return errx.Wrap(ErrLifecycleUpdate, err)
@@ -398,7 +552,24 @@ func (s *Sandbox) PrepareExecEnv() *api.ExecOptions {
 }
 
 func (s *Sandbox) Exec(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
-	return execCommand(ctx, s.machine, s.config, s.caPool, s.policy, command, opts)
+	var result *api.ExecResult
+	_, err := s.events.traceExec(command, opts, func(opts *api.ExecOptions) (int, error) {
+		var err error
+		result, err = execCommand(ctx, s.machine, s.config, s.caPool, s.policy, command, opts)
+		if err != nil {
+			return 1, err
+		}
+		return result.ExitCode, nil
+	})
+	return result, err
+}
+
+// ExecInteractive runs command attached to a guest PTY of rows x cols,
+// relaying stdin/stdout and applying terminal sizes received on resizeCh.
+func (s *Sandbox) ExecInteractive(ctx context.Context, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error) {
+	return s.events.traceExec(command, opts, func(opts *api.ExecOptions) (int, error) {
+		return execInteractive(ctx, s.machine, s.config, s.caPool, s.policy, command, opts, rows, cols, stdin, stdout, resizeCh)
+	})
 }
 
 func (s *Sandbox) WriteFile(ctx context.Context, path string, content []byte, mode uint32) error {
@@ -413,12 +584,76 @@ func (s *Sandbox) ReadFileTo(ctx context.Context, path string, w io.Writer) (int
 	return readFileTo(s.vfsRoot, path, w)
 }
 
+func (s *Sandbox) ReadFileRange(ctx context.Context, path string, off int64, length int) ([]byte, error) {
+	return readFileRange(s.vfsRoot, path, off, length)
+}
+
 func (s *Sandbox) ListFiles(ctx context.Context, path string) ([]api.FileInfo, error) {
 	return listFiles(s.vfsRoot, path)
 }
 
+// ExportPath copies a file or directory from the sandbox VFS (the workspace
+// and its mounts) into hostDir on the host.
+func (s *Sandbox) ExportPath(ctx context.Context, guestPath, hostDir string) error {
+	return exportPath(s.vfsRoot, guestPath, hostDir, s.secretFiles)
+}
+
+// LogPath returns the VM console log, which carries kernel output and the
+// guest runtime's diagnostics.
+func (s *Sandbox) LogPath() string { return s.stateMgr.LogPath(s.id) }
+
+// Commit stores the VM's current rootfs in the local image cache as tag,
+// together with the image config it booted with.
+func (s *Sandbox) Commit(ctx context.Context, tag string, opts CommitOptions) (*image.BuildResult, error) {
+	return s.commit(ctx, tag, opts, copyRootfsDarwin)
+}
+
+// SnapshotWorkspace checkpoints the workspace VFS and returns the snapshot ID.
+// Only the workspace mount is covered; the guest rootfs is not.
+func (s *Sandbox) SnapshotWorkspace(ctx context.Context) (string, error) {
+	return snapshotWorkspace(s.workspaceFS)
+}
+
+// FreezeWorkspace makes the workspace and its mounts read-only to the guest:
+// until UnfreezeWorkspace, guest writes fail with EROFS, including writes
+// through files opened before the freeze. Host-side file operations and
+// RestoreWorkspace are not affected.
+func (s *Sandbox) FreezeWorkspace(ctx context.Context) error {
+	s.guestFS.SetFrozen(true)
+	return nil
+}
+
+// UnfreezeWorkspace lifts a FreezeWorkspace.
+func (s *Sandbox) UnfreezeWorkspace(ctx context.Context) error {
+	s.guestFS.SetFrozen(false)
+	return nil
+}
+
+// RestoreWorkspace rolls the workspace VFS back to a snapshot.
+func (s *Sandbox) RestoreWorkspace(ctx context.Context, id string) error {
+	return restoreWorkspace(s.workspaceFS, id)
+}
+
+// Snapshot is not supported by the Virtualization.framework backend.
+func (s *Sandbox) Snapshot(ctx context.Context) (string, error) {
+	return "", ErrVMSnapshotUnsupported
+}
+
+// Restore is not supported by the Virtualization.framework backend.
+func Restore(ctx context.Context, id string, configure func(*api.Config), opts *Options) (*Sandbox, error) {
+	return nil, ErrVMSnapshotUnsupported
+}
+
+// Events returns a channel for receiving sandbox events. Delivery is at most
+// once: events that arrive while the channel is full are dropped and later
+// summarized by an "events_dropped" event.
 func (s *Sandbox) Events() <-chan api.Event {
-	return s.events
+	return s.events.out
+}
+
+// DroppedEvents returns how many events Events has dropped so far.
+func (s *Sandbox) DroppedEvents() uint64 {
+	return s.events.droppedTotal()
 }
 
 func (s *Sandbox) Close(ctx context.Context) error {
@@ -446,6 +681,9 @@ func (s *Sandbox) Close(ctx context.Context) error {
 	} else {
 		markCleanup("vfs_stop", nil)
 	}
+	if s.guestVFSHooks != nil {
+		s.guestVFSHooks.Close()
+	}
 	if s.vfsHooks != nil {
 		s.vfsHooks.Close()
 		markCleanup("vfs_hooks", nil)
@@ -474,7 +712,16 @@ func (s *Sandbox) Close(ctx context.Context) error {
 		markCleanup("subnet_release", nil)
 	}
 
-	close(s.events)
+	if s.auditStopFunc != nil {
+		s.auditStopFunc()
+	}
+	if s.policyStopFunc != nil {
+		s.policyStopFunc()
+	}
+	if s.socketStopFunc != nil {
+		s.socketStopFunc()
+	}
+	s.events.close()
 	markCleanup("events_close", nil)
 	if err := s.stateMgr.Unregister(s.id); err != nil {
 		errs = append(errs, errx.Wrap(ErrUnregisterState, err))
@@ -489,14 +736,16 @@ func (s *Sandbox) Close(ctx context.Context) error {
 		markCleanup("machine_close", nil)
 	}
 
-	var overlayCleanupErr error
-	for _, snapshotPath := range s.overlaySnapshots {
-		if err := os.RemoveAll(snapshotPath); err != nil {
-			errs = append(errs, errx.With(ErrRemoveOverlaySnapshot, " %s: %v", snapshotPath, err))
-			overlayCleanupErr = err
+	if !s.config.KeepStateOnClose {
+		var overlayCleanupErr error
+		for _, snapshotPath := range s.overlaySnapshots {
+			if err := os.RemoveAll(snapshotPath); err != nil {
+				errs = append(errs, errx.With(ErrRemoveOverlaySnapshot, " %s: %v", snapshotPath, err))
+				overlayCleanupErr = err
+			}
 		}
+		markCleanup("overlay_snapshot_remove", overlayCleanupErr)
 	}
-	markCleanup("overlay_snapshot_remove", overlayCleanupErr)
 
 	if len(errs) > 0 {
 		joined := errors.Join(errs...)
@@ -517,21 +766,6 @@ func (s *Sandbox) Close(ctx context.Context) error {
 	return nil
 }
 
-func createProvider(mount api.MountConfig) vfs.Provider {
-	switch mount.Type {
-	case api.MountTypeMemory:
-		return vfs.NewMemoryProvider()
-	case api.MountTypeHostFS:
-		p := vfs.NewRealFSProvider(mount.HostPath)
-		if mount.Readonly {
-			return vfs.NewReadonlyProvider(p)
-		}
-		return p
-	default:
-		return vfs.NewMemoryProvider()
-	}
-}
-
 func copyRootfsDarwin(srcPath, dstPath string) error {
 	src, err := os.Open(srcPath)
 	if err != nil {
@@ -5,13 +5,18 @@ package sandbox
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/image"
 	"github.com/jingkaihe/matchlock/pkg/lifecycle"
 	sandboxnet "github.com/jingkaihe/matchlock/pkg/net"
 	"github.com/jingkaihe/matchlock/pkg/policy"
@@ -19,6 +24,7 @@ import (
 	"github.com/jingkaihe/matchlock/pkg/vfs"
 	"github.com/jingkaihe/matchlock/pkg/vm"
 	"github.com/jingkaihe/matchlock/pkg/vm/linux"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
 	"golang.org/x/sys/unix"
 )
 
@@ -33,15 +39,23 @@ type Sandbox struct {
 	id               string
 	config           *api.Config
 	machine          vm.Machine
+	vsockPorts       vsock.Ports
 	proxy            *sandboxnet.TransparentProxy
 	fwRules          FirewallRules
-	natRules         *sandboxnet.NFTablesNAT
+	natRules         FirewallRules // per-TAP NAT, or the port rules on the shared bridge
 	policy           *policy.Engine
 	vfsRoot          vfs.Provider
+	secretFiles      map[string]struct{} // secret file mounts; never exported or committed
+	workspaceFS      vfs.Provider        // provider mounted at the workspace root
+	guestFS          *vfs.FreezeProvider // guest view of vfsRoot; frozen by FreezeWorkspace
 	vfsHooks         *vfs.HookEngine
+	guestVFSHooks    *vfs.HookEngine // callback rules; guest-originated ops only
 	vfsServer        *vfs.VFSServer
 	vfsStopFunc      func()
-	events           chan api.Event
+	auditStopFunc    func()
+	policyStopFunc   func()
+	socketStopFunc   func()
+	events           *eventRecorder // stamps, logs and forwards sandbox events
 	stateMgr         *state.Manager
 	tapName          string
 	caPool           *sandboxnet.CAPool
@@ -51,6 +65,8 @@ type Sandbox struct {
 	rootfsPath       string
 	overlaySnapshots []string
 	lifecycle        *lifecycle.Store
+	kernelPath       string
+	restored         bool // resumed from a VM snapshot rather than booted
 }
 
 // Options configures sandbox creation.
@@ -59,6 +75,8 @@ type Options struct {
 	KernelPath string
 	// RootfsPath is the path to the rootfs image (required)
 	RootfsPath string
+
+	restore *VMSnapshot // set by Restore
 }
 
 // New creates a new sandbox VM with the given configuration.
@@ -66,13 +84,51 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 	if opts == nil {
 		opts = &Options{}
 	}
-	if opts.RootfsPath == "" {
+	restore := opts.restore
+	if opts.RootfsPath == "" && (restore == nil || config.SharedRootfs) {
 		return nil, fmt.Errorf("RootfsPath is required")
 	}
+	if err := CheckNetworkPrivileges(); err != nil {
+		return nil, err
+	}
+	// Checked again by the backend, but before any rootfs or network setup.
+	if err := linux.CheckKVM(); err != nil {
+		return nil, err
+	}
+	kernelPath, err := resolveKernelPath(config, opts.KernelPath)
+	if restore != nil {
+		kernelPath, err = restore.kernel()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := validateKernelModules(config, kernelPath); err != nil {
+		return nil, err
+	}
 
 	id := config.GetID()
 	hostname := config.GetHostname()
 	workspace := config.GetWorkspace()
+	resolveAutoMTU(config, sandboxnet.DetectOutboundMTU)
+	capAdd, capDrop, err := resolveCapabilities(config)
+	if err != nil {
+		return nil, err
+	}
+	upstreamProxy, err := sandboxnet.NewUpstreamProxy(config.Network, os.Getenv)
+	if err != nil {
+		return nil, errx.Wrap(ErrCreateProxy, err)
+	}
+	sharedBridge := config.Network.UsesSharedBridge()
+	if sharedBridge && restore != nil {
+		return nil, ErrSharedBridgeSnapshot
+	}
+	cgroupParent := config.Resources.CgroupParent
+	if cgroupParent == "" {
+		cgroupParent = os.Getenv(api.CgroupParentEnv)
+		if err := api.ValidateCgroupParent(cgroupParent); err != nil {
+			return nil, errx.With(err, " (from $%s)", api.CgroupParentEnv)
+		}
+	}
 
 	stateMgr := state.NewManager()
 	if err := stateMgr.Register(id, config); err != nil {
@@ -94,32 +150,52 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		}
 	}()
 
-	// Create a copy of the rootfs for this VM (copy-on-write if supported)
+	// Give this VM its own rootfs: a prepared copy (copy-on-write if
+	// supported), or an overlay disk over a shared read-only base.
 	vmRootfsPath := stateMgr.Dir(id) + "/rootfs.ext4"
-	if err := copyRootfs(opts.RootfsPath, vmRootfsPath); err != nil {
+	var bootRootfsPath string
+	if restore != nil {
+		// The backend copies the snapshot's own disk into vmRootfsPath.
+		bootRootfsPath, err = restore.bootRootfs(config, opts.RootfsPath, vmRootfsPath, copyRootfs)
+	} else {
+		bootRootfsPath, err = stageRootfs(config, opts.RootfsPath, vmRootfsPath, copyRootfs)
+	}
+	if err != nil {
 		stateMgr.Unregister(id)
-		return nil, errx.Wrap(ErrCopyRootfs, err)
+		return nil, err
 	}
 	_ = lifecycleStore.SetResource(func(r *lifecycle.Resources) {
 		r.RootfsPath = vmRootfsPath
 		r.VsockPath = stateMgr.Dir(id) + "/vsock.sock"
 	})
-
-	// Inject guest runtime components and resize rootfs
-	var diskSizeMB int64
-	if config.Resources != nil {
-		diskSizeMB = int64(config.Resources.DiskSizeMB)
+	var rootfsOverlay string
+	if config.SharedRootfs {
+		rootfsOverlay = vmRootfsPath
 	}
-	if err := prepareRootfs(vmRootfsPath, diskSizeMB); err != nil {
-		os.Remove(vmRootfsPath)
-		stateMgr.Unregister(id)
-		return nil, errx.Wrap(ErrPrepareRootfs, err)
+	var modulesDisk string
+	if len(config.KernelModules) > 0 {
+		// A restored VM gets the snapshot's copy of the disk.
+		modulesDisk = filepath.Join(stateMgr.Dir(id), modulesDiskName)
+		if restore == nil {
+			if err := buildModulesDisk(config.KernelModules, modulesDisk); err != nil {
+				os.Remove(vmRootfsPath)
+				stateMgr.Unregister(id)
+				return nil, err
+			}
+		}
 	}
 
 	// Create CAPool early and inject cert into rootfs before VM creation
-	needsProxy := config.Network != nil && (len(config.Network.AllowedHosts) > 0 || len(config.Network.Secrets) > 0)
+	needsProxy := config.Network != nil && (len(config.Network.AllowedHosts) > 0 || config.Network.HasProxiedSecrets() || len(config.Network.MirrorRoutes) > 0 || config.Network.MetadataService || config.Network.MaxConcurrentConnections > 0 || config.Network.MaxConnectionsPerHost > 0 || len(config.Network.AllowedUDPHosts) > 0 || upstreamProxy != nil)
 	var caPool *sandboxnet.CAPool
-	if needsProxy {
+	if needsProxy && restore != nil {
+		// The restored guest already trusts the snapshot's CA.
+		caPool, err = restore.caPool()
+		if err != nil {
+			stateMgr.Unregister(id)
+			return nil, err
+		}
+	} else if needsProxy {
 		var err error
 		caPool, err = sandboxnet.NewCAPool()
 		if err != nil {
@@ -127,16 +203,27 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 			stateMgr.Unregister(id)
 			return nil, errx.Wrap(ErrCreateCAPool, err)
 		}
-		if err := injectConfigFileIntoRootfs(vmRootfsPath, "/etc/ssl/certs/matchlock-ca.crt", caPool.CACertPEM()); err != nil {
+		if err := injectCACert(config, vmRootfsPath, caPool.CACertPEM()); err != nil {
 			os.Remove(vmRootfsPath)
 			stateMgr.Unregister(id)
-			return nil, errx.Wrap(ErrInjectCACert, err)
+			return nil, err
 		}
 	}
 
 	// Allocate unique subnet for this VM
 	subnetAlloc := state.NewSubnetAllocator()
-	subnetInfo, err := subnetAlloc.Allocate(id)
+	var subnetInfo *state.SubnetInfo
+	staticIP, staticMAC := config.Network.StaticAddress()
+	switch {
+	case sharedBridge:
+		subnetInfo, err = subnetAlloc.AllocateShared(id, staticIP, staticMAC)
+	case staticIP != "" || staticMAC != "":
+		subnetInfo, err = subnetAlloc.AllocateStatic(id, staticIP, staticMAC, config.Network.PrivateHostRoutes()...)
+	case restore != nil:
+		subnetInfo, err = subnetAlloc.AllocateOctet(id, restore.SubnetOctet)
+	default:
+		subnetInfo, err = subnetAlloc.Allocate(id, config.Network.PrivateHostRoutes()...)
+	}
 	if err != nil {
 		os.Remove(vmRootfsPath)
 		stateMgr.Unregister(id)
@@ -148,13 +235,13 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		r.SubnetCIDR = subnetInfo.Subnet
 	})
 
-	backend := linux.NewLinuxBackend()
-
-	kernelPath := opts.KernelPath
-	if kernelPath == "" {
-		kernelPath = DefaultKernelPath()
+	var bridge string
+	if sharedBridge {
+		bridge = api.SharedBridgeName
 	}
 
+	backend := linux.NewLinuxBackend()
+
 	var extraDisks []vm.DiskConfig
 	for _, d := range config.ExtraDisks {
 		if err := api.ValidateGuestMount(d.GuestMount); err != nil {
@@ -170,28 +257,59 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 	}
 
 	vmConfig := &vm.VMConfig{
-		ID:         id,
-		KernelPath: kernelPath,
-		RootfsPath: vmRootfsPath,
-		CPUs:       config.Resources.CPUs,
-		MemoryMB:   config.Resources.MemoryMB,
-		SocketPath: stateMgr.SocketPath(id) + ".sock",
-		LogPath:    stateMgr.LogPath(id),
-		VsockCID:   3,
-		VsockPath:  stateMgr.Dir(id) + "/vsock.sock",
-		GatewayIP:  subnetInfo.GatewayIP,
-		GuestIP:    subnetInfo.GuestIP,
-		SubnetCIDR: subnetInfo.GatewayIP + "/24",
-		Workspace:  workspace,
-		Privileged: config.Privileged,
-		ExtraDisks: extraDisks,
-		DNSServers: config.Network.GetDNSServers(),
-		Hostname:   hostname,
-		AddHosts:   config.Network.AddHosts,
-		MTU:        config.Network.GetMTU(),
-	}
-
-	machine, err := backend.Create(ctx, vmConfig)
+		ID:            id,
+		KernelPath:    kernelPath,
+		RootfsPath:    bootRootfsPath,
+		CPUs:          config.Resources.CPUs,
+		MemoryMB:      config.Resources.MemoryMB,
+		SwapMB:        config.Resources.SwapMB,
+		CPUAffinity:   config.Resources.CPUAffinity,
+		CgroupParent:  cgroupParent,
+		Ulimits:       config.Ulimits,
+		User:          imageUser(config),
+		SocketPath:    stateMgr.SocketPath(id) + ".sock",
+		LogPath:       stateMgr.LogPath(id),
+		VsockCID:      3,
+		VsockPath:     stateMgr.Dir(id) + "/vsock.sock",
+		VsockPorts:    vsock.DefaultPorts(),
+		GatewayIP:     subnetInfo.GatewayIP,
+		GuestIP:       subnetInfo.GuestIP,
+		SubnetCIDR:    subnetInfo.GatewayCIDR(),
+		MACAddress:    staticMAC,
+		Bridge:        bridge,
+		Workspace:     workspace,
+		Privileged:    config.Privileged,
+		CapAdd:        capAdd,
+		CapDrop:       capDrop,
+		AllowSyscalls: config.AllowSyscalls,
+		KeepNewPrivs:  config.DisableNoNewPrivs,
+		ExtraDisks:    extraDisks,
+		DNSServers:    config.Network.GetDNSServers(),
+		SearchDomains: config.Network.GetSearchDomains(),
+		ResolvOptions: config.Network.GetResolvOptions(),
+		Hostname:      hostname,
+		Routes:        config.Network.PrivateHostRoutes(),
+		NetworkProbe:  config.Network.NetworkWaitProbe(),
+		SocketMounts:  api.SocketMountPaths(config.SocketMounts),
+		AddHosts:      config.Network.HostMachineAddHosts(subnetInfo.GatewayIP),
+		MTU:           config.Network.GetMTU(),
+
+		SeccompAudit:  config.SeccompAudit,
+		RootfsOverlay: rootfsOverlay,
+		ModulesDisk:   modulesDisk,
+		KernelModules: kernelModuleNames(config.KernelModules),
+		CrashDumpDir:  stateMgr.Dir(id),
+		CrashContext:  lifecycleCrashContext(lifecycleStore),
+
+		StopGracePeriod: config.GetStopGracePeriod(),
+	}
+
+	var machine vm.Machine
+	if restore != nil {
+		machine, err = backend.Restore(ctx, vmConfig, VMSnapshotDir(restore.ID))
+	} else {
+		machine, err = backend.Create(ctx, vmConfig)
+	}
 	if err != nil {
 		subnetAlloc.Release(id)
 		stateMgr.Unregister(id)
@@ -203,6 +321,9 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		r.TAPName = linuxMachine.TapName()
 		r.FirewallTable = "matchlock_" + linuxMachine.TapName()
 		r.NATTable = "matchlock_nat_" + linuxMachine.TapName()
+		if sharedBridge {
+			r.NATTable = "matchlock_br_" + linuxMachine.TapName()
+		}
 	})
 
 	// Auto-add secret hosts to allowed hosts if secrets are defined
@@ -228,12 +349,24 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		stateMgr.Unregister(id)
 		return nil, err
 	}
+	vfsProviders, err := buildVFSProviders(config, workspace)
+	if err != nil {
+		cleanupSnapshotPaths(overlaySnapshots)
+		machine.Close(ctx)
+		subnetAlloc.Release(id)
+		stateMgr.Unregister(id)
+		return nil, err
+	}
 
 	// Create policy engine
 	policyEngine := policy.NewEngine(config.Network)
+	secretFiles := addSecretFileMounts(vfsProviders, config)
+	policyEngine.SetHostMachineIP(subnetInfo.GatewayIP)
 
 	// Create event channel
-	events := make(chan api.Event, 100)
+	recorder := newEventRecorder(config.EventBufferSize)
+	events := recorder.in
+	warnWeakenedIsolation(config, events)
 
 	// Set up transparent proxy for HTTP/HTTPS interception
 	gatewayIP := subnetInfo.GatewayIP
@@ -243,6 +376,13 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 	var fwRules FirewallRules
 
 	if needsProxy {
+		resolver, err := sandboxnet.NewResolver(config.Network.UpstreamDNS)
+		if err != nil {
+			machine.Close(ctx)
+			subnetAlloc.Release(id)
+			stateMgr.Unregister(id)
+			return nil, errx.Wrap(ErrCreateProxy, err)
+		}
 		proxy, err = sandboxnet.NewTransparentProxy(&sandboxnet.ProxyConfig{
 			BindAddr:        proxyBindAddr,
 			HTTPPort:        0,
@@ -251,6 +391,11 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 			Policy:          policyEngine,
 			Events:          events,
 			CAPool:          caPool,
+			Resolver:        resolver,
+			UpstreamProxy:   upstreamProxy,
+			Metadata:        metadataService(config, policyEngine),
+			MaxConnections:  config.Network.MaxConcurrentConnections,
+			MaxPerHost:      config.Network.MaxConnectionsPerHost,
 		})
 		if err != nil {
 			machine.Close(ctx)
@@ -261,7 +406,15 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 
 		proxy.Start()
 
-		fwRules = sandboxnet.NewNFTablesRules(linuxMachine.TapName(), gatewayIP, proxy.HTTPPort(), proxy.HTTPSPort(), proxy.PassthroughPort(), config.Network.GetDNSServers())
+		udpAllow, warnings := sandboxnet.ResolveUDPAllowRules(ctx, policyEngine, config.Network.AllowedUDPHosts, resolver)
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		if sharedBridge {
+			fwRules = sandboxnet.NewNFTablesBridgeRules(bridge, linuxMachine.TapName(), subnetInfo.GuestIP, gatewayIP, proxy.HTTPPort(), proxy.HTTPSPort(), proxy.PassthroughPort(), config.Network.GetDNSServers(), udpAllow)
+		} else {
+			fwRules = sandboxnet.NewNFTablesRules(linuxMachine.TapName(), gatewayIP, proxy.HTTPPort(), proxy.HTTPSPort(), proxy.PassthroughPort(), config.Network.GetDNSServers(), udpAllow)
+		}
 		if err := fwRules.Setup(); err != nil {
 			proxy.Close()
 			machine.Close(ctx)
@@ -271,15 +424,43 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		}
 	}
 
-	// Set up basic NAT for guest network access using nftables
-	natRules := sandboxnet.NewNFTablesNAT(linuxMachine.TapName())
-	if err := natRules.Setup(); err != nil {
-		fmt.Fprintf(os.Stderr, "Warning: failed to setup NAT: %v\n", err)
-		natRules = nil
+	// Set up basic NAT for guest network access using nftables. On the
+	// shared bridge the NAT belongs to the bridge and outlives this VM;
+	// what is per VM is the port rules that keep the guest to its own MAC
+	// and IP, without which its policy could be sidestepped, and its MSS
+	// clamp. Without the shared NAT the guest has no way out, and the
+	// bridge would let it route to the other guests, so it is fatal here.
+	var natRules FirewallRules
+	if sharedBridge {
+		abort := func(kind, err error) error {
+			if proxy != nil {
+				proxy.Close()
+			}
+			if fwRules != nil {
+				fwRules.Cleanup()
+			}
+			machine.Close(ctx)
+			subnetAlloc.Release(id)
+			stateMgr.Unregister(id)
+			return errx.Wrap(kind, err)
+		}
+		if err := sandboxnet.NewNFTablesBridgeNAT(bridge).Ensure(); err != nil {
+			return nil, abort(ErrNATSetup, err)
+		}
+		portRules := sandboxnet.NewNFTablesBridgePort(bridge, linuxMachine.TapName(), linuxMachine.MACAddress(), subnetInfo.GuestIP, config.Network.ClampMSS)
+		if err := portRules.Setup(); err != nil {
+			return nil, abort(ErrFirewallSetup, err)
+		}
+		natRules = portRules
+	} else {
+		tapNAT := sandboxnet.NewNFTablesNAT(linuxMachine.TapName(), config.Network.ClampMSS)
+		if err := tapNAT.Setup(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to setup NAT: %v\n", err)
+		} else {
+			natRules = tapNAT
+		}
 	}
 
-	// Create VFS providers
-	vfsProviders := buildVFSProviders(config, workspace)
 	vfsRouter := vfs.NewMountRouter(vfsProviders)
 	var vfsRoot vfs.Provider = vfsRouter
 	vfsHooks := buildVFSHookEngine(config)
@@ -289,10 +470,17 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 	}
 
 	// Create VFS server for guest FUSE daemon connections
-	vfsServer := vfs.NewVFSServer(vfsRoot)
+	guestRoot := vfsRoot
+	guestVFSHooks := buildGuestVFSHookEngine(config)
+	if guestVFSHooks != nil {
+		guestRoot = vfs.NewInterceptProvider(vfsRoot, guestVFSHooks)
+	}
+	guestFS := vfs.NewFreezeProvider(guestRoot)
+	vfsServer := vfs.NewVFSServer(guestFS, vfsServerOptions(config)...)
+	vfsServer.SetVolatilePaths(watchedMountPaths(config)...)
 
 	// Start VFS server on the vsock UDS path for VFS port
-	vfsSocketPath := fmt.Sprintf("%s_%d", vmConfig.VsockPath, linux.VsockPortVFS)
+	vfsSocketPath := fmt.Sprintf("%s_%d", vmConfig.VsockPath, vmConfig.VsockPorts.Port(vsock.ServiceVFS))
 	vfsStopFunc, err := vfsServer.ServeUDSBackground(vfsSocketPath)
 	if err != nil {
 		if proxy != nil {
@@ -307,19 +495,94 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		return nil, errx.Wrap(ErrVFSServer, err)
 	}
 
+	var auditStopFunc func()
+	if config.SeccompAudit {
+		auditSocketPath := fmt.Sprintf("%s_%d", vmConfig.VsockPath, vmConfig.VsockPorts.Port(vsock.ServiceAudit))
+		os.Remove(auditSocketPath)
+		auditListener, err := net.Listen("unix", auditSocketPath)
+		if err != nil {
+			vfsStopFunc()
+			if proxy != nil {
+				proxy.Close()
+			}
+			if fwRules != nil {
+				fwRules.Cleanup()
+			}
+			machine.Close(ctx)
+			subnetAlloc.Release(id)
+			stateMgr.Unregister(id)
+			return nil, errx.Wrap(ErrSyscallAuditListener, err)
+		}
+		auditStopFunc = serveSyscallAudit(auditListener, events)
+	}
+
+	policySocketPath := fmt.Sprintf("%s_%d", vmConfig.VsockPath, vmConfig.VsockPorts.Port(vsock.ServicePolicy))
+	os.Remove(policySocketPath)
+	policyListener, err := net.Listen("unix", policySocketPath)
+	if err != nil {
+		if auditStopFunc != nil {
+			auditStopFunc()
+		}
+		vfsStopFunc()
+		if proxy != nil {
+			proxy.Close()
+		}
+		if fwRules != nil {
+			fwRules.Cleanup()
+		}
+		machine.Close(ctx)
+		subnetAlloc.Release(id)
+		stateMgr.Unregister(id)
+		return nil, errx.Wrap(ErrPolicyQueryListener, err)
+	}
+	policyStopFunc := servePolicyQueries(policyListener, policyEngine)
+
+	var socketStopFunc func()
+	if len(config.SocketMounts) > 0 {
+		socketPath := fmt.Sprintf("%s_%d", vmConfig.VsockPath, vmConfig.VsockPorts.Port(vsock.ServiceSocket))
+		os.Remove(socketPath)
+		socketListener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			policyStopFunc()
+			if auditStopFunc != nil {
+				auditStopFunc()
+			}
+			vfsStopFunc()
+			if proxy != nil {
+				proxy.Close()
+			}
+			if fwRules != nil {
+				fwRules.Cleanup()
+			}
+			machine.Close(ctx)
+			subnetAlloc.Release(id)
+			stateMgr.Unregister(id)
+			return nil, errx.Wrap(ErrSocketMountListener, err)
+		}
+		socketStopFunc = serveSocketMounts(socketListener, config.SocketMounts)
+	}
+
 	sb = &Sandbox{
 		id:               id,
 		config:           config,
 		machine:          machine,
+		vsockPorts:       vmConfig.VsockPorts,
 		proxy:            proxy,
 		fwRules:          fwRules,
 		natRules:         natRules,
 		policy:           policyEngine,
 		vfsRoot:          vfsRoot,
+		secretFiles:      secretFiles,
+		workspaceFS:      workspaceProvider(vfsProviders, workspace),
+		guestFS:          guestFS,
 		vfsHooks:         vfsHooks,
+		guestVFSHooks:    guestVFSHooks,
 		vfsServer:        vfsServer,
 		vfsStopFunc:      vfsStopFunc,
-		events:           events,
+		auditStopFunc:    auditStopFunc,
+		policyStopFunc:   policyStopFunc,
+		socketStopFunc:   socketStopFunc,
+		events:           recorder,
 		stateMgr:         stateMgr,
 		tapName:          linuxMachine.TapName(),
 		caPool:           caPool,
@@ -329,7 +592,10 @@ func New(ctx context.Context, config *api.Config, opts *Options) (sb *Sandbox, r
 		rootfsPath:       vmRootfsPath,
 		overlaySnapshots: overlaySnapshots,
 		lifecycle:        lifecycleStore,
+		kernelPath:       kernelPath,
+		restored:         restore != nil,
 	}
+	recorder.start(stateMgr.EventLogPath(id))
 	if err := lifecycleStore.SetPhase(lifecycle.PhaseCreated); err != nil {
 		_ = sb.Close(ctx)
 		return nil, errx.Wrap(ErrLifecycleUpdate, err)
@@ -372,6 +638,16 @@ func (s *Sandbox) Start(ctx context.Context) error {
 		}
 		return err
 	}
+	// A restored guest ran its init commands before the snapshot.
+	if !s.restored {
+		if err := s.runInitCommands(ctx); err != nil {
+			if s.lifecycle != nil {
+				_ = s.lifecycle.SetLastError(err)
+				_ = s.lifecycle.SetPhase(lifecycle.PhaseStartFailed)
+			}
+			return err
+		}
+	}
 	if s.lifecycle != nil {
 		if err := s.lifecycle.SetPhase(lifecycle.PhaseRunning); err != nil {
 			return errx.Wrap(ErrLifecycleUpdate, err)
@@ -413,7 +689,24 @@ func (s *Sandbox) PrepareExecEnv() *api.ExecOptions {
 }
 
 func (s *Sandbox) Exec(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
-	return execCommand(ctx, s.machine, s.config, s.caPool, s.policy, command, opts)
+	var result *api.ExecResult
+	_, err := s.events.traceExec(command, opts, func(opts *api.ExecOptions) (int, error) {
+		var err error
+		result, err = execCommand(ctx, s.machine, s.config, s.caPool, s.policy, command, opts)
+		if err != nil {
+			return 1, err
+		}
+		return result.ExitCode, nil
+	})
+	return result, err
+}
+
+// ExecInteractive runs command attached to a guest PTY of rows x cols,
+// relaying stdin/stdout and applying terminal sizes received on resizeCh.
+func (s *Sandbox) ExecInteractive(ctx context.Context, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error) {
+	return s.events.traceExec(command, opts, func(opts *api.ExecOptions) (int, error) {
+		return execInteractive(ctx, s.machine, s.config, s.caPool, s.policy, command, opts, rows, cols, stdin, stdout, resizeCh)
+	})
 }
 
 func (s *Sandbox) WriteFile(ctx context.Context, path string, content []byte, mode uint32) error {
@@ -428,13 +721,169 @@ func (s *Sandbox) ReadFileTo(ctx context.Context, path string, w io.Writer) (int
 	return readFileTo(s.vfsRoot, path, w)
 }
 
+func (s *Sandbox) ReadFileRange(ctx context.Context, path string, off int64, length int) ([]byte, error) {
+	return readFileRange(s.vfsRoot, path, off, length)
+}
+
 func (s *Sandbox) ListFiles(ctx context.Context, path string) ([]api.FileInfo, error) {
 	return listFiles(s.vfsRoot, path)
 }
 
-// Events returns a channel for receiving sandbox events.
+// ExportPath copies a file or directory from the sandbox VFS (the workspace
+// and its mounts) into hostDir on the host.
+func (s *Sandbox) ExportPath(ctx context.Context, guestPath, hostDir string) error {
+	return exportPath(s.vfsRoot, guestPath, hostDir, s.secretFiles)
+}
+
+// LogPath returns the VM console log, which carries kernel output and the
+// guest runtime's diagnostics.
+func (s *Sandbox) LogPath() string { return s.stateMgr.LogPath(s.id) }
+
+// Commit stores the VM's current rootfs in the local image cache as tag,
+// together with the image config it booted with.
+func (s *Sandbox) Commit(ctx context.Context, tag string, opts CommitOptions) (*image.BuildResult, error) {
+	return s.commit(ctx, tag, opts, copyRootfs)
+}
+
+// SnapshotWorkspace checkpoints the workspace VFS and returns the snapshot ID.
+// Only the workspace mount is covered; the guest rootfs is not.
+func (s *Sandbox) SnapshotWorkspace(ctx context.Context) (string, error) {
+	return snapshotWorkspace(s.workspaceFS)
+}
+
+// FreezeWorkspace makes the workspace and its mounts read-only to the guest:
+// until UnfreezeWorkspace, guest writes fail with EROFS, including writes
+// through files opened before the freeze. Host-side file operations and
+// RestoreWorkspace are not affected.
+func (s *Sandbox) FreezeWorkspace(ctx context.Context) error {
+	s.guestFS.SetFrozen(true)
+	return nil
+}
+
+// UnfreezeWorkspace lifts a FreezeWorkspace.
+func (s *Sandbox) UnfreezeWorkspace(ctx context.Context) error {
+	s.guestFS.SetFrozen(false)
+	return nil
+}
+
+// RestoreWorkspace rolls the workspace VFS back to a snapshot.
+func (s *Sandbox) RestoreWorkspace(ctx context.Context, id string) error {
+	return restoreWorkspace(s.workspaceFS, id)
+}
+
+// Snapshot saves a full snapshot of the running VM and returns its ID for
+// Restore. It captures guest memory and device state, the VM's rootfs disk,
+// the interception CA, the contents of overlay mounts and, when the
+// workspace is in memory, the workspace files; the guest is paused while
+// they are taken. Other VFS mounts are recorded by config only and are
+// rebuilt on restore, so host_fs mounts show the host directory as it is
+// then.
+func (s *Sandbox) Snapshot(ctx context.Context) (id string, retErr error) {
+	snapshotter, ok := s.machine.(vm.Snapshotter)
+	if !ok {
+		return "", ErrVMSnapshotUnsupported
+	}
+	if s.subnetInfo.Shared {
+		return "", ErrSharedBridgeSnapshot
+	}
+
+	id = newVMSnapshotID()
+	dir := VMSnapshotDir(id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errx.Wrap(ErrVMSnapshot, err)
+	}
+	defer func() {
+		if retErr != nil {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	snap := &VMSnapshot{
+		ID:          id,
+		CreatedAt:   time.Now().UTC(),
+		Backend:     "firecracker",
+		KernelPath:  s.kernelPath,
+		SubnetOctet: s.subnetInfo.Octet,
+	}
+	if s.config.SharedRootfs {
+		snap.SharedRootfs = s.machine.RootfsPath()
+	}
+	if s.caPool != nil {
+		if err := writeVMSnapshotCA(dir, s.caPool); err != nil {
+			return "", err
+		}
+	}
+
+	if err := snapshotter.Pause(ctx); err != nil {
+		return "", errx.Wrap(ErrVMSnapshot, err)
+	}
+	err := func() error {
+		config, err := snapshotConfig(s.config, s.overlaySnapshots, dir)
+		if err != nil {
+			return err
+		}
+		snap.Config = config
+		if mem, ok := s.workspaceFS.(*vfs.MemoryProvider); ok {
+			if err := exportPath(mem, "/", filepath.Join(dir, vmSnapshotWorkspaceDir), nil); err != nil {
+				return err
+			}
+			snap.Workspace = true
+		}
+		if err := snapshotter.Snapshot(ctx, dir); err != nil {
+			return errx.Wrap(ErrVMSnapshot, err)
+		}
+		return nil
+	}()
+	if resumeErr := snapshotter.Resume(context.WithoutCancel(ctx)); err == nil && resumeErr != nil {
+		err = errx.Wrap(ErrVMSnapshot, resumeErr)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := writeVMSnapshotMetadata(dir, snap); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Restore creates a sandbox that resumes VM snapshot id instead of booting,
+// with the source sandbox's config under a new ID. The guest keeps the IP
+// it had, so the source sandbox (or another restore of the same snapshot)
+// must be closed first. configure, if non-nil, may set the config's
+// non-serialized fields (such as VFS hook callbacks) before the sandbox is
+// created. opts.RootfsPath is only needed when the snapshot's sandbox used
+// shared_rootfs, and must then be the same image's rootfs. Call Start to
+// resume the guest; init commands are not run again.
+func Restore(ctx context.Context, id string, configure func(*api.Config), opts *Options) (*Sandbox, error) {
+	snap, err := LoadVMSnapshot(id)
+	if err != nil {
+		return nil, err
+	}
+	if snap.Backend != "firecracker" {
+		return nil, errx.With(ErrVMSnapshotMismatch, ": snapshot %s was taken with %s", id, snap.Backend)
+	}
+	restoreOpts := Options{}
+	if opts != nil {
+		restoreOpts = *opts
+	}
+	restoreOpts.restore = snap
+	config := snap.restoreConfig()
+	if configure != nil {
+		configure(config)
+	}
+	return New(ctx, config, &restoreOpts)
+}
+
+// Events returns a channel for receiving sandbox events. Delivery is at most
+// once: events that arrive while the channel is full are dropped and later
+// summarized by an "events_dropped" event.
 func (s *Sandbox) Events() <-chan api.Event {
-	return s.events
+	return s.events.out
+}
+
+// DroppedEvents returns how many events Events has dropped so far.
+func (s *Sandbox) DroppedEvents() uint64 {
+	return s.events.droppedTotal()
 }
 
 // Close shuts down the sandbox and releases all resources.
@@ -463,6 +912,9 @@ func (s *Sandbox) Close(ctx context.Context) error {
 	} else {
 		markCleanup("vfs_stop", nil)
 	}
+	if s.guestVFSHooks != nil {
+		s.guestVFSHooks.Close()
+	}
 	if s.vfsHooks != nil {
 		s.vfsHooks.Close()
 		markCleanup("vfs_hooks", nil)
@@ -512,7 +964,16 @@ func (s *Sandbox) Close(ctx context.Context) error {
 		markCleanup("subnet_release", nil)
 	}
 
-	close(s.events)
+	if s.auditStopFunc != nil {
+		s.auditStopFunc()
+	}
+	if s.policyStopFunc != nil {
+		s.policyStopFunc()
+	}
+	if s.socketStopFunc != nil {
+		s.socketStopFunc()
+	}
+	s.events.close()
 	markCleanup("events_close", nil)
 	if err := s.stateMgr.Unregister(s.id); err != nil {
 		errs = append(errs, errx.Wrap(ErrUnregisterState, err))
@@ -527,22 +988,26 @@ func (s *Sandbox) Close(ctx context.Context) error {
 		markCleanup("machine_close", nil)
 	}
 
-	var overlayCleanupErr error
-	for _, snapshotPath := range s.overlaySnapshots {
-		if err := os.RemoveAll(snapshotPath); err != nil {
-			errs = append(errs, errx.With(ErrRemoveOverlaySnapshot, " %s: %v", snapshotPath, err))
-			overlayCleanupErr = err
+	if !s.config.KeepStateOnClose {
+		var overlayCleanupErr error
+		for _, snapshotPath := range s.overlaySnapshots {
+			if err := os.RemoveAll(snapshotPath); err != nil {
+				errs = append(errs, errx.With(ErrRemoveOverlaySnapshot, " %s: %v", snapshotPath, err))
+				overlayCleanupErr = err
+			}
 		}
-	}
-	markCleanup("overlay_snapshot_remove", overlayCleanupErr)
+		markCleanup("overlay_snapshot_remove", overlayCleanupErr)
 
-	// Remove rootfs copy to save disk space
-	rootfsCopy := s.stateMgr.Dir(s.id) + "/rootfs.ext4"
-	if err := os.Remove(rootfsCopy); err != nil && !os.IsNotExist(err) {
-		errs = append(errs, errx.Wrap(ErrRemoveRootfs, err))
-		markCleanup("rootfs_remove", err)
-	} else {
-		markCleanup("rootfs_remove", nil)
+		// Remove the VM's own rootfs disk to save disk space. With a shared
+		// rootfs this is only the overlay; the shared base is left in place.
+		rootfsCopy := s.stateMgr.Dir(s.id) + "/rootfs.ext4"
+		if err := os.Remove(rootfsCopy); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, errx.Wrap(ErrRemoveRootfs, err))
+			markCleanup("rootfs_remove", err)
+		} else {
+			markCleanup("rootfs_remove", nil)
+		}
+		_ = os.Remove(filepath.Join(s.stateMgr.Dir(s.id), modulesDiskName))
 	}
 
 	if len(errs) > 0 {
@@ -564,21 +1029,6 @@ func (s *Sandbox) Close(ctx context.Context) error {
 	return nil
 }
 
-func createProvider(mount api.MountConfig) vfs.Provider {
-	switch mount.Type {
-	case api.MountTypeMemory:
-		return vfs.NewMemoryProvider()
-	case api.MountTypeHostFS:
-		p := vfs.NewRealFSProvider(mount.HostPath)
-		if mount.Readonly {
-			return vfs.NewReadonlyProvider(p)
-		}
-		return p
-	default:
-		return vfs.NewMemoryProvider()
-	}
-}
-
 func copyRootfs(src, dst string) error {
 	srcFile, err := os.Open(src)
 	if err != nil {
@@ -608,3 +1058,19 @@ func copyRootfs(src, dst string) error {
 
 	return nil
 }
+
+// lifecycleCrashContext renders the current lifecycle record for inclusion in
+// VM crash dumps.
+func lifecycleCrashContext(store *lifecycle.Store) func() string {
+	return func() string {
+		rec, err := store.Load()
+		if err != nil {
+			return fmt.Sprintf("lifecycle: <%v>", err)
+		}
+		data, err := json.MarshalIndent(rec, "", "  ")
+		if err != nil {
+			return fmt.Sprintf("lifecycle: <%v>", err)
+		}
+		return "lifecycle:\n" + string(data)
+	}
+}
@@ -0,0 +1,36 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// serveSyscallAudit accepts guest seccomp audit connections on listener and
+// forwards each JSON-encoded api.SyscallEvent as a "syscall" event. The
+// returned stop function closes the listener and open connections and waits
+// for all readers to exit, so events can be closed safely afterwards.
+func serveSyscallAudit(listener net.Listener, events *api.EventSink) func() {
+	return serveGuestConns(listener, func(conn net.Conn) {
+		forwardSyscallEvents(conn, events)
+	})
+}
+
+func forwardSyscallEvents(conn net.Conn, events *api.EventSink) {
+	dec := json.NewDecoder(conn)
+	for {
+		var syscallEvent api.SyscallEvent
+		if err := dec.Decode(&syscallEvent); err != nil {
+			return
+		}
+		evt := api.Event{
+			Type:      string(api.EventTypeSyscall),
+			Timestamp: time.Now().UnixMilli(),
+			Syscall:   &syscallEvent,
+		}
+		// Audit is best-effort: drop records rather than stall the guest.
+		events.Emit(evt)
+	}
+}
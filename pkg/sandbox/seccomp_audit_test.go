@@ -0,0 +1,45 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestServeSyscallAuditForwardsEvents(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	events := api.NewEventSink(10)
+	stop := serveSyscallAudit(listener, events)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	enc := json.NewEncoder(conn)
+	require.NoError(t, enc.Encode(api.SyscallEvent{Name: "mount", Nr: 165, Args: "0x1, 0x2", PID: 42}))
+	require.NoError(t, enc.Encode(api.SyscallEvent{Name: "ptrace", Nr: 101, PID: 43, Blocked: true}))
+
+	var got []api.Event
+	for len(got) < 2 {
+		select {
+		case evt := <-events.C:
+			got = append(got, evt)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for syscall events")
+		}
+	}
+	assert.Equal(t, "syscall", got[0].Type)
+	assert.Equal(t, "mount", got[0].Syscall.Name)
+	assert.Equal(t, 42, got[0].Syscall.PID)
+	assert.True(t, got[1].Syscall.Blocked)
+
+	// stop must return even with the guest connection still open.
+	stop()
+	conn.Close()
+}
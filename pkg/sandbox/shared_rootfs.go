@@ -0,0 +1,180 @@
+package sandbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// sharedRootfsHeadroomMB is the free space added to a shared base before
+// the guest runtime is injected. Images built from large Dockerfiles may
+// have almost no free blocks, and the base is never resized afterwards.
+const sharedRootfsHeadroomMB = 64
+
+// overlayUpperDir is where the guest finds the writable layer on a
+// per-VM overlay disk (see cmd/guest-init/overlay_root.go).
+const overlayUpperDir = "/upper"
+
+const caCertGuestPath = "/etc/ssl/certs/matchlock-ca.crt"
+
+// stageRootfs prepares the disk a VM boots from and returns the path to
+// attach as its root. vmRootfsPath is the VM-owned disk in the state
+// directory: a full prepared copy of srcPath, or with config.SharedRootfs
+// an empty overlay disk over a read-only base shared by every VM booted
+// from the same image. Either way only vmRootfsPath belongs to the VM.
+// The disk is checked with checkRootfs before it is returned unless
+// config.SkipRootfsCheck is set, in which case only its superblock is.
+func stageRootfs(config *api.Config, srcPath, vmRootfsPath string, copyFn func(src, dst string) error) (string, error) {
+	var diskSizeMB int64
+	if config.Resources != nil {
+		diskSizeMB = int64(config.Resources.DiskSizeMB)
+	}
+
+	if config.SharedRootfs {
+		base, err := prepareSharedRootfs(srcPath, copyFn, !config.SkipRootfsCheck)
+		if err != nil {
+			return "", errx.Wrap(ErrPrepareRootfs, err)
+		}
+		if err := checkRootfsSuperblock(base); err != nil {
+			return "", err
+		}
+		if err := createRootfsOverlay(vmRootfsPath, diskSizeMB); err != nil {
+			os.Remove(vmRootfsPath)
+			return "", err
+		}
+		return base, nil
+	}
+
+	if err := copyFn(srcPath, vmRootfsPath); err != nil {
+		return "", errx.Wrap(ErrCopyRootfs, err)
+	}
+	if err := prepareRootfs(vmRootfsPath, diskSizeMB); err != nil {
+		os.Remove(vmRootfsPath)
+		return "", errx.Wrap(ErrPrepareRootfs, err)
+	}
+	if err := checkRootfs(vmRootfsPath, !config.SkipRootfsCheck); err != nil {
+		os.Remove(vmRootfsPath)
+		return "", err
+	}
+	return vmRootfsPath, nil
+}
+
+// injectCACert installs the interception CA into the VM-owned rootfs disk,
+// which is the overlay's upper layer when the base is shared.
+func injectCACert(config *api.Config, vmRootfsPath string, caCertPEM []byte) error {
+	guestPath := caCertGuestPath
+	if config.SharedRootfs {
+		guestPath = overlayUpperDir + guestPath
+	}
+	if err := injectConfigFileIntoRootfs(vmRootfsPath, guestPath, caCertPEM); err != nil {
+		return errx.Wrap(ErrInjectCACert, err)
+	}
+	return nil
+}
+
+// sharedRootfsDir holds prepared read-only base images.
+func sharedRootfsDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".cache", "matchlock", "shared-rootfs")
+}
+
+// sharedRootfsKey identifies a prepared base by the image and guest-init
+// it was built from, so rebuilding either prepares a fresh base.
+func sharedRootfsKey(srcPath, guestInitPath string) (string, error) {
+	h := sha256.New()
+	for _, p := range []string{srcPath, guestInitPath} {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return "", err
+		}
+		fi, err := os.Stat(abs)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", abs, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32], nil
+}
+
+// prepareSharedRootfs returns the read-only base for srcPath, preparing it
+// on first use. The base is built under a temporary name and renamed into
+// place, so concurrent creates never boot from a half-written image. A
+// corrupt base is never renamed into place; full selects the e2fsck pass
+// of checkRootfs.
+func prepareSharedRootfs(srcPath string, copyFn func(src, dst string) error, full bool) (string, error) {
+	guestInitPath := DefaultGuestInitPath()
+	key, err := sharedRootfsKey(srcPath, guestInitPath)
+	if err != nil {
+		return "", errx.Wrap(ErrSharedRootfs, err)
+	}
+
+	dir := sharedRootfsDir()
+	base := filepath.Join(dir, key+".ext4")
+	if _, err := os.Stat(base); err == nil {
+		return base, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errx.Wrap(ErrSharedRootfs, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, key+".*.tmp")
+	if err != nil {
+		return "", errx.Wrap(ErrSharedRootfs, err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := copyFn(srcPath, tmpPath); err != nil {
+		return "", errx.Wrap(ErrCopyRootfs, err)
+	}
+	fi, err := os.Stat(tmpPath)
+	if err != nil {
+		return "", errx.Wrap(ErrStatRootfs, err)
+	}
+	sizeMB := fi.Size()/(1024*1024) + sharedRootfsHeadroomMB
+	if err := prepareRootfs(tmpPath, sizeMB); err != nil {
+		return "", err
+	}
+	if err := checkRootfs(tmpPath, full); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpPath, base); err != nil {
+		return "", errx.Wrap(ErrSharedRootfs, err)
+	}
+	return base, nil
+}
+
+// createRootfsOverlay creates the empty ext4 disk that receives a VM's
+// writes over a shared base. The file is sparse, so sizeMB (default
+// api.DefaultDiskSizeMB) only bounds how much the VM can write.
+func createRootfsOverlay(path string, sizeMB int64) error {
+	if sizeMB <= 0 {
+		sizeMB = api.DefaultDiskSizeMB
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errx.Wrap(ErrCreateRootfsOverlay, err)
+	}
+	err = f.Truncate(sizeMB * 1024 * 1024)
+	f.Close()
+	if err != nil {
+		return errx.Wrap(ErrCreateRootfsOverlay, err)
+	}
+
+	mkfsPath, err := exec.LookPath("mkfs.ext4")
+	if err != nil {
+		return errx.With(ErrCreateRootfsOverlay, ": mkfs.ext4 not found; install e2fsprogs")
+	}
+	cmd := exec.Command(mkfsPath, "-F", "-q", path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errx.With(ErrCreateRootfsOverlay, ": mkfs.ext4: %w: %s", err, out)
+	}
+	return nil
+}
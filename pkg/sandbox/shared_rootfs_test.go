@@ -0,0 +1,100 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedRootfsKeyTracksInputs(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "rootfs.ext4")
+	guestInit := filepath.Join(dir, "guest-init")
+	require.NoError(t, os.WriteFile(src, []byte("rootfs"), 0644))
+	require.NoError(t, os.WriteFile(guestInit, []byte("init"), 0755))
+
+	key, err := sharedRootfsKey(src, guestInit)
+	require.NoError(t, err)
+	again, err := sharedRootfsKey(src, guestInit)
+	require.NoError(t, err)
+	assert.Equal(t, key, again)
+
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(guestInit, later, later))
+	rebuilt, err := sharedRootfsKey(src, guestInit)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, rebuilt)
+}
+
+func TestStageRootfsSharedLeavesBaseUntouched(t *testing.T) {
+	if !hasDebugfs() || !hasMkfsExt4() {
+		t.Skip("debugfs or mkfs.ext4 not available")
+	}
+	t.Setenv("HOME", t.TempDir())
+	guestInit := filepath.Join(t.TempDir(), "guest-init")
+	require.NoError(t, os.WriteFile(guestInit, []byte("#!/bin/sh\n"), 0755))
+	t.Setenv("MATCHLOCK_GUEST_INIT", guestInit)
+
+	src := createTestExt4(t, 16)
+	config := &api.Config{SharedRootfs: true, Resources: &api.Resources{DiskSizeMB: 64}}
+
+	overlay1 := filepath.Join(t.TempDir(), "rootfs.ext4")
+	base1, err := stageRootfs(config, src, overlay1, copyFile)
+	require.NoError(t, err)
+	overlay2 := filepath.Join(t.TempDir(), "rootfs.ext4")
+	base2, err := stageRootfs(config, src, overlay2, copyFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, base1, base2, "VMs from one image share a base")
+	assert.Equal(t, sharedRootfsDir(), filepath.Dir(base1))
+	assert.Contains(t, debugfsStatMode(t, base1, "/opt/matchlock/guest-init"), "0755")
+
+	fi, err := os.Stat(overlay1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(64*1024*1024), fi.Size())
+
+	require.NoError(t, injectCACert(config, overlay1, []byte("ca")))
+	assert.Equal(t, "ca", debugfsCat(t, overlay1, overlayUpperDir+caCertGuestPath))
+
+	require.NoError(t, os.Remove(overlay1))
+	_, err = os.Stat(base1)
+	assert.NoError(t, err, "removing a VM's overlay keeps the shared base")
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+func TestStageRootfsRejectsTruncatedCopy(t *testing.T) {
+	if !hasDebugfs() || !hasMkfsExt4() {
+		t.Skip("debugfs or mkfs.ext4 not available")
+	}
+	guestInit := filepath.Join(t.TempDir(), "guest-init")
+	require.NoError(t, os.WriteFile(guestInit, []byte("#!/bin/sh\n"), 0755))
+	t.Setenv("MATCHLOCK_GUEST_INIT", guestInit)
+
+	src := createTestExt4(t, 16)
+	truncatingCopy := func(src, dst string) error {
+		if err := copyFile(src, dst); err != nil {
+			return err
+		}
+		return os.Truncate(dst, 4*1024*1024)
+	}
+
+	for _, skip := range []bool{false, true} {
+		dst := filepath.Join(t.TempDir(), "rootfs.ext4")
+		_, err := stageRootfs(&api.Config{SkipRootfsCheck: skip}, src, dst, truncatingCopy)
+		require.ErrorIs(t, err, ErrRootfsCorrupt, "skip=%v: the superblock check always runs", skip)
+		_, statErr := os.Stat(dst)
+		assert.True(t, os.IsNotExist(statErr), "corrupt copy is removed")
+	}
+}
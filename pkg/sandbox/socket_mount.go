@@ -0,0 +1,47 @@
+package sandbox
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+)
+
+// serveSocketMounts proxies guest unix socket mount connections on listener
+// to host sockets. The guest agent opens one vsock connection per client,
+// names the guest path it accepted on in a newline-terminated header and
+// then relays raw bytes. Connections naming a path that is not in mounts
+// are dropped, so the guest can only reach the sockets it was given.
+func serveSocketMounts(listener net.Listener, mounts map[string]string) func() {
+	return serveGuestConns(listener, func(conn net.Conn) {
+		proxySocketMount(conn, mounts)
+	})
+}
+
+func proxySocketMount(conn net.Conn, mounts map[string]string) {
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	hostPath, ok := mounts[strings.TrimSuffix(header, "\n")]
+	if !ok {
+		return
+	}
+	target, err := net.Dial("unix", hostPath)
+	if err != nil {
+		return
+	}
+	defer target.Close()
+
+	go func() {
+		_, _ = io.Copy(target, reader)
+		// The host socket sees the guest client's half-close, but the
+		// reverse is not propagated onto the vsock side (see
+		// PortForwardManager.proxyConn): the session ends when the host closes.
+		if cw, ok := target.(*net.UnixConn); ok {
+			_ = cw.CloseWrite()
+		}
+	}()
+	_, _ = io.Copy(conn, target)
+}
@@ -0,0 +1,60 @@
+package sandbox
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeSocketMountsProxiesToHostSocket(t *testing.T) {
+	hostPath := filepath.Join(t.TempDir(), "host.sock")
+	hostListener, err := net.Listen("unix", hostPath)
+	require.NoError(t, err)
+	defer hostListener.Close()
+	go func() {
+		conn, err := hostListener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		_, _ = io.WriteString(conn, "echo: "+line)
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	stop := serveSocketMounts(listener, map[string]string{"/var/run/docker.sock": hostPath})
+	defer stop()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "/var/run/docker.sock\nping\n")
+	require.NoError(t, err)
+
+	reply, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "echo: ping\n", string(reply))
+}
+
+func TestServeSocketMountsDropsUnknownPaths(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	stop := serveSocketMounts(listener, map[string]string{"/run/a.sock": "/nonexistent.sock"})
+	defer stop()
+
+	for _, header := range []string{"/run/other.sock\n", "/run/a.sock\n"} {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		require.NoError(t, err)
+		_, err = io.WriteString(conn, header)
+		require.NoError(t, err)
+		reply, _ := io.ReadAll(conn)
+		assert.Empty(t, reply, header)
+		conn.Close()
+	}
+}
@@ -0,0 +1,49 @@
+package sandbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vm"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+)
+
+// Stats samples the sandbox's resource usage. Backends that implement
+// vm.MetricsReader report host-side figures too; on the others only the
+// guest agent's CPU, memory and exec counters are filled in.
+func (s *Sandbox) Stats(ctx context.Context) (*api.Stats, error) {
+	if reader, ok := s.machine.(vm.MetricsReader); ok {
+		stats, err := reader.Metrics(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, errx.Wrap(ErrStats, err)
+		}
+		return stats, nil
+	}
+
+	dialer, ok := s.machine.(vm.VsockDialer)
+	if !ok {
+		return nil, ErrNoVsockDialer
+	}
+	conn, err := dialer.DialVsock(s.vsockPorts.Port(vsock.ServiceExec))
+	if err != nil {
+		return nil, errx.Wrap(ErrStats, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	stats, err := vsock.QueryStats(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrStats, err)
+	}
+	stats.Time = time.Now()
+	return stats, nil
+}
@@ -0,0 +1,92 @@
+package sandbox
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+)
+
+// statsGuestMachine answers the stats query on its exec port like the
+// guest agent does.
+type statsGuestMachine struct {
+	fakeInteractiveMachine
+	reply []byte
+}
+
+func (m *statsGuestMachine) DialVsock(port uint32) (net.Conn, error) {
+	host, guest := net.Pipe()
+	go func() {
+		defer guest.Close()
+		header := make([]byte, 5)
+		if _, err := vsock.ReadFull(guest, header); err != nil {
+			return
+		}
+		_ = vsock.SendMessage(guest, vsock.MsgTypeStats, m.reply)
+	}()
+	return host, nil
+}
+
+// metricsMachine reports stats itself, like the Firecracker backend.
+type metricsMachine struct {
+	fakeInteractiveMachine
+	stats *api.Stats
+}
+
+func (m *metricsMachine) Metrics(ctx context.Context) (*api.Stats, error) {
+	return m.stats, nil
+}
+
+func TestStatsQueriesGuestAgent(t *testing.T) {
+	sb := &Sandbox{
+		config:  &api.Config{},
+		machine: &statsGuestMachine{reply: []byte(`{"cpu_usage_usec":10,"memory_used_bytes":20,"memory_total_bytes":40,"active_execs":1}`)},
+		events:  newEventRecorder(0),
+	}
+
+	stats, err := sb.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), stats.CPUUsageUsec)
+	assert.Equal(t, uint64(20), stats.MemoryUsedBytes)
+	assert.Equal(t, 1, stats.ActiveExecs)
+	assert.Zero(t, stats.VMMRSSBytes)
+	assert.False(t, stats.Time.IsZero())
+}
+
+func TestStatsPrefersMachineMetrics(t *testing.T) {
+	want := &api.Stats{CPUUsageUsec: 10, VMMRSSBytes: 1 << 20, NetRxBytes: 7}
+	sb := &Sandbox{config: &api.Config{}, machine: &metricsMachine{stats: want}, events: newEventRecorder(0)}
+
+	stats, err := sb.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, want, stats)
+}
+
+func TestStatsWithoutVsock(t *testing.T) {
+	sb := &Sandbox{config: &api.Config{}, machine: newFakeInteractiveMachine(), events: newEventRecorder(0)}
+
+	_, err := sb.Stats(context.Background())
+	assert.ErrorIs(t, err, ErrNoVsockDialer)
+}
+
+func TestStatsViaRelay(t *testing.T) {
+	sb := &Sandbox{
+		config:  &api.Config{},
+		machine: &statsGuestMachine{reply: []byte(`{"cpu_usage_usec":10,"active_execs":3}`)},
+		events:  newEventRecorder(0),
+	}
+	relay := NewExecRelay(sb)
+	socketPath := t.TempDir() + "/exec.sock"
+	require.NoError(t, relay.Start(socketPath))
+	defer relay.Stop()
+
+	stats, err := StatsViaRelay(context.Background(), socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), stats.CPUUsageUsec)
+	assert.Equal(t, 3, stats.ActiveExecs)
+}
@@ -0,0 +1,35 @@
+package sandbox
+
+import (
+	"context"
+	"io"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/vm"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+)
+
+// TailFile follows the guest file at path, which may be anywhere in the
+// guest filesystem, and copies the bytes appended to it into w until ctx is
+// done. A truncated file is followed from its start again and a rotated one
+// is reopened. Output written before the call is not sent.
+func (s *Sandbox) TailFile(ctx context.Context, path string, w io.Writer) error {
+	dialer, ok := s.machine.(vm.VsockDialer)
+	if !ok {
+		return ErrNoVsockDialer
+	}
+
+	conn, err := dialer.DialVsock(s.vsockPorts.Port(vsock.ServiceExec))
+	if err != nil {
+		return errx.Wrap(ErrTailFile, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	err = vsock.TailFile(conn, path, w)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return errx.With(ErrTailFile, " %s: %w", path, err)
+}
@@ -0,0 +1,239 @@
+package sandbox
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// traceStartEvent is an internal marker sent through the recorder when an
+// exec starts; it is never logged or forwarded.
+const traceStartEvent = "trace_start"
+
+// droppedReportInterval is how often dropped events are summarized as an
+// "events_dropped" event.
+const droppedReportInterval = time.Second
+
+// eventRecorder sits between event producers (proxy, VFS hooks, seccomp
+// audit, execs) and Sandbox.Events. It attributes untraced events to the
+// running exec, appends every event to the VM's event log, and forwards it
+// without blocking. Exec start markers and exec events travel through the
+// same channel as other events, so attribution follows arrival order.
+//
+// Delivery to Sandbox.Events is at most once: a consumer that falls behind
+// loses events rather than stalling producers such as the network proxy.
+// Those drops, and events producers could not hand to the recorder itself,
+// are counted and summarized by an api.EventsDropped event once the
+// consumer catches up.
+type eventRecorder struct {
+	in       *api.EventSink
+	out      chan api.Event
+	log      *os.File
+	done     chan struct{}
+	active   map[string]int // running execs by trace ID; owned by run
+	dropped  atomic.Uint64  // consumer-side drops; see droppedTotal
+	reported uint64         // drops already summarized; owned by run
+
+	mu     sync.Mutex // guards closed and sends from traceExec
+	closed bool
+	seq    atomic.Uint64
+}
+
+// newEventRecorder returns a recorder whose input buffers events until start
+// is called, so producers can be wired up before sandbox creation succeeds.
+// bufferSize <= 0 uses api.DefaultEventBufferSize.
+func newEventRecorder(bufferSize int) *eventRecorder {
+	if bufferSize <= 0 {
+		bufferSize = api.DefaultEventBufferSize
+	}
+	return &eventRecorder{
+		in:     api.NewEventSink(bufferSize),
+		out:    make(chan api.Event, bufferSize),
+		done:   make(chan struct{}),
+		active: make(map[string]int),
+	}
+}
+
+// start begins recording to logPath. A log that cannot be opened only
+// disables persistence.
+func (r *eventRecorder) start(logPath string) {
+	if logPath != "" {
+		f, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to open event log: %v\n", err)
+		} else {
+			r.log = f
+		}
+	}
+	go r.run()
+}
+
+func (r *eventRecorder) run() {
+	defer close(r.done)
+	defer close(r.out)
+
+	var enc *json.Encoder
+	if r.log != nil {
+		defer r.log.Close()
+		enc = json.NewEncoder(r.log)
+	}
+	ticker := time.NewTicker(droppedReportInterval)
+	defer ticker.Stop()
+
+	for {
+		var evt api.Event
+		select {
+		case <-ticker.C:
+			r.reportDropped()
+			continue
+		case e, ok := <-r.in.C:
+			if !ok {
+				r.reportDropped()
+				return
+			}
+			evt = e
+		}
+
+		switch {
+		case evt.Type == traceStartEvent:
+			r.active[evt.TraceID]++
+			continue
+		case evt.Type == string(api.EventTypeExec):
+			if r.active[evt.TraceID]--; r.active[evt.TraceID] <= 0 {
+				delete(r.active, evt.TraceID)
+			}
+		case evt.TraceID == "":
+			evt.TraceID = r.currentTrace()
+		}
+		if enc != nil {
+			_ = enc.Encode(evt)
+		}
+		select {
+		case r.out <- evt:
+		default:
+			r.dropped.Add(1)
+		}
+	}
+}
+
+// droppedTotal returns how many events were lost on either side of the
+// recorder.
+func (r *eventRecorder) droppedTotal() uint64 {
+	return r.dropped.Load() + r.in.Dropped()
+}
+
+// reportDropped forwards a summary of events dropped since the last one.
+// If the consumer is still behind, the summary waits for the next tick.
+func (r *eventRecorder) reportDropped() {
+	total := r.droppedTotal()
+	if total == r.reported {
+		return
+	}
+	evt := api.Event{
+		Type:      string(api.EventTypeEventsDropped),
+		Timestamp: time.Now().Unix(),
+		Dropped:   &api.EventsDropped{Count: total - r.reported, Total: total},
+	}
+	select {
+	case r.out <- evt:
+		r.reported = total
+	default:
+	}
+}
+
+// close stops accepting events and waits until the log is flushed and the
+// output channel is closed. Producers other than traceExec must be stopped
+// first.
+func (r *eventRecorder) close() {
+	r.mu.Lock()
+	r.closed = true
+	close(r.in.C)
+	r.mu.Unlock()
+	<-r.done
+}
+
+// currentTrace returns the trace ID of the only running exec. With zero or
+// several concurrent execs, attribution would be a guess, so it is empty.
+func (r *eventRecorder) currentTrace() string {
+	if len(r.active) != 1 {
+		return ""
+	}
+	for id := range r.active {
+		return id
+	}
+	return ""
+}
+
+// traceExec runs an exec under a trace ID: it fills in opts.TraceID, exports
+// it to the guest command, marks the exec as running for event attribution,
+// and records an exec event when run returns.
+func (r *eventRecorder) traceExec(command string, opts *api.ExecOptions, run func(*api.ExecOptions) (int, error)) (int, error) {
+	if opts == nil {
+		opts = &api.ExecOptions{}
+	}
+	if opts.TraceID == "" {
+		opts.TraceID = fmt.Sprintf("exec-%d", r.seq.Add(1))
+	}
+	if opts.Env == nil {
+		opts.Env = make(map[string]string)
+	}
+	opts.Env[api.TraceIDEnvKey] = opts.TraceID
+
+	r.send(api.Event{Type: traceStartEvent, TraceID: opts.TraceID})
+	exitCode, err := run(opts)
+
+	evt := api.Event{
+		Type:      string(api.EventTypeExec),
+		Timestamp: time.Now().UnixMilli(),
+		TraceID:   opts.TraceID,
+		Exec:      &api.ExecEvent{Command: command, ExitCode: exitCode},
+	}
+	if err != nil {
+		evt.Exec.Error = err.Error()
+	}
+
+	r.send(evt)
+	return exitCode, err
+}
+
+// send delivers an exec lifecycle event. Unlike producer events these are
+// never dropped, since the recorder's running-exec set depends on them.
+// Execs can outlive close; their events are discarded once it has run.
+func (r *eventRecorder) send(evt api.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.closed {
+		r.in.C <- evt
+	}
+}
+
+// ReadEventLog reads the events recorded for a VM by its sandbox.
+func ReadEventLog(path string) ([]api.Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errx.Wrap(ErrReadEventLog, err)
+	}
+	defer f.Close()
+
+	var events []api.Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var evt api.Event
+		if err := json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+			continue
+		}
+		events = append(events, evt)
+	}
+	if err := scanner.Err(); err != nil {
+		return events, errx.Wrap(ErrReadEventLog, err)
+	}
+	return events, nil
+}
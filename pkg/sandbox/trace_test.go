@@ -0,0 +1,127 @@
+package sandbox
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestEventRecorderAttributesEventsToRunningExec(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	r := newEventRecorder(0)
+	r.start(logPath)
+
+	_, err := r.traceExec("curl example.com", nil, func(opts *api.ExecOptions) (int, error) {
+		assert.Equal(t, "exec-1", opts.TraceID)
+		assert.Equal(t, "exec-1", opts.Env[api.TraceIDEnvKey])
+		r.in.C <- api.Event{Type: "network", Network: &api.NetworkEvent{Host: "example.com"}}
+		r.in.C <- api.Event{Type: "network", TraceID: "explicit", Network: &api.NetworkEvent{Host: "tagged.example.com"}}
+		return 0, nil
+	})
+	require.NoError(t, err)
+
+	_, err = r.traceExec("false", &api.ExecOptions{TraceID: "rpc-7"}, func(opts *api.ExecOptions) (int, error) {
+		return 1, errors.New("boom")
+	})
+	require.Error(t, err)
+
+	r.in.C <- api.Event{Type: "file", File: &api.FileEvent{Op: "write", Path: "/workspace/idle"}}
+	r.close()
+
+	events, err := ReadEventLog(logPath)
+	require.NoError(t, err)
+	require.Len(t, events, 5)
+
+	assert.Equal(t, "exec-1", events[0].TraceID)
+	assert.Equal(t, "explicit", events[1].TraceID)
+	assert.Equal(t, "exec", events[2].Type)
+	assert.Equal(t, "exec-1", events[2].TraceID)
+	assert.Equal(t, "curl example.com", events[2].Exec.Command)
+	assert.Equal(t, "rpc-7", events[3].TraceID)
+	assert.Equal(t, "boom", events[3].Exec.Error)
+	assert.Empty(t, events[4].TraceID, "events outside an exec stay untraced")
+}
+
+func TestEventRecorderLeavesConcurrentExecEventsUntraced(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "events.jsonl")
+	r := newEventRecorder(0)
+	r.start(logPath)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = r.traceExec("sleep", nil, func(*api.ExecOptions) (int, error) {
+			close(started)
+			<-release
+			return 0, nil
+		})
+	}()
+	<-started
+
+	_, _ = r.traceExec("other", nil, func(*api.ExecOptions) (int, error) {
+		r.in.C <- api.Event{Type: "file", File: &api.FileEvent{Op: "write", Path: "/workspace/x"}}
+		return 0, nil
+	})
+	close(release)
+	<-done
+	r.close()
+
+	events, err := ReadEventLog(logPath)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "file", events[0].Type)
+	assert.Empty(t, events[0].TraceID, "attribution is ambiguous with two running execs")
+}
+
+func TestEventRecorderCountsAndReportsDroppedEvents(t *testing.T) {
+	r := newEventRecorder(2)
+	r.start("")
+
+	for i := 0; i < 5; i++ {
+		r.in.C <- api.Event{Type: "network", Network: &api.NetworkEvent{Host: "example.com"}}
+	}
+	require.Eventually(t, func() bool { return r.dropped.Load() == 3 }, 5*time.Second, time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "network", (<-r.out).Type)
+	}
+	r.close()
+
+	var rest []api.Event
+	for evt := range r.out {
+		rest = append(rest, evt)
+	}
+	require.Len(t, rest, 1)
+	assert.Equal(t, "events_dropped", rest[0].Type)
+	assert.Equal(t, &api.EventsDropped{Count: 3, Total: 3}, rest[0].Dropped)
+}
+
+func TestEventRecorderReportsProducerDrops(t *testing.T) {
+	r := newEventRecorder(1)
+
+	// Not started yet, so the input buffer fills and Emit drops the rest.
+	for i := 0; i < 4; i++ {
+		r.in.Emit(api.Event{Type: "network", Network: &api.NetworkEvent{Host: "example.com"}})
+	}
+	assert.Equal(t, uint64(3), r.droppedTotal())
+
+	r.start("")
+	assert.Equal(t, "network", (<-r.out).Type)
+	r.close()
+
+	var rest []api.Event
+	for evt := range r.out {
+		rest = append(rest, evt)
+	}
+	require.Len(t, rest, 1)
+	assert.Equal(t, "events_dropped", rest[0].Type)
+	assert.Equal(t, &api.EventsDropped{Count: 3, Total: 3}, rest[0].Dropped)
+}
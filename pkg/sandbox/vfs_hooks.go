@@ -1,7 +1,9 @@
 package sandbox
 
 import (
+	"context"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/jingkaihe/matchlock/pkg/api"
@@ -49,7 +51,110 @@ func buildVFSHookEngine(config *api.Config) *vfs.HookEngine {
 	return vfs.NewHookEngine(rules)
 }
 
-func attachVFSFileEvents(hooks *vfs.HookEngine, events chan api.Event) {
+// defaultVFSHookDecisionTimeout bounds how long a guest operation waits for a
+// callback rule's decision when the rule sets no timeout.
+const defaultVFSHookDecisionTimeout = 5 * time.Second
+
+// buildGuestVFSHookEngine compiles callback and mutate_callback rules into a
+// hook engine that only sees guest-originated operations. Host-initiated
+// file RPCs are checked and mutated by the client itself before they are
+// sent, so they bypass it.
+func buildGuestVFSHookEngine(config *api.Config) *vfs.HookEngine {
+	if config == nil || config.VFS == nil || !config.VFS.Interception.HasCallbackRules() {
+		return nil
+	}
+
+	decider := config.VFS.Interception.Decider
+	mutator := config.VFS.Interception.Mutator
+	var rules []vfs.HookRule
+	decideIndex, mutateIndex := 0, 0
+	for _, cfgRule := range config.VFS.Interception.Rules {
+		isDecide := strings.EqualFold(cfgRule.Action, api.VFSHookActionCallback)
+		isMutate := strings.EqualFold(cfgRule.Action, api.VFSHookActionMutateCallback)
+		if !isDecide && !isMutate {
+			continue
+		}
+
+		ops := make([]vfs.HookOp, 0, len(cfgRule.Ops))
+		for _, opName := range cfgRule.Ops {
+			if op, ok := parseVFSHookOp(opName); ok {
+				ops = append(ops, op)
+			}
+		}
+		timeout := defaultVFSHookDecisionTimeout
+		if cfgRule.TimeoutMS > 0 {
+			timeout = time.Duration(cfgRule.TimeoutMS) * time.Millisecond
+		}
+
+		if isMutate {
+			ruleIndex := mutateIndex
+			mutateIndex++
+			rules = append(rules, vfs.HookRule{
+				Name:        cfgRule.Name,
+				Phase:       vfs.HookPhaseBefore,
+				Ops:         ops,
+				PathPattern: cfgRule.Path,
+				Action:      vfs.HookActionMutateWrite,
+				MutateWriteFunc: func(ctx context.Context, req vfs.MutateWriteRequest) ([]byte, error) {
+					if mutator == nil {
+						return nil, syscall.EPERM
+					}
+					ctx, cancel := context.WithTimeout(ctx, timeout)
+					defer cancel()
+					data, err := mutator(ctx, api.VFSHookMutateRequest{
+						Rule:   ruleIndex,
+						Path:   req.Path,
+						Offset: req.Offset,
+						Data:   req.Data,
+						Mode:   uint32(req.Mode),
+						UID:    req.UID,
+						GID:    req.GID,
+					})
+					if err != nil {
+						return nil, err
+					}
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					return data, nil
+				},
+			})
+			continue
+		}
+
+		ruleIndex := decideIndex
+		decideIndex++
+		rules = append(rules, vfs.HookRule{
+			Name:        cfgRule.Name,
+			Phase:       vfs.HookPhaseBefore,
+			Ops:         ops,
+			PathPattern: cfgRule.Path,
+			ActionFunc: func(ctx context.Context, req vfs.HookRequest) vfs.HookAction {
+				if decider == nil {
+					return vfs.HookActionBlock
+				}
+				ctx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				decision := decider(ctx, api.VFSHookDecisionRequest{
+					Rule: ruleIndex,
+					Op:   string(req.Op),
+					Path: req.Path,
+					Size: len(req.Data),
+					Mode: uint32(req.Mode),
+					UID:  req.UID,
+					GID:  req.GID,
+				})
+				if ctx.Err() == nil && strings.EqualFold(decision, string(vfs.HookActionAllow)) {
+					return vfs.HookActionAllow
+				}
+				return vfs.HookActionBlock
+			},
+		})
+	}
+	return vfs.NewHookEngine(rules)
+}
+
+func attachVFSFileEvents(hooks *vfs.HookEngine, events *api.EventSink) {
 	if hooks == nil || events == nil {
 		return
 	}
@@ -67,7 +172,7 @@ func attachVFSFileEvents(hooks *vfs.HookEngine, events chan api.Event) {
 		}
 
 		evt := api.Event{
-			Type:      "file",
+			Type:      string(api.EventTypeFile),
 			Timestamp: time.Now().UnixMilli(),
 			File: &api.FileEvent{
 				Op:   string(req.Op),
@@ -78,10 +183,7 @@ func attachVFSFileEvents(hooks *vfs.HookEngine, events chan api.Event) {
 				GID:  gid,
 			},
 		}
-		select {
-		case events <- evt:
-		default:
-		}
+		events.Emit(evt)
 	})
 }
 
@@ -0,0 +1,102 @@
+package sandbox
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vfs"
+)
+
+func callbackConfig(decider api.VFSHookDecider, timeoutMS int) *api.Config {
+	return &api.Config{VFS: &api.VFSConfig{Interception: &api.VFSInterceptionConfig{
+		Rules: []api.VFSHookRule{
+			{Name: "static", Action: "block", Ops: []string{"remove"}},
+			{Name: "ask", Action: api.VFSHookActionCallback, Ops: []string{"write"}, Path: "/workspace/*", TimeoutMS: timeoutMS},
+		},
+		Decider: decider,
+	}}}
+}
+
+func TestBuildGuestVFSHookEngineAsksDecider(t *testing.T) {
+	var got api.VFSHookDecisionRequest
+	hooks := buildGuestVFSHookEngine(callbackConfig(func(ctx context.Context, req api.VFSHookDecisionRequest) string {
+		got = req
+		if req.Path == "/workspace/secret" {
+			return "block"
+		}
+		return "allow"
+	}, 0))
+	require.NotNil(t, hooks)
+	defer hooks.Close()
+
+	req := vfs.HookRequest{Op: vfs.HookOpWrite, Path: "/workspace/ok", Data: []byte("abc"), UID: 1000, GID: 1000}
+	require.NoError(t, hooks.Before(&req))
+	assert.Equal(t, api.VFSHookDecisionRequest{Rule: 0, Op: "write", Path: "/workspace/ok", Size: 3, UID: 1000, GID: 1000}, got)
+
+	req = vfs.HookRequest{Op: vfs.HookOpWrite, Path: "/workspace/secret"}
+	assert.ErrorIs(t, hooks.Before(&req), syscall.EPERM)
+
+	// Static rules stay in the main engine.
+	req = vfs.HookRequest{Op: vfs.HookOpRemove, Path: "/workspace/ok"}
+	assert.NoError(t, hooks.Before(&req))
+}
+
+func TestBuildGuestVFSHookEngineFailsClosed(t *testing.T) {
+	hooks := buildGuestVFSHookEngine(callbackConfig(nil, 0))
+	require.NotNil(t, hooks)
+	defer hooks.Close()
+	req := vfs.HookRequest{Op: vfs.HookOpWrite, Path: "/workspace/a"}
+	assert.ErrorIs(t, hooks.Before(&req), syscall.EPERM, "no decider")
+
+	slow := buildGuestVFSHookEngine(callbackConfig(func(ctx context.Context, req api.VFSHookDecisionRequest) string {
+		<-ctx.Done()
+		return "allow"
+	}, 20))
+	defer slow.Close()
+	start := time.Now()
+	req = vfs.HookRequest{Op: vfs.HookOpWrite, Path: "/workspace/a"}
+	assert.ErrorIs(t, slow.Before(&req), syscall.EPERM, "decision timed out")
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestBuildGuestVFSHookEngineWithoutCallbackRules(t *testing.T) {
+	assert.Nil(t, buildGuestVFSHookEngine(&api.Config{VFS: &api.VFSConfig{Interception: &api.VFSInterceptionConfig{
+		Rules: []api.VFSHookRule{{Action: "block"}},
+	}}}))
+	assert.Nil(t, buildGuestVFSHookEngine(&api.Config{}))
+}
+
+func TestBuildGuestVFSHookEngineMutatesWrites(t *testing.T) {
+	var got api.VFSHookMutateRequest
+	hooks := buildGuestVFSHookEngine(&api.Config{VFS: &api.VFSConfig{Interception: &api.VFSInterceptionConfig{
+		Rules: []api.VFSHookRule{
+			{Name: "ask", Action: api.VFSHookActionCallback, Ops: []string{"create"}},
+			{Name: "redact", Action: api.VFSHookActionMutateCallback, Ops: []string{"write"}, Path: "/workspace/*"},
+		},
+		Decider: func(ctx context.Context, req api.VFSHookDecisionRequest) string { return "allow" },
+		Mutator: func(ctx context.Context, req api.VFSHookMutateRequest) ([]byte, error) {
+			got = req
+			return []byte("[redacted]"), nil
+		},
+	}}})
+	require.NotNil(t, hooks)
+	defer hooks.Close()
+
+	req := vfs.HookRequest{Op: vfs.HookOpWrite, Path: "/workspace/env", Offset: 4, Data: []byte("token=abc"), UID: 1000, GID: 1000}
+	require.NoError(t, hooks.Before(&req))
+	assert.Equal(t, "[redacted]", string(req.Data))
+	assert.Equal(t, api.VFSHookMutateRequest{Rule: 0, Path: "/workspace/env", Offset: 4, Data: []byte("token=abc"), UID: 1000, GID: 1000}, got)
+
+	failing := buildGuestVFSHookEngine(&api.Config{VFS: &api.VFSConfig{Interception: &api.VFSInterceptionConfig{
+		Rules: []api.VFSHookRule{{Action: api.VFSHookActionMutateCallback, Ops: []string{"write"}}},
+	}}})
+	defer failing.Close()
+	req = vfs.HookRequest{Op: vfs.HookOpWrite, Path: "/workspace/env", Data: []byte("x")}
+	assert.ErrorIs(t, failing.Before(&req), syscall.EPERM, "no mutator")
+}
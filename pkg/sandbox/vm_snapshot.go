@@ -0,0 +1,205 @@
+package sandbox
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	sandboxnet "github.com/jingkaihe/matchlock/pkg/net"
+)
+
+// Files in a VM snapshot directory besides the backend's own.
+const (
+	vmSnapshotMetadataFile = "snapshot.json"
+	vmSnapshotCACertFile   = "ca.crt"
+	vmSnapshotCAKeyFile    = "ca.key"
+	vmSnapshotWorkspaceDir = "workspace"
+	vmSnapshotOverlayDir   = "overlay"
+)
+
+var vmSnapshotIDPattern = regexp.MustCompile(`^snap-[0-9a-f]{12}$`)
+
+// VMSnapshot describes a full-VM snapshot taken with Sandbox.Snapshot.
+type VMSnapshot struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Backend   string    `json:"backend"`
+	// Config is the source sandbox's resolved config, including secret
+	// values and the placeholders the guest already holds.
+	Config     *api.Config `json:"config"`
+	KernelPath string      `json:"kernel_path"`
+	// SubnetOctet is the source VM's subnet; the restored guest keeps its IP.
+	SubnetOctet int `json:"subnet_octet"`
+	// SharedRootfs is the read-only base under the rootfs overlay, if any.
+	SharedRootfs string `json:"shared_rootfs,omitempty"`
+	// Workspace is set when the in-memory workspace was saved with the VM.
+	Workspace bool `json:"workspace,omitempty"`
+}
+
+// VMSnapshotDir returns the directory holding snapshot id. Snapshots live
+// outside any VM's state directory so they outlive the sandbox they came
+// from.
+func VMSnapshotDir(id string) string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".matchlock", "snapshots", id)
+}
+
+func newVMSnapshotID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return "snap-" + hex.EncodeToString(b)
+}
+
+// LoadVMSnapshot reads the metadata of snapshot id.
+func LoadVMSnapshot(id string) (*VMSnapshot, error) {
+	if !vmSnapshotIDPattern.MatchString(id) {
+		return nil, errx.With(ErrVMSnapshotNotFound, ": invalid snapshot ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(VMSnapshotDir(id), vmSnapshotMetadataFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errx.With(ErrVMSnapshotNotFound, ": %s", id)
+		}
+		return nil, errx.Wrap(ErrVMSnapshot, err)
+	}
+	var snap VMSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, errx.With(ErrVMSnapshot, " %s: %w", id, err)
+	}
+	if snap.Config == nil {
+		return nil, errx.With(ErrVMSnapshot, " %s: missing config", id)
+	}
+	return &snap, nil
+}
+
+// writeVMSnapshotMetadata stores snap in its directory. The file carries
+// secret values, so it is only readable by the owner, like the VM state
+// database.
+func writeVMSnapshotMetadata(dir string, snap *VMSnapshot) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return errx.Wrap(ErrVMSnapshot, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, vmSnapshotMetadataFile), data, 0600); err != nil {
+		return errx.Wrap(ErrVMSnapshot, err)
+	}
+	return nil
+}
+
+// snapshotConfig returns the config to save with a snapshot in dir. Overlay
+// mounts run from copies in the sandbox's state dir (see
+// prepareOverlaySnapshots), which Close deletes, so their current contents
+// are copied into the snapshot and the saved config mounts those copies as
+// overlays again. Every restore then starts from the snapshot's files.
+// config itself is not modified.
+func snapshotConfig(config *api.Config, overlaySnapshots []string, dir string) (*api.Config, error) {
+	if config.VFS == nil || len(overlaySnapshots) == 0 {
+		return config, nil
+	}
+	saved := *config
+	vfsConfig := *config.VFS
+	vfsConfig.Mounts = make(map[string]api.MountConfig, len(config.VFS.Mounts))
+	for path, mount := range config.VFS.Mounts {
+		if mount.Type == api.MountTypeHostFS && slices.Contains(overlaySnapshots, mount.HostPath) {
+			dst := filepath.Join(dir, vmSnapshotOverlayDir, filepath.Base(mount.HostPath))
+			if err := copySnapshotPath(mount.HostPath, dst); err != nil {
+				return nil, errx.Wrap(ErrVMSnapshot, err)
+			}
+			mount.Type = api.MountTypeOverlay
+			mount.HostPath = dst
+		}
+		vfsConfig.Mounts[path] = mount
+	}
+	saved.VFS = &vfsConfig
+	return &saved, nil
+}
+
+// restoreConfig returns the config a sandbox restored from snap runs with:
+// the source's config under a new ID. A saved workspace is mounted as an
+// overlay, so every restore starts from the snapshot's files and the
+// snapshot itself is never modified.
+func (snap *VMSnapshot) restoreConfig() *api.Config {
+	data, _ := json.Marshal(snap.Config)
+	var config api.Config
+	_ = json.Unmarshal(data, &config)
+	config.ID = ""
+
+	if snap.Workspace {
+		if config.VFS == nil {
+			config.VFS = &api.VFSConfig{}
+		}
+		mounts := make(map[string]api.MountConfig, len(config.VFS.Mounts)+1)
+		for path, mount := range config.VFS.Mounts {
+			mounts[path] = mount
+		}
+		mounts[config.GetWorkspace()] = api.MountConfig{
+			Type:     api.MountTypeOverlay,
+			HostPath: filepath.Join(VMSnapshotDir(snap.ID), vmSnapshotWorkspaceDir),
+		}
+		config.VFS.Mounts = mounts
+	}
+	return &config
+}
+
+// kernel returns the kernel the snapshot's VM booted. A restored guest
+// resumes inside that kernel, so no other kernel will do.
+func (snap *VMSnapshot) kernel() (string, error) {
+	if _, err := os.Stat(snap.KernelPath); err != nil {
+		return "", errx.With(ErrVMSnapshotMismatch, ": kernel %s: %w", snap.KernelPath, err)
+	}
+	return snap.KernelPath, nil
+}
+
+// bootRootfs returns the rootfs drive path for a VM restored from snap.
+// Without shared_rootfs that is the VM's own disk, which the backend fills
+// from the snapshot. With it, the read-only base is prepared from
+// srcPath as usual and must be the base the snapshot's overlay was written
+// against.
+func (snap *VMSnapshot) bootRootfs(config *api.Config, srcPath, vmRootfsPath string, copyFn func(src, dst string) error) (string, error) {
+	if !config.SharedRootfs {
+		return vmRootfsPath, nil
+	}
+	base, err := prepareSharedRootfs(srcPath, copyFn, !config.SkipRootfsCheck)
+	if err != nil {
+		return "", errx.Wrap(ErrPrepareRootfs, err)
+	}
+	if base != snap.SharedRootfs {
+		return "", errx.With(ErrVMSnapshotMismatch, ": shared rootfs %s, snapshot needs %s", base, snap.SharedRootfs)
+	}
+	return base, nil
+}
+
+func writeVMSnapshotCA(dir string, pool *sandboxnet.CAPool) error {
+	if err := os.WriteFile(filepath.Join(dir, vmSnapshotCACertFile), pool.CACertPEM(), 0600); err != nil {
+		return errx.Wrap(ErrVMSnapshot, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, vmSnapshotCAKeyFile), pool.CAKeyPEM(), 0600); err != nil {
+		return errx.Wrap(ErrVMSnapshot, err)
+	}
+	return nil
+}
+
+// caPool loads the interception CA saved with the snapshot.
+func (snap *VMSnapshot) caPool() (*sandboxnet.CAPool, error) {
+	dir := VMSnapshotDir(snap.ID)
+	certPEM, err := os.ReadFile(filepath.Join(dir, vmSnapshotCACertFile))
+	if err != nil {
+		return nil, errx.Wrap(ErrVMSnapshot, err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, vmSnapshotCAKeyFile))
+	if err != nil {
+		return nil, errx.Wrap(ErrVMSnapshot, err)
+	}
+	pool, err := sandboxnet.LoadCAPool(certPEM, keyPEM)
+	if err != nil {
+		return nil, errx.Wrap(ErrVMSnapshot, err)
+	}
+	return pool, nil
+}
@@ -0,0 +1,117 @@
+package sandbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestLoadVMSnapshotRoundTrip(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	snap := &VMSnapshot{
+		ID:          newVMSnapshotID(),
+		CreatedAt:   time.Now().UTC().Truncate(time.Second),
+		Backend:     "firecracker",
+		Config:      &api.Config{ID: "vm-source", Image: "alpine:latest"},
+		KernelPath:  "/kernels/vmlinux",
+		SubnetOctet: 7,
+	}
+	dir := VMSnapshotDir(snap.ID)
+	require.NoError(t, os.MkdirAll(dir, 0700))
+	require.NoError(t, writeVMSnapshotMetadata(dir, snap))
+
+	loaded, err := LoadVMSnapshot(snap.ID)
+	require.NoError(t, err)
+	assert.Equal(t, snap.ID, loaded.ID)
+	assert.Equal(t, "alpine:latest", loaded.Config.Image)
+	assert.Equal(t, 7, loaded.SubnetOctet)
+}
+
+func TestLoadVMSnapshotRejectsBadIDs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	for _, id := range []string{"", "../etc", "snap-0123456789ab/..", "snap-XYZ"} {
+		_, err := LoadVMSnapshot(id)
+		assert.ErrorIs(t, err, ErrVMSnapshotNotFound, id)
+	}
+	_, err := LoadVMSnapshot("snap-0123456789ab")
+	assert.ErrorIs(t, err, ErrVMSnapshotNotFound)
+}
+
+func TestVMSnapshotRestoreConfigMountsSavedWorkspace(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	snap := &VMSnapshot{
+		ID: "snap-0123456789ab",
+		Config: &api.Config{
+			ID:    "vm-source",
+			Image: "alpine:latest",
+			VFS: &api.VFSConfig{
+				Workspace: "/workspace",
+				Mounts: map[string]api.MountConfig{
+					"/workspace": {Type: api.MountTypeMemory},
+					"/data":      {Type: api.MountTypeMemory},
+				},
+			},
+		},
+		Workspace: true,
+	}
+
+	config := snap.restoreConfig()
+	assert.Empty(t, config.ID)
+	assert.Equal(t, api.MountConfig{
+		Type:     api.MountTypeOverlay,
+		HostPath: filepath.Join(VMSnapshotDir(snap.ID), vmSnapshotWorkspaceDir),
+	}, config.VFS.Mounts["/workspace"])
+	assert.Equal(t, api.MountTypeMemory, config.VFS.Mounts["/data"].Type)
+	assert.Equal(t, api.MountTypeMemory, snap.Config.VFS.Mounts["/workspace"].Type, "snapshot config is not modified")
+}
+
+func TestSnapshotConfigCopiesOverlayMounts(t *testing.T) {
+	stateDir := t.TempDir()
+	source := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "seed.txt"), []byte("seed"), 0644))
+	config := &api.Config{
+		VFS: &api.VFSConfig{
+			Workspace: "/workspace",
+			Mounts: map[string]api.MountConfig{
+				"/workspace": {Type: api.MountTypeOverlay, HostPath: source},
+				"/data":      {Type: api.MountTypeMemory},
+			},
+		},
+	}
+	overlays, err := prepareOverlaySnapshots(config, stateDir)
+	require.NoError(t, err)
+	require.Len(t, overlays, 1)
+	// A guest write lands in the sandbox's copy.
+	require.NoError(t, os.WriteFile(filepath.Join(overlays[0], "guest.txt"), []byte("guest"), 0644))
+
+	snapDir := t.TempDir()
+	saved, err := snapshotConfig(config, overlays, snapDir)
+	require.NoError(t, err)
+	mount := saved.VFS.Mounts["/workspace"]
+	assert.Equal(t, api.MountTypeOverlay, mount.Type)
+	assert.Equal(t, snapDir, filepath.Dir(filepath.Dir(mount.HostPath)))
+	assert.Equal(t, api.MountTypeMemory, saved.VFS.Mounts["/data"].Type)
+	assert.Equal(t, api.MountTypeHostFS, config.VFS.Mounts["/workspace"].Type, "sandbox config is not modified")
+
+	// Close deletes the sandbox's copy; the snapshot keeps its own.
+	cleanupSnapshotPaths(overlays)
+	data, err := os.ReadFile(filepath.Join(mount.HostPath, "guest.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "guest", string(data))
+
+	restored, err := prepareOverlaySnapshots(saved, t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, restored, 1)
+	data, err = os.ReadFile(filepath.Join(restored[0], "seed.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "seed", string(data))
+}
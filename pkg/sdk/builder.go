@@ -1,6 +1,10 @@
 package sdk
 
-import "github.com/jingkaihe/matchlock/pkg/api"
+import (
+	"time"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
 
 // SandboxBuilder provides a fluent API for configuring and creating sandboxes.
 //
@@ -25,12 +29,125 @@ func New(image string) *SandboxBuilder {
 	}
 }
 
-// WithPrivileged enables privileged mode, skipping in-guest security restrictions.
+// WithPrivileged enables privileged mode, skipping in-guest security
+// restrictions. Prefer WithCapAdd, WithAllowSyscalls or
+// WithDisableNoNewPrivs when a single restriction is in the way.
 func (b *SandboxBuilder) WithPrivileged() *SandboxBuilder {
 	b.opts.Privileged = true
 	return b
 }
 
+// WithCapAdd keeps guest capabilities that are dropped by default
+// (e.g. "SYS_PTRACE" for debuggers). See api.DefaultDroppedCapabilities.
+func (b *SandboxBuilder) WithCapAdd(caps ...string) *SandboxBuilder {
+	b.opts.CapAdd = append(b.opts.CapAdd, caps...)
+	return b
+}
+
+// WithCapDrop removes additional capabilities from guest commands.
+func (b *SandboxBuilder) WithCapDrop(caps ...string) *SandboxBuilder {
+	b.opts.CapDrop = append(b.opts.CapDrop, caps...)
+	return b
+}
+
+// WithAllowSyscalls removes syscalls from the guest seccomp filter (e.g.
+// "ptrace"). See api.AllowableSyscalls.
+func (b *SandboxBuilder) WithAllowSyscalls(syscalls ...string) *SandboxBuilder {
+	b.opts.AllowSyscalls = append(b.opts.AllowSyscalls, syscalls...)
+	return b
+}
+
+// WithUlimit sets a resource limit on guest commands (core, nofile, nproc
+// or stack), like docker --ulimit. Use api.UlimitUnlimited for no limit.
+func (b *SandboxBuilder) WithUlimit(name string, soft, hard uint64) *SandboxBuilder {
+	if b.opts.Ulimits == nil {
+		b.opts.Ulimits = make(map[string]api.Ulimit)
+	}
+	b.opts.Ulimits[name] = api.Ulimit{Soft: soft, Hard: hard}
+	return b
+}
+
+// WithDisableNoNewPrivs leaves no_new_privs unset so setuid binaries work.
+func (b *SandboxBuilder) WithDisableNoNewPrivs() *SandboxBuilder {
+	b.opts.DisableNoNewPrivs = true
+	return b
+}
+
+// WithSeccompAudit enables seccomp audit mode and delivers flagged guest
+// syscalls to fn. See CreateOptions.SeccompAudit for the performance cost.
+func (b *SandboxBuilder) WithSeccompAudit(fn func(api.SyscallEvent)) *SandboxBuilder {
+	b.opts.SeccompAudit = true
+	b.opts.OnSyscallEvent = fn
+	return b
+}
+
+// WithKernel boots the sandbox from the kernel image at path. See
+// CreateOptions.KernelPath.
+func (b *SandboxBuilder) WithKernel(path string) *SandboxBuilder {
+	b.opts.KernelPath = path
+	return b
+}
+
+// WithKernelModule adds a kernel module (.ko) for the guest to load at
+// boot. See CreateOptions.KernelModules.
+func (b *SandboxBuilder) WithKernelModule(path string) *SandboxBuilder {
+	b.opts.KernelModules = append(b.opts.KernelModules, path)
+	return b
+}
+
+// WithSocketMount exposes the host unix socket hostPath inside the guest at
+// guestPath. See CreateOptions.SocketMounts.
+func (b *SandboxBuilder) WithSocketMount(guestPath, hostPath string) *SandboxBuilder {
+	if b.opts.SocketMounts == nil {
+		b.opts.SocketMounts = make(map[string]string)
+	}
+	b.opts.SocketMounts[guestPath] = hostPath
+	return b
+}
+
+// WithInitCommand adds a command to run as root after boot, before the
+// sandbox is handed back. See CreateOptions.InitCommands.
+func (b *SandboxBuilder) WithInitCommand(command string) *SandboxBuilder {
+	b.opts.InitCommands = append(b.opts.InitCommands, command)
+	return b
+}
+
+// WithSkipRootfsCheck skips the pre-boot e2fsck pass over the rootfs. See
+// CreateOptions.SkipRootfsCheck.
+func (b *SandboxBuilder) WithSkipRootfsCheck() *SandboxBuilder {
+	b.opts.SkipRootfsCheck = true
+	return b
+}
+
+// WithKeepStateOnClose keeps the sandbox's disks after Close for
+// debugging. See CreateOptions.KeepStateOnClose.
+func (b *SandboxBuilder) WithKeepStateOnClose() *SandboxBuilder {
+	b.opts.KeepStateOnClose = true
+	return b
+}
+
+// WithStopGracePeriod sets how long Close waits for the VM to shut down
+// before killing it. See CreateOptions.StopGracePeriod.
+func (b *SandboxBuilder) WithStopGracePeriod(d time.Duration) *SandboxBuilder {
+	b.opts.StopGracePeriod = d
+	return b
+}
+
+// WithSharedRootfs boots from a shared read-only rootfs with a per-VM
+// overlay instead of a private copy. See CreateOptions.SharedRootfs.
+func (b *SandboxBuilder) WithSharedRootfs() *SandboxBuilder {
+	b.opts.SharedRootfs = true
+	return b
+}
+
+// WithRequireSignature refuses to boot the image unless it is signed by one
+// of trustedKeys (PEM text or key file paths). See CreateOptions.RequireSignature.
+func (b *SandboxBuilder) WithRequireSignature(trustedKeys ...string) *SandboxBuilder {
+	b.opts.RequireSignature = true
+	b.opts.TrustedKeys = append(b.opts.TrustedKeys, trustedKeys...)
+	return b
+}
+
 // WithCPUs sets the number of vCPUs.
 func (b *SandboxBuilder) WithCPUs(cpus int) *SandboxBuilder {
 	b.opts.CPUs = cpus
@@ -43,6 +160,25 @@ func (b *SandboxBuilder) WithMemory(mb int) *SandboxBuilder {
 	return b
 }
 
+// WithSwap adds zram swap of mb megabytes inside the guest.
+func (b *SandboxBuilder) WithSwap(mb int) *SandboxBuilder {
+	b.opts.SwapMB = mb
+	return b
+}
+
+// WithCPUAffinity pins the VM to the given host CPUs (Linux hosts only).
+func (b *SandboxBuilder) WithCPUAffinity(cpus ...int) *SandboxBuilder {
+	b.opts.CPUAffinity = cpus
+	return b
+}
+
+// WithCgroupParent runs the VM in its own host cgroup under parent. See
+// CreateOptions.CgroupParent.
+func (b *SandboxBuilder) WithCgroupParent(parent string) *SandboxBuilder {
+	b.opts.CgroupParent = parent
+	return b
+}
+
 // WithDiskSize sets disk size in megabytes.
 func (b *SandboxBuilder) WithDiskSize(mb int) *SandboxBuilder {
 	b.opts.DiskSizeMB = mb
@@ -61,6 +197,13 @@ func (b *SandboxBuilder) WithWorkspace(path string) *SandboxBuilder {
 	return b
 }
 
+// WithVFSCompression compresses guest file reads of at least min bytes on
+// their way over vsock.
+func (b *SandboxBuilder) WithVFSCompression(min int) *SandboxBuilder {
+	b.opts.VFSCompressMinBytes = min
+	return b
+}
+
 // WithVFSInterception sets host-side VFS interception rules.
 func (b *SandboxBuilder) WithVFSInterception(cfg *VFSInterceptionConfig) *SandboxBuilder {
 	b.opts.VFSInterception = cfg
@@ -76,6 +219,22 @@ func (b *SandboxBuilder) WithEnv(name, value string) *SandboxBuilder {
 	return b
 }
 
+// WithEventBufferSize sets how many sandbox events are buffered before
+// further events are dropped.
+func (b *SandboxBuilder) WithEventBufferSize(size int) *SandboxBuilder {
+	b.opts.EventBufferSize = size
+	return b
+}
+
+// WithLabel sets a sandbox label.
+func (b *SandboxBuilder) WithLabel(key, value string) *SandboxBuilder {
+	if b.opts.Labels == nil {
+		b.opts.Labels = make(map[string]string)
+	}
+	b.opts.Labels[key] = value
+	return b
+}
+
 // WithEnvMap merges non-secret environment variables into the sandbox config.
 func (b *SandboxBuilder) WithEnvMap(env map[string]string) *SandboxBuilder {
 	if b.opts.Env == nil {
@@ -122,6 +281,13 @@ func (b *SandboxBuilder) AllowPrivateHost(hosts ...string) *SandboxBuilder {
 	return b
 }
 
+// AllowUDPHost lets guest UDP reach host or host:port destinations, e.g.
+// a DNS resolver ("9.9.9.9:53") or a QUIC endpoint ("quic.example.com:443").
+func (b *SandboxBuilder) AllowUDPHost(hosts ...string) *SandboxBuilder {
+	b.opts.AllowedUDPHosts = append(b.opts.AllowedUDPHosts, hosts...)
+	return b
+}
+
 // UnsetBlockPrivateIPs resets private IP blocking to API defaults.
 func (b *SandboxBuilder) UnsetBlockPrivateIPs() *SandboxBuilder {
 	b.opts.BlockPrivateIPs = false
@@ -141,24 +307,156 @@ func (b *SandboxBuilder) AddSecret(name, value string, hosts ...string) *Sandbox
 	return b
 }
 
+// AddSecretFile registers a MITM secret delivered as a read-only file at
+// guestPath instead of an environment variable. The file holds the
+// placeholder; the real value is injected into HTTP requests to hosts.
+func (b *SandboxBuilder) AddSecretFile(name, value, guestPath string, hosts ...string) *SandboxBuilder {
+	b.opts.Secrets = append(b.opts.Secrets, Secret{
+		Name:  name,
+		Value: value,
+		Hosts: hosts,
+		File:  guestPath,
+	})
+	return b
+}
+
+// AddRawSecretFile writes the real secret value to a read-only file at
+// guestPath. Unlike AddSecret and AddSecretFile, the value is fully visible
+// to the guest and never passes through the proxy; use it only for
+// credentials the guest must hold itself, such as SSH keys.
+func (b *SandboxBuilder) AddRawSecretFile(name, value, guestPath string) *SandboxBuilder {
+	b.opts.Secrets = append(b.opts.Secrets, Secret{
+		Name:    name,
+		Value:   value,
+		File:    guestPath,
+		FileRaw: true,
+	})
+	return b
+}
+
 // WithDNSServers overrides the default DNS servers (8.8.8.8, 8.8.4.4).
 func (b *SandboxBuilder) WithDNSServers(servers ...string) *SandboxBuilder {
 	b.opts.DNSServers = append(b.opts.DNSServers, servers...)
 	return b
 }
 
+// WithUpstreamDNS resolves allowed hostnames on the host through servers
+// instead of the host's resolver. See CreateOptions.UpstreamDNS.
+func (b *SandboxBuilder) WithUpstreamDNS(servers ...string) *SandboxBuilder {
+	b.opts.UpstreamDNS = append(b.opts.UpstreamDNS, servers...)
+	return b
+}
+
+// WithProgress reports image pull progress to fn during Create. See
+// CreateOptions.ProgressFunc.
+func (b *SandboxBuilder) WithProgress(fn func(ImageProgress)) *SandboxBuilder {
+	b.opts.ProgressFunc = fn
+	return b
+}
+
+// WithUpstreamProxy tunnels upstream connections through proxyURL. See
+// CreateOptions.UpstreamProxy.
+func (b *SandboxBuilder) WithUpstreamProxy(proxyURL string) *SandboxBuilder {
+	b.opts.UpstreamProxy = proxyURL
+	return b
+}
+
+// WithSearchDomains adds "search" domains to the guest's resolv.conf.
+func (b *SandboxBuilder) WithSearchDomains(domains ...string) *SandboxBuilder {
+	b.opts.SearchDomains = append(b.opts.SearchDomains, domains...)
+	return b
+}
+
+// WithResolvOptions adds resolv.conf "options" entries such as "ndots:2"
+// or "rotate" to the guest.
+func (b *SandboxBuilder) WithResolvOptions(options ...string) *SandboxBuilder {
+	b.opts.ResolvOptions = append(b.opts.ResolvOptions, options...)
+	return b
+}
+
+// WithMirror copies requests to hosts matching hostGlob to mirrorTo (a
+// base URL) in addition to sending them upstream. See CreateOptions.MirrorRoutes.
+func (b *SandboxBuilder) WithMirror(hostGlob, mirrorTo string) *SandboxBuilder {
+	b.opts.MirrorRoutes = append(b.opts.MirrorRoutes, api.MirrorRule{HostGlob: hostGlob, MirrorTo: mirrorTo})
+	return b
+}
+
 // WithHostname sets the sandbox's hostname
 func (b *SandboxBuilder) WithHostname(hostname string) *SandboxBuilder {
 	b.opts.Hostname = hostname
 	return b
 }
 
+// WithStaticIP pins the guest's IPv4 address (192.168.100.2 -
+// 192.168.254.254, or an address in 10.99.0.0/16 with WithSharedBridge) instead of using its allocated subnet's .2 address.
+func (b *SandboxBuilder) WithStaticIP(ip string) *SandboxBuilder {
+	b.opts.StaticIP = ip
+	return b
+}
+
+// WithStaticMAC pins the guest's MAC address instead of deriving one.
+func (b *SandboxBuilder) WithStaticMAC(mac string) *SandboxBuilder {
+	b.opts.StaticMAC = mac
+	return b
+}
+
+// WithSharedBridge attaches the VM to the host's shared bridge instead of
+// giving it its own subnet (Linux only).
+func (b *SandboxBuilder) WithSharedBridge() *SandboxBuilder {
+	b.opts.SharedBridge = true
+	return b
+}
+
 // WithNetworkMTU overrides the guest interface/network stack MTU.
 func (b *SandboxBuilder) WithNetworkMTU(mtu int) *SandboxBuilder {
 	b.opts.NetworkMTU = mtu
 	return b
 }
 
+// WithAutoMTU sizes the guest MTU from the host's outbound interface.
+// An explicit WithNetworkMTU takes precedence.
+func (b *SandboxBuilder) WithAutoMTU() *SandboxBuilder {
+	b.opts.AutoMTU = true
+	return b
+}
+
+// WithClampMSS clamps the TCP MSS of forwarded SYNs to the route MTU (Linux only).
+func (b *SandboxBuilder) WithClampMSS() *SandboxBuilder {
+	b.opts.ClampMSS = true
+	return b
+}
+
+// WithMetadataService serves sandbox metadata and by-name secret lookups to
+// the guest at http://169.254.169.254.
+func (b *SandboxBuilder) WithMetadataService() *SandboxBuilder {
+	b.opts.MetadataService = true
+	return b
+}
+
+// WithWaitForNetwork holds readiness until the guest can reach probe over
+// TCP (host:port); an empty probe uses the first DNS server on port 53.
+func (b *SandboxBuilder) WithWaitForNetwork(probe string) *SandboxBuilder {
+	b.opts.WaitForNetwork = true
+	b.opts.NetworkProbe = probe
+	return b
+}
+
+// WithConnectionLimits caps concurrent guest TCP connections in total and
+// per destination IP (0 leaves that limit off).
+func (b *SandboxBuilder) WithConnectionLimits(total, perHost int) *SandboxBuilder {
+	b.opts.MaxConcurrentConnections = total
+	b.opts.MaxConnectionsPerHost = perHost
+	return b
+}
+
+// WithHostApproval holds guest connections to hosts outside the allowlist
+// and asks fn whether to allow each one (see CreateOptions.HostApproval).
+func (b *SandboxBuilder) WithHostApproval(fn func(host string) bool) *SandboxBuilder {
+	b.opts.HostApproval = true
+	b.opts.OnHostDenied = fn
+	return b
+}
+
 // WithPortForward adds a host-to-guest port mapping.
 func (b *SandboxBuilder) WithPortForward(localPort, remotePort int) *SandboxBuilder {
 	b.opts.PortForwards = append(b.opts.PortForwards, api.PortForward{
@@ -168,6 +466,14 @@ func (b *SandboxBuilder) WithPortForward(localPort, remotePort int) *SandboxBuil
 	return b
 }
 
+// WithPort publishes a sandbox port using `docker run -p` syntax, e.g.
+// "8080:80", "127.0.0.1:8080:80" or "80" for an ephemeral host port.
+// Invalid specs are reported by Create.
+func (b *SandboxBuilder) WithPort(spec string) *SandboxBuilder {
+	b.opts.Ports = append(b.opts.Ports, spec)
+	return b
+}
+
 // WithPortForwardAddresses sets host bind addresses for configured mappings.
 func (b *SandboxBuilder) WithPortForwardAddresses(addresses ...string) *SandboxBuilder {
 	b.opts.PortForwardAddresses = append(b.opts.PortForwardAddresses, addresses...)
@@ -203,6 +509,14 @@ func (b *SandboxBuilder) MountOverlay(guestPath, hostPath string) *SandboxBuilde
 	return b.Mount(guestPath, MountConfig{Type: api.MountTypeOverlay, HostPath: hostPath})
 }
 
+// MountLayers mounts upper over lower at the given guest path. Reads fall
+// through to lower and writes are copied up, so e.g. a read-only host_fs
+// lower with a memory upper gives a writable view without copying the
+// host directory up front.
+func (b *SandboxBuilder) MountLayers(guestPath string, upper, lower MountConfig) *SandboxBuilder {
+	return b.Mount(guestPath, MountConfig{Type: api.MountTypeOverlay, Upper: &upper, Lower: &lower})
+}
+
 // WithUser sets the user to run commands as (uid, uid:gid, or username).
 func (b *SandboxBuilder) WithUser(user string) *SandboxBuilder {
 	if b.opts.ImageConfig == nil {
@@ -221,6 +535,22 @@ func (b *SandboxBuilder) WithEntrypoint(entrypoint ...string) *SandboxBuilder {
 	return b
 }
 
+// WithPublishAll forwards all image EXPOSEd ports to ephemeral host ports.
+func (b *SandboxBuilder) WithPublishAll() *SandboxBuilder {
+	b.opts.PublishAll = true
+	return b
+}
+
+// WithCmd sets the image CMD override. Arguments passed to Exec are not
+// affected; this only changes the default command composed with ENTRYPOINT.
+func (b *SandboxBuilder) WithCmd(cmd ...string) *SandboxBuilder {
+	if b.opts.ImageConfig == nil {
+		b.opts.ImageConfig = &ImageConfig{}
+	}
+	b.opts.ImageConfig.Cmd = cmd
+	return b
+}
+
 // WithImageConfig merges the given image configuration into any existing config.
 // Fields set in cfg override existing values; zero-value fields are left unchanged.
 func (b *SandboxBuilder) WithImageConfig(cfg *ImageConfig) *SandboxBuilder {
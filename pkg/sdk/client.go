@@ -26,6 +26,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
@@ -45,7 +46,7 @@ type Client struct {
 	cmd       *exec.Cmd
 	stdin     io.WriteCloser
 	stdout    *bufio.Reader
-	stderr    io.ReadCloser
+	stderr    *stderrTail // last stderr output of the RPC process
 	requestID atomic.Uint64
 	vmID      string
 	mu        sync.Mutex // legacy — kept for Close()
@@ -62,14 +63,38 @@ type Client struct {
 	vfsMutateHooks []compiledVFSMutateHook
 	vfsActionHooks []compiledVFSActionHook
 	vfsHookActive  atomic.Bool
+
+	portBindingsMu sync.Mutex
+	portBindings   []api.PortForwardBinding
+
+	fileEventMu   sync.RWMutex
+	fileEventSubs map[uint64]func(api.FileEvent)
+	fileEventSeq  uint64
+
+	syscallEventMu sync.RWMutex
+	onSyscallEvent func(api.SyscallEvent)
+
+	hostDeniedMu sync.RWMutex
+	onHostDenied func(host string) bool
+
+	clientEventsOnce sync.Once          // see subscribeClientEvents
+	stopClientEvents context.CancelFunc // set by clientEventsOnce
+
+	ttySeq atomic.Uint64 // source of exec_tty session IDs
 }
 
 // Config holds client configuration
 type Config struct {
 	// BinaryPath is the path to the matchlock binary
 	BinaryPath string
-	// UseSudo runs matchlock with sudo (required for TAP devices)
+	// UseSudo runs matchlock with sudo. On Linux this is only needed when
+	// the binary lacks CAP_NET_ADMIN; after `matchlock setup linux` the RPC
+	// process runs rootless and UseSudo should be left false.
 	UseSudo bool
+	// Stderr receives the RPC process's stderr. Nil discards it. Either
+	// way the last few KB are kept and attached to errors from Create and
+	// to connection-closed errors.
+	Stderr io.Writer
 }
 
 // DefaultConfig returns the default client configuration
@@ -112,13 +137,14 @@ func NewClient(cfg Config) (*Client, error) {
 	}
 
 	// Drain stderr in background to prevent blocking
-	go io.Copy(io.Discard, stderr)
+	tail := newStderrTail(cfg.Stderr)
+	go tail.drain(stderr)
 
 	return &Client{
 		cmd:     cmd,
 		stdin:   stdin,
 		stdout:  bufio.NewReader(stdout),
-		stderr:  stderr,
+		stderr:  tail,
 		pending: make(map[uint64]*pendingRequest),
 	}, nil
 }
@@ -145,6 +171,12 @@ func (c *Client) Close(timeout time.Duration) error {
 	c.mu.Unlock()
 
 	c.setVFSHooks(nil, nil, nil)
+	c.setSyscallEventHandler(nil)
+	// Also keeps a later SubscribeFiltered from opening the subscription.
+	c.clientEventsOnce.Do(func() {})
+	if c.stopClientEvents != nil {
+		c.stopClientEvents()
+	}
 
 	effectiveTimeout := timeout
 	if effectiveTimeout <= 0 {
@@ -194,12 +226,103 @@ func (c *Client) Remove() error {
 type CreateOptions struct {
 	// Image is the container image reference (required, e.g., alpine:latest)
 	Image string
-	// Privileged skips in-guest security restrictions (seccomp, cap drop, no_new_privs)
+	// Privileged skips in-guest security restrictions (seccomp, cap drop,
+	// no_new_privs) and is logged as a "security" event. Prefer the scoped
+	// CapAdd, AllowSyscalls or DisableNoNewPrivs when only one is in the way.
 	Privileged bool
+	// CapAdd keeps guest capabilities that are dropped by default
+	// (api.DefaultDroppedCapabilities, e.g. "SYS_PTRACE"). Each of these
+	// weakens isolation; prefer the narrowest set the workload needs.
+	CapAdd []string
+	// CapDrop removes additional capabilities from guest commands (e.g. "NET_RAW").
+	CapDrop []string
+	// AllowSyscalls removes individual syscalls from the guest seccomp
+	// filter (api.AllowableSyscalls, e.g. "ptrace"), leaving the rest of
+	// it in place.
+	AllowSyscalls []string
+	// DisableNoNewPrivs leaves no_new_privs unset so setuid binaries (sudo,
+	// ping) work in guest commands. Seccomp and the cap drop still apply.
+	DisableNoNewPrivs bool
+	// Ulimits sets resource limits on guest commands, keyed by name
+	// (api.UlimitNames: core, nofile, nproc, stack), like docker --ulimit.
+	Ulimits map[string]api.Ulimit
+	// SeccompAudit reports security-relevant guest syscalls (mount, bpf,
+	// ptrace, ...) to OnSyscallEvent. Each flagged syscall round-trips
+	// through the guest agent, so expect a noticeable slowdown for
+	// syscall-heavy workloads; use it to profile before tightening policy.
+	SeccompAudit bool
+	// OnSyscallEvent receives audit records when SeccompAudit is enabled.
+	OnSyscallEvent func(api.SyscallEvent)
+	// SharedRootfs attaches the image's rootfs read-only and sends the
+	// sandbox's writes to a per-VM overlay disk instead of copying the
+	// whole rootfs, which makes creating many sandboxes from one image
+	// much cheaper. Removing the sandbox deletes only its overlay.
+	SharedRootfs bool
+	// SkipRootfsCheck skips the read-only e2fsck pass over the sandbox's
+	// rootfs before boot. The check turns a corrupt disk into a create
+	// error instead of a guest kernel panic, but takes a moment on large
+	// images.
+	SkipRootfsCheck bool
+	// KeepStateOnClose keeps the sandbox's rootfs and overlay snapshots in
+	// its state directory after Close, so a failed run can be inspected
+	// (see `matchlock export-debug`). Remove still deletes everything.
+	KeepStateOnClose bool
+	// StopGracePeriod is how long the sandbox waits for the VM to shut
+	// down on Close before killing it, when Close has no timeout of its own
+	// (default: 5s). It is rounded down to whole seconds. Linux hosts only.
+	StopGracePeriod time.Duration
+	// KernelPath boots the sandbox from this kernel image instead of the
+	// default cached kernel, e.g. to test against another kernel version.
+	// The path is on the host running matchlock and must be an ELF vmlinux
+	// (x86_64) or an arm64 Image; create fails otherwise.
+	KernelPath string
+	// KernelModules are host paths of loadable kernel modules (.ko) that
+	// the guest loads, in this order, before the sandbox starts. Each must
+	// be built for the sandbox's kernel; create fails otherwise. Modules
+	// that the guest kernel still refuses are reported as [init] warnings
+	// in the sandbox logs. Linux hosts only.
+	KernelModules []string
+	// InitCommands run as root, in order, after the VM boots and before
+	// Create returns, for one-off setup such as mounting or writing config
+	// that the workload's user may not do itself. Their output is written
+	// to init-commands.log in the sandbox's state directory; a command
+	// that exits non-zero fails Create.
+	InitCommands []string
+	// SocketMounts maps guest paths to unix sockets on the host running
+	// matchlock, e.g. {"/var/run/docker.sock": "/var/run/docker.sock"}. The
+	// guest agent creates each guest socket and proxies its connections to
+	// the host socket over vsock; nothing else on the host is reachable.
+	// Guest paths must be outside the workspace; host paths must be
+	// absolute.
+	SocketMounts map[string]string
+	// RequireSignature makes Create fail unless Image carries a cosign
+	// signature by one of TrustedKeys. Each key is PEM text or the path of
+	// a PEM public key file on the host running matchlock. Only key-based
+	// signatures are verified; keyless (Fulcio/Rekor) signing is not.
+	RequireSignature bool
+	TrustedKeys      []string
+	// EventBufferSize sets how many sandbox events are buffered for this
+	// client (default: api.DefaultEventBufferSize). Events beyond it are
+	// dropped rather than slowing the sandbox; raise it for bursty
+	// workloads that use OnSyscallEvent or VFS hook callbacks.
+	EventBufferSize int
 	// CPUs is the number of vCPUs
 	CPUs int
 	// MemoryMB is the memory in megabytes
 	MemoryMB int
+	// SwapMB adds compressed zram swap inside the guest so transient spikes
+	// above MemoryMB slow down instead of triggering the OOM killer. It may
+	// be at most api.MaxSwapRatio times MemoryMB; 0 disables swap.
+	SwapMB int
+	// CPUAffinity pins the VM's process, including its vCPU threads, to
+	// these host CPUs. Every core must be available to the host process.
+	// Linux hosts only.
+	CPUAffinity []int
+	// CgroupParent runs the VM in its own host cgroup under this cgroup v2
+	// path (e.g. "matchlock.slice"), so host limits and per-VM accounting
+	// cover the whole VM; Stats then reports the cgroup's usage too. Empty
+	// falls back to $MATCHLOCK_CGROUP_PARENT on the host. Linux hosts only.
+	CgroupParent string
 	// DiskSizeMB is the disk size in megabytes (default: 5120)
 	DiskSizeMB int
 	// TimeoutSeconds is the maximum execution time
@@ -217,33 +340,117 @@ type CreateOptions struct {
 	// AllowedPrivateHosts lists specific private IP addresses or patterns
 	// that bypass block-private-ips when it is enabled.
 	AllowedPrivateHosts []string
+	// AllowedUDPHosts lets guest UDP reach host or host:port destinations
+	// (same patterns as AllowedHosts; no port means any). Other UDP apart
+	// from DNS is dropped. See api.NetworkConfig.AllowedUDPHosts.
+	AllowedUDPHosts []string
 	// Mounts defines VFS mount configurations
 	Mounts map[string]MountConfig
 	// Env defines non-secret environment variables for command execution.
 	// These are visible in VM state and inspect/get outputs.
 	Env map[string]string
+	// Labels are free-form key/value tags, readable by the guest through
+	// the metadata service.
+	Labels map[string]string
 	// Secrets defines secrets to inject (replaced in HTTP requests to allowed hosts)
 	Secrets []Secret
 	// Workspace is the mount point for VFS in the guest (default: /workspace)
 	Workspace string
 	// VFSInterception configures host-side VFS interception hooks/rules.
 	VFSInterception *VFSInterceptionConfig
+	// VFSCompressMinBytes compresses guest file reads of at least this many
+	// bytes over vsock, which helps with large text files. 0 disables.
+	VFSCompressMinBytes int
 	// DNSServers overrides the default DNS servers (8.8.8.8, 8.8.4.4)
 	DNSServers []string
+	// UpstreamDNS sets the DNS servers (ip or ip:port) the host-side proxy
+	// uses to resolve allowed hostnames before connecting upstream, instead
+	// of the host's resolver. Use it for split-horizon DNS, e.g. to reach a
+	// regional endpoint the host would resolve differently.
+	UpstreamDNS []string
+	// UpstreamProxy tunnels the host-side proxy's upstream connections
+	// through an http://, https://, socks5:// or socks5h:// proxy, with
+	// optional user:password@ credentials. Empty uses the HTTPS_PROXY of
+	// the matchlock process; "none" connects directly.
+	UpstreamProxy string
+	// SearchDomains and ResolvOptions become the "search" and "options"
+	// lines of the guest's /etc/resolv.conf, e.g. ResolvOptions
+	// []string{"ndots:2"} to avoid slow lookups of dotted names.
+	SearchDomains []string
+	ResolvOptions []string
+	// MirrorRoutes sends a copy of matching HTTP(S) requests to a shadow
+	// endpoint, e.g. a local model, while the guest still talks to the
+	// real host. Network events report both statuses and latencies.
+	MirrorRoutes []api.MirrorRule
 	// Hostname overrides the default guest hostname (sandbox's ID)
 	Hostname string
+	// StaticIP and StaticMAC pin the guest's address instead of deriving
+	// it (see api.NetworkConfig.StaticIP). Create fails if another
+	// sandbox already uses the subnet or MAC.
+	StaticIP  string
+	StaticMAC string
+	// SharedBridge attaches the VM to the host's shared bridge with its own
+	// address there instead of a dedicated subnet (Linux only; see
+	// api.NetworkConfig.SharedBridge).
+	SharedBridge bool
 	// NetworkMTU overrides the guest interface/network stack MTU (default: 1500).
 	NetworkMTU int
+	// AutoMTU uses the host's outbound interface MTU for the guest when
+	// NetworkMTU is unset.
+	AutoMTU bool
+	// ClampMSS clamps the TCP MSS of forwarded SYNs to the route MTU (Linux only).
+	ClampMSS bool
+	// MetadataService lets the guest read sandbox metadata and fetch
+	// secrets by name from http://169.254.169.254 (see api.MetadataServiceIP).
+	MetadataService bool
+	// WaitForNetwork delays readiness until the guest can open a TCP
+	// connection to NetworkProbe (host:port; default the first DNS server
+	// on port 53), so the first command doesn't race network setup. Create
+	// fails with api.ErrBootNetworkUnreachable if egress never comes up.
+	// With AllowedHosts, point NetworkProbe at an allowed host. Setting
+	// NetworkProbe alone turns the wait on.
+	WaitForNetwork bool
+	NetworkProbe   string
+	// MaxConcurrentConnections caps the guest TCP connections the host-side
+	// proxy handles at once; MaxConnectionsPerHost caps them per destination
+	// IP. Excess connections are reset and reported as "connection_limited"
+	// events. 0 means unlimited.
+	MaxConcurrentConnections int
+	MaxConnectionsPerHost    int
+	// HostApproval holds guest connections to hosts outside AllowedHosts
+	// for up to HostApprovalTimeoutSeconds (default 30) and reports them to
+	// OnHostDenied. Returning true adds the host to the allowlist for the
+	// rest of the sandbox's life and lets the held connection through.
+	HostApproval               bool
+	HostApprovalTimeoutSeconds int
+	// OnHostDenied decides on hosts held by HostApproval. It runs on its
+	// own goroutine and may block, e.g. to ask a human, up to the timeout.
+	OnHostDenied func(host string) bool
 	// PortForwards maps local host ports to remote sandbox ports.
 	// These are applied after VM creation via the port_forward RPC.
 	PortForwards []api.PortForward
 	// PortForwardAddresses controls host bind addresses used when applying
 	// PortForwards (default: 127.0.0.1).
 	PortForwardAddresses []string
+	// Ports publishes sandbox ports using `docker run -p` syntax
+	// ([[ADDRESS:]HOST_PORT:]CONTAINER_PORT). They are applied after
+	// PortForwards; a spec without HOST_PORT gets an ephemeral host port.
+	Ports []string
+	// PublishAll forwards every port the image EXPOSEs to an ephemeral host
+	// port, like `docker run -P`. Realized bindings are available via
+	// Client.PortBindings.
+	PublishAll bool
 	// ImageConfig holds OCI image metadata (USER, ENTRYPOINT, CMD, WORKDIR, ENV)
 	ImageConfig *ImageConfig
+	// ProgressFunc receives image pull progress (phase, layers, bytes)
+	// while Create resolves the image. It is not called when the image is
+	// already cached.
+	ProgressFunc func(ImageProgress)
 }
 
+// ImageProgress is one image pull progress update reported during Create.
+type ImageProgress = api.ImageProgress
+
 // ImageConfig holds OCI image metadata for user/entrypoint/cmd/workdir/env.
 type ImageConfig struct {
 	User       string            `json:"user,omitempty"`
@@ -251,6 +458,8 @@ type ImageConfig struct {
 	Entrypoint []string          `json:"entrypoint,omitempty"`
 	Cmd        []string          `json:"cmd,omitempty"`
 	Env        map[string]string `json:"env,omitempty"`
+	// ExposedPorts lists TCP ports declared by the image via EXPOSE.
+	ExposedPorts []int `json:"exposed_ports,omitempty"`
 }
 
 // Secret defines a secret that will be injected as a placeholder env var
@@ -262,19 +471,46 @@ type Secret struct {
 	Value string
 	// Hosts is a list of hosts where this secret can be used (supports wildcards)
 	Hosts []string
+	// File delivers the secret as a read-only file at this guest path (under
+	// the workspace) instead of an environment variable. The file holds the
+	// placeholder unless FileRaw is set.
+	File string
+	// FileRaw writes the real value to File. The guest can read it directly
+	// and the proxy never substitutes it, so Hosts must be empty.
+	FileRaw bool
 }
 
-// MountConfig defines a VFS mount
+// MountConfig defines a VFS mount. An overlay takes either a HostPath,
+// which is snapshotted, or an Upper and Lower layer, each a MountConfig of
+// its own; writes land in Upper and never reach Lower.
+//
+// A host_fs mount can remap ownership: host files owned by HostUID appear
+// owned by GuestUID, and entries the guest creates are chowned to HostUID
+// (HostGID/GuestGID likewise). Set each pair together, e.g. with IDPtr.
 type MountConfig struct {
-	Type     string `json:"type"` // memory, host_fs, overlay
-	HostPath string `json:"host_path,omitempty"`
-	Readonly bool   `json:"readonly,omitempty"`
+	Type     string       `json:"type"` // memory, host_fs, overlay
+	HostPath string       `json:"host_path,omitempty"`
+	Readonly bool         `json:"readonly,omitempty"`
+	Upper    *MountConfig `json:"upper,omitempty"`
+	Lower    *MountConfig `json:"lower,omitempty"`
+	HostUID  *int         `json:"host_uid,omitempty"`
+	HostGID  *int         `json:"host_gid,omitempty"`
+	GuestUID *int         `json:"guest_uid,omitempty"`
+	GuestGID *int         `json:"guest_gid,omitempty"`
 }
 
+// IDPtr returns a pointer to id, for the ownership fields of MountConfig.
+func IDPtr(id int) *int { return &id }
+
 // VFSInterceptionConfig configures host-side VFS interception rules.
 type VFSInterceptionConfig struct {
 	EmitEvents bool          `json:"emit_events,omitempty"`
 	Rules      []VFSHookRule `json:"rules,omitempty"`
+	// OnHookDisabled is called, on its own goroutine, when a callback hook
+	// is disabled after repeated timeouts or panics. A disabled action hook
+	// blocks and a disabled mutate hook fails the write, so enforcement
+	// fails closed; disabled after hooks are skipped.
+	OnHookDisabled func(VFSHookDisabledEvent) `json:"-"`
 }
 
 // VFS hook phases.
@@ -308,6 +544,7 @@ const (
 	VFSHookOpRename    VFSHookOp = "rename"
 	VFSHookOpSymlink   VFSHookOp = "symlink"
 	VFSHookOpReadlink  VFSHookOp = "readlink"
+	VFSHookOpLink      VFSHookOp = "link"
 	VFSHookOpRead      VFSHookOp = "read"
 	VFSHookOpWrite     VFSHookOp = "write"
 	VFSHookOpClose     VFSHookOp = "close"
@@ -350,17 +587,24 @@ type VFSHookFunc func(ctx context.Context, event VFSHookEvent) error
 // Use this only when you intentionally need side effects that call back into the sandbox.
 type VFSDangerousHookFunc func(ctx context.Context, client *Client, event VFSHookEvent) error
 
-// VFSMutateRequest is passed to SDK-local mutate hooks before WriteFile.
+// VFSMutateRequest is passed to mutate hooks before a write. For WriteFile
+// Data is the whole content at Offset 0; for guest writes it is a single
+// write as the guest issued it, so a file may arrive in several chunks.
 type VFSMutateRequest struct {
-	Path string
-	Size int
-	Mode uint32
-	UID  int
-	GID  int
+	Path   string
+	Offset int64
+	Size   int
+	Data   []byte
+	Mode   uint32
+	UID    int
+	GID    int
 }
 
-// VFSMutateHookFunc computes replacement bytes for SDK WriteFile calls.
-// This hook runs in the SDK process and currently applies only to write_file RPCs.
+// VFSMutateHookFunc computes replacement bytes for a write. Returning nil
+// keeps Data unchanged; returning an error fails the write.
+// It runs in the SDK process before SDK WriteFile calls and, through a round
+// trip from the host, before matching writes made inside the guest. Guest
+// writes fail if no answer arrives within the rule's TimeoutMS (default 5s).
 type VFSMutateHookFunc func(ctx context.Context, req VFSMutateRequest) ([]byte, error)
 
 // VFSActionRequest is passed to SDK-local allow/block action hooks.
@@ -374,6 +618,10 @@ type VFSActionRequest struct {
 }
 
 // VFSActionHookFunc decides whether an operation should be allowed or blocked.
+// It runs in the SDK process before SDK WriteFile/ReadFile/ListFiles calls
+// and, through a round trip from the host, before matching file operations
+// made inside the guest. Guest operations are blocked if no decision arrives
+// within the rule's TimeoutMS (default 5s).
 type VFSActionHookFunc func(ctx context.Context, req VFSActionRequest) VFSHookAction
 
 type compiledVFSHook struct {
@@ -382,6 +630,7 @@ type compiledVFSHook struct {
 	path      string
 	timeout   time.Duration
 	dangerous bool
+	breaker   *vfsHookBreaker
 	callback  func(ctx context.Context, client *Client, event VFSHookEvent) error
 }
 
@@ -389,6 +638,8 @@ type compiledVFSMutateHook struct {
 	name     string
 	ops      map[string]struct{}
 	path     string
+	timeout  time.Duration
+	breaker  *vfsHookBreaker
 	callback VFSMutateHookFunc
 }
 
@@ -396,6 +647,8 @@ type compiledVFSActionHook struct {
 	name     string
 	ops      map[string]struct{}
 	path     string
+	timeout  time.Duration
+	breaker  *vfsHookBreaker
 	callback VFSActionHookFunc
 }
 
@@ -421,36 +674,146 @@ func (c *Client) Create(opts CreateOptions) (string, error) {
 	if opts.NetworkMTU < 0 {
 		return "", ErrInvalidNetworkMTU
 	}
+	if opts.MaxConcurrentConnections < 0 || opts.MaxConnectionsPerHost < 0 {
+		return "", ErrInvalidConnLimit
+	}
+	if opts.HostApprovalTimeoutSeconds < 0 {
+		return "", ErrInvalidHostApproval
+	}
+	if opts.RequireSignature && len(opts.TrustedKeys) == 0 {
+		return "", ErrNoTrustedKeys
+	}
+	if opts.NetworkProbe != "" {
+		if err := api.ValidateNetworkProbe(opts.NetworkProbe); err != nil {
+			return "", errx.Wrap(ErrInvalidNetworkProbe, err)
+		}
+	}
+	for _, entry := range opts.AllowedUDPHosts {
+		if _, _, err := api.ParseUDPHost(entry); err != nil {
+			return "", errx.Wrap(ErrInvalidUDPHost, err)
+		}
+	}
+	if err := api.ValidateSwap(opts.SwapMB, opts.MemoryMB); err != nil {
+		return "", errx.Wrap(ErrInvalidSwap, err)
+	}
+	if err := api.ValidateCPUAffinity(opts.CPUAffinity); err != nil {
+		return "", errx.Wrap(ErrInvalidCPUSet, err)
+	}
+	if err := api.ValidateCgroupParent(opts.CgroupParent); err != nil {
+		return "", errx.Wrap(ErrInvalidCgroupParent, err)
+	}
 	for _, mapping := range opts.AddHosts {
 		if err := api.ValidateAddHost(mapping); err != nil {
 			return "", errx.Wrap(ErrInvalidAddHost, err)
 		}
 	}
+	for _, rule := range opts.MirrorRoutes {
+		if err := api.ValidateMirrorRule(rule); err != nil {
+			return "", errx.Wrap(ErrInvalidMirrorRule, err)
+		}
+	}
+	if _, err := api.CapabilityNumbers(opts.CapAdd); err != nil {
+		return "", errx.Wrap(ErrInvalidCapability, err)
+	}
+	if _, err := api.CapabilityNumbers(opts.CapDrop); err != nil {
+		return "", errx.Wrap(ErrInvalidCapability, err)
+	}
+	if _, err := api.NormalizeAllowSyscalls(opts.AllowSyscalls); err != nil {
+		return "", errx.Wrap(ErrInvalidAllowSyscall, err)
+	}
+	if err := api.ValidateUlimits(opts.Ulimits); err != nil {
+		return "", errx.Wrap(ErrInvalidUlimit, err)
+	}
+	published, err := api.ParsePublishSpecs(opts.Ports)
+	if err != nil {
+		return "", errx.Wrap(ErrParsePortForwards, err)
+	}
 
 	wireVFS, localHooks, localMutateHooks, localActionHooks, err := compileVFSHooks(opts.VFSInterception)
 	if err != nil {
 		return "", err
 	}
 
+	resources := map[string]interface{}{
+		"cpus":            opts.CPUs,
+		"memory_mb":       opts.MemoryMB,
+		"disk_size_mb":    opts.DiskSizeMB,
+		"timeout_seconds": opts.TimeoutSeconds,
+	}
+	if opts.SwapMB > 0 {
+		resources["swap_mb"] = opts.SwapMB
+	}
+	if len(opts.CPUAffinity) > 0 {
+		resources["cpu_affinity"] = opts.CPUAffinity
+	}
+	if opts.CgroupParent != "" {
+		resources["cgroup_parent"] = opts.CgroupParent
+	}
 	params := map[string]interface{}{
-		"image": opts.Image,
-		"resources": map[string]interface{}{
-			"cpus":            opts.CPUs,
-			"memory_mb":       opts.MemoryMB,
-			"disk_size_mb":    opts.DiskSizeMB,
-			"timeout_seconds": opts.TimeoutSeconds,
-		},
+		"image":     opts.Image,
+		"resources": resources,
 	}
 
 	if opts.Privileged {
 		params["privileged"] = true
 	}
+	if len(opts.CapAdd) > 0 {
+		params["cap_add"] = opts.CapAdd
+	}
+	if len(opts.CapDrop) > 0 {
+		params["cap_drop"] = opts.CapDrop
+	}
+	if len(opts.AllowSyscalls) > 0 {
+		params["allow_syscalls"] = opts.AllowSyscalls
+	}
+	if opts.DisableNoNewPrivs {
+		params["disable_no_new_privs"] = true
+	}
+	if len(opts.Ulimits) > 0 {
+		params["ulimits"] = opts.Ulimits
+	}
+	if opts.SeccompAudit {
+		params["seccomp_audit"] = true
+	}
+	if opts.SharedRootfs {
+		params["shared_rootfs"] = true
+	}
+	if opts.SkipRootfsCheck {
+		params["skip_rootfs_check"] = true
+	}
+	if opts.KeepStateOnClose {
+		params["keep_state_on_close"] = true
+	}
+	if seconds := int(opts.StopGracePeriod / time.Second); seconds > 0 {
+		params["stop_grace_period_seconds"] = seconds
+	}
+	if opts.KernelPath != "" {
+		params["kernel_path"] = opts.KernelPath
+	}
+	if len(opts.KernelModules) > 0 {
+		params["kernel_modules"] = opts.KernelModules
+	}
+	if len(opts.InitCommands) > 0 {
+		params["init_commands"] = opts.InitCommands
+	}
+	if opts.RequireSignature {
+		params["require_signature"] = true
+	}
+	if len(opts.SocketMounts) > 0 {
+		params["socket_mounts"] = opts.SocketMounts
+	}
+	if len(opts.TrustedKeys) > 0 {
+		params["trusted_keys"] = opts.TrustedKeys
+	}
+	if opts.EventBufferSize > 0 {
+		params["event_buffer_size"] = opts.EventBufferSize
+	}
 
 	if network := buildCreateNetworkParams(opts); network != nil {
 		params["network"] = network
 	}
 
-	if len(opts.Mounts) > 0 || opts.Workspace != "" || wireVFS != nil {
+	if len(opts.Mounts) > 0 || opts.Workspace != "" || wireVFS != nil || opts.VFSCompressMinBytes > 0 {
 		vfs := make(map[string]interface{})
 		if len(opts.Mounts) > 0 {
 			vfs["mounts"] = opts.Mounts
@@ -461,24 +824,42 @@ func (c *Client) Create(opts CreateOptions) (string, error) {
 		if wireVFS != nil {
 			vfs["interception"] = wireVFS
 		}
+		if opts.VFSCompressMinBytes > 0 {
+			vfs["compress_min_bytes"] = opts.VFSCompressMinBytes
+		}
 		params["vfs"] = vfs
 	}
 
 	if len(opts.Env) > 0 {
 		params["env"] = opts.Env
 	}
+	if len(opts.Labels) > 0 {
+		params["labels"] = opts.Labels
+	}
 
 	if opts.ImageConfig != nil {
 		params["image_config"] = opts.ImageConfig
 	}
 
-	result, err := c.sendRequest("create", params)
+	var onProgress func(string, json.RawMessage)
+	if opts.ProgressFunc != nil {
+		onProgress = func(method string, params json.RawMessage) {
+			var p struct {
+				Progress ImageProgress `json:"progress"`
+			}
+			if err := json.Unmarshal(params, &p); err == nil {
+				opts.ProgressFunc(p.Progress)
+			}
+		}
+	}
+	result, err := c.sendRequestCtx(context.Background(), "create", params, onProgress)
 	if err != nil {
-		return "", err
+		return "", c.withStderr(err)
 	}
 
 	var createResult struct {
-		ID string `json:"id"`
+		ID           string `json:"id"`
+		ExposedPorts []int  `json:"exposed_ports,omitempty"`
 	}
 	if err := json.Unmarshal(result, &createResult); err != nil {
 		return "", errx.Wrap(ErrParseCreateResult, err)
@@ -486,9 +867,18 @@ func (c *Client) Create(opts CreateOptions) (string, error) {
 
 	c.vmID = createResult.ID
 	c.setVFSHooks(localHooks, localMutateHooks, localActionHooks)
+	c.setSyscallEventHandler(opts.OnSyscallEvent)
+	c.setHostDeniedHandler(opts.OnHostDenied)
 
-	if len(opts.PortForwards) > 0 {
-		if _, err := c.portForwardMappings(context.Background(), opts.PortForwardAddresses, opts.PortForwards); err != nil {
+	forwards := opts.PortForwards
+	if len(published) > 0 {
+		forwards = append(append([]api.PortForward(nil), forwards...), published...)
+	}
+	if opts.PublishAll {
+		forwards = append(append([]api.PortForward(nil), forwards...), api.PublishAllPortForwards(createResult.ExposedPorts)...)
+	}
+	if len(forwards) > 0 {
+		if _, err := c.portForwardMappings(context.Background(), opts.PortForwardAddresses, forwards); err != nil {
 			return c.vmID, err
 		}
 	}
@@ -500,12 +890,20 @@ func buildCreateNetworkParams(opts CreateOptions) map[string]interface{} {
 	hasAddHosts := len(opts.AddHosts) > 0
 	hasSecrets := len(opts.Secrets) > 0
 	hasDNSServers := len(opts.DNSServers) > 0
+	hasUpstreamDNS := len(opts.UpstreamDNS) > 0
+	hasUpstreamProxy := opts.UpstreamProxy != ""
+	hasResolv := len(opts.SearchDomains) > 0 || len(opts.ResolvOptions) > 0
+	hasMirrorRoutes := len(opts.MirrorRoutes) > 0
 	hasHostname := len(opts.Hostname) > 0
+	hasStaticAddress := opts.StaticIP != "" || opts.StaticMAC != ""
 	hasMTU := opts.NetworkMTU > 0
+	hasAutoMTU := opts.AutoMTU && !hasMTU
+	hasConnLimits := opts.MaxConcurrentConnections > 0 || opts.MaxConnectionsPerHost > 0
 	hasAllowedPrivateHosts := len(opts.AllowedPrivateHosts) > 0
+	hasAllowedUDPHosts := len(opts.AllowedUDPHosts) > 0
 	blockPrivateIPs, hasBlockPrivateIPsOverride := resolveCreateBlockPrivateIPs(opts)
 
-	includeNetwork := hasAllowedHosts || hasAddHosts || hasSecrets || hasDNSServers || hasHostname || hasMTU || hasBlockPrivateIPsOverride || hasAllowedPrivateHosts
+	includeNetwork := hasAllowedHosts || hasAddHosts || hasSecrets || hasDNSServers || hasUpstreamDNS || hasUpstreamProxy || hasResolv || hasMirrorRoutes || hasHostname || hasStaticAddress || opts.SharedBridge || hasMTU || hasAutoMTU || opts.ClampMSS || opts.MetadataService || opts.WaitForNetwork || opts.NetworkProbe != "" || hasConnLimits || opts.HostApproval || hasBlockPrivateIPsOverride || hasAllowedPrivateHosts || hasAllowedUDPHosts
 	if !includeNetwork {
 		return nil
 	}
@@ -523,28 +921,89 @@ func buildCreateNetworkParams(opts CreateOptions) map[string]interface{} {
 	if hasAllowedPrivateHosts {
 		network["allowed_private_hosts"] = opts.AllowedPrivateHosts
 	}
+	if hasAllowedUDPHosts {
+		network["allowed_udp_hosts"] = opts.AllowedUDPHosts
+	}
 	if hasAddHosts {
 		network["add_hosts"] = opts.AddHosts
 	}
 	if hasSecrets {
 		secrets := make(map[string]interface{})
 		for _, s := range opts.Secrets {
-			secrets[s.Name] = map[string]interface{}{
+			secret := map[string]interface{}{
 				"value": s.Value,
 				"hosts": s.Hosts,
 			}
+			if s.File != "" {
+				secret["file"] = s.File
+			}
+			if s.FileRaw {
+				secret["file_raw"] = true
+			}
+			secrets[s.Name] = secret
 		}
 		network["secrets"] = secrets
 	}
 	if hasDNSServers {
 		network["dns_servers"] = opts.DNSServers
 	}
+	if hasUpstreamDNS {
+		network["upstream_dns"] = opts.UpstreamDNS
+	}
+	if hasUpstreamProxy {
+		network["upstream_proxy"] = opts.UpstreamProxy
+	}
+	if len(opts.SearchDomains) > 0 {
+		network["search_domains"] = opts.SearchDomains
+	}
+	if len(opts.ResolvOptions) > 0 {
+		network["resolv_options"] = opts.ResolvOptions
+	}
+	if hasMirrorRoutes {
+		network["mirror_routes"] = opts.MirrorRoutes
+	}
 	if hasHostname {
 		network["hostname"] = opts.Hostname
 	}
+	if opts.StaticIP != "" {
+		network["static_ip"] = opts.StaticIP
+	}
+	if opts.StaticMAC != "" {
+		network["static_mac"] = opts.StaticMAC
+	}
 	if hasMTU {
 		network["mtu"] = opts.NetworkMTU
 	}
+	if hasAutoMTU {
+		network["auto_mtu"] = true
+	}
+	if opts.ClampMSS {
+		network["clamp_mss"] = true
+	}
+	if opts.SharedBridge {
+		network["shared_bridge"] = true
+	}
+	if opts.MetadataService {
+		network["metadata_service"] = true
+	}
+	if opts.WaitForNetwork || opts.NetworkProbe != "" {
+		network["wait_for_network"] = true
+		if opts.NetworkProbe != "" {
+			network["network_probe"] = opts.NetworkProbe
+		}
+	}
+	if opts.MaxConcurrentConnections > 0 {
+		network["max_concurrent_connections"] = opts.MaxConcurrentConnections
+	}
+	if opts.MaxConnectionsPerHost > 0 {
+		network["max_connections_per_host"] = opts.MaxConnectionsPerHost
+	}
+	if opts.HostApproval {
+		network["host_approval"] = true
+		if opts.HostApprovalTimeoutSeconds > 0 {
+			network["host_approval_timeout_seconds"] = opts.HostApprovalTimeoutSeconds
+		}
+	}
 	return network
 }
 
@@ -595,6 +1054,10 @@ func compileVFSHooks(cfg *VFSInterceptionConfig) (*VFSInterceptionConfig, []comp
 			switch action {
 			case "mutate_write":
 				return nil, nil, nil, nil, errx.With(ErrInvalidVFSHook, " %q mutate_write requires MutateHook callback", rule.Name)
+			case api.VFSHookActionCallback:
+				return nil, nil, nil, nil, errx.With(ErrInvalidVFSHook, " %q action=callback requires ActionHook callback", rule.Name)
+			case api.VFSHookActionMutateCallback:
+				return nil, nil, nil, nil, errx.With(ErrInvalidVFSHook, " %q action=mutate_callback requires MutateHook callback", rule.Name)
 			}
 			wire.Rules = append(wire.Rules, rule)
 			continue
@@ -609,8 +1072,9 @@ func compileVFSHooks(cfg *VFSInterceptionConfig) (*VFSInterceptionConfig, []comp
 			}
 
 			compiled := compiledVFSHook{
-				name: rule.Name,
-				path: rule.Path,
+				name:    rule.Name,
+				path:    rule.Path,
+				breaker: newVFSHookBreaker(rule.Name, rule.Path, cfg.OnHookDisabled),
 				callback: func(ctx context.Context, _ *Client, event VFSHookEvent) error {
 					return rule.Hook(ctx, event)
 				},
@@ -644,6 +1108,7 @@ func compileVFSHooks(cfg *VFSInterceptionConfig) (*VFSInterceptionConfig, []comp
 				path:      rule.Path,
 				timeout:   0,
 				dangerous: true,
+				breaker:   newVFSHookBreaker(rule.Name, rule.Path, cfg.OnHookDisabled),
 				callback: func(ctx context.Context, client *Client, event VFSHookEvent) error {
 					return rule.DangerousHook(ctx, client, event)
 				},
@@ -674,6 +1139,8 @@ func compileVFSHooks(cfg *VFSInterceptionConfig) (*VFSInterceptionConfig, []comp
 			compiledAction := compiledVFSActionHook{
 				name:     rule.Name,
 				path:     rule.Path,
+				timeout:  enforcementHookTimeout(rule.TimeoutMS),
+				breaker:  newVFSHookBreaker(rule.Name, rule.Path, cfg.OnHookDisabled),
 				callback: rule.ActionHook,
 			}
 			if len(rule.Ops) > 0 {
@@ -686,6 +1153,16 @@ func compileVFSHooks(cfg *VFSInterceptionConfig) (*VFSInterceptionConfig, []comp
 				}
 			}
 			localAction = append(localAction, compiledAction)
+			// Guest file operations never pass through the SDK, so the host
+			// asks back (vfs_hook.decide) for this rule's decision.
+			wire.Rules = append(wire.Rules, VFSHookRule{
+				Name:      rule.Name,
+				Phase:     VFSHookPhaseBefore,
+				Ops:       rule.Ops,
+				Path:      rule.Path,
+				Action:    api.VFSHookActionCallback,
+				TimeoutMS: rule.TimeoutMS,
+			})
 			continue
 		}
 
@@ -699,6 +1176,8 @@ func compileVFSHooks(cfg *VFSInterceptionConfig) (*VFSInterceptionConfig, []comp
 		compiledMutate := compiledVFSMutateHook{
 			name:     rule.Name,
 			path:     rule.Path,
+			timeout:  enforcementHookTimeout(rule.TimeoutMS),
+			breaker:  newVFSHookBreaker(rule.Name, rule.Path, cfg.OnHookDisabled),
 			callback: rule.MutateHook,
 		}
 		if len(rule.Ops) > 0 {
@@ -711,6 +1190,14 @@ func compileVFSHooks(cfg *VFSInterceptionConfig) (*VFSInterceptionConfig, []comp
 			}
 		}
 		localMutate = append(localMutate, compiledMutate)
+		wire.Rules = append(wire.Rules, VFSHookRule{
+			Name:      rule.Name,
+			Phase:     VFSHookPhaseBefore,
+			Ops:       rule.Ops,
+			Path:      rule.Path,
+			Action:    api.VFSHookActionMutateCallback,
+			TimeoutMS: rule.TimeoutMS,
+		})
 	}
 
 	if len(local) > 0 {
@@ -724,6 +1211,50 @@ func compileVFSHooks(cfg *VFSInterceptionConfig) (*VFSInterceptionConfig, []comp
 	return wire, local, localMutate, localAction, nil
 }
 
+func enforcementHookTimeout(timeoutMS int) time.Duration {
+	if timeoutMS > 0 {
+		return time.Duration(timeoutMS) * time.Millisecond
+	}
+	return defaultVFSEnforcementHookTimeout
+}
+
+func (c *Client) setSyscallEventHandler(fn func(api.SyscallEvent)) {
+	c.syscallEventMu.Lock()
+	c.onSyscallEvent = fn
+	c.syscallEventMu.Unlock()
+}
+
+func (c *Client) dispatchSyscallEvent(event api.SyscallEvent) {
+	c.syscallEventMu.RLock()
+	fn := c.onSyscallEvent
+	c.syscallEventMu.RUnlock()
+	if fn != nil {
+		fn(event)
+	}
+}
+
+func (c *Client) setHostDeniedHandler(fn func(host string) bool) {
+	c.hostDeniedMu.Lock()
+	c.onHostDenied = fn
+	c.hostDeniedMu.Unlock()
+}
+
+// dispatchHostDenied asks OnHostDenied about a held host off the reader
+// goroutine, since the decision may wait on a human.
+func (c *Client) dispatchHostDenied(event api.HostDenied) {
+	c.hostDeniedMu.RLock()
+	fn := c.onHostDenied
+	c.hostDeniedMu.RUnlock()
+	if fn == nil {
+		return
+	}
+	go func() {
+		if fn(event.Host) {
+			_ = c.AllowHost(context.Background(), event.Host)
+		}
+	}()
+}
+
 func (c *Client) setVFSHooks(hooks []compiledVFSHook, mutateHooks []compiledVFSMutateHook, actionHooks []compiledVFSActionHook) {
 	c.vfsHookMu.Lock()
 	c.vfsHooks = hooks
@@ -733,6 +1264,32 @@ func (c *Client) setVFSHooks(hooks []compiledVFSHook, mutateHooks []compiledVFSM
 	c.vfsHookMu.Unlock()
 }
 
+// subscribeFileEvents registers fn to receive every VFS file event. fn runs on
+// the reader goroutine and must not block. The returned function unsubscribes.
+func (c *Client) subscribeFileEvents(fn func(api.FileEvent)) func() {
+	c.fileEventMu.Lock()
+	defer c.fileEventMu.Unlock()
+	if c.fileEventSubs == nil {
+		c.fileEventSubs = make(map[uint64]func(api.FileEvent))
+	}
+	c.fileEventSeq++
+	id := c.fileEventSeq
+	c.fileEventSubs[id] = fn
+	return func() {
+		c.fileEventMu.Lock()
+		delete(c.fileEventSubs, id)
+		c.fileEventMu.Unlock()
+	}
+}
+
+func (c *Client) dispatchFileEvent(event api.FileEvent) {
+	c.fileEventMu.RLock()
+	defer c.fileEventMu.RUnlock()
+	for _, fn := range c.fileEventSubs {
+		fn(event)
+	}
+}
+
 func (c *Client) handleVFSFileEvent(op, path string, size int64, mode uint32, uid, gid int) {
 	c.vfsHookMu.RLock()
 	hooks := append([]compiledVFSHook(nil), c.vfsHooks...)
@@ -785,13 +1342,9 @@ func (c *Client) runVFSSafeHooksForEvent(hooks []compiledVFSHook, event VFSHookE
 }
 
 func (c *Client) runSingleVFSHook(hook compiledVFSHook, event VFSHookEvent) {
-	ctx := context.Background()
-	cancel := func() {}
-	if hook.timeout > 0 {
-		ctx, cancel = context.WithTimeout(ctx, hook.timeout)
-	}
-	_ = hook.callback(ctx, c, event)
-	cancel()
+	_ = guardVFSHook(context.Background(), hook.timeout, hook.breaker, func(ctx context.Context) error {
+		return hook.callback(ctx, c, event)
+	})
 }
 
 func matchesVFSHook(hook compiledVFSHook, op, path string) bool {
@@ -865,7 +1418,10 @@ func (c *Client) applyLocalActionHooks(ctx context.Context, op VFSHookOp, path s
 			continue
 		}
 
-		decision := VFSHookAction(strings.ToLower(strings.TrimSpace(string(hook.callback(ctx, req)))))
+		decision, err := runVFSActionHook(ctx, hook, req)
+		if err != nil {
+			return errx.With(ErrVFSHookBlocked, " op=%s path=%s hook=%q: %w", op, path, hook.name, err)
+		}
 		switch decision {
 		case "", VFSHookActionAllow:
 			continue
@@ -879,6 +1435,100 @@ func (c *Client) applyLocalActionHooks(ctx context.Context, op VFSHookOp, path s
 	return nil
 }
 
+// runVFSActionHook runs an action hook under its timeout and breaker and
+// returns its normalized decision.
+func runVFSActionHook(ctx context.Context, hook compiledVFSActionHook, req VFSActionRequest) (VFSHookAction, error) {
+	var decision VFSHookAction
+	err := guardVFSHook(ctx, hook.timeout, hook.breaker, func(ctx context.Context) error {
+		decision = VFSHookAction(strings.ToLower(strings.TrimSpace(string(hook.callback(ctx, req)))))
+		return nil
+	})
+	if err != nil {
+		// A timed-out hook may still be writing decision.
+		return "", err
+	}
+	return decision, nil
+}
+
+// answerVFSHookDecision runs the action hook a vfs_hook.decide notification
+// refers to and sends its decision back to the host.
+func (c *Client) answerVFSHookDecision(decisionID uint64, req api.VFSHookDecisionRequest) {
+	c.vfsHookMu.RLock()
+	hooks := append([]compiledVFSActionHook(nil), c.vfsActionHooks...)
+	c.vfsHookMu.RUnlock()
+
+	decision := VFSHookActionBlock
+	if req.Rule >= 0 && req.Rule < len(hooks) {
+		answer, err := runVFSActionHook(context.Background(), hooks[req.Rule], VFSActionRequest{
+			Op:   req.Op,
+			Path: req.Path,
+			Size: req.Size,
+			Mode: req.Mode,
+			UID:  req.UID,
+			GID:  req.GID,
+		})
+		switch {
+		case err != nil:
+		case answer == "":
+			decision = VFSHookActionAllow
+		default:
+			decision = answer
+		}
+	}
+
+	params := map[string]interface{}{
+		"decision_id": decisionID,
+		"action":      decision,
+	}
+	_, _ = c.sendRequestCtx(context.Background(), "vfs_hook.decision", params, nil)
+}
+
+// runVFSMutateHook runs a mutate hook under its timeout and breaker.
+func runVFSMutateHook(ctx context.Context, hook compiledVFSMutateHook, req VFSMutateRequest) ([]byte, error) {
+	var mutated []byte
+	err := guardVFSHook(ctx, hook.timeout, hook.breaker, func(ctx context.Context) error {
+		var err error
+		mutated, err = hook.callback(ctx, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mutated, nil
+}
+
+// answerVFSHookMutation runs the mutate hook a vfs_hook.mutate notification
+// refers to and sends the replacement bytes back to the host.
+func (c *Client) answerVFSHookMutation(mutationID uint64, req api.VFSHookMutateRequest) {
+	c.vfsHookMu.RLock()
+	hooks := append([]compiledVFSMutateHook(nil), c.vfsMutateHooks...)
+	c.vfsHookMu.RUnlock()
+
+	params := map[string]interface{}{"mutation_id": mutationID}
+	if req.Rule < 0 || req.Rule >= len(hooks) {
+		params["error"] = "unknown mutate hook"
+	} else {
+		data, err := runVFSMutateHook(context.Background(), hooks[req.Rule], VFSMutateRequest{
+			Path:   req.Path,
+			Offset: req.Offset,
+			Size:   len(req.Data),
+			Data:   req.Data,
+			Mode:   req.Mode,
+			UID:    req.UID,
+			GID:    req.GID,
+		})
+		switch {
+		case err != nil:
+			params["error"] = err.Error()
+		case data == nil:
+			params["data"] = req.Data
+		default:
+			params["data"] = data
+		}
+	}
+	_, _ = c.sendRequestCtx(context.Background(), "vfs_hook.mutation", params, nil)
+}
+
 func (c *Client) applyLocalWriteMutations(ctx context.Context, path string, content []byte, mode uint32) ([]byte, error) {
 	c.vfsHookMu.RLock()
 	hooks := append([]compiledVFSMutateHook(nil), c.vfsMutateHooks...)
@@ -896,11 +1546,12 @@ func (c *Client) applyLocalWriteMutations(ctx context.Context, path string, cont
 		req := VFSMutateRequest{
 			Path: path,
 			Size: len(current),
+			Data: current,
 			Mode: mode,
 			UID:  os.Geteuid(),
 			GID:  os.Getegid(),
 		}
-		mutated, err := hook.callback(ctx, req)
+		mutated, err := runVFSMutateHook(ctx, hook, req)
 		if err != nil {
 			return nil, err
 		}
@@ -928,6 +1579,21 @@ func (c *Client) PortForwardWithAddresses(ctx context.Context, addresses []strin
 	return c.portForwardMappings(ctx, addresses, forwards)
 }
 
+// PortForwardWait applies a [LOCAL_PORT:]REMOTE_PORT mapping and waits until
+// a guest service accepts connections on REMOTE_PORT before returning. A
+// non-positive timeout uses api.DefaultPortForwardWaitTimeout.
+func (c *Client) PortForwardWait(ctx context.Context, spec string, timeout time.Duration) ([]api.PortForwardBinding, error) {
+	pf, err := api.ParsePortForward(spec)
+	if err != nil {
+		return nil, errx.Wrap(ErrParsePortForwards, err)
+	}
+	pf.WaitForGuestPort = true
+	if timeout > 0 {
+		pf.WaitTimeoutMS = int(timeout / time.Millisecond)
+	}
+	return c.portForwardMappings(ctx, nil, []api.PortForward{pf})
+}
+
 func (c *Client) portForwardMappings(ctx context.Context, addresses []string, forwards []api.PortForward) ([]api.PortForwardBinding, error) {
 	if len(forwards) == 0 {
 		return nil, nil
@@ -953,9 +1619,21 @@ func (c *Client) portForwardMappings(ctx context.Context, addresses []string, fo
 	if err := json.Unmarshal(result, &parsed); err != nil {
 		return nil, errx.Wrap(ErrParsePortBindings, err)
 	}
+
+	c.portBindingsMu.Lock()
+	c.portBindings = append([]api.PortForwardBinding(nil), parsed.Bindings...)
+	c.portBindingsMu.Unlock()
 	return parsed.Bindings, nil
 }
 
+// PortBindings returns the host listener bindings from the most recent
+// port-forward request, including those applied at Create time.
+func (c *Client) PortBindings() []api.PortForwardBinding {
+	c.portBindingsMu.Lock()
+	defer c.portBindingsMu.Unlock()
+	return append([]api.PortForwardBinding(nil), c.portBindings...)
+}
+
 // ExecResult holds the result of command execution
 type ExecResult struct {
 	// ExitCode is the command's exit code
@@ -966,6 +1644,90 @@ type ExecResult struct {
 	Stderr string
 	// DurationMS is the execution time in milliseconds
 	DurationMS int64
+	// UserTimeMS and SysTimeMS are the CPU time the command spent in user
+	// and kernel mode, including child processes it waited for.
+	UserTimeMS int64
+	SysTimeMS  int64
+	// MaxRSSKB is the peak resident set size of the command's largest
+	// process, in kilobytes.
+	MaxRSSKB int64
+	// TimedOut reports the command was killed at ExecOptions.TimeoutMS;
+	// ExitCode is then 124 and Stdout/Stderr hold the output up to that point.
+	TimedOut bool
+}
+
+// ExecOptions configures a single command run with ExecWithOptions or
+// ExecStreamWithOptions.
+type ExecOptions struct {
+	// WorkingDir overrides the command's working directory.
+	WorkingDir string
+	// User overrides the user the command runs as.
+	User string
+	// LoginShell runs the command with "sh -lc" instead of "sh -c", so
+	// /etc/profile and ~/.profile run first and PATH additions made there
+	// (conda, nvm, ...) apply. The image ENV is merged into every command
+	// either way; profile scripts may override it.
+	LoginShell bool
+	// Shell is the argv the command is appended to, e.g.
+	// []string{"bash", "-c"}. Empty means "sh -c".
+	Shell []string
+	// Args, when set, runs directly as the process argv without a shell,
+	// for images with no /bin/sh (distroless, scratch). Args[0] is looked up
+	// in the command's PATH. The command string may be empty; it then
+	// defaults to the joined Args in events.
+	Args []string
+	// NoShell runs the command string as a single executable path with no
+	// shell and no arguments. It is shorthand for Args: []string{command}.
+	NoShell bool
+	// Env adds variables for this command only, on top of the image ENV
+	// and CreateOptions.Env (Env wins on conflicts). The CA bundle paths
+	// and secret placeholders matchlock injects cannot be overridden.
+	Env map[string]string
+	// TimeoutMS, when positive, has the guest agent kill the command's
+	// process group after that many milliseconds. The exec then returns its
+	// result, with TimedOut set and exit code 124 like GNU timeout, together
+	// with an error matching ErrExecTimeout. Context cancellation is still
+	// reported as context.Canceled, so the two can be told apart.
+	TimeoutMS int
+}
+
+func (o ExecOptions) params(command string) map[string]interface{} {
+	params := map[string]interface{}{
+		"command": command,
+	}
+	if args := o.argv(command); len(args) > 0 {
+		params["args"] = args
+	}
+	if len(o.Shell) > 0 {
+		params["shell"] = o.Shell
+	}
+	if o.WorkingDir != "" {
+		params["working_dir"] = o.WorkingDir
+	}
+	if len(o.Env) > 0 {
+		params["env"] = o.Env
+	}
+	if o.User != "" {
+		params["user"] = o.User
+	}
+	if o.LoginShell {
+		params["login_shell"] = true
+	}
+	if o.TimeoutMS > 0 {
+		params["timeout_ms"] = o.TimeoutMS
+	}
+	return params
+}
+
+// argv returns the argv to run without a shell, or nil to use a shell.
+func (o ExecOptions) argv(command string) []string {
+	if len(o.Args) > 0 {
+		return o.Args
+	}
+	if o.NoShell && command != "" {
+		return []string{command}
+	}
+	return nil
 }
 
 // Exec executes a command in the sandbox and returns the buffered result.
@@ -977,37 +1739,123 @@ func (c *Client) Exec(ctx context.Context, command string) (*ExecResult, error)
 
 // ExecWithDir executes a command in the sandbox with a working directory.
 func (c *Client) ExecWithDir(ctx context.Context, command, workingDir string) (*ExecResult, error) {
-	params := map[string]string{
-		"command": command,
+	return c.ExecWithOptions(ctx, command, ExecOptions{WorkingDir: workingDir})
+}
+
+// ExecWithOptions executes a command in the sandbox with opts.
+func (c *Client) ExecWithOptions(ctx context.Context, command string, opts ExecOptions) (*ExecResult, error) {
+	raw, err := c.execRaw(ctx, command, opts)
+	if err != nil {
+		return nil, err
 	}
-	if workingDir != "" {
-		params["working_dir"] = workingDir
+	result := &ExecResult{
+		ExitCode:   raw.ExitCode,
+		Stdout:     string(raw.Stdout),
+		Stderr:     string(raw.Stderr),
+		DurationMS: raw.DurationMS,
+		UserTimeMS: raw.UserTimeMS,
+		SysTimeMS:  raw.SysTimeMS,
+		MaxRSSKB:   raw.MaxRSSKB,
+		TimedOut:   raw.TimedOut,
 	}
+	if raw.TimedOut {
+		return result, execTimeoutError(opts.TimeoutMS)
+	}
+	return result, nil
+}
 
-	result, err := c.sendRequestCtx(ctx, "exec", params, nil)
+func execTimeoutError(timeoutMS int) error {
+	return errx.With(ErrExecTimeout, " after %dms", timeoutMS)
+}
+
+// ExecBytes executes a command like Exec but returns stdout and stderr as
+// raw bytes, for commands whose output is binary (e.g. tar or gzip writing
+// to stdout) and should not be handled as text.
+func (c *Client) ExecBytes(ctx context.Context, command string) (stdout, stderr []byte, exitCode int, err error) {
+	raw, err := c.execRaw(ctx, command, ExecOptions{})
 	if err != nil {
-		return nil, err
+		return nil, nil, 0, err
 	}
+	return raw.Stdout, raw.Stderr, raw.ExitCode, nil
+}
+
+// execRawResult is the exec RPC result. The handler base64-encodes output,
+// which encoding/json decodes into the []byte fields.
+type execRawResult struct {
+	ExitCode   int    `json:"exit_code"`
+	Stdout     []byte `json:"stdout"`
+	Stderr     []byte `json:"stderr"`
+	DurationMS int64  `json:"duration_ms"`
+	UserTimeMS int64  `json:"user_time_ms"`
+	SysTimeMS  int64  `json:"sys_time_ms"`
+	MaxRSSKB   int64  `json:"max_rss_kb"`
+	TimedOut   bool   `json:"timed_out"`
+}
 
-	var execResult struct {
-		ExitCode   int    `json:"exit_code"`
-		Stdout     string `json:"stdout"`
-		Stderr     string `json:"stderr"`
-		DurationMS int64  `json:"duration_ms"`
+func (c *Client) execRaw(ctx context.Context, command string, opts ExecOptions) (*execRawResult, error) {
+	result, err := c.sendRequestCtx(ctx, "exec", opts.params(command), nil)
+	if err != nil {
+		return nil, err
 	}
+	var execResult execRawResult
 	if err := json.Unmarshal(result, &execResult); err != nil {
 		return nil, errx.Wrap(ErrParseExecResult, err)
 	}
+	return &execResult, nil
+}
 
-	stdout, _ := base64.StdEncoding.DecodeString(execResult.Stdout)
-	stderr, _ := base64.StdEncoding.DecodeString(execResult.Stderr)
+// execErrorOutputLimit bounds how much command output ExecError.Error
+// includes; the full output stays in ExecError.Result.
+const execErrorOutputLimit = 2048
 
-	return &ExecResult{
-		ExitCode:   execResult.ExitCode,
-		Stdout:     string(stdout),
-		Stderr:     string(stderr),
-		DurationMS: execResult.DurationMS,
-	}, nil
+// ExecError is returned by ExecCheck when a command exits non-zero. It
+// unwraps to ErrCommandFailed.
+type ExecError struct {
+	Command string
+	Result  *ExecResult
+}
+
+func (e *ExecError) Error() string {
+	msg := fmt.Sprintf("command %q exited with code %d", e.Command, e.Result.ExitCode)
+	output := strings.TrimSpace(e.Result.Stderr)
+	if output == "" {
+		output = strings.TrimSpace(e.Result.Stdout)
+	}
+	if len(output) > execErrorOutputLimit {
+		output = "..." + output[len(output)-execErrorOutputLimit:]
+	}
+	if output != "" {
+		msg += ": " + output
+	}
+	return msg
+}
+
+func (e *ExecError) Unwrap() error {
+	return ErrCommandFailed
+}
+
+// ExecCheck runs a command like Exec but also returns an *ExecError when it
+// exits non-zero. The result is returned alongside that error.
+func (c *Client) ExecCheck(ctx context.Context, command string) (*ExecResult, error) {
+	result, err := c.Exec(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return result, &ExecError{Command: command, Result: result}
+	}
+	return result, nil
+}
+
+// MustExec runs a command with ExecCheck and returns its stdout. It panics
+// if the command cannot be run or exits non-zero, so it is meant for tests
+// and setup code where a failure should stop everything.
+func (c *Client) MustExec(ctx context.Context, command string) string {
+	result, err := c.ExecCheck(ctx, command)
+	if err != nil {
+		panic(err)
+	}
+	return result.Stdout
 }
 
 // ExecStreamResult holds the final result of a streaming exec (no stdout/stderr
@@ -1015,6 +1863,12 @@ func (c *Client) ExecWithDir(ctx context.Context, command, workingDir string) (*
 type ExecStreamResult struct {
 	ExitCode   int
 	DurationMS int64
+	// Resource usage, as in ExecResult.
+	UserTimeMS int64
+	SysTimeMS  int64
+	MaxRSSKB   int64
+	// TimedOut is set as in ExecResult.
+	TimedOut bool
 }
 
 // ExecStream executes a command and streams stdout/stderr to the provided writers
@@ -1027,13 +1881,55 @@ func (c *Client) ExecStream(ctx context.Context, command string, stdout, stderr
 // ExecStreamWithDir executes a command with a working directory and streams
 // stdout/stderr to the provided writers in real-time.
 func (c *Client) ExecStreamWithDir(ctx context.Context, command, workingDir string, stdout, stderr io.Writer) (*ExecStreamResult, error) {
-	params := map[string]string{
-		"command": command,
-	}
-	if workingDir != "" {
-		params["working_dir"] = workingDir
+	return c.ExecStreamWithOptions(ctx, command, ExecOptions{WorkingDir: workingDir}, stdout, stderr)
+}
+
+// ExecStreamWithOptions executes a command with opts and streams
+// stdout/stderr to the provided writers in real-time.
+func (c *Client) ExecStreamWithOptions(ctx context.Context, command string, opts ExecOptions, stdout, stderr io.Writer) (*ExecStreamResult, error) {
+	handle, err := c.startExecStream(ctx, command, opts, stdout, stderr)
+	if err != nil {
+		return nil, err
 	}
+	return handle.Wait()
+}
+
+// ExecHandle is a streaming command started with StartExecStream.
+type ExecHandle struct {
+	id     uint64
+	cancel context.CancelFunc
+	done   chan struct{}
 
+	result *ExecStreamResult
+	err    error
+}
+
+// ID returns the request ID of the command, accepted by Client.CancelExec.
+func (h *ExecHandle) ID() uint64 {
+	return h.id
+}
+
+// Cancel aborts the command without cancelling the context it was started
+// with. Wait then returns context.Canceled. Cancelling a finished command is
+// a no-op.
+func (h *ExecHandle) Cancel() {
+	h.cancel()
+}
+
+// Wait blocks until the command exits and returns its result.
+func (h *ExecHandle) Wait() (*ExecStreamResult, error) {
+	<-h.done
+	return h.result, h.err
+}
+
+// StartExecStream starts a command like ExecStreamWithDir but returns as soon
+// as the request is sent. The handle can abort that one command, e.g. from a
+// UI stop button, while other requests sharing ctx keep running.
+func (c *Client) StartExecStream(ctx context.Context, command, workingDir string, stdout, stderr io.Writer) (*ExecHandle, error) {
+	return c.startExecStream(ctx, command, ExecOptions{WorkingDir: workingDir}, stdout, stderr)
+}
+
+func (c *Client) startExecStream(ctx context.Context, command string, opts ExecOptions, stdout, stderr io.Writer) (*ExecHandle, error) {
 	onNotification := func(method string, params json.RawMessage) {
 		var chunk struct {
 			Data string `json:"data"`
@@ -1057,23 +1953,62 @@ func (c *Client) ExecStreamWithDir(ctx context.Context, command, workingDir stri
 		}
 	}
 
-	result, err := c.sendRequestCtx(ctx, "exec_stream", params, onNotification)
+	id, pending, err := c.startRequest("exec_stream", opts.params(command), onNotification)
 	if err != nil {
 		return nil, err
 	}
 
-	var streamResult struct {
-		ExitCode   int   `json:"exit_code"`
-		DurationMS int64 `json:"duration_ms"`
-	}
-	if err := json.Unmarshal(result, &streamResult); err != nil {
-		return nil, errx.Wrap(ErrParseExecStreamResult, err)
-	}
+	ctx, cancel := context.WithCancel(ctx)
+	handle := &ExecHandle{id: id, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(handle.done)
+		defer cancel()
+		result, err := c.awaitRequest(ctx, id, pending)
+		if err != nil {
+			handle.err = err
+			return
+		}
 
-	return &ExecStreamResult{
-		ExitCode:   streamResult.ExitCode,
-		DurationMS: streamResult.DurationMS,
-	}, nil
+		var streamResult struct {
+			ExitCode   int   `json:"exit_code"`
+			DurationMS int64 `json:"duration_ms"`
+			UserTimeMS int64 `json:"user_time_ms"`
+			SysTimeMS  int64 `json:"sys_time_ms"`
+			MaxRSSKB   int64 `json:"max_rss_kb"`
+			TimedOut   bool  `json:"timed_out"`
+		}
+		if err := json.Unmarshal(result, &streamResult); err != nil {
+			handle.err = errx.Wrap(ErrParseExecStreamResult, err)
+			return
+		}
+		handle.result = &ExecStreamResult{
+			ExitCode:   streamResult.ExitCode,
+			DurationMS: streamResult.DurationMS,
+			UserTimeMS: streamResult.UserTimeMS,
+			SysTimeMS:  streamResult.SysTimeMS,
+			MaxRSSKB:   streamResult.MaxRSSKB,
+			TimedOut:   streamResult.TimedOut,
+		}
+		if streamResult.TimedOut {
+			handle.err = execTimeoutError(opts.TimeoutMS)
+		}
+	}()
+	return handle, nil
+}
+
+// CancelExec aborts the in-flight exec or exec_stream request with the given
+// ID (see ExecHandle.ID). The call waiting on it returns the server's
+// cancellation error. It returns ErrExecNotRunning if no such request is in
+// flight.
+func (c *Client) CancelExec(id uint64) error {
+	c.pendingMu.Lock()
+	_, ok := c.pending[id]
+	c.pendingMu.Unlock()
+	if !ok {
+		return errx.With(ErrExecNotRunning, ": %d", id)
+	}
+	c.sendCancelRequest(id)
+	return nil
 }
 
 // WriteFile writes content to a file in the sandbox.
@@ -1127,6 +2062,81 @@ func (c *Client) ReadFile(ctx context.Context, path string) ([]byte, error) {
 	return base64.StdEncoding.DecodeString(readResult.Content)
 }
 
+// ReadFileRange reads up to length bytes of a file from offset off without
+// transferring the rest, e.g. the tail of a large log. It returns fewer
+// bytes when the file ends first, and none when off is past EOF.
+func (c *Client) ReadFileRange(ctx context.Context, path string, off int64, length int) ([]byte, error) {
+	if off < 0 || length < 0 {
+		return nil, errx.With(ErrInvalidReadRange, ": offset %d, length %d", off, length)
+	}
+	if err := c.applyLocalActionHooks(ctx, VFSHookOpRead, path, 0, 0); err != nil {
+		return nil, err
+	}
+
+	result, err := c.sendRequestCtx(ctx, "read_file_range", map[string]interface{}{
+		"path":   path,
+		"offset": off,
+		"length": length,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var readResult struct {
+		Content string `json:"content"`
+	}
+	if err := json.Unmarshal(result, &readResult); err != nil {
+		return nil, errx.Wrap(ErrParseReadResult, err)
+	}
+
+	return base64.StdEncoding.DecodeString(readResult.Content)
+}
+
+// ReadFileTo streams a file from the sandbox into w and returns the number
+// of bytes written. Unlike ReadFile, the file is never held in memory whole,
+// on either side of the RPC connection, so it suits large files such as
+// model checkpoints. A failing w.Write aborts the transfer.
+func (c *Client) ReadFileTo(ctx context.Context, path string, w io.Writer) (int64, error) {
+	if err := c.applyLocalActionHooks(ctx, VFSHookOpRead, path, 0, 0); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var written int64
+	var writeErr error
+	onNotification := func(method string, params json.RawMessage) {
+		if writeErr != nil {
+			return
+		}
+		var chunk struct {
+			Data string `json:"data"`
+		}
+		if err := json.Unmarshal(params, &chunk); err != nil {
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(chunk.Data)
+		if err != nil {
+			return
+		}
+		n, err := w.Write(decoded)
+		written += int64(n)
+		if err != nil {
+			writeErr = err
+			cancel()
+		}
+	}
+
+	_, err := c.sendRequestCtx(ctx, "read_file_stream", map[string]string{
+		"path": path,
+	}, onNotification)
+	if writeErr != nil {
+		return written, writeErr
+	}
+	return written, err
+}
+
 // FileInfo holds file metadata
 type FileInfo struct {
 	Name  string `json:"name"`
@@ -1159,3 +2169,215 @@ func (c *Client) ListFiles(ctx context.Context, path string) ([]FileInfo, error)
 
 	return listResult.Files, nil
 }
+
+// SnapshotWorkspace checkpoints the workspace filesystem and returns an ID
+// for RestoreWorkspace. Only the workspace VFS mount is captured, not the
+// guest rootfs. Snapshots share unchanged file data with the live workspace
+// but are held in memory until the sandbox is closed, so every file modified
+// after a snapshot costs its size again.
+func (c *Client) SnapshotWorkspace(ctx context.Context) (string, error) {
+	result, err := c.sendRequestCtx(ctx, "snapshot_workspace", nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var snapshotResult struct {
+		SnapshotID string `json:"snapshot_id"`
+	}
+	if err := json.Unmarshal(result, &snapshotResult); err != nil {
+		return "", errx.Wrap(ErrParseSnapshotResult, err)
+	}
+	return snapshotResult.SnapshotID, nil
+}
+
+// RestoreWorkspace rolls the workspace filesystem back to a snapshot taken
+// with SnapshotWorkspace. The snapshot remains usable afterwards.
+func (c *Client) RestoreWorkspace(ctx context.Context, id string) error {
+	_, err := c.sendRequestCtx(ctx, "restore_workspace", map[string]string{
+		"snapshot_id": id,
+	}, nil)
+	return err
+}
+
+// Snapshot saves a full snapshot of the VM (guest memory, rootfs disk and
+// in-memory workspace) and returns an ID for RestoreFromSnapshot. The guest
+// is paused while the snapshot is taken and then carries on. Snapshots are
+// kept under ~/.matchlock/snapshots and hold the sandbox's secrets, so treat
+// them like credentials. Only the Linux (Firecracker) backend supports it.
+func (c *Client) Snapshot(ctx context.Context) (string, error) {
+	result, err := c.sendRequestCtx(ctx, "snapshot", nil, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var snapshotResult struct {
+		SnapshotID string `json:"snapshot_id"`
+	}
+	if err := json.Unmarshal(result, &snapshotResult); err != nil {
+		return "", errx.Wrap(ErrParseSnapshotResult, err)
+	}
+	return snapshotResult.SnapshotID, nil
+}
+
+// RestoreFromSnapshot creates the client's VM by resuming a snapshot taken
+// with Snapshot, in place of Create, and returns the new VM ID. Running
+// processes and open connections inside the guest pick up where they were.
+// The guest keeps its original IP, so the snapshot's source sandbox must be
+// closed first. Local VFS hooks and event handlers set in CreateOptions are
+// not part of the snapshot and are not installed.
+func (c *Client) RestoreFromSnapshot(ctx context.Context, id string) (string, error) {
+	result, err := c.sendRequestCtx(ctx, "restore_snapshot", map[string]string{
+		"snapshot_id": id,
+	}, nil)
+	if err != nil {
+		return "", c.withStderr(err)
+	}
+
+	var restoreResult struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(result, &restoreResult); err != nil {
+		return "", errx.Wrap(ErrParseCreateResult, err)
+	}
+	c.vmID = restoreResult.ID
+	return c.vmID, nil
+}
+
+// FreezeWorkspace makes the workspace and its mounts read-only to the guest,
+// e.g. so a verification step cannot change what it verifies. Until
+// UnfreezeWorkspace, guest writes fail with EROFS, including writes through
+// files that were already open. WriteFile and RestoreWorkspace from the host
+// keep working.
+func (c *Client) FreezeWorkspace(ctx context.Context) error {
+	_, err := c.sendRequestCtx(ctx, "freeze_workspace", nil, nil)
+	return err
+}
+
+// UnfreezeWorkspace makes the workspace writable to the guest again.
+func (c *Client) UnfreezeWorkspace(ctx context.Context) error {
+	_, err := c.sendRequestCtx(ctx, "unfreeze_workspace", nil, nil)
+	return err
+}
+
+// DiskUsage is the space usage of one sandbox filesystem.
+type DiskUsage = api.DiskUsage
+
+// DiskUsage reports total/used/free bytes for the rootfs and each extra
+// disk, as df would inside the guest, plus the bytes held by the workspace.
+func (c *Client) DiskUsage(ctx context.Context) ([]DiskUsage, error) {
+	result, err := c.sendRequestCtx(ctx, "disk_usage", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var usage struct {
+		Disks []DiskUsage `json:"disks"`
+	}
+	if err := json.Unmarshal(result, &usage); err != nil {
+		return nil, errx.Wrap(ErrParseDiskUsage, err)
+	}
+	return usage.Disks, nil
+}
+
+// Stats is a resource usage sample for the sandbox.
+type Stats = api.Stats
+
+// Stats samples the sandbox's resource usage: guest CPU time, memory in
+// use, running exec sessions and, on backends that report them, the VMM's
+// resident memory and network bytes in and out.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	result, err := c.sendRequestCtx(ctx, "stats", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var stats Stats
+	if err := json.Unmarshal(result, &stats); err != nil {
+		return nil, errx.Wrap(ErrParseStats, err)
+	}
+	return &stats, nil
+}
+
+// GuestEnv returns the environment guest commands run with: image ENV,
+// sandbox env, CA bundle variables and secret placeholders. Secrets show
+// as their placeholders; real secret values are never returned.
+func (c *Client) GuestEnv(ctx context.Context) (map[string]string, error) {
+	result, err := c.sendRequestCtx(ctx, "guest_env", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var guest struct {
+		Env map[string]string `json:"env"`
+	}
+	if err := json.Unmarshal(result, &guest); err != nil {
+		return nil, errx.Wrap(ErrParseGuestEnv, err)
+	}
+	return guest.Env, nil
+}
+
+// CommitOptions configures CommitWithOptions.
+type CommitOptions struct {
+	// WorkspaceDest copies the workspace into the committed image at this
+	// guest path. Empty leaves the workspace out. It cannot be the
+	// workspace path, which is mounted over at boot.
+	WorkspaceDest string
+}
+
+// CommitResult describes an image created by Commit.
+type CommitResult struct {
+	Tag        string `json:"tag"`
+	RootfsPath string `json:"rootfs_path"`
+	Size       int64  `json:"size"`
+}
+
+// Commit saves the sandbox's current rootfs as a new image in the local
+// image cache, like docker commit, so later sandboxes can boot it with
+// Image: tag. The image config the sandbox was created with (entrypoint,
+// env, user, working dir) is recorded with it. The guest is synced first,
+// but the VM keeps running, so files being written during the commit may be
+// captured half-written. Sandboxes created with SharedRootfs cannot be
+// committed.
+func (c *Client) Commit(ctx context.Context, tag string) (*CommitResult, error) {
+	return c.CommitWithOptions(ctx, tag, CommitOptions{})
+}
+
+// CommitWithOptions is Commit with opts.
+func (c *Client) CommitWithOptions(ctx context.Context, tag string, opts CommitOptions) (*CommitResult, error) {
+	params := map[string]string{"tag": tag}
+	if opts.WorkspaceDest != "" {
+		params["workspace_dest"] = opts.WorkspaceDest
+	}
+	result, err := c.sendRequestCtx(ctx, "commit", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	var commitResult CommitResult
+	if err := json.Unmarshal(result, &commitResult); err != nil {
+		return nil, errx.Wrap(ErrParseCommitResult, err)
+	}
+	return &commitResult, nil
+}
+
+// AllowHost adds host (a hostname, IP or glob pattern) to the sandbox's
+// network allowlist until it is closed, releasing connections held by
+// HostApproval. Private IPs stay subject to BlockPrivateIPs.
+func (c *Client) AllowHost(ctx context.Context, host string) error {
+	_, err := c.sendRequestCtx(ctx, "allow_host", map[string]string{"host": host}, nil)
+	return err
+}
+
+// CheckHostAllowed reports whether the sandbox's network policy lets the
+// guest reach host (a hostname, IP or host:port) without making a request.
+// Code inside the guest can ask the same with "guest-agent policy check".
+func (c *Client) CheckHostAllowed(host string) (bool, error) {
+	result, err := c.sendRequest("check_host", map[string]string{"host": host})
+	if err != nil {
+		return false, err
+	}
+
+	var checkResult struct {
+		Allowed bool `json:"allowed"`
+	}
+	if err := json.Unmarshal(result, &checkResult); err != nil {
+		return false, errx.Wrap(ErrParseCheckHostResult, err)
+	}
+	return checkResult.Allowed, nil
+}
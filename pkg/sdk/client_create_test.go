@@ -2,10 +2,14 @@ package sdk
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -15,6 +19,15 @@ import (
 
 func newScriptedClient(t *testing.T, handle func(request) response) (*Client, func()) {
 	t.Helper()
+	return newScriptedStreamClient(t, func(req request) ([]notification, response) {
+		return nil, handle(req)
+	})
+}
+
+// newScriptedStreamClient is like newScriptedClient but lets handle send
+// notifications ahead of each response.
+func newScriptedStreamClient(t *testing.T, handle func(request) ([]notification, response)) (*Client, func()) {
+	t.Helper()
 
 	stdinR, stdinW := io.Pipe()
 	stdoutR, stdoutW := io.Pipe()
@@ -28,7 +41,14 @@ func newScriptedClient(t *testing.T, handle func(request) response) (*Client, fu
 			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
 				continue
 			}
-			resp := handle(req)
+			notifs, resp := handle(req)
+			for _, notif := range notifs {
+				data, err := json.Marshal(notif)
+				if err != nil {
+					continue
+				}
+				_, _ = fmt.Fprintln(stdoutW, string(data))
+			}
 			data, err := json.Marshal(resp)
 			if err != nil {
 				continue
@@ -100,6 +120,162 @@ func TestCreateReturnsVMIDWhenPostCreatePortForwardFails(t *testing.T) {
 	assert.Contains(t, rpcErr.Message, "address already in use")
 }
 
+func TestCreateReportsImageProgress(t *testing.T) {
+	client, cleanup := newScriptedStreamClient(t, func(req request) ([]notification, response) {
+		notifs := []notification{{
+			Method: "create.progress",
+			Params: json.RawMessage(fmt.Sprintf(`{"id":%d,"progress":{"image":"alpine:latest","phase":"download","layers":1,"bytes_done":5,"bytes_total":10}}`, req.ID)),
+		}}
+		return notifs, response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-created"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	var got []ImageProgress
+	vmID, err := client.Create(CreateOptions{
+		Image:        "alpine:latest",
+		ProgressFunc: func(p ImageProgress) { got = append(got, p) },
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "vm-created", vmID)
+	assert.Equal(t, []ImageProgress{{
+		Image:      "alpine:latest",
+		Phase:      api.ImageProgressDownload,
+		Layers:     1,
+		BytesDone:  5,
+		BytesTotal: 10,
+	}}, got)
+}
+
+func TestCreateSendsCgroupParent(t *testing.T) {
+	var resources map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		resources = req.Params.(map[string]interface{})["resources"].(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-created"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(New("alpine:latest").WithCgroupParent("matchlock.slice").Options())
+	require.NoError(t, err)
+	assert.Equal(t, "matchlock.slice", resources["cgroup_parent"])
+
+	_, err = client.Create(CreateOptions{Image: "alpine:latest", CgroupParent: "../escape"})
+	require.ErrorIs(t, err, ErrInvalidCgroupParent)
+	require.ErrorIs(t, err, api.ErrInvalidCgroupParent)
+}
+
+func TestCreateSendsStopGracePeriod(t *testing.T) {
+	var params map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		params = req.Params.(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-created"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(New("alpine:latest").WithStopGracePeriod(30 * time.Second).Options())
+	require.NoError(t, err)
+	assert.Equal(t, float64(30), params["stop_grace_period_seconds"])
+}
+
+func TestCreatePublishAllForwardsExposedPorts(t *testing.T) {
+	var capturedForwards []api.PortForward
+
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		switch req.Method {
+		case "create":
+			return response{
+				JSONRPC: "2.0",
+				Result:  json.RawMessage(`{"id":"vm-publish","exposed_ports":[80,443]}`),
+				ID:      &req.ID,
+			}
+		case "port_forward":
+			data, _ := json.Marshal(req.Params)
+			var params struct {
+				Forwards []api.PortForward `json:"forwards"`
+			}
+			_ = json.Unmarshal(data, &params)
+			capturedForwards = params.Forwards
+			return response{
+				JSONRPC: "2.0",
+				Result:  json.RawMessage(`{"bindings":[{"address":"127.0.0.1","local_port":18080,"remote_port":8080},{"address":"127.0.0.1","local_port":40001,"remote_port":80},{"address":"127.0.0.1","local_port":40002,"remote_port":443}]}`),
+				ID:      &req.ID,
+			}
+		default:
+			return response{
+				JSONRPC: "2.0",
+				Error: &rpcError{
+					Code:    ErrCodeMethodNotFound,
+					Message: "Method not found",
+				},
+				ID: &req.ID,
+			}
+		}
+	})
+	defer cleanup()
+
+	_, err := client.Create(CreateOptions{
+		Image:        "nginx:alpine",
+		PortForwards: []api.PortForward{{LocalPort: 18080, RemotePort: 8080}},
+		PublishAll:   true,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []api.PortForward{
+		{LocalPort: 18080, RemotePort: 8080},
+		{LocalPort: 0, RemotePort: 80},
+		{LocalPort: 0, RemotePort: 443},
+	}, capturedForwards)
+
+	bindings := client.PortBindings()
+	require.Len(t, bindings, 3)
+	assert.Equal(t, 40002, bindings[2].LocalPort)
+	assert.Equal(t, 443, bindings[2].RemotePort)
+}
+
+func TestCreatePortsUseDockerSyntax(t *testing.T) {
+	var capturedForwards []api.PortForward
+
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		switch req.Method {
+		case "create":
+			return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-ports"}`), ID: &req.ID}
+		case "port_forward":
+			data, _ := json.Marshal(req.Params)
+			var params struct {
+				Forwards []api.PortForward `json:"forwards"`
+			}
+			_ = json.Unmarshal(data, &params)
+			capturedForwards = params.Forwards
+			return response{
+				JSONRPC: "2.0",
+				Result:  json.RawMessage(`{"bindings":[{"address":"0.0.0.0","local_port":8080,"remote_port":80},{"address":"127.0.0.1","local_port":40001,"remote_port":443}]}`),
+				ID:      &req.ID,
+			}
+		default:
+			return response{JSONRPC: "2.0", Error: &rpcError{Code: ErrCodeMethodNotFound, Message: "Method not found"}, ID: &req.ID}
+		}
+	})
+	defer cleanup()
+
+	_, err := client.Create(CreateOptions{
+		Image: "nginx:alpine",
+		Ports: []string{"0.0.0.0:8080:80", "443"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []api.PortForward{
+		{Address: "0.0.0.0", LocalPort: 8080, RemotePort: 80},
+		{RemotePort: 443},
+	}, capturedForwards)
+	assert.Len(t, client.PortBindings(), 2)
+}
+
+func TestCreateRejectsInvalidPortSpec(t *testing.T) {
+	client := &Client{}
+	_, err := client.Create(CreateOptions{Image: "nginx:alpine", Ports: []string{"80/udp"}})
+	require.ErrorIs(t, err, ErrParsePortForwards)
+	require.ErrorIs(t, err, api.ErrPortForwardSpecFormat)
+}
+
 func TestCreateSendsNetworkMTU(t *testing.T) {
 	var capturedMTU float64
 	var capturedBlockPrivateIPs bool
@@ -151,6 +327,184 @@ func TestCreateSendsNetworkMTU(t *testing.T) {
 	assert.True(t, capturedBlockPrivateIPs)
 }
 
+func TestBuildCreateNetworkParamsAutoMTUAndClampMSS(t *testing.T) {
+	network := buildCreateNetworkParams(CreateOptions{AutoMTU: true, ClampMSS: true})
+	require.NotNil(t, network)
+	assert.Equal(t, true, network["auto_mtu"])
+	assert.Equal(t, true, network["clamp_mss"])
+	assert.Equal(t, true, network["block_private_ips"])
+
+	network = buildCreateNetworkParams(CreateOptions{AutoMTU: true, NetworkMTU: 1200})
+	assert.Equal(t, 1200, network["mtu"])
+	assert.NotContains(t, network, "auto_mtu", "explicit MTU must win over auto-detection")
+}
+
+func TestBuildCreateNetworkParamsMetadataService(t *testing.T) {
+	network := buildCreateNetworkParams(CreateOptions{MetadataService: true})
+	require.NotNil(t, network)
+	assert.Equal(t, true, network["metadata_service"])
+	assert.Equal(t, true, network["block_private_ips"])
+}
+
+func TestBuildCreateNetworkParamsWaitForNetwork(t *testing.T) {
+	network := buildCreateNetworkParams(CreateOptions{WaitForNetwork: true})
+	require.NotNil(t, network)
+	assert.Equal(t, true, network["wait_for_network"])
+	assert.NotContains(t, network, "network_probe")
+
+	network = buildCreateNetworkParams(CreateOptions{WaitForNetwork: true, NetworkProbe: "example.com:443"})
+	assert.Equal(t, "example.com:443", network["network_probe"])
+
+	network = buildCreateNetworkParams(CreateOptions{NetworkProbe: "example.com:443"})
+	require.NotNil(t, network, "a probe alone implies the wait")
+	assert.Equal(t, true, network["wait_for_network"])
+	assert.Equal(t, "example.com:443", network["network_probe"])
+}
+
+func TestBuildCreateNetworkParamsAllowedUDPHosts(t *testing.T) {
+	network := buildCreateNetworkParams(CreateOptions{AllowedUDPHosts: []string{"9.9.9.9:53"}})
+	require.NotNil(t, network)
+	assert.Equal(t, []string{"9.9.9.9:53"}, network["allowed_udp_hosts"])
+	assert.Equal(t, true, network["block_private_ips"])
+}
+
+func TestCreateRejectsInvalidUDPHost(t *testing.T) {
+	client := &Client{}
+	_, err := client.Create(CreateOptions{Image: "alpine:latest", AllowedUDPHosts: []string{"quic.example.com:0"}})
+	require.ErrorIs(t, err, ErrInvalidUDPHost)
+	require.ErrorIs(t, err, api.ErrInvalidUDPHost)
+}
+
+func TestBuildCreateNetworkParamsConnectionLimits(t *testing.T) {
+	network := buildCreateNetworkParams(CreateOptions{MaxConnectionsPerHost: 8})
+	require.NotNil(t, network)
+	assert.Equal(t, 8, network["max_connections_per_host"])
+	assert.NotContains(t, network, "max_concurrent_connections")
+}
+
+func TestBuildCreateNetworkParamsHostApproval(t *testing.T) {
+	network := buildCreateNetworkParams(CreateOptions{
+		AllowedHosts:               []string{"api.openai.com"},
+		HostApproval:               true,
+		HostApprovalTimeoutSeconds: 120,
+	})
+	require.NotNil(t, network)
+	assert.Equal(t, true, network["host_approval"])
+	assert.Equal(t, 120, network["host_approval_timeout_seconds"])
+}
+
+func TestHostDeniedEventCallsApprovalHook(t *testing.T) {
+	allowed := make(chan string, 1)
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		if req.Method == "allow_host" {
+			allowed <- req.Params.(map[string]interface{})["host"].(string)
+		}
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	asked := make(chan string, 2)
+	client.setHostDeniedHandler(func(host string) bool {
+		asked <- host
+		return host == "pypi.org"
+	})
+	client.handleNotification(notification{Method: "event", Params: json.RawMessage(`{"type":"host_denied","host_denied":{"host":"evil.com"}}`)})
+	client.handleNotification(notification{Method: "event", Params: json.RawMessage(`{"type":"host_denied","host_denied":{"host":"pypi.org"}}`)})
+
+	assert.ElementsMatch(t, []string{"evil.com", "pypi.org"}, []string{<-asked, <-asked})
+	assert.Equal(t, "pypi.org", <-allowed)
+	assert.Empty(t, allowed, "denied hosts must not be allowed")
+}
+
+func TestCreateRejectsNegativeConnectionLimit(t *testing.T) {
+	client := &Client{}
+	_, err := client.Create(CreateOptions{Image: "alpine:latest", MaxConcurrentConnections: -1})
+	require.ErrorIs(t, err, ErrInvalidConnLimit)
+}
+
+func TestCreateRequireSignatureNeedsTrustedKeys(t *testing.T) {
+	client := &Client{}
+	_, err := client.Create(CreateOptions{Image: "alpine:latest", RequireSignature: true})
+	require.ErrorIs(t, err, ErrNoTrustedKeys)
+}
+
+func TestCreateSendsSignaturePolicy(t *testing.T) {
+	var captured map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		captured, _ = req.Params.(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-signed"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	opts := New("ghcr.io/acme/agent:v1").WithRequireSignature("/etc/matchlock/cosign.pub").Options()
+	_, err := client.Create(opts)
+	require.NoError(t, err)
+	assert.Equal(t, true, captured["require_signature"])
+	assert.Equal(t, []interface{}{"/etc/matchlock/cosign.pub"}, captured["trusted_keys"])
+}
+
+func TestCreateSendsSocketMounts(t *testing.T) {
+	var captured map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		captured, _ = req.Params.(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-socket"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(New("alpine:latest").WithSocketMount("/var/run/docker.sock", "/run/user/1000/docker.sock").Options())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"/var/run/docker.sock": "/run/user/1000/docker.sock"}, captured["socket_mounts"])
+}
+
+func TestCreateSendsStaticAddress(t *testing.T) {
+	var captured map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		captured, _ = req.Params.(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-static"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(New("alpine:latest").WithStaticIP("192.168.150.10").WithStaticMAC("02:00:00:00:00:01").Options())
+	require.NoError(t, err)
+	network, ok := captured["network"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "192.168.150.10", network["static_ip"])
+	assert.Equal(t, "02:00:00:00:00:01", network["static_mac"])
+	assert.Equal(t, true, network["block_private_ips"])
+}
+
+func TestCreateSendsSharedBridge(t *testing.T) {
+	var captured map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		captured, _ = req.Params.(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-bridge"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(New("alpine:latest").WithSharedBridge().WithStaticIP("10.99.0.20").Options())
+	require.NoError(t, err)
+	network, ok := captured["network"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, true, network["shared_bridge"])
+	assert.Equal(t, "10.99.0.20", network["static_ip"])
+	assert.Equal(t, true, network["block_private_ips"])
+}
+
+func TestCreateSendsVFSCompression(t *testing.T) {
+	var captured map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		captured, _ = req.Params.(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-compress"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(New("alpine:latest").WithVFSCompression(64 << 10).Options())
+	require.NoError(t, err)
+	vfs, ok := captured["vfs"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, float64(64<<10), vfs["compress_min_bytes"])
+}
+
 func TestCreateSendsAddHosts(t *testing.T) {
 	var capturedAddHosts []map[string]interface{}
 
@@ -338,6 +692,29 @@ func TestCreateOmitsNetworkWhenNoNetworkOverrides(t *testing.T) {
 	assert.False(t, hasNetworkConfig)
 }
 
+func TestCreateReturnsTypedBootError(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		return response{
+			JSONRPC: "2.0",
+			Error: &rpcError{
+				Code:    ErrCodeVMFailed,
+				Message: "VM failed to become ready: guest boot failed (missing_dns): missing matchlock.dns",
+				Data:    json.RawMessage(`{"boot_error":{"code":"missing_dns","message":"missing matchlock.dns"}}`),
+			},
+			ID: &req.ID,
+		}
+	})
+	defer cleanup()
+
+	_, err := client.Create(CreateOptions{Image: "alpine:latest"})
+	require.ErrorIs(t, err, api.ErrBootMissingDNS)
+	require.ErrorIs(t, err, api.ErrBootFailed)
+
+	var bootErr *api.BootError
+	require.ErrorAs(t, err, &bootErr)
+	assert.Equal(t, "missing matchlock.dns", bootErr.Message)
+}
+
 func TestCreateRejectsNegativeNetworkMTU(t *testing.T) {
 	client := &Client{}
 	vmID, err := client.Create(CreateOptions{
@@ -348,6 +725,96 @@ func TestCreateRejectsNegativeNetworkMTU(t *testing.T) {
 	assert.Empty(t, vmID)
 }
 
+func TestCreateSendsCapabilities(t *testing.T) {
+	var capturedParams map[string]interface{}
+
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		if req.Method == "create" {
+			capturedParams, _ = req.Params.(map[string]interface{})
+			return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-caps"}`), ID: &req.ID}
+		}
+		return response{JSONRPC: "2.0", Error: &rpcError{Code: ErrCodeMethodNotFound, Message: "Method not found"}, ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(CreateOptions{
+		Image:   "alpine:latest",
+		CapAdd:  []string{"SYS_PTRACE"},
+		CapDrop: []string{"NET_RAW"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"SYS_PTRACE"}, capturedParams["cap_add"])
+	assert.Equal(t, []interface{}{"NET_RAW"}, capturedParams["cap_drop"])
+	assert.NotContains(t, capturedParams, "allow_syscalls")
+	assert.NotContains(t, capturedParams, "disable_no_new_privs")
+
+	_, err = client.Create(CreateOptions{
+		Image:             "alpine:latest",
+		AllowSyscalls:     []string{"ptrace"},
+		DisableNoNewPrivs: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"ptrace"}, capturedParams["allow_syscalls"])
+	assert.Equal(t, true, capturedParams["disable_no_new_privs"])
+}
+
+func TestCreateSendsKernelPath(t *testing.T) {
+	var capturedParams map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		capturedParams, _ = req.Params.(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-kernel"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(New("alpine:latest").WithKernel("/opt/kernels/vmlinux-6.6").WithKernelModule("/opt/kernels/nf_tables.ko").Options())
+	require.NoError(t, err)
+	assert.Equal(t, "/opt/kernels/vmlinux-6.6", capturedParams["kernel_path"])
+	assert.Equal(t, []interface{}{"/opt/kernels/nf_tables.ko"}, capturedParams["kernel_modules"])
+}
+
+func TestCreateRejectsInvalidAllowSyscall(t *testing.T) {
+	client := &Client{}
+	_, err := client.Create(CreateOptions{
+		Image:         "alpine:latest",
+		AllowSyscalls: []string{"mount"},
+	})
+	require.ErrorIs(t, err, ErrInvalidAllowSyscall)
+	require.ErrorIs(t, err, api.ErrInvalidSyscall)
+}
+
+func TestCreateSendsUlimits(t *testing.T) {
+	var capturedParams map[string]interface{}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		capturedParams, _ = req.Params.(map[string]interface{})
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"id":"vm-ulimit"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Create(New("alpine:latest").WithUlimit("nofile", 1024, 65536).Options())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"nofile": map[string]interface{}{"soft": float64(1024), "hard": float64(65536)},
+	}, capturedParams["ulimits"])
+
+	_, err = (&Client{}).Create(CreateOptions{
+		Image:   "alpine:latest",
+		Ulimits: map[string]api.Ulimit{"nofile": {Soft: 65536, Hard: 1024}},
+	})
+	require.ErrorIs(t, err, ErrInvalidUlimit)
+	require.ErrorIs(t, err, api.ErrInvalidUlimit)
+}
+
+func TestCreateRejectsInvalidCapability(t *testing.T) {
+	client := &Client{}
+	vmID, err := client.Create(CreateOptions{
+		Image:  "alpine:latest",
+		CapAdd: []string{"NOT_A_CAP"},
+	})
+	require.ErrorIs(t, err, ErrInvalidCapability)
+	require.ErrorIs(t, err, api.ErrInvalidCapability)
+	assert.Empty(t, vmID)
+}
+
 func TestCreateRejectsInvalidAddHost(t *testing.T) {
 	client := &Client{}
 	vmID, err := client.Create(CreateOptions{
@@ -359,3 +826,214 @@ func TestCreateRejectsInvalidAddHost(t *testing.T) {
 	require.ErrorIs(t, err, ErrInvalidAddHost)
 	assert.Empty(t, vmID)
 }
+
+func TestSyscallEventsDispatchToHandler(t *testing.T) {
+	var got []api.SyscallEvent
+	client := &Client{}
+	client.setSyscallEventHandler(func(event api.SyscallEvent) {
+		got = append(got, event)
+	})
+
+	client.handleNotification(notification{
+		Method: "event",
+		Params: json.RawMessage(`{"type":"syscall","syscall":{"name":"mount","nr":165,"args":"0x1","pid":7}}`),
+	})
+
+	require.Len(t, got, 1)
+	assert.Equal(t, "mount", got[0].Name)
+	assert.Equal(t, 7, got[0].PID)
+}
+
+func TestCheckHostAllowed(t *testing.T) {
+	var capturedHost string
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		require.Equal(t, "check_host", req.Method)
+		data, _ := json.Marshal(req.Params)
+		var params struct {
+			Host string `json:"host"`
+		}
+		_ = json.Unmarshal(data, &params)
+		capturedHost = params.Host
+		return response{
+			JSONRPC: "2.0",
+			Result:  json.RawMessage(`{"host":"api.openai.com","allowed":true}`),
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+
+	allowed, err := client.CheckHostAllowed("api.openai.com")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, "api.openai.com", capturedHost)
+}
+
+func TestCommit(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		require.Equal(t, "commit", req.Method)
+		params, ok := req.Params.(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, "snap:v1", params["tag"])
+		assert.Equal(t, "/opt/app", params["workspace_dest"])
+		return response{
+			JSONRPC: "2.0",
+			Result:  json.RawMessage(`{"tag":"snap:v1","rootfs_path":"/cache/snap/rootfs.ext4","size":4096}`),
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+
+	result, err := client.CommitWithOptions(context.Background(), "snap:v1", CommitOptions{WorkspaceDest: "/opt/app"})
+	require.NoError(t, err)
+	assert.Equal(t, &CommitResult{Tag: "snap:v1", RootfsPath: "/cache/snap/rootfs.ext4", Size: 4096}, result)
+}
+
+func TestDiskUsage(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		require.Equal(t, "disk_usage", req.Method)
+		return response{
+			JSONRPC: "2.0",
+			Result:  json.RawMessage(`{"disks":[{"path":"/","kind":"rootfs","total_bytes":4096,"used_bytes":1024,"free_bytes":3072},{"path":"/workspace","kind":"workspace","total_bytes":0,"used_bytes":12,"free_bytes":0}]}`),
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+
+	disks, err := client.DiskUsage(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []DiskUsage{
+		{Path: "/", Kind: api.DiskUsageRootfs, TotalBytes: 4096, UsedBytes: 1024, FreeBytes: 3072},
+		{Path: "/workspace", Kind: api.DiskUsageWorkspace, UsedBytes: 12},
+	}, disks)
+}
+
+func TestStats(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		require.Equal(t, "stats", req.Method)
+		return response{
+			JSONRPC: "2.0",
+			Result:  json.RawMessage(`{"cpu_usage_usec":1500,"memory_used_bytes":4096,"memory_total_bytes":8192,"active_execs":2,"vmm_rss_bytes":65536,"net_rx_bytes":10,"net_tx_bytes":20,"time":"2026-01-02T03:04:05Z"}`),
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+
+	stats, err := client.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{
+		CPUUsageUsec:     1500,
+		MemoryUsedBytes:  4096,
+		MemoryTotalBytes: 8192,
+		ActiveExecs:      2,
+		VMMRSSBytes:      65536,
+		NetRxBytes:       10,
+		NetTxBytes:       20,
+		Time:             time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}, stats)
+}
+
+func TestGuestEnv(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		require.Equal(t, "guest_env", req.Method)
+		return response{
+			JSONRPC: "2.0",
+			Result:  json.RawMessage(`{"env":{"PATH":"/usr/bin:/bin","API_KEY":"SANDBOX_SECRET_abc"}}`),
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+
+	env, err := client.GuestEnv(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"PATH": "/usr/bin:/bin", "API_KEY": "SANDBOX_SECRET_abc"}, env)
+}
+
+func TestSnapshotAndRestoreFromSnapshot(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		switch req.Method {
+		case "snapshot":
+			return response{
+				JSONRPC: "2.0",
+				Result:  json.RawMessage(`{"snapshot_id":"snap-0123456789ab"}`),
+				ID:      &req.ID,
+			}
+		case "restore_snapshot":
+			params, ok := req.Params.(map[string]interface{})
+			require.True(t, ok)
+			assert.Equal(t, "snap-0123456789ab", params["snapshot_id"])
+			return response{
+				JSONRPC: "2.0",
+				Result:  json.RawMessage(`{"id":"vm-restored"}`),
+				ID:      &req.ID,
+			}
+		default:
+			return response{
+				JSONRPC: "2.0",
+				Error:   &rpcError{Code: ErrCodeMethodNotFound, Message: "Method not found"},
+				ID:      &req.ID,
+			}
+		}
+	})
+	defer cleanup()
+
+	id, err := client.Snapshot(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "snap-0123456789ab", id)
+
+	vmID, err := client.RestoreFromSnapshot(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, "vm-restored", vmID)
+	assert.Equal(t, "vm-restored", client.VMID())
+}
+
+func TestReadFileRange(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		require.Equal(t, "read_file_range", req.Method)
+		params, ok := req.Params.(map[string]interface{})
+		require.True(t, ok)
+		assert.Equal(t, "/workspace/train.log", params["path"])
+		assert.Equal(t, float64(1<<30), params["offset"])
+		assert.Equal(t, float64(4096), params["length"])
+		return response{
+			JSONRPC: "2.0",
+			Result:  json.RawMessage(fmt.Sprintf(`{"content":%q}`, base64.StdEncoding.EncodeToString([]byte("epoch 9 done\n")))),
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+
+	data, err := client.ReadFileRange(context.Background(), "/workspace/train.log", 1<<30, 4096)
+	require.NoError(t, err)
+	assert.Equal(t, "epoch 9 done\n", string(data))
+
+	_, err = client.ReadFileRange(context.Background(), "/workspace/train.log", -1, 4096)
+	require.ErrorIs(t, err, ErrInvalidReadRange)
+}
+
+func TestReadFileToStreamsChunks(t *testing.T) {
+	content := bytes.Repeat([]byte("checkpoint"), 10*1024)
+	client, cleanup := newScriptedStreamClient(t, func(req request) ([]notification, response) {
+		require.Equal(t, "read_file_stream", req.Method)
+		var notifs []notification
+		for off := 0; off < len(content); off += 32 * 1024 {
+			end := min(off+32*1024, len(content))
+			params, _ := json.Marshal(map[string]interface{}{
+				"id":   req.ID,
+				"data": base64.StdEncoding.EncodeToString(content[off:end]),
+			})
+			notifs = append(notifs, notification{Method: "read_file_stream.data", Params: params})
+		}
+		return notifs, response{
+			JSONRPC: "2.0",
+			Result:  json.RawMessage(fmt.Sprintf(`{"size":%d}`, len(content))),
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+
+	var buf bytes.Buffer
+	n, err := client.ReadFileTo(context.Background(), "/workspace/model.bin", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), n)
+	assert.True(t, bytes.Equal(content, buf.Bytes()))
+}
@@ -0,0 +1,51 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestPortForwardWaitSendsReadinessOptions(t *testing.T) {
+	var captured []api.PortForward
+
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		data, _ := json.Marshal(req.Params)
+		var params struct {
+			Forwards []api.PortForward `json:"forwards"`
+		}
+		_ = json.Unmarshal(data, &params)
+		captured = params.Forwards
+		return response{
+			JSONRPC: "2.0",
+			Result:  json.RawMessage(`{"bindings":[{"address":"127.0.0.1","local_port":18080,"remote_port":8080}]}`),
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+
+	bindings, err := client.PortForwardWait(context.Background(), "18080:8080", 5*time.Second)
+	require.NoError(t, err)
+	require.Len(t, bindings, 1)
+	assert.Equal(t, 18080, bindings[0].LocalPort)
+
+	require.Len(t, captured, 1)
+	assert.True(t, captured[0].WaitForGuestPort)
+	assert.Equal(t, 5000, captured[0].WaitTimeoutMS)
+}
+
+func TestPortForwardWaitRejectsInvalidSpec(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.PortForwardWait(context.Background(), "bad:spec:here", time.Second)
+	require.ErrorIs(t, err, ErrParsePortForwards)
+}
@@ -0,0 +1,152 @@
+package sdk
+
+import (
+	"sort"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// LoadCreateOptions reads a sandbox config file (the same YAML/JSON schema
+// as `matchlock run -f`, see api.ConfigFileVersion) into CreateOptions.
+// ${VAR} references are resolved from the environment as described by
+// api.ConfigFileOptions. Callers can adjust the result, for example to add
+// VFS hook callbacks, before passing it to Client.Create.
+func LoadCreateOptions(path string, opts api.ConfigFileOptions) (CreateOptions, error) {
+	config, err := api.LoadConfigFile(path, opts)
+	if err != nil {
+		return CreateOptions{}, err
+	}
+	return CreateOptionsFromConfig(config)
+}
+
+// CreateOptionsFromConfig converts an api.Config into CreateOptions. It
+// fails for settings CreateOptions cannot express (extra disks, direct
+// mounts, nested overlay layers) rather than dropping them.
+func CreateOptionsFromConfig(config *api.Config) (CreateOptions, error) {
+	if len(config.ExtraDisks) > 0 {
+		return CreateOptions{}, errx.With(ErrUnsupportedConfig, ": extra_disks")
+	}
+
+	opts := CreateOptions{
+		Image:             config.Image,
+		Privileged:        config.Privileged,
+		CapAdd:            config.CapAdd,
+		CapDrop:           config.CapDrop,
+		AllowSyscalls:     config.AllowSyscalls,
+		DisableNoNewPrivs: config.DisableNoNewPrivs,
+		Ulimits:           config.Ulimits,
+		SeccompAudit:      config.SeccompAudit,
+		SharedRootfs:      config.SharedRootfs,
+		SkipRootfsCheck:   config.SkipRootfsCheck,
+		KeepStateOnClose:  config.KeepStateOnClose,
+		StopGracePeriod:   config.GetStopGracePeriod(),
+		KernelPath:        config.KernelPath,
+		KernelModules:     config.KernelModules,
+		InitCommands:      config.InitCommands,
+		SocketMounts:      config.SocketMounts,
+		RequireSignature:  config.RequireSignature,
+		TrustedKeys:       config.TrustedKeys,
+		EventBufferSize:   config.EventBufferSize,
+		Env:               config.Env,
+		Labels:            config.Labels,
+	}
+
+	if r := config.Resources; r != nil {
+		opts.CPUs = r.CPUs
+		opts.MemoryMB = r.MemoryMB
+		opts.SwapMB = r.SwapMB
+		opts.CPUAffinity = r.CPUAffinity
+		opts.CgroupParent = r.CgroupParent
+		opts.DiskSizeMB = r.DiskSizeMB
+		opts.TimeoutSeconds = r.TimeoutSeconds
+	}
+
+	if n := config.Network; n != nil {
+		opts.AllowedHosts = n.AllowedHosts
+		opts.AddHosts = n.AddHosts
+		opts.BlockPrivateIPs = n.BlockPrivateIPs
+		opts.BlockPrivateIPsSet = true
+		opts.AllowedPrivateHosts = n.AllowedPrivateHosts
+		opts.AllowedUDPHosts = n.AllowedUDPHosts
+		opts.DNSServers = n.DNSServers
+		opts.UpstreamDNS = n.UpstreamDNS
+		opts.UpstreamProxy = n.UpstreamProxy
+		opts.SearchDomains = n.SearchDomains
+		opts.ResolvOptions = n.ResolvOptions
+		opts.MirrorRoutes = n.MirrorRoutes
+		opts.Hostname = n.Hostname
+		opts.StaticIP = n.StaticIP
+		opts.StaticMAC = n.StaticMAC
+		opts.NetworkMTU = n.MTU
+		opts.AutoMTU = n.AutoMTU
+		opts.ClampMSS = n.ClampMSS
+		opts.SharedBridge = n.SharedBridge
+		opts.MetadataService = n.MetadataService
+		opts.WaitForNetwork = n.WaitForNetwork
+		opts.NetworkProbe = n.NetworkProbe
+		opts.MaxConcurrentConnections = n.MaxConcurrentConnections
+		opts.MaxConnectionsPerHost = n.MaxConnectionsPerHost
+		opts.HostApproval = n.HostApproval
+		opts.HostApprovalTimeoutSeconds = n.HostApprovalTimeoutSeconds
+
+		names := make([]string, 0, len(n.Secrets))
+		for name := range n.Secrets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			secret := n.Secrets[name]
+			opts.Secrets = append(opts.Secrets, Secret{Name: name, Value: secret.Value, Hosts: secret.Hosts, File: secret.File, FileRaw: secret.FileRaw})
+		}
+	}
+
+	if v := config.VFS; v != nil {
+		if len(v.DirectMounts) > 0 {
+			return CreateOptions{}, errx.With(ErrUnsupportedConfig, ": vfs.direct_mounts")
+		}
+		opts.Workspace = v.Workspace
+		opts.VFSCompressMinBytes = v.CompressMinBytes
+		for guestPath, mount := range v.Mounts {
+			if opts.Mounts == nil {
+				opts.Mounts = make(map[string]MountConfig, len(v.Mounts))
+			}
+			opts.Mounts[guestPath] = mountConfigFromAPI(mount)
+		}
+		if ic := v.Interception; ic != nil {
+			opts.VFSInterception = &VFSInterceptionConfig{EmitEvents: ic.EmitEvents}
+			for _, rule := range ic.Rules {
+				opts.VFSInterception.Rules = append(opts.VFSInterception.Rules, VFSHookRule{
+					Name:      rule.Name,
+					Phase:     rule.Phase,
+					Ops:       rule.Ops,
+					Path:      rule.Path,
+					Action:    rule.Action,
+					TimeoutMS: rule.TimeoutMS,
+				})
+			}
+		}
+	}
+	return opts, nil
+}
+
+func mountConfigFromAPI(mount api.MountConfig) MountConfig {
+	out := MountConfig{
+		Type:     mount.Type,
+		HostPath: mount.HostPath,
+		Readonly: mount.Readonly,
+		HostUID:  mount.HostUID,
+		HostGID:  mount.HostGID,
+		GuestUID: mount.GuestUID,
+		GuestGID: mount.GuestGID,
+	}
+	if mount.Upper != nil {
+		upper := mountConfigFromAPI(*mount.Upper)
+		out.Upper = &upper
+	}
+	if mount.Lower != nil {
+		lower := mountConfigFromAPI(*mount.Lower)
+		out.Lower = &lower
+	}
+	return out
+}
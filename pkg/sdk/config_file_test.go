@@ -0,0 +1,97 @@
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestLoadCreateOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sandbox.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+version: 1
+image: python:3.12-alpine
+resources: {cpus: 2, memory_mb: 1024}
+stop_grace_period_seconds: 20
+network:
+  allowed_hosts: [api.openai.com]
+  secrets:
+    OPENAI_API_KEY: {value: sk-test, hosts: [api.openai.com]}
+vfs:
+  interception:
+    rules:
+      - {phase: before, ops: [write], path: /workspace/.git/*, action: block}
+`), 0644))
+
+	opts, err := LoadCreateOptions(path, api.ConfigFileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "python:3.12-alpine", opts.Image)
+	assert.Equal(t, 2, opts.CPUs)
+	assert.Equal(t, 1024, opts.MemoryMB)
+	assert.Equal(t, 20*time.Second, opts.StopGracePeriod)
+	assert.Equal(t, []string{"api.openai.com"}, opts.AllowedHosts)
+	assert.True(t, opts.BlockPrivateIPsSet)
+	assert.True(t, opts.BlockPrivateIPs)
+	assert.Equal(t, []Secret{{Name: "OPENAI_API_KEY", Value: "sk-test", Hosts: []string{"api.openai.com"}}}, opts.Secrets)
+	require.NotNil(t, opts.VFSInterception)
+	require.Len(t, opts.VFSInterception.Rules, 1)
+	assert.Equal(t, VFSHookActionBlock, opts.VFSInterception.Rules[0].Action)
+}
+
+func TestLoadCreateOptionsLayeredMount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sandbox.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+version: 1
+image: alpine:latest
+vfs:
+  mounts:
+    /workspace/src:
+      type: overlay
+      upper: {type: memory}
+      lower: {type: host_fs, host_path: /srv/src, readonly: true}
+`), 0644))
+
+	opts, err := LoadCreateOptions(path, api.ConfigFileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, MountConfig{
+		Type:  api.MountTypeOverlay,
+		Upper: &MountConfig{Type: api.MountTypeMemory},
+		Lower: &MountConfig{Type: api.MountTypeHostFS, HostPath: "/srv/src", Readonly: true},
+	}, opts.Mounts["/workspace/src"])
+}
+
+func TestLoadCreateOptionsOwnerRemap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sandbox.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+version: 1
+image: alpine:latest
+vfs:
+  mounts:
+    /workspace/data: {type: host_fs, host_path: /srv/data, host_uid: 501, guest_uid: 1000, host_gid: 20, guest_gid: 1000}
+`), 0644))
+
+	opts, err := LoadCreateOptions(path, api.ConfigFileOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, MountConfig{
+		Type:     api.MountTypeHostFS,
+		HostPath: "/srv/data",
+		HostUID:  IDPtr(501),
+		GuestUID: IDPtr(1000),
+		HostGID:  IDPtr(20),
+		GuestGID: IDPtr(1000),
+	}, opts.Mounts["/workspace/data"])
+}
+
+func TestLoadCreateOptionsRejectsUnsupportedSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sandbox.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 1, "image": "alpine:latest", "extra_disks": [{"host_path": "/tmp/d.ext4", "guest_mount": "/data"}]}`), 0644))
+
+	_, err := LoadCreateOptions(path, api.ConfigFileOptions{})
+	assert.ErrorIs(t, err, ErrUnsupportedConfig)
+}
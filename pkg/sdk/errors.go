@@ -20,30 +20,73 @@ var (
 
 // Create / VM errors
 var (
-	ErrImageRequired     = errors.New("image is required (e.g., alpine:latest)")
-	ErrInvalidNetworkMTU = errors.New("network mtu must be > 0")
-	ErrInvalidAddHost    = errors.New("invalid add-host mapping")
-	ErrParseCreateResult = errors.New("parse create result")
-	ErrInvalidVFSHook    = errors.New("invalid vfs hook")
-	ErrVFSHookBlocked    = errors.New("vfs hook blocked operation")
-	ErrParsePortForwards = errors.New("parse port-forward spec")
-	ErrParsePortBindings = errors.New("parse port-forward result")
+	ErrImageRequired       = errors.New("image is required (e.g., alpine:latest)")
+	ErrInvalidNetworkMTU   = errors.New("network mtu must be > 0")
+	ErrInvalidConnLimit    = errors.New("connection limits must not be negative")
+	ErrInvalidHostApproval = errors.New("host approval timeout must not be negative")
+	ErrNoTrustedKeys       = errors.New("require signature needs at least one trusted key")
+	ErrInvalidAddHost      = errors.New("invalid add-host mapping")
+	ErrInvalidSwap         = errors.New("invalid swap size")
+	ErrInvalidCPUSet       = errors.New("invalid CPU affinity")
+	ErrInvalidCgroupParent = errors.New("invalid cgroup parent")
+	ErrInvalidMirrorRule   = errors.New("invalid mirror rule")
+	ErrInvalidNetworkProbe = errors.New("invalid network probe")
+	ErrInvalidUDPHost      = errors.New("invalid UDP allowlist entry")
+	ErrUnsupportedConfig   = errors.New("config setting not supported by CreateOptions")
+	ErrInvalidCapability   = errors.New("invalid capability")
+	ErrInvalidAllowSyscall = errors.New("invalid allow_syscalls entry")
+	ErrInvalidUlimit       = errors.New("invalid ulimit")
+	ErrParseCreateResult   = errors.New("parse create result")
+	ErrInvalidVFSHook      = errors.New("invalid vfs hook")
+	ErrVFSHookBlocked      = errors.New("vfs hook blocked operation")
+	ErrVFSHookTimeout      = errors.New("vfs hook timed out")
+	ErrVFSHookPanic        = errors.New("vfs hook panicked")
+	ErrVFSHookDisabled     = errors.New("vfs hook disabled after repeated failures")
+	ErrParsePortForwards   = errors.New("parse port-forward spec")
+	ErrParsePortBindings   = errors.New("parse port-forward result")
 )
 
 // Exec errors
 var (
 	ErrParseExecResult       = errors.New("parse exec result")
 	ErrParseExecStreamResult = errors.New("parse exec_stream result")
+	ErrParseExecTTYResult    = errors.New("parse exec_tty result")
+	ErrInvalidTTYSize        = errors.New("invalid tty size")
+	ErrExecNotRunning        = errors.New("no running exec with that request ID")
+	ErrCommandFailed         = errors.New("command exited with non-zero status")
+	ErrExecTimeout           = errors.New("command timed out")
 )
 
 // File operation errors
 var (
-	ErrParseReadResult = errors.New("parse read result")
-	ErrParseListResult = errors.New("parse list result")
+	ErrParseReadResult     = errors.New("parse read result")
+	ErrParseListResult     = errors.New("parse list result")
+	ErrParseSnapshotResult = errors.New("parse snapshot result")
+	ErrParseDiskUsage      = errors.New("parse disk_usage result")
+	ErrParseStats          = errors.New("parse stats result")
+	ErrParseCommitResult   = errors.New("parse commit result")
+	ErrParseGuestEnv       = errors.New("parse guest_env result")
+	ErrInvalidReadRange    = errors.New("invalid read range")
+)
+
+// Policy errors
+var (
+	ErrParseCheckHostResult = errors.New("parse check_host result")
+)
+
+// Sync errors
+var (
+	ErrSyncHostDir  = errors.New("sync host directory")
+	ErrSyncGuestDir = errors.New("sync guest directory")
+	ErrSyncWatch    = errors.New("watch host directory")
+	ErrSyncInitial  = errors.New("initial sync")
+	ErrSyncPush     = errors.New("sync host change to guest")
+	ErrSyncPull     = errors.New("sync guest change to host")
 )
 
 // Close / Remove errors
 var (
 	ErrCloseTimeout = errors.New("close timed out, process killed")
 	ErrRemoveVM     = errors.New("matchlock rm")
+	ErrRunCleanup   = errors.New("clean up sandbox after run")
 )
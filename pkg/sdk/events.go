@@ -0,0 +1,108 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// EventType is the kind of a sandbox event, such as api.EventTypeNetwork.
+type EventType = api.EventType
+
+// clientEventTypes are the event types the client's own handlers consume:
+// file events for VFS hooks, seccomp audit records and held hosts.
+var clientEventTypes = []string{
+	string(api.EventTypeFile),
+	string(api.EventTypeSyscall),
+	string(api.EventTypeHostDenied),
+}
+
+// SubscribeFiltered streams the sandbox events whose type is one of types,
+// or every event when types is empty. The filter runs in the matchlock
+// process, so events of other types are never encoded or sent for this
+// subscription. The channel is closed once ctx is cancelled or the client
+// closes; events that arrive while it is full are dropped, so read it
+// promptly. Events emitted before the subscription reaches the server are
+// not delivered.
+func (c *Client) SubscribeFiltered(ctx context.Context, types ...EventType) (<-chan api.Event, error) {
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		if _, err := api.ParseEventType(string(t)); err != nil {
+			return nil, err
+		}
+		names = append(names, string(t))
+	}
+	if err := c.subscribeClientEvents(); err != nil {
+		return nil, err
+	}
+	params := map[string]interface{}{}
+	if len(names) > 0 {
+		params["types"] = names
+	}
+
+	events := make(chan api.Event, api.DefaultEventBufferSize)
+	var mu sync.Mutex
+	closed := false
+	onNotification := func(method string, params json.RawMessage) {
+		var p struct {
+			Event api.Event `json:"event"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case events <- p.Event:
+		default:
+		}
+	}
+
+	id, pending, err := c.startRequest("subscribe_events", params, onNotification)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_, _ = c.awaitRequest(ctx, id, pending)
+		mu.Lock()
+		closed = true
+		close(events)
+		mu.Unlock()
+	}()
+	return events, nil
+}
+
+// subscribeClientEvents moves the client's own event handling onto a
+// subscription of clientEventTypes. The server stops the plain "event"
+// notifications while any subscription is open, so this is opened before
+// the first SubscribeFiltered and kept until Close.
+func (c *Client) subscribeClientEvents() error {
+	var err error
+	c.clientEventsOnce.Do(func() {
+		params := map[string]interface{}{"types": clientEventTypes}
+		var (
+			id      uint64
+			pending *pendingRequest
+		)
+		id, pending, err = c.startRequest("subscribe_events", params, func(method string, params json.RawMessage) {
+			var p struct {
+				Event api.Event `json:"event"`
+			}
+			if json.Unmarshal(params, &p) == nil {
+				c.dispatchEvent(p.Event)
+			}
+		})
+		if err != nil {
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		c.stopClientEvents = cancel
+		go func() { _, _ = c.awaitRequest(ctx, id, pending) }()
+	})
+	return err
+}
@@ -0,0 +1,75 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestSubscribeFiltered(t *testing.T) {
+	subscribed := make(chan request, 2)
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		if req.Method == "subscribe_events" {
+			subscribed <- req
+			// Never answered: the subscription streams until cancelled.
+			return response{JSONRPC: "2.0"}
+		}
+		if req.Method == "cancel" {
+			id := cancelTarget(t, req)
+			return response{JSONRPC: "2.0", Error: &rpcError{Code: ErrCodeCancelled, Message: "context canceled"}, ID: &id}
+		}
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.SubscribeFiltered(context.Background(), EventType("dns"))
+	require.ErrorIs(t, err, api.ErrInvalidEventType)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := client.SubscribeFiltered(ctx, api.EventTypeHostDenied, api.EventTypeNetwork)
+	require.NoError(t, err)
+
+	// The client's own handlers move to a subscription first, since the
+	// server stops plain "event" notifications while one is open.
+	own := <-subscribed
+	params, ok := own.Params.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, []interface{}{"file", "syscall", "host_denied"}, params["types"])
+
+	req := <-subscribed
+	params, ok = req.Params.(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, []interface{}{"host_denied", "network"}, params["types"])
+
+	fileEvents := make(chan api.FileEvent, 1)
+	defer client.subscribeFileEvents(func(e api.FileEvent) { fileEvents <- e })()
+	client.handleNotification(notification{
+		Method: "subscribe_events.event",
+		Params: json.RawMessage(fmt.Sprintf(`{"id":%d,"event":{"type":"file","file":{"op":"write","path":"/workspace/a"}}}`, own.ID)),
+	})
+	assert.Equal(t, "/workspace/a", (<-fileEvents).Path)
+
+	_, err = client.SubscribeFiltered(ctx, api.EventTypeExec)
+	require.NoError(t, err)
+	req2 := <-subscribed
+	assert.NotEqual(t, own.ID, req2.ID, "the client's subscription is opened once")
+
+	client.handleNotification(notification{
+		Method: "subscribe_events.event",
+		Params: json.RawMessage(fmt.Sprintf(`{"id":%d,"event":{"type":"host_denied","host_denied":{"host":"evil.com"}}}`, req.ID)),
+	})
+	event := <-events
+	assert.Equal(t, "host_denied", event.Type)
+	require.NotNil(t, event.HostDenied)
+	assert.Equal(t, "evil.com", event.HostDenied.Host)
+
+	cancel()
+	_, open := <-events
+	assert.False(t, open)
+}
@@ -0,0 +1,214 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cancelTarget returns the request ID a "cancel" request aborts.
+func cancelTarget(t *testing.T, req request) uint64 {
+	t.Helper()
+	params, ok := req.Params.(map[string]interface{})
+	require.True(t, ok)
+	id, ok := params["id"].(float64)
+	require.True(t, ok)
+	return uint64(id)
+}
+
+func TestExecHandleCancelAbortsOnlyThatExec(t *testing.T) {
+	cancels := make(chan uint64, 1)
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		switch req.Method {
+		case "exec_stream":
+			// Never answered: the command runs until cancelled.
+			return response{JSONRPC: "2.0"}
+		case "cancel":
+			cancels <- cancelTarget(t, req)
+		}
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	ctx := context.Background()
+	handle, err := client.StartExecStream(ctx, "sleep 100", "", nil, nil)
+	require.NoError(t, err)
+	require.NotZero(t, handle.ID())
+
+	handle.Cancel()
+	_, err = handle.Wait()
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, handle.ID(), <-cancels)
+	require.NoError(t, ctx.Err())
+}
+
+func TestCancelExecByRequestID(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		switch req.Method {
+		case "exec_stream":
+			return response{JSONRPC: "2.0"}
+		case "cancel":
+			// Answer the aborted exec the way the server does.
+			id := cancelTarget(t, req)
+			return response{JSONRPC: "2.0", Error: &rpcError{Code: ErrCodeExecFailed, Message: "context canceled"}, ID: &id}
+		}
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	handle, err := client.StartExecStream(context.Background(), "sleep 100", "", nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, client.CancelExec(handle.ID()))
+	_, err = handle.Wait()
+	var rpcErr *RPCError
+	require.ErrorAs(t, err, &rpcErr)
+	assert.True(t, rpcErr.IsExecError())
+
+	require.ErrorIs(t, client.CancelExec(handle.ID()), ErrExecNotRunning)
+}
+
+func TestExecWithOptionsSendsLoginShell(t *testing.T) {
+	params := make(chan map[string]interface{}, 2)
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		p, _ := req.Params.(map[string]interface{})
+		params <- p
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"exit_code":0}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.ExecWithOptions(context.Background(), "conda list", ExecOptions{WorkingDir: "/app", LoginShell: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"command": "conda list", "working_dir": "/app", "login_shell": true}, <-params)
+
+	_, err = client.ExecStreamWithOptions(context.Background(), "conda list", ExecOptions{}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"command": "conda list"}, <-params)
+}
+
+func TestExecWithOptionsSendsShellAndArgs(t *testing.T) {
+	params := make(chan map[string]interface{}, 3)
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		p, _ := req.Params.(map[string]interface{})
+		params <- p
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"exit_code":0}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.ExecWithOptions(context.Background(), "echo $0", ExecOptions{Shell: []string{"bash", "-c"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"command": "echo $0", "shell": []interface{}{"bash", "-c"}}, <-params)
+
+	_, err = client.ExecWithOptions(context.Background(), "", ExecOptions{Args: []string{"/app/server", "--help"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"command": "", "args": []interface{}{"/app/server", "--help"}}, <-params)
+
+	_, err = client.ExecWithOptions(context.Background(), "/app/server", ExecOptions{NoShell: true})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"command": "/app/server", "args": []interface{}{"/app/server"}}, <-params)
+}
+
+func TestExecWithOptionsEnv(t *testing.T) {
+	params := make(chan map[string]interface{}, 2)
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		p, _ := req.Params.(map[string]interface{})
+		params <- p
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"exit_code":0}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.ExecWithOptions(context.Background(), "env", ExecOptions{Env: map[string]string{"DEBUG": "1"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"DEBUG": "1"}, (<-params)["env"])
+
+	_, err = client.ExecWithOptions(context.Background(), "env", ExecOptions{})
+	require.NoError(t, err)
+	assert.NotContains(t, <-params, "env")
+}
+
+func TestExecWithOptionsTimeout(t *testing.T) {
+	params := make(chan map[string]interface{}, 2)
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		p, _ := req.Params.(map[string]interface{})
+		params <- p
+		result := `{"exit_code":124,"stdout":"cGFydGlhbAo=","timed_out":true}` // "partial\n"
+		return response{JSONRPC: "2.0", Result: json.RawMessage(result), ID: &req.ID}
+	})
+	defer cleanup()
+
+	result, err := client.ExecWithOptions(context.Background(), "sleep 60", ExecOptions{TimeoutMS: 500})
+	require.ErrorIs(t, err, ErrExecTimeout)
+	assert.NotErrorIs(t, err, context.Canceled)
+	require.NotNil(t, result)
+	assert.True(t, result.TimedOut)
+	assert.Equal(t, 124, result.ExitCode)
+	assert.Equal(t, "partial\n", result.Stdout)
+	assert.Equal(t, float64(500), (<-params)["timeout_ms"])
+
+	streamResult, err := client.ExecStreamWithOptions(context.Background(), "sleep 60", ExecOptions{TimeoutMS: 500}, nil, nil)
+	require.ErrorIs(t, err, ErrExecTimeout)
+	require.NotNil(t, streamResult)
+	assert.True(t, streamResult.TimedOut)
+	assert.Equal(t, float64(500), (<-params)["timeout_ms"])
+}
+
+func TestExecCheckAndMustExec(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		p, _ := req.Params.(map[string]interface{})
+		result := `{"exit_code":0,"stdout":"aGVsbG8K","user_time_ms":12,"sys_time_ms":3,"max_rss_kb":2048}` // "hello\n"
+		if p["command"] == "false" {
+			result = `{"exit_code":2,"stdout":"cGFydGlhbAo=","stderr":"Ym9vbQo="}` // "partial\n", "boom\n"
+		}
+		return response{JSONRPC: "2.0", Result: json.RawMessage(result), ID: &req.ID}
+	})
+	defer cleanup()
+	ctx := context.Background()
+
+	result, err := client.ExecCheck(ctx, "echo hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", result.Stdout)
+	assert.Equal(t, int64(12), result.UserTimeMS)
+	assert.Equal(t, int64(3), result.SysTimeMS)
+	assert.Equal(t, int64(2048), result.MaxRSSKB)
+	assert.Equal(t, "hello\n", client.MustExec(ctx, "echo hello"))
+
+	result, err = client.ExecCheck(ctx, "false")
+	require.ErrorIs(t, err, ErrCommandFailed)
+	var execErr *ExecError
+	require.ErrorAs(t, err, &execErr)
+	assert.Equal(t, 2, execErr.Result.ExitCode)
+	assert.Equal(t, "partial\n", result.Stdout)
+	assert.Equal(t, `command "false" exited with code 2: boom`, err.Error())
+
+	assert.PanicsWithError(t, err.Error(), func() { client.MustExec(ctx, "false") })
+}
+
+func TestExecBytesReturnsRawOutput(t *testing.T) {
+	binary := []byte{0x1f, 0x8b, 0x00, 0xff, 0xfe, '\n'}
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		result := fmt.Sprintf(`{"exit_code":3,"stdout":%q,"stderr":"d2Fybgo="}`, base64.StdEncoding.EncodeToString(binary)) // stderr "warn\n"
+		return response{JSONRPC: "2.0", Result: json.RawMessage(result), ID: &req.ID}
+	})
+	defer cleanup()
+
+	stdout, stderr, exitCode, err := client.ExecBytes(context.Background(), "tar -cz -C /data .")
+	require.NoError(t, err)
+	assert.Equal(t, binary, stdout)
+	assert.Equal(t, []byte("warn\n"), stderr)
+	assert.Equal(t, 3, exitCode)
+}
+
+func TestExecRejectsMalformedOutput(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{"exit_code":0,"stdout":"not base64!"}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	_, err := client.Exec(context.Background(), "echo hi")
+	assert.ErrorIs(t, err, ErrParseExecResult)
+}
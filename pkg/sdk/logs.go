@@ -0,0 +1,55 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// LogOptions configures Logs.
+type LogOptions struct {
+	// Sources limits output to these sources; empty means all of them.
+	Sources []api.LogSource
+	// Follow keeps streaming new lines until ctx is cancelled.
+	Follow bool
+	// Since starts at this byte offset of the log, or this many bytes
+	// before its end when negative.
+	Since int64
+	// OnLine receives each log line in order.
+	OnLine func(api.LogLine)
+}
+
+// Logs streams the VM console log, which carries kernel output and the
+// diagnostics printed by guest init, the guest agent and the FUSE daemon.
+// Without Follow it returns once the current log has been sent; with Follow
+// it streams until ctx is cancelled, which is not reported as an error.
+func (c *Client) Logs(ctx context.Context, opts LogOptions) error {
+	params := map[string]interface{}{}
+	if len(opts.Sources) > 0 {
+		params["sources"] = opts.Sources
+	}
+	if opts.Follow {
+		params["follow"] = true
+	}
+	if opts.Since != 0 {
+		params["since"] = opts.Since
+	}
+
+	onNotification := func(method string, params json.RawMessage) {
+		if opts.OnLine == nil {
+			return
+		}
+		var line api.LogLine
+		if err := json.Unmarshal(params, &line); err != nil {
+			return
+		}
+		opts.OnLine(line)
+	}
+
+	_, err := c.sendRequestCtx(ctx, "logs", params, onNotification)
+	if err != nil && opts.Follow && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
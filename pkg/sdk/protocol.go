@@ -3,7 +3,9 @@ package sdk
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 
 	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/api"
@@ -31,8 +33,9 @@ type notification struct {
 }
 
 type rpcError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
 }
 
 // Error codes
@@ -52,10 +55,46 @@ const (
 type RPCError struct {
 	Code    int
 	Message string
+	// BootError is set when VM creation failed because guest-init reported a
+	// boot failure. RPCError unwraps to it, so errors.Is matches
+	// api.ErrBootFailed and the code's api.ErrBoot* sentinel.
+	BootError *api.BootError
+	// Stderr is the tail of the RPC process's stderr, set on errors from
+	// Create.
+	Stderr string
+	// NotFound is set when a file operation failed because the guest path
+	// does not exist; errors.Is then matches fs.ErrNotExist.
+	NotFound bool
 }
 
 func (e *RPCError) Error() string {
-	return fmt.Sprintf("matchlock RPC error [%d]: %s", e.Code, e.Message)
+	return fmt.Sprintf("matchlock RPC error [%d]: %s", e.Code, e.Message) + stderrSuffix(e.Stderr)
+}
+
+func (e *RPCError) Is(target error) bool {
+	return target == fs.ErrNotExist && e.NotFound
+}
+
+func (e *RPCError) Unwrap() error {
+	if e.BootError == nil {
+		return nil
+	}
+	return e.BootError
+}
+
+func newRPCError(e *rpcError) *RPCError {
+	rpcErr := &RPCError{Code: e.Code, Message: e.Message}
+	if len(e.Data) > 0 {
+		var data struct {
+			BootError *api.BootError `json:"boot_error"`
+			NotFound  bool           `json:"not_found"`
+		}
+		if json.Unmarshal(e.Data, &data) == nil {
+			rpcErr.BootError = data.BootError
+			rpcErr.NotFound = data.NotFound
+		}
+	}
+	return rpcErr
 }
 
 // IsVMError returns true if the error is a VM-related error
@@ -77,7 +116,7 @@ func (e *RPCError) IsFileError() bool {
 type pendingRequest struct {
 	ch chan pendingResult
 	// onNotification is called for streaming notifications matching this request ID.
-	// It is only set for exec_stream requests.
+	// It is only set for exec_stream and exec_tty requests.
 	onNotification func(method string, params json.RawMessage)
 }
 
@@ -98,6 +137,16 @@ func (c *Client) sendRequest(method string, params interface{}) (json.RawMessage
 // If onNotification is non-nil, it is called for each streaming notification
 // matching this request's ID before the final response arrives.
 func (c *Client) sendRequestCtx(ctx context.Context, method string, params interface{}, onNotification func(string, json.RawMessage)) (json.RawMessage, error) {
+	id, pending, err := c.startRequest(method, params, onNotification)
+	if err != nil {
+		return nil, err
+	}
+	return c.awaitRequest(ctx, id, pending)
+}
+
+// startRequest registers a pending request and writes it to the server
+// without waiting for the response. Callers must follow up with awaitRequest.
+func (c *Client) startRequest(method string, params interface{}, onNotification func(string, json.RawMessage)) (uint64, *pendingRequest, error) {
 	c.readerOnce.Do(c.startReader)
 
 	id := c.requestID.Add(1)
@@ -110,17 +159,11 @@ func (c *Client) sendRequestCtx(ctx context.Context, method string, params inter
 	c.pendingMu.Lock()
 	if c.pending == nil {
 		c.pendingMu.Unlock()
-		return nil, ErrClientClosed
+		return 0, nil, ErrClientClosed
 	}
 	c.pending[id] = pending
 	c.pendingMu.Unlock()
 
-	defer func() {
-		c.pendingMu.Lock()
-		delete(c.pending, id)
-		c.pendingMu.Unlock()
-	}()
-
 	req := request{
 		JSONRPC: "2.0",
 		Method:  method,
@@ -130,15 +173,23 @@ func (c *Client) sendRequestCtx(ctx context.Context, method string, params inter
 
 	data, err := json.Marshal(req)
 	if err != nil {
-		return nil, errx.Wrap(ErrMarshalRequest, err)
+		c.forgetRequest(id)
+		return 0, nil, errx.Wrap(ErrMarshalRequest, err)
 	}
 
 	c.writeMu.Lock()
 	_, writeErr := fmt.Fprintln(c.stdin, string(data))
 	c.writeMu.Unlock()
 	if writeErr != nil {
-		return nil, errx.Wrap(ErrWriteRequest, writeErr)
+		c.forgetRequest(id)
+		return 0, nil, errx.Wrap(ErrWriteRequest, writeErr)
 	}
+	return id, pending, nil
+}
+
+// awaitRequest waits for the response to a request sent by startRequest.
+func (c *Client) awaitRequest(ctx context.Context, id uint64, pending *pendingRequest) (json.RawMessage, error) {
+	defer c.forgetRequest(id)
 
 	select {
 	case result := <-pending.ch:
@@ -149,6 +200,12 @@ func (c *Client) sendRequestCtx(ctx context.Context, method string, params inter
 	}
 }
 
+func (c *Client) forgetRequest(id uint64) {
+	c.pendingMu.Lock()
+	delete(c.pending, id)
+	c.pendingMu.Unlock()
+}
+
 // sendCancelRequest sends a fire-and-forget "cancel" RPC to abort an in-flight request.
 func (c *Client) sendCancelRequest(targetID uint64) {
 	cancelID := c.requestID.Add(1)
@@ -172,9 +229,11 @@ func (c *Client) startReader() {
 		for {
 			line, err := c.stdout.ReadBytes('\n')
 			if err != nil {
+				c.stderr.waitDrained()
+				closeErr := errx.With(ErrConnectionClose, ": %w%s", err, stderrSuffix(c.stderr.String()))
 				c.pendingMu.Lock()
 				for _, p := range c.pending {
-					p.ch <- pendingResult{err: errx.Wrap(ErrConnectionClose, err)}
+					p.ch <- pendingResult{err: closeErr}
 				}
 				c.pending = nil
 				c.pendingMu.Unlock()
@@ -205,10 +264,7 @@ func (c *Client) startReader() {
 			}
 
 			if resp.Error != nil {
-				p.ch <- pendingResult{err: &RPCError{
-					Code:    resp.Error.Code,
-					Message: resp.Error.Message,
-				}}
+				p.ch <- pendingResult{err: newRPCError(resp.Error)}
 			} else {
 				p.ch <- pendingResult{result: resp.Result}
 			}
@@ -216,12 +272,24 @@ func (c *Client) startReader() {
 	}()
 }
 
+// withStderr attaches the RPC process's recent stderr to an RPCError.
+func (c *Client) withStderr(err error) error {
+	var rpcErr *RPCError
+	if !errors.As(err, &rpcErr) {
+		return err
+	}
+	withStderr := *rpcErr
+	withStderr.Stderr = c.stderr.String()
+	return &withStderr
+}
+
 // handleNotification routes JSON-RPC notifications. Stream notifications
-// (exec_stream.stdout, exec_stream.stderr) include a request ID in params
-// and are forwarded to the matching pending request's callback.
+// (exec_stream.stdout, exec_stream.stderr, exec_tty.stdout, logs.line, tail_file.data,
+// read_file_stream.data, subscribe_events.event, create.progress) include a request ID
+// in params and are forwarded to the matching pending request's callback.
 func (c *Client) handleNotification(notif notification) {
 	switch notif.Method {
-	case "exec_stream.stdout", "exec_stream.stderr":
+	case "exec_stream.stdout", "exec_stream.stderr", "exec_tty.stdout", "logs.line", "tail_file.data", "read_file_stream.data", "subscribe_events.event", "create.progress":
 		var p struct {
 			ID *uint64 `json:"id"`
 		}
@@ -234,14 +302,50 @@ func (c *Client) handleNotification(notif notification) {
 		if ok && pending.onNotification != nil {
 			pending.onNotification(notif.Method, notif.Params)
 		}
+	case "vfs_hook.decide":
+		var p struct {
+			DecisionID uint64 `json:"decision_id"`
+			api.VFSHookDecisionRequest
+		}
+		if err := json.Unmarshal(notif.Params, &p); err != nil {
+			return
+		}
+		// The callback may call back into the sandbox; never run it on the
+		// reader goroutine.
+		go c.answerVFSHookDecision(p.DecisionID, p.VFSHookDecisionRequest)
+	case "vfs_hook.mutate":
+		var p struct {
+			MutationID uint64 `json:"mutation_id"`
+			api.VFSHookMutateRequest
+		}
+		if err := json.Unmarshal(notif.Params, &p); err != nil {
+			return
+		}
+		go c.answerVFSHookMutation(p.MutationID, p.VFSHookMutateRequest)
 	case "event":
 		var event api.Event
 		if err := json.Unmarshal(notif.Params, &event); err != nil {
 			return
 		}
-		if event.File == nil {
-			return
-		}
-		c.handleVFSFileEvent(event.File.Op, event.File.Path, event.File.Size, event.File.Mode, event.File.UID, event.File.GID)
+		c.dispatchEvent(event)
+	}
+}
+
+// dispatchEvent hands a sandbox event to the client's own handlers, whether
+// it arrived as a plain "event" notification or on the client's
+// subscription (see subscribeClientEvents).
+func (c *Client) dispatchEvent(event api.Event) {
+	if event.Syscall != nil {
+		c.dispatchSyscallEvent(*event.Syscall)
+		return
+	}
+	if event.HostDenied != nil {
+		c.dispatchHostDenied(*event.HostDenied)
+		return
+	}
+	if event.File == nil {
+		return
 	}
+	c.dispatchFileEvent(*event.File)
+	c.handleVFSFileEvent(event.File.Op, event.File.Path, event.File.Size, event.File.Mode, event.File.UID, event.File.GID)
 }
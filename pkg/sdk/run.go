@@ -0,0 +1,53 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// Run is the one-shot form of NewClient, Create, Exec, Close and Remove: it
+// starts a sandbox from opts using DefaultConfig, runs command in it and
+// tears the sandbox down again, returning the command's result. A non-zero
+// exit code is reported in the result, not as an error.
+//
+// Cleanup always runs, including when Create or Exec fails, ctx is
+// cancelled (which also aborts a Create in progress) or the caller panics.
+func Run(ctx context.Context, opts CreateOptions, command string) (*ExecResult, error) {
+	return RunWithConfig(ctx, DefaultConfig(), opts, command)
+}
+
+// RunWithConfig is Run with an explicit client Config, e.g. to point at a
+// specific matchlock binary.
+func RunWithConfig(ctx context.Context, cfg Config, opts CreateOptions, command string) (result *ExecResult, err error) {
+	client, err := NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create takes no context, so cancelling ctx closes the client, which
+	// fails any request still in flight.
+	cancelled := make(chan error, 1)
+	stop := context.AfterFunc(ctx, func() { cancelled <- client.Close(0) })
+	defer func() {
+		var closeErr error
+		if stop() {
+			closeErr = client.Close(0)
+		} else {
+			closeErr = <-cancelled
+		}
+		cleanupErr := errors.Join(closeErr, client.Remove())
+		if err == nil && cleanupErr != nil {
+			err = errx.Wrap(ErrRunCleanup, cleanupErr)
+		}
+	}()
+
+	if _, err := client.Create(opts); err != nil {
+		if ctx.Err() != nil {
+			return nil, errx.Wrap(ctx.Err(), err)
+		}
+		return nil, err
+	}
+	return client.Exec(ctx, command)
+}
@@ -0,0 +1,114 @@
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runHelperEnv makes the test binary act as a fake matchlock CLI (see
+// TestRunHelperProcess), recording what it was asked to do in that dir.
+const runHelperEnv = "MATCHLOCK_SDK_RUN_HELPER"
+
+func TestRunHelperProcess(t *testing.T) {
+	dir := os.Getenv(runHelperEnv)
+	if dir == "" {
+		return
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	switch args[0] {
+	case "rm":
+		_ = os.WriteFile(filepath.Join(dir, "removed"), []byte(args[1]), 0644)
+	case "rpc":
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			var req struct {
+				Method string                 `json:"method"`
+				Params map[string]interface{} `json:"params"`
+				ID     uint64                 `json:"id"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &req) != nil {
+				continue
+			}
+			result := `{}`
+			switch req.Method {
+			case "create":
+				if req.Params["image"] == "bad:latest" {
+					fmt.Printf(`{"jsonrpc":"2.0","error":{"code":-32000,"message":"pull failed"},"id":%d}`+"\n", req.ID)
+					continue
+				}
+				result = `{"id":"vm-run"}`
+			case "exec":
+				if req.Params["command"] == "sleep" {
+					continue
+				}
+				result = `{"exit_code":3,"stdout":"aGkK","stderr":""}`
+			case "close":
+				_ = os.WriteFile(filepath.Join(dir, "closed"), nil, 0644)
+			}
+			fmt.Printf(`{"jsonrpc":"2.0","result":%s,"id":%d}`+"\n", result, req.ID)
+		}
+	}
+	os.Exit(0)
+}
+
+// fakeMatchlock returns a Config whose binary is this test binary running
+// TestRunHelperProcess, and the dir it records into.
+func fakeMatchlock(t *testing.T) (Config, string) {
+	t.Helper()
+	dir := t.TempDir()
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	script := filepath.Join(dir, "matchlock")
+	require.NoError(t, os.WriteFile(script, []byte(fmt.Sprintf(
+		"#!/bin/sh\n%s=%q exec %q -test.run='^TestRunHelperProcess$' -- \"$@\"\n", runHelperEnv, dir, exe)), 0755))
+	return Config{BinaryPath: script}, dir
+}
+
+func TestRunWithConfig(t *testing.T) {
+	cfg, dir := fakeMatchlock(t)
+
+	result, err := RunWithConfig(context.Background(), cfg, CreateOptions{Image: "alpine:latest"}, "echo hi")
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, "hi\n", result.Stdout)
+
+	assert.FileExists(t, filepath.Join(dir, "closed"))
+	removed, err := os.ReadFile(filepath.Join(dir, "removed"))
+	require.NoError(t, err)
+	assert.Equal(t, "vm-run", string(removed))
+}
+
+func TestRunWithConfigCleansUpAfterCreateFailure(t *testing.T) {
+	cfg, dir := fakeMatchlock(t)
+
+	_, err := RunWithConfig(context.Background(), cfg, CreateOptions{Image: "bad:latest"}, "echo hi")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pull failed")
+	assert.FileExists(t, filepath.Join(dir, "closed"))
+	assert.NoFileExists(t, filepath.Join(dir, "removed"), "no VM was created")
+}
+
+func TestRunWithConfigCleansUpOnCancel(t *testing.T) {
+	cfg, dir := fakeMatchlock(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err := RunWithConfig(ctx, cfg, CreateOptions{Image: "alpine:latest"}, "sleep")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.FileExists(t, filepath.Join(dir, "removed"))
+}
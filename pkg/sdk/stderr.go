@@ -0,0 +1,80 @@
+package sdk
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// stderrTailSize bounds how much of the RPC process's stderr is kept
+	// for attaching to errors.
+	stderrTailSize = 16 << 10
+	// stderrDrainWait bounds how long a connection-closed error waits for
+	// the exiting process's last stderr output.
+	stderrDrainWait = time.Second
+)
+
+// stderrTail records the last stderrTailSize bytes of the RPC process's
+// stderr and forwards everything to an optional caller writer. Forwarding
+// errors are ignored so a failing writer never blocks the process.
+type stderrTail struct {
+	forward io.Writer
+	done    chan struct{} // closed once stderr reaches EOF
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+func newStderrTail(forward io.Writer) *stderrTail {
+	return &stderrTail{forward: forward, done: make(chan struct{})}
+}
+
+// drain copies r into the tail until EOF.
+func (t *stderrTail) drain(r io.Reader) {
+	defer close(t.done)
+	io.Copy(t, r)
+}
+
+func (t *stderrTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > stderrTailSize {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-stderrTailSize:]...)
+	}
+	t.mu.Unlock()
+
+	if t.forward != nil {
+		t.forward.Write(p)
+	}
+	return len(p), nil
+}
+
+func (t *stderrTail) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.TrimSpace(string(t.buf))
+}
+
+// waitDrained waits up to stderrDrainWait for stderr to reach EOF.
+func (t *stderrTail) waitDrained() {
+	if t == nil {
+		return
+	}
+	select {
+	case <-t.done:
+	case <-time.After(stderrDrainWait):
+	}
+}
+
+// stderrSuffix formats a stderr tail for appending to an error message.
+func stderrSuffix(stderr string) string {
+	if stderr == "" {
+		return ""
+	}
+	return "\nmatchlock rpc stderr:\n" + stderr
+}
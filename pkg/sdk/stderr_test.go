@@ -0,0 +1,81 @@
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) { return 0, errors.New("broken") }
+
+func TestStderrTailKeepsLastBytesAndForwards(t *testing.T) {
+	var forwarded bytes.Buffer
+	tail := newStderrTail(&forwarded)
+	tail.drain(strings.NewReader(strings.Repeat("a", stderrTailSize) + "boot failed\n"))
+
+	assert.Equal(t, strings.Repeat("a", stderrTailSize)+"boot failed\n", forwarded.String())
+	assert.Len(t, tail.buf, stderrTailSize)
+	assert.True(t, strings.HasSuffix(tail.String(), "boot failed"))
+}
+
+func TestStderrTailIgnoresForwardErrors(t *testing.T) {
+	tail := newStderrTail(failingWriter{})
+	n, err := tail.Write([]byte("kernel panic"))
+	require.NoError(t, err)
+	assert.Equal(t, 12, n)
+	assert.Equal(t, "kernel panic", tail.String())
+}
+
+func TestCreateErrorIncludesStderr(t *testing.T) {
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		return response{
+			JSONRPC: "2.0",
+			Error:   &rpcError{Code: ErrCodeVMFailed, Message: "create failed"},
+			ID:      &req.ID,
+		}
+	})
+	defer cleanup()
+	client.stderr = newStderrTail(nil)
+	client.stderr.Write([]byte("firecracker: /dev/kvm: permission denied\n"))
+
+	_, err := client.Create(CreateOptions{Image: "alpine:latest"})
+	require.Error(t, err)
+	var rpcErr *RPCError
+	require.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, "firecracker: /dev/kvm: permission denied", rpcErr.Stderr)
+	assert.Contains(t, err.Error(), "create failed")
+	assert.Contains(t, err.Error(), "/dev/kvm: permission denied")
+}
+
+func TestConnectionCloseErrorIncludesStderr(t *testing.T) {
+	stdinR, stdinW := io.Pipe()
+	go io.Copy(io.Discard, stdinR)
+	defer stdinW.Close()
+	stdoutR, stdoutW := io.Pipe()
+
+	client := &Client{
+		stdin:   stdinW,
+		stdout:  bufio.NewReader(stdoutR),
+		stderr:  newStderrTail(nil),
+		pending: make(map[uint64]*pendingRequest),
+	}
+	client.stderr.Write([]byte("panic: runtime error\n"))
+	close(client.stderr.done)
+
+	id, pending, err := client.startRequest("exec", nil, nil)
+	require.NoError(t, err)
+	stdoutW.Close()
+
+	_, err = client.awaitRequest(context.Background(), id, pending)
+	require.ErrorIs(t, err, ErrConnectionClose)
+	assert.Contains(t, err.Error(), "panic: runtime error")
+}
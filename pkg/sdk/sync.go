@@ -0,0 +1,521 @@
+package sdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// defaultSyncDebounce coalesces bursts of change events for the same path.
+const defaultSyncDebounce = 100 * time.Millisecond
+
+// SyncOptions configures Client.SyncWithOptions.
+type SyncOptions struct {
+	// Ignore lists glob patterns (path.Match syntax) for paths that are never
+	// synced. A pattern matches if it matches the slash-separated path
+	// relative to the sync root or any single path component, so ".git"
+	// ignores every .git directory and "build/*.o" ignores object files
+	// directly under build/.
+	Ignore []string
+	// Debounce is how long a path must be quiet before it is synced
+	// (default: 100ms).
+	Debounce time.Duration
+	// OnError, if set, receives errors from background sync operations.
+	// Sync is best-effort: failed paths are retried on their next change.
+	OnError func(error)
+}
+
+type syncDirection int
+
+const (
+	syncToGuest syncDirection = iota
+	syncToHost
+)
+
+type syncKey struct {
+	dir syncDirection
+	rel string
+}
+
+type syncSession struct {
+	client   *Client
+	hostDir  string
+	guestDir string
+	opts     SyncOptions
+	// root confines pulls to hostDir: the guest picks the paths, and host
+	// symlinks under hostDir must not let it write or delete outside.
+	root *os.Root
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	watcher *fsnotify.Watcher
+	wg      sync.WaitGroup
+
+	mu      sync.Mutex
+	pending map[syncKey]time.Time
+	// synced records the content hash last seen on both sides for each
+	// relative file path. It suppresses echo events caused by our own writes.
+	synced map[string]string
+}
+
+// Sync keeps hostDir and guestDir in sync until the returned stop function is
+// called or ctx is cancelled. See SyncWithOptions.
+func (c *Client) Sync(ctx context.Context, hostDir, guestDir string) (func(), error) {
+	return c.SyncWithOptions(ctx, hostDir, guestDir, SyncOptions{})
+}
+
+// SyncWithOptions performs an initial host-to-guest copy of hostDir, pulls
+// guest-only files back to the host, then keeps both sides in sync:
+//
+//   - host changes are detected with fsnotify and pushed via write_file;
+//   - guest changes are detected from VFS file events and pulled via read_file.
+//
+// Conflicts are resolved last-writer-wins: each side's change is applied as
+// it is observed, so the most recent write to a path overwrites the other
+// side. Guest-to-host sync requires VFS file events, which are only emitted
+// when the sandbox was created with VFSInterception.EmitEvents (or any
+// after-hook callback) enabled.
+func (c *Client) SyncWithOptions(ctx context.Context, hostDir, guestDir string, opts SyncOptions) (func(), error) {
+	absHost, err := filepath.Abs(hostDir)
+	if err != nil {
+		return nil, errx.Wrap(ErrSyncHostDir, err)
+	}
+	info, err := os.Stat(absHost)
+	if err != nil {
+		return nil, errx.Wrap(ErrSyncHostDir, err)
+	}
+	if !info.IsDir() {
+		return nil, errx.With(ErrSyncHostDir, ": %s is not a directory", absHost)
+	}
+	if !path.IsAbs(guestDir) {
+		return nil, errx.With(ErrSyncGuestDir, ": %q must be absolute", guestDir)
+	}
+	if opts.Debounce <= 0 {
+		opts.Debounce = defaultSyncDebounce
+	}
+
+	root, err := os.OpenRoot(absHost)
+	if err != nil {
+		return nil, errx.Wrap(ErrSyncHostDir, err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		root.Close()
+		return nil, errx.Wrap(ErrSyncWatch, err)
+	}
+
+	syncCtx, cancel := context.WithCancel(ctx)
+	s := &syncSession{
+		client:   c,
+		hostDir:  absHost,
+		guestDir: path.Clean(guestDir),
+		opts:     opts,
+		root:     root,
+		ctx:      syncCtx,
+		cancel:   cancel,
+		watcher:  watcher,
+		pending:  make(map[syncKey]time.Time),
+		synced:   make(map[string]string),
+	}
+
+	if err := s.watchTree(absHost); err != nil {
+		cancel()
+		_ = watcher.Close()
+		root.Close()
+		return nil, err
+	}
+	if err := s.initialSync(); err != nil {
+		cancel()
+		_ = watcher.Close()
+		root.Close()
+		return nil, err
+	}
+
+	unsubscribe := c.subscribeFileEvents(s.handleGuestEvent)
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		s.watchHost()
+	}()
+	go func() {
+		defer s.wg.Done()
+		s.run()
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			unsubscribe()
+			cancel()
+			_ = watcher.Close()
+			s.wg.Wait()
+			root.Close()
+		})
+	}
+	return stop, nil
+}
+
+func (s *syncSession) initialSync() error {
+	err := filepath.WalkDir(s.hostDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, ok := s.hostRel(p)
+		if !ok {
+			return nil
+		}
+		if s.ignored(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		return s.pushPath(rel)
+	})
+	if err != nil {
+		return errx.Wrap(ErrSyncInitial, err)
+	}
+	if err := s.pullMissing(""); err != nil {
+		return errx.Wrap(ErrSyncInitial, err)
+	}
+	return nil
+}
+
+// pullMissing copies guest files that do not exist on the host.
+func (s *syncSession) pullMissing(rel string) error {
+	files, err := s.client.ListFiles(s.ctx, s.guestPath(rel))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		child := path.Join(rel, f.Name)
+		if s.ignored(child) {
+			continue
+		}
+		if _, err := os.Lstat(s.hostPath(child)); err == nil {
+			continue
+		}
+		if f.IsDir {
+			if err := s.pullMissing(child); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.pullPath(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncSession) watchTree(root string) error {
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if rel, ok := s.hostRel(p); ok && s.ignored(rel) {
+			return filepath.SkipDir
+		}
+		return s.watcher.Add(p)
+	})
+	if err != nil {
+		return errx.Wrap(ErrSyncWatch, err)
+	}
+	return nil
+}
+
+func (s *syncSession) watchHost() {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case ev, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			rel, ok := s.hostRel(ev.Name)
+			if !ok || s.ignored(rel) {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if fi, err := os.Lstat(ev.Name); err == nil && fi.IsDir() {
+					if err := s.watchTree(ev.Name); err != nil {
+						s.reportError(err)
+					}
+				}
+			}
+			s.schedule(syncToGuest, rel)
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			s.reportError(errx.Wrap(ErrSyncWatch, err))
+		}
+	}
+}
+
+func (s *syncSession) handleGuestEvent(event api.FileEvent) {
+	// Only content-changing ops are considered. Close is deliberately
+	// excluded: our own read_file pulls close guest files and would
+	// otherwise re-trigger a pull forever.
+	switch strings.ToLower(event.Op) {
+	case VFSHookOpWrite, VFSHookOpCreate, VFSHookOpTruncate, VFSHookOpRemove, VFSHookOpRemoveAll, VFSHookOpRename:
+	default:
+		return
+	}
+	rel, ok := s.guestRel(event.Path)
+	if !ok || s.ignored(rel) {
+		return
+	}
+	s.schedule(syncToHost, rel)
+}
+
+func (s *syncSession) schedule(dir syncDirection, rel string) {
+	s.mu.Lock()
+	s.pending[syncKey{dir: dir, rel: rel}] = time.Now().Add(s.opts.Debounce)
+	s.mu.Unlock()
+}
+
+// run applies due changes one at a time so host and guest updates for the
+// same path never race each other.
+func (s *syncSession) run() {
+	ticker := time.NewTicker(s.opts.Debounce / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, key := range s.due(now) {
+				var err error
+				if key.dir == syncToGuest {
+					err = s.pushPath(key.rel)
+				} else {
+					err = s.pullPath(key.rel)
+				}
+				if err != nil && s.ctx.Err() == nil {
+					s.reportError(err)
+				}
+			}
+		}
+	}
+}
+
+func (s *syncSession) due(now time.Time) []syncKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []syncKey
+	for key, deadline := range s.pending {
+		if now.Before(deadline) {
+			continue
+		}
+		keys = append(keys, key)
+		delete(s.pending, key)
+	}
+	return keys
+}
+
+// pushPath copies a host path into the guest, or removes it from the guest
+// if it no longer exists on the host.
+func (s *syncSession) pushPath(rel string) error {
+	hostPath := s.hostPath(rel)
+	guestPath := s.guestPath(rel)
+
+	fi, err := os.Lstat(hostPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if !s.forget(rel) {
+			return nil
+		}
+		return s.guestExec("rm", "-rf", "--", guestPath)
+	}
+	if err != nil {
+		return errx.Wrap(ErrSyncPush, err)
+	}
+
+	if fi.IsDir() {
+		return s.guestExec("mkdir", "-p", "--", guestPath)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	content, err := os.ReadFile(hostPath)
+	if err != nil {
+		return errx.Wrap(ErrSyncPush, err)
+	}
+	sum := syncHash(content)
+	if s.hashOf(rel) == sum {
+		return nil
+	}
+	if err := s.client.WriteFileMode(s.ctx, guestPath, content, uint32(fi.Mode().Perm())); err != nil {
+		return errx.With(ErrSyncPush, " %s: %w", guestPath, err)
+	}
+	s.record(rel, sum)
+	return nil
+}
+
+// pullPath copies a guest file to the host, or removes it from the host if it
+// was previously synced and no longer exists in the guest. Any other read
+// failure (a timeout, cancellation, a permission error) leaves the host copy
+// alone. Host paths are resolved inside s.root, and an existing host
+// symlink is never written through.
+func (s *syncSession) pullPath(rel string) error {
+	hostPath := s.hostPath(rel)
+	guestPath := s.guestPath(rel)
+	name := filepath.FromSlash(rel)
+
+	content, err := s.client.ReadFile(s.ctx, guestPath)
+	if err != nil {
+		if ctxErr := s.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return errx.With(ErrSyncPull, " %s: %w", guestPath, err)
+		}
+		if !s.forget(rel) {
+			return nil
+		}
+		if err := s.root.RemoveAll(name); err != nil {
+			return errx.Wrap(ErrSyncPull, err)
+		}
+		return nil
+	}
+
+	sum := syncHash(content)
+	if s.hashOf(rel) == sum {
+		return nil
+	}
+
+	mode := os.FileMode(0644)
+	if fi, err := s.root.Lstat(name); err == nil {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return errx.With(ErrSyncPull, ": %s is a symlink on the host", hostPath)
+		}
+		mode = fi.Mode().Perm()
+	}
+	if err := s.root.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return errx.Wrap(ErrSyncPull, err)
+	}
+	// Record before writing so the resulting fsnotify event is recognised as
+	// an echo of this pull rather than a new host change.
+	s.record(rel, sum)
+	if err := s.root.WriteFile(name, content, mode); err != nil {
+		s.forget(rel)
+		return errx.With(ErrSyncPull, " %s: %w", hostPath, err)
+	}
+	return nil
+}
+
+func (s *syncSession) guestExec(args ...string) error {
+	result, err := s.client.Exec(s.ctx, api.ShellQuoteArgs(args))
+	if err != nil {
+		return errx.Wrap(ErrSyncPush, err)
+	}
+	if result.ExitCode != 0 {
+		return errx.With(ErrSyncPush, ": %s exited %d: %s", args[0], result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+func (s *syncSession) hashOf(rel string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.synced[rel]
+}
+
+func (s *syncSession) record(rel, sum string) {
+	s.mu.Lock()
+	s.synced[rel] = sum
+	s.mu.Unlock()
+}
+
+// forget drops rel and everything below it from the synced set. It reports
+// whether anything was known, which guards deletes against paths that were
+// never synced (for example guest directories or ignored files).
+func (s *syncSession) forget(rel string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known := false
+	prefix := rel + "/"
+	for p := range s.synced {
+		if p == rel || strings.HasPrefix(p, prefix) {
+			delete(s.synced, p)
+			known = true
+		}
+	}
+	return known
+}
+
+func (s *syncSession) ignored(rel string) bool {
+	if rel == "" {
+		return false
+	}
+	for _, pattern := range s.opts.Ignore {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		for _, part := range strings.Split(rel, "/") {
+			if ok, _ := path.Match(pattern, part); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *syncSession) hostRel(p string) (string, bool) {
+	rel, err := filepath.Rel(s.hostDir, p)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+func (s *syncSession) guestRel(p string) (string, bool) {
+	p = path.Clean(p)
+	prefix := strings.TrimSuffix(s.guestDir, "/") + "/"
+	if !strings.HasPrefix(p, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(p, prefix), true
+}
+
+func (s *syncSession) hostPath(rel string) string {
+	return filepath.Join(s.hostDir, filepath.FromSlash(rel))
+}
+
+func (s *syncSession) guestPath(rel string) string {
+	return path.Join(s.guestDir, rel)
+}
+
+func (s *syncSession) reportError(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
+
+func syncHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,276 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// fakeGuestFS is a minimal in-memory guest filesystem behind the scripted
+// client, supporting the RPCs used by Sync.
+type fakeGuestFS struct {
+	mu     sync.Mutex
+	files  map[string][]byte
+	denied map[string]bool // read_file fails without not_found
+}
+
+func (f *fakeGuestFS) get(p string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.files[p]
+	return data, ok
+}
+
+func (f *fakeGuestFS) set(p string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[p] = data
+}
+
+func (f *fakeGuestFS) deny(p string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.denied == nil {
+		f.denied = make(map[string]bool)
+	}
+	f.denied[p] = true
+}
+
+func (f *fakeGuestFS) isDenied(p string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.denied[p]
+}
+
+func (f *fakeGuestFS) remove(p string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.files, p)
+}
+
+func (f *fakeGuestFS) handle(req request) response {
+	data, _ := json.Marshal(req.Params)
+	var params struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	_ = json.Unmarshal(data, &params)
+
+	ok := func(result string) response {
+		return response{JSONRPC: "2.0", Result: json.RawMessage(result), ID: &req.ID}
+	}
+
+	switch req.Method {
+	case "write_file":
+		content, _ := base64.StdEncoding.DecodeString(params.Content)
+		f.set(params.Path, content)
+		return ok(`{}`)
+	case "read_file":
+		if f.isDenied(params.Path) {
+			return response{JSONRPC: "2.0", Error: &rpcError{Code: ErrCodeFileFailed, Message: "permission denied"}, ID: &req.ID}
+		}
+		content, found := f.get(params.Path)
+		if !found {
+			return response{JSONRPC: "2.0", Error: &rpcError{Code: ErrCodeFileFailed, Message: "not found", Data: json.RawMessage(`{"not_found":true}`)}, ID: &req.ID}
+		}
+		out, _ := json.Marshal(map[string]string{"content": base64.StdEncoding.EncodeToString(content)})
+		return ok(string(out))
+	case "list_files":
+		f.mu.Lock()
+		seen := make(map[string]bool)
+		var files []FileInfo
+		for p := range f.files {
+			if !strings.HasPrefix(p, params.Path+"/") {
+				continue
+			}
+			rest := strings.TrimPrefix(p, params.Path+"/")
+			name, _, nested := strings.Cut(rest, "/")
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			files = append(files, FileInfo{Name: name, IsDir: nested})
+		}
+		f.mu.Unlock()
+		out, _ := json.Marshal(map[string]interface{}{"files": files})
+		return ok(string(out))
+	case "exec":
+		return ok(`{"exit_code":0,"stdout":"","stderr":"","duration_ms":1}`)
+	default:
+		return response{JSONRPC: "2.0", Error: &rpcError{Code: ErrCodeMethodNotFound, Message: "Method not found"}, ID: &req.ID}
+	}
+}
+
+func TestSyncPushesHostFiles(t *testing.T) {
+	guest := &fakeGuestFS{files: map[string][]byte{}}
+	client, cleanup := newScriptedClient(t, guest.handle)
+	defer cleanup()
+
+	hostDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "a.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(hostDir, ".git"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, ".git", "config"), []byte("x"), 0644))
+
+	stop, err := client.SyncWithOptions(context.Background(), hostDir, "/workspace", SyncOptions{
+		Ignore:   []string{".git"},
+		Debounce: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer stop()
+
+	content, ok := guest.get("/workspace/a.txt")
+	require.True(t, ok)
+	assert.Equal(t, "hello", string(content))
+	_, ok = guest.get("/workspace/.git/config")
+	assert.False(t, ok, "ignored paths must not be synced")
+
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "b.txt"), []byte("new"), 0644))
+	require.Eventually(t, func() bool {
+		content, ok := guest.get("/workspace/b.txt")
+		return ok && string(content) == "new"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSyncPullsGuestChanges(t *testing.T) {
+	guest := &fakeGuestFS{files: map[string][]byte{
+		"/workspace/sub/guest-only.txt": []byte("from guest"),
+	}}
+	client, cleanup := newScriptedClient(t, guest.handle)
+	defer cleanup()
+
+	hostDir := t.TempDir()
+	stop, err := client.SyncWithOptions(context.Background(), hostDir, "/workspace", SyncOptions{
+		Debounce: 20 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer stop()
+
+	content, err := os.ReadFile(filepath.Join(hostDir, "sub", "guest-only.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "from guest", string(content))
+
+	guest.set("/workspace/out.txt", []byte("result"))
+	client.dispatchFileEvent(api.FileEvent{Op: VFSHookOpWrite, Path: "/workspace/out.txt"})
+	require.Eventually(t, func() bool {
+		content, err := os.ReadFile(filepath.Join(hostDir, "out.txt"))
+		return err == nil && string(content) == "result"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	guest.remove("/workspace/out.txt")
+	client.dispatchFileEvent(api.FileEvent{Op: VFSHookOpRemove, Path: "/workspace/out.txt"})
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(hostDir, "out.txt"))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSyncPullNeverFollowsHostSymlinksOutsideHostDir(t *testing.T) {
+	outside := t.TempDir()
+	target := filepath.Join(outside, "python3")
+	require.NoError(t, os.WriteFile(target, []byte("host binary"), 0644))
+
+	hostDir := t.TempDir()
+	require.NoError(t, os.Symlink(target, filepath.Join(hostDir, "python")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(hostDir, "home")))
+
+	guest := &fakeGuestFS{files: map[string][]byte{}}
+	client, cleanup := newScriptedClient(t, guest.handle)
+	defer cleanup()
+
+	var mu sync.Mutex
+	var syncErrs []error
+	stop, err := client.SyncWithOptions(context.Background(), hostDir, "/workspace", SyncOptions{
+		Debounce: 20 * time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			syncErrs = append(syncErrs, err)
+		},
+	})
+	require.NoError(t, err)
+	defer stop()
+
+	guest.set("/workspace/python", []byte("pwned"))
+	guest.set("/workspace/home/.bashrc", []byte("pwned"))
+	client.dispatchFileEvent(api.FileEvent{Op: VFSHookOpWrite, Path: "/workspace/python"})
+	client.dispatchFileEvent(api.FileEvent{Op: VFSHookOpWrite, Path: "/workspace/home/.bashrc"})
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(syncErrs) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	for _, err := range syncErrs {
+		assert.ErrorIs(t, err, ErrSyncPull)
+	}
+	mu.Unlock()
+
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "host binary", string(content))
+	_, err = os.Stat(filepath.Join(outside, ".bashrc"))
+	assert.True(t, os.IsNotExist(err), "nothing may be created outside hostDir")
+}
+
+func TestSyncKeepsHostFileOnTransientReadError(t *testing.T) {
+	guest := &fakeGuestFS{files: map[string][]byte{
+		"/workspace/out.txt": []byte("result"),
+	}}
+	client, cleanup := newScriptedClient(t, guest.handle)
+	defer cleanup()
+
+	hostDir := t.TempDir()
+	var mu sync.Mutex
+	var syncErrs []error
+	stop, err := client.SyncWithOptions(context.Background(), hostDir, "/workspace", SyncOptions{
+		Debounce: 20 * time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			syncErrs = append(syncErrs, err)
+		},
+	})
+	require.NoError(t, err)
+	defer stop()
+
+	guest.deny("/workspace/out.txt")
+	client.dispatchFileEvent(api.FileEvent{Op: VFSHookOpWrite, Path: "/workspace/out.txt"})
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(syncErrs) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.ErrorIs(t, syncErrs[0], ErrSyncPull)
+	mu.Unlock()
+
+	content, err := os.ReadFile(filepath.Join(hostDir, "out.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "result", string(content))
+}
+
+func TestSyncRejectsRelativeGuestDir(t *testing.T) {
+	client := &Client{}
+	_, err := client.Sync(context.Background(), t.TempDir(), "workspace")
+	require.ErrorIs(t, err, ErrSyncGuestDir)
+}
+
+func TestSyncIgnoreMatching(t *testing.T) {
+	s := &syncSession{opts: SyncOptions{Ignore: []string{"node_modules", "build/*.o"}}}
+	assert.True(t, s.ignored("node_modules"))
+	assert.True(t, s.ignored(path.Join("pkg", "node_modules", "x.js")))
+	assert.True(t, s.ignored("build/main.o"))
+	assert.False(t, s.ignored("src/main.go"))
+}
@@ -0,0 +1,39 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+)
+
+// TailFile follows a file anywhere in the guest filesystem, like tail -F,
+// and writes the bytes appended to it into w until ctx is cancelled, which
+// is not reported as an error. Existing content is skipped. A truncated
+// file is followed from its start again and a rotated one is reopened.
+// Use it for logs written outside the workspace, which the VFS cannot see.
+func (c *Client) TailFile(ctx context.Context, path string, w io.Writer) error {
+	params := map[string]interface{}{
+		"path": path,
+	}
+
+	onNotification := func(method string, params json.RawMessage) {
+		var chunk struct {
+			Data string `json:"data"`
+		}
+		if err := json.Unmarshal(params, &chunk); err != nil {
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(chunk.Data)
+		if err != nil {
+			return
+		}
+		w.Write(decoded)
+	}
+
+	_, err := c.sendRequestCtx(ctx, "tail_file", params, onNotification)
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,190 @@
+package sdk
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// InteractiveOptions configures ExecInteractive.
+type InteractiveOptions struct {
+	// WorkingDir overrides the command's working directory.
+	WorkingDir string
+	// User overrides the user the command runs as.
+	User string
+	// LoginShell runs the command in a login shell (see ExecOptions.LoginShell).
+	LoginShell bool
+	// Shell and Args choose how the command runs, as in ExecOptions.
+	Shell []string
+	Args  []string
+	// Rows and Cols set the initial terminal size (default 24x80).
+	Rows uint16
+	Cols uint16
+	// Stdin is relayed to the guest PTY until EOF. Nil means no input.
+	Stdin io.Reader
+	// Stdout receives the PTY output. Nil discards it.
+	Stdout io.Writer
+}
+
+// TTYSession is an interactive command started with ExecInteractive.
+type TTYSession struct {
+	id     string
+	client *Client
+	done   chan struct{}
+
+	exitCode int
+	err      error
+}
+
+// ID returns the session ID accepted by Client.ResizeTTY.
+func (s *TTYSession) ID() string {
+	return s.id
+}
+
+// Resize changes the session's terminal size.
+func (s *TTYSession) Resize(rows, cols uint16) error {
+	return s.client.ResizeTTY(s.id, rows, cols)
+}
+
+// Wait blocks until the command exits and returns its exit code.
+func (s *TTYSession) Wait() (int, error) {
+	<-s.done
+	return s.exitCode, s.err
+}
+
+// ExecInteractive starts command attached to a guest PTY and returns a handle
+// for resizing the terminal and waiting for the exit code. Cancelling ctx
+// aborts the command. Sessions are independent: it may be called
+// concurrently, and each call gets its own guest PTY.
+func (c *Client) ExecInteractive(ctx context.Context, command string, opts InteractiveOptions) (*TTYSession, error) {
+	session := &TTYSession{
+		id:     fmt.Sprintf("tty-%d", c.ttySeq.Add(1)),
+		client: c,
+		done:   make(chan struct{}),
+	}
+
+	params := map[string]interface{}{
+		"session_id": session.id,
+		"command":    command,
+	}
+	if opts.WorkingDir != "" {
+		params["working_dir"] = opts.WorkingDir
+	}
+	if opts.User != "" {
+		params["user"] = opts.User
+	}
+	if opts.LoginShell {
+		params["login_shell"] = true
+	}
+	if len(opts.Shell) > 0 {
+		params["shell"] = opts.Shell
+	}
+	if len(opts.Args) > 0 {
+		params["args"] = opts.Args
+	}
+	if opts.Rows > 0 {
+		params["rows"] = opts.Rows
+	}
+	if opts.Cols > 0 {
+		params["cols"] = opts.Cols
+	}
+
+	onNotification := func(method string, params json.RawMessage) {
+		if opts.Stdout == nil {
+			return
+		}
+		var chunk struct {
+			Data string `json:"data"`
+		}
+		if err := json.Unmarshal(params, &chunk); err != nil {
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(chunk.Data)
+		if err != nil {
+			return
+		}
+		opts.Stdout.Write(decoded)
+	}
+
+	// The request is written before returning so resizes and stdin sent
+	// through the handle are ordered after it.
+	id, pending, err := c.startRequest("exec_tty", params, onNotification)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		defer close(session.done)
+		result, err := c.awaitRequest(ctx, id, pending)
+		if err != nil {
+			session.err = err
+			return
+		}
+		var ttyResult struct {
+			ExitCode int `json:"exit_code"`
+		}
+		if err := json.Unmarshal(result, &ttyResult); err != nil {
+			session.err = errx.Wrap(ErrParseExecTTYResult, err)
+			return
+		}
+		session.exitCode = ttyResult.ExitCode
+	}()
+
+	if opts.Stdin != nil {
+		go c.pumpTTYStdin(session, opts.Stdin)
+	}
+	return session, nil
+}
+
+// AttachInteractive runs command in a new guest PTY, relaying opts.Stdin
+// and opts.Stdout, and blocks until it exits, like `matchlock exec -it`.
+// Each call is its own session, so several goroutines may attach to the
+// sandbox at once, e.g. a shell next to htop.
+func (c *Client) AttachInteractive(ctx context.Context, command string, opts InteractiveOptions) (int, error) {
+	session, err := c.ExecInteractive(ctx, command, opts)
+	if err != nil {
+		return 1, err
+	}
+	return session.Wait()
+}
+
+// pumpTTYStdin forwards stdin to the session in order, closing guest stdin
+// at EOF. It stops early once the server no longer knows the session.
+func (c *Client) pumpTTYStdin(session *TTYSession, stdin io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := stdin.Read(buf)
+		params := map[string]interface{}{"session_id": session.id}
+		if n > 0 {
+			params["data"] = base64.StdEncoding.EncodeToString(buf[:n])
+		}
+		if readErr != nil {
+			params["eof"] = true
+		}
+		if n > 0 || readErr != nil {
+			if _, err := c.sendRequest("exec_tty.stdin", params); err != nil {
+				return
+			}
+		}
+		if readErr != nil {
+			return
+		}
+	}
+}
+
+// ResizeTTY changes the terminal size of a running interactive session.
+func (c *Client) ResizeTTY(sessionID string, rows, cols uint16) error {
+	if rows == 0 || cols == 0 {
+		return errx.With(ErrInvalidTTYSize, ": %dx%d", rows, cols)
+	}
+	_, err := c.sendRequest("exec_tty.resize", map[string]interface{}{
+		"session_id": sessionID,
+		"rows":       rows,
+		"cols":       cols,
+	})
+	return err
+}
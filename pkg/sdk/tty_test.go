@@ -0,0 +1,88 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecInteractiveReturnsSessionHandle(t *testing.T) {
+	requests := make(chan request, 4)
+	client, cleanup := newScriptedClient(t, func(req request) response {
+		requests <- req
+		switch req.Method {
+		case "exec_tty":
+			return response{JSONRPC: "2.0", Result: json.RawMessage(`{"exit_code":7}`), ID: &req.ID}
+		default:
+			return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+		}
+	})
+	defer cleanup()
+
+	session, err := client.ExecInteractive(context.Background(), "sh", InteractiveOptions{Rows: 40, Cols: 100})
+	require.NoError(t, err)
+	require.NotEmpty(t, session.ID())
+
+	exitCode, err := session.Wait()
+	require.NoError(t, err)
+	assert.Equal(t, 7, exitCode)
+
+	start := <-requests
+	params := start.Params.(map[string]interface{})
+	assert.Equal(t, session.ID(), params["session_id"])
+	assert.Equal(t, "sh", params["command"])
+	assert.EqualValues(t, 40, params["rows"])
+	assert.EqualValues(t, 100, params["cols"])
+
+	require.NoError(t, session.Resize(50, 120))
+	resize := <-requests
+	assert.Equal(t, "exec_tty.resize", resize.Method)
+	params = resize.Params.(map[string]interface{})
+	assert.Equal(t, session.ID(), params["session_id"])
+	assert.EqualValues(t, 50, params["rows"])
+	assert.EqualValues(t, 120, params["cols"])
+}
+
+func TestResizeTTYRejectsZeroSize(t *testing.T) {
+	client := &Client{}
+	err := client.ResizeTTY("tty-1", 0, 80)
+	require.ErrorIs(t, err, ErrInvalidTTYSize)
+}
+
+func TestAttachInteractiveConcurrentSessions(t *testing.T) {
+	client, cleanup := newScriptedStreamClient(t, func(req request) ([]notification, response) {
+		if req.Method != "exec_tty" {
+			return nil, response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+		}
+		command := req.Params.(map[string]interface{})["command"].(string)
+		out := base64.StdEncoding.EncodeToString([]byte("running " + command))
+		notifs := []notification{{
+			Method: "exec_tty.stdout",
+			Params: json.RawMessage(fmt.Sprintf(`{"id":%d,"data":%q}`, req.ID, out)),
+		}}
+		result := json.RawMessage(fmt.Sprintf(`{"exit_code":%d}`, len(command)))
+		return notifs, response{JSONRPC: "2.0", Result: result, ID: &req.ID}
+	})
+	defer cleanup()
+
+	var wg sync.WaitGroup
+	for _, command := range []string{"sh", "htop"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var stdout bytes.Buffer
+			exitCode, err := client.AttachInteractive(context.Background(), command, InteractiveOptions{Stdout: &stdout})
+			assert.NoError(t, err)
+			assert.Equal(t, len(command), exitCode)
+			assert.Equal(t, "running "+command, stdout.String())
+		}()
+	}
+	wg.Wait()
+}
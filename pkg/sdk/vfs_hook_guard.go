@@ -0,0 +1,107 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+const (
+	// defaultVFSEnforcementHookTimeout bounds action and mutate hooks that
+	// set no TimeoutMS. It matches the host's wait for guest operations.
+	defaultVFSEnforcementHookTimeout = 5 * time.Second
+
+	// vfsHookBreakerThreshold is the number of consecutive timeouts or
+	// panics after which a hook is disabled.
+	vfsHookBreakerThreshold = 3
+)
+
+// VFSHookDisabledEvent reports a hook that was disabled after repeated
+// timeouts or panics.
+type VFSHookDisabledEvent struct {
+	Name     string
+	Path     string
+	Failures int
+	// Err is the last failure, wrapping ErrVFSHookTimeout or ErrVFSHookPanic.
+	Err error
+}
+
+// vfsHookBreaker disables a hook after vfsHookBreakerThreshold consecutive
+// timeouts or panics. Errors the hook returns itself do not count. A nil
+// breaker never trips.
+type vfsHookBreaker struct {
+	name     string
+	path     string
+	failures atomic.Int32
+	open     atomic.Bool
+	onOpen   func(VFSHookDisabledEvent)
+}
+
+func newVFSHookBreaker(name, path string, onOpen func(VFSHookDisabledEvent)) *vfsHookBreaker {
+	return &vfsHookBreaker{name: name, path: path, onOpen: onOpen}
+}
+
+func (b *vfsHookBreaker) disabled() bool {
+	return b != nil && b.open.Load()
+}
+
+func (b *vfsHookBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	if !errors.Is(err, ErrVFSHookTimeout) && !errors.Is(err, ErrVFSHookPanic) {
+		b.failures.Store(0)
+		return
+	}
+	failures := int(b.failures.Add(1))
+	if failures < vfsHookBreakerThreshold || !b.open.CompareAndSwap(false, true) {
+		return
+	}
+	if b.onOpen != nil {
+		go b.onOpen(VFSHookDisabledEvent{Name: b.name, Path: b.path, Failures: failures, Err: err})
+	}
+}
+
+// guardVFSHook runs fn with panic recovery and, when timeout is positive, a
+// deadline that is enforced even if fn ignores its context. A hook that
+// overruns keeps running in the background, but the caller moves on.
+// Timeouts and panics count towards tripping b; once it has tripped, fn is
+// no longer called and ErrVFSHookDisabled is returned.
+func guardVFSHook(ctx context.Context, timeout time.Duration, b *vfsHookBreaker, fn func(ctx context.Context) error) error {
+	if b.disabled() {
+		return errx.With(ErrVFSHookDisabled, " %q", b.name)
+	}
+
+	hookCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		hookCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- errx.With(ErrVFSHookPanic, ": %v", r)
+			}
+		}()
+		done <- fn(hookCtx)
+	}()
+
+	select {
+	case err := <-done:
+		b.record(err)
+		return err
+	case <-hookCtx.Done():
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := errx.With(ErrVFSHookTimeout, " after %s", timeout)
+		b.record(err)
+		return err
+	}
+}
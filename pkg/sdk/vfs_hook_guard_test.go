@@ -0,0 +1,84 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardVFSHookRecoversPanic(t *testing.T) {
+	err := guardVFSHook(context.Background(), 0, nil, func(ctx context.Context) error {
+		panic("boom")
+	})
+	require.ErrorIs(t, err, ErrVFSHookPanic)
+	assert.ErrorContains(t, err, "boom")
+}
+
+func TestGuardVFSHookEnforcesTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	start := time.Now()
+	err := guardVFSHook(context.Background(), 20*time.Millisecond, nil, func(ctx context.Context) error {
+		<-release // ignores ctx
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrVFSHookTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestGuardVFSHookParentCancelDoesNotCount(t *testing.T) {
+	b := newVFSHookBreaker("h", "", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < vfsHookBreakerThreshold; i++ {
+		err := guardVFSHook(ctx, time.Second, b, func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+	assert.False(t, b.disabled())
+}
+
+func TestVFSHookBreakerTripsAfterRepeatedFailures(t *testing.T) {
+	events := make(chan VFSHookDisabledEvent, 1)
+	b := newVFSHookBreaker("slow", "/workspace/*", func(evt VFSHookDisabledEvent) { events <- evt })
+
+	calls := 0
+	panicky := func(ctx context.Context) error {
+		calls++
+		panic("bad hook")
+	}
+
+	// A hook's own error resets the count.
+	_ = guardVFSHook(context.Background(), 0, b, panicky)
+	_ = guardVFSHook(context.Background(), 0, b, panicky)
+	_ = guardVFSHook(context.Background(), 0, b, func(ctx context.Context) error { return errors.New("refused") })
+	assert.False(t, b.disabled())
+
+	for i := 0; i < vfsHookBreakerThreshold; i++ {
+		_ = guardVFSHook(context.Background(), 0, b, panicky)
+	}
+	require.True(t, b.disabled())
+
+	select {
+	case evt := <-events:
+		assert.Equal(t, "slow", evt.Name)
+		assert.Equal(t, "/workspace/*", evt.Path)
+		assert.Equal(t, vfsHookBreakerThreshold, evt.Failures)
+		assert.ErrorIs(t, evt.Err, ErrVFSHookPanic)
+	case <-time.After(time.Second):
+		t.Fatal("no disabled event")
+	}
+
+	before := calls
+	err := guardVFSHook(context.Background(), 0, b, panicky)
+	assert.ErrorIs(t, err, ErrVFSHookDisabled)
+	assert.Equal(t, before, calls, "disabled hook must not run")
+}
@@ -1,7 +1,11 @@
 package sdk
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"os"
 	"sync/atomic"
 	"testing"
@@ -9,6 +13,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
 )
 
 func TestCompileVFSHooks_SplitsLocalCallbacks(t *testing.T) {
@@ -93,8 +99,15 @@ func TestCompileVFSHooks_SplitsLocalMutateHooks(t *testing.T) {
 	require.Len(t, localAfter, 0)
 	require.Len(t, localMutate, 1)
 	require.Len(t, localAction, 0)
-	require.Len(t, wire.Rules, 1)
-	assert.Equal(t, "wire-rule", wire.Rules[0].Name)
+	require.Len(t, wire.Rules, 2)
+	assert.Equal(t, VFSHookRule{
+		Name:   "dynamic-mutate",
+		Phase:  VFSHookPhaseBefore,
+		Ops:    []VFSHookOp{VFSHookOpWrite},
+		Path:   "/workspace/*",
+		Action: api.VFSHookActionMutateCallback,
+	}, wire.Rules[0])
+	assert.Equal(t, "wire-rule", wire.Rules[1].Name)
 }
 
 func TestCompileVFSHooks_RejectsAfterMutateHook(t *testing.T) {
@@ -215,8 +228,86 @@ func TestCompileVFSHooks_SplitsLocalActionHooks(t *testing.T) {
 	require.Len(t, localAfter, 0)
 	require.Len(t, localMutate, 0)
 	require.Len(t, localAction, 1)
-	require.Len(t, wire.Rules, 1)
-	assert.Equal(t, "wire-rule", wire.Rules[0].Name)
+	require.Len(t, wire.Rules, 2)
+	assert.Equal(t, VFSHookAction(api.VFSHookActionCallback), wire.Rules[0].Action, "action hooks are also enforced on guest ops by the host")
+	assert.Equal(t, []VFSHookOp{VFSHookOpWrite}, wire.Rules[0].Ops)
+	assert.Equal(t, "wire-rule", wire.Rules[1].Name)
+}
+
+func TestCompileVFSHooks_RejectsCallbackActionWithoutHook(t *testing.T) {
+	_, _, _, _, err := compileVFSHooks(&VFSInterceptionConfig{
+		Rules: []VFSHookRule{{Name: "bare", Action: api.VFSHookActionCallback}},
+	})
+	require.ErrorIs(t, err, ErrInvalidVFSHook)
+}
+
+func TestClientAnswerVFSHookDecision(t *testing.T) {
+	answers := make(chan map[string]interface{}, 2)
+	c, cleanup := newScriptedClient(t, func(req request) response {
+		if req.Method == "vfs_hook.decision" {
+			answers <- req.Params.(map[string]interface{})
+		}
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	c.setVFSHooks(nil, nil, []compiledVFSActionHook{
+		{callback: func(ctx context.Context, req VFSActionRequest) VFSHookAction { return VFSHookActionAllow }},
+		{callback: func(ctx context.Context, req VFSActionRequest) VFSHookAction {
+			assert.Equal(t, VFSHookOpWrite, req.Op)
+			assert.Equal(t, "/workspace/.env", req.Path)
+			assert.Equal(t, 7, req.Size)
+			assert.Equal(t, 1000, req.UID)
+			return VFSHookActionBlock
+		}},
+	})
+
+	c.answerVFSHookDecision(9, api.VFSHookDecisionRequest{Rule: 1, Op: "write", Path: "/workspace/.env", Size: 7, UID: 1000})
+	got := <-answers
+	assert.Equal(t, float64(9), got["decision_id"])
+	assert.Equal(t, "block", got["action"])
+
+	// An unknown rule index fails closed.
+	c.answerVFSHookDecision(10, api.VFSHookDecisionRequest{Rule: 5})
+	got = <-answers
+	assert.Equal(t, "block", got["action"])
+}
+
+func TestClientAnswerVFSHookMutation(t *testing.T) {
+	answers := make(chan map[string]interface{}, 3)
+	c, cleanup := newScriptedClient(t, func(req request) response {
+		if req.Method == "vfs_hook.mutation" {
+			answers <- req.Params.(map[string]interface{})
+		}
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	c.setVFSHooks(nil, []compiledVFSMutateHook{
+		{callback: func(ctx context.Context, req VFSMutateRequest) ([]byte, error) {
+			assert.Equal(t, "/workspace/.env", req.Path)
+			assert.Equal(t, int64(4), req.Offset)
+			assert.Equal(t, len(req.Data), req.Size)
+			return bytes.ReplaceAll(req.Data, []byte("abc"), []byte("***")), nil
+		}},
+		{callback: func(ctx context.Context, req VFSMutateRequest) ([]byte, error) {
+			return nil, errors.New("refused")
+		}},
+	}, nil)
+
+	c.answerVFSHookMutation(3, api.VFSHookMutateRequest{Rule: 0, Path: "/workspace/.env", Offset: 4, Data: []byte("token=abc")})
+	got := <-answers
+	assert.Equal(t, float64(3), got["mutation_id"])
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("token=***")), got["data"])
+
+	c.answerVFSHookMutation(4, api.VFSHookMutateRequest{Rule: 1})
+	got = <-answers
+	assert.Equal(t, "refused", got["error"])
+
+	// An unknown rule index fails the write.
+	c.answerVFSHookMutation(5, api.VFSHookMutateRequest{Rule: 7})
+	got = <-answers
+	assert.NotEmpty(t, got["error"])
 }
 
 func TestCompileVFSHooks_RejectsAfterActionHook(t *testing.T) {
@@ -363,3 +454,28 @@ func TestClientApplyLocalActionHooks_Block(t *testing.T) {
 	require.Error(t, err)
 	assert.ErrorIs(t, err, ErrVFSHookBlocked)
 }
+
+func TestClientActionHookPanicBlocks(t *testing.T) {
+	answers := make(chan map[string]interface{}, 1)
+	c, cleanup := newScriptedClient(t, func(req request) response {
+		if req.Method == "vfs_hook.decision" {
+			answers <- req.Params.(map[string]interface{})
+		}
+		return response{JSONRPC: "2.0", Result: json.RawMessage(`{}`), ID: &req.ID}
+	})
+	defer cleanup()
+
+	c.setVFSHooks(nil, nil, []compiledVFSActionHook{
+		{name: "buggy", callback: func(ctx context.Context, req VFSActionRequest) VFSHookAction {
+			panic("nil map")
+		}},
+	})
+
+	err := c.applyLocalActionHooks(context.Background(), VFSHookOpWrite, "/workspace/a", 1, 0o644)
+	assert.ErrorIs(t, err, ErrVFSHookBlocked)
+	assert.ErrorIs(t, err, ErrVFSHookPanic)
+
+	c.answerVFSHookDecision(1, api.VFSHookDecisionRequest{Rule: 0, Op: "write", Path: "/workspace/a"})
+	got := <-answers
+	assert.Equal(t, "block", got["action"])
+}
@@ -54,6 +54,27 @@ CREATE TABLE IF NOT EXISTS subnet_allocations (
   created_at TEXT NOT NULL
 );
 CREATE INDEX IF NOT EXISTS idx_subnet_allocations_octet ON subnet_allocations(octet);
+`,
+		},
+		{
+			Version: 3,
+			Name:    "add_subnet_allocation_mac",
+			SQL: `
+ALTER TABLE subnet_allocations ADD COLUMN mac TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subnet_allocations_mac ON subnet_allocations(mac);
+`,
+		},
+		{
+			Version: 4,
+			Name:    "create_shared_bridge_allocations",
+			SQL: `
+CREATE TABLE IF NOT EXISTS shared_bridge_allocations (
+  vm_id TEXT PRIMARY KEY,
+  host INTEGER NOT NULL UNIQUE,
+  guest_ip TEXT NOT NULL,
+  mac TEXT UNIQUE,
+  created_at TEXT NOT NULL
+);
 `,
 		},
 	}
@@ -13,4 +13,6 @@ var (
 
 	ErrNoAvailableSubnets   = errors.New("no available subnets")
 	ErrSaveSubnetAllocation = errors.New("failed to save subnet allocation")
+	ErrSubnetInUse          = errors.New("subnet already allocated")
+	ErrMACInUse             = errors.New("MAC address already allocated")
 )
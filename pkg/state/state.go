@@ -19,6 +19,9 @@ type VMState struct {
 	Image     string          `json:"image"`
 	CreatedAt time.Time       `json:"created_at"`
 	Config    json.RawMessage `json:"config,omitempty"`
+	// StateDir is the VM's state directory (rootfs, logs, lifecycle
+	// record). Only set by Get.
+	StateDir string `json:"state_dir,omitempty"`
 }
 
 type Manager struct {
@@ -176,6 +179,7 @@ func (m *Manager) Get(id string) (VMState, error) {
 		}
 		return VMState{}, errx.Wrap(ErrGetVM, err)
 	}
+	state.StateDir = m.Dir(id)
 	return state, nil
 }
 
@@ -297,6 +301,11 @@ func (m *Manager) LogPath(id string) string {
 	return filepath.Join(m.baseDir, id, "logs", "vm.log")
 }
 
+// EventLogPath is the JSON-lines log of the VM's sandbox events.
+func (m *Manager) EventLogPath(id string) string {
+	return filepath.Join(m.baseDir, id, "events.jsonl")
+}
+
 func (m *Manager) SocketPath(id string) string {
 	return filepath.Join(m.baseDir, id, "socket")
 }
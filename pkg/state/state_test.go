@@ -132,6 +132,7 @@ func TestUnregisterThenRemove_RmFlag(t *testing.T) {
 	state, err := mgr.Get(id)
 	require.NoError(t, err)
 	require.Equal(t, "stopped", state.Status)
+	assert.Equal(t, filepath.Join(dir, id), state.StateDir)
 
 	require.NoError(t, mgr.Remove(id))
 
@@ -168,3 +169,115 @@ func TestUnregisterWithoutRemove_NoRmFlag(t *testing.T) {
 	_, err = os.Stat(filepath.Join(dir, id))
 	require.False(t, os.IsNotExist(err))
 }
+
+func TestSubnetAllocatorSkipsReservedIPs(t *testing.T) {
+	alloc := NewSubnetAllocatorWithDir(filepath.Join(t.TempDir(), "subnets"))
+
+	info, err := alloc.Allocate("vm-a", "192.168.100.50", "192.168.101.7", "10.0.0.5")
+	require.NoError(t, err)
+	assert.Equal(t, 102, info.Octet)
+	assert.Equal(t, "192.168.102.1", info.GatewayIP)
+
+	info, err = alloc.Allocate("vm-b")
+	require.NoError(t, err)
+	assert.Equal(t, 100, info.Octet)
+}
+
+func TestSubnetAllocatorAllocateOctet(t *testing.T) {
+	alloc := NewSubnetAllocatorWithDir(filepath.Join(t.TempDir(), "subnets"))
+
+	info, err := alloc.AllocateOctet("vm-a", 120)
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.120.2", info.GuestIP)
+
+	_, err = alloc.AllocateOctet("vm-b", 120)
+	require.ErrorIs(t, err, ErrSubnetInUse)
+
+	require.NoError(t, alloc.Release("vm-a"))
+	info, err = alloc.AllocateOctet("vm-b", 120)
+	require.NoError(t, err)
+	assert.Equal(t, "vm-b", info.VMID)
+}
+
+func TestSubnetAllocatorAllocateStatic(t *testing.T) {
+	alloc := NewSubnetAllocatorWithDir(filepath.Join(t.TempDir(), "subnets"))
+
+	info, err := alloc.AllocateStatic("vm-a", "192.168.130.42", "02:00:00:00:00:AA")
+	require.NoError(t, err)
+	assert.Equal(t, 130, info.Octet)
+	assert.Equal(t, "192.168.130.1", info.GatewayIP)
+	assert.Equal(t, "192.168.130.42", info.GuestIP)
+	assert.Equal(t, "02:00:00:00:00:aa", info.MAC)
+
+	got, err := alloc.Get("vm-a")
+	require.NoError(t, err)
+	assert.Equal(t, info, got)
+
+	_, err = alloc.AllocateStatic("vm-b", "192.168.130.43", "")
+	require.ErrorIs(t, err, ErrSubnetInUse)
+	_, err = alloc.AllocateOctet("vm-b", 130)
+	require.ErrorIs(t, err, ErrSubnetInUse)
+	_, err = alloc.AllocateStatic("vm-b", "", "02:00:00:00:00:aa")
+	require.ErrorIs(t, err, ErrMACInUse)
+
+	info, err = alloc.AllocateStatic("vm-b", "", "02:00:00:00:00:bb")
+	require.NoError(t, err)
+	assert.Equal(t, 100, info.Octet)
+	assert.Equal(t, "192.168.100.2", info.GuestIP)
+
+	info, err = alloc.Allocate("vm-c")
+	require.NoError(t, err)
+	assert.Empty(t, info.MAC)
+
+	require.NoError(t, alloc.Release("vm-a"))
+	info, err = alloc.AllocateStatic("vm-d", "192.168.130.42", "02:00:00:00:00:aa")
+	require.NoError(t, err)
+	assert.Equal(t, "vm-d", info.VMID)
+}
+
+func TestSubnetAllocatorAllocateShared(t *testing.T) {
+	alloc := NewSubnetAllocatorWithDir(filepath.Join(t.TempDir(), "subnets"))
+
+	info, err := alloc.AllocateShared("vm-a", "", "")
+	require.NoError(t, err)
+	assert.True(t, info.Shared)
+	assert.Equal(t, "10.99.0.1", info.GatewayIP)
+	assert.Equal(t, "10.99.0.2", info.GuestIP)
+	assert.Equal(t, "10.99.0.0/16", info.Subnet)
+	assert.Equal(t, "10.99.0.1/16", info.GatewayCIDR())
+
+	got, err := alloc.Get("vm-a")
+	require.NoError(t, err)
+	assert.Equal(t, info, got)
+
+	info, err = alloc.AllocateShared("vm-b", "10.99.1.0", "02:00:00:00:00:AA")
+	require.NoError(t, err)
+	assert.Equal(t, "10.99.1.0", info.GuestIP)
+	assert.Equal(t, "02:00:00:00:00:aa", info.MAC)
+
+	_, err = alloc.AllocateShared("vm-c", "10.99.1.0", "")
+	require.ErrorIs(t, err, ErrSubnetInUse)
+	_, err = alloc.AllocateShared("vm-c", "", "02:00:00:00:00:aa")
+	require.ErrorIs(t, err, ErrMACInUse)
+	_, err = alloc.AllocateShared("vm-c", "192.168.120.3", "")
+	require.ErrorIs(t, err, ErrNoAvailableSubnets)
+	_, err = alloc.AllocateShared("vm-c", "10.99.255.255", "")
+	require.ErrorIs(t, err, ErrNoAvailableSubnets)
+
+	// Shared addresses do not use up the per-VM subnet pool.
+	info, err = alloc.Allocate("vm-c")
+	require.NoError(t, err)
+	assert.Equal(t, 100, info.Octet)
+	assert.Equal(t, "192.168.100.1/24", info.GatewayCIDR())
+	_, err = alloc.AllocateShared("vm-c", "", "")
+	require.ErrorIs(t, err, ErrSubnetInUse)
+
+	info, err = alloc.AllocateShared("vm-d", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "10.99.0.3", info.GuestIP)
+
+	require.NoError(t, alloc.Release("vm-a"))
+	info, err = alloc.AllocateShared("vm-e", "", "")
+	require.NoError(t, err)
+	assert.Equal(t, "10.99.0.2", info.GuestIP)
+}
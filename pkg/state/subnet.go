@@ -3,8 +3,10 @@ package state
 import (
 	"database/sql"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,22 +14,26 @@ import (
 )
 
 // SubnetAllocator manages unique /24 subnet allocation for VMs
-// Uses 192.168.X.0/24 where X ranges from 100-254.
+// Uses 192.168.X.0/24 where X ranges from 100-254. VMs on the shared
+// bridge instead get one address each in 10.99.0.0/16.
 type SubnetAllocator struct {
-	mu       sync.Mutex
-	baseDir  string
-	minOctet int
-	maxOctet int
-	db       *sql.DB
-	initErr  error
+	mu           sync.Mutex
+	baseDir      string
+	minOctet     int
+	maxOctet     int
+	sharedPrefix [2]byte
+	db           *sql.DB
+	initErr      error
 }
 
 type SubnetInfo struct {
-	Octet     int    `json:"octet"`      // Third octet (e.g., 100 for 192.168.100.0/24)
-	GatewayIP string `json:"gateway_ip"` // Host TAP IP (e.g., 192.168.100.1)
-	GuestIP   string `json:"guest_ip"`   // Guest IP (e.g., 192.168.100.2)
-	Subnet    string `json:"subnet"`     // CIDR notation (e.g., 192.168.100.0/24)
+	Octet     int    `json:"octet"`         // Third octet (e.g., 100 for 192.168.100.0/24)
+	GatewayIP string `json:"gateway_ip"`    // Host TAP IP (e.g., 192.168.100.1)
+	GuestIP   string `json:"guest_ip"`      // Guest IP (e.g., 192.168.100.2)
+	Subnet    string `json:"subnet"`        // CIDR notation (e.g., 192.168.100.0/24)
+	MAC       string `json:"mac,omitempty"` // Static guest MAC, empty when derived
 	VMID      string `json:"vm_id"`
+	Shared    bool   `json:"shared,omitempty"` // Address on the shared bridge subnet
 }
 
 func NewSubnetAllocator() *SubnetAllocator {
@@ -39,11 +45,12 @@ func NewSubnetAllocator() *SubnetAllocator {
 func NewSubnetAllocatorWithDir(baseDir string) *SubnetAllocator {
 	db, err := openStateDB(baseDir)
 	return &SubnetAllocator{
-		baseDir:  baseDir,
-		minOctet: 100,
-		maxOctet: 254,
-		db:       db,
-		initErr:  err,
+		baseDir:      baseDir,
+		minOctet:     100,
+		maxOctet:     254,
+		sharedPrefix: [2]byte{10, 99},
+		db:           db,
+		initErr:      err,
 	}
 }
 
@@ -57,8 +64,10 @@ func (a *SubnetAllocator) ready() error {
 	return nil
 }
 
-// Allocate assigns a unique subnet to a VM.
-func (a *SubnetAllocator) Allocate(vmID string) (*SubnetInfo, error) {
+// Allocate assigns a unique subnet to a VM. Subnets containing any of the
+// reserved IPs (e.g. allowed private hosts the VM must reach through its
+// gateway) are skipped.
+func (a *SubnetAllocator) Allocate(vmID string, reserved ...string) (*SubnetInfo, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -70,38 +79,286 @@ func (a *SubnetAllocator) Allocate(vmID string) (*SubnetInfo, error) {
 		return existing, nil
 	}
 
-	used, err := a.usedOctets()
+	octet, err := a.freeOctet(reserved)
 	if err != nil {
 		return nil, err
 	}
+	return a.save(vmID, octet, "", "")
+}
+
+// freeOctet picks the lowest unallocated octet whose subnet holds none of
+// the reserved IPs.
+func (a *SubnetAllocator) freeOctet(reserved []string) (int, error) {
+	used, err := a.usedOctets()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, ip := range reserved {
+		if ip4 := net.ParseIP(ip).To4(); ip4 != nil && ip4[0] == 192 && ip4[1] == 168 {
+			used[int(ip4[2])] = true
+		}
+	}
 
-	var octet int
 	for o := a.minOctet; o <= a.maxOctet; o++ {
 		if !used[o] {
-			octet = o
-			break
+			return o, nil
+		}
+	}
+	return 0, errx.With(ErrNoAvailableSubnets, " (all %d-%d in use)", a.minOctet, a.maxOctet)
+}
+
+// AllocateOctet assigns the subnet 192.168.octet.0/24 to a VM, failing with
+// ErrSubnetInUse when another VM holds it. A VM restored from a snapshot
+// needs this: its guest keeps the IP it had when the snapshot was taken.
+func (a *SubnetAllocator) AllocateOctet(vmID string, octet int) (*SubnetInfo, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ready(); err != nil {
+		return nil, err
+	}
+
+	if existing, err := a.Get(vmID); err == nil {
+		if existing.Octet != octet {
+			return nil, errx.With(ErrSubnetInUse, ": %s already has 192.168.%d.0/24", vmID, existing.Octet)
+		}
+		return existing, nil
+	}
+	if octet < a.minOctet || octet > a.maxOctet {
+		return nil, errx.With(ErrNoAvailableSubnets, ": 192.168.%d.0/24 is outside %d-%d", octet, a.minOctet, a.maxOctet)
+	}
+
+	used, err := a.usedOctets()
+	if err != nil {
+		return nil, err
+	}
+	if used[octet] {
+		return nil, errx.With(ErrSubnetInUse, ": 192.168.%d.0/24", octet)
+	}
+	return a.save(vmID, octet, "", "")
+}
+
+// AllocateStatic assigns a VM a pinned guest address. A non-empty guestIP
+// (192.168.X.Y) gives the VM the subnet 192.168.X.0/24 with guestIP as its
+// guest address, failing with ErrSubnetInUse when another VM holds that
+// subnet; an empty one picks a free subnet like Allocate. A non-empty mac
+// is recorded with the allocation and fails with ErrMACInUse when another
+// VM already uses it.
+func (a *SubnetAllocator) AllocateStatic(vmID, guestIP, mac string, reserved ...string) (*SubnetInfo, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ready(); err != nil {
+		return nil, err
+	}
+
+	if mac != "" {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+		}
+		mac = hw.String()
+	}
+
+	if existing, err := a.Get(vmID); err == nil {
+		if (guestIP != "" && existing.GuestIP != guestIP) || existing.MAC != mac {
+			return nil, errx.With(ErrSubnetInUse, ": %s already has %s", vmID, existing.GuestIP)
+		}
+		return existing, nil
+	}
+
+	var octet int
+	if guestIP == "" {
+		var err error
+		if octet, err = a.freeOctet(reserved); err != nil {
+			return nil, err
+		}
+	} else {
+		ip4 := net.ParseIP(guestIP).To4()
+		if ip4 == nil || ip4[0] != 192 || ip4[1] != 168 || int(ip4[2]) < a.minOctet || int(ip4[2]) > a.maxOctet {
+			return nil, errx.With(ErrNoAvailableSubnets, ": %s is outside 192.168.%d.0-192.168.%d.255", guestIP, a.minOctet, a.maxOctet)
+		}
+		octet = int(ip4[2])
+		used, err := a.usedOctets()
+		if err != nil {
+			return nil, err
+		}
+		if used[octet] {
+			return nil, errx.With(ErrSubnetInUse, ": 192.168.%d.0/24 (for %s)", octet, guestIP)
+		}
+	}
+
+	if mac != "" {
+		var holder string
+		err := a.db.QueryRow(`SELECT vm_id FROM subnet_allocations WHERE mac = ?`, mac).Scan(&holder)
+		if err == nil {
+			return nil, errx.With(ErrMACInUse, ": %s (held by %s)", mac, holder)
+		}
+		if err != sql.ErrNoRows {
+			return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+		}
+	}
+	return a.save(vmID, octet, guestIP, mac)
+}
+
+// AllocateShared assigns a VM one address on the shared bridge subnet
+// 10.99.0.0/16, whose 10.99.0.1 is the bridge itself. A non-empty guestIP
+// pins the address and fails with ErrSubnetInUse when another VM holds
+// it; an empty one picks the lowest free address. A non-empty mac fails
+// with ErrMACInUse when another VM on the bridge already uses it.
+func (a *SubnetAllocator) AllocateShared(vmID, guestIP, mac string) (*SubnetInfo, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.ready(); err != nil {
+		return nil, err
+	}
+
+	if mac != "" {
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+		}
+		mac = hw.String()
+	}
+
+	if existing, err := a.Get(vmID); err == nil {
+		if !existing.Shared || (guestIP != "" && existing.GuestIP != guestIP) || existing.MAC != mac {
+			return nil, errx.With(ErrSubnetInUse, ": %s already has %s", vmID, existing.GuestIP)
 		}
+		return existing, nil
 	}
-	if octet == 0 {
-		return nil, errx.With(ErrNoAvailableSubnets, " (all %d-%d in use)", a.minOctet, a.maxOctet)
+
+	used, err := a.usedSharedHosts()
+	if err != nil {
+		return nil, err
+	}
+	// host is the address's low 16 bits; 1 is the bridge and 0xffff the
+	// broadcast address.
+	var host int
+	if guestIP == "" {
+		for h := 2; h < 0xffff; h++ {
+			if !used[h] {
+				host = h
+				break
+			}
+		}
+		if host == 0 {
+			return nil, errx.With(ErrNoAvailableSubnets, " (all of %s in use)", a.sharedSubnet())
+		}
+	} else {
+		ip4 := net.ParseIP(guestIP).To4()
+		if ip4 == nil || ip4[0] != a.sharedPrefix[0] || ip4[1] != a.sharedPrefix[1] {
+			return nil, errx.With(ErrNoAvailableSubnets, ": %s is outside %s", guestIP, a.sharedSubnet())
+		}
+		host = int(ip4[2])<<8 | int(ip4[3])
+		if host < 2 || host == 0xffff {
+			return nil, errx.With(ErrNoAvailableSubnets, ": %s is the network, gateway or broadcast address", guestIP)
+		}
+		if used[host] {
+			return nil, errx.With(ErrSubnetInUse, ": %s", guestIP)
+		}
 	}
 
+	if mac != "" {
+		var holder string
+		err := a.db.QueryRow(`SELECT vm_id FROM shared_bridge_allocations WHERE mac = ?`, mac).Scan(&holder)
+		if err == nil {
+			return nil, errx.With(ErrMACInUse, ": %s (held by %s)", mac, holder)
+		}
+		if err != sql.ErrNoRows {
+			return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+		}
+	}
+
+	info := a.sharedInfo(vmID, a.sharedIP(host), mac)
+	_, err = a.db.Exec(
+		`INSERT INTO shared_bridge_allocations (vm_id, host, guest_ip, mac, created_at)
+		 VALUES (?, ?, ?, ?, ?)`,
+		info.VMID,
+		host,
+		info.GuestIP,
+		sql.NullString{String: info.MAC, Valid: info.MAC != ""},
+		time.Now().UTC().Format(time.RFC3339Nano),
+	)
+	if err != nil {
+		return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+	}
+	return info, nil
+}
+
+func (a *SubnetAllocator) sharedIP(host int) string {
+	return fmt.Sprintf("%d.%d.%d.%d", a.sharedPrefix[0], a.sharedPrefix[1], host>>8, host&0xff)
+}
+
+func (a *SubnetAllocator) sharedSubnet() string {
+	return a.sharedIP(0) + "/16"
+}
+
+func (a *SubnetAllocator) sharedInfo(vmID, guestIP, mac string) *SubnetInfo {
+	return &SubnetInfo{
+		GatewayIP: a.sharedIP(1),
+		GuestIP:   guestIP,
+		Subnet:    a.sharedSubnet(),
+		MAC:       mac,
+		VMID:      vmID,
+		Shared:    true,
+	}
+}
+
+func (a *SubnetAllocator) usedSharedHosts() (map[int]bool, error) {
+	rows, err := a.db.Query(`SELECT host FROM shared_bridge_allocations`)
+	if err != nil {
+		return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+	}
+	defer rows.Close()
+
+	used := make(map[int]bool)
+	for rows.Next() {
+		var host int
+		if err := rows.Scan(&host); err != nil {
+			return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+		}
+		used[host] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+	}
+	return used, nil
+}
+
+// GatewayCIDR returns the gateway address with the subnet's prefix length
+// (e.g., 192.168.100.1/24), as configured on the host side.
+func (s *SubnetInfo) GatewayCIDR() string {
+	_, bits, _ := strings.Cut(s.Subnet, "/")
+	return s.GatewayIP + "/" + bits
+}
+
+// save records an allocation. An empty guestIP uses the subnet's .2
+// address; an empty mac is stored as NULL.
+func (a *SubnetAllocator) save(vmID string, octet int, guestIP, mac string) (*SubnetInfo, error) {
+	if guestIP == "" {
+		guestIP = fmt.Sprintf("192.168.%d.2", octet)
+	}
 	info := &SubnetInfo{
 		Octet:     octet,
 		GatewayIP: fmt.Sprintf("192.168.%d.1", octet),
-		GuestIP:   fmt.Sprintf("192.168.%d.2", octet),
+		GuestIP:   guestIP,
 		Subnet:    fmt.Sprintf("192.168.%d.0/24", octet),
+		MAC:       mac,
 		VMID:      vmID,
 	}
 
-	_, err = a.db.Exec(
-		`INSERT INTO subnet_allocations (vm_id, octet, gateway_ip, guest_ip, subnet, created_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
+	_, err := a.db.Exec(
+		`INSERT INTO subnet_allocations (vm_id, octet, gateway_ip, guest_ip, subnet, mac, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
 		info.VMID,
 		info.Octet,
 		info.GatewayIP,
 		info.GuestIP,
 		info.Subnet,
+		sql.NullString{String: info.MAC, Valid: info.MAC != ""},
 		time.Now().UTC().Format(time.RFC3339Nano),
 	)
 	if err != nil {
@@ -140,8 +397,13 @@ func (a *SubnetAllocator) Release(vmID string) error {
 		return err
 	}
 
-	if _, err := a.db.Exec(`DELETE FROM subnet_allocations WHERE vm_id = ?`, vmID); err != nil {
-		return errx.Wrap(ErrSaveSubnetAllocation, err)
+	for _, query := range []string{
+		`DELETE FROM subnet_allocations WHERE vm_id = ?`,
+		`DELETE FROM shared_bridge_allocations WHERE vm_id = ?`,
+	} {
+		if _, err := a.db.Exec(query, vmID); err != nil {
+			return errx.Wrap(ErrSaveSubnetAllocation, err)
+		}
 	}
 	return nil
 }
@@ -152,17 +414,32 @@ func (a *SubnetAllocator) Get(vmID string) (*SubnetInfo, error) {
 		return nil, err
 	}
 
-	row := a.db.QueryRow(`SELECT octet, gateway_ip, guest_ip, subnet, vm_id FROM subnet_allocations WHERE vm_id = ?`, vmID)
+	row := a.db.QueryRow(`SELECT octet, gateway_ip, guest_ip, subnet, mac, vm_id FROM subnet_allocations WHERE vm_id = ?`, vmID)
 	var info SubnetInfo
-	if err := row.Scan(&info.Octet, &info.GatewayIP, &info.GuestIP, &info.Subnet, &info.VMID); err != nil {
+	var mac sql.NullString
+	if err := row.Scan(&info.Octet, &info.GatewayIP, &info.GuestIP, &info.Subnet, &mac, &info.VMID); err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("subnet allocation not found for %s", vmID)
+			return a.getShared(vmID)
 		}
 		return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
 	}
+	info.MAC = mac.String
 	return &info, nil
 }
 
+func (a *SubnetAllocator) getShared(vmID string) (*SubnetInfo, error) {
+	var guestIP string
+	var mac sql.NullString
+	err := a.db.QueryRow(`SELECT guest_ip, mac FROM shared_bridge_allocations WHERE vm_id = ?`, vmID).Scan(&guestIP, &mac)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("subnet allocation not found for %s", vmID)
+		}
+		return nil, errx.Wrap(ErrSaveSubnetAllocation, err)
+	}
+	return a.sharedInfo(vmID, guestIP, mac.String), nil
+}
+
 // Cleanup removes all stale subnet allocations (VMs that no longer exist).
 func (a *SubnetAllocator) Cleanup(mgr *Manager) error {
 	a.mu.Lock()
@@ -172,7 +449,16 @@ func (a *SubnetAllocator) Cleanup(mgr *Manager) error {
 		return err
 	}
 
-	rows, err := a.db.Query(`SELECT vm_id FROM subnet_allocations`)
+	for _, table := range []string{"subnet_allocations", "shared_bridge_allocations"} {
+		if err := a.cleanupTable(mgr, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *SubnetAllocator) cleanupTable(mgr *Manager, table string) error {
+	rows, err := a.db.Query(`SELECT vm_id FROM ` + table)
 	if err != nil {
 		return errx.Wrap(ErrSaveSubnetAllocation, err)
 	}
@@ -192,7 +478,7 @@ func (a *SubnetAllocator) Cleanup(mgr *Manager) error {
 		return errx.Wrap(ErrSaveSubnetAllocation, err)
 	}
 	for _, vmID := range stale {
-		if _, err := a.db.Exec(`DELETE FROM subnet_allocations WHERE vm_id = ?`, vmID); err != nil {
+		if _, err := a.db.Exec(`DELETE FROM `+table+` WHERE vm_id = ?`, vmID); err != nil {
 			return errx.Wrap(ErrSaveSubnetAllocation, err)
 		}
 	}
@@ -0,0 +1,98 @@
+package vfs
+
+import (
+	"sync"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// ProviderFactory builds the provider for one mount spec. Specs that nest
+// other specs (an overlay's upper and lower) build them with build, so every
+// layer goes through the same registry and Readonly handling.
+type ProviderFactory func(mount api.MountConfig, build func(api.MountConfig) (Provider, error)) (Provider, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]ProviderFactory{
+		api.MountTypeMemory:  buildMemory,
+		api.MountTypeHostFS:  buildHostFS,
+		api.MountTypeOverlay: buildOverlay,
+	}
+)
+
+// RegisterProvider makes mountType available to BuildProvider, replacing
+// any factory already registered for it.
+func RegisterProvider(mountType string, factory ProviderFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[mountType] = factory
+}
+
+// BuildProvider builds the provider described by mount, recursing into
+// nested layers. An empty type is a memory mount. Readonly wraps whatever
+// the factory returns, at any level of the spec.
+func BuildProvider(mount api.MountConfig) (Provider, error) {
+	mountType := mount.Type
+	if mountType == "" {
+		mountType = api.MountTypeMemory
+	}
+	factoriesMu.RLock()
+	factory, ok := factories[mountType]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, errx.With(ErrUnknownMountType, ": %q", mount.Type)
+	}
+
+	p, err := factory(mount, BuildProvider)
+	if err != nil {
+		return nil, err
+	}
+	if mount.Readonly && !p.Readonly() {
+		p = NewReadonlyProvider(p)
+	}
+	return p, nil
+}
+
+func buildMemory(api.MountConfig, func(api.MountConfig) (Provider, error)) (Provider, error) {
+	return NewMemoryProvider(), nil
+}
+
+func buildHostFS(mount api.MountConfig, _ func(api.MountConfig) (Provider, error)) (Provider, error) {
+	if mount.HostPath == "" {
+		return nil, errx.With(ErrInvalidMountSpec, ": %s mount needs host_path", api.MountTypeHostFS)
+	}
+	uid := idMap(mount.HostUID, mount.GuestUID)
+	gid := idMap(mount.HostGID, mount.GuestGID)
+	if uid == nil && gid == nil {
+		return NewRealFSProvider(mount.HostPath), nil
+	}
+	return NewRealFSProviderWithOwners(mount.HostPath, uid, gid), nil
+}
+
+// idMap turns a validated host/guest ID pair from api.MountConfig into an
+// IDMap, or nil when the pair is unset.
+func idMap(host, guest *int) *IDMap {
+	if host == nil || guest == nil {
+		return nil
+	}
+	return &IDMap{Host: uint32(*host), Guest: uint32(*guest)}
+}
+
+// buildOverlay builds a layered overlay. Overlays given only a host_path are
+// snapshot copies that the sandbox turns into host_fs mounts before the
+// providers are built, so they are not accepted here.
+func buildOverlay(mount api.MountConfig, build func(api.MountConfig) (Provider, error)) (Provider, error) {
+	if mount.Upper == nil || mount.Lower == nil {
+		return nil, errx.With(ErrInvalidMountSpec, ": %s mount needs both upper and lower", api.MountTypeOverlay)
+	}
+	upper, err := build(*mount.Upper)
+	if err != nil {
+		return nil, errx.With(err, " (overlay upper)")
+	}
+	lower, err := build(*mount.Lower)
+	if err != nil {
+		return nil, errx.With(err, " (overlay lower)")
+	}
+	return NewOverlayProvider(upper, lower), nil
+}
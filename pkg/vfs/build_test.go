@@ -0,0 +1,83 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestBuildProviderComposesOverlay(t *testing.T) {
+	hostDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "seed.txt"), []byte("seed"), 0644))
+
+	p, err := BuildProvider(api.MountConfig{
+		Type:  api.MountTypeOverlay,
+		Upper: &api.MountConfig{Type: api.MountTypeMemory},
+		Lower: &api.MountConfig{Type: api.MountTypeHostFS, HostPath: hostDir, Readonly: true},
+	})
+	require.NoError(t, err)
+	require.IsType(t, &OverlayProvider{}, p)
+
+	h, err := p.Create("/seed.txt", 0644)
+	require.NoError(t, err)
+	_, err = h.Write([]byte("changed"))
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+
+	data, err := os.ReadFile(filepath.Join(hostDir, "seed.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "seed", string(data), "writes must not reach the host lower layer")
+}
+
+func TestBuildProviderReadonlyWrapsAnyType(t *testing.T) {
+	p, err := BuildProvider(api.MountConfig{Type: api.MountTypeMemory, Readonly: true})
+	require.NoError(t, err)
+	assert.True(t, p.Readonly())
+
+	p, err = BuildProvider(api.MountConfig{})
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryProvider{}, p)
+}
+
+func TestBuildProviderRejectsInvalidSpecs(t *testing.T) {
+	_, err := BuildProvider(api.MountConfig{Type: "s3"})
+	assert.ErrorIs(t, err, ErrUnknownMountType)
+
+	_, err = BuildProvider(api.MountConfig{Type: api.MountTypeHostFS})
+	assert.ErrorIs(t, err, ErrInvalidMountSpec)
+
+	_, err = BuildProvider(api.MountConfig{
+		Type:  api.MountTypeOverlay,
+		Upper: &api.MountConfig{Type: api.MountTypeMemory},
+		Lower: &api.MountConfig{Type: "tarball"},
+	})
+	assert.ErrorIs(t, err, ErrUnknownMountType)
+	assert.Contains(t, err.Error(), "overlay lower")
+}
+
+func TestRegisterProvider(t *testing.T) {
+	const mountType = "test-scratch"
+	RegisterProvider(mountType, func(api.MountConfig, func(api.MountConfig) (Provider, error)) (Provider, error) {
+		p := NewMemoryProvider()
+		return p, p.WriteFile("/README", []byte("scratch"), 0644)
+	})
+	t.Cleanup(func() {
+		factoriesMu.Lock()
+		delete(factories, mountType)
+		factoriesMu.Unlock()
+	})
+
+	p, err := BuildProvider(api.MountConfig{
+		Type:  api.MountTypeOverlay,
+		Upper: &api.MountConfig{Type: api.MountTypeMemory},
+		Lower: &api.MountConfig{Type: mountType},
+	})
+	require.NoError(t, err)
+	_, err = p.Stat("/README")
+	require.NoError(t, err)
+}
@@ -0,0 +1,90 @@
+package vfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// Payload encodings. VFSResponse.Encoding says how Data is compressed, and
+// an OpHello request offers encodings as bits (1 << encoding) in Flags.
+const (
+	EncodingNone uint8 = iota
+	EncodingGzip
+	EncodingZstd
+)
+
+// ServerOption configures a VFSServer.
+type ServerOption func(*VFSServer)
+
+// WithCompression has the server compress read payloads of at least min
+// bytes on connections whose guest offered an encoding in its OpHello
+// handshake. Payloads that do not shrink are sent raw. min <= 0 leaves
+// compression off, and guests that never say hello always get raw data.
+func WithCompression(min int) ServerOption {
+	return func(s *VFSServer) {
+		s.compressMin = min
+	}
+}
+
+// negotiate picks the encoding for a connection from the bits a guest
+// offered, preferring zstd, which decodes much faster than gzip.
+func (s *VFSServer) negotiate(offered uint32) uint8 {
+	if s.compressMin <= 0 {
+		return EncodingNone
+	}
+	for _, enc := range []uint8{EncodingZstd, EncodingGzip} {
+		if offered&(1<<enc) != 0 {
+			return enc
+		}
+	}
+	return EncodingNone
+}
+
+// compressRead replaces a large read payload with its compressed form
+// when the connection negotiated an encoding and compression helps.
+func (s *VFSServer) compressRead(req *VFSRequest, resp *VFSResponse, enc uint8) {
+	if enc == EncodingNone || req.Op != OpRead || len(resp.Data) < s.compressMin {
+		return
+	}
+	packed, err := compressPayload(enc, resp.Data)
+	if err != nil || len(packed) >= len(resp.Data) {
+		return
+	}
+	resp.Data = packed
+	resp.Encoding = enc
+}
+
+var zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+})
+
+func compressPayload(enc uint8, data []byte) ([]byte, error) {
+	switch enc {
+	case EncodingZstd:
+		encoder, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, make([]byte, 0, len(data)/2)), nil
+	case EncodingGzip:
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(data); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errx.With(ErrUnknownEncoding, ": %d", enc)
+	}
+}
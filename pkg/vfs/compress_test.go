@@ -0,0 +1,137 @@
+package vfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTrip sends one request frame on conn and reads its response.
+func roundTrip(t *testing.T, conn net.Conn, req *VFSRequest) *VFSResponse {
+	t.Helper()
+	data, err := cbor.Marshal(req)
+	require.NoError(t, err)
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+	_, err = conn.Write(frame)
+	require.NoError(t, err)
+
+	var lenBuf [4]byte
+	_, err = io.ReadFull(conn, lenBuf[:])
+	require.NoError(t, err)
+	body := make([]byte, binary.BigEndian.Uint32(lenBuf[:]))
+	_, err = io.ReadFull(conn, body)
+	require.NoError(t, err)
+	var resp VFSResponse
+	require.NoError(t, cbor.Unmarshal(body, &resp))
+	return &resp
+}
+
+func serveTestConn(t *testing.T, s *VFSServer) net.Conn {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.HandleConnection(server)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		<-done
+	})
+	return client
+}
+
+func readFileOverConn(t *testing.T, conn net.Conn, path string, size uint32) *VFSResponse {
+	t.Helper()
+	open := roundTrip(t, conn, &VFSRequest{Op: OpOpen, Path: path})
+	require.Zero(t, open.Err)
+	return roundTrip(t, conn, &VFSRequest{Op: OpRead, Handle: open.Handle, Size: size})
+}
+
+func compressibleProvider(t *testing.T) (Provider, []byte) {
+	t.Helper()
+	data := []byte(strings.Repeat(`{"level":"info","msg":"request served"}`+"\n", 1000))
+	p := NewMemoryProvider()
+	require.NoError(t, p.WriteFile("/log.json", data, 0644))
+	require.NoError(t, p.WriteFile("/small.txt", []byte("tiny tiny tiny tiny"), 0644))
+	return p, data
+}
+
+func TestVFSServerCompressesReadsAfterHello(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		offered uint32
+		want    uint8
+	}{
+		{"zstd preferred", 1<<EncodingGzip | 1<<EncodingZstd, EncodingZstd},
+		{"gzip only", 1 << EncodingGzip, EncodingGzip},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			provider, data := compressibleProvider(t)
+			conn := serveTestConn(t, NewVFSServer(provider, WithCompression(1024)))
+
+			hello := roundTrip(t, conn, &VFSRequest{Op: OpHello, Flags: tc.offered})
+			require.Zero(t, hello.Err)
+			assert.Equal(t, tc.want, hello.Encoding)
+
+			resp := readFileOverConn(t, conn, "/log.json", uint32(len(data)))
+			require.Zero(t, resp.Err)
+			assert.Equal(t, tc.want, resp.Encoding)
+			assert.Less(t, len(resp.Data), len(data)/4)
+			assert.Equal(t, data, decodeForTest(t, resp.Encoding, resp.Data))
+
+			small := readFileOverConn(t, conn, "/small.txt", 64)
+			assert.Equal(t, EncodingNone, small.Encoding, "payloads under the threshold stay raw")
+			assert.Equal(t, "tiny tiny tiny tiny", string(small.Data))
+		})
+	}
+}
+
+func TestVFSServerSendsRawWithoutNegotiation(t *testing.T) {
+	provider, data := compressibleProvider(t)
+
+	// No hello: an older guest never asked for compression.
+	conn := serveTestConn(t, NewVFSServer(provider, WithCompression(1024)))
+	resp := readFileOverConn(t, conn, "/log.json", uint32(len(data)))
+	assert.Equal(t, EncodingNone, resp.Encoding)
+	assert.Equal(t, data, resp.Data)
+
+	// Hello, but the server was not opted in.
+	conn = serveTestConn(t, NewVFSServer(provider))
+	hello := roundTrip(t, conn, &VFSRequest{Op: OpHello, Flags: 1 << EncodingZstd})
+	assert.Equal(t, EncodingNone, hello.Encoding)
+	resp = readFileOverConn(t, conn, "/log.json", uint32(len(data)))
+	assert.Equal(t, EncodingNone, resp.Encoding)
+	assert.Equal(t, data, resp.Data)
+}
+
+func decodeForTest(t *testing.T, enc uint8, data []byte) []byte {
+	t.Helper()
+	switch enc {
+	case EncodingZstd:
+		dec, err := zstd.NewReader(nil)
+		require.NoError(t, err)
+		defer dec.Close()
+		out, err := dec.DecodeAll(data, nil)
+		require.NoError(t, err)
+		return out
+	case EncodingGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		out, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		return out
+	}
+	return data
+}
@@ -0,0 +1,10 @@
+package vfs
+
+import "errors"
+
+var (
+	ErrSnapshotNotFound = errors.New("workspace snapshot not found")
+	ErrUnknownMountType = errors.New("unknown mount type")
+	ErrInvalidMountSpec = errors.New("invalid mount spec")
+	ErrUnknownEncoding  = errors.New("unknown payload encoding")
+)
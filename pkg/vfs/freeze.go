@@ -0,0 +1,137 @@
+package vfs
+
+import (
+	"os"
+	"sync/atomic"
+	"syscall"
+)
+
+// FreezeProvider passes operations through to inner until it is frozen.
+// While frozen every mutation fails with EROFS, including writes through
+// handles that were opened before the freeze; reads are unaffected.
+type FreezeProvider struct {
+	inner  Provider
+	frozen *atomic.Bool
+}
+
+func NewFreezeProvider(inner Provider) *FreezeProvider {
+	return &FreezeProvider{inner: inner, frozen: new(atomic.Bool)}
+}
+
+// SetFrozen toggles readonly enforcement.
+func (p *FreezeProvider) SetFrozen(frozen bool) { p.frozen.Store(frozen) }
+
+// Frozen reports whether readonly enforcement is active.
+func (p *FreezeProvider) Frozen() bool { return p.frozen.Load() }
+
+func (p *FreezeProvider) withCaller(uid, gid int) Provider {
+	callerAware, ok := p.inner.(interface {
+		withCaller(uid, gid int) Provider
+	})
+	if !ok {
+		return p
+	}
+	return &FreezeProvider{inner: callerAware.withCaller(uid, gid), frozen: p.frozen}
+}
+
+func (p *FreezeProvider) Readonly() bool                          { return p.inner.Readonly() }
+func (p *FreezeProvider) Stat(path string) (FileInfo, error)      { return p.inner.Stat(path) }
+func (p *FreezeProvider) ReadDir(path string) ([]DirEntry, error) { return p.inner.ReadDir(path) }
+func (p *FreezeProvider) Readlink(path string) (string, error)    { return p.inner.Readlink(path) }
+
+func (p *FreezeProvider) Open(path string, flags int, mode os.FileMode) (Handle, error) {
+	if p.Frozen() && flags&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, syscall.EROFS
+	}
+	h, err := p.inner.Open(path, flags, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &freezeHandle{Handle: h, frozen: p.frozen}, nil
+}
+
+func (p *FreezeProvider) Create(path string, mode os.FileMode) (Handle, error) {
+	if p.Frozen() {
+		return nil, syscall.EROFS
+	}
+	h, err := p.inner.Create(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &freezeHandle{Handle: h, frozen: p.frozen}, nil
+}
+
+func (p *FreezeProvider) Mkdir(path string, mode os.FileMode) error {
+	if p.Frozen() {
+		return syscall.EROFS
+	}
+	return p.inner.Mkdir(path, mode)
+}
+
+func (p *FreezeProvider) Chmod(path string, mode os.FileMode) error {
+	if p.Frozen() {
+		return syscall.EROFS
+	}
+	return p.inner.Chmod(path, mode)
+}
+
+func (p *FreezeProvider) Remove(path string) error {
+	if p.Frozen() {
+		return syscall.EROFS
+	}
+	return p.inner.Remove(path)
+}
+
+func (p *FreezeProvider) RemoveAll(path string) error {
+	if p.Frozen() {
+		return syscall.EROFS
+	}
+	return p.inner.RemoveAll(path)
+}
+
+func (p *FreezeProvider) Rename(oldPath, newPath string) error {
+	if p.Frozen() {
+		return syscall.EROFS
+	}
+	return p.inner.Rename(oldPath, newPath)
+}
+
+func (p *FreezeProvider) Symlink(target, link string) error {
+	if p.Frozen() {
+		return syscall.EROFS
+	}
+	return p.inner.Symlink(target, link)
+}
+
+func (p *FreezeProvider) Link(oldPath, newPath string) error {
+	if p.Frozen() {
+		return syscall.EROFS
+	}
+	return p.inner.Link(oldPath, newPath)
+}
+
+type freezeHandle struct {
+	Handle
+	frozen *atomic.Bool
+}
+
+func (h *freezeHandle) Write(p []byte) (int, error) {
+	if h.frozen.Load() {
+		return 0, syscall.EROFS
+	}
+	return h.Handle.Write(p)
+}
+
+func (h *freezeHandle) WriteAt(p []byte, off int64) (int, error) {
+	if h.frozen.Load() {
+		return 0, syscall.EROFS
+	}
+	return h.Handle.WriteAt(p, off)
+}
+
+func (h *freezeHandle) Truncate(size int64) error {
+	if h.frozen.Load() {
+		return syscall.EROFS
+	}
+	return h.Handle.Truncate(size)
+}
@@ -0,0 +1,62 @@
+package vfs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreezeProvider_BlocksWritesWhileFrozen(t *testing.T) {
+	base := NewMemoryProvider()
+	fp := NewFreezeProvider(base)
+
+	h, err := fp.Create("/file.txt", 0644)
+	require.NoError(t, err)
+	_, err = h.Write([]byte("before"))
+	require.NoError(t, err)
+
+	fp.SetFrozen(true)
+	assert.True(t, fp.Frozen())
+
+	_, err = h.Write([]byte("during"))
+	assert.ErrorIs(t, err, syscall.EROFS, "handles opened before the freeze must not write")
+	assert.ErrorIs(t, h.Truncate(0), syscall.EROFS)
+	require.NoError(t, h.Close())
+
+	_, err = fp.Create("/new.txt", 0644)
+	assert.ErrorIs(t, err, syscall.EROFS)
+	_, err = fp.Open("/file.txt", os.O_WRONLY, 0)
+	assert.ErrorIs(t, err, syscall.EROFS)
+	assert.ErrorIs(t, fp.Mkdir("/dir", 0755), syscall.EROFS)
+	assert.ErrorIs(t, fp.Chmod("/file.txt", 0600), syscall.EROFS)
+	assert.ErrorIs(t, fp.Remove("/file.txt"), syscall.EROFS)
+	assert.ErrorIs(t, fp.RemoveAll("/file.txt"), syscall.EROFS)
+	assert.ErrorIs(t, fp.Rename("/file.txt", "/moved.txt"), syscall.EROFS)
+	assert.ErrorIs(t, fp.Symlink("/file.txt", "/link"), syscall.EROFS)
+
+	rh, err := fp.Open("/file.txt", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	buf := make([]byte, 16)
+	n, _ := rh.Read(buf)
+	assert.Equal(t, "before", string(buf[:n]))
+	require.NoError(t, rh.Close())
+
+	fp.SetFrozen(false)
+	require.NoError(t, fp.Mkdir("/dir", 0755))
+	require.NoError(t, fp.Rename("/file.txt", "/dir/file.txt"))
+}
+
+func TestFreezeProvider_WithCallerSharesState(t *testing.T) {
+	base := NewMemoryProvider()
+	hooks := NewHookEngine(nil)
+	fp := NewFreezeProvider(NewInterceptProvider(base, hooks))
+
+	caller := fp.withCaller(1000, 1000)
+	fp.SetFrozen(true)
+
+	_, err := caller.Create("/file.txt", 0644)
+	assert.ErrorIs(t, err, syscall.EROFS)
+}
@@ -24,6 +24,7 @@ const (
 	HookOpRename    HookOp = "rename"
 	HookOpSymlink   HookOp = "symlink"
 	HookOpReadlink  HookOp = "readlink"
+	HookOpLink      HookOp = "link"
 	HookOpRead      HookOp = "read"
 	HookOpWrite     HookOp = "write"
 	HookOpClose     HookOp = "close"
@@ -89,10 +90,12 @@ type HookResult struct {
 type MutateWriteFunc func(ctx context.Context, req MutateWriteRequest) ([]byte, error)
 
 // MutateWriteRequest contains metadata for write mutation decisions.
+// Data is the write being mutated; callers must not retain or modify it.
 type MutateWriteRequest struct {
 	Path   string
 	Offset int64
 	Size   int
+	Data   []byte
 	Mode   os.FileMode
 	UID    int
 	GID    int
@@ -384,6 +387,7 @@ func compileHooksFromRules(rules []HookRule) []Hook {
 						Path:   req.Path,
 						Offset: req.Offset,
 						Size:   len(req.Data),
+						Data:   req.Data,
 						Mode:   req.Mode,
 						UID:    req.UID,
 						GID:    req.GID,
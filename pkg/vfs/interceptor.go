@@ -1,7 +1,9 @@
 package vfs
 
 import (
+	"io"
 	"os"
+	"sync"
 	"syscall"
 )
 
@@ -186,12 +188,57 @@ func (p *interceptProvider) Readlink(path string) (string, error) {
 	return result, err
 }
 
+func (p *interceptProvider) Link(oldPath, newPath string) error {
+	req := p.baseRequest(HookOpLink, oldPath)
+	req.NewPath = newPath
+	if err := p.hooks.Before(&req); err != nil {
+		return err
+	}
+	err := p.inner.Link(req.Path, req.NewPath)
+	p.hooks.After(req, HookResult{Err: err})
+	return err
+}
+
 type interceptHandle struct {
 	inner Handle
 	hooks *HookEngine
 	path  string
 	uid   int
 	gid   int
+
+	// shifts records where mutate hooks changed the length of a write, so
+	// later writes land after the mutated bytes rather than at the offset
+	// the guest, which only knows its own byte counts, asked for.
+	mu     sync.Mutex
+	shifts []writeShift
+}
+
+// writeShift moves guest offsets at or past from by delta bytes.
+type writeShift struct {
+	from  int64
+	delta int64
+}
+
+// fileOffset maps a guest write offset to the file offset it lands at.
+func (h *interceptHandle) fileOffset(off int64) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fileOff := off
+	for _, s := range h.shifts {
+		if off >= s.from {
+			fileOff += s.delta
+		}
+	}
+	return fileOff
+}
+
+func (h *interceptHandle) addShift(from, delta int64) {
+	if delta == 0 {
+		return
+	}
+	h.mu.Lock()
+	h.shifts = append(h.shifts, writeShift{from: from, delta: delta})
+	h.mu.Unlock()
 }
 
 func (h *interceptHandle) Read(p []byte) (int, error) {
@@ -216,16 +263,18 @@ func (h *interceptHandle) ReadAt(p []byte, off int64) (int, error) {
 
 func (h *interceptHandle) Write(p []byte) (int, error) {
 	req := HookRequest{Op: HookOpWrite, Path: h.path, Data: append([]byte(nil), p...), UID: h.uid, GID: h.gid}
+	if pos, err := h.inner.Seek(0, io.SeekCurrent); err == nil {
+		req.Offset = pos
+	}
 	h.populateWriteMetadata(&req)
 	if err := h.hooks.Before(&req); err != nil {
 		return 0, err
 	}
-	origLen := len(p)
 	n, err := h.inner.Write(req.Data)
+	result := HookResult{Err: err, Bytes: n}
 	if err == nil && n == len(req.Data) {
-		n = origLen
+		n = len(p)
 	}
-	result := HookResult{Err: err, Bytes: n}
 	if info, statErr := h.inner.Stat(); statErr == nil {
 		result.Meta = fileMetaFromInfo(info)
 	}
@@ -234,17 +283,18 @@ func (h *interceptHandle) Write(p []byte) (int, error) {
 }
 
 func (h *interceptHandle) WriteAt(p []byte, off int64) (int, error) {
-	req := HookRequest{Op: HookOpWrite, Path: h.path, Offset: off, Data: append([]byte(nil), p...), UID: h.uid, GID: h.gid}
+	fileOff := h.fileOffset(off)
+	req := HookRequest{Op: HookOpWrite, Path: h.path, Offset: fileOff, Data: append([]byte(nil), p...), UID: h.uid, GID: h.gid}
 	h.populateWriteMetadata(&req)
 	if err := h.hooks.Before(&req); err != nil {
 		return 0, err
 	}
-	origLen := len(p)
-	n, err := h.inner.WriteAt(req.Data, off)
+	n, err := h.inner.WriteAt(req.Data, fileOff)
+	result := HookResult{Err: err, Bytes: n}
 	if err == nil && n == len(req.Data) {
-		n = origLen
+		h.addShift(off+int64(len(p)), int64(len(req.Data)-len(p)))
+		n = len(p)
 	}
-	result := HookResult{Err: err, Bytes: n}
 	if info, statErr := h.inner.Stat(); statErr == nil {
 		result.Meta = fileMetaFromInfo(info)
 	}
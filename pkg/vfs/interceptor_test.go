@@ -1,6 +1,7 @@
 package vfs
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -118,6 +119,7 @@ func TestInterceptProvider_BeforeMutateWriteDynamic(t *testing.T) {
 				assert.Equal(t, os.FileMode(0644), req.Mode.Perm())
 				assert.Equal(t, os.Geteuid(), req.UID)
 				assert.Equal(t, os.Getegid(), req.GID)
+				assert.Equal(t, "payload", string(req.Data))
 				return []byte(strings.Repeat("X", req.Size) + ":" + req.Path), nil
 			},
 		},
@@ -144,6 +146,53 @@ func TestInterceptProvider_BeforeMutateWriteDynamic(t *testing.T) {
 	assert.Equal(t, "XXXXXXX:/mutate-dyn.txt", string(buf[:n]))
 }
 
+func TestInterceptProvider_MutateWriteReportsFileOffsets(t *testing.T) {
+	var offsets []int64
+	hooks := NewHookEngine([]HookRule{
+		{
+			Phase:       HookPhaseBefore,
+			Ops:         []HookOp{HookOpWrite},
+			PathPattern: "/grow.txt",
+			Action:      HookActionMutateWrite,
+			MutateWriteFunc: func(ctx context.Context, req MutateWriteRequest) ([]byte, error) {
+				offsets = append(offsets, req.Offset)
+				return bytes.Repeat(req.Data, 2), nil
+			},
+		},
+	})
+	defer hooks.Close()
+
+	var written []int
+	hooks.SetEventFunc(func(req HookRequest, result HookResult) {
+		if req.Op == HookOpWrite {
+			written = append(written, result.Bytes)
+		}
+	})
+
+	provider := NewInterceptProvider(NewMemoryProvider(), hooks)
+	h, err := provider.Create("/grow.txt", 0644)
+	require.NoError(t, err)
+	n, err := h.WriteAt([]byte("ab"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "the guest sees its own byte count")
+	_, err = h.WriteAt([]byte("cd"), 2)
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+
+	assert.Equal(t, []int64{0, 4}, offsets)
+	assert.Equal(t, []int{4, 4}, written)
+
+	h, err = provider.Open("/grow.txt", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	defer h.Close()
+	buf := make([]byte, 16)
+	n, err = h.Read(buf)
+	if err != nil && err != io.EOF {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "ababcdcd", string(buf[:n]))
+}
+
 func TestInterceptProvider_BeforeMutateWriteDynamicError(t *testing.T) {
 	wantErr := errors.New("mutate denied")
 	hooks := NewHookEngine([]HookRule{
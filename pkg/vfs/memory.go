@@ -16,13 +16,28 @@ type MemoryProvider struct {
 	files    map[string]*memFile
 	dirs     map[string]bool
 	dirModes map[string]os.FileMode
+
+	snapshots   map[SnapshotID]*memSnapshot
+	snapshotSeq int
 }
 
+// memFile is a regular file, or a symlink when mode has os.ModeSymlink, in
+// which case data holds the link target.
 type memFile struct {
 	mu      sync.RWMutex
 	data    []byte
 	mode    os.FileMode
 	modTime time.Time
+	shared  bool // data is referenced by a snapshot
+}
+
+// own gives the file a private copy of data shared with a snapshot. Callers
+// must hold f.mu for writing.
+func (f *memFile) own() {
+	if f.shared {
+		f.data = bytes.Clone(f.data)
+		f.shared = false
+	}
 }
 
 func NewMemoryProvider() *MemoryProvider {
@@ -43,6 +58,30 @@ func (p *MemoryProvider) normPath(path string) string {
 	return path
 }
 
+// maxSymlinkHops bounds how many symlinks follow resolves, like the
+// kernel's MAXSYMLINKS.
+const maxSymlinkHops = 40
+
+// follow resolves path through symlinks in its final component. Callers
+// must hold p.mu.
+func (p *MemoryProvider) follow(path string) (string, error) {
+	for i := 0; i < maxSymlinkHops; i++ {
+		f, ok := p.files[path]
+		if !ok || f.mode&os.ModeSymlink == 0 {
+			return path, nil
+		}
+		f.mu.RLock()
+		target := string(f.data)
+		f.mu.RUnlock()
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = p.normPath(target)
+	}
+	return "", syscall.ELOOP
+}
+
+// Stat reports symlinks themselves rather than their targets.
 func (p *MemoryProvider) Stat(path string) (FileInfo, error) {
 	path = p.normPath(path)
 	p.mu.RLock()
@@ -124,6 +163,12 @@ func (p *MemoryProvider) ReadDir(path string) ([]DirEntry, error) {
 
 func (p *MemoryProvider) Open(path string, flags int, mode os.FileMode) (Handle, error) {
 	path = p.normPath(path)
+	p.mu.RLock()
+	path, err := p.follow(path)
+	p.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
 
 	if flags&os.O_CREATE != 0 {
 		p.mu.Lock()
@@ -184,6 +229,11 @@ func (p *MemoryProvider) Chmod(path string, mode os.FileMode) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	path, err := p.follow(path)
+	if err != nil {
+		return err
+	}
+
 	if p.dirs[path] {
 		p.dirModes[path] = mode
 		return nil
@@ -276,11 +326,67 @@ func (p *MemoryProvider) Rename(oldPath, newPath string) error {
 }
 
 func (p *MemoryProvider) Symlink(target, link string) error {
-	return syscall.ENOSYS
+	link = p.normPath(link)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.dirs[filepath.Dir(link)] {
+		return syscall.ENOENT
+	}
+	if _, exists := p.files[link]; exists || p.dirs[link] {
+		return syscall.EEXIST
+	}
+	p.files[link] = &memFile{
+		data:    []byte(target),
+		mode:    os.ModeSymlink | 0777,
+		modTime: time.Now(),
+	}
+	return nil
 }
 
 func (p *MemoryProvider) Readlink(path string) (string, error) {
-	return "", syscall.ENOSYS
+	path = p.normPath(path)
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	f, ok := p.files[path]
+	if !ok {
+		if p.dirs[path] {
+			return "", syscall.EINVAL
+		}
+		return "", syscall.ENOENT
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.mode&os.ModeSymlink == 0 {
+		return "", syscall.EINVAL
+	}
+	return string(f.data), nil
+}
+
+// Link makes newPath another name for the file at oldPath; writes through
+// either name are seen through both.
+func (p *MemoryProvider) Link(oldPath, newPath string) error {
+	oldPath = p.normPath(oldPath)
+	newPath = p.normPath(newPath)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, ok := p.files[oldPath]
+	if !ok {
+		if p.dirs[oldPath] {
+			return syscall.EPERM
+		}
+		return syscall.ENOENT
+	}
+	if !p.dirs[filepath.Dir(newPath)] {
+		return syscall.ENOENT
+	}
+	if _, exists := p.files[newPath]; exists || p.dirs[newPath] {
+		return syscall.EEXIST
+	}
+	p.files[newPath] = f
+	return nil
 }
 
 type memHandle struct {
@@ -319,6 +425,7 @@ func (h *memHandle) Write(p []byte) (int, error) {
 func (h *memHandle) WriteAt(p []byte, off int64) (int, error) {
 	h.file.mu.Lock()
 	defer h.file.mu.Unlock()
+	h.file.own()
 
 	end := off + int64(len(p))
 	if end > int64(len(h.file.data)) {
@@ -365,6 +472,7 @@ func (h *memHandle) Sync() error {
 func (h *memHandle) Truncate(size int64) error {
 	h.file.mu.Lock()
 	defer h.file.mu.Unlock()
+	h.file.own()
 
 	if size < int64(len(h.file.data)) {
 		h.file.data = h.file.data[:size]
@@ -386,6 +494,21 @@ func (p *MemoryProvider) WriteFile(path string, data []byte, mode os.FileMode) e
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	path, err := p.follow(path)
+	if err != nil {
+		return err
+	}
+	if f, ok := p.files[path]; ok {
+		// Write in place so hard links see the new contents.
+		f.mu.Lock()
+		f.data = bytes.Clone(data)
+		f.mode = mode
+		f.modTime = time.Now()
+		f.shared = false
+		f.mu.Unlock()
+		return nil
+	}
+
 	dir := filepath.Dir(path)
 	if !p.dirs[dir] {
 		return syscall.ENOENT
@@ -404,6 +527,11 @@ func (p *MemoryProvider) ReadFile(path string) ([]byte, error) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
+	path, err := p.follow(path)
+	if err != nil {
+		return nil, err
+	}
+
 	f, ok := p.files[path]
 	if !ok {
 		return nil, syscall.ENOENT
@@ -3,6 +3,7 @@ package vfs
 import (
 	"io"
 	"os"
+	"syscall"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -158,3 +159,62 @@ func TestMemoryProvider_Truncate(t *testing.T) {
 	content, _ := mp.ReadFile("/trunc.txt")
 	assert.Equal(t, "01234", string(content))
 }
+
+func TestMemoryProvider_Symlink(t *testing.T) {
+	mp := NewMemoryProvider()
+	require.NoError(t, mp.WriteFile("/target.txt", []byte("data"), 0644))
+	require.NoError(t, mp.Symlink("target.txt", "/link"))
+	require.NoError(t, mp.Symlink("/link", "/abs"))
+
+	info, err := mp.Stat("/link")
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeSymlink, info.Mode().Type())
+	assert.Equal(t, int64(len("target.txt")), info.Size())
+
+	target, err := mp.Readlink("/abs")
+	require.NoError(t, err)
+	assert.Equal(t, "/link", target)
+	_, err = mp.Readlink("/target.txt")
+	assert.ErrorIs(t, err, syscall.EINVAL)
+
+	data, err := mp.ReadFile("/abs")
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+	require.NoError(t, mp.Chmod("/abs", 0600))
+	info, err = mp.Stat("/target.txt")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm(), "chmod follows the link")
+
+	assert.ErrorIs(t, mp.Symlink("x", "/link"), syscall.EEXIST)
+	assert.ErrorIs(t, mp.Symlink("x", "/missing/link"), syscall.ENOENT)
+
+	require.NoError(t, mp.Symlink("loop-b", "/loop-a"))
+	require.NoError(t, mp.Symlink("loop-a", "/loop-b"))
+	_, err = mp.Open("/loop-a", os.O_RDONLY, 0)
+	assert.ErrorIs(t, err, syscall.ELOOP)
+
+	require.NoError(t, mp.Remove("/link"))
+	_, err = mp.ReadFile("/abs")
+	assert.ErrorIs(t, err, syscall.ENOENT, "dangling link")
+}
+
+func TestMemoryProvider_Link(t *testing.T) {
+	mp := NewMemoryProvider()
+	require.NoError(t, mp.WriteFile("/a.txt", []byte("one"), 0644))
+	require.NoError(t, mp.Link("/a.txt", "/b.txt"))
+	require.NoError(t, mp.WriteFile("/b.txt", []byte("two"), 0644))
+
+	data, err := mp.ReadFile("/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(data))
+
+	require.NoError(t, mp.Remove("/a.txt"))
+	data, err = mp.ReadFile("/b.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(data))
+
+	require.NoError(t, mp.Mkdir("/dir", 0755))
+	assert.ErrorIs(t, mp.Link("/dir", "/dir2"), syscall.EPERM)
+	assert.ErrorIs(t, mp.Link("/b.txt", "/dir"), syscall.EEXIST)
+	assert.ErrorIs(t, mp.Link("/missing", "/c.txt"), syscall.ENOENT)
+}
@@ -0,0 +1,426 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// OverlayProvider merges a writable upper provider over a lower one, like
+// overlayfs. Reads fall through to lower for paths upper does not have;
+// writes copy the file (or directory) up first, so lower is never modified.
+// Removing a path that exists in lower records a whiteout that hides it.
+// Whiteouts are kept in memory and last as long as the provider.
+type OverlayProvider struct {
+	mu    sync.Mutex
+	upper Provider
+	lower Provider
+	// whiteouts hides these lower paths and everything under them.
+	whiteouts map[string]bool
+	// opaque directories were recreated in upper after a whiteout, so
+	// their lower contents stay hidden.
+	opaque map[string]bool
+}
+
+func NewOverlayProvider(upper, lower Provider) *OverlayProvider {
+	return &OverlayProvider{
+		upper:     upper,
+		lower:     lower,
+		whiteouts: make(map[string]bool),
+		opaque:    make(map[string]bool),
+	}
+}
+
+func (p *OverlayProvider) Readonly() bool { return p.upper.Readonly() }
+
+func (p *OverlayProvider) normPath(path string) string {
+	path = filepath.Clean(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return path
+}
+
+// lowerVisible reports whether path may be served from lower.
+func (p *OverlayProvider) lowerVisible(path string) bool {
+	if p.whiteouts[path] {
+		return false
+	}
+	for dir := path; dir != "/"; {
+		dir = filepath.Dir(dir)
+		if p.whiteouts[dir] || p.opaque[dir] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *OverlayProvider) inUpper(path string) bool {
+	_, err := p.upper.Stat(path)
+	return err == nil
+}
+
+func (p *OverlayProvider) inLower(path string) bool {
+	if !p.lowerVisible(path) {
+		return false
+	}
+	_, err := p.lower.Stat(path)
+	return err == nil
+}
+
+func (p *OverlayProvider) stat(path string) (FileInfo, error) {
+	info, err := p.upper.Stat(path)
+	if err == nil || !isMissingPathError(err) {
+		return info, err
+	}
+	if !p.lowerVisible(path) {
+		return FileInfo{}, syscall.ENOENT
+	}
+	return p.lower.Stat(path)
+}
+
+// unhide makes path, now created in upper, visible again. A directory
+// recreated over a whiteout must not show the old lower contents.
+func (p *OverlayProvider) unhide(path string, isDir bool) {
+	if p.whiteouts[path] {
+		delete(p.whiteouts, path)
+		if isDir {
+			p.opaque[path] = true
+		}
+	}
+}
+
+func (p *OverlayProvider) Stat(path string) (FileInfo, error) {
+	path = p.normPath(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stat(path)
+}
+
+func (p *OverlayProvider) ReadDir(path string) ([]DirEntry, error) {
+	path = p.normPath(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.readDir(path)
+}
+
+func (p *OverlayProvider) readDir(path string) ([]DirEntry, error) {
+	if info, err := p.upper.Stat(path); err == nil && !info.IsDir() {
+		return nil, syscall.ENOTDIR
+	}
+	upperEntries, upperErr := p.upper.ReadDir(path)
+	if upperErr != nil && !isMissingPathError(upperErr) {
+		return nil, upperErr
+	}
+	if !p.lowerVisible(path) || p.opaque[path] {
+		return upperEntries, upperErr
+	}
+	lowerEntries, lowerErr := p.lower.ReadDir(path)
+	if upperErr != nil {
+		if lowerErr != nil {
+			return nil, upperErr
+		}
+		upperEntries = nil
+	}
+
+	seen := make(map[string]bool, len(upperEntries))
+	for _, entry := range upperEntries {
+		seen[entry.Name()] = true
+	}
+	entries := upperEntries
+	for _, entry := range lowerEntries {
+		if seen[entry.Name()] || p.whiteouts[filepath.Join(path, entry.Name())] {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (p *OverlayProvider) Open(path string, flags int, mode os.FileMode) (Handle, error) {
+	path = p.normPath(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if flags&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) == 0 {
+		if p.inUpper(path) || !p.lowerVisible(path) {
+			return p.upper.Open(path, flags, mode)
+		}
+		return p.lower.Open(path, flags, mode)
+	}
+
+	if p.inLower(path) {
+		if err := p.copyUp(path); err != nil {
+			return nil, err
+		}
+	} else if err := p.ensureUpperDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	h, err := p.upper.Open(path, flags, mode)
+	if err != nil {
+		return nil, err
+	}
+	p.unhide(path, false)
+	return h, nil
+}
+
+func (p *OverlayProvider) Create(path string, mode os.FileMode) (Handle, error) {
+	return p.Open(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+}
+
+func (p *OverlayProvider) Mkdir(path string, mode os.FileMode) error {
+	path = p.normPath(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.stat(path); err == nil {
+		return syscall.EEXIST
+	}
+	if err := p.ensureUpperDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	if err := p.upper.Mkdir(path, mode); err != nil {
+		return err
+	}
+	p.unhide(path, true)
+	return nil
+}
+
+func (p *OverlayProvider) Chmod(path string, mode os.FileMode) error {
+	path = p.normPath(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.copyUp(path); err != nil {
+		return err
+	}
+	return p.upper.Chmod(path, mode)
+}
+
+func (p *OverlayProvider) Remove(path string) error {
+	path = p.normPath(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := p.stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		entries, err := p.readDir(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return syscall.ENOTEMPTY
+		}
+	}
+	return p.remove(path, p.upper.Remove)
+}
+
+func (p *OverlayProvider) RemoveAll(path string) error {
+	path = p.normPath(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.remove(path, p.upper.RemoveAll)
+}
+
+func (p *OverlayProvider) remove(path string, removeUpper func(string) error) error {
+	if p.inUpper(path) {
+		if err := removeUpper(path); err != nil {
+			return err
+		}
+	}
+	if p.inLower(path) {
+		p.whiteouts[path] = true
+	}
+	delete(p.opaque, path)
+	return nil
+}
+
+func (p *OverlayProvider) Rename(oldPath, newPath string) error {
+	oldPath = p.normPath(oldPath)
+	newPath = p.normPath(newPath)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := p.stat(oldPath)
+	if err != nil {
+		return err
+	}
+	if err := p.copyUpTree(oldPath); err != nil {
+		return err
+	}
+	if err := p.ensureUpperDir(filepath.Dir(newPath)); err != nil {
+		return err
+	}
+	if err := p.upper.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	if p.inLower(oldPath) {
+		p.whiteouts[oldPath] = true
+	}
+	delete(p.opaque, oldPath)
+	// As in unhide: a directory landing on a whiteout must not show the
+	// deleted lower contents once the whiteout is cleared.
+	if info.IsDir() && (p.whiteouts[newPath] || p.inLower(newPath)) {
+		p.opaque[newPath] = true
+	}
+	delete(p.whiteouts, newPath)
+	return nil
+}
+
+func (p *OverlayProvider) Symlink(target, link string) error {
+	link = p.normPath(link)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.stat(link); err == nil {
+		return syscall.EEXIST
+	}
+	if err := p.ensureUpperDir(filepath.Dir(link)); err != nil {
+		return err
+	}
+	if err := p.upper.Symlink(target, link); err != nil {
+		return err
+	}
+	p.unhide(link, false)
+	return nil
+}
+
+// Link copies oldPath up to the upper layer if needed and links it there.
+func (p *OverlayProvider) Link(oldPath, newPath string) error {
+	oldPath = p.normPath(oldPath)
+	newPath = p.normPath(newPath)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := p.stat(oldPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return syscall.EPERM
+	}
+	if _, err := p.stat(newPath); err == nil {
+		return syscall.EEXIST
+	}
+	if err := p.copyUp(oldPath); err != nil {
+		return err
+	}
+	if err := p.ensureUpperDir(filepath.Dir(newPath)); err != nil {
+		return err
+	}
+	if err := p.upper.Link(oldPath, newPath); err != nil {
+		return err
+	}
+	p.unhide(newPath, false)
+	return nil
+}
+
+func (p *OverlayProvider) Readlink(path string) (string, error) {
+	path = p.normPath(path)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.inUpper(path) || !p.lowerVisible(path) {
+		return p.upper.Readlink(path)
+	}
+	return p.lower.Readlink(path)
+}
+
+// ensureUpperDir creates dir and its missing parents in upper, copying the
+// modes of the merged view.
+func (p *OverlayProvider) ensureUpperDir(dir string) error {
+	if dir == "/" || p.inUpper(dir) {
+		return nil
+	}
+	info, err := p.stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return syscall.ENOTDIR
+	}
+	if err := p.ensureUpperDir(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	return p.upper.Mkdir(dir, info.Mode().Perm())
+}
+
+// copyUp copies path from lower to upper unless upper already has it.
+// Directories are created empty; see copyUpTree.
+func (p *OverlayProvider) copyUp(path string) error {
+	if p.inUpper(path) {
+		return nil
+	}
+	if !p.lowerVisible(path) {
+		return syscall.ENOENT
+	}
+	info, err := p.lower.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := p.ensureUpperDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	switch {
+	case info.IsDir():
+		return p.upper.Mkdir(path, info.Mode().Perm())
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := p.lower.Readlink(path)
+		if err != nil {
+			return err
+		}
+		return p.upper.Symlink(target, path)
+	}
+
+	src, err := p.lower.Open(path, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := p.upper.Create(path, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		_ = p.upper.Remove(path)
+		return err
+	}
+	return dst.Close()
+}
+
+// copyUpTree copies path and, for a directory, everything visible under
+// it, so the whole tree can be renamed within upper.
+func (p *OverlayProvider) copyUpTree(path string) error {
+	if err := p.copyUp(path); err != nil {
+		return err
+	}
+	if p.opaque[path] || !p.lowerVisible(path) {
+		return nil
+	}
+	info, err := p.lower.Stat(path)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	entries, err := p.lower.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		if p.whiteouts[child] {
+			continue
+		}
+		if err := p.copyUpTree(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
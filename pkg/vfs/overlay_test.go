@@ -0,0 +1,142 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"sort"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOverlay(t *testing.T) (*OverlayProvider, *MemoryProvider, *MemoryProvider) {
+	t.Helper()
+	lower := NewMemoryProvider()
+	require.NoError(t, lower.MkdirAll("/src/pkg", 0755))
+	require.NoError(t, lower.WriteFile("/src/main.go", []byte("package main"), 0644))
+	require.NoError(t, lower.WriteFile("/src/pkg/util.go", []byte("package pkg"), 0644))
+	upper := NewMemoryProvider()
+	return NewOverlayProvider(upper, NewReadonlyProvider(lower)), upper, lower
+}
+
+func readOverlayFile(t *testing.T, p Provider, path string) string {
+	t.Helper()
+	h, err := p.Open(path, os.O_RDONLY, 0)
+	require.NoError(t, err)
+	defer h.Close()
+	data, err := io.ReadAll(h)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func overlayNames(t *testing.T, p Provider, path string) []string {
+	t.Helper()
+	entries, err := p.ReadDir(path)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestOverlayProviderReadsThroughToLower(t *testing.T) {
+	p, _, _ := newTestOverlay(t)
+
+	assert.Equal(t, "package main", readOverlayFile(t, p, "/src/main.go"))
+	info, err := p.Stat("/src/pkg")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	assert.False(t, p.Readonly())
+}
+
+func TestOverlayProviderCopiesUpOnWrite(t *testing.T) {
+	p, upper, lower := newTestOverlay(t)
+
+	h, err := p.Open("/src/pkg/util.go", os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = h.Seek(0, io.SeekEnd)
+	require.NoError(t, err)
+	_, err = h.Write([]byte("\n// changed"))
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+
+	assert.Equal(t, "package pkg\n// changed", readOverlayFile(t, p, "/src/pkg/util.go"))
+	data, err := lower.ReadFile("/src/pkg/util.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package pkg", string(data))
+	data, err = upper.ReadFile("/src/pkg/util.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package pkg\n// changed", string(data))
+
+	h, err = p.Create("/src/new.go", 0644)
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+	assert.Equal(t, []string{"main.go", "new.go", "pkg"}, overlayNames(t, p, "/src"))
+}
+
+func TestOverlayProviderRemoveHidesLowerPaths(t *testing.T) {
+	p, _, lower := newTestOverlay(t)
+
+	require.NoError(t, p.Remove("/src/main.go"))
+	_, err := p.Stat("/src/main.go")
+	assert.ErrorIs(t, err, syscall.ENOENT)
+	assert.Equal(t, []string{"pkg"}, overlayNames(t, p, "/src"))
+	_, err = lower.Stat("/src/main.go")
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, p.Remove("/src/pkg"), syscall.ENOTEMPTY)
+	require.NoError(t, p.RemoveAll("/src/pkg"))
+	_, err = p.Stat("/src/pkg/util.go")
+	assert.ErrorIs(t, err, syscall.ENOENT)
+
+	// A directory recreated after removal starts empty.
+	require.NoError(t, p.Mkdir("/src/pkg", 0755))
+	assert.Empty(t, overlayNames(t, p, "/src/pkg"))
+
+	h, err := p.Create("/src/main.go", 0644)
+	require.NoError(t, err)
+	_, err = h.Write([]byte("package other"))
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+	assert.Equal(t, "package other", readOverlayFile(t, p, "/src/main.go"))
+}
+
+func TestOverlayProviderRename(t *testing.T) {
+	p, _, _ := newTestOverlay(t)
+
+	require.NoError(t, p.Rename("/src/main.go", "/src/app.go"))
+	assert.Equal(t, "package main", readOverlayFile(t, p, "/src/app.go"))
+	_, err := p.Stat("/src/main.go")
+	assert.ErrorIs(t, err, syscall.ENOENT)
+	assert.Equal(t, []string{"app.go", "pkg"}, overlayNames(t, p, "/src"))
+}
+
+func TestOverlayProviderRenameDirOverWhiteout(t *testing.T) {
+	p, _, _ := newTestOverlay(t)
+
+	require.NoError(t, p.RemoveAll("/src/pkg"))
+	require.NoError(t, p.Mkdir("/build", 0755))
+	require.NoError(t, p.Rename("/build", "/src/pkg"))
+
+	info, err := p.Stat("/src/pkg")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	assert.Empty(t, overlayNames(t, p, "/src/pkg"), "deleted lower entries must stay hidden")
+	_, err = p.Stat("/src/pkg/util.go")
+	assert.ErrorIs(t, err, syscall.ENOENT)
+}
+
+func TestOverlayProviderReadonlyUpper(t *testing.T) {
+	lower := NewMemoryProvider()
+	require.NoError(t, lower.WriteFile("/a.txt", []byte("a"), 0644))
+	p := NewOverlayProvider(NewReadonlyProvider(NewMemoryProvider()), lower)
+
+	assert.True(t, p.Readonly())
+	_, err := p.Create("/b.txt", 0644)
+	assert.ErrorIs(t, err, syscall.EROFS)
+	assert.Equal(t, "a", readOverlayFile(t, p, "/a.txt"))
+}
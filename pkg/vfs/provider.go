@@ -20,6 +20,7 @@ type Provider interface {
 	Rename(oldPath, newPath string) error
 	Symlink(target, link string) error
 	Readlink(path string) (string, error)
+	Link(oldPath, newPath string) error
 }
 
 type Handle interface {
@@ -41,6 +42,8 @@ type FileInfo struct {
 	modTime time.Time
 	isDir   bool
 	sys     any
+	uid     uint32
+	gid     uint32
 }
 
 func (fi FileInfo) Name() string       { return fi.name }
@@ -50,6 +53,17 @@ func (fi FileInfo) ModTime() time.Time { return fi.modTime }
 func (fi FileInfo) IsDir() bool        { return fi.isDir }
 func (fi FileInfo) Sys() any           { return fi.sys }
 
+// Owner returns the owner reported to the guest. Providers that do not set
+// one report root.
+func (fi FileInfo) Owner() (uid, gid uint32) { return fi.uid, fi.gid }
+
+// WithOwner returns a copy of fi reporting uid and gid to the guest.
+func (fi FileInfo) WithOwner(uid, gid uint32) FileInfo {
+	fi.uid = uid
+	fi.gid = gid
+	return fi
+}
+
 func NewFileInfo(name string, size int64, mode os.FileMode, modTime time.Time, isDir bool) FileInfo {
 	return NewFileInfoWithSys(name, size, mode, modTime, isDir, nil)
 }
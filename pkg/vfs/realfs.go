@@ -1,37 +1,193 @@
 package vfs
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
 )
 
+// RealFSProvider serves a host directory, or a single host file. Paths in a
+// directory are resolved through an os.Root, so neither ".." nor a symlink
+// (including one the guest created) reaches anything outside it on the
+// host. Stat reports symlinks themselves rather than following them; the
+// guest resolves them.
 type RealFSProvider struct {
 	root string
+	uid  *IDMap
+	gid  *IDMap
+
+	mu sync.Mutex
+	fs hostFS
+}
+
+// hostFS is the subset of *os.Root RealFSProvider uses.
+type hostFS interface {
+	Lstat(name string) (os.FileInfo, error)
+	Open(name string) (*os.File, error)
+	OpenFile(name string, flag int, perm os.FileMode) (*os.File, error)
+	Mkdir(name string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	Lchown(name string, uid, gid int) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldname, newname string) error
+	Symlink(oldname, newname string) error
+	Readlink(name string) (string, error)
+	Link(oldname, newname string) error
+}
+
+// fileFS serves a single-file mount straight from its host path. The guest
+// cannot add entries under a file, so there is nothing to confine, and the
+// host path the user named is followed even if it is a symlink.
+type fileFS string
+
+func (f fileFS) path(name string) string { return filepath.Join(string(f), name) }
+
+func (f fileFS) Lstat(name string) (os.FileInfo, error) { return os.Stat(f.path(name)) }
+func (f fileFS) Open(name string) (*os.File, error)     { return os.Open(f.path(name)) }
+func (f fileFS) OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	return os.OpenFile(f.path(name), flag, perm)
+}
+func (f fileFS) Mkdir(name string, perm os.FileMode) error { return os.Mkdir(f.path(name), perm) }
+func (f fileFS) Chmod(name string, mode os.FileMode) error { return os.Chmod(f.path(name), mode) }
+func (f fileFS) Lchown(name string, uid, gid int) error    { return os.Lchown(f.path(name), uid, gid) }
+func (f fileFS) Remove(name string) error                  { return os.Remove(f.path(name)) }
+func (f fileFS) RemoveAll(name string) error               { return os.RemoveAll(f.path(name)) }
+func (f fileFS) Rename(oldname, newname string) error {
+	return os.Rename(f.path(oldname), f.path(newname))
+}
+func (f fileFS) Symlink(oldname, newname string) error { return os.Symlink(oldname, f.path(newname)) }
+func (f fileFS) Readlink(name string) (string, error)  { return os.Readlink(f.path(name)) }
+func (f fileFS) Link(oldname, newname string) error    { return os.Link(f.path(oldname), f.path(newname)) }
+
+// IDMap pairs a host user or group ID with the ID the guest sees.
+type IDMap struct {
+	Host  uint32
+	Guest uint32
 }
 
 func NewRealFSProvider(root string) *RealFSProvider {
 	return &RealFSProvider{root: root}
 }
 
+// NewRealFSProviderWithOwners returns a RealFSProvider that remaps
+// ownership. Host files owned by uid.Host appear owned by uid.Guest and
+// everything else appears owned by root, as without remapping. Files,
+// directories and symlinks the guest creates are chowned to uid.Host. gid
+// does the same for groups; a nil map leaves that ID alone.
+func NewRealFSProviderWithOwners(root string, uid, gid *IDMap) *RealFSProvider {
+	return &RealFSProvider{root: root, uid: uid, gid: gid}
+}
+
 func (p *RealFSProvider) Readonly() bool { return false }
 
-func (p *RealFSProvider) realPath(path string) string {
-	return filepath.Join(p.root, filepath.Clean(path))
+// hostRoot opens the mount directory as an os.Root (or a fileFS for a
+// single-file mount) on first use and keeps it for the provider's lifetime.
+func (p *RealFSProvider) hostRoot() (hostFS, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fs == nil {
+		info, err := os.Stat(p.root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			p.fs = fileFS(p.root)
+			return p.fs, nil
+		}
+		root, err := os.OpenRoot(p.root)
+		if err != nil {
+			return nil, err
+		}
+		p.fs = root
+	}
+	return p.fs, nil
+}
+
+// rootName turns a provider path into a name relative to the mount root.
+func rootName(path string) string {
+	name := strings.TrimPrefix(filepath.Clean("/"+path), "/")
+	if name == "" {
+		return "."
+	}
+	return name
 }
 
 func (p *RealFSProvider) Stat(path string) (FileInfo, error) {
-	info, err := os.Stat(p.realPath(path))
+	root, err := p.hostRoot()
+	if err != nil {
+		return FileInfo{}, err
+	}
+	info, err := root.Lstat(rootName(path))
 	if err != nil {
 		return FileInfo{}, err
 	}
-	return NewFileInfoWithSys(info.Name(), info.Size(), info.Mode(), info.ModTime(), info.IsDir(), info.Sys()), nil
+	return p.fileInfo(info.Name(), info), nil
+}
+
+func (p *RealFSProvider) fileInfo(name string, info os.FileInfo) FileInfo {
+	fi := NewFileInfoWithSys(name, info.Size(), info.Mode(), info.ModTime(), info.IsDir(), info.Sys())
+	if p.uid == nil && p.gid == nil {
+		return fi
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi
+	}
+	var uid, gid uint32
+	if p.uid != nil && st.Uid == p.uid.Host {
+		uid = p.uid.Guest
+	}
+	if p.gid != nil && st.Gid == p.gid.Host {
+		gid = p.gid.Guest
+	}
+	return fi.WithOwner(uid, gid)
+}
+
+// chownCreated hands an entry the guest just created to the mapped host
+// owner. If that fails the entry is removed again, so a mount that cannot
+// honour its remap never leaves files with the wrong owner behind.
+func (p *RealFSProvider) chownCreated(path string) error {
+	if p.uid == nil && p.gid == nil {
+		return nil
+	}
+	uid, gid := -1, -1
+	if p.uid != nil {
+		uid = int(p.uid.Host)
+	}
+	if p.gid != nil {
+		gid = int(p.gid.Host)
+	}
+	root, err := p.hostRoot()
+	if err != nil {
+		return err
+	}
+	if err := root.Lchown(rootName(path), uid, gid); err != nil {
+		_ = root.Remove(rootName(path))
+		return err
+	}
+	return nil
 }
 
 func (p *RealFSProvider) ReadDir(path string) ([]DirEntry, error) {
-	entries, err := os.ReadDir(p.realPath(path))
+	root, err := p.hostRoot()
 	if err != nil {
 		return nil, err
 	}
+	dir, err := root.Open(rootName(path))
+	if err != nil {
+		return nil, err
+	}
+	entries, err := dir.ReadDir(-1)
+	dir.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
 
 	result := make([]DirEntry, 0, len(entries))
 	for _, e := range entries {
@@ -43,58 +199,118 @@ func (p *RealFSProvider) ReadDir(path string) ([]DirEntry, error) {
 			e.Name(),
 			e.IsDir(),
 			info.Mode(),
-			NewFileInfoWithSys(e.Name(), info.Size(), info.Mode(), info.ModTime(), e.IsDir(), info.Sys()),
+			p.fileInfo(e.Name(), info),
 		))
 	}
 	return result, nil
 }
 
 func (p *RealFSProvider) Open(path string, flags int, mode os.FileMode) (Handle, error) {
-	f, err := os.OpenFile(p.realPath(path), flags, mode)
+	// Only entries this call creates change owner; opening an existing
+	// file with O_CREATE leaves it alone.
+	root, err := p.hostRoot()
 	if err != nil {
 		return nil, err
 	}
-	return &realHandle{file: f}, nil
-}
-
-func (p *RealFSProvider) Create(path string, mode os.FileMode) (Handle, error) {
-	f, err := os.OpenFile(p.realPath(path), os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
+	creating := false
+	if flags&os.O_CREATE != 0 && (p.uid != nil || p.gid != nil) {
+		_, err := root.Lstat(rootName(path))
+		creating = errors.Is(err, os.ErrNotExist)
+	}
+	f, err := root.OpenFile(rootName(path), flags, mode)
 	if err != nil {
 		return nil, err
 	}
-	return &realHandle{file: f}, nil
+	if creating {
+		if err := p.chownCreated(path); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &realHandle{file: f, provider: p}, nil
+}
+
+func (p *RealFSProvider) Create(path string, mode os.FileMode) (Handle, error) {
+	return p.Open(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, mode)
 }
 
 func (p *RealFSProvider) Mkdir(path string, mode os.FileMode) error {
-	return os.Mkdir(p.realPath(path), mode)
+	root, err := p.hostRoot()
+	if err != nil {
+		return err
+	}
+	if err := root.Mkdir(rootName(path), mode); err != nil {
+		return err
+	}
+	return p.chownCreated(path)
 }
 
 func (p *RealFSProvider) Chmod(path string, mode os.FileMode) error {
-	return os.Chmod(p.realPath(path), mode)
+	root, err := p.hostRoot()
+	if err != nil {
+		return err
+	}
+	return root.Chmod(rootName(path), mode)
 }
 
 func (p *RealFSProvider) Remove(path string) error {
-	return os.Remove(p.realPath(path))
+	root, err := p.hostRoot()
+	if err != nil {
+		return err
+	}
+	return root.Remove(rootName(path))
 }
 
 func (p *RealFSProvider) RemoveAll(path string) error {
-	return os.RemoveAll(p.realPath(path))
+	root, err := p.hostRoot()
+	if err != nil {
+		return err
+	}
+	return root.RemoveAll(rootName(path))
 }
 
 func (p *RealFSProvider) Rename(oldPath, newPath string) error {
-	return os.Rename(p.realPath(oldPath), p.realPath(newPath))
+	root, err := p.hostRoot()
+	if err != nil {
+		return err
+	}
+	return root.Rename(rootName(oldPath), rootName(newPath))
 }
 
+// Symlink stores target verbatim; it is resolved by the guest, never
+// against the host filesystem.
 func (p *RealFSProvider) Symlink(target, link string) error {
-	return os.Symlink(target, p.realPath(link))
+	root, err := p.hostRoot()
+	if err != nil {
+		return err
+	}
+	if err := root.Symlink(target, rootName(link)); err != nil {
+		return err
+	}
+	return p.chownCreated(link)
 }
 
 func (p *RealFSProvider) Readlink(path string) (string, error) {
-	return os.Readlink(p.realPath(path))
+	root, err := p.hostRoot()
+	if err != nil {
+		return "", err
+	}
+	return root.Readlink(rootName(path))
+}
+
+// Link hard-links newPath to oldPath. The new name shares the existing
+// file's owner, so it is not remapped.
+func (p *RealFSProvider) Link(oldPath, newPath string) error {
+	root, err := p.hostRoot()
+	if err != nil {
+		return err
+	}
+	return root.Link(rootName(oldPath), rootName(newPath))
 }
 
 type realHandle struct {
-	file *os.File
+	file     *os.File
+	provider *RealFSProvider
 }
 
 func (h *realHandle) Read(p []byte) (int, error)                { return h.file.Read(p) }
@@ -111,5 +327,5 @@ func (h *realHandle) Stat() (FileInfo, error) {
 	if err != nil {
 		return FileInfo{}, err
 	}
-	return NewFileInfoWithSys(info.Name(), info.Size(), info.Mode(), info.ModTime(), info.IsDir(), info.Sys()), nil
+	return h.provider.fileInfo(info.Name(), info), nil
 }
@@ -0,0 +1,168 @@
+package vfs
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestRealFSProviderReportsRemappedOwner(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.txt"), []byte("x"), 0644))
+	uid, gid := uint32(os.Getuid()), uint32(os.Getgid())
+
+	plain, err := NewRealFSProvider(dir).Stat("/data.txt")
+	require.NoError(t, err)
+	ownerUID, ownerGID := plain.Owner()
+	assert.Zero(t, ownerUID, "without a remap files appear owned by root")
+	assert.Zero(t, ownerGID)
+
+	p := NewRealFSProviderWithOwners(dir, &IDMap{Host: uid, Guest: 1000}, &IDMap{Host: gid, Guest: 2000})
+	info, err := p.Stat("/data.txt")
+	require.NoError(t, err)
+	ownerUID, ownerGID = info.Owner()
+	assert.Equal(t, uint32(1000), ownerUID)
+	assert.Equal(t, uint32(2000), ownerGID)
+
+	entries, err := p.ReadDir("/")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entryInfo, err := entries[0].Info()
+	require.NoError(t, err)
+	ownerUID, ownerGID = entryInfo.(FileInfo).Owner()
+	assert.Equal(t, uint32(1000), ownerUID)
+	assert.Equal(t, uint32(2000), ownerGID)
+
+	h, err := p.Open("/data.txt", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	defer h.Close()
+	info, err = h.Stat()
+	require.NoError(t, err)
+	ownerUID, _ = info.Owner()
+	assert.Equal(t, uint32(1000), ownerUID)
+
+	other := NewRealFSProviderWithOwners(dir, &IDMap{Host: uid + 1, Guest: 1000}, nil)
+	info, err = other.Stat("/data.txt")
+	require.NoError(t, err)
+	ownerUID, _ = info.Owner()
+	assert.Zero(t, ownerUID, "owners outside the map appear as root")
+}
+
+func TestRealFSProviderChownsCreatedEntries(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("chown to another user needs root")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "existing.txt"), []byte("x"), 0644))
+	p, err := BuildProvider(api.MountConfig{
+		Type:     api.MountTypeHostFS,
+		HostPath: dir,
+		HostUID:  intPtr(4242),
+		GuestUID: intPtr(1000),
+		HostGID:  intPtr(4343),
+		GuestGID: intPtr(1000),
+	})
+	require.NoError(t, err)
+
+	h, err := p.Create("/new.txt", 0644)
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+	require.NoError(t, p.Mkdir("/newdir", 0755))
+	require.NoError(t, p.Symlink("new.txt", "/link"))
+	h, err = p.Open("/existing.txt", os.O_CREATE|os.O_RDWR, 0644)
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+
+	for _, name := range []string{"new.txt", "newdir", "link"} {
+		st := lstatT(t, filepath.Join(dir, name))
+		assert.Equal(t, uint32(4242), st.Uid, name)
+		assert.Equal(t, uint32(4343), st.Gid, name)
+	}
+	assert.Zero(t, lstatT(t, filepath.Join(dir, "existing.txt")).Uid, "existing files keep their owner")
+
+	info, err := p.Stat("/new.txt")
+	require.NoError(t, err)
+	ownerUID, ownerGID := info.Owner()
+	assert.Equal(t, uint32(1000), ownerUID)
+	assert.Equal(t, uint32(1000), ownerGID)
+}
+
+func TestRealFSProviderConfinesSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.txt")
+	require.NoError(t, os.WriteFile(secret, []byte("host"), 0600))
+	dir := t.TempDir()
+	p := NewRealFSProvider(dir)
+
+	require.NoError(t, p.Symlink(secret, "/abs"))
+	require.NoError(t, p.Symlink("../"+filepath.Base(outside)+"/secret.txt", "/rel"))
+	require.NoError(t, p.Symlink(outside, "/dirlink"))
+
+	info, err := p.Stat("/abs")
+	require.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink, "Stat reports the link, not its target")
+	target, err := p.Readlink("/abs")
+	require.NoError(t, err)
+	assert.Equal(t, secret, target)
+
+	for _, path := range []string{"/abs", "/rel"} {
+		_, err := p.Open(path, os.O_RDWR, 0)
+		assert.Error(t, err, path)
+	}
+	_, err = p.Create("/dirlink/new.txt", 0644)
+	assert.Error(t, err)
+	_, err = p.ReadDir("/dirlink")
+	assert.Error(t, err)
+	assert.Error(t, p.Chmod("/abs", 0777))
+	assert.Error(t, p.Link("/abs/../../secret.txt", "/stolen"))
+
+	content, err := os.ReadFile(secret)
+	require.NoError(t, err)
+	assert.Equal(t, "host", string(content))
+	st, err := os.Stat(secret)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), st.Mode().Perm())
+	_, err = os.Stat(filepath.Join(outside, "new.txt"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRealFSProviderFileMountFollowsHostSymlink(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "real.conf"), []byte("v1"), 0644))
+	require.NoError(t, os.Symlink("real.conf", filepath.Join(dir, "app.conf")))
+
+	p := NewRealFSProvider(filepath.Join(dir, "app.conf"))
+	info, err := p.Stat("/")
+	require.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	h, err := p.Open("/", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	defer h.Close()
+	buf := make([]byte, 2)
+	_, err = h.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(buf))
+}
+
+func TestStatFromInfoCarriesOwner(t *testing.T) {
+	info := NewFileInfo("f", 1, 0644, time.Time{}, false).WithOwner(1000, 2000)
+	st := statFromInfo("/f", info)
+	assert.Equal(t, uint32(1000), st.UID)
+	assert.Equal(t, uint32(2000), st.GID)
+}
+
+func lstatT(t *testing.T, path string) *syscall.Stat_t {
+	t.Helper()
+	info, err := os.Lstat(path)
+	require.NoError(t, err)
+	return info.Sys().(*syscall.Stat_t)
+}
+
+func intPtr(v int) *int { return &v }
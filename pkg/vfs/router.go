@@ -281,6 +281,21 @@ func (r *MountRouter) Readlink(path string) (string, error) {
 	return p.Readlink(rel)
 }
 
+func (r *MountRouter) Link(oldPath, newPath string) error {
+	oldP, oldRel, err := r.resolve(oldPath)
+	if err != nil {
+		return err
+	}
+	newP, newRel, err := r.resolve(newPath)
+	if err != nil {
+		return err
+	}
+	if oldP != newP {
+		return syscall.EXDEV
+	}
+	return oldP.Link(oldRel, newRel)
+}
+
 func (r *MountRouter) AddMount(path string, provider Provider) {
 	path = filepath.Clean(path)
 	r.mounts = append(r.mounts, mount{path: path, provider: provider})
@@ -1,6 +1,7 @@
 package vfs
 
 import (
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
@@ -270,3 +271,40 @@ func TestMountRouter_StatIntermediateMountDir(t *testing.T) {
 	require.NoError(t, err, "Stat /workspace/.host failed")
 	assert.True(t, info.IsDir(), "intermediate mount dir should be a directory")
 }
+
+func TestMountRouter_ReadonlyFileMountSeesHostUpdates(t *testing.T) {
+	hostDir := t.TempDir()
+	hostFile := filepath.Join(hostDir, "app.conf")
+	require.NoError(t, os.WriteFile(hostFile, []byte("v1"), 0644))
+
+	router := NewMountRouter(map[string]Provider{
+		"/workspace":          NewMemoryProvider(),
+		"/workspace/app.conf": NewReadonlyProvider(NewRealFSProvider(hostFile)),
+	})
+
+	readMounted := func() string {
+		h, err := router.Open("/workspace/app.conf", os.O_RDONLY, 0)
+		require.NoError(t, err)
+		defer h.Close()
+		content, err := io.ReadAll(h)
+		require.NoError(t, err)
+		return string(content)
+	}
+	assert.Equal(t, "v1", readMounted())
+
+	// In-place rewrite.
+	require.NoError(t, os.WriteFile(hostFile, []byte("version-2"), 0644))
+	info, err := router.Stat("/workspace/app.conf")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("version-2")), info.Size())
+	assert.Equal(t, "version-2", readMounted())
+
+	// Atomic replace via rename, as editors and config managers do.
+	tmp := filepath.Join(hostDir, "app.conf.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("v3"), 0644))
+	require.NoError(t, os.Rename(tmp, hostFile))
+	assert.Equal(t, "v3", readMounted())
+
+	_, err = router.Create("/workspace/app.conf", 0644)
+	require.Error(t, err)
+}
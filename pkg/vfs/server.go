@@ -2,11 +2,13 @@ package vfs
 
 import (
 	"encoding/binary"
+	"errors"
 	"hash/fnv"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -36,9 +38,15 @@ const (
 	OpSymlink
 	OpReadlink
 	OpLink
+	// OpHello is an optional handshake a guest sends first on a connection,
+	// offering payload encodings in Flags. The response's Encoding is the
+	// one the server will use for reads, if any. Servers that predate it
+	// answer ENOSYS, which leaves the connection uncompressed.
+	OpHello
 )
 
 type VFSRequest struct {
+	ID      uint64 `cbor:"id,omitempty"`
 	Op      OpCode `cbor:"op"`
 	Path    string `cbor:"path,omitempty"`
 	NewPath string `cbor:"new_path,omitempty"`
@@ -53,12 +61,14 @@ type VFSRequest struct {
 }
 
 type VFSResponse struct {
-	Err     int32         `cbor:"err"`
-	Stat    *VFSStat      `cbor:"stat,omitempty"`
-	Data    []byte        `cbor:"data,omitempty"`
-	Written uint32        `cbor:"written,omitempty"`
-	Handle  uint64        `cbor:"fh,omitempty"`
-	Entries []VFSDirEntry `cbor:"entries,omitempty"`
+	ID       uint64        `cbor:"id,omitempty"`
+	Err      int32         `cbor:"err"`
+	Stat     *VFSStat      `cbor:"stat,omitempty"`
+	Data     []byte        `cbor:"data,omitempty"`
+	Encoding uint8         `cbor:"enc,omitempty"` // how Data is compressed
+	Written  uint32        `cbor:"written,omitempty"`
+	Handle   uint64        `cbor:"fh,omitempty"`
+	Entries  []VFSDirEntry `cbor:"entries,omitempty"`
 }
 
 type VFSStat struct {
@@ -67,6 +77,11 @@ type VFSStat struct {
 	ModTime int64  `cbor:"mtime"`
 	IsDir   bool   `cbor:"is_dir"`
 	Ino     uint64 `cbor:"ino,omitempty"`
+	UID     uint32 `cbor:"uid,omitempty"`
+	GID     uint32 `cbor:"gid,omitempty"`
+	// Volatile asks the guest not to cache these attributes because the
+	// path is under a watched mount whose host file may change at any time.
+	Volatile bool `cbor:"volatile,omitempty"`
 }
 
 type VFSDirEntry struct {
@@ -78,13 +93,44 @@ type VFSDirEntry struct {
 }
 
 type VFSServer struct {
-	provider Provider
-	handles  sync.Map
-	nextFH   uint64
+	provider    Provider
+	handles     sync.Map
+	nextFH      uint64
+	volatile    []string
+	compressMin int
+}
+
+func NewVFSServer(provider Provider, opts ...ServerOption) *VFSServer {
+	s := &VFSServer{provider: provider}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// SetVolatilePaths marks paths (and everything below them) whose attributes
+// the guest must not cache. It must be called before serving.
+func (s *VFSServer) SetVolatilePaths(paths ...string) {
+	s.volatile = make([]string, 0, len(paths))
+	for _, p := range paths {
+		s.volatile = append(s.volatile, filepath.Clean(p))
+	}
 }
 
-func NewVFSServer(provider Provider) *VFSServer {
-	return &VFSServer{provider: provider}
+func (s *VFSServer) isVolatile(path string) bool {
+	path = filepath.Clean(path)
+	for _, p := range s.volatile {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *VFSServer) stat(path string, info FileInfo) *VFSStat {
+	st := statFromInfo(path, info)
+	st.Volatile = s.isVolatile(path)
+	return st
 }
 
 func (s *VFSServer) Serve(listener net.Listener) error {
@@ -97,9 +143,48 @@ func (s *VFSServer) Serve(listener net.Listener) error {
 	}
 }
 
+// maxInFlightRequests bounds how many pipelined requests one connection
+// may have dispatched at once.
+const maxInFlightRequests = 64
+
+// maxFrameSize bounds a single request frame. The guest splits writes into
+// chunks well below it; a larger length prefix means a corrupt stream, and
+// the connection is dropped instead of allocating it.
+const maxFrameSize = 16 << 20
+
 // HandleConnection handles a single VFS connection. Exported for use by platform-specific backends.
+//
+// Requests with a nonzero ID are pipelined: they are dispatched concurrently
+// and their responses, tagged with the same ID, are written as they
+// complete. Requests without an ID are answered in order.
 func (s *VFSServer) HandleConnection(conn net.Conn) {
+	var (
+		wg      sync.WaitGroup
+		writeMu sync.Mutex
+		sem     = make(chan struct{}, maxInFlightRequests)
+		enc     uint8 // read encoding negotiated by OpHello
+	)
 	defer conn.Close()
+	defer wg.Wait()
+
+	respond := func(resp *VFSResponse) bool {
+		respBuf, err := cbor.Marshal(resp)
+		if err != nil {
+			conn.Close()
+			return false
+		}
+		frame := make([]byte, 4+len(respBuf))
+		binary.BigEndian.PutUint32(frame, uint32(len(respBuf)))
+		copy(frame[4:], respBuf)
+
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if _, err := conn.Write(frame); err != nil {
+			conn.Close()
+			return false
+		}
+		return true
+	}
 
 	for {
 		var lenBuf [4]byte
@@ -107,6 +192,9 @@ func (s *VFSServer) HandleConnection(conn net.Conn) {
 			return
 		}
 		msgLen := binary.BigEndian.Uint32(lenBuf[:])
+		if msgLen > maxFrameSize {
+			return
+		}
 
 		msgBuf := make([]byte, msgLen)
 		if _, err := io.ReadFull(conn, msgBuf); err != nil {
@@ -118,20 +206,33 @@ func (s *VFSServer) HandleConnection(conn net.Conn) {
 			return
 		}
 
-		resp := s.dispatch(&req)
-
-		respBuf, err := cbor.Marshal(resp)
-		if err != nil {
-			return
+		if req.Op == OpHello {
+			enc = s.negotiate(req.Flags)
+			if !respond(&VFSResponse{ID: req.ID, Encoding: enc}) {
+				return
+			}
+			continue
 		}
 
-		binary.BigEndian.PutUint32(lenBuf[:], uint32(len(respBuf)))
-		if _, err := conn.Write(lenBuf[:]); err != nil {
-			return
-		}
-		if _, err := conn.Write(respBuf); err != nil {
-			return
+		if req.ID == 0 {
+			resp := s.dispatch(&req)
+			s.compressRead(&req, resp, enc)
+			if !respond(resp) {
+				return
+			}
+			continue
 		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(enc uint8) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp := s.dispatch(&req)
+			resp.ID = req.ID
+			s.compressRead(&req, resp, enc)
+			respond(resp)
+		}(enc)
 	}
 }
 
@@ -149,7 +250,7 @@ func (s *VFSServer) dispatch(req *VFSRequest) *VFSResponse {
 		if err != nil {
 			return &VFSResponse{Err: errnoFromError(err)}
 		}
-		return &VFSResponse{Stat: statFromInfo(req.Path, info)}
+		return &VFSResponse{Stat: s.stat(req.Path, info)}
 
 	case OpSetattr:
 		if err := provider.Chmod(req.Path, os.FileMode(req.Mode)); err != nil {
@@ -159,7 +260,7 @@ func (s *VFSServer) dispatch(req *VFSRequest) *VFSResponse {
 		if err != nil {
 			return &VFSResponse{Err: errnoFromError(err)}
 		}
-		return &VFSResponse{Stat: statFromInfo(req.Path, info)}
+		return &VFSResponse{Stat: s.stat(req.Path, info)}
 
 	case OpOpen:
 		h, err := provider.Open(req.Path, int(req.Flags), os.FileMode(req.Mode))
@@ -182,7 +283,7 @@ func (s *VFSServer) dispatch(req *VFSRequest) *VFSResponse {
 		}
 		fh := atomic.AddUint64(&s.nextFH, 1)
 		s.handles.Store(fh, h)
-		return &VFSResponse{Handle: fh, Stat: statFromInfo(req.Path, info)}
+		return &VFSResponse{Handle: fh, Stat: s.stat(req.Path, info)}
 
 	case OpRead:
 		hi, ok := s.handles.Load(req.Handle)
@@ -203,10 +304,12 @@ func (s *VFSServer) dispatch(req *VFSRequest) *VFSResponse {
 			return &VFSResponse{Err: -int32(syscall.EBADF)}
 		}
 		h := hi.(Handle)
-		n, err := h.WriteAt(req.Data, req.Offset)
-		if err != nil {
+		n, err := writeAllAt(h, req.Data, req.Offset)
+		if err != nil && n == 0 {
 			return &VFSResponse{Err: errnoFromError(err)}
 		}
+		// After a partial write, report the true count; the guest retries
+		// the rest and gets the error then.
 		return &VFSResponse{Written: uint32(n)}
 
 	case OpRelease:
@@ -230,7 +333,7 @@ func (s *VFSServer) dispatch(req *VFSRequest) *VFSResponse {
 		if err != nil {
 			return &VFSResponse{}
 		}
-		return &VFSResponse{Stat: statFromInfo(req.Path, info)}
+		return &VFSResponse{Stat: s.stat(req.Path, info)}
 
 	case OpMkdirAll:
 		mp, ok := provider.(*MemoryProvider)
@@ -260,6 +363,35 @@ func (s *VFSServer) dispatch(req *VFSRequest) *VFSResponse {
 		}
 		return &VFSResponse{}
 
+	case OpSymlink:
+		// Path is the new link; NewPath is its target.
+		if err := provider.Symlink(req.NewPath, req.Path); err != nil {
+			return &VFSResponse{Err: errnoFromError(err)}
+		}
+		info, err := provider.Stat(req.Path)
+		if err != nil {
+			return &VFSResponse{}
+		}
+		return &VFSResponse{Stat: s.stat(req.Path, info)}
+
+	case OpReadlink:
+		target, err := provider.Readlink(req.Path)
+		if err != nil {
+			return &VFSResponse{Err: errnoFromError(err)}
+		}
+		return &VFSResponse{Data: []byte(target)}
+
+	case OpLink:
+		// Path is the existing file; NewPath is the name to add.
+		if err := provider.Link(req.Path, req.NewPath); err != nil {
+			return &VFSResponse{Err: errnoFromError(err)}
+		}
+		info, err := provider.Stat(req.NewPath)
+		if err != nil {
+			return &VFSResponse{}
+		}
+		return &VFSResponse{Stat: s.stat(req.NewPath, info)}
+
 	case OpFsync:
 		if hi, ok := s.handles.Load(req.Handle); ok {
 			hi.(Handle).Sync()
@@ -271,11 +403,29 @@ func (s *VFSServer) dispatch(req *VFSRequest) *VFSResponse {
 	}
 }
 
+// writeAllAt writes data at off, retrying short writes that report no
+// error. It returns how many bytes were written before any error.
+func writeAllAt(h Handle, data []byte, off int64) (int, error) {
+	total := 0
+	for total < len(data) {
+		n, err := h.WriteAt(data[total:], off+int64(total))
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			return total, io.ErrShortWrite
+		}
+	}
+	return total, nil
+}
+
 func errnoFromError(err error) int32 {
 	if err == nil {
 		return 0
 	}
-	if errno, ok := err.(syscall.Errno); ok {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
 		return -int32(errno)
 	}
 	if os.IsNotExist(err) {
@@ -291,12 +441,15 @@ func errnoFromError(err error) int32 {
 }
 
 func statFromInfo(path string, info FileInfo) *VFSStat {
+	uid, gid := info.Owner()
 	return &VFSStat{
 		Size:    info.Size(),
 		Mode:    uint32(info.Mode()),
 		ModTime: info.ModTime().Unix(),
 		IsDir:   info.IsDir(),
 		Ino:     inodeFromFileInfo(path, info, info.IsDir()),
+		UID:     uid,
+		GID:     gid,
 	}
 }
 
@@ -2,6 +2,7 @@ package vfs
 
 import (
 	"os"
+	"path/filepath"
 	"syscall"
 	"testing"
 	"time"
@@ -109,3 +110,189 @@ type denyStatProvider struct {
 func (p denyStatProvider) Stat(path string) (FileInfo, error) {
 	return FileInfo{}, syscall.EACCES
 }
+
+func TestDispatchMarksVolatilePaths(t *testing.T) {
+	p := NewMemoryProvider()
+	require.NoError(t, p.MkdirAll("/workspace/conf", 0755))
+	require.NoError(t, p.WriteFile("/workspace/conf/app.conf", []byte("x"), 0644))
+	require.NoError(t, p.WriteFile("/workspace/conference", []byte("x"), 0644))
+
+	s := NewVFSServer(p)
+	s.SetVolatilePaths("/workspace/conf/")
+
+	for path, want := range map[string]bool{
+		"/workspace/conf":          true,
+		"/workspace/conf/app.conf": true,
+		"/workspace/conference":    false,
+		"/workspace":               false,
+	} {
+		resp := s.dispatch(&VFSRequest{Op: OpLookup, Path: path})
+		require.Equal(t, int32(0), resp.Err, path)
+		assert.Equal(t, want, resp.Stat.Volatile, path)
+	}
+}
+
+func TestDispatchGuestWriteBlockedByHookReturnsEPERM(t *testing.T) {
+	hooks := NewHookEngine([]HookRule{
+		{
+			Phase:       HookPhaseBefore,
+			Ops:         []HookOp{HookOpWrite},
+			PathPattern: "/workspace/*.env",
+			Action:      HookActionBlock,
+		},
+	})
+	defer hooks.Close()
+	mem := NewMemoryProvider()
+	require.NoError(t, mem.MkdirAll("/workspace", 0755))
+	s := NewVFSServer(NewInterceptProvider(mem, hooks))
+
+	created := s.dispatch(&VFSRequest{Op: OpCreate, Path: "/workspace/.env", Mode: 0644})
+	require.Equal(t, int32(0), created.Err)
+	write := s.dispatch(&VFSRequest{Op: OpWrite, Handle: created.Handle, Data: []byte("TOKEN=x")})
+	assert.Equal(t, -int32(syscall.EPERM), write.Err)
+	s.dispatch(&VFSRequest{Op: OpRelease, Handle: created.Handle})
+
+	data, err := mem.ReadFile("/workspace/.env")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+// shortWriteProvider hands out handles whose WriteAt writes at most limit
+// bytes per call and, once failAfter bytes are written, fails.
+type shortWriteProvider struct {
+	Provider
+	limit     int
+	failAfter int
+}
+
+func (p shortWriteProvider) Open(path string, flags int, mode os.FileMode) (Handle, error) {
+	h, err := p.Provider.Open(path, flags, mode)
+	if err != nil {
+		return nil, err
+	}
+	return &shortWriteHandle{Handle: h, limit: p.limit, failAfter: p.failAfter}, nil
+}
+
+type shortWriteHandle struct {
+	Handle
+	limit     int
+	failAfter int
+	written   int
+}
+
+func (h *shortWriteHandle) WriteAt(p []byte, off int64) (int, error) {
+	if h.failAfter > 0 && h.written >= h.failAfter {
+		return 0, syscall.ENOSPC
+	}
+	if len(p) > h.limit {
+		p = p[:h.limit]
+	}
+	n, err := h.Handle.WriteAt(p, off)
+	h.written += n
+	return n, err
+}
+
+func TestDispatchWriteRetriesShortWrites(t *testing.T) {
+	base := NewMemoryProvider()
+	require.NoError(t, base.WriteFile("/f", nil, 0644))
+	s := NewVFSServer(shortWriteProvider{Provider: base, limit: 3})
+
+	open := s.dispatch(&VFSRequest{Op: OpOpen, Path: "/f", Flags: uint32(os.O_WRONLY)})
+	require.Equal(t, int32(0), open.Err)
+
+	resp := s.dispatch(&VFSRequest{Op: OpWrite, Handle: open.Handle, Offset: 2, Data: []byte("hello world")})
+	require.Equal(t, int32(0), resp.Err)
+	assert.Equal(t, uint32(11), resp.Written)
+
+	data, err := base.ReadFile("/f")
+	require.NoError(t, err)
+	assert.Equal(t, "\x00\x00hello world", string(data))
+}
+
+func TestDispatchWriteReportsPartialCountBeforeError(t *testing.T) {
+	base := NewMemoryProvider()
+	require.NoError(t, base.WriteFile("/f", nil, 0644))
+	s := NewVFSServer(shortWriteProvider{Provider: base, limit: 4, failAfter: 4})
+
+	open := s.dispatch(&VFSRequest{Op: OpOpen, Path: "/f", Flags: uint32(os.O_WRONLY)})
+	require.Equal(t, int32(0), open.Err)
+
+	resp := s.dispatch(&VFSRequest{Op: OpWrite, Handle: open.Handle, Data: []byte("hello world")})
+	require.Equal(t, int32(0), resp.Err)
+	assert.Equal(t, uint32(4), resp.Written)
+
+	resp = s.dispatch(&VFSRequest{Op: OpWrite, Handle: open.Handle, Offset: 4, Data: []byte("o world")})
+	assert.Equal(t, -int32(syscall.ENOSPC), resp.Err)
+}
+
+func TestDispatchSymlinkChainAndHardLink(t *testing.T) {
+	providers := map[string]func(t *testing.T) Provider{
+		"memory": func(t *testing.T) Provider { return NewMemoryProvider() },
+		"realfs": func(t *testing.T) Provider { return NewRealFSProvider(t.TempDir()) },
+	}
+	for name, newProvider := range providers {
+		t.Run(name, func(t *testing.T) {
+			s := NewVFSServer(newProvider(t))
+			writeFile := func(path, content string) {
+				created := s.dispatch(&VFSRequest{Op: OpCreate, Path: path, Mode: 0644})
+				require.Equal(t, int32(0), created.Err)
+				written := s.dispatch(&VFSRequest{Op: OpWrite, Handle: created.Handle, Data: []byte(content)})
+				require.Equal(t, int32(0), written.Err)
+				s.dispatch(&VFSRequest{Op: OpRelease, Handle: created.Handle})
+			}
+			readFile := func(path string) string {
+				opened := s.dispatch(&VFSRequest{Op: OpOpen, Path: path, Flags: uint32(os.O_RDONLY)})
+				require.Equal(t, int32(0), opened.Err, path)
+				defer s.dispatch(&VFSRequest{Op: OpRelease, Handle: opened.Handle})
+				read := s.dispatch(&VFSRequest{Op: OpRead, Handle: opened.Handle, Size: 64})
+				require.Equal(t, int32(0), read.Err)
+				return string(read.Data)
+			}
+
+			writeFile("/c.txt", "hello")
+			require.Equal(t, int32(0), s.dispatch(&VFSRequest{Op: OpMkdir, Path: "/sub", Mode: 0755}).Err)
+
+			resp := s.dispatch(&VFSRequest{Op: OpSymlink, Path: "/sub/b", NewPath: "../c.txt"})
+			require.Equal(t, int32(0), resp.Err)
+			require.NotNil(t, resp.Stat)
+			assert.NotZero(t, os.FileMode(resp.Stat.Mode)&os.ModeSymlink)
+			require.Equal(t, int32(0), s.dispatch(&VFSRequest{Op: OpSymlink, Path: "/a", NewPath: "sub/b"}).Err)
+			assert.Equal(t, -int32(syscall.EEXIST), s.dispatch(&VFSRequest{Op: OpSymlink, Path: "/a", NewPath: "c.txt"}).Err)
+
+			// Resolve the chain the way the guest kernel does: lookup, and
+			// readlink while the entry is a symlink.
+			path, hops := "/a", 0
+			for {
+				lookup := s.dispatch(&VFSRequest{Op: OpLookup, Path: path})
+				require.Equal(t, int32(0), lookup.Err, path)
+				if os.FileMode(lookup.Stat.Mode)&os.ModeSymlink == 0 {
+					break
+				}
+				link := s.dispatch(&VFSRequest{Op: OpReadlink, Path: path})
+				require.Equal(t, int32(0), link.Err)
+				path = filepath.Join(filepath.Dir(path), string(link.Data))
+				hops++
+			}
+			assert.Equal(t, "/c.txt", path)
+			assert.Equal(t, 2, hops)
+			assert.Equal(t, "hello", readFile("/a"), "the host follows links inside the mount")
+			assert.Equal(t, -int32(syscall.EINVAL), s.dispatch(&VFSRequest{Op: OpReadlink, Path: "/c.txt"}).Err)
+
+			dir := s.dispatch(&VFSRequest{Op: OpReaddir, Path: "/"})
+			require.Equal(t, int32(0), dir.Err)
+			for _, e := range dir.Entries {
+				if e.Name == "a" {
+					assert.NotZero(t, os.FileMode(e.Mode)&os.ModeSymlink)
+				}
+			}
+
+			resp = s.dispatch(&VFSRequest{Op: OpLink, Path: "/c.txt", NewPath: "/sub/d.txt"})
+			require.Equal(t, int32(0), resp.Err)
+			require.NotNil(t, resp.Stat)
+			writeFile("/sub/d.txt", "shared")
+			assert.Equal(t, "shared", readFile("/c.txt"))
+			assert.Equal(t, -int32(syscall.EEXIST), s.dispatch(&VFSRequest{Op: OpLink, Path: "/c.txt", NewPath: "/a"}).Err)
+			assert.Equal(t, -int32(syscall.EPERM), s.dispatch(&VFSRequest{Op: OpLink, Path: "/sub", NewPath: "/sub2"}).Err)
+		})
+	}
+}
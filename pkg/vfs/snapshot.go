@@ -0,0 +1,86 @@
+package vfs
+
+import (
+	"maps"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SnapshotID identifies a point-in-time copy of a provider's contents.
+type SnapshotID string
+
+// Snapshotter is implemented by providers that can checkpoint their contents
+// and roll back to a checkpoint later. An overlay provider would implement it
+// by checkpointing its upper layer.
+type Snapshotter interface {
+	Snapshot() SnapshotID
+	Restore(id SnapshotID) error
+}
+
+type memSnapshot struct {
+	files    map[string]memFileState
+	dirs     map[string]bool
+	dirModes map[string]os.FileMode
+}
+
+type memFileState struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+// Snapshot records the current contents of the provider. File data is shared
+// copy-on-write with the live tree, so a snapshot only costs memory for files
+// that are modified after it was taken. Snapshots are kept for the lifetime
+// of the provider.
+func (p *MemoryProvider) Snapshot() SnapshotID {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snap := &memSnapshot{
+		files:    make(map[string]memFileState, len(p.files)),
+		dirs:     maps.Clone(p.dirs),
+		dirModes: maps.Clone(p.dirModes),
+	}
+	for path, f := range p.files {
+		f.mu.Lock()
+		f.shared = true
+		snap.files[path] = memFileState{data: f.data, mode: f.mode, modTime: f.modTime}
+		f.mu.Unlock()
+	}
+
+	if p.snapshots == nil {
+		p.snapshots = make(map[SnapshotID]*memSnapshot)
+	}
+	p.snapshotSeq++
+	id := SnapshotID("snap-" + strconv.Itoa(p.snapshotSeq))
+	p.snapshots[id] = snap
+	return id
+}
+
+// Restore replaces the provider's contents with a snapshot. The snapshot is
+// kept, so it can be restored again. Handles opened before the restore keep
+// referring to the replaced files.
+func (p *MemoryProvider) Restore(id SnapshotID) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	snap, ok := p.snapshots[id]
+	if !ok {
+		return ErrSnapshotNotFound
+	}
+
+	p.files = make(map[string]*memFile, len(snap.files))
+	for path, state := range snap.files {
+		p.files[path] = &memFile{
+			data:    state.data,
+			mode:    state.mode,
+			modTime: state.modTime,
+			shared:  true,
+		}
+	}
+	p.dirs = maps.Clone(snap.dirs)
+	p.dirModes = maps.Clone(snap.dirModes)
+	return nil
+}
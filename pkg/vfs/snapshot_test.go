@@ -0,0 +1,53 @@
+package vfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryProvider_SnapshotRestore(t *testing.T) {
+	mp := NewMemoryProvider()
+	require.NoError(t, mp.WriteFile("/keep.txt", []byte("original"), 0644))
+	require.NoError(t, mp.Mkdir("/dir", 0755))
+
+	id := mp.Snapshot()
+
+	h, err := mp.Open("/keep.txt", os.O_RDWR, 0)
+	require.NoError(t, err)
+	_, err = h.WriteAt([]byte("MODIFIED"), 0)
+	require.NoError(t, err)
+	require.NoError(t, h.Close())
+	require.NoError(t, mp.WriteFile("/dir/new.txt", []byte("new"), 0644))
+	require.NoError(t, mp.Remove("/dir/new.txt"))
+	require.NoError(t, mp.Remove("/dir"))
+	require.NoError(t, mp.WriteFile("/added.txt", []byte("added"), 0644))
+
+	require.NoError(t, mp.Restore(id))
+
+	data, err := mp.ReadFile("/keep.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data))
+	info, err := mp.Stat("/dir")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	_, err = mp.Stat("/added.txt")
+	assert.Error(t, err)
+
+	// Writes after a restore must not leak into the snapshot.
+	h, err = mp.Open("/keep.txt", os.O_RDWR, 0)
+	require.NoError(t, err)
+	require.NoError(t, h.Truncate(2))
+	require.NoError(t, h.Close())
+	require.NoError(t, mp.Restore(id))
+	data, err = mp.ReadFile("/keep.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "original", string(data))
+}
+
+func TestMemoryProvider_RestoreUnknownSnapshot(t *testing.T) {
+	mp := NewMemoryProvider()
+	assert.ErrorIs(t, mp.Restore("snap-404"), ErrSnapshotNotFound)
+}
@@ -0,0 +1,81 @@
+package vfs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// StaticFileProvider serves a single read-only file whose content is fixed
+// at construction. It is meant to be mounted at a file path, so the only
+// path it knows is "/".
+type StaticFileProvider struct {
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func NewStaticFileProvider(data []byte, mode os.FileMode) *StaticFileProvider {
+	return &StaticFileProvider{
+		data:    append([]byte(nil), data...),
+		mode:    mode.Perm(),
+		modTime: time.Now(),
+	}
+}
+
+func (p *StaticFileProvider) Readonly() bool { return true }
+
+func (p *StaticFileProvider) info() FileInfo {
+	return NewFileInfo("/", int64(len(p.data)), p.mode, p.modTime, false)
+}
+
+func (p *StaticFileProvider) Stat(path string) (FileInfo, error) {
+	if filepath.Clean("/"+path) != "/" {
+		return FileInfo{}, syscall.ENOENT
+	}
+	return p.info(), nil
+}
+
+func (p *StaticFileProvider) ReadDir(path string) ([]DirEntry, error) {
+	if filepath.Clean("/"+path) != "/" {
+		return nil, syscall.ENOENT
+	}
+	return nil, syscall.ENOTDIR
+}
+
+func (p *StaticFileProvider) Open(path string, flags int, mode os.FileMode) (Handle, error) {
+	if filepath.Clean("/"+path) != "/" {
+		return nil, syscall.ENOENT
+	}
+	if flags&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, syscall.EROFS
+	}
+	return &staticHandle{Reader: bytes.NewReader(p.data), info: p.info()}, nil
+}
+
+func (p *StaticFileProvider) Create(path string, mode os.FileMode) (Handle, error) {
+	return nil, syscall.EROFS
+}
+
+func (p *StaticFileProvider) Chmod(path string, mode os.FileMode) error { return syscall.EROFS }
+func (p *StaticFileProvider) Mkdir(path string, mode os.FileMode) error { return syscall.EROFS }
+func (p *StaticFileProvider) Remove(path string) error                  { return syscall.EROFS }
+func (p *StaticFileProvider) RemoveAll(path string) error               { return syscall.EROFS }
+func (p *StaticFileProvider) Rename(oldPath, newPath string) error      { return syscall.EROFS }
+func (p *StaticFileProvider) Symlink(target, link string) error         { return syscall.EROFS }
+func (p *StaticFileProvider) Readlink(path string) (string, error)      { return "", syscall.EINVAL }
+func (p *StaticFileProvider) Link(oldPath, newPath string) error        { return syscall.EROFS }
+
+type staticHandle struct {
+	*bytes.Reader
+	info FileInfo
+}
+
+func (h *staticHandle) Stat() (FileInfo, error)                  { return h.info, nil }
+func (h *staticHandle) Close() error                             { return nil }
+func (h *staticHandle) Sync() error                              { return nil }
+func (h *staticHandle) Write(p []byte) (int, error)              { return 0, syscall.EROFS }
+func (h *staticHandle) WriteAt(p []byte, off int64) (int, error) { return 0, syscall.EROFS }
+func (h *staticHandle) Truncate(size int64) error                { return syscall.EROFS }
@@ -0,0 +1,61 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticFileProvider_Read(t *testing.T) {
+	p := NewStaticFileProvider([]byte("token"), 0440)
+
+	info, err := p.Stat("/")
+	require.NoError(t, err)
+	assert.False(t, info.IsDir())
+	assert.Equal(t, int64(5), info.Size())
+	assert.Equal(t, os.FileMode(0440), info.Mode())
+
+	h, err := p.Open("/", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	defer h.Close()
+	data, err := io.ReadAll(h)
+	require.NoError(t, err)
+	assert.Equal(t, "token", string(data))
+}
+
+func TestStaticFileProvider_WriteBlocked(t *testing.T) {
+	p := NewStaticFileProvider([]byte("token"), 0400)
+
+	_, err := p.Open("/", os.O_RDWR, 0)
+	assert.ErrorIs(t, err, syscall.EROFS)
+	_, err = p.Create("/", 0644)
+	assert.ErrorIs(t, err, syscall.EROFS)
+	assert.ErrorIs(t, p.Remove("/"), syscall.EROFS)
+
+	_, err = p.Stat("/other")
+	assert.ErrorIs(t, err, syscall.ENOENT)
+}
+
+func TestStaticFileProvider_MountedUnderRouter(t *testing.T) {
+	r := NewMountRouter(map[string]Provider{
+		"/workspace":                NewMemoryProvider(),
+		"/workspace/.secrets/token": NewStaticFileProvider([]byte("value"), 0400),
+	})
+
+	entries, err := r.ReadDir("/workspace/.secrets")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "token", entries[0].Name())
+	assert.False(t, entries[0].IsDir())
+
+	h, err := r.Open("/workspace/.secrets/token", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	defer h.Close()
+	data, err := io.ReadAll(h)
+	require.NoError(t, err)
+	assert.Equal(t, "value", string(data))
+}
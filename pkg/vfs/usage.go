@@ -0,0 +1,33 @@
+package vfs
+
+import "path"
+
+// Usage returns the total size in bytes of the regular files under root in
+// p. Symlinks are not followed.
+func Usage(p Provider, root string) (int64, error) {
+	entries, err := p.ReadDir(root)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, e := range entries {
+		child := path.Join(root, e.Name())
+		if e.IsDir() {
+			n, err := Usage(p, child)
+			if err != nil {
+				return 0, err
+			}
+			total += n
+			continue
+		}
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return 0, err
+		}
+		total += info.Size()
+	}
+	return total, nil
+}
@@ -0,0 +1,32 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageSumsRegularFiles(t *testing.T) {
+	mp := NewMemoryProvider()
+	require.NoError(t, mp.Mkdir("/ws", 0755))
+	require.NoError(t, mp.Mkdir("/ws/sub", 0755))
+	for path, size := range map[string]int{"/ws/a.txt": 10, "/ws/sub/b.bin": 1000} {
+		h, err := mp.Create(path, 0644)
+		require.NoError(t, err)
+		_, err = h.Write(make([]byte, size))
+		require.NoError(t, err)
+		require.NoError(t, h.Close())
+	}
+
+	used, err := Usage(mp, "/ws")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1010), used)
+
+	used, err = Usage(mp, "/ws/sub")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), used)
+
+	_, err = Usage(mp, "/missing")
+	assert.Error(t, err)
+}
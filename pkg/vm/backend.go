@@ -4,9 +4,12 @@ import (
 	"context"
 	"io"
 	"net"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
 )
 
 // DiskConfig describes an additional block device to attach to the VM.
@@ -23,9 +26,15 @@ type VMConfig struct {
 	RootfsPath      string
 	CPUs            int
 	MemoryMB        int
+	SwapMB          int                   // zram swap set up by guest-init (0 disables)
+	CPUAffinity     []int                 // Host CPUs the VM process is pinned to (empty leaves scheduling alone)
+	CgroupParent    string                // Host cgroup v2 path the VM process gets its own cgroup under (empty leaves it in the caller's)
+	Ulimits         map[string]api.Ulimit // Resource limits applied to guest commands (see api.Config.Ulimits)
+	User            string                // Default user for guest commands (image USER); resolved by guest-init at boot
 	NetworkFD       int
 	VsockCID        uint32
 	VsockPath       string
+	VsockPorts      vsock.Ports // Guest service port assignment (nil uses vsock.DefaultPorts)
 	SocketPath      string
 	LogPath         string
 	KernelArgs      string
@@ -33,15 +42,33 @@ type VMConfig struct {
 	GatewayIP       string              // Host TAP IP (e.g., 192.168.100.1)
 	GuestIP         string              // Guest IP (e.g., 192.168.100.2)
 	SubnetCIDR      string              // CIDR notation (e.g., 192.168.100.1/24)
+	MACAddress      string              // Guest NIC MAC (empty derives one from the ID on Linux, random on macOS)
+	Bridge          string              // Host bridge the TAP joins; the bridge holds SubnetCIDR instead of the TAP (Linux only)
 	Workspace       string              // Guest VFS mount point (default: /workspace)
 	UseInterception bool                // Use network interception (MITM proxy)
 	Privileged      bool                // Skip in-guest security restrictions (seccomp, cap drop, no_new_privs)
 	DNSServers      []string            // DNS servers for the guest (default: 8.8.8.8, 8.8.4.4)
+	SearchDomains   []string            // resolv.conf "search" domains for the guest
+	ResolvOptions   []string            // resolv.conf "options" entries for the guest (e.g. ndots:2)
 	Hostname        string              // Hostname for the guest (default: vm's ID)
 	AddHosts        []api.HostIPMapping // Additional /etc/hosts entries injected at boot
+	Routes          []string            // IPv4 hosts the guest routes via its gateway (see api.NetworkConfig.PrivateHostRoutes)
 	MTU             int                 // Guest interface/network stack MTU (default: 1500)
+	NetworkProbe    string              // host:port guest-init reaches before signalling ready (empty skips the wait)
+	SocketMounts    []string            // Guest paths the agent proxies to host unix sockets (see api.Config.SocketMounts)
+	CapAdd          []int               // Capability numbers kept despite the default guest cap drop
+	CapDrop         []int               // Additional capability numbers dropped from guest commands
+	AllowSyscalls   []string            // Syscall names removed from the guest seccomp filter (see api.AllowableSyscalls)
+	KeepNewPrivs    bool                // Leave no_new_privs unset for guest commands (see api.Config.DisableNoNewPrivs)
+	SeccompAudit    bool                // Stream flagged guest syscalls to the host (see api.Config.SeccompAudit)
 	PrebuiltRootfs  string              // Pre-prepared rootfs path (skips internal copy if set)
 	ExtraDisks      []DiskConfig        // Additional block devices to attach
+	RootfsOverlay   string              // Per-VM overlay disk for writes; RootfsPath is then attached read-only (see api.Config.SharedRootfs)
+	ModulesDisk     string              // Read-only disk holding KernelModules, attached after every other disk (Linux only)
+	KernelModules   []string            // File names on ModulesDisk guest-init loads at boot, in order
+	CrashDumpDir    string              // Directory for crash-<timestamp>.txt dumps on unexpected exit (empty disables)
+	CrashContext    func() string       // Optional extra context (e.g. lifecycle state) recorded in crash dumps
+	StopGracePeriod time.Duration       // SIGTERM-to-SIGKILL wait when Stop's context has no deadline (default: 5s)
 }
 
 type Backend interface {
@@ -66,12 +93,38 @@ type InteractiveMachine interface {
 	ExecInteractive(ctx context.Context, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error)
 }
 
+// Snapshotter is implemented by machines that can save a full-VM snapshot:
+// guest memory, device state and the VM's own writable disks. Pause and
+// Resume let callers capture host-side state while the guest is stopped;
+// Snapshot pauses on its own when the machine is running.
+type Snapshotter interface {
+	Pause(ctx context.Context) error
+	Resume(ctx context.Context) error
+	Snapshot(ctx context.Context, dir string) error
+}
+
+// Restorer is implemented by backends that can resume a machine from a
+// snapshot written by Snapshotter.Snapshot instead of booting it. config
+// supplies the new machine's host-side resources (TAP device, sockets, disk
+// paths); the guest keeps the identity it had when the snapshot was taken.
+// The returned machine resumes the snapshot on Start.
+type Restorer interface {
+	Restore(ctx context.Context, config *VMConfig, snapshotDir string) (Machine, error)
+}
+
 // VsockDialer is implemented by backends that can establish host-initiated
 // vsock connections to guest service ports.
 type VsockDialer interface {
 	DialVsock(port uint32) (net.Conn, error)
 }
 
+// MetricsReader is implemented by machines that can sample their own
+// resource usage: the guest's counters plus what the host sees of the VM
+// (VMM memory, network device traffic).
+type MetricsReader interface {
+	Metrics(ctx context.Context) (*api.Stats, error)
+}
+
 // KernelIPDNSSuffix returns the DNS portion of the kernel ip= parameter.
 // The ip= format only supports up to 2 DNS servers (`:dns0:dns1`).
 func KernelIPDNSSuffix(dnsServers []string) string {
@@ -86,7 +139,154 @@ func KernelIPDNSSuffix(dnsServers []string) string {
 	return sb.String()
 }
 
+// KernelNetmask returns the dotted netmask of subnetCIDR for the kernel
+// ip= parameter, defaulting to 255.255.255.0.
+func KernelNetmask(subnetCIDR string) string {
+	_, ipNet, err := net.ParseCIDR(subnetCIDR)
+	if err != nil || len(ipNet.Mask) != net.IPv4len {
+		return "255.255.255.0"
+	}
+	return net.IP(ipNet.Mask).String()
+}
+
+// KernelCapParams returns the matchlock.cap_add= and matchlock.cap_drop=
+// cmdline params (with a leading space) for non-empty capability lists.
+func KernelCapParams(capAdd, capDrop []int) string {
+	var sb strings.Builder
+	for _, param := range []struct {
+		name string
+		caps []int
+	}{{"matchlock.cap_add", capAdd}, {"matchlock.cap_drop", capDrop}} {
+		if len(param.caps) == 0 {
+			continue
+		}
+		sb.WriteString(" " + param.name + "=")
+		for i, c := range param.caps {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(strconv.Itoa(c))
+		}
+	}
+	return sb.String()
+}
+
+// KernelIsolationParams returns the matchlock.allow_syscalls= and
+// matchlock.no_new_privs=0 cmdline params (with a leading space) for the
+// scoped alternatives to privileged mode.
+func KernelIsolationParams(allowSyscalls []string, keepNewPrivs bool) string {
+	var sb strings.Builder
+	if len(allowSyscalls) > 0 {
+		sb.WriteString(" matchlock.allow_syscalls=" + strings.Join(allowSyscalls, ","))
+	}
+	if keepNewPrivs {
+		sb.WriteString(" matchlock.no_new_privs=0")
+	}
+	return sb.String()
+}
+
+// KernelSwapParam returns the matchlock.swap_mb= cmdline param (with a
+// leading space), or "" when swap is disabled.
+func KernelSwapParam(swapMB int) string {
+	if swapMB <= 0 {
+		return ""
+	}
+	return " matchlock.swap_mb=" + strconv.Itoa(swapMB)
+}
+
+// KernelUlimitParam returns the matchlock.ulimits= cmdline param (with a
+// leading space), or "" when no limits are set.
+func KernelUlimitParam(ulimits map[string]api.Ulimit) string {
+	if len(ulimits) == 0 {
+		return ""
+	}
+	return " matchlock.ulimits=" + api.FormatUlimits(ulimits)
+}
+
+// KernelUserParam returns the matchlock.user= cmdline param (with a leading
+// space), or "" when guest commands default to root.
+func KernelUserParam(user string) string {
+	if user == "" {
+		return ""
+	}
+	return " matchlock.user=" + user
+}
+
+// KernelRoutesParam returns the matchlock.routes= cmdline param (with a
+// leading space), or "" when there are no routes.
+func KernelRoutesParam(routes []string) string {
+	if len(routes) == 0 {
+		return ""
+	}
+	return " matchlock.routes=" + strings.Join(routes, ",")
+}
+
+// KernelSocketMountsParam returns the matchlock.socket_mounts= cmdline param
+// (with a leading space) listing the guest paths the agent proxies to host
+// unix sockets, or "" when there are none.
+func KernelSocketMountsParam(guestPaths []string) string {
+	if len(guestPaths) == 0 {
+		return ""
+	}
+	return " matchlock.socket_mounts=" + strings.Join(guestPaths, ",")
+}
+
+// KernelNetworkWaitParam returns the matchlock.wait_network= cmdline param
+// (with a leading space), or "" when boot should not wait for egress.
+func KernelNetworkWaitParam(probe string) string {
+	if probe == "" {
+		return ""
+	}
+	return " matchlock.wait_network=" + probe
+}
+
+// OverlayRootDevice returns the guest block device of the rootfs overlay
+// disk, which is attached after the root and extraDisks extra disks.
+func OverlayRootDevice(extraDisks int) string {
+	return "vd" + string(rune('b'+extraDisks))
+}
+
+// KernelOverlayRootParam returns the matchlock.overlay_root= cmdline param
+// (with a leading space), or "" when the VM has no rootfs overlay.
+func KernelOverlayRootParam(overlayPath string, extraDisks int) string {
+	if overlayPath == "" {
+		return ""
+	}
+	return " matchlock.overlay_root=" + OverlayRootDevice(extraDisks)
+}
+
+// KernelModulesParam returns the matchlock.modules= cmdline param (with a
+// leading space) naming the modules disk's device and the module files on
+// it, in load order, or "" when there are none. The disk is attached after
+// the root, extraDisks extra disks and the rootfs overlay, if any.
+func KernelModulesParam(modules []string, extraDisks int, overlay bool) string {
+	if len(modules) == 0 {
+		return ""
+	}
+	index := extraDisks
+	if overlay {
+		index++
+	}
+	return " matchlock.modules=vd" + string(rune('b'+index)) + ":" + strings.Join(modules, ",")
+}
+
 // KernelDNSParam returns a comma-separated DNS list for the matchlock.dns= cmdline param.
 func KernelDNSParam(dnsServers []string) string {
 	return strings.Join(dnsServers, ",")
 }
+
+// KernelResolvParams returns the matchlock.dns_search= and
+// matchlock.dns_options= cmdline params (each with a leading space), or ""
+// for lists that are empty.
+func KernelResolvParams(searchDomains, resolvOptions []string) string {
+	var b strings.Builder
+	if len(searchDomains) > 0 {
+		b.WriteString(" matchlock.dns_search=")
+		b.WriteString(strings.Join(searchDomains, ","))
+	}
+	if len(resolvOptions) > 0 {
+		b.WriteString(" matchlock.dns_options=")
+		b.WriteString(strings.Join(resolvOptions, ","))
+	}
+	return b.String()
+}
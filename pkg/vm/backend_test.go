@@ -0,0 +1,80 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestKernelIsolationParams(t *testing.T) {
+	assert.Equal(t, "", KernelIsolationParams(nil, false))
+	assert.Equal(t, " matchlock.allow_syscalls=ptrace,kexec_load", KernelIsolationParams([]string{"ptrace", "kexec_load"}, false))
+	assert.Equal(t, " matchlock.no_new_privs=0", KernelIsolationParams(nil, true))
+}
+
+func TestKernelCapParams(t *testing.T) {
+	assert.Equal(t, "", KernelCapParams(nil, nil))
+	assert.Equal(t, " matchlock.cap_add=13,19", KernelCapParams([]int{13, 19}, nil))
+	assert.Equal(t, " matchlock.cap_add=19 matchlock.cap_drop=12", KernelCapParams([]int{19}, []int{12}))
+}
+
+func TestKernelSwapParam(t *testing.T) {
+	assert.Equal(t, "", KernelSwapParam(0))
+	assert.Equal(t, " matchlock.swap_mb=768", KernelSwapParam(768))
+}
+
+func TestKernelUlimitParam(t *testing.T) {
+	assert.Equal(t, "", KernelUlimitParam(nil))
+	assert.Equal(t, " matchlock.ulimits=core:0:0,nofile:1024:65536", KernelUlimitParam(map[string]api.Ulimit{
+		"nofile": {Soft: 1024, Hard: 65536},
+		"core":   {},
+	}))
+}
+
+func TestKernelNetworkWaitParam(t *testing.T) {
+	assert.Equal(t, "", KernelNetworkWaitParam(""))
+	assert.Equal(t, " matchlock.wait_network=8.8.8.8:53", KernelNetworkWaitParam("8.8.8.8:53"))
+}
+
+func TestKernelNetmask(t *testing.T) {
+	assert.Equal(t, "255.255.255.0", KernelNetmask("192.168.100.1/24"))
+	assert.Equal(t, "255.255.0.0", KernelNetmask("10.99.0.1/16"))
+	assert.Equal(t, "255.255.255.0", KernelNetmask(""))
+}
+
+func TestKernelRoutesParam(t *testing.T) {
+	assert.Equal(t, "", KernelRoutesParam(nil))
+	assert.Equal(t, " matchlock.routes=192.168.1.50,10.0.0.9", KernelRoutesParam([]string{"192.168.1.50", "10.0.0.9"}))
+}
+
+func TestKernelSocketMountsParam(t *testing.T) {
+	assert.Equal(t, "", KernelSocketMountsParam(nil))
+	assert.Equal(t, " matchlock.socket_mounts=/run/a.sock,/var/run/docker.sock", KernelSocketMountsParam([]string{"/run/a.sock", "/var/run/docker.sock"}))
+}
+
+func TestKernelUserParam(t *testing.T) {
+	assert.Equal(t, "", KernelUserParam(""))
+	assert.Equal(t, " matchlock.user=appuser", KernelUserParam("appuser"))
+	assert.Equal(t, " matchlock.user=1000:1000", KernelUserParam("1000:1000"))
+}
+
+func TestKernelResolvParams(t *testing.T) {
+	assert.Equal(t, "", KernelResolvParams(nil, nil))
+	assert.Equal(t, " matchlock.dns_search=svc.cluster.local,cluster.local matchlock.dns_options=ndots:2,rotate",
+		KernelResolvParams([]string{"svc.cluster.local", "cluster.local"}, []string{"ndots:2", "rotate"}))
+	assert.Equal(t, " matchlock.dns_options=edns0", KernelResolvParams(nil, []string{"edns0"}))
+}
+
+func TestKernelOverlayRootParam(t *testing.T) {
+	assert.Equal(t, "", KernelOverlayRootParam("", 0))
+	assert.Equal(t, " matchlock.overlay_root=vdb", KernelOverlayRootParam("/state/rootfs.ext4", 0))
+	assert.Equal(t, " matchlock.overlay_root=vdd", KernelOverlayRootParam("/state/rootfs.ext4", 2))
+}
+
+func TestKernelModulesParam(t *testing.T) {
+	assert.Equal(t, "", KernelModulesParam(nil, 0, false))
+	assert.Equal(t, " matchlock.modules=vdb:00-nf_tables.ko,01-nft_nat.ko", KernelModulesParam([]string{"00-nf_tables.ko", "01-nft_nat.ko"}, 0, false))
+	assert.Equal(t, " matchlock.modules=vde:00-nf_tables.ko", KernelModulesParam([]string{"00-nf_tables.ko"}, 2, true))
+}
@@ -0,0 +1,61 @@
+package vm
+
+import (
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+// BootErrorScanner watches a VM console log for the boot error line written
+// by guest-init. Each Scan only reads what was appended since the last one,
+// so it is cheap to call from a readiness poll loop.
+type BootErrorScanner struct {
+	path    string
+	offset  int64
+	partial []byte
+}
+
+// NewBootErrorScanner returns a scanner for the console log at path. An
+// empty path yields a scanner that never reports an error.
+func NewBootErrorScanner(path string) *BootErrorScanner {
+	return &BootErrorScanner{path: path}
+}
+
+// Scan returns the first boot error in the newly appended log lines, or nil.
+// A missing or unreadable log is treated as having no boot error.
+func (s *BootErrorScanner) Scan() *api.BootError {
+	if s.path == "" {
+		return nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(s.offset, io.SeekStart); err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil
+	}
+	s.offset += int64(len(data))
+
+	data = append(s.partial, data...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if bootErr := api.ParseBootError(string(data[:i])); bootErr != nil {
+			s.partial = nil
+			return bootErr
+		}
+		data = data[i+1:]
+	}
+	s.partial = append([]byte(nil), data...)
+	return nil
+}
@@ -0,0 +1,38 @@
+package vm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func TestBootErrorScannerReadsAppendedLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.log")
+	require.NoError(t, os.WriteFile(path, []byte("[    0.1] booting\n[init] MATCHLOCK_BOOT_ERROR: missing"), 0644))
+
+	s := NewBootErrorScanner(path)
+	assert.Nil(t, s.Scan())
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString("_dns missing matchlock.dns\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	bootErr := s.Scan()
+	require.NotNil(t, bootErr)
+	assert.Equal(t, api.BootErrorMissingDNS, bootErr.Code)
+	assert.Equal(t, "missing matchlock.dns", bootErr.Message)
+	assert.ErrorIs(t, bootErr, api.ErrBootMissingDNS)
+	assert.ErrorIs(t, bootErr, api.ErrBootFailed)
+}
+
+func TestBootErrorScannerMissingLog(t *testing.T) {
+	assert.Nil(t, NewBootErrorScanner(filepath.Join(t.TempDir(), "missing.log")).Scan())
+	assert.Nil(t, NewBootErrorScanner("").Scan())
+}
@@ -0,0 +1,79 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// CrashDumpLogTailBytes bounds how much of the VM console log is copied into
+// a crash dump. Kernel panics are printed last, so the tail is what matters.
+const CrashDumpLogTailBytes = 64 * 1024
+
+// CrashDump describes an unexpected VM exit.
+type CrashDump struct {
+	VMID    string
+	Reason  string // Exit description, e.g. "exit status 1" or "signal: killed"
+	LogPath string // Console log whose tail is captured
+	Context string // Optional extra context such as lifecycle state
+}
+
+// WriteCrashDump writes a crash-<timestamp>.txt file into dir and returns its
+// path. A missing or unreadable log is recorded in the dump rather than
+// failing the write.
+func WriteCrashDump(dir string, dump CrashDump) (string, error) {
+	now := time.Now().UTC()
+	path := filepath.Join(dir, fmt.Sprintf("crash-%s.txt", now.Format("20060102T150405.000Z")))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "vm: %s\n", dump.VMID)
+	fmt.Fprintf(&sb, "time: %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(&sb, "reason: %s\n", dump.Reason)
+	if dump.Context != "" {
+		fmt.Fprintf(&sb, "\n--- context ---\n%s\n", strings.TrimRight(dump.Context, "\n"))
+	}
+	if dump.LogPath != "" {
+		fmt.Fprintf(&sb, "\n--- log tail (%s) ---\n", dump.LogPath)
+		tail, err := readTail(dump.LogPath, CrashDumpLogTailBytes)
+		if err != nil {
+			fmt.Fprintf(&sb, "<%v>\n", err)
+		} else {
+			sb.Write(tail)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(sb.String()), 0600); err != nil {
+		return "", errx.Wrap(ErrCreateCrashDump, err)
+	}
+	return path, nil
+}
+
+func readTail(path string, max int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errx.Wrap(ErrReadVMLog, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, errx.Wrap(ErrReadVMLog, err)
+	}
+	offset := fi.Size() - max
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, errx.Wrap(ErrReadVMLog, err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, errx.Wrap(ErrReadVMLog, err)
+	}
+	return data, nil
+}
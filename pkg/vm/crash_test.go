@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteCrashDumpIncludesLogTail(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "vm.log")
+	log := strings.Repeat("x", 2*CrashDumpLogTailBytes) + "Kernel panic - not syncing\n"
+	require.NoError(t, os.WriteFile(logPath, []byte(log), 0644))
+
+	path, err := WriteCrashDump(dir, CrashDump{
+		VMID:    "vm-test",
+		Reason:  "exit status 1",
+		LogPath: logPath,
+		Context: "phase: running",
+	})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(filepath.Base(path), "crash-"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	content := string(data)
+	assert.Contains(t, content, "vm: vm-test")
+	assert.Contains(t, content, "reason: exit status 1")
+	assert.Contains(t, content, "phase: running")
+	assert.Contains(t, content, "Kernel panic - not syncing")
+	assert.Less(t, len(content), len(log), "only the log tail should be captured")
+}
+
+func TestWriteCrashDumpMissingLog(t *testing.T) {
+	dir := t.TempDir()
+	path, err := WriteCrashDump(dir, CrashDump{
+		VMID:    "vm-test",
+		Reason:  "signal: killed",
+		LogPath: filepath.Join(dir, "missing.log"),
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "read VM log")
+}
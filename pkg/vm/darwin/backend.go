@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"path/filepath"
 
@@ -13,12 +14,7 @@ import (
 	"github.com/jingkaihe/matchlock/internal/errx"
 	"github.com/jingkaihe/matchlock/pkg/api"
 	"github.com/jingkaihe/matchlock/pkg/vm"
-)
-
-const (
-	VsockPortExec  = 5000
-	VsockPortVFS   = 5001
-	VsockPortReady = 5002
+	"github.com/jingkaihe/matchlock/pkg/vsock"
 )
 
 type DarwinBackend struct{}
@@ -32,6 +28,10 @@ func (b *DarwinBackend) Name() string {
 }
 
 func (b *DarwinBackend) Create(ctx context.Context, config *vm.VMConfig) (vm.Machine, error) {
+	if err := config.VsockPorts.Validate(); err != nil {
+		return nil, err
+	}
+
 	// Verify files exist
 	if _, err := os.Stat(config.KernelPath); err != nil {
 		return nil, errx.With(ErrKernelNotFound, ": %s: %w", config.KernelPath, err)
@@ -42,8 +42,13 @@ func (b *DarwinBackend) Create(ctx context.Context, config *vm.VMConfig) (vm.Mac
 
 	// Copy rootfs to temp file so each VM gets a clean image
 	// (VMs write to the rootfs and would corrupt the cached image)
-	// If PrebuiltRootfs is set, skip the copy (caller already prepared it)
+	// If PrebuiltRootfs is set, skip the copy (caller already prepared it).
+	// With a rootfs overlay the base is attached read-only and never copied;
+	// the overlay is the only per-VM disk.
 	tempRootfs := config.PrebuiltRootfs
+	if tempRootfs == "" {
+		tempRootfs = config.RootfsOverlay
+	}
 	if tempRootfs == "" {
 		var err error
 		tempRootfs, err = CopyRootfsToTemp(config.RootfsPath)
@@ -94,14 +99,16 @@ func (b *DarwinBackend) Create(ctx context.Context, config *vm.VMConfig) (vm.Mac
 	}
 
 	configWithRootfs := *config
-	configWithRootfs.RootfsPath = tempRootfs
+	if config.RootfsOverlay == "" {
+		configWithRootfs.RootfsPath = tempRootfs
+	}
 	if err := b.configureStorage(vzConfig, &configWithRootfs); err != nil {
 		os.Remove(tempRootfs)
 		socketPair.Close()
 		return nil, errx.Wrap(ErrStorageConfig, err)
 	}
 
-	if err := b.configureNetwork(vzConfig, socketPair, config.UseInterception); err != nil {
+	if err := b.configureNetwork(vzConfig, socketPair, config.UseInterception, config.MACAddress); err != nil {
 		os.Remove(tempRootfs)
 		socketPair.Close()
 		return nil, errx.Wrap(ErrNetworkConfig, err)
@@ -160,7 +167,7 @@ func (b *DarwinBackend) buildKernelArgs(config *vm.VMConfig) string {
 
 	workspace := config.Workspace
 	if workspace == "" {
-		workspace = "/workspace"
+		workspace = api.DefaultWorkspace
 	}
 
 	hostname := config.Hostname
@@ -174,6 +181,26 @@ func (b *DarwinBackend) buildKernelArgs(config *vm.VMConfig) string {
 	privilegedArg := ""
 	if config.Privileged {
 		privilegedArg = " matchlock.privileged=1"
+	} else {
+		privilegedArg = vm.KernelCapParams(config.CapAdd, config.CapDrop)
+		privilegedArg += vm.KernelIsolationParams(config.AllowSyscalls, config.KeepNewPrivs)
+	}
+	if config.SeccompAudit {
+		privilegedArg += " matchlock.seccomp_audit=1"
+	}
+	privilegedArg += vm.KernelSwapParam(config.SwapMB)
+	privilegedArg += vm.KernelUlimitParam(config.Ulimits)
+	privilegedArg += vm.KernelUserParam(config.User)
+	privilegedArg += vm.KernelRoutesParam(config.Routes)
+	privilegedArg += vm.KernelNetworkWaitParam(config.NetworkProbe)
+	privilegedArg += vm.KernelSocketMountsParam(config.SocketMounts)
+	privilegedArg += config.VsockPorts.KernelParam()
+	privilegedArg += vm.KernelResolvParams(config.SearchDomains, config.ResolvOptions)
+	privilegedArg += vm.KernelOverlayRootParam(config.RootfsOverlay, len(config.ExtraDisks))
+
+	rootMode := "rw"
+	if config.RootfsOverlay != "" {
+		rootMode = "ro"
 	}
 
 	diskArgs := ""
@@ -197,14 +224,14 @@ func (b *DarwinBackend) buildKernelArgs(config *vm.VMConfig) string {
 			gatewayIP = "192.168.100.1"
 		}
 		return fmt.Sprintf(
-			"console=hvc0 root=/dev/vda rw init=/init reboot=k panic=1 ip=%s::%s:255.255.255.0::eth0:off%s hostname=%s matchlock.workspace=%s matchlock.dns=%s matchlock.mtu=%d%s%s%s",
-			guestIP, gatewayIP, vm.KernelIPDNSSuffix(config.DNSServers), hostname, workspace, vm.KernelDNSParam(config.DNSServers), mtu, privilegedArg, diskArgs, addHostArgs,
+			"console=hvc0 root=/dev/vda %s init=/init reboot=k panic=1 ip=%s::%s:255.255.255.0::eth0:off%s hostname=%s matchlock.workspace=%s matchlock.dns=%s matchlock.mtu=%d%s%s%s",
+			rootMode, guestIP, gatewayIP, vm.KernelIPDNSSuffix(config.DNSServers), hostname, workspace, vm.KernelDNSParam(config.DNSServers), mtu, privilegedArg, diskArgs, addHostArgs,
 		)
 	}
 
 	return fmt.Sprintf(
-		"console=hvc0 root=/dev/vda rw init=/init reboot=k panic=1 ip=dhcp hostname=%s matchlock.workspace=%s matchlock.dns=%s matchlock.mtu=%d%s%s%s",
-		hostname, workspace, vm.KernelDNSParam(config.DNSServers), mtu, privilegedArg, diskArgs, addHostArgs,
+		"console=hvc0 root=/dev/vda %s init=/init reboot=k panic=1 ip=dhcp hostname=%s matchlock.workspace=%s matchlock.dns=%s matchlock.mtu=%d%s%s%s",
+		rootMode, hostname, workspace, vm.KernelDNSParam(config.DNSServers), mtu, privilegedArg, diskArgs, addHostArgs,
 	)
 }
 
@@ -218,7 +245,7 @@ func effectiveMTU(mtu int) int {
 func (b *DarwinBackend) configureStorage(vzConfig *vz.VirtualMachineConfiguration, config *vm.VMConfig) error {
 	diskAttachment, err := vz.NewDiskImageStorageDeviceAttachmentWithCacheAndSync(
 		config.RootfsPath,
-		false,
+		config.RootfsOverlay != "",
 		vz.DiskImageCachingModeAutomatic,
 		vz.DiskImageSynchronizationModeFsync,
 	)
@@ -252,6 +279,23 @@ func (b *DarwinBackend) configureStorage(vzConfig *vz.VirtualMachineConfiguratio
 		devices = append(devices, extraConfig)
 	}
 
+	if config.RootfsOverlay != "" {
+		overlayAttachment, err := vz.NewDiskImageStorageDeviceAttachmentWithCacheAndSync(
+			config.RootfsOverlay,
+			false,
+			vz.DiskImageCachingModeAutomatic,
+			vz.DiskImageSynchronizationModeFsync,
+		)
+		if err != nil {
+			return errx.With(ErrDiskAttachment, ": rootfs overlay: %w", err)
+		}
+		overlayConfig, err := vz.NewVirtioBlockDeviceConfiguration(overlayAttachment)
+		if err != nil {
+			return errx.With(ErrStorageConfig, ": rootfs overlay: %w", err)
+		}
+		devices = append(devices, overlayConfig)
+	}
+
 	vzConfig.SetStorageDevicesVirtualMachineConfiguration(devices)
 	return nil
 }
@@ -291,7 +335,7 @@ func CopyRootfsToTemp(srcPath string) (string, error) {
 	return dstPath, nil
 }
 
-func (b *DarwinBackend) configureNetwork(vzConfig *vz.VirtualMachineConfiguration, socketPair *SocketPair, useInterception bool) error {
+func (b *DarwinBackend) configureNetwork(vzConfig *vz.VirtualMachineConfiguration, socketPair *SocketPair, useInterception bool, macAddress string) error {
 	var netAttachment vz.NetworkDeviceAttachment
 	var err error
 
@@ -314,7 +358,16 @@ func (b *DarwinBackend) configureNetwork(vzConfig *vz.VirtualMachineConfiguratio
 		return errx.Wrap(ErrNetworkConfig, err)
 	}
 
-	mac, err := vz.NewRandomLocallyAdministeredMACAddress()
+	var mac *vz.MACAddress
+	if macAddress != "" {
+		hw, parseErr := net.ParseMAC(macAddress)
+		if parseErr != nil {
+			return errx.Wrap(ErrMACAddress, parseErr)
+		}
+		mac, err = vz.NewMACAddress(hw)
+	} else {
+		mac, err = vz.NewRandomLocallyAdministeredMACAddress()
+	}
 	if err != nil {
 		return errx.Wrap(ErrMACAddress, err)
 	}
@@ -325,9 +378,12 @@ func (b *DarwinBackend) configureNetwork(vzConfig *vz.VirtualMachineConfiguratio
 }
 
 func (b *DarwinBackend) configureConsole(vzConfig *vz.VirtualMachineConfiguration, config *vm.VMConfig) error {
-	// Debug console - kernel output goes to file
-	home, _ := os.UserHomeDir()
-	logPath := filepath.Join(home, ".cache", "matchlock", "console.log")
+	// Debug console - kernel and guest runtime output goes to file
+	logPath := config.LogPath
+	if logPath == "" {
+		home, _ := os.UserHomeDir()
+		logPath = filepath.Join(home, ".cache", "matchlock", "console.log")
+	}
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		return errx.Wrap(ErrConsoleLog, err)
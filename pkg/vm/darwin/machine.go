@@ -57,15 +57,20 @@ func (m *DarwinMachine) Start(ctx context.Context) error {
 
 func (m *DarwinMachine) waitForReady(ctx context.Context, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
+	bootErrors := vm.NewBootErrorScanner(m.config.LogPath)
 
 	for time.Now().Before(deadline) {
+		if bootErr := bootErrors.Scan(); bootErr != nil {
+			return bootErr
+		}
+
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		conn, err := m.dialVsock(VsockPortReady)
+		conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceReady))
 		if err == nil {
 			conn.Close()
 			return nil
@@ -74,6 +79,9 @@ func (m *DarwinMachine) waitForReady(ctx context.Context, timeout time.Duration)
 		time.Sleep(100 * time.Millisecond)
 	}
 
+	if bootErr := bootErrors.Scan(); bootErr != nil {
+		return bootErr
+	}
 	return ErrVMReady
 }
 
@@ -171,7 +179,7 @@ func (m *DarwinMachine) Wait(ctx context.Context) error {
 
 func (m *DarwinMachine) Exec(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
 	if opts != nil && opts.Stdin != nil {
-		conn, err := m.dialVsock(VsockPortExec)
+		conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceExec))
 		if err != nil {
 			return nil, errx.Wrap(ErrExecConnect, err)
 		}
@@ -180,7 +188,7 @@ func (m *DarwinMachine) Exec(ctx context.Context, command string, opts *api.Exec
 
 	start := time.Now()
 
-	conn, err := m.dialVsock(VsockPortExec)
+	conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceExec))
 	if err != nil {
 		return nil, errx.Wrap(ErrExecConnect, err)
 	}
@@ -200,6 +208,11 @@ func (m *DarwinMachine) Exec(ctx context.Context, command string, opts *api.Exec
 		req.WorkingDir = opts.WorkingDir
 		req.Env = opts.Env
 		req.User = opts.User
+		req.LoginShell = opts.LoginShell
+		req.Shell = opts.Shell
+		req.Args = opts.Args
+		req.TimeoutMS = opts.TimeoutMS
+		req.Setup = opts.Setup
 	}
 
 	reqData, err := json.Marshal(req)
@@ -289,8 +302,15 @@ func (m *DarwinMachine) Exec(ctx context.Context, command string, opts *api.Exec
 				Stderr:     stderrData,
 				Duration:   duration,
 				DurationMS: duration.Milliseconds(),
+				UserTimeMS: resp.UserTimeMS,
+				SysTimeMS:  resp.SysTimeMS,
+				MaxRSSKB:   resp.MaxRSSKB,
 			}
 
+			if resp.Error == vsock.ExecErrorTimeout {
+				result.TimedOut = true
+				return result, errx.With(api.ErrExecTimeout, " after %dms", req.TimeoutMS)
+			}
 			if resp.Error != "" {
 				return result, errx.With(ErrExecRemote, ": %s", resp.Error)
 			}
@@ -301,7 +321,7 @@ func (m *DarwinMachine) Exec(ctx context.Context, command string, opts *api.Exec
 }
 
 func (m *DarwinMachine) ExecInteractive(ctx context.Context, command string, opts *api.ExecOptions, rows, cols uint16, stdin io.Reader, stdout io.Writer, resizeCh <-chan [2]uint16) (int, error) {
-	conn, err := m.dialVsock(VsockPortExec)
+	conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceExec))
 	if err != nil {
 		return 1, errx.Wrap(ErrExecConnect, err)
 	}
@@ -316,6 +336,9 @@ func (m *DarwinMachine) ExecInteractive(ctx context.Context, command string, opt
 		req.WorkingDir = opts.WorkingDir
 		req.Env = opts.Env
 		req.User = opts.User
+		req.LoginShell = opts.LoginShell
+		req.Shell = opts.Shell
+		req.Args = opts.Args
 	}
 
 	reqData, err := json.Marshal(req)
@@ -383,12 +406,22 @@ func (m *DarwinMachine) ExecInteractive(ctx context.Context, command string, opt
 		}
 	}()
 
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
 	go func() {
-		for size := range resizeCh {
-			data := make([]byte, 4)
-			binary.BigEndian.PutUint16(data[0:2], size[0])
-			binary.BigEndian.PutUint16(data[2:4], size[1])
-			vsock.SendMessage(conn, vsock.MsgTypeResize, data)
+		for {
+			select {
+			case size, ok := <-resizeCh:
+				if !ok {
+					return
+				}
+				data := make([]byte, 4)
+				binary.BigEndian.PutUint16(data[0:2], size[0])
+				binary.BigEndian.PutUint16(data[2:4], size[1])
+				vsock.SendMessage(conn, vsock.MsgTypeResize, data)
+			case <-sessionDone:
+				return
+			}
 		}
 	}()
 
@@ -468,7 +501,7 @@ func (m *DarwinMachine) SetupVFSListener() (*vz.VirtioSocketListener, error) {
 		return nil, ErrNoVsockDevice
 	}
 
-	listener, err := socketDevice.Listen(VsockPortVFS)
+	listener, err := socketDevice.Listen(m.config.VsockPorts.Port(vsock.ServiceVFS))
 	if err != nil {
 		return nil, err
 	}
@@ -476,6 +509,36 @@ func (m *DarwinMachine) SetupVFSListener() (*vz.VirtioSocketListener, error) {
 	return listener, nil
 }
 
+// SetupAuditListener listens for the guest's seccomp audit stream. The caller
+// owns the returned listener.
+func (m *DarwinMachine) SetupAuditListener() (*vz.VirtioSocketListener, error) {
+	socketDevice := m.SocketDevice()
+	if socketDevice == nil {
+		return nil, ErrNoVsockDevice
+	}
+	return socketDevice.Listen(m.config.VsockPorts.Port(vsock.ServiceAudit))
+}
+
+// SetupPolicyListener listens for guest network policy queries. The caller
+// owns the returned listener.
+func (m *DarwinMachine) SetupPolicyListener() (*vz.VirtioSocketListener, error) {
+	socketDevice := m.SocketDevice()
+	if socketDevice == nil {
+		return nil, ErrNoVsockDevice
+	}
+	return socketDevice.Listen(m.config.VsockPorts.Port(vsock.ServicePolicy))
+}
+
+// SetupSocketListener listens for guest unix socket mount connections. The
+// caller owns the returned listener.
+func (m *DarwinMachine) SetupSocketListener() (*vz.VirtioSocketListener, error) {
+	socketDevice := m.SocketDevice()
+	if socketDevice == nil {
+		return nil, ErrNoVsockDevice
+	}
+	return socketDevice.Listen(m.config.VsockPorts.Port(vsock.ServiceSocket))
+}
+
 func (m *DarwinMachine) Config() *vm.VMConfig {
 	return m.config
 }
@@ -0,0 +1,9 @@
+package vm
+
+import "errors"
+
+// Crash dump errors
+var (
+	ErrCreateCrashDump = errors.New("create crash dump")
+	ErrReadVMLog       = errors.New("read VM log")
+)
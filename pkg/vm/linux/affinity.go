@@ -0,0 +1,55 @@
+//go:build linux
+
+package linux
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"golang.org/x/sys/unix"
+)
+
+// validateCPUAffinity checks that every requested CPU is one this process
+// may run on, so a pin to an offline or cgroup-excluded core fails before
+// the VM is created rather than after Firecracker has started.
+func validateCPUAffinity(cpus []int) error {
+	if len(cpus) == 0 {
+		return nil
+	}
+	var allowed unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &allowed); err != nil {
+		return errx.Wrap(ErrCPUAffinity, err)
+	}
+	for _, cpu := range cpus {
+		if cpu < 0 || !allowed.IsSet(cpu) {
+			return errx.With(ErrCPUAffinity, ": CPU %d is not available on this host", cpu)
+		}
+	}
+	return nil
+}
+
+// pinProcess sets the affinity of every thread of pid to cpus. Threads
+// created afterwards inherit the mask from the thread that spawns them.
+func pinProcess(pid int, cpus []int) error {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	tasks, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(pid), "task"))
+	if err != nil {
+		return errx.Wrap(ErrCPUAffinity, err)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		// A thread may exit between listing and pinning.
+		if err := unix.SchedSetaffinity(tid, &set); err != nil && err != unix.ESRCH {
+			return errx.With(ErrCPUAffinity, ": thread %d: %w", tid, err)
+		}
+	}
+	return nil
+}
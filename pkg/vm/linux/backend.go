@@ -7,6 +7,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -24,15 +26,6 @@ import (
 	"github.com/jingkaihe/matchlock/pkg/vsock"
 )
 
-const (
-	// VsockPortExec is the port for command execution
-	VsockPortExec = 5000
-	// VsockPortVFS is the port for VFS protocol
-	VsockPortVFS = 5001
-	// VsockPortReady is the port for ready signal
-	VsockPortReady = 5002
-)
-
 type LinuxBackend struct{}
 
 func NewLinuxBackend() *LinuxBackend {
@@ -44,6 +37,16 @@ func (b *LinuxBackend) Name() string {
 }
 
 func (b *LinuxBackend) Create(ctx context.Context, config *vm.VMConfig) (vm.Machine, error) {
+	if err := CheckKVM(); err != nil {
+		return nil, err
+	}
+	if err := validateCPUAffinity(config.CPUAffinity); err != nil {
+		return nil, err
+	}
+	if err := config.VsockPorts.Validate(); err != nil {
+		return nil, err
+	}
+
 	tapName := tapNameForVMID(config.ID)
 	tapFD, err := CreateTAP(tapName)
 	if err != nil {
@@ -56,8 +59,21 @@ func (b *LinuxBackend) Create(ctx context.Context, config *vm.VMConfig) (vm.Mach
 		subnetCIDR = "192.168.100.1/24"
 	}
 
-	// Initial TAP configuration (will be refreshed after Firecracker starts)
-	if err := ConfigureInterface(tapName, subnetCIDR); err != nil {
+	// Initial TAP configuration (will be refreshed after Firecracker
+	// starts). On a shared bridge the bridge holds the gateway address and
+	// the TAP is just one of its ports.
+	if config.Bridge != "" {
+		if err := EnsureBridge(config.Bridge, subnetCIDR); err != nil {
+			syscall.Close(tapFD)
+			DeleteInterface(tapName)
+			return nil, errx.Wrap(ErrBridge, err)
+		}
+		if err := AttachToBridge(config.Bridge, tapName); err != nil {
+			syscall.Close(tapFD)
+			DeleteInterface(tapName)
+			return nil, errx.Wrap(ErrBridge, err)
+		}
+	} else if err := ConfigureInterface(tapName, subnetCIDR); err != nil {
 		syscall.Close(tapFD)
 		DeleteInterface(tapName)
 		return nil, errx.Wrap(ErrTAPConfigure, err)
@@ -72,12 +88,16 @@ func (b *LinuxBackend) Create(ctx context.Context, config *vm.VMConfig) (vm.Mach
 	// Close the FD - Firecracker will re-open the device by name
 	syscall.Close(tapFD)
 
+	macAddress := config.MACAddress
+	if macAddress == "" {
+		macAddress = GenerateMAC(config.ID)
+	}
 	m := &LinuxMachine{
 		id:         config.ID,
 		config:     config,
 		tapName:    tapName,
 		tapFD:      -1, // FD closed, Firecracker will open it
-		macAddress: GenerateMAC(config.ID),
+		macAddress: macAddress,
 	}
 
 	return m, nil
@@ -105,6 +125,23 @@ type LinuxMachine struct {
 	cmd        *exec.Cmd
 	pid        int
 	started    bool
+	// cgroupDir is the VM's own host cgroup when VMConfig.CgroupParent
+	// is set.
+	cgroupDir string
+
+	// exited is closed once the Firecracker process has been reaped.
+	// exitErr and crashPath are only valid after that.
+	exited    chan struct{}
+	exitErr   error
+	crashPath string
+	stopping  atomic.Bool
+
+	paused atomic.Bool
+
+	// restoreDir, when set, makes Start load this snapshot instead of
+	// booting; restoreDrives are the drives it recorded.
+	restoreDir    string
+	restoreDrives []snapshotDrive
 }
 
 func (m *LinuxMachine) Start(ctx context.Context) error {
@@ -112,17 +149,17 @@ func (m *LinuxMachine) Start(ctx context.Context) error {
 		return nil
 	}
 
-	fcConfig := m.generateFirecrackerConfig()
-
-	configPath := filepath.Join(filepath.Dir(m.config.SocketPath), "config.json")
-	if err := os.WriteFile(configPath, fcConfig, 0644); err != nil {
-		return errx.Wrap(ErrWriteConfig, err)
+	args := []string{"--api-sock", m.config.SocketPath}
+	// A restored machine is configured by the snapshot, not a config file.
+	if m.restoreDir == "" {
+		configPath := filepath.Join(filepath.Dir(m.config.SocketPath), "config.json")
+		if err := os.WriteFile(configPath, m.generateFirecrackerConfig(), 0644); err != nil {
+			return errx.Wrap(ErrWriteConfig, err)
+		}
+		args = append(args, "--config-file", configPath)
 	}
 
-	m.cmd = exec.CommandContext(ctx, "firecracker",
-		"--api-sock", m.config.SocketPath,
-		"--config-file", configPath,
-	)
+	m.cmd = exec.CommandContext(ctx, "firecracker", args...)
 
 	if m.config.LogPath != "" {
 		logFile, err := os.Create(m.config.LogPath)
@@ -133,23 +170,68 @@ func (m *LinuxMachine) Start(ctx context.Context) error {
 		m.cmd.Stderr = logFile
 	}
 
+	if m.config.CgroupParent != "" {
+		dir, err := createVMCgroup(m.config.CgroupParent, m.id)
+		if err != nil {
+			return err
+		}
+		cgroupFD, err := os.Open(dir)
+		if err != nil {
+			removeVMCgroup(dir)
+			return errx.Wrap(ErrCgroup, err)
+		}
+		defer cgroupFD.Close()
+		// Start Firecracker inside the cgroup so all of its memory and
+		// threads are charged there from the first instruction.
+		m.cmd.SysProcAttr = &syscall.SysProcAttr{UseCgroupFD: true, CgroupFD: int(cgroupFD.Fd())}
+		m.cgroupDir = dir
+	}
+
 	if err := m.cmd.Start(); err != nil {
+		if m.cgroupDir != "" {
+			removeVMCgroup(m.cgroupDir)
+			m.cgroupDir = ""
+		}
 		return errx.Wrap(ErrStartFirecracker, err)
 	}
 
 	m.pid = m.cmd.Process.Pid
 	m.started = true
+	m.exited = make(chan struct{})
+	go m.reap(ctx)
+
+	if m.restoreDir != "" {
+		if err := m.loadSnapshot(ctx); err != nil {
+			m.Stop(ctx)
+			return err
+		}
+	}
+
+	if err := m.pinCPUs(); err != nil {
+		m.Stop(ctx)
+		return err
+	}
 
 	// Give Firecracker a moment to open the TAP device, then configure it
 	time.Sleep(100 * time.Millisecond)
 
+	// vCPU threads spawned before the first pin landed are caught here.
+	if err := m.pinCPUs(); err != nil {
+		m.Stop(ctx)
+		return err
+	}
+
 	// Re-configure the TAP interface (Firecracker resets it when opening)
 	// Use configured subnet or default
 	subnetCIDR := m.config.SubnetCIDR
 	if subnetCIDR == "" {
 		subnetCIDR = "192.168.100.1/24"
 	}
-	ConfigureInterface(m.tapName, subnetCIDR)
+	if m.config.Bridge != "" {
+		AttachToBridge(m.config.Bridge, m.tapName)
+	} else {
+		ConfigureInterface(m.tapName, subnetCIDR)
+	}
 	SetMTU(m.tapName, effectiveMTU(m.config.MTU))
 
 	// Wait for VM to be ready
@@ -166,6 +248,66 @@ func (m *LinuxMachine) Start(ctx context.Context) error {
 	return nil
 }
 
+// pinCPUs applies VMConfig.CPUAffinity to the Firecracker process.
+func (m *LinuxMachine) pinCPUs() error {
+	if len(m.config.CPUAffinity) == 0 {
+		return nil
+	}
+	return pinProcess(m.pid, m.config.CPUAffinity)
+}
+
+// reap waits for the Firecracker process and, unless the exit was requested
+// via Stop or context cancellation, records a crash dump before signalling
+// exited so callers observing the exit can report the dump path.
+func (m *LinuxMachine) reap(ctx context.Context) {
+	err := m.cmd.Wait()
+	m.exitErr = err
+	if !m.stopping.Load() && ctx.Err() == nil {
+		m.crashPath = m.captureCrash(err)
+	}
+	close(m.exited)
+}
+
+func (m *LinuxMachine) captureCrash(waitErr error) string {
+	dir := m.config.CrashDumpDir
+	if dir == "" {
+		return ""
+	}
+	reason := "exit status 0"
+	if waitErr != nil {
+		reason = waitErr.Error()
+	} else if m.cmd.ProcessState != nil {
+		reason = m.cmd.ProcessState.String()
+	}
+	var extra string
+	if m.config.CrashContext != nil {
+		extra = m.config.CrashContext()
+	}
+	path, err := vm.WriteCrashDump(dir, vm.CrashDump{
+		VMID:    m.id,
+		Reason:  reason,
+		LogPath: m.config.LogPath,
+		Context: extra,
+	})
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+// exitError describes an unexpected Firecracker exit, pointing at the crash
+// dump when one was written.
+func (m *LinuxMachine) exitError() error {
+	reason := "exit status 0"
+	if m.exitErr != nil {
+		reason = m.exitErr.Error()
+	}
+	if m.crashPath != "" {
+		return errx.With(ErrVMExited, " (%s); crash dump: %s", reason, m.crashPath)
+	}
+	return errx.With(ErrVMExited, " (%s)", reason)
+}
+
 func (m *LinuxMachine) waitForReady(ctx context.Context, timeout time.Duration) error {
 	if m.config.VsockPath == "" {
 		return nil
@@ -174,16 +316,27 @@ func (m *LinuxMachine) waitForReady(ctx context.Context, timeout time.Duration)
 	deadline := time.Now().Add(timeout)
 	vsockFailCount := 0
 	maxVsockFailures := 50 // After 5 seconds of vsock failures, use fallback
+	bootErrors := vm.NewBootErrorScanner(m.config.LogPath)
 
 	for time.Now().Before(deadline) {
+		// A boot error explains a later exit or timeout, so it wins.
+		if bootErr := bootErrors.Scan(); bootErr != nil {
+			return bootErr
+		}
+
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-m.exited:
+			if bootErr := bootErrors.Scan(); bootErr != nil {
+				return bootErr
+			}
+			return m.exitError()
 		default:
 		}
 
 		// Try to connect to the ready port via UDS forwarded by Firecracker
-		conn, err := m.dialVsock(VsockPortReady)
+		conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceReady))
 		if err == nil {
 			conn.Close()
 			return nil
@@ -206,6 +359,9 @@ func (m *LinuxMachine) waitForReady(ctx context.Context, timeout time.Duration)
 		time.Sleep(100 * time.Millisecond)
 	}
 
+	if bootErr := bootErrors.Scan(); bootErr != nil {
+		return bootErr
+	}
 	return ErrVMReadyTimeout
 }
 
@@ -266,7 +422,7 @@ func (m *LinuxMachine) generateFirecrackerConfig() []byte {
 		}
 		workspace := m.config.Workspace
 		if workspace == "" {
-			workspace = "/workspace"
+			workspace = api.DefaultWorkspace
 		}
 		hostname := m.config.Hostname
 		if hostname == "" {
@@ -274,11 +430,27 @@ func (m *LinuxMachine) generateFirecrackerConfig() []byte {
 		}
 
 		mtu := effectiveMTU(m.config.MTU)
-		kernelArgs = fmt.Sprintf("console=ttyS0 reboot=k panic=1 acpi=off init=/init ip=%s::%s:255.255.255.0::eth0:off%s hostname=%s matchlock.workspace=%s matchlock.dns=%s",
-			guestIP, gatewayIP, vm.KernelIPDNSSuffix(m.config.DNSServers), hostname, workspace, vm.KernelDNSParam(m.config.DNSServers))
+		kernelArgs = fmt.Sprintf("console=ttyS0 reboot=k panic=1 acpi=off init=/init ip=%s::%s:%s::eth0:off%s hostname=%s matchlock.workspace=%s matchlock.dns=%s",
+			guestIP, gatewayIP, vm.KernelNetmask(m.config.SubnetCIDR), vm.KernelIPDNSSuffix(m.config.DNSServers), hostname, workspace, vm.KernelDNSParam(m.config.DNSServers))
 		kernelArgs += fmt.Sprintf(" matchlock.mtu=%d", mtu)
+		kernelArgs += vm.KernelSwapParam(m.config.SwapMB)
+		kernelArgs += vm.KernelUlimitParam(m.config.Ulimits)
+		kernelArgs += vm.KernelUserParam(m.config.User)
+		kernelArgs += vm.KernelRoutesParam(m.config.Routes)
+		kernelArgs += vm.KernelNetworkWaitParam(m.config.NetworkProbe)
+		kernelArgs += vm.KernelSocketMountsParam(m.config.SocketMounts)
+		kernelArgs += m.config.VsockPorts.KernelParam()
+		kernelArgs += vm.KernelResolvParams(m.config.SearchDomains, m.config.ResolvOptions)
+		kernelArgs += vm.KernelOverlayRootParam(m.config.RootfsOverlay, len(m.config.ExtraDisks))
+		kernelArgs += vm.KernelModulesParam(m.config.KernelModules, len(m.config.ExtraDisks), m.config.RootfsOverlay != "")
 		if m.config.Privileged {
 			kernelArgs += " matchlock.privileged=1"
+		} else {
+			kernelArgs += vm.KernelCapParams(m.config.CapAdd, m.config.CapDrop)
+			kernelArgs += vm.KernelIsolationParams(m.config.AllowSyscalls, m.config.KeepNewPrivs)
+		}
+		if m.config.SeccompAudit {
+			kernelArgs += " matchlock.seccomp_audit=1"
 		}
 		for i, disk := range m.config.ExtraDisks {
 			dev := string(rune('b' + i)) // vdb, vdc, ...
@@ -289,25 +461,6 @@ func (m *LinuxMachine) generateFirecrackerConfig() []byte {
 		}
 	}
 
-	type fcDrive struct {
-		DriveID      string `json:"drive_id"`
-		PathOnHost   string `json:"path_on_host"`
-		IsRootDevice bool   `json:"is_root_device"`
-		IsReadOnly   bool   `json:"is_read_only"`
-	}
-
-	drives := []fcDrive{
-		{DriveID: "rootfs", PathOnHost: m.config.RootfsPath, IsRootDevice: true, IsReadOnly: false},
-	}
-	for i, disk := range m.config.ExtraDisks {
-		drives = append(drives, fcDrive{
-			DriveID:      fmt.Sprintf("disk%d", i),
-			PathOnHost:   disk.HostPath,
-			IsRootDevice: false,
-			IsReadOnly:   disk.ReadOnly,
-		})
-	}
-
 	type fcConfig struct {
 		BootSource struct {
 			KernelImagePath string `json:"kernel_image_path"`
@@ -332,7 +485,7 @@ func (m *LinuxMachine) generateFirecrackerConfig() []byte {
 	var cfg fcConfig
 	cfg.BootSource.KernelImagePath = m.config.KernelPath
 	cfg.BootSource.BootArgs = kernelArgs
-	cfg.Drives = drives
+	cfg.Drives = m.drives()
 	cfg.MachineConfig.VCPUCount = m.config.CPUs
 	cfg.MachineConfig.MemSizeMiB = m.config.MemoryMB
 	cfg.NetworkInterfaces = []struct {
@@ -360,6 +513,45 @@ func (m *LinuxMachine) generateFirecrackerConfig() []byte {
 	return data
 }
 
+type fcDrive struct {
+	DriveID      string `json:"drive_id"`
+	PathOnHost   string `json:"path_on_host"`
+	IsRootDevice bool   `json:"is_root_device"`
+	IsReadOnly   bool   `json:"is_read_only"`
+}
+
+// drives lists the block devices attached to the VM, in attach order.
+func (m *LinuxMachine) drives() []fcDrive {
+	drives := []fcDrive{
+		{DriveID: "rootfs", PathOnHost: m.config.RootfsPath, IsRootDevice: true, IsReadOnly: m.config.RootfsOverlay != ""},
+	}
+	for i, disk := range m.config.ExtraDisks {
+		drives = append(drives, fcDrive{
+			DriveID:      fmt.Sprintf("disk%d", i),
+			PathOnHost:   disk.HostPath,
+			IsRootDevice: false,
+			IsReadOnly:   disk.ReadOnly,
+		})
+	}
+	if m.config.RootfsOverlay != "" {
+		drives = append(drives, fcDrive{
+			DriveID:      "rootfs_overlay",
+			PathOnHost:   m.config.RootfsOverlay,
+			IsRootDevice: false,
+			IsReadOnly:   false,
+		})
+	}
+	if m.config.ModulesDisk != "" {
+		drives = append(drives, fcDrive{
+			DriveID:      "kernel_modules",
+			PathOnHost:   m.config.ModulesDisk,
+			IsRootDevice: false,
+			IsReadOnly:   true,
+		})
+	}
+	return drives
+}
+
 func effectiveMTU(mtu int) int {
 	if mtu > 0 {
 		return mtu
@@ -367,45 +559,83 @@ func effectiveMTU(mtu int) int {
 	return api.DefaultNetworkMTU
 }
 
+// defaultStopGracePeriod is how long Stop waits after SIGTERM when neither
+// VMConfig.StopGracePeriod nor a context deadline says otherwise.
+const defaultStopGracePeriod = 5 * time.Second
+
+// Stop sends SIGTERM and waits for Firecracker to exit, escalating to
+// SIGKILL once the grace period ends. The grace period is the context's
+// deadline when it has one, so Close(ctx) callers control the budget, and
+// VMConfig.StopGracePeriod otherwise. Stop returns after the process has
+// been reaped; only reap calls cmd.Wait.
 func (m *LinuxMachine) Stop(ctx context.Context) error {
 	if m.cmd == nil || m.cmd.Process == nil {
 		return nil
 	}
+	m.stopping.Store(true)
 
 	// Check if process already exited
-	if m.cmd.ProcessState != nil && m.cmd.ProcessState.Exited() {
+	select {
+	case <-m.exited:
 		return nil
+	default:
 	}
 
 	if err := m.cmd.Process.Signal(syscall.SIGTERM); err != nil {
 		// Process already finished is not an error
-		if err.Error() == "os: process already finished" {
+		if errors.Is(err, os.ErrProcessDone) {
 			return nil
 		}
-		return m.cmd.Process.Kill()
+		return m.kill()
 	}
 
-	done := make(chan error, 1)
-	go func() {
-		_, err := m.cmd.Process.Wait()
-		done <- err
-	}()
-
+	timer := time.NewTimer(m.stopGracePeriod(ctx))
+	defer timer.Stop()
 	select {
-	case <-done:
+	case <-m.exited:
 		return nil
-	case <-time.After(5 * time.Second):
-		return m.cmd.Process.Kill()
+	case <-timer.C:
 	case <-ctx.Done():
-		return m.cmd.Process.Kill()
 	}
+	return m.kill()
+}
+
+func (m *LinuxMachine) stopGracePeriod(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	if m.config.StopGracePeriod > 0 {
+		return m.config.StopGracePeriod
+	}
+	return defaultStopGracePeriod
 }
 
+// kill sends SIGKILL and waits for reap to observe the exit, so the TAP
+// device and state files are no longer in use when Stop returns.
+func (m *LinuxMachine) kill() error {
+	if err := m.cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return err
+	}
+	<-m.exited
+	return nil
+}
+
+// Wait blocks until the Firecracker process exits. An exit that was not
+// requested via Stop is reported as ErrVMExited, including the crash dump
+// path when one was captured.
 func (m *LinuxMachine) Wait(ctx context.Context) error {
-	if m.cmd == nil {
+	if m.cmd == nil || m.exited == nil {
+		return nil
+	}
+	select {
+	case <-m.exited:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if m.stopping.Load() {
 		return nil
 	}
-	return m.cmd.Wait()
+	return m.exitError()
 }
 
 func (m *LinuxMachine) Exec(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
@@ -422,7 +652,7 @@ func (m *LinuxMachine) Exec(ctx context.Context, command string, opts *api.ExecO
 // forwards stdin to the guest process without allocating a PTY.
 func (m *LinuxMachine) execVsock(ctx context.Context, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
 	if opts != nil && opts.Stdin != nil {
-		conn, err := m.dialVsock(VsockPortExec)
+		conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceExec))
 		if err != nil {
 			return nil, errx.Wrap(ErrExecConnect, err)
 		}
@@ -431,7 +661,7 @@ func (m *LinuxMachine) execVsock(ctx context.Context, command string, opts *api.
 
 	start := time.Now()
 
-	conn, err := m.dialVsock(VsockPortExec)
+	conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceExec))
 	if err != nil {
 		return nil, errx.Wrap(ErrExecConnect, err)
 	}
@@ -451,6 +681,11 @@ func (m *LinuxMachine) execVsock(ctx context.Context, command string, opts *api.
 		req.WorkingDir = opts.WorkingDir
 		req.Env = opts.Env
 		req.User = opts.User
+		req.LoginShell = opts.LoginShell
+		req.Shell = opts.Shell
+		req.Args = opts.Args
+		req.TimeoutMS = opts.TimeoutMS
+		req.Setup = opts.Setup
 	}
 
 	reqData, err := json.Marshal(req)
@@ -540,8 +775,15 @@ func (m *LinuxMachine) execVsock(ctx context.Context, command string, opts *api.
 				Stderr:     stderrData,
 				Duration:   duration,
 				DurationMS: duration.Milliseconds(),
+				UserTimeMS: resp.UserTimeMS,
+				SysTimeMS:  resp.SysTimeMS,
+				MaxRSSKB:   resp.MaxRSSKB,
 			}
 
+			if resp.Error == vsock.ExecErrorTimeout {
+				result.TimedOut = true
+				return result, errx.With(api.ErrExecTimeout, " after %dms", req.TimeoutMS)
+			}
 			if resp.Error != "" {
 				return result, errx.With(ErrExecRemote, ": %s", resp.Error)
 			}
@@ -557,7 +799,7 @@ func (m *LinuxMachine) ExecInteractive(ctx context.Context, command string, opts
 		return 1, ErrVsockNotConfigured
 	}
 
-	conn, err := m.dialVsock(VsockPortExec)
+	conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceExec))
 	if err != nil {
 		return 1, errx.Wrap(ErrExecConnect, err)
 	}
@@ -573,6 +815,9 @@ func (m *LinuxMachine) ExecInteractive(ctx context.Context, command string, opts
 		req.WorkingDir = opts.WorkingDir
 		req.Env = opts.Env
 		req.User = opts.User
+		req.LoginShell = opts.LoginShell
+		req.Shell = opts.Shell
+		req.Args = opts.Args
 	}
 
 	reqData, err := json.Marshal(req)
@@ -643,13 +888,23 @@ func (m *LinuxMachine) ExecInteractive(ctx context.Context, command string, opts
 		}
 	}()
 
-	// Handle resize events
+	// Handle resize events until the session ends; resizeCh may outlive it
+	sessionDone := make(chan struct{})
+	defer close(sessionDone)
 	go func() {
-		for size := range resizeCh {
-			data := make([]byte, 4)
-			binary.BigEndian.PutUint16(data[0:2], size[0]) // rows
-			binary.BigEndian.PutUint16(data[2:4], size[1]) // cols
-			vsock.SendMessage(conn, vsock.MsgTypeResize, data)
+		for {
+			select {
+			case size, ok := <-resizeCh:
+				if !ok {
+					return
+				}
+				data := make([]byte, 4)
+				binary.BigEndian.PutUint16(data[0:2], size[0]) // rows
+				binary.BigEndian.PutUint16(data[2:4], size[1]) // cols
+				vsock.SendMessage(conn, vsock.MsgTypeResize, data)
+			case <-sessionDone:
+				return
+			}
 		}
 	}()
 
@@ -687,6 +942,11 @@ func (m *LinuxMachine) TapName() string {
 	return m.tapName
 }
 
+// MACAddress returns the guest NIC's MAC address.
+func (m *LinuxMachine) MACAddress() string {
+	return m.macAddress
+}
+
 func (m *LinuxMachine) PID() int {
 	return m.pid
 }
@@ -703,7 +963,9 @@ func (m *LinuxMachine) Close(ctx context.Context) error {
 			errs = append(errs, errx.Wrap(ErrStop, err))
 		}
 		// Wait for process to fully exit
-		m.cmd.Wait()
+		if m.exited != nil {
+			<-m.exited
+		}
 	}
 
 	if m.tapFD > 0 {
@@ -718,6 +980,12 @@ func (m *LinuxMachine) Close(ctx context.Context) error {
 		}
 	}
 
+	if m.cgroupDir != "" {
+		if err := removeVMCgroup(m.cgroupDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if len(errs) > 0 {
 		return errs[0]
 	}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package linux
+
+import (
+	"bufio"
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/vm"
+)
+
+// startTermIgnoringProcess stands in for a Firecracker process that does
+// not exit on SIGTERM.
+func startTermIgnoringProcess(t *testing.T, config *vm.VMConfig) *LinuxMachine {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", `trap "" TERM; echo ready; exec sleep 30`)
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	_, err = bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+
+	m := &LinuxMachine{config: config, cmd: cmd, exited: make(chan struct{})}
+	go m.reap(context.Background())
+	return m
+}
+
+func TestStopWaitsForGracePeriod(t *testing.T) {
+	grace := 500 * time.Millisecond
+	m := startTermIgnoringProcess(t, &vm.VMConfig{StopGracePeriod: grace})
+
+	start := time.Now()
+	require.NoError(t, m.Stop(context.Background()))
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, grace, "Stop must give the VM its grace period before SIGKILL")
+	assert.Less(t, elapsed, defaultStopGracePeriod, "the configured grace period replaces the default")
+}
+
+func TestStopContextDeadlineOverridesGracePeriod(t *testing.T) {
+	m := startTermIgnoringProcess(t, &vm.VMConfig{StopGracePeriod: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	require.NoError(t, m.Stop(ctx))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
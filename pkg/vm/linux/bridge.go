@@ -0,0 +1,76 @@
+//go:build linux
+
+package linux
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"golang.org/x/sys/unix"
+)
+
+// EnsureBridge creates the bridge name if it does not exist yet and gives
+// it the gateway address cidr. VMs share it, so it is never deleted here.
+func EnsureBridge(name, cidr string) error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return errx.Wrap(ErrCreateSocket, err)
+	}
+	defer syscall.Close(fd)
+
+	var ifname [ifnameLen]byte
+	copy(ifname[:], name)
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+		unix.SIOCBRADDBR, uintptr(unsafe.Pointer(&ifname[0]))); errno != 0 && !errors.Is(errno, syscall.EEXIST) {
+		return errx.With(ErrSIOCBRADDBR, " %s: %w", name, errno)
+	}
+
+	// Re-applying the same address and netmask is a no-op, so VMs
+	// already on the bridge keep their connections.
+	return ConfigureInterface(name, cidr)
+}
+
+// AttachToBridge adds the TAP port to bridge and brings it up. A port
+// already on bridge is left as it is.
+func AttachToBridge(bridge, port string) error {
+	iface, err := net.InterfaceByName(port)
+	if err != nil {
+		return errx.With(ErrInterfaceNotFound, " %s: %w", port, err)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return errx.Wrap(ErrCreateSocket, err)
+	}
+	defer syscall.Close(fd)
+
+	if bridgeOf(port) != bridge {
+		var ifr struct {
+			name    [ifnameLen]byte
+			ifindex int32
+			_       [20]byte
+		}
+		copy(ifr.name[:], bridge)
+		ifr.ifindex = int32(iface.Index)
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+			unix.SIOCBRADDIF, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+			return errx.With(ErrSIOCBRADDIF, " %s to %s: %w", port, bridge, errno)
+		}
+	}
+
+	return interfaceUp(fd, port)
+}
+
+// bridgeOf returns the bridge port is enslaved to, or "".
+func bridgeOf(port string) string {
+	target, err := os.Readlink(filepath.Join("/sys/class/net", port, "brport", "bridge"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(target)
+}
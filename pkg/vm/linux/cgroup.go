@@ -0,0 +1,64 @@
+//go:build linux
+
+package linux
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// cgroupRoot is where the host's cgroup v2 hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// createVMCgroup creates the cgroup matchlock-<id> under parent for the
+// VM's Firecracker process and returns its directory. The cpu and memory
+// controllers are enabled for it where the parent allows; without them
+// the cgroup still groups the process but reports less.
+func createVMCgroup(parent, id string) (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", errx.With(ErrCgroup, ": cgroup v2 is not mounted at %s: %w", cgroupRoot, err)
+	}
+	parentDir := filepath.Join(cgroupRoot, parent)
+	if err := os.MkdirAll(parentDir, 0755); err != nil {
+		return "", errx.Wrap(ErrCgroup, err)
+	}
+	for _, controller := range []string{"+cpu", "+memory"} {
+		_ = os.WriteFile(filepath.Join(parentDir, "cgroup.subtree_control"), []byte(controller), 0644)
+	}
+	dir := filepath.Join(parentDir, "matchlock-"+id)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return "", errx.Wrap(ErrCgroup, err)
+	}
+	return dir, nil
+}
+
+// removeVMCgroup deletes the VM's cgroup once its processes have exited.
+func removeVMCgroup(dir string) error {
+	if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		return errx.Wrap(ErrCgroup, err)
+	}
+	return nil
+}
+
+// cgroupUsage reads the CPU time (usage_usec in cpu.stat) and memory
+// (memory.current) charged to the cgroup at dir. Values whose files are
+// missing, e.g. with the memory controller off, are left at zero.
+func cgroupUsage(dir string) (cpuUsec, memoryBytes uint64) {
+	if data, err := os.ReadFile(filepath.Join(dir, "cpu.stat")); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "usage_usec "); ok {
+				cpuUsec, _ = strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+				break
+			}
+		}
+	}
+	memoryBytes, _ = readCounter(filepath.Join(dir, "memory.current"))
+	return cpuUsec, memoryBytes
+}
@@ -21,15 +21,37 @@ var (
 	ErrSIOCSIFNETMASK    = errors.New("SIOCSIFNETMASK")
 	ErrSIOCGIFFLAGS      = errors.New("SIOCGIFFLAGS")
 	ErrSIOCSIFFLAGS      = errors.New("SIOCSIFFLAGS")
+	ErrBridge            = errors.New("attach TAP to bridge")
+	ErrSIOCBRADDBR       = errors.New("SIOCBRADDBR")
+	ErrSIOCBRADDIF       = errors.New("SIOCBRADDIF")
 )
 
 // Firecracker lifecycle errors
 var (
+	ErrNoKVM            = errors.New("KVM unavailable")
 	ErrWriteConfig      = errors.New("write firecracker config")
 	ErrCreateLogFile    = errors.New("create log file")
 	ErrStartFirecracker = errors.New("start firecracker")
 	ErrVMNotReady       = errors.New("VM failed to become ready")
 	ErrVMReadyTimeout   = errors.New("timeout waiting for VM ready signal")
+	ErrVMExited         = errors.New("firecracker exited unexpectedly")
+	ErrCPUAffinity      = errors.New("set CPU affinity")
+	ErrCgroup           = errors.New("VM cgroup")
+	ErrFirecrackerAPI   = errors.New("firecracker API")
+)
+
+// Snapshot errors
+var (
+	ErrVMNotStarted     = errors.New("VM is not running")
+	ErrSnapshotCreate   = errors.New("create VM snapshot")
+	ErrSnapshotLoad     = errors.New("load VM snapshot")
+	ErrSnapshotDisk     = errors.New("copy snapshot disk")
+	ErrSnapshotMetadata = errors.New("snapshot drive metadata")
+)
+
+// Metrics errors
+var (
+	ErrMetrics = errors.New("read VM metrics")
 )
 
 // Vsock errors
@@ -0,0 +1,87 @@
+//go:build linux
+
+package linux
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// firecrackerAPI talks to a Firecracker process over its --api-sock.
+type firecrackerAPI struct {
+	socketPath string
+	client     *http.Client
+}
+
+func newFirecrackerAPI(socketPath string) *firecrackerAPI {
+	return &firecrackerAPI{
+		socketPath: socketPath,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// call sends body as JSON and treats any non-2xx status as an error carrying
+// Firecracker's fault message.
+func (a *firecrackerAPI) call(ctx context.Context, method, path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errx.With(ErrFirecrackerAPI, " %s %s: %w", method, path, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, bytes.NewReader(data))
+	if err != nil {
+		return errx.With(ErrFirecrackerAPI, " %s %s: %w", method, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return errx.With(ErrFirecrackerAPI, " %s %s: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var fault struct {
+		FaultMessage string `json:"fault_message"`
+	}
+	if json.Unmarshal(respBody, &fault) == nil && fault.FaultMessage != "" {
+		return errx.With(ErrFirecrackerAPI, " %s %s: %s: %s", method, path, resp.Status, fault.FaultMessage)
+	}
+	return errx.With(ErrFirecrackerAPI, " %s %s: %s", method, path, resp.Status)
+}
+
+// waitForSocket waits for Firecracker to create its API socket.
+func (a *firecrackerAPI) waitForSocket(ctx context.Context, exited <-chan struct{}, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(a.socketPath); err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-exited:
+			return ErrVMExited
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return errx.With(ErrFirecrackerAPI, ": timed out waiting for %s", a.socketPath)
+}
@@ -0,0 +1,36 @@
+//go:build linux
+
+package linux
+
+import (
+	"errors"
+	"os"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// kvmDevice is the device Firecracker opens to create the VM.
+const kvmDevice = "/dev/kvm"
+
+// CheckKVM fails fast with ErrNoKVM when /dev/kvm cannot be opened read-write,
+// which Firecracker would otherwise only report as an opaque early exit.
+// The error names the cause and how to fix it.
+func CheckKVM() error {
+	f, err := os.OpenFile(kvmDevice, os.O_RDWR, 0)
+	if err != nil {
+		return errx.With(ErrNoKVM, ": %w; %s", err, kvmHint(err))
+	}
+	return f.Close()
+}
+
+// kvmHint returns the remediation for an error opening /dev/kvm.
+func kvmHint(err error) string {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return "enable virtualization in BIOS/UEFI (or nested virtualization when running inside a VM) and load the module: sudo modprobe kvm_intel (or kvm_amd)"
+	case errors.Is(err, os.ErrPermission):
+		return "run 'sudo matchlock setup linux' to add your user to the kvm group, then log in again"
+	default:
+		return "run 'matchlock doctor' for details"
+	}
+}
@@ -0,0 +1,88 @@
+//go:build linux
+
+package linux
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/api"
+	"github.com/jingkaihe/matchlock/pkg/vsock"
+)
+
+// Metrics samples the VM's resource usage. CPU time, memory and active
+// execs come from the guest agent; Firecracker's RSS, the VM cgroup's
+// usage and the TAP byte counters are read on the host. The TAP counters
+// are from the host's side of the device, so its tx is what the guest
+// received.
+func (m *LinuxMachine) Metrics(ctx context.Context) (*api.Stats, error) {
+	if err := m.checkRunning(); err != nil {
+		return nil, err
+	}
+
+	conn, err := m.dialVsock(m.config.VsockPorts.Port(vsock.ServiceExec))
+	if err != nil {
+		return nil, errx.Wrap(ErrMetrics, err)
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	stats, err := vsock.QueryStats(conn)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errx.Wrap(ErrMetrics, err)
+	}
+	stats.Time = time.Now()
+
+	if rss, err := processRSS(m.pid); err == nil {
+		stats.VMMRSSBytes = rss
+	}
+	if m.cgroupDir != "" {
+		stats.CgroupCPUUsageUsec, stats.CgroupMemoryBytes = cgroupUsage(m.cgroupDir)
+	}
+	if m.tapName != "" {
+		dir := filepath.Join("/sys/class/net", m.tapName, "statistics")
+		stats.NetRxBytes, _ = readCounter(filepath.Join(dir, "tx_bytes"))
+		stats.NetTxBytes, _ = readCounter(filepath.Join(dir, "rx_bytes"))
+	}
+	return stats, nil
+}
+
+// processRSS returns VmRSS from /proc/<pid>/status in bytes.
+func processRSS(pid int) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "status"))
+	if err != nil {
+		return 0, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	return 0, errx.With(ErrMetrics, ": no VmRSS for pid %d", pid)
+}
+
+func readCounter(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
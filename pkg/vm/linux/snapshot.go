@@ -0,0 +1,319 @@
+//go:build linux
+
+package linux
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+	"github.com/jingkaihe/matchlock/pkg/vm"
+	"golang.org/x/sys/unix"
+)
+
+// Files written by Snapshot, relative to the snapshot directory.
+const (
+	snapshotStateFile  = "vmstate"
+	snapshotMemoryFile = "memory"
+	snapshotDrivesFile = "drives.json"
+	snapshotDisksDir   = "disks"
+)
+
+// snapshotDrive records a drive as it was when the snapshot was taken.
+// Firecracker reopens drives at their recorded paths when it loads the
+// snapshot, so Restore has to know them.
+type snapshotDrive struct {
+	ID     string `json:"id"`
+	Path   string `json:"path"`
+	Copied bool   `json:"copied,omitempty"` // saved as disks/<id>.ext4
+}
+
+// Pause stops the guest's vCPUs.
+func (m *LinuxMachine) Pause(ctx context.Context) error {
+	if err := m.checkRunning(); err != nil {
+		return err
+	}
+	if err := newFirecrackerAPI(m.config.SocketPath).call(ctx, http.MethodPatch, "/vm", map[string]string{"state": "Paused"}); err != nil {
+		return err
+	}
+	m.paused.Store(true)
+	return nil
+}
+
+// Resume restarts the guest's vCPUs after Pause.
+func (m *LinuxMachine) Resume(ctx context.Context) error {
+	if err := m.checkRunning(); err != nil {
+		return err
+	}
+	if err := newFirecrackerAPI(m.config.SocketPath).call(ctx, http.MethodPatch, "/vm", map[string]string{"state": "Resumed"}); err != nil {
+		return err
+	}
+	m.paused.Store(false)
+	return nil
+}
+
+func (m *LinuxMachine) checkRunning() error {
+	if !m.started || m.exited == nil {
+		return ErrVMNotStarted
+	}
+	select {
+	case <-m.exited:
+		return m.exitError()
+	default:
+		return nil
+	}
+}
+
+// Snapshot writes a full snapshot of the VM into dir: Firecracker's device
+// state and memory files, plus copies of the disks the VM owns (its rootfs
+// or rootfs overlay, and its kernel modules disk). Extra disks are host
+// volumes and are recorded by path only. A running guest is paused for the
+// duration and resumed afterwards; a guest paused by the caller stays
+// paused.
+func (m *LinuxMachine) Snapshot(ctx context.Context, dir string) (retErr error) {
+	if err := m.checkRunning(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(dir, snapshotDisksDir), 0700); err != nil {
+		return errx.Wrap(ErrSnapshotCreate, err)
+	}
+	if !m.paused.Load() {
+		if err := m.Pause(ctx); err != nil {
+			return errx.Wrap(ErrSnapshotCreate, err)
+		}
+		defer func() {
+			if err := m.Resume(context.WithoutCancel(ctx)); err != nil && retErr == nil {
+				retErr = err
+			}
+		}()
+	}
+
+	err := newFirecrackerAPI(m.config.SocketPath).call(ctx, http.MethodPut, "/snapshot/create", map[string]string{
+		"snapshot_type": "Full",
+		"snapshot_path": filepath.Join(dir, snapshotStateFile),
+		"mem_file_path": filepath.Join(dir, snapshotMemoryFile),
+	})
+	if err != nil {
+		return errx.Wrap(ErrSnapshotCreate, err)
+	}
+
+	var recorded []snapshotDrive
+	for _, d := range m.drives() {
+		sd := snapshotDrive{ID: d.DriveID, Path: d.PathOnHost}
+		if ownedDrive(d) {
+			if err := cloneFile(d.PathOnHost, snapshotDiskPath(dir, d.DriveID)); err != nil {
+				return errx.With(ErrSnapshotDisk, " %s: %w", d.DriveID, err)
+			}
+			sd.Copied = true
+		}
+		recorded = append(recorded, sd)
+	}
+	data, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return errx.Wrap(ErrSnapshotMetadata, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotDrivesFile), data, 0600); err != nil {
+		return errx.Wrap(ErrSnapshotMetadata, err)
+	}
+	return nil
+}
+
+// ownedDrive reports whether a drive belongs to this VM alone, as opposed
+// to a shared read-only base or a host volume, and so must be captured.
+func ownedDrive(d fcDrive) bool {
+	return (d.DriveID == "rootfs" && !d.IsReadOnly) || d.DriveID == "rootfs_overlay" || d.DriveID == "kernel_modules"
+}
+
+func snapshotDiskPath(dir, driveID string) string {
+	return filepath.Join(dir, snapshotDisksDir, driveID+".ext4")
+}
+
+// Restore creates a machine that resumes the snapshot in snapshotDir on
+// Start. The snapshot's disks are copied to the paths config gives them,
+// and the TAP device and vsock socket are the new machine's own.
+func (b *LinuxBackend) Restore(ctx context.Context, config *vm.VMConfig, snapshotDir string) (vm.Machine, error) {
+	data, err := os.ReadFile(filepath.Join(snapshotDir, snapshotDrivesFile))
+	if err != nil {
+		return nil, errx.Wrap(ErrSnapshotMetadata, err)
+	}
+	var drives []snapshotDrive
+	if err := json.Unmarshal(data, &drives); err != nil {
+		return nil, errx.Wrap(ErrSnapshotMetadata, err)
+	}
+
+	machine, err := b.Create(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	m := machine.(*LinuxMachine)
+	m.restoreDir = snapshotDir
+	m.restoreDrives = drives
+
+	for _, d := range drives {
+		if !d.Copied {
+			continue
+		}
+		dst := m.drivePath(d.ID)
+		if dst == "" {
+			m.Close(ctx)
+			return nil, errx.With(ErrSnapshotLoad, ": snapshot drive %s has no counterpart in the new VM", d.ID)
+		}
+		if err := cloneFile(snapshotDiskPath(snapshotDir, d.ID), dst); err != nil {
+			m.Close(ctx)
+			return nil, errx.With(ErrSnapshotDisk, " %s: %w", d.ID, err)
+		}
+	}
+	return m, nil
+}
+
+func (m *LinuxMachine) drivePath(id string) string {
+	for _, d := range m.drives() {
+		if d.DriveID == id {
+			return d.PathOnHost
+		}
+	}
+	return ""
+}
+
+// loadSnapshot loads restoreDir into the freshly started Firecracker
+// process. The network interface and vsock device are pointed at this
+// machine's TAP and socket, drives are moved to this machine's disks, and
+// only then is the guest resumed.
+func (m *LinuxMachine) loadSnapshot(ctx context.Context) error {
+	api := newFirecrackerAPI(m.config.SocketPath)
+	if err := api.waitForSocket(ctx, m.exited, 5*time.Second); err != nil {
+		return errx.Wrap(ErrSnapshotLoad, err)
+	}
+
+	cleanup, err := stageRecordedDrivePaths(m.restoreDrives, m.drivePath)
+	if err != nil {
+		return errx.Wrap(ErrSnapshotLoad, err)
+	}
+	defer cleanup()
+
+	load := map[string]any{
+		"snapshot_path": filepath.Join(m.restoreDir, snapshotStateFile),
+		"mem_backend": map[string]string{
+			"backend_type": "File",
+			"backend_path": filepath.Join(m.restoreDir, snapshotMemoryFile),
+		},
+		"resume_vm": false,
+		"network_overrides": []map[string]string{
+			{"iface_id": "eth0", "host_dev_name": m.tapName},
+		},
+	}
+	if m.config.VsockPath != "" {
+		load["vsock_override"] = map[string]string{"uds_path": m.config.VsockPath}
+	}
+	if err := api.call(ctx, http.MethodPut, "/snapshot/load", load); err != nil {
+		return errx.Wrap(ErrSnapshotLoad, err)
+	}
+
+	for _, d := range m.restoreDrives {
+		path := m.drivePath(d.ID)
+		if path == "" || path == d.Path {
+			continue
+		}
+		err := api.call(ctx, http.MethodPatch, "/drives/"+d.ID, map[string]string{
+			"drive_id":     d.ID,
+			"path_on_host": path,
+		})
+		if err != nil {
+			return errx.Wrap(ErrSnapshotLoad, err)
+		}
+	}
+
+	if err := api.call(ctx, http.MethodPatch, "/vm", map[string]string{"state": "Resumed"}); err != nil {
+		return errx.Wrap(ErrSnapshotLoad, err)
+	}
+	return nil
+}
+
+// stageRecordedDrivePaths makes every drive path recorded in the snapshot
+// openable while Firecracker loads it. A recorded path that no longer
+// exists, typically because the source VM's state directory was removed,
+// gets a temporary symlink to this machine's disk. loadSnapshot repoints
+// the drives before the guest resumes, so the symlinks are only needed
+// during the load; the returned cleanup removes them and any directories
+// created for them.
+func stageRecordedDrivePaths(drives []snapshotDrive, current func(id string) string) (func(), error) {
+	var created []string
+	cleanup := func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			os.Remove(created[i])
+		}
+	}
+	for _, d := range drives {
+		target := current(d.ID)
+		if target == "" || target == d.Path {
+			continue
+		}
+		if _, err := os.Lstat(d.Path); err == nil {
+			continue
+		}
+		dirs, err := mkdirAllTracked(filepath.Dir(d.Path))
+		created = append(created, dirs...)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		if err := os.Symlink(target, d.Path); err != nil {
+			cleanup()
+			return nil, err
+		}
+		created = append(created, d.Path)
+	}
+	return cleanup, nil
+}
+
+// mkdirAllTracked is os.MkdirAll that returns the directories it created,
+// outermost first.
+func mkdirAllTracked(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	var created []string
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0700); err != nil {
+			if errors.Is(err, os.ErrExist) {
+				continue
+			}
+			return created, err
+		}
+		created = append(created, missing[i])
+	}
+	return created, nil
+}
+
+// cloneFile copies src to dst, sharing blocks via FICLONE when the
+// filesystem supports it.
+func cloneFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlFileClone(int(out.Fd()), int(in.Fd())); err == nil {
+		return out.Close()
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -97,6 +97,12 @@ func ConfigureInterface(name, cidr string) error {
 		return errx.Wrap(ErrSIOCSIFNETMASK, errno)
 	}
 
+	_ = iface
+	return interfaceUp(fd, name)
+}
+
+// interfaceUp sets IFF_UP and IFF_RUNNING on name using the socket fd.
+func interfaceUp(fd int, name string) error {
 	var flagReq struct {
 		name  [ifnameLen]byte
 		flags int16
@@ -115,8 +121,6 @@ func ConfigureInterface(name, cidr string) error {
 		syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&flagReq))); errno != 0 {
 		return errx.Wrap(ErrSIOCSIFFLAGS, errno)
 	}
-
-	_ = iface
 	return nil
 }
 
@@ -11,6 +11,11 @@ var (
 	ErrConnect      = errors.New("connect to vsock")
 )
 
+// Port registry errors
+var (
+	ErrInvalidPorts = errors.New("invalid vsock port assignment")
+)
+
 // Device/CID errors
 var (
 	ErrOpenDevice  = errors.New("open /dev/vsock")
@@ -29,4 +34,16 @@ var (
 	ErrReadPortForwardResponse  = errors.New("read port-forward response")
 	ErrPortForwardRejected      = errors.New("port-forward rejected")
 	ErrUnexpectedPortForwardMsg = errors.New("unexpected port-forward response message")
+
+	ErrEncodeDiskUsageRequest = errors.New("encode disk usage request")
+	ErrReadDiskUsageResponse  = errors.New("read disk usage response")
+	ErrDiskUsageRejected      = errors.New("disk usage rejected")
+
+	ErrReadStatsResponse = errors.New("read stats response")
+	ErrStatsRejected     = errors.New("stats rejected")
+
+	ErrEncodeTailRequest = errors.New("encode tail request")
+	ErrReadTailResponse  = errors.New("read tail response")
+	ErrTailRejected      = errors.New("tail rejected")
+	ErrWriteTailOutput   = errors.New("write tail output")
 )
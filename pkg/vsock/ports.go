@@ -0,0 +1,125 @@
+package vsock
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jingkaihe/matchlock/internal/errx"
+)
+
+// Service names in the vsock port registry. The host and the guest agree
+// on which port each service uses through Ports rather than hardcoding
+// numbers on both sides.
+const (
+	ServiceExec   = "exec"   // host -> guest: exec, streams, port-forward, tail
+	ServiceVFS    = "vfs"    // guest -> host: workspace VFS
+	ServiceReady  = "ready"  // host -> guest: ready check
+	ServiceAudit  = "audit"  // guest -> host: seccomp audit records
+	ServicePolicy = "policy" // guest -> host: network policy queries
+	ServiceSocket = "socket" // guest -> host: unix socket mounts
+)
+
+// portsParam is the kernel cmdline key carrying non-default assignments.
+const portsParam = "matchlock.vsock_ports="
+
+// Ports maps service names to vsock ports. A nil or partial Ports falls
+// back to DefaultPorts for missing services.
+type Ports map[string]uint32
+
+// DefaultPorts returns the port assignment used when nothing overrides it.
+func DefaultPorts() Ports {
+	return Ports{
+		ServiceExec:   ServicePortExec,
+		ServiceVFS:    ServicePortVFS,
+		ServiceReady:  ServicePortReady,
+		ServiceAudit:  ServicePortAudit,
+		ServicePolicy: ServicePortPolicy,
+		ServiceSocket: ServicePortSocket,
+	}
+}
+
+// Port returns the port assigned to service, or its default when p has no
+// entry. Unknown services return 0.
+func (p Ports) Port(service string) uint32 {
+	if port, ok := p[service]; ok {
+		return port
+	}
+	return DefaultPorts()[service]
+}
+
+// Validate rejects unknown services, port 0, VMADDR_PORT_ANY and ports
+// shared by two services once defaults are filled in.
+func (p Ports) Validate() error {
+	for service, port := range p {
+		if _, ok := DefaultPorts()[service]; !ok {
+			return errx.With(ErrInvalidPorts, ": unknown service %q", service)
+		}
+		if port == 0 || port == VMADDR_PORT_ANY {
+			return errx.With(ErrInvalidPorts, ": invalid port %d for %s", port, service)
+		}
+	}
+	owner := make(map[uint32]string)
+	for _, service := range sortedServices() {
+		port := p.Port(service)
+		if other, ok := owner[port]; ok {
+			return errx.With(ErrInvalidPorts, ": %s and %s both use port %d", other, service, port)
+		}
+		owner[port] = service
+	}
+	return nil
+}
+
+// KernelParam returns the matchlock.vsock_ports= cmdline param (with a
+// leading space) listing the assignments that differ from the defaults, or
+// "" when p uses the defaults throughout.
+func (p Ports) KernelParam() string {
+	defaults := DefaultPorts()
+	var entries []string
+	for _, service := range sortedServices() {
+		if port := p.Port(service); port != defaults[service] {
+			entries = append(entries, service+":"+strconv.FormatUint(uint64(port), 10))
+		}
+	}
+	if len(entries) == 0 {
+		return ""
+	}
+	return " " + portsParam + strings.Join(entries, ",")
+}
+
+// ParsePorts reads matchlock.vsock_ports=service:port,... from a kernel
+// cmdline on top of the defaults. Malformed and unknown entries are
+// skipped; the host validates the assignment before boot.
+func ParsePorts(cmdline string) Ports {
+	ports := DefaultPorts()
+	for _, field := range strings.Fields(cmdline) {
+		value, ok := strings.CutPrefix(field, portsParam)
+		if !ok {
+			continue
+		}
+		for _, entry := range strings.Split(value, ",") {
+			service, raw, ok := strings.Cut(entry, ":")
+			if !ok {
+				continue
+			}
+			if _, known := ports[service]; !known {
+				continue
+			}
+			port, err := strconv.ParseUint(raw, 10, 32)
+			if err != nil || port == 0 {
+				continue
+			}
+			ports[service] = uint32(port)
+		}
+	}
+	return ports
+}
+
+func sortedServices() []string {
+	services := make([]string, 0, len(DefaultPorts()))
+	for service := range DefaultPorts() {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
@@ -0,0 +1,56 @@
+package vsock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPortsPortFallsBackToDefaults(t *testing.T) {
+	var nilPorts Ports
+	assert.Equal(t, uint32(ServicePortExec), nilPorts.Port(ServiceExec))
+	assert.Equal(t, uint32(6001), Ports{ServiceVFS: 6001}.Port(ServiceVFS))
+	assert.Equal(t, uint32(ServicePortReady), Ports{ServiceVFS: 6001}.Port(ServiceReady))
+	assert.Zero(t, nilPorts.Port("stats"))
+}
+
+func TestPortsValidate(t *testing.T) {
+	require.NoError(t, DefaultPorts().Validate())
+	require.NoError(t, Ports(nil).Validate())
+	require.NoError(t, Ports{ServiceExec: 6000}.Validate())
+
+	assert.ErrorIs(t, Ports{"stats": 6000}.Validate(), ErrInvalidPorts)
+	assert.ErrorIs(t, Ports{ServiceExec: 0}.Validate(), ErrInvalidPorts)
+	assert.ErrorIs(t, Ports{ServiceExec: VMADDR_PORT_ANY}.Validate(), ErrInvalidPorts)
+
+	err := Ports{ServiceExec: ServicePortVFS}.Validate()
+	require.ErrorIs(t, err, ErrInvalidPorts)
+	assert.Contains(t, err.Error(), "exec and vfs both use port 5001")
+}
+
+func TestPortsKernelParamRoundTrip(t *testing.T) {
+	assert.Empty(t, DefaultPorts().KernelParam())
+	assert.Empty(t, Ports(nil).KernelParam())
+
+	ports := Ports{ServiceVFS: 6001, ServiceExec: 6000}
+	param := ports.KernelParam()
+	assert.Equal(t, " matchlock.vsock_ports=exec:6000,vfs:6001", param)
+
+	parsed := ParsePorts("console=ttyS0" + param + " quiet")
+	assert.Equal(t, uint32(6000), parsed.Port(ServiceExec))
+	assert.Equal(t, uint32(6001), parsed.Port(ServiceVFS))
+	assert.Equal(t, uint32(ServicePortReady), parsed.Port(ServiceReady))
+}
+
+func TestParsePortsSkipsMalformedEntries(t *testing.T) {
+	parsed := ParsePorts("matchlock.vsock_ports=exec:6000,stats:7000,vfs,ready:0,audit:x,policy:99999999999")
+	assert.Equal(t, uint32(6000), parsed.Port(ServiceExec))
+	assert.Equal(t, DefaultPorts().Port(ServiceVFS), parsed.Port(ServiceVFS))
+	assert.Equal(t, DefaultPorts().Port(ServiceReady), parsed.Port(ServiceReady))
+	assert.Equal(t, DefaultPorts().Port(ServiceAudit), parsed.Port(ServiceAudit))
+	assert.Equal(t, DefaultPorts().Port(ServicePolicy), parsed.Port(ServicePolicy))
+	assert.NotContains(t, parsed, "stats")
+
+	assert.Equal(t, DefaultPorts(), ParsePorts(""))
+}
@@ -38,6 +38,12 @@ const (
 	ServicePortVFS = 5001
 	// ServicePortReady is the guest ready-check service port.
 	ServicePortReady = 5002
+	// ServicePortAudit is the host port receiving guest seccomp audit records.
+	ServicePortAudit = 5003
+	// ServicePortPolicy is the host port answering guest network policy queries.
+	ServicePortPolicy = 5004
+	// ServicePortSocket is the host port proxying guest unix socket mounts.
+	ServicePortSocket = 5005
 )
 
 // sockaddrVM is the sockaddr_vm structure for vsock
@@ -240,27 +246,50 @@ const (
 	MsgTypeExecStream  uint8 = 11 // Streaming batch: stdout/stderr sent as chunks, then ExecResult
 	MsgTypeExecPipe    uint8 = 12 // Pipe mode: like ExecStream but also accepts MsgTypeStdin, sends MsgTypeExit
 	MsgTypePortForward uint8 = 13 // Request guest-agent to proxy raw TCP to an in-guest address
+	MsgTypeDiskUsage   uint8 = 14 // statfs the requested guest paths; reply is a MsgTypeDiskUsage JSON list
+	MsgTypeTail        uint8 = 15 // Follow a guest file: MsgTypeReady, then appended bytes as MsgTypeStdout
+	MsgTypeStats       uint8 = 16 // Guest CPU, memory and exec counters; reply is a MsgTypeStats JSON object
 )
 
 // ExecRequest is sent from host to guest to execute a command
 type ExecRequest struct {
 	Command    string            `json:"command"`
-	Args       []string          `json:"args,omitempty"`
+	Args       []string          `json:"args,omitempty"`  // run directly as argv, without a shell
+	Shell      []string          `json:"shell,omitempty"` // shell argv command is appended to (default: sh -c)
 	WorkingDir string            `json:"working_dir,omitempty"`
 	Env        map[string]string `json:"env,omitempty"`
 	Stdin      []byte            `json:"stdin,omitempty"`
 	User       string            `json:"user,omitempty"` // "uid", "uid:gid", or username
+	LoginShell bool              `json:"login_shell,omitempty"`
+	TimeoutMS  int               `json:"timeout_ms,omitempty"` // guest kills the process group after this (0 = none)
+	Setup      bool              `json:"setup,omitempty"`      // privileged setup exec, refused after the first ordinary exec
 }
 
+// ExecErrorTimeout is the ExecResponse.Error of a command the guest killed
+// because ExecRequest.TimeoutMS elapsed.
+const ExecErrorTimeout = "timeout"
+
 // ExecTTYRequest is sent from host to guest for interactive execution
 type ExecTTYRequest struct {
 	Command    string            `json:"command"`
-	Args       []string          `json:"args,omitempty"`
+	Args       []string          `json:"args,omitempty"`  // run directly as argv, without a shell
+	Shell      []string          `json:"shell,omitempty"` // shell argv command is appended to (default: sh -c)
 	WorkingDir string            `json:"working_dir,omitempty"`
 	Env        map[string]string `json:"env,omitempty"`
 	Rows       uint16            `json:"rows"`
 	Cols       uint16            `json:"cols"`
 	User       string            `json:"user,omitempty"` // "uid", "uid:gid", or username
+	LoginShell bool              `json:"login_shell,omitempty"`
+}
+
+// DiskUsageRequest asks the guest agent to statfs each of Paths.
+type DiskUsageRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// TailRequest asks the guest agent to follow the file at Path.
+type TailRequest struct {
+	Path string `json:"path"`
 }
 
 // PortForwardRequest asks the guest agent to dial a TCP destination in guest
@@ -278,10 +307,13 @@ type WindowSize struct {
 
 // ExecResponse is sent from guest to host with execution results
 type ExecResponse struct {
-	ExitCode int    `json:"exit_code"`
-	Stdout   []byte `json:"stdout,omitempty"`
-	Stderr   []byte `json:"stderr,omitempty"`
-	Error    string `json:"error,omitempty"`
+	ExitCode   int    `json:"exit_code"`
+	Stdout     []byte `json:"stdout,omitempty"`
+	Stderr     []byte `json:"stderr,omitempty"`
+	Error      string `json:"error,omitempty"`
+	UserTimeMS int64  `json:"user_time_ms,omitempty"` // CPU time in user mode (0 from older guests)
+	SysTimeMS  int64  `json:"sys_time_ms,omitempty"`  // CPU time in kernel mode
+	MaxRSSKB   int64  `json:"max_rss_kb,omitempty"`   // Peak resident set size
 }
 
 // WriteMessage writes a length-prefixed message to the connection
@@ -14,6 +14,7 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"io"
 
 	"net"
 	"time"
@@ -36,20 +37,20 @@ func ReadFull(conn net.Conn, buf []byte) (int, error) {
 }
 
 // SendMessage writes a framed vsock message (1-byte type + 4-byte big-endian
-// length + payload) to conn.
+// length + payload) to conn. The frame is written in a single Write so
+// concurrent senders on one connection (stdin, resize, signal) never
+// interleave.
 func SendMessage(conn net.Conn, msgType uint8, data []byte) error {
-	header := make([]byte, 5)
-	header[0] = msgType
-	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
-	if _, err := conn.Write(header); err != nil {
-		return err
-	}
-	if len(data) > 0 {
-		if _, err := conn.Write(data); err != nil {
-			return err
-		}
-	}
-	return nil
+	_, err := conn.Write(frameMessage(msgType, data))
+	return err
+}
+
+func frameMessage(msgType uint8, data []byte) []byte {
+	frame := make([]byte, 5+len(data))
+	frame[0] = msgType
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	return frame
 }
 
 // OpenPortForward sends a port-forward request on an already-connected guest-agent
@@ -92,9 +93,111 @@ func OpenPortForward(conn net.Conn, host string, port uint16) error {
 	return errx.With(ErrUnexpectedPortForwardMsg, ": type=%d", msgType)
 }
 
+// QueryDiskUsage asks the guest agent on an already-connected stream to
+// statfs paths and returns one entry per path, in order. Kind is left empty.
+func QueryDiskUsage(conn net.Conn, paths []string) ([]api.DiskUsage, error) {
+	reqData, err := json.Marshal(DiskUsageRequest{Paths: paths})
+	if err != nil {
+		return nil, errx.Wrap(ErrEncodeDiskUsageRequest, err)
+	}
+	if err := SendMessage(conn, MsgTypeDiskUsage, reqData); err != nil {
+		return nil, errx.Wrap(ErrWriteRequest, err)
+	}
+
+	header := make([]byte, 5)
+	if _, err := ReadFull(conn, header); err != nil {
+		return nil, errx.Wrap(ErrReadDiskUsageResponse, err)
+	}
+	msgType := header[0]
+	data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := ReadFull(conn, data); err != nil {
+		return nil, errx.Wrap(ErrReadDiskUsageResponse, err)
+	}
+
+	if msgType != MsgTypeDiskUsage {
+		return nil, errx.With(ErrDiskUsageRejected, ": %s", string(data))
+	}
+	var usage []api.DiskUsage
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, errx.Wrap(ErrReadDiskUsageResponse, err)
+	}
+	return usage, nil
+}
+
+// QueryStats asks the guest agent on an already-connected stream for its
+// CPU, memory and exec counters. Host-side fields are left zero.
+func QueryStats(conn net.Conn) (*api.Stats, error) {
+	if err := SendMessage(conn, MsgTypeStats, nil); err != nil {
+		return nil, errx.Wrap(ErrWriteRequest, err)
+	}
+
+	header := make([]byte, 5)
+	if _, err := ReadFull(conn, header); err != nil {
+		return nil, errx.Wrap(ErrReadStatsResponse, err)
+	}
+	msgType := header[0]
+	data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err := ReadFull(conn, data); err != nil {
+		return nil, errx.Wrap(ErrReadStatsResponse, err)
+	}
+
+	if msgType != MsgTypeStats {
+		return nil, errx.With(ErrStatsRejected, ": %s", string(data))
+	}
+	var stats api.Stats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, errx.Wrap(ErrReadStatsResponse, err)
+	}
+	return &stats, nil
+}
+
+// TailFile asks the guest agent on an already-connected stream to follow
+// the file at path and copies the bytes appended to it into w. It runs
+// until the stream fails, so callers stop it by closing conn.
+func TailFile(conn net.Conn, path string, w io.Writer) error {
+	reqData, err := json.Marshal(TailRequest{Path: path})
+	if err != nil {
+		return errx.Wrap(ErrEncodeTailRequest, err)
+	}
+	if err := SendMessage(conn, MsgTypeTail, reqData); err != nil {
+		return errx.Wrap(ErrWriteRequest, err)
+	}
+
+	header := make([]byte, 5)
+	for {
+		if _, err := ReadFull(conn, header); err != nil {
+			return errx.Wrap(ErrReadTailResponse, err)
+		}
+		msgType := header[0]
+		data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+		if _, err := ReadFull(conn, data); err != nil {
+			return errx.Wrap(ErrReadTailResponse, err)
+		}
+		switch msgType {
+		case MsgTypeReady:
+		case MsgTypeStdout:
+			if _, err := w.Write(data); err != nil {
+				return errx.Wrap(ErrWriteTailOutput, err)
+			}
+		default:
+			return errx.With(ErrTailRejected, ": %s", string(data))
+		}
+	}
+}
+
+// CloseStdin sends the stdin half-close frame, an empty MsgTypeStdin message.
+// The guest closes the process's stdin so it sees EOF, while the connection
+// stays open for output, the exit code and signals. Closing the connection
+// instead cancels the exec.
+func CloseStdin(conn net.Conn) error {
+	return SendMessage(conn, MsgTypeStdin, nil)
+}
+
 // ExecPipe executes a command over a vsock connection with bidirectional
 // stdin/stdout/stderr piping (no PTY). The caller must supply an already-dialed
-// conn; ExecPipe takes ownership and closes it when done.
+// conn; ExecPipe takes ownership and closes it when done. When opts.Stdin
+// reaches EOF the guest's stdin is half-closed with CloseStdin, so the
+// process can finish reading and still deliver all of its output.
 func ExecPipe(ctx context.Context, conn net.Conn, command string, opts *api.ExecOptions) (*api.ExecResult, error) {
 	start := time.Now()
 	defer conn.Close()
@@ -107,6 +210,9 @@ func ExecPipe(ctx context.Context, conn net.Conn, command string, opts *api.Exec
 		req.WorkingDir = opts.WorkingDir
 		req.Env = opts.Env
 		req.User = opts.User
+		req.LoginShell = opts.LoginShell
+		req.Shell = opts.Shell
+		req.Args = opts.Args
 	}
 
 	reqData, err := json.Marshal(req)
@@ -161,7 +267,7 @@ func ExecPipe(ctx context.Context, conn net.Conn, command string, opts *api.Exec
 						return
 					default:
 					}
-					SendMessage(conn, MsgTypeStdin, nil)
+					CloseStdin(conn)
 					return
 				}
 			}
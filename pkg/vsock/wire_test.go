@@ -0,0 +1,146 @@
+package vsock
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jingkaihe/matchlock/pkg/api"
+)
+
+func readTestFrame(t *testing.T, conn net.Conn) (uint8, []byte) {
+	t.Helper()
+	hdr := make([]byte, 5)
+	_, err := ReadFull(conn, hdr)
+	require.NoError(t, err)
+	data := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+	_, err = ReadFull(conn, data)
+	require.NoError(t, err)
+	return hdr[0], data
+}
+
+// TestExecPipeHalfClosesStdin plays a guest running a filter that, like jq or
+// a compiler, reads all of stdin before writing any output.
+func TestExecPipeHalfClosesStdin(t *testing.T) {
+	host, guest := net.Pipe()
+	input := strings.Repeat(`{"n":1}`+"\n", 2000)
+
+	guestErr := make(chan error, 1)
+	go func() {
+		defer guest.Close()
+		msgType, _ := readTestFrame(t, guest)
+		assert.Equal(t, uint8(MsgTypeExecPipe), msgType)
+
+		var stdin bytes.Buffer
+		for {
+			msgType, data := readTestFrame(t, guest)
+			require.Equal(t, uint8(MsgTypeStdin), msgType)
+			if len(data) == 0 {
+				break
+			}
+			stdin.Write(data)
+		}
+
+		// Stdin is closed; the connection must still carry the output.
+		if err := SendMessage(guest, MsgTypeStdout, bytes.ToUpper(stdin.Bytes())); err != nil {
+			guestErr <- err
+			return
+		}
+		exit := make([]byte, 4)
+		binary.BigEndian.PutUint32(exit, 3)
+		guestErr <- SendMessage(guest, MsgTypeExit, exit)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var stdout bytes.Buffer
+	result, err := ExecPipe(ctx, host, "jq .", &api.ExecOptions{
+		Stdin:  strings.NewReader(input),
+		Stdout: &stdout,
+	})
+	require.NoError(t, err)
+	require.NoError(t, <-guestErr)
+	assert.Equal(t, 3, result.ExitCode)
+	assert.Equal(t, strings.ToUpper(input), stdout.String())
+}
+
+func TestCloseStdinSendsEmptyStdinFrame(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	go CloseStdin(a)
+	msgType, data := readTestFrame(t, b)
+	assert.Equal(t, uint8(MsgTypeStdin), msgType)
+	assert.Empty(t, data)
+}
+
+func TestTailFileCopiesAppendedBytes(t *testing.T) {
+	host, guest := net.Pipe()
+
+	go func() {
+		defer guest.Close()
+		msgType, data := readTestFrame(t, guest)
+		assert.Equal(t, uint8(MsgTypeTail), msgType)
+		assert.JSONEq(t, `{"path":"/var/log/app.log"}`, string(data))
+		_ = SendMessage(guest, MsgTypeReady, nil)
+		_ = SendMessage(guest, MsgTypeStdout, []byte("line 1\n"))
+		_ = SendMessage(guest, MsgTypeStdout, []byte("line 2\n"))
+	}()
+
+	var out bytes.Buffer
+	err := TailFile(host, "/var/log/app.log", &out)
+	assert.ErrorIs(t, err, ErrReadTailResponse)
+	assert.Equal(t, "line 1\nline 2\n", out.String())
+}
+
+func TestTailFileRejected(t *testing.T) {
+	host, guest := net.Pipe()
+
+	go func() {
+		defer guest.Close()
+		readTestFrame(t, guest)
+		_ = SendMessage(guest, MsgTypeStderr, []byte("open /missing: no such file or directory"))
+	}()
+
+	err := TailFile(host, "/missing", &bytes.Buffer{})
+	assert.ErrorIs(t, err, ErrTailRejected)
+	assert.Contains(t, err.Error(), "no such file")
+}
+
+func TestQueryStats(t *testing.T) {
+	host, guest := net.Pipe()
+
+	go func() {
+		defer guest.Close()
+		msgType, data := readTestFrame(t, guest)
+		assert.Equal(t, uint8(MsgTypeStats), msgType)
+		assert.Empty(t, data)
+		_ = SendMessage(guest, MsgTypeStats, []byte(`{"cpu_usage_usec":1500,"memory_used_bytes":4096,"memory_total_bytes":8192,"active_execs":2}`))
+	}()
+
+	stats, err := QueryStats(host)
+	require.NoError(t, err)
+	assert.Equal(t, &api.Stats{CPUUsageUsec: 1500, MemoryUsedBytes: 4096, MemoryTotalBytes: 8192, ActiveExecs: 2}, stats)
+}
+
+func TestQueryStatsRejected(t *testing.T) {
+	host, guest := net.Pipe()
+
+	go func() {
+		defer guest.Close()
+		readTestFrame(t, guest)
+		_ = SendMessage(guest, MsgTypeStderr, []byte("read /proc/stat: permission denied"))
+	}()
+
+	_, err := QueryStats(host)
+	assert.ErrorIs(t, err, ErrStatsRejected)
+	assert.Contains(t, err.Error(), "/proc/stat")
+}
@@ -4,6 +4,11 @@ package acceptance
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -139,6 +144,32 @@ func TestSecretInjectedInHTTPSHeader(t *testing.T) {
 	assert.Contains(t, result.Stdout, secretValue, "expected secret value to be injected in HTTPS header")
 }
 
+func TestCustomWorkspaceMountsAndCATrust(t *testing.T) {
+	t.Parallel()
+	hostDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(hostDir, "probe.txt"), []byte("custom-workspace"), 0644), "write probe file")
+	secretValue := "sk-custom-workspace-secret"
+
+	sandbox := sdk.New("alpine:latest").
+		WithWorkspace("/code").
+		MountHostDirReadonly("/code/data", hostDir).
+		AllowHost("httpbin.org").
+		AddSecret("MY_API_KEY", secretValue, "httpbin.org")
+
+	client := launchAlpineWithNetwork(t, sandbox)
+
+	result, err := client.Exec(context.Background(), "pwd && cat /code/data/probe.txt && test ! -e /workspace/data")
+	require.NoError(t, err, "Exec")
+	assert.Equal(t, 0, result.ExitCode, result.Stderr)
+	assert.Equal(t, "/code\ncustom-workspace", strings.TrimSpace(result.Stdout))
+
+	// HTTPS through the interception proxy only works if the guest trusts
+	// the matchlock CA, which must not depend on the workspace path.
+	result, err = client.Exec(context.Background(), `sh -c 'wget -q -O - --header "Authorization: Bearer $MY_API_KEY" https://httpbin.org/headers 2>&1'`)
+	require.NoError(t, err, "Exec")
+	assert.Contains(t, result.Stdout, secretValue, "expected HTTPS interception to work with a custom workspace")
+}
+
 func TestSecretInjectedInHTTPHeader(t *testing.T) {
 	t.Parallel()
 	secretValue := "sk-test-http-secret-67890"
@@ -386,3 +417,50 @@ func TestDNSResolutionWorksWithInterception(t *testing.T) {
 	assert.False(t, strings.Contains(combined, "SERVFAIL") || strings.Contains(combined, "can't resolve"),
 		"expected DNS resolution to work, got: %s", combined)
 }
+
+// ---------------------------------------------------------------------------
+// Allowed private host tests
+// ---------------------------------------------------------------------------
+
+// hostPrivateIP returns the host's outbound IPv4 address when it is private.
+func hostPrivateIP(t *testing.T) string {
+	t.Helper()
+	conn, err := net.Dial("udp4", "8.8.8.8:53")
+	if err != nil {
+		t.Skipf("no outbound IPv4 route: %v", err)
+	}
+	defer conn.Close()
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	if !ip.IsPrivate() {
+		t.Skipf("host outbound address %s is not private", ip)
+	}
+	return ip.String()
+}
+
+func TestAllowedPrivateHostIsReachable(t *testing.T) {
+	t.Parallel()
+	hostIP := hostPrivateIP(t)
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(hostIP, "0"))
+	require.NoError(t, err)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "private-ok")
+	})}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	url := fmt.Sprintf("http://%s/", ln.Addr())
+
+	sandbox := sdk.New("alpine:latest").
+		BlockPrivateIPs().
+		AllowPrivateHost(hostIP)
+	client := launchAlpineWithNetwork(t, sandbox)
+
+	result, err := client.Exec(context.Background(), "wget -q -T 10 -O - "+url+" 2>&1")
+	require.NoError(t, err, "Exec")
+	assert.Contains(t, result.Stdout+result.Stderr, "private-ok", "expected allowed private host to be reachable")
+
+	blocked := launchAlpineWithNetwork(t, sdk.New("alpine:latest").BlockPrivateIPs())
+	result, err = blocked.Exec(context.Background(), "wget -q -T 5 -O - "+url+" 2>&1 || true")
+	require.NoError(t, err, "Exec")
+	assert.NotContains(t, result.Stdout+result.Stderr, "private-ok", "expected private host to stay blocked when not allowed")
+}
@@ -23,6 +23,22 @@ func TestExecSimpleCommand(t *testing.T) {
 	assert.Equal(t, "hello", strings.TrimSpace(result.Stdout))
 }
 
+func TestInitCommandsRunPrivileged(t *testing.T) {
+	t.Parallel()
+	// mount needs CAP_SYS_ADMIN, which workload commands do not have.
+	client := launchWithBuilder(t, sdk.New("alpine:latest").
+		WithInitCommand("mkdir -p /mnt/setup && mount -t tmpfs tmpfs /mnt/setup"))
+
+	result, err := client.Exec(context.Background(), "grep /mnt/setup /proc/mounts")
+	require.NoError(t, err, "Exec")
+	assert.Equal(t, 0, result.ExitCode, "init command's mount should be visible to workload commands")
+	assert.Contains(t, result.Stdout, "tmpfs")
+
+	result, err = client.Exec(context.Background(), "mount -t tmpfs tmpfs /mnt || echo denied")
+	require.NoError(t, err, "Exec")
+	assert.Contains(t, result.Stdout, "denied", "workload commands must not be able to mount")
+}
+
 func TestExecNonZeroExit(t *testing.T) {
 	t.Parallel()
 	t.Skip("known bug: guest agent does not propagate non-zero exit codes")
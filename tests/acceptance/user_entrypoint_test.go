@@ -192,6 +192,21 @@ func TestUserWithCustomWorkdir(t *testing.T) {
 	assert.Equal(t, "65534", lines[1], "uid")
 }
 
+func TestImageOCIEnvPropagation(t *testing.T) {
+	t.Parallel()
+	// python:3.12-alpine declares PYTHON_VERSION and a PATH starting with
+	// /usr/local/bin in its image config; nothing is passed by the client.
+	client := launchWithBuilder(t, sdk.New("python:3.12-alpine"))
+
+	result, err := client.Exec(context.Background(), "echo $PYTHON_VERSION")
+	require.NoError(t, err, "Exec PYTHON_VERSION")
+	assert.True(t, strings.HasPrefix(strings.TrimSpace(result.Stdout), "3.12"), "PYTHON_VERSION=%q", result.Stdout)
+
+	result, err = client.Exec(context.Background(), "echo $PATH")
+	require.NoError(t, err, "Exec PATH")
+	assert.True(t, strings.HasPrefix(strings.TrimSpace(result.Stdout), "/usr/local/bin"), "PATH=%q", result.Stdout)
+}
+
 // --- Python image with real OCI USER ---
 
 func TestPythonImageDefaultUser(t *testing.T) {